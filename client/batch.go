@@ -0,0 +1,349 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrBatchWriterClosed is returned for writes to a closed BatchWriter
+var ErrBatchWriterClosed = errors.New("batch writer is closed")
+
+// BatchOptions configures a BatchWriter. Zero fields take their defaults.
+type BatchOptions struct {
+	MaxWrites     int           // buffered writes that trigger a flush, 500 by default
+	FlushInterval time.Duration // longest time a write stays buffered, 1s by default
+
+	// OnError is called from the flushing goroutine with the writes that failed,
+	// as the flush that sent them cannot return them to the writer. Without it
+	// failures are only counted by Stats.
+	OnError func(BatchError)
+}
+
+// BatchError reports writes of a flush that failed: the whole request when Keys is
+// empty, or the documents and keys listed
+type BatchError struct {
+	Collection string   // the collection of failed document inserts
+	Bucket     string   // the bucket of failed key-value writes, when Collection is empty
+	Keys       []string // ids or keys of the writes that failed, empty when all did
+	Writes     int      // writes sent in the request
+	Err        error
+}
+
+func (e BatchError) Error() string {
+	target := "collection " + e.Collection
+	if e.Collection == "" {
+		target = "bucket " + e.Bucket
+	}
+	if len(e.Keys) == 0 {
+		return fmt.Sprintf("%d writes to %s failed: %v", e.Writes, target, e.Err)
+	}
+	return fmt.Sprintf("%d of %d writes to %s failed: %v", len(e.Keys), e.Writes, target, e.Err)
+}
+
+// BatchStats counts the writes of a BatchWriter
+type BatchStats struct {
+	Buffered int   `json:"buffered"` // waiting for the next flush
+	Flushes  int64 `json:"flushes"`  // requests sent
+	Written  int64 `json:"written"`
+	Failed   int64 `json:"failed"`
+}
+
+// BatchWriter buffers document inserts and key-value writes and sends them in
+// batches through /docs/{collection}/_insertMany and /kv/{bucket}/_mset, once
+// MaxWrites are buffered or FlushInterval has passed, so workloads writing many
+// small documents, such as telemetry, make one request per batch rather than per
+// write. Flushes are made by a goroutine of the writer, in the order the writes
+// were buffered; writes block while a full buffer waits for the previous flush to
+// be sent. Documents and keys are written independently of each other, failures
+// being reported through OnError. A BatchWriter is safe for concurrent use and
+// must be closed to send its last writes.
+type BatchWriter struct {
+	client  *Client
+	options BatchOptions
+
+	pending *pendingWrites
+	closed  bool
+	mutex   sync.Mutex
+	swapped *sync.Cond // signalled when pending is handed to the flushing goroutine
+
+	full     chan struct{}   // pending holds MaxWrites writes
+	requests chan chan error // flushes asked by Flush
+	stop     chan chan error // the last flush, asked by Close
+
+	flushes, written, failed int64 // under statsMutex
+	statsMutex               sync.Mutex
+}
+
+// pendingWrites are the writes buffered for a flush, per collection and bucket in
+// the order they were made
+type pendingWrites struct {
+	documents   map[string][]Document
+	ids         map[string]map[string]bool // ids given to the documents of each collection
+	values      map[string][]keyValue
+	collections []string
+	buckets     []string
+	count       int
+}
+
+type keyValue struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+func newPendingWrites() *pendingWrites {
+	return &pendingWrites{
+		documents: make(map[string][]Document),
+		ids:       make(map[string]map[string]bool),
+		values:    make(map[string][]keyValue),
+	}
+}
+
+// NewBatchWriter returns a writer batching writes to the server of c
+func (c *Client) NewBatchWriter(options BatchOptions) *BatchWriter {
+	if options.MaxWrites <= 0 {
+		options.MaxWrites = 500
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = time.Second
+	}
+	w := &BatchWriter{
+		client:   c,
+		options:  options,
+		pending:  newPendingWrites(),
+		full:     make(chan struct{}, 1),
+		requests: make(chan chan error),
+		stop:     make(chan chan error),
+	}
+	w.swapped = sync.NewCond(&w.mutex)
+	go w.run()
+	return w
+}
+
+// InsertDocument buffers the insert of doc into collection, under the id in its _id
+// field or a generated one
+func (w *BatchWriter) InsertDocument(collection string, doc Document) error {
+	id, given := doc["_id"]
+	if given {
+		if text, ok := id.(string); !ok || text == "" {
+			return fmt.Errorf("_id must be a non-empty string")
+		}
+	}
+	return w.add(func(p *pendingWrites) bool {
+		if given {
+			// The server rejects a batch holding an id twice, so the second write
+			// goes to the next batch, where it conflicts as a separate insert would
+			if p.ids[collection][id.(string)] {
+				return false
+			}
+			if p.ids[collection] == nil {
+				p.ids[collection] = make(map[string]bool)
+			}
+			p.ids[collection][id.(string)] = true
+		}
+		if _, exists := p.documents[collection]; !exists {
+			p.collections = append(p.collections, collection)
+		}
+		p.documents[collection] = append(p.documents[collection], doc)
+		return true
+	})
+}
+
+// SetValue buffers setting key to value in bucket, the default bucket when empty.
+// A key set twice in a batch takes the later value.
+func (w *BatchWriter) SetValue(bucket, key string, value interface{}) error {
+	return w.add(func(p *pendingWrites) bool {
+		if _, exists := p.values[bucket]; !exists {
+			p.buckets = append(p.buckets, bucket)
+		}
+		p.values[bucket] = append(p.values[bucket], keyValue{Key: key, Value: value})
+		return true
+	})
+}
+
+// add buffers a write with buffer, which returns false without buffering when the
+// write must go to the next batch. It waits while the buffer is full.
+func (w *BatchWriter) add(buffer func(p *pendingWrites) bool) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for {
+		if w.closed {
+			return ErrBatchWriterClosed
+		}
+		if w.pending.count < w.options.MaxWrites && buffer(w.pending) {
+			w.pending.count++
+			if w.pending.count >= w.options.MaxWrites {
+				w.signalFull()
+			}
+			return nil
+		}
+		w.signalFull()
+		w.swapped.Wait()
+	}
+}
+
+func (w *BatchWriter) signalFull() {
+	select {
+	case w.full <- struct{}{}:
+	default:
+	}
+}
+
+// Flush sends the buffered writes and waits for them to be written, returning the
+// first failure of the writes it sent
+func (w *BatchWriter) Flush(ctx context.Context) error {
+	w.mutex.Lock()
+	closed := w.closed
+	w.mutex.Unlock()
+	if closed {
+		return ErrBatchWriterClosed
+	}
+	return w.ask(ctx, w.requests)
+}
+
+// Close sends the buffered writes, as Flush, and stops the writer
+func (w *BatchWriter) Close(ctx context.Context) error {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return ErrBatchWriterClosed
+	}
+	w.closed = true
+	w.swapped.Broadcast()
+	w.mutex.Unlock()
+
+	// The goroutine is stopped even when ctx ends before the last flush
+	reply := make(chan error, 1)
+	w.stop <- reply
+	select {
+	case err := <-reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ask hands a flush request to the flushing goroutine and waits for its outcome
+func (w *BatchWriter) ask(ctx context.Context, requests chan chan error) error {
+	reply := make(chan error, 1)
+	select {
+	case requests <- reply:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns the counters of the writer
+func (w *BatchWriter) Stats() BatchStats {
+	w.mutex.Lock()
+	buffered := w.pending.count
+	w.mutex.Unlock()
+	w.statsMutex.Lock()
+	defer w.statsMutex.Unlock()
+	return BatchStats{Buffered: buffered, Flushes: w.flushes, Written: w.written, Failed: w.failed}
+}
+
+// run flushes the pending writes when the buffer is full, every FlushInterval and
+// when asked to. Only it takes the pending writes, so batches are sent in order.
+func (w *BatchWriter) run() {
+	ticker := time.NewTicker(w.options.FlushInterval)
+	defer ticker.Stop()
+	for {
+		var reply chan error
+		last := false
+		select {
+		case <-w.full:
+		case <-ticker.C:
+		case reply = <-w.requests:
+		case reply = <-w.stop:
+			last = true
+		}
+
+		w.mutex.Lock()
+		batch := w.pending
+		w.pending = newPendingWrites()
+		w.swapped.Broadcast()
+		w.mutex.Unlock()
+
+		err := w.flush(batch)
+		if reply != nil {
+			reply <- err
+		}
+		if last {
+			return
+		}
+	}
+}
+
+// flush sends a batch, one request per collection and bucket, and returns the
+// first failure
+func (w *BatchWriter) flush(batch *pendingWrites) error {
+	var first error
+	record := func(outcome BatchError) {
+		if err := w.report(outcome); err != nil && first == nil {
+			first = err
+		}
+	}
+	ctx := context.Background()
+	for _, collection := range batch.collections {
+		docs := batch.documents[collection]
+		var result struct {
+			Errors []struct {
+				ID string `json:"id"`
+			} `json:"errors"`
+		}
+		err := w.client.do(ctx, http.MethodPost, "/docs/"+url.PathEscape(collection)+"/_insertMany", nil, map[string]interface{}{"documents": docs}, &result)
+		outcome := BatchError{Collection: collection, Writes: len(docs), Err: err}
+		var apiErr *Error
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusOK {
+			for _, failed := range result.Errors {
+				outcome.Keys = append(outcome.Keys, failed.ID)
+			}
+		}
+		record(outcome)
+	}
+	for _, bucket := range batch.buckets {
+		pairs := batch.values[bucket]
+		path := "/kv/_mset"
+		if bucket != "" {
+			path = "/kv/" + url.PathEscape(bucket) + "/_mset"
+		}
+		err := w.client.do(ctx, http.MethodPost, path, nil, map[string]interface{}{"pairs": pairs}, nil)
+		record(BatchError{Bucket: bucket, Writes: len(pairs), Err: err})
+	}
+	return first
+}
+
+// report counts the outcome of a request of a flush, passing failures to OnError
+// and returning them
+func (w *BatchWriter) report(outcome BatchError) error {
+	failed := 0
+	if outcome.Err != nil {
+		failed = outcome.Writes
+		if len(outcome.Keys) > 0 {
+			failed = len(outcome.Keys)
+		}
+	}
+	w.statsMutex.Lock()
+	w.flushes++
+	w.written += int64(outcome.Writes - failed)
+	w.failed += int64(failed)
+	w.statsMutex.Unlock()
+	if failed == 0 {
+		return nil
+	}
+	if w.options.OnError != nil {
+		w.options.OnError(outcome)
+	}
+	return outcome
+}
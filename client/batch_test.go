@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatchWriter(t *testing.T) {
+	c := New(newTestServer(t).URL, Options{})
+	ctx := context.Background()
+	var failures []BatchError
+	var mutex sync.Mutex
+	w := c.NewBatchWriter(BatchOptions{MaxWrites: 3, FlushInterval: time.Hour, OnError: func(failure BatchError) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		failures = append(failures, failure)
+	}})
+
+	for i := 0; i < 7; i++ {
+		if err := w.InsertDocument("events", Document{"seq": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.SetValue("", "last", 6); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetValue("metrics", "count", 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	docs, err := c.QueryDocuments(ctx, "events", nil)
+	if err != nil || len(docs) != 7 {
+		t.Fatalf("expected the 7 events to be written, got %d, %v", len(docs), err)
+	}
+	var last int
+	if err := c.GetValue(ctx, "last", &last); err != nil || last != 6 {
+		t.Fatalf("last = %d, %v", last, err)
+	}
+	// Full buffers were flushed on their own: 3 + 3, then the event and both keys
+	if stats := w.Stats(); stats.Written != 9 || stats.Flushes != 5 || stats.Buffered != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// An id given twice goes to the next batch, where it fails alone
+	for _, id := range []string{"a", "b", "a"} {
+		if err := w.InsertDocument("events", Document{"_id": id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var failure BatchError
+	if err := w.Flush(ctx); !errors.As(err, &failure) || len(failure.Keys) != 1 || failure.Keys[0] != "a" {
+		t.Fatalf("expected the second a to fail, got %v", err)
+	}
+	mutex.Lock()
+	if len(failures) != 1 || failures[0].Collection != "events" {
+		t.Fatalf("expected the failure to be reported, got %v", failures)
+	}
+	mutex.Unlock()
+	if stats := w.Stats(); stats.Written != 11 || stats.Failed != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	if err := w.InsertDocument("events", Document{"_id": 1}); err == nil {
+		t.Fatal("expected a non-string id to be rejected")
+	}
+	if err := w.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.InsertDocument("events", Document{}); !errors.Is(err, ErrBatchWriterClosed) {
+		t.Fatalf("expected writes after Close to fail, got %v", err)
+	}
+}
+
+func TestBatchWriterFlushesOnInterval(t *testing.T) {
+	c := New(newTestServer(t).URL, Options{})
+	w := c.NewBatchWriter(BatchOptions{FlushInterval: 10 * time.Millisecond})
+	defer w.Close(context.Background())
+
+	if err := w.InsertDocument("events", Document{"_id": "e1"}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for w.Stats().Written == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the write to be flushed after the interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, err := c.GetDocument(context.Background(), "events", "e1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatchWriterConcurrentWrites(t *testing.T) {
+	c := New(newTestServer(t).URL, Options{})
+	w := c.NewBatchWriter(BatchOptions{MaxWrites: 10})
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				w.InsertDocument("events", Document{"_id": fmt.Sprintf("%d-%d", g, i)})
+			}
+		}(g)
+	}
+	wg.Wait()
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if stats := w.Stats(); stats.Written != 100 || stats.Failed != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,142 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the server while the circuit
+// breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of a circuit breaker
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // requests are sent
+	BreakerOpen     BreakerState = "open"      // requests fail with ErrCircuitOpen
+	BreakerHalfOpen BreakerState = "half_open" // a probe request is sent, the others fail
+)
+
+// BreakerPolicy configures the circuit breaker. Zero fields take their defaults; a
+// negative FailureThreshold disables the breaker.
+//
+// Attempts failing with a network error, 502, 503 or 504 count as failures, any
+// other answer as a success. After FailureThreshold consecutive failures the
+// breaker opens for OpenDuration, then lets one probe request through: its success
+// closes the breaker, its failure opens it again.
+type BreakerPolicy struct {
+	FailureThreshold int           // 5 by default
+	OpenDuration     time.Duration // 10s by default
+}
+
+func (p BreakerPolicy) withDefaults() BreakerPolicy {
+	if p.FailureThreshold == 0 {
+		p.FailureThreshold = 5
+	}
+	if p.OpenDuration <= 0 {
+		p.OpenDuration = 10 * time.Second
+	}
+	return p
+}
+
+// failed reports whether an attempt counts as a failure of the server
+func (info RequestInfo) failed() bool {
+	switch info.StatusCode {
+	case 0:
+		// Attempts cancelled by the caller say nothing of the server
+		return info.Err != nil && !errors.Is(info.Err, context.Canceled)
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+type circuitBreaker struct {
+	policy   BreakerPolicy
+	state    BreakerState
+	failures int       // consecutive
+	openedAt time.Time // when the breaker last opened
+	probing  bool      // a half-open probe is in flight
+	changed  func(from, to BreakerState)
+	mutex    sync.Mutex
+	now      func() time.Time
+}
+
+func newCircuitBreaker(policy BreakerPolicy, changed func(from, to BreakerState)) *circuitBreaker {
+	return &circuitBreaker{policy: policy, state: BreakerClosed, changed: changed, now: time.Now}
+}
+
+// allow reports whether a request may be sent
+func (b *circuitBreaker) allow() bool {
+	if b.policy.FailureThreshold < 0 {
+		return true
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.policy.OpenDuration {
+			return false
+		}
+		b.transition(BreakerHalfOpen)
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// record counts the outcome of a request allowed by allow
+func (b *circuitBreaker) record(failed bool) {
+	if b.policy.FailureThreshold < 0 {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.state == BreakerHalfOpen {
+		b.probing = false
+		if failed {
+			b.open()
+		} else {
+			b.failures = 0
+			b.transition(BreakerClosed)
+		}
+		return
+	}
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == BreakerClosed && b.failures >= b.policy.FailureThreshold {
+		b.open()
+	}
+}
+
+func (b *circuitBreaker) open() {
+	b.openedAt = b.now()
+	b.transition(BreakerOpen)
+}
+
+// transition changes the state and reports the change, under the breaker's lock
+func (b *circuitBreaker) transition(to BreakerState) {
+	if from := b.state; from != to {
+		b.state = to
+		b.changed(from, to)
+	}
+}
+
+func (b *circuitBreaker) current() BreakerState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state
+}
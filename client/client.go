@@ -0,0 +1,341 @@
+// Package client is the Go client of the database server's HTTP API.
+//
+//	c := client.New("http://localhost:8080/v1", client.Options{Token: os.Getenv("API_TOKEN")})
+//	err := c.InsertDocument(ctx, "orders", "o1", client.Document{"total": 30})
+//
+// Requests failing with a network error or an overloaded server are retried with
+// exponential backoff, within a retry budget that caps retries at a share of the
+// requests made, so a downed node or an overloaded engine does not see its load
+// multiplied by retries. A circuit breaker stops sending requests after repeated
+// failures, failing them at once with ErrCircuitOpen until a probe succeeds. An
+// Observer receives every attempt, retry and breaker change for metrics.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds each attempt of a request when Options.Timeout is not set
+const DefaultTimeout = 30 * time.Second
+
+// Document is a document of the document store. Numbers are decoded as
+// json.Number, keeping their exact text as the server does.
+type Document map[string]interface{}
+
+// Error is an error answered by the server. Requests applied in part, such as
+// batches some writes of which failed, answer with a StatusCode of 200.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("server answered %d: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is the server's answer for a missing document or key
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// IsConflict reports whether err is the server's answer for a write conflicting
+// with existing data, such as inserting a document under a taken id
+func IsConflict(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict
+}
+
+// Options configures a Client. The zero value is a client without a token, with
+// the default retry and circuit breaker policies and no observer.
+type Options struct {
+	Token      string        // API_TOKEN of the server, sent as a bearer token
+	HTTPClient *http.Client  // http.DefaultClient when nil
+	Timeout    time.Duration // per attempt, DefaultTimeout when zero
+	Retry      RetryPolicy
+	Breaker    BreakerPolicy
+	Observer   Observer
+}
+
+// Client calls the HTTP API of a database server. It is safe for concurrent use.
+type Client struct {
+	baseURL  string
+	token    string
+	http     *http.Client
+	timeout  time.Duration
+	retry    RetryPolicy
+	budget   *retryBudget
+	breaker  *circuitBreaker
+	observer Observer
+	stats    clientStats
+}
+
+// New returns a client of the server at baseURL, e.g. http://localhost:8080/v1
+func New(baseURL string, options Options) *Client {
+	c := &Client{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		token:    options.Token,
+		http:     options.HTTPClient,
+		timeout:  options.Timeout,
+		retry:    options.Retry.withDefaults(),
+		observer: options.Observer,
+	}
+	if c.http == nil {
+		c.http = http.DefaultClient
+	}
+	if c.timeout <= 0 {
+		c.timeout = DefaultTimeout
+	}
+	if c.observer == nil {
+		c.observer = BaseObserver{}
+	}
+	c.budget = newRetryBudget(c.retry)
+	c.breaker = newCircuitBreaker(options.Breaker.withDefaults(), c.breakerChanged)
+	return c
+}
+
+// envelope is the body of every API response
+type envelope struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+	Error   string          `json:"error"`
+}
+
+// do sends a request, retrying it as the retry policy, the retry budget and the
+// circuit breaker allow, and decodes the data of the response into out when given
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	c.budget.request()
+	c.stats.requests.Add(1)
+
+	for attempt := 1; ; attempt++ {
+		if !c.breaker.allow() {
+			c.stats.rejected.Add(1)
+			return ErrCircuitOpen
+		}
+		info, retryAfter := c.attempt(ctx, method, path, query, payload, out)
+		info.Attempt = attempt
+		c.breaker.record(info.failed())
+		c.observer.RequestDone(info)
+
+		if info.Err == nil || !info.retryable(method, retryAfter) || ctx.Err() != nil {
+			return info.Err
+		}
+		if attempt >= c.retry.MaxAttempts {
+			return info.Err
+		}
+		delay := c.retry.backoff(attempt)
+		if retryAfter > delay {
+			if retryAfter > c.retry.MaxDelay {
+				// The server asks for more patience than the policy has
+				return info.Err
+			}
+			delay = retryAfter
+		}
+		if !c.budget.withdraw() {
+			c.stats.retriesDenied.Add(1)
+			c.observer.RetryDenied(info)
+			return info.Err
+		}
+		c.stats.retries.Add(1)
+		c.observer.Retrying(info, delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends a request once, returning its outcome and the server's Retry-After
+func (c *Client) attempt(ctx context.Context, method, path string, query url.Values, payload []byte, out interface{}) (RequestInfo, time.Duration) {
+	info := RequestInfo{Method: method, Path: path}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		info.Err = err
+		return info, 0
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	start := time.Now()
+	resp, err := c.http.Do(req)
+	if err != nil {
+		info.Duration = time.Since(start)
+		info.Err = err
+		return info, 0
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	info.Duration = time.Since(start)
+	info.StatusCode = resp.StatusCode
+	if err != nil {
+		info.Err = err
+		return info, 0
+	}
+
+	retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+	var response envelope
+	if err := json.Unmarshal(data, &response); err != nil {
+		info.Err = &Error{StatusCode: resp.StatusCode, Message: "invalid response body: " + resp.Status}
+		return info, retryAfter
+	}
+	if resp.StatusCode >= 300 {
+		if response.Error == "" {
+			response.Error = resp.Status
+		}
+		info.Err = &Error{StatusCode: resp.StatusCode, Message: response.Error}
+		return info, retryAfter
+	}
+	if out != nil && len(response.Data) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(response.Data))
+		decoder.UseNumber()
+		if info.Err = decoder.Decode(out); info.Err != nil {
+			return info, retryAfter
+		}
+	}
+	// Batches partially applied answer 200 without success, their data telling which
+	// writes failed
+	if !response.Success {
+		if response.Message == "" {
+			response.Message = response.Error
+		}
+		info.Err = &Error{StatusCode: resp.StatusCode, Message: response.Message}
+	}
+	return info, retryAfter
+}
+
+// Documents
+
+func documentPath(collection, id string) string {
+	return "/docs/" + url.PathEscape(collection) + "/" + url.PathEscape(id)
+}
+
+// GetDocument returns a document by id
+func (c *Client) GetDocument(ctx context.Context, collection, id string) (Document, error) {
+	var doc Document
+	if err := c.do(ctx, http.MethodGet, documentPath(collection, id), nil, nil, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// InsertDocument inserts a document under id, failing with a conflict when the id
+// is taken
+func (c *Client) InsertDocument(ctx context.Context, collection, id string, doc Document) error {
+	return c.do(ctx, http.MethodPost, documentPath(collection, id), nil, doc, nil)
+}
+
+// UpdateDocument sets the fields of updates in a document, dot paths addressing
+// nested fields
+func (c *Client) UpdateDocument(ctx context.Context, collection, id string, updates Document) error {
+	return c.do(ctx, http.MethodPut, documentPath(collection, id), nil, updates, nil)
+}
+
+// DeleteDocument deletes a document by id
+func (c *Client) DeleteDocument(ctx context.Context, collection, id string) error {
+	return c.do(ctx, http.MethodDelete, documentPath(collection, id), nil, nil, nil)
+}
+
+// QueryDocuments returns the documents of collection matching query, written as
+// the query string of GET /docs/{collection}, e.g. status=open&_sort=-total
+func (c *Client) QueryDocuments(ctx context.Context, collection string, query url.Values) ([]Document, error) {
+	var docs []Document
+	if err := c.do(ctx, http.MethodGet, "/docs/"+url.PathEscape(collection), query, nil, &docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// IndexSpec is a secondary index of a collection
+type IndexSpec struct {
+	Field     string    `json:"field"`          // a key or a dot path
+	Type      string    `json:"type,omitempty"` // hash when empty, prefix or trigram
+	Collation Collation `json:"collation"`
+}
+
+// Collation controls how an index compares strings
+type Collation struct {
+	CaseInsensitive   bool `json:"case_insensitive,omitempty"`
+	AccentInsensitive bool `json:"accent_insensitive,omitempty"`
+	Numeric           bool `json:"numeric,omitempty"`
+}
+
+// CreateIndex creates an index on collection, replacing the one on the same field
+func (c *Client) CreateIndex(ctx context.Context, collection string, spec IndexSpec) error {
+	return c.do(ctx, http.MethodPost, "/docs/"+url.PathEscape(collection)+"/_indexes", nil, spec, nil)
+}
+
+// Key-value store
+
+// GetValue decodes the value of key in the default bucket into out
+func (c *Client) GetValue(ctx context.Context, key string, out interface{}) error {
+	return c.do(ctx, http.MethodGet, "/kv/"+url.PathEscape(key), nil, nil, out)
+}
+
+// SetValue stores value under key in the default bucket, expiring after ttl when
+// it is positive
+func (c *Client) SetValue(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	var query url.Values
+	if ttl > 0 {
+		query = url.Values{"ttl": {ttl.String()}}
+	}
+	return c.do(ctx, http.MethodPut, "/kv/"+url.PathEscape(key), query, value, nil)
+}
+
+// DeleteValue deletes key from the default bucket
+func (c *Client) DeleteValue(ctx context.Context, key string) error {
+	return c.do(ctx, http.MethodDelete, "/kv/"+url.PathEscape(key), nil, nil, nil)
+}
+
+// Interface is the API of a Client, for applications to depend on so that tests can
+// substitute the in-memory fake of package clienttest, or a mock of their own
+type Interface interface {
+	GetDocument(ctx context.Context, collection, id string) (Document, error)
+	InsertDocument(ctx context.Context, collection, id string, doc Document) error
+	UpdateDocument(ctx context.Context, collection, id string, updates Document) error
+	DeleteDocument(ctx context.Context, collection, id string) error
+	QueryDocuments(ctx context.Context, collection string, query url.Values) ([]Document, error)
+	CreateIndex(ctx context.Context, collection string, spec IndexSpec) error
+	GetValue(ctx context.Context, key string, out interface{}) error
+	SetValue(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	DeleteValue(ctx context.Context, key string) error
+	NewBatchWriter(options BatchOptions) *BatchWriter
+	Stats() Stats
+}
+
+var _ Interface = (*Client)(nil)
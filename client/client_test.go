@@ -0,0 +1,271 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/config"
+	"multimodel-db-engine/internal/database"
+	"multimodel-db-engine/internal/server"
+)
+
+// newTestServer serves the API of an engine holding its data in a temporary directory
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	db := database.NewMultiModelDatabase(&config.Config{DataDir: t.TempDir(), ReplicationFactor: 1})
+	t.Cleanup(db.Close)
+	router := mux.NewRouter()
+	server.SetupRoutes(router, db)
+	srv := httptest.NewServer(server.APIVersioning(router))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// recordingObserver records the events of a client
+type recordingObserver struct {
+	BaseObserver
+	attempts int
+	retries  int
+	denied   int
+	changes  []BreakerState
+	mutex    sync.Mutex
+}
+
+func (o *recordingObserver) RequestDone(RequestInfo) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.attempts++
+}
+
+func (o *recordingObserver) Retrying(RequestInfo, time.Duration) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.retries++
+}
+
+func (o *recordingObserver) RetryDenied(RequestInfo) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.denied++
+}
+
+func (o *recordingObserver) BreakerChanged(from, to BreakerState) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.changes = append(o.changes, to)
+}
+
+// failingServer answers the first failures requests with status, then succeeds
+func failingServer(t *testing.T, failures int64, status int, retryAfter string) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var hits atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "overloaded"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": map[string]interface{}{"ok": true}})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+var fastRetries = RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+func TestClientDocumentsAndValues(t *testing.T) {
+	c := New(newTestServer(t).URL+"/v1", Options{})
+	ctx := context.Background()
+
+	if err := c.InsertDocument(ctx, "orders", "o1", Document{"status": "open", "total": 30}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.InsertDocument(ctx, "orders", "o1", Document{}); !IsConflict(err) {
+		t.Fatalf("expected a conflict inserting a taken id, got %v", err)
+	}
+	if err := c.UpdateDocument(ctx, "orders", "o1", Document{"status": "paid"}); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := c.GetDocument(ctx, "orders", "o1")
+	if err != nil || doc["status"] != "paid" || doc["total"] != json.Number("30") {
+		t.Fatalf("doc = %v, %v", doc, err)
+	}
+	docs, err := c.QueryDocuments(ctx, "orders", map[string][]string{"status": {"paid"}})
+	if err != nil || len(docs) != 1 {
+		t.Fatalf("docs = %v, %v", docs, err)
+	}
+	if err := c.DeleteDocument(ctx, "orders", "o1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetDocument(ctx, "orders", "o1"); !IsNotFound(err) {
+		t.Fatalf("expected the deleted document to be missing, got %v", err)
+	}
+
+	if err := c.SetValue(ctx, "greeting", "hello", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	var value string
+	if err := c.GetValue(ctx, "greeting", &value); err != nil || value != "hello" {
+		t.Fatalf("value = %q, %v", value, err)
+	}
+	if err := c.DeleteValue(ctx, "greeting"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GetValue(ctx, "greeting", &value); !IsNotFound(err) {
+		t.Fatalf("expected the deleted key to be missing, got %v", err)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	srv, hits := failingServer(t, 2, http.StatusServiceUnavailable, "")
+	observer := &recordingObserver{}
+	c := New(srv.URL, Options{Retry: fastRetries, Observer: observer})
+	if _, err := c.GetDocument(context.Background(), "orders", "o1"); err != nil {
+		t.Fatal(err)
+	}
+	if hits.Load() != 3 || observer.attempts != 3 || observer.retries != 2 {
+		t.Fatalf("expected two retries, got %d hits, %+v", hits.Load(), observer)
+	}
+	if stats := c.Stats(); stats.Requests != 1 || stats.Retries != 2 || stats.Breaker != BreakerClosed {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// Writes that may have been applied are not retried
+	srv, hits = failingServer(t, 1, http.StatusBadGateway, "")
+	c = New(srv.URL, Options{Retry: fastRetries})
+	var apiErr *Error
+	if err := c.InsertDocument(context.Background(), "orders", "o1", Document{}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway || hits.Load() != 1 {
+		t.Fatalf("expected the insert to fail without a retry, got %v after %d hits", err, hits.Load())
+	}
+	// but requests shed by the server's rate limit are
+	srv, hits = failingServer(t, 1, http.StatusTooManyRequests, "0")
+	c = New(srv.URL, Options{Retry: fastRetries})
+	if err := c.InsertDocument(context.Background(), "orders", "o1", Document{}); err != nil || hits.Load() != 2 {
+		t.Fatalf("expected the insert to be retried, got %v after %d hits", err, hits.Load())
+	}
+
+	// A Retry-After beyond the longest backoff is not waited for
+	srv, hits = failingServer(t, 1, http.StatusServiceUnavailable, "60")
+	c = New(srv.URL, Options{Retry: fastRetries})
+	if _, err := c.GetDocument(context.Background(), "orders", "o1"); err == nil || hits.Load() != 1 {
+		t.Fatalf("expected no retry, got %v after %d hits", err, hits.Load())
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	now := time.Unix(1000, 0)
+	budget := newRetryBudget(RetryPolicy{BudgetRatio: 0.2, MinRetriesPerSecond: 1})
+	budget.now = func() time.Time { return now }
+
+	for i := 0; i < 100; i++ {
+		budget.request()
+	}
+	// 10 retries allowed per window, plus 20% of the 100 requests
+	for i := 0; i < 30; i++ {
+		if !budget.withdraw() {
+			t.Fatalf("retry %d denied within the budget", i)
+		}
+	}
+	if budget.withdraw() {
+		t.Fatal("expected the retry beyond the budget to be denied")
+	}
+	// Retries and requests leave the budget once out of the window
+	now = now.Add(retryWindow)
+	for i := 0; i < 10; i++ {
+		if !budget.withdraw() {
+			t.Fatalf("retry %d denied after the window passed", i)
+		}
+	}
+	if budget.withdraw() {
+		t.Fatal("expected the requests of the previous window to be forgotten")
+	}
+}
+
+func TestClientRetryBudgetStopsRetryStorms(t *testing.T) {
+	srv, hits := failingServer(t, 1000, http.StatusServiceUnavailable, "")
+	observer := &recordingObserver{}
+	c := New(srv.URL, Options{
+		Retry:    RetryPolicy{MaxAttempts: 5, BaseDelay: time.Microsecond, MaxDelay: time.Microsecond, BudgetRatio: 0.1, MinRetriesPerSecond: 1},
+		Breaker:  BreakerPolicy{FailureThreshold: -1},
+		Observer: observer,
+	})
+	for i := 0; i < 50; i++ {
+		c.GetDocument(context.Background(), "orders", "o1")
+	}
+	// Without the budget 50 requests would make 250 attempts
+	if hits.Load() != 50+10+5 || observer.denied == 0 {
+		t.Fatalf("expected retries capped at 15, got %d attempts and %d denied", hits.Load(), observer.denied)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var healthy atomic.Bool
+	var hits atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "overloaded"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": map[string]interface{}{}})
+	}))
+	defer srv.Close()
+
+	observer := &recordingObserver{}
+	c := New(srv.URL, Options{Retry: RetryPolicy{MaxAttempts: 1}, Breaker: BreakerPolicy{FailureThreshold: 2, OpenDuration: time.Minute}, Observer: observer})
+	now := time.Now()
+	c.breaker.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetDocument(ctx, "orders", "o1"); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected the server's error, got %v", err)
+		}
+	}
+	if _, err := c.GetDocument(ctx, "orders", "o1"); !errors.Is(err, ErrCircuitOpen) || hits.Load() != 2 {
+		t.Fatalf("expected the open breaker to fail the request at once, got %v after %d hits", err, hits.Load())
+	}
+
+	// A failed probe opens the breaker again
+	now = now.Add(time.Minute)
+	if _, err := c.GetDocument(ctx, "orders", "o1"); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the probe to reach the server, got %v", err)
+	}
+	if _, err := c.GetDocument(ctx, "orders", "o1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the breaker to open again, got %v", err)
+	}
+
+	// A successful one closes it
+	healthy.Store(true)
+	now = now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetDocument(ctx, "orders", "o1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerOpen, BreakerHalfOpen, BreakerClosed}
+	if len(observer.changes) != len(want) {
+		t.Fatalf("expected changes %v, got %v", want, observer.changes)
+	}
+	for i := range want {
+		if observer.changes[i] != want[i] {
+			t.Fatalf("expected changes %v, got %v", want, observer.changes)
+		}
+	}
+	if stats := c.Stats(); stats.BreakerOpens != 2 || stats.Rejected != 2 || stats.Breaker != BreakerClosed {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,79 @@
+// Package clienttest provides a fake of the database server for testing
+// applications that use package client, without running a server:
+//
+//	fake := clienttest.NewFake()
+//	defer fake.Close()
+//	svc := NewOrderService(fake) // takes a client.Interface
+//
+// The fake serves the client's requests in process with the real engine, holding
+// its data in a temporary directory, so queries, indexes and errors behave as
+// against a server. Its DB field gives tests direct access to the engine to seed
+// data and inspect the results.
+package clienttest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/client"
+	"multimodel-db-engine/internal/config"
+	"multimodel-db-engine/internal/database"
+	"multimodel-db-engine/internal/server"
+)
+
+// baseURL is the address the fake's client sends its requests to, never dialled
+const baseURL = "http://clienttest.invalid"
+
+// Fake is a client.Interface backed by an in-process engine. The embedded Client
+// also serves typed collections: client.NewCollection[T](fake.Client, "orders").
+type Fake struct {
+	*client.Client
+	DB *database.MultiModelDatabase
+
+	dir string
+}
+
+// NewFake returns a fake with an empty engine and a client retrying nothing. It
+// panics when its temporary directory cannot be created, as a test could not run.
+func NewFake() *Fake {
+	return NewFakeWithOptions(client.Options{Retry: client.RetryPolicy{MaxAttempts: 1}})
+}
+
+// NewFakeWithOptions is NewFake with the client configured by options; its
+// HTTPClient is replaced by the in-process one
+func NewFakeWithOptions(options client.Options) *Fake {
+	dir, err := os.MkdirTemp("", "clienttest")
+	if err != nil {
+		panic(fmt.Sprintf("clienttest: failed to create the data directory: %v", err))
+	}
+	db := database.NewMultiModelDatabase(&config.Config{DataDir: dir, ReplicationFactor: 1})
+	router := mux.NewRouter()
+	server.SetupRoutes(router, db)
+
+	options.HTTPClient = &http.Client{Transport: handlerTransport{server.APIVersioning(router)}}
+	return &Fake{Client: client.New(baseURL, options), DB: db, dir: dir}
+}
+
+// Close closes the engine and removes its data
+func (f *Fake) Close() {
+	f.DB.Close()
+	os.RemoveAll(f.dir)
+}
+
+// handlerTransport serves requests with a handler instead of sending them. Streams
+// and long polls are answered once the handler returns.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	t.handler.ServeHTTP(recorder, req)
+	resp := recorder.Result()
+	resp.Request = req
+	return resp, nil
+}
@@ -0,0 +1,68 @@
+package clienttest
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"multimodel-db-engine/client"
+	"multimodel-db-engine/internal/database"
+)
+
+// openOrders is application code depending on client.Interface
+func openOrders(ctx context.Context, c client.Interface) (int, error) {
+	docs, err := c.QueryDocuments(ctx, "orders", url.Values{"status": {"open"}})
+	return len(docs), err
+}
+
+func TestFake(t *testing.T) {
+	fake := NewFake()
+	defer fake.Close()
+	ctx := context.Background()
+
+	// Data seeded through the engine is seen by the client, and the other way round
+	if err := fake.DB.InsertDocument("orders", "o1", database.Document{"status": "open"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.InsertDocument(ctx, "orders", "o2", client.Document{"status": "open"}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := openOrders(ctx, fake); err != nil || n != 2 {
+		t.Fatalf("open orders = %d, %v", n, err)
+	}
+	if err := fake.InsertDocument(ctx, "orders", "o1", client.Document{}); !client.IsConflict(err) {
+		t.Fatalf("expected the server's conflict, got %v", err)
+	}
+	if doc, err := fake.DB.GetDocument("orders", "o2"); err != nil || doc["status"] != "open" {
+		t.Fatalf("doc = %v, %v", doc, err)
+	}
+
+	if err := fake.SetValue(ctx, "k", "v", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	var value string
+	if err := fake.GetValue(ctx, "k", &value); err != nil || value != "v" {
+		t.Fatalf("value = %q, %v", value, err)
+	}
+
+	type order struct {
+		Status string `json:"status" jettra:"index"`
+	}
+	orders := client.NewCollection[order](fake.Client, "orders")
+	if err := orders.EnsureIndexes(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := orders.Query(ctx, url.Values{"status": {"open"}}); err != nil || len(got) != 2 {
+		t.Fatalf("orders = %v, %v", got, err)
+	}
+
+	w := fake.NewBatchWriter(client.BatchOptions{})
+	w.InsertDocument("events", client.Document{"_id": "e1"})
+	if err := w.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fake.DB.GetDocument("events", "e1"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,209 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// Collection binds a collection to the Go type T of its documents, which are
+// encoded and decoded with encoding/json, so T's json tags name the stored fields:
+//
+//	type Order struct {
+//		Customer string  `json:"customer" jettra:"index,ci"`
+//		Status   string  `json:"status" jettra:"index"`
+//		Total    float64 `json:"total"`
+//	}
+//	orders := client.NewCollection[Order](c, "orders")
+//	err := orders.EnsureIndexes(ctx)
+//	open, err := orders.Query(ctx, url.Values{"status": {"open"}})
+//
+// The jettra tag hints at the indexes the application queries the collection with:
+// "index" for a hash index, "index=prefix" or "index=trigram" for the other types,
+// followed by the collation options "ci", "ai" and "numeric". Fields of nested
+// structs are indexed under their dot paths.
+type Collection[T any] struct {
+	client *Client
+	name   string
+}
+
+// NewCollection returns the binding of collection to T
+func NewCollection[T any](c *Client, collection string) *Collection[T] {
+	return &Collection[T]{client: c, name: collection}
+}
+
+// Name returns the name of the collection
+func (c *Collection[T]) Name() string {
+	return c.name
+}
+
+// Get returns the document with id
+func (c *Collection[T]) Get(ctx context.Context, id string) (T, error) {
+	var value T
+	err := c.client.do(ctx, http.MethodGet, documentPath(c.name, id), nil, nil, &value)
+	return value, err
+}
+
+// Insert inserts value under id, failing with a conflict when the id is taken
+func (c *Collection[T]) Insert(ctx context.Context, id string, value T) error {
+	return c.client.do(ctx, http.MethodPost, documentPath(c.name, id), nil, value, nil)
+}
+
+// Put stores value under id: it is inserted, or when the id is taken its fields are
+// set in the stored document, whose fields T does not encode are kept
+func (c *Collection[T]) Put(ctx context.Context, id string, value T) error {
+	err := c.Insert(ctx, id, value)
+	if IsConflict(err) {
+		return c.client.do(ctx, http.MethodPut, documentPath(c.name, id), nil, value, nil)
+	}
+	return err
+}
+
+// Delete deletes the document with id
+func (c *Collection[T]) Delete(ctx context.Context, id string) error {
+	return c.client.DeleteDocument(ctx, c.name, id)
+}
+
+// Query returns the documents matching query, written as the query string of
+// GET /docs/{collection}, e.g. status=open&_sort=-total
+func (c *Collection[T]) Query(ctx context.Context, query url.Values) ([]T, error) {
+	var values []T
+	if err := c.client.do(ctx, http.MethodGet, "/docs/"+url.PathEscape(c.name), query, nil, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Indexes returns the indexes hinted at by the jettra tags of T
+func (c *Collection[T]) Indexes() ([]IndexSpec, error) {
+	return IndexHints(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+// EnsureIndexes creates the indexes hinted at by the jettra tags of T, replacing
+// the indexes on the same fields
+func (c *Collection[T]) EnsureIndexes(ctx context.Context) error {
+	specs, err := c.Indexes()
+	if err != nil {
+		return err
+	}
+	for _, spec := range specs {
+		if err := c.client.CreateIndex(ctx, c.name, spec); err != nil {
+			return fmt.Errorf("failed to create index on %s: %w", spec.Field, err)
+		}
+	}
+	return nil
+}
+
+// IndexHints returns the indexes hinted at by the jettra tags of the fields of the
+// struct type t, in field order
+func IndexHints(t reflect.Type) ([]IndexSpec, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	var specs []IndexSpec
+	err := collectIndexHints(t, "", &specs, map[reflect.Type]bool{})
+	return specs, err
+}
+
+// collectIndexHints adds the hints of the fields of t, named below prefix. Types
+// being visited are skipped, so recursive types end.
+func collectIndexHints(t reflect.Type, prefix string, specs *[]IndexSpec, visiting map[reflect.Type]bool) error {
+	if visiting[t] {
+		return nil
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, skip := jsonName(field)
+		if skip {
+			continue
+		}
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		// Embedded structs without a json name have their fields encoded inline
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			if err := collectIndexHints(fieldType, prefix, specs, visiting); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		path := prefix + name
+
+		if tag, tagged := field.Tag.Lookup("jettra"); tagged {
+			spec, err := parseIndexHint(path, tag)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", field.Name, err)
+			}
+			if spec != nil {
+				*specs = append(*specs, *spec)
+			}
+		}
+		if fieldType.Kind() == reflect.Struct {
+			if err := collectIndexHints(fieldType, path+".", specs, visiting); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// jsonName returns the name a field is encoded under, empty for the Go name, and
+// whether encoding/json skips it
+func jsonName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	return name, false
+}
+
+// parseIndexHint parses a jettra tag of the field at path, returning nil for tags
+// without an index
+func parseIndexHint(path, tag string) (*IndexSpec, error) {
+	options := strings.Split(tag, ",")
+	kind, indexType, _ := strings.Cut(options[0], "=")
+	if kind == "" || kind == "-" {
+		return nil, nil
+	}
+	if kind != "index" {
+		return nil, fmt.Errorf("unknown jettra tag %q, expected index", kind)
+	}
+	spec := &IndexSpec{Field: path}
+	switch indexType {
+	case "", "hash":
+	case "prefix", "trigram":
+		spec.Type = indexType
+	default:
+		return nil, fmt.Errorf("unknown index type %q, expected hash, prefix or trigram", indexType)
+	}
+	for _, option := range options[1:] {
+		switch strings.TrimSpace(option) {
+		case "ci":
+			spec.Collation.CaseInsensitive = true
+		case "ai":
+			spec.Collation.AccentInsensitive = true
+		case "numeric":
+			spec.Collation.Numeric = true
+		default:
+			return nil, fmt.Errorf("unknown index option %q, expected ci, ai or numeric", option)
+		}
+	}
+	return spec, nil
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+type testAddress struct {
+	City string `json:"city" jettra:"index=prefix,ci,ai"`
+	Zip  string `json:"zip,omitempty"`
+}
+
+type testAudit struct {
+	Updated string `json:"updated" jettra:"index"`
+}
+
+type testOrder struct {
+	testAudit
+	Customer string       `json:"customer" jettra:"index,ci"`
+	Status   string       `json:"status" jettra:"index"`
+	Total    int          `json:"total"`
+	Address  *testAddress `json:"address,omitempty"`
+	Notes    string       `json:"-" jettra:"index"`
+	Tags     []string     `json:"tags,omitempty" jettra:"index=trigram"`
+}
+
+func TestIndexHints(t *testing.T) {
+	specs, err := NewCollection[testOrder](nil, "orders").Indexes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []IndexSpec{
+		{Field: "updated"},
+		{Field: "customer", Collation: Collation{CaseInsensitive: true}},
+		{Field: "status"},
+		{Field: "address.city", Type: "prefix", Collation: Collation{CaseInsensitive: true, AccentInsensitive: true}},
+		{Field: "tags", Type: "trigram"},
+	}
+	if !reflect.DeepEqual(specs, want) {
+		t.Fatalf("expected %+v, got %+v", want, specs)
+	}
+
+	type invalid struct {
+		Name string `jettra:"index=btree"`
+	}
+	if _, err := IndexHints(reflect.TypeOf(invalid{})); err == nil {
+		t.Fatal("expected an unknown index type to be rejected")
+	}
+}
+
+func TestCollection(t *testing.T) {
+	c := New(newTestServer(t).URL, Options{})
+	ctx := context.Background()
+	orders := NewCollection[testOrder](c, "orders")
+
+	if err := orders.Insert(ctx, "o1", testOrder{Customer: "Ann", Status: "open", Total: 30, Address: &testAddress{City: "Oslo"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := orders.Insert(ctx, "o1", testOrder{}); !IsConflict(err) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+	if err := orders.Put(ctx, "o2", testOrder{Customer: "Bob", Status: "open", Total: 10}); err != nil {
+		t.Fatal(err)
+	}
+	// Put over an existing document sets the fields of the value
+	if err := orders.Put(ctx, "o2", testOrder{Customer: "Bob", Status: "paid", Total: 12}); err != nil {
+		t.Fatal(err)
+	}
+
+	order, err := orders.Get(ctx, "o1")
+	if err != nil || order.Customer != "Ann" || order.Total != 30 || order.Address == nil || order.Address.City != "Oslo" {
+		t.Fatalf("order = %+v, %v", order, err)
+	}
+	if _, err := orders.Get(ctx, "missing"); !IsNotFound(err) {
+		t.Fatalf("expected a missing document, got %v", err)
+	}
+
+	if err := orders.EnsureIndexes(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var indexes []IndexSpec
+	if err := c.do(ctx, "GET", "/docs/orders/_indexes", nil, nil, &indexes); err != nil || len(indexes) != 5 {
+		t.Fatalf("indexes = %+v, %v", indexes, err)
+	}
+	paid, err := orders.Query(ctx, url.Values{"status": {"paid"}})
+	if err != nil || len(paid) != 1 || paid[0].Customer != "Bob" || paid[0].Total != 12 {
+		t.Fatalf("paid = %+v, %v", paid, err)
+	}
+	// The case insensitive index serves a query under the same collation
+	byCustomer, err := orders.Query(ctx, url.Values{"customer": {"ANN"}, "_collation": {"ci"}})
+	if err != nil || len(byCustomer) != 1 {
+		t.Fatalf("byCustomer = %+v, %v", byCustomer, err)
+	}
+
+	if err := orders.Delete(ctx, "o1"); err != nil {
+		t.Fatal(err)
+	}
+	if all, err := orders.Query(ctx, nil); err != nil || len(all) != 1 {
+		t.Fatalf("all = %+v, %v", all, err)
+	}
+}
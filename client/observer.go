@@ -0,0 +1,76 @@
+package client
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// RequestInfo describes an attempt of a request
+type RequestInfo struct {
+	Method     string
+	Path       string        // below the base URL, without the query string
+	Attempt    int           // 1 for the first attempt
+	StatusCode int           // 0 when no response was received
+	Duration   time.Duration // until the response was read
+	Err        error         // nil for successful attempts
+}
+
+// Observer receives the events of a client, to export them as metrics. Its methods
+// are called synchronously by the goroutine making the request, so they must be
+// quick and must not call the client. Embed BaseObserver to implement only the
+// methods you need.
+type Observer interface {
+	// RequestDone is called after every attempt, retries included
+	RequestDone(info RequestInfo)
+	// Retrying is called when a failed attempt is retried after delay
+	Retrying(info RequestInfo, delay time.Duration)
+	// RetryDenied is called when the retry budget refuses to retry a failed attempt
+	RetryDenied(info RequestInfo)
+	// BreakerChanged is called when the circuit breaker changes state
+	BreakerChanged(from, to BreakerState)
+}
+
+// BaseObserver implements every Observer method as a no-op
+type BaseObserver struct{}
+
+func (BaseObserver) RequestDone(RequestInfo)              {}
+func (BaseObserver) Retrying(RequestInfo, time.Duration)  {}
+func (BaseObserver) RetryDenied(RequestInfo)              {}
+func (BaseObserver) BreakerChanged(from, to BreakerState) {}
+
+// Stats reports the client-side health of a Client since it was created
+type Stats struct {
+	Breaker       BreakerState `json:"breaker"`
+	Requests      int64        `json:"requests"`       // made by the application
+	Retries       int64        `json:"retries"`        // attempts beyond the first
+	RetriesDenied int64        `json:"retries_denied"` // by the retry budget
+	Rejected      int64        `json:"rejected"`       // failed with ErrCircuitOpen
+	BreakerOpens  int64        `json:"breaker_opens"`
+}
+
+type clientStats struct {
+	requests      atomic.Int64
+	retries       atomic.Int64
+	retriesDenied atomic.Int64
+	rejected      atomic.Int64
+	breakerOpens  atomic.Int64
+}
+
+// Stats returns the counters of the client and the state of its circuit breaker
+func (c *Client) Stats() Stats {
+	return Stats{
+		Breaker:       c.breaker.current(),
+		Requests:      c.stats.requests.Load(),
+		Retries:       c.stats.retries.Load(),
+		RetriesDenied: c.stats.retriesDenied.Load(),
+		Rejected:      c.stats.rejected.Load(),
+		BreakerOpens:  c.stats.breakerOpens.Load(),
+	}
+}
+
+func (c *Client) breakerChanged(from, to BreakerState) {
+	if to == BreakerOpen {
+		c.stats.breakerOpens.Add(1)
+	}
+	c.observer.BreakerChanged(from, to)
+}
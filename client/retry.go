@@ -0,0 +1,161 @@
+package client
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// retryWindow is the period over which the retry budget compares retries to requests
+const retryWindow = 10 * time.Second
+
+// RetryPolicy decides which failed requests are retried and when. Zero fields take
+// their defaults; set MaxAttempts to 1 to disable retries.
+//
+// Requests failing with a network error, 502, 503 or 504 are retried when they are
+// idempotent (GET, PUT and DELETE). Other requests are only retried after a 429 or
+// 503 carrying Retry-After, the server's way of shedding a request before handling
+// it. Retries wait an exponential backoff with full jitter, or the Retry-After of
+// the server when longer; a Retry-After beyond MaxDelay is not waited for.
+type RetryPolicy struct {
+	MaxAttempts int           // attempts per request, the first included, 3 by default
+	BaseDelay   time.Duration // backoff before the first retry, 100ms by default
+	MaxDelay    time.Duration // longest backoff, 2s by default
+
+	// The retry budget lets retries add at most BudgetRatio to the requests made
+	// over the last ten seconds, 0.2 by default, plus MinRetriesPerSecond, 10 by
+	// default, so that clients making few requests still retry. Retries beyond the
+	// budget are not made and the request fails with the last error.
+	BudgetRatio         float64
+	MinRetriesPerSecond int
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = 100 * time.Millisecond
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 2 * time.Second
+	}
+	if p.MaxDelay < p.BaseDelay {
+		p.MaxDelay = p.BaseDelay
+	}
+	if p.BudgetRatio <= 0 {
+		p.BudgetRatio = 0.2
+	}
+	if p.MinRetriesPerSecond <= 0 {
+		p.MinRetriesPerSecond = 10
+	}
+	return p
+}
+
+var jitter = struct {
+	rand  *rand.Rand
+	mutex sync.Mutex
+}{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// backoff returns the delay before the retry following attempt: a random duration
+// up to BaseDelay doubled per attempt made, capped at MaxDelay
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.BaseDelay
+	for i := 1; i < attempt && ceiling < p.MaxDelay; i++ {
+		ceiling *= 2
+	}
+	if ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	jitter.mutex.Lock()
+	defer jitter.mutex.Unlock()
+	return time.Duration(jitter.rand.Int63n(int64(ceiling) + 1))
+}
+
+// retryable reports whether the failed attempt of a method request may be retried,
+// retryAfter being the Retry-After of its response
+func (info RequestInfo) retryable(method string, retryAfter time.Duration) bool {
+	idempotent := method == http.MethodGet || method == http.MethodPut || method == http.MethodDelete
+	switch info.StatusCode {
+	case 0:
+		return info.Err != nil && idempotent
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusServiceUnavailable:
+		return idempotent || retryAfter > 0
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+// parseRetryAfter returns the delay of a Retry-After header given in seconds, or 0
+func parseRetryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// retryBudget counts requests and retries per second over retryWindow
+type retryBudget struct {
+	ratio    float64
+	minimum  int // retries allowed per window regardless of the ratio
+	requests [10]int
+	retries  [10]int
+	second   int64 // the second counted by the current slot
+	mutex    sync.Mutex
+	now      func() time.Time
+}
+
+func newRetryBudget(policy RetryPolicy) *retryBudget {
+	return &retryBudget{
+		ratio:   policy.BudgetRatio,
+		minimum: policy.MinRetriesPerSecond * int(retryWindow/time.Second),
+		now:     time.Now,
+	}
+}
+
+// advance clears the slots of the seconds passed since the last call
+func (b *retryBudget) advance() int {
+	now := b.now().Unix()
+	slots := int64(len(b.requests))
+	if now-b.second >= slots {
+		b.requests, b.retries = [10]int{}, [10]int{}
+	} else {
+		for s := b.second + 1; s <= now; s++ {
+			b.requests[s%slots], b.retries[s%slots] = 0, 0
+		}
+	}
+	if now > b.second {
+		b.second = now
+	}
+	return int(b.second % slots)
+}
+
+// request counts a request made
+func (b *retryBudget) request() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.requests[b.advance()]++
+}
+
+// withdraw counts a retry and reports whether the budget allows it
+func (b *retryBudget) withdraw() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	slot := b.advance()
+	requests, retries := 0, 0
+	for i := range b.requests {
+		requests += b.requests[i]
+		retries += b.retries[i]
+	}
+	if float64(retries) >= float64(b.minimum)+b.ratio*float64(requests) {
+		return false
+	}
+	b.retries[slot]++
+	return true
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// requestTimeout bounds each request to the server
+const requestTimeout = 60 * time.Second
+
+// client calls the HTTP API of a database server
+type client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// response is the envelope of every API response
+type response struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+	Error   string          `json:"error"`
+}
+
+// request returns a GET request of path with query
+func (c *client) request(ctx context.Context, path string, query url.Values) (*http.Request, error) {
+	target := strings.TrimRight(c.baseURL, "/") + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// get requests path with query and decodes the data of the response into out
+func (c *client) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	req, err := c.request(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	if c.http == nil {
+		c.http = &http.Client{Timeout: requestTimeout}
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var envelope response
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return fmt.Errorf("server answered %s with an invalid body", resp.Status)
+	}
+	if resp.StatusCode >= 300 || !envelope.Success {
+		if envelope.Error == "" {
+			envelope.Error = resp.Status
+		}
+		return fmt.Errorf("%s", envelope.Error)
+	}
+	if resp.Header.Get("X-Partial-Results") == "true" {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", envelope.Message)
+	}
+	// Numbers keep their exact text, as the server keeps them
+	decoder := json.NewDecoder(bytes.NewReader(envelope.Data))
+	decoder.UseNumber()
+	return decoder.Decode(out)
+}
+
+// stream requests a server-sent event stream and calls fn with the name and data
+// of each event until the stream ends, ctx is done or fn fails. Requests are not
+// bounded by requestTimeout, streams being open for as long as they are read.
+func (c *client) stream(ctx context.Context, path string, query url.Values, fn func(event, data string) error) error {
+	req, err := c.request(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var envelope response
+		if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil || envelope.Error == "" {
+			return fmt.Errorf("server answered %s", resp.Status)
+		}
+		return fmt.Errorf("%s", envelope.Error)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	var event, data string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data != "" {
+				if err := fn(event, data); err != nil {
+					return err
+				}
+			}
+			event, data = "", ""
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(line[len("event:"):])
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(line[len("data:"):])
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// completionTTL is how long the names fetched for completion are reused
+const completionTTL = 30 * time.Second
+
+// completionTimeout bounds the requests made while completing, so a slow server
+// does not freeze the prompt
+const completionTimeout = 2 * time.Second
+
+// systemCollections are the read-only collections describing the server, listed
+// by no other system collection
+var systemCollections = []string{"_system.collections", "_system.indexes", "_system.jobs", "_system.labels", "_system.nodes"}
+
+// queryOptions are the query string options completed along with field names
+var queryOptions = []string{"_collation=", "_explain=", "_fields=", "_lookup=", "_partial=", "_sort=", "_timeout="}
+
+// completer completes shell lines with command names, collection names from
+// _system.collections, field names inferred by /_schema and graph labels from
+// _system.labels. Names are fetched when first completed and cached for
+// completionTTL; a failed fetch completes nothing rather than interrupting.
+type completer struct {
+	client *client
+	cache  map[string]cachedNames
+}
+
+type cachedNames struct {
+	names   []string
+	fetched time.Time
+}
+
+func newCompleter(c *client) *completer {
+	return &completer{client: c, cache: make(map[string]cachedNames)}
+}
+
+// complete returns the candidates for the word ending line and the offset in line
+// where that word starts. Candidates ending with = or . take no space after them.
+func (c *completer) complete(line string) (int, []string) {
+	words := strings.Fields(line)
+	if len(words) == 0 || !strings.HasSuffix(line, words[len(words)-1]) {
+		words = append(words, "") // completing a new word
+	}
+	word := words[len(words)-1]
+	start := len(line) - len(word)
+
+	if len(words) == 1 {
+		return start, withPrefix(shellCommandNames(), word)
+	}
+	switch words[0] {
+	case "query", "schema":
+		if len(words) == 2 {
+			return start, withPrefix(c.collections(), word)
+		}
+		if words[0] == "query" {
+			offset, candidates := c.filter(words[1], word)
+			return start + offset, candidates
+		}
+	case "watch":
+		key, value, found := strings.Cut(word, "=")
+		switch {
+		case !found:
+			return start, withPrefix([]string{"label=", "type="}, word)
+		case key == "label":
+			return start + len(key) + 1, withPrefix(c.labels("node"), value)
+		case key == "type":
+			return start + len(key) + 1, withPrefix(c.labels("edge"), value)
+		}
+	case "labels":
+		return start, withPrefix([]string{"node", "edge"}, word)
+	case "format":
+		return start, withPrefix([]string{formatTable, formatJSON, formatNDJSON, formatCSV}, word)
+	}
+	return start, nil
+}
+
+// filter completes a query filter of collection: the field name or option before
+// =, then field names for the values of _sort and _fields. It returns the offset in
+// word of the part completed.
+func (c *completer) filter(collection, word string) (int, []string) {
+	key, value, found := strings.Cut(word, "=")
+	if !found {
+		// Field operators such as :after are left to the user
+		if strings.Contains(word, ":") {
+			return 0, nil
+		}
+		fields := c.fields(collection)
+		candidates := make([]string, 0, len(fields)+len(queryOptions))
+		for _, field := range fields {
+			candidates = append(candidates, field+"=")
+		}
+		return 0, withPrefix(append(candidates, queryOptions...), word)
+	}
+	switch key {
+	case "_sort":
+		offset := len(key) + 1
+		if strings.HasPrefix(value, "-") {
+			offset, value = offset+1, value[1:]
+		}
+		return offset, withPrefix(c.fields(collection), value)
+	case "_fields":
+		offset := len(key) + 1
+		if i := strings.LastIndex(value, ","); i >= 0 {
+			offset, value = offset+i+1, value[i+1:]
+		}
+		return offset, withPrefix(c.fields(collection), value)
+	}
+	return 0, nil
+}
+
+func (c *completer) collections() []string {
+	return c.names("collections", func(ctx context.Context) ([]string, error) {
+		names, err := c.documentNames(ctx, "_system.collections", nil)
+		return append(names, systemCollections...), err
+	})
+}
+
+// labels returns the node labels or edge types of the graph, kind being node or edge
+func (c *completer) labels(kind string) []string {
+	return c.names("labels:"+kind, func(ctx context.Context) ([]string, error) {
+		return c.documentNames(ctx, "_system.labels", url.Values{"kind": {kind}})
+	})
+}
+
+// fields returns the dot paths of the fields of collection, nested objects included
+func (c *completer) fields(collection string) []string {
+	return c.names("fields:"+collection, func(ctx context.Context) ([]string, error) {
+		var schema struct {
+			Fields map[string]*schemaField `json:"fields"`
+		}
+		if err := c.client.get(ctx, "/docs/"+url.PathEscape(collection)+"/_schema", nil, &schema); err != nil {
+			return nil, err
+		}
+		var paths []string
+		var walk func(prefix string, fields map[string]*schemaField)
+		walk = func(prefix string, fields map[string]*schemaField) {
+			for name, field := range fields {
+				paths = append(paths, prefix+name)
+				if field != nil {
+					walk(prefix+name+".", field.Fields)
+				}
+			}
+		}
+		walk("", schema.Fields)
+		return paths, nil
+	})
+}
+
+// schemaField is the part of a field's inferred schema completion uses
+type schemaField struct {
+	Fields map[string]*schemaField `json:"fields"`
+}
+
+// documentNames returns the name field of the documents of a system collection
+func (c *completer) documentNames(ctx context.Context, collection string, query url.Values) ([]string, error) {
+	var docs []document
+	if err := c.client.get(ctx, "/docs/"+collection, query, &docs); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		if name, ok := doc["name"].(string); ok {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// names returns the names cached under key, fetching them when missing or stale
+func (c *completer) names(key string, fetch func(ctx context.Context) ([]string, error)) []string {
+	if cached, exists := c.cache[key]; exists && time.Since(cached.fetched) < completionTTL {
+		return cached.names
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+	names, err := fetch(ctx)
+	if err != nil {
+		return nil
+	}
+	sort.Strings(names)
+	c.cache[key] = cachedNames{names: names, fetched: time.Now()}
+	return names
+}
+
+// forget drops the cached names, so the next completion sees the server's changes
+func (c *completer) forget() {
+	c.cache = make(map[string]cachedNames)
+}
+
+// withPrefix returns the names starting with prefix
+func withPrefix(names []string, prefix string) []string {
+	var matches []string
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			matches = append(matches, name)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats of query results
+const (
+	formatTable  = "table"
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+)
+
+// newResultWriter returns a function writing documents to out in format
+func newResultWriter(format string, out io.Writer) (func(docs []document) error, error) {
+	switch format {
+	case formatTable:
+		return func(docs []document) error { return writeTable(out, docs) }, nil
+	case formatJSON:
+		return func(docs []document) error {
+			if docs == nil {
+				docs = []document{}
+			}
+			encoder := json.NewEncoder(out)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(docs)
+		}, nil
+	case formatNDJSON:
+		return func(docs []document) error {
+			encoder := json.NewEncoder(out)
+			for _, doc := range docs {
+				if err := encoder.Encode(doc); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, nil
+	case formatCSV:
+		return func(docs []document) error { return writeCSV(out, docs) }, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, expected table, json, ndjson or csv", format)
+}
+
+// columns returns the top-level fields of docs in name order, _id first
+func columns(docs []document) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, doc := range docs {
+		for field := range doc {
+			if !seen[field] {
+				seen[field] = true
+				names = append(names, field)
+			}
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == "_id") != (names[j] == "_id") {
+			return names[i] == "_id"
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// cell formats a field value: strings as they are, nested values as JSON and missing
+// values as empty
+func cell(value interface{}, present bool) string {
+	if !present || value == nil {
+		return ""
+	}
+	if text, ok := value.(string); ok {
+		return text
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+func writeTable(out io.Writer, docs []document) error {
+	if len(docs) == 0 {
+		_, err := fmt.Fprintln(out, "(no documents)")
+		return err
+	}
+	names := columns(docs)
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(names, "\t"))
+	for _, doc := range docs {
+		row := make([]string, len(names))
+		for i, name := range names {
+			value, present := doc[name]
+			// Tabs and newlines would break the alignment
+			row[i] = strings.NewReplacer("\t", " ", "\n", " ").Replace(cell(value, present))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func writeCSV(out io.Writer, docs []document) error {
+	names := columns(docs)
+	w := csv.NewWriter(out)
+	if err := w.Write(names); err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		row := make([]string, len(names))
+		for i, name := range names {
+			value, present := doc[name]
+			row[i] = cell(value, present)
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestResultWriters(t *testing.T) {
+	docs := []document{
+		{"_id": "a", "name": "Ann\tLee", "total": json.Number("12.50"), "address": map[string]interface{}{"city": "Oslo"}},
+		{"_id": "b", "name": "Bob, Jr.", "tags": []interface{}{"x"}, "note": nil},
+	}
+	tests := []struct {
+		format string
+		docs   []document
+		want   string
+	}{
+		{formatTable, docs, "" +
+			"_id  address          name      note  tags   total\n" +
+			"a    {\"city\":\"Oslo\"}  Ann Lee                12.50\n" +
+			"b                     Bob, Jr.        [\"x\"]  \n"},
+		{formatTable, nil, "(no documents)\n"},
+		{formatCSV, docs, "" +
+			"_id,address,name,note,tags,total\n" +
+			"a,\"{\"\"city\"\":\"\"Oslo\"\"}\",Ann\tLee,,,12.50\n" +
+			"b,,\"Bob, Jr.\",,\"[\"\"x\"\"]\",\n"},
+		{formatNDJSON, docs, "" +
+			`{"_id":"a","address":{"city":"Oslo"},"name":"Ann\tLee","total":12.50}` + "\n" +
+			`{"_id":"b","name":"Bob, Jr.","note":null,"tags":["x"]}` + "\n"},
+		{formatNDJSON, nil, ""},
+		{formatJSON, nil, "[]\n"},
+		{formatJSON, docs[1:], "[\n  {\n    \"_id\": \"b\",\n    \"name\": \"Bob, Jr.\",\n    \"note\": null,\n    \"tags\": [\n      \"x\"\n    ]\n  }\n]\n"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		writer, err := newResultWriter(tt.format, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writer(tt.docs); err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s of %d documents:\n%s\nwant:\n%s", tt.format, len(tt.docs), out.String(), tt.want)
+		}
+	}
+
+	if _, err := newResultWriter("xml", &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "unknown format") {
+		t.Fatalf("unknown format: %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// historySize is the number of lines the line editor recalls with the arrow keys
+const historySize = 500
+
+// lineEditor reads the lines of the shell. On a terminal it edits them in raw
+// mode: Tab completes, Up and Down recall earlier lines, Backspace, Ctrl-U and
+// Ctrl-W delete, Ctrl-C discards the line and Ctrl-D on an empty line ends the
+// input. Elsewhere, as when input is piped, it reads whole lines as they come.
+type lineEditor struct {
+	in       *os.File
+	out      io.Writer
+	reader   *bufio.Reader
+	terminal bool
+	history  []string
+	complete func(line string) (int, []string)
+}
+
+func newLineEditor(in *os.File, out io.Writer, complete func(line string) (int, []string)) *lineEditor {
+	e := &lineEditor{in: in, out: out, reader: bufio.NewReader(in), complete: complete}
+	if restore, err := makeRaw(int(in.Fd())); err == nil {
+		restore()
+		e.terminal = true
+	}
+	return e
+}
+
+// readLine reads a line after printing prompt, returning io.EOF once the input ends
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	if !e.terminal {
+		return e.readPlain(prompt)
+	}
+	restore, err := makeRaw(int(e.in.Fd()))
+	if err != nil {
+		return e.readPlain(prompt)
+	}
+	defer restore()
+
+	var line []rune
+	recalled := len(e.history)
+	redraw := func() { fmt.Fprintf(e.out, "\r\x1b[K%s%s", prompt, string(line)) }
+	redraw()
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			text := strings.TrimSpace(string(line))
+			if text != "" && (len(e.history) == 0 || e.history[len(e.history)-1] != text) {
+				e.history = append(e.history, text)
+				if len(e.history) > historySize {
+					e.history = e.history[1:]
+				}
+			}
+			return text, nil
+		case 3: // Ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			line, recalled = nil, len(e.history)
+		case 4: // Ctrl-D
+			if len(line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+		case 127, 8: // Backspace
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+		case 21: // Ctrl-U
+			line = nil
+		case 23: // Ctrl-W
+			end := len(line)
+			for end > 0 && line[end-1] == ' ' {
+				end--
+			}
+			for end > 0 && line[end-1] != ' ' {
+				end--
+			}
+			line = line[:end]
+		case 12: // Ctrl-L
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case '\t':
+			line = e.completeLine(prompt, line)
+		case 27: // escape sequences, of which only Up and Down are handled
+			switch e.readEscape() {
+			case 'A':
+				if recalled > 0 {
+					recalled--
+					line = []rune(e.history[recalled])
+				}
+			case 'B':
+				if recalled < len(e.history) {
+					recalled++
+					line = nil
+					if recalled < len(e.history) {
+						line = []rune(e.history[recalled])
+					}
+				}
+			}
+		default:
+			if r >= ' ' {
+				line = append(line, r)
+			}
+		}
+		redraw()
+	}
+}
+
+// readEscape reads the rest of an escape sequence and returns its final byte
+func (e *lineEditor) readEscape() byte {
+	b, err := e.reader.ReadByte()
+	if err != nil || (b != '[' && b != 'O') {
+		return 0
+	}
+	for {
+		b, err := e.reader.ReadByte()
+		if err != nil || (b >= 0x40 && b <= 0x7e) {
+			return b
+		}
+	}
+}
+
+// completeLine completes the word ending line. A single candidate replaces the
+// word; several extend it to their common prefix, or are listed when they share
+// nothing more.
+func (e *lineEditor) completeLine(prompt string, line []rune) []rune {
+	text := string(line)
+	start, candidates := e.complete(text)
+	word := text[start:]
+	switch len(candidates) {
+	case 0:
+		fmt.Fprint(e.out, "\a")
+		return line
+	case 1:
+		completed := text[:start] + candidates[0]
+		if !strings.HasSuffix(completed, "=") && !strings.HasSuffix(completed, ".") {
+			completed += " "
+		}
+		return []rune(completed)
+	}
+	prefix := commonPrefix(candidates)
+	if len(prefix) > len(word) {
+		return []rune(text[:start] + prefix)
+	}
+	fmt.Fprint(e.out, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+	return line
+}
+
+func (e *lineEditor) readPlain(prompt string) (string, error) {
+	if e.terminal {
+		fmt.Fprint(e.out, prompt)
+	}
+	line, err := e.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// commonPrefix returns the longest prefix of every name
+func commonPrefix(names []string) string {
+	prefix := names[0]
+	for _, name := range names[1:] {
+		for !strings.HasPrefix(name, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
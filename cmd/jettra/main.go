@@ -0,0 +1,72 @@
+// Command jettra is a command line client of a database server, for operators
+// exploring data without writing scripts:
+//
+//	jettra query [flags] <collection> [filter ...]   run a document query
+//	jettra shell [flags]                             start an interactive shell
+//
+// Every command takes -url and -token, defaulting to $JETTRA_URL (or
+// http://localhost:8080) and $JETTRA_TOKEN.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// errUsage is returned for invalid command lines, after the usage has been printed
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch command, args := os.Args[1], os.Args[2:]; command {
+	case "query":
+		err = runQuery(args)
+	case "shell":
+		err = runShell(args)
+	case "help", "-h", "-help", "--help":
+		usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "jettra: unknown command %q\n", command)
+		usage()
+		os.Exit(2)
+	}
+	if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "jettra: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `Usage: jettra <command> [flags] [arguments]
+
+Commands:
+  query   run a document query: jettra query [flags] <collection> [filter ...]
+  shell   start an interactive shell with completion: jettra shell [flags]
+
+Run jettra <command> -h for the flags of a command.
+`)
+}
+
+// newFlagSet returns the flags of command with the connection flags every command
+// takes, bound to client
+func newFlagSet(command string, c *client) *flag.FlagSet {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	url := os.Getenv("JETTRA_URL")
+	if url == "" {
+		url = "http://localhost:8080"
+	}
+	flags.StringVar(&c.baseURL, "url", url, "server base URL, $JETTRA_URL")
+	flags.StringVar(&c.token, "token", os.Getenv("JETTRA_TOKEN"), "API token of the server, $JETTRA_TOKEN")
+	return flags
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// document is a query result, with numbers kept as json.Number
+type document = map[string]interface{}
+
+// runQuery runs a document query. Filters are written as in query strings, one per
+// argument or several joined with &, e.g. status=open age:int=30 _sort=-total.
+func runQuery(args []string) error {
+	c := &client{}
+	flags := newFlagSet("query", c)
+	format := flags.String("format", formatTable, "output format: table, json, ndjson or csv")
+	pageSize := flags.Int("page-size", 0, "documents per page, 0 prints every document (paged here, the server still sends them all)")
+	page := flags.Int("page", 1, "page to print with -page-size")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: jettra query [flags] <collection> [filter ...]")
+		fmt.Fprintln(os.Stderr, "Example: jettra query -format csv orders status=open _sort=-total")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 1 || *pageSize < 0 || *page < 1 {
+		flags.Usage()
+		return errUsage
+	}
+	writer, err := newResultWriter(*format, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	docs, err := queryDocuments(context.Background(), c, flags.Arg(0), flags.Args()[1:])
+	if err != nil {
+		return err
+	}
+
+	total := len(docs)
+	if *pageSize > 0 {
+		docs = pageOf(docs, *pageSize, *page)
+	}
+	if err := writer(docs); err != nil {
+		return err
+	}
+	if *pageSize > 0 {
+		pages := (total + *pageSize - 1) / *pageSize
+		fmt.Fprintf(os.Stderr, "page %d of %d, %d documents\n", *page, pages, total)
+	}
+	return nil
+}
+
+// queryDocuments returns the documents of collection matching the filter arguments
+func queryDocuments(ctx context.Context, c *client, collection string, filters []string) ([]document, error) {
+	query, err := parseFilters(filters)
+	if err != nil {
+		return nil, err
+	}
+	var docs []document
+	if err := c.get(ctx, "/docs/"+url.PathEscape(collection), query, &docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// parseFilters merges query string arguments into one query
+func parseFilters(args []string) (url.Values, error) {
+	query := url.Values{}
+	for _, arg := range args {
+		values, err := url.ParseQuery(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %q: %w", arg, err)
+		}
+		for key, list := range values {
+			query[key] = append(query[key], list...)
+		}
+	}
+	return query, nil
+}
+
+// pageOf returns the page-th page of size documents, counting from 1. The server has
+// no paging of document queries, so pages are cut from the whole result.
+func pageOf(docs []document, size, page int) []document {
+	start := (page - 1) * size
+	if start >= len(docs) {
+		return nil
+	}
+	end := start + size
+	if end > len(docs) {
+		end = len(docs)
+	}
+	return docs[start:end]
+}
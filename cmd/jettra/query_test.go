@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestPageOf(t *testing.T) {
+	docs := make([]document, 5)
+	for i := range docs {
+		docs[i] = document{"_id": fmt.Sprint(i)}
+	}
+	ids := func(page []document) []string {
+		list := []string{}
+		for _, doc := range page {
+			list = append(list, doc["_id"].(string))
+		}
+		return list
+	}
+	tests := []struct {
+		size, page int
+		want       []string
+	}{
+		{2, 1, []string{"0", "1"}},
+		{2, 3, []string{"4"}},
+		{2, 4, []string{}},
+		{5, 1, []string{"0", "1", "2", "3", "4"}},
+		{10, 1, []string{"0", "1", "2", "3", "4"}},
+	}
+	for _, tt := range tests {
+		if got := ids(pageOf(docs, tt.size, tt.page)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("page %d of size %d = %v, want %v", tt.page, tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestQueryDocuments(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"success": false, "error": "missing or invalid API token"}`)
+			return
+		}
+		if r.URL.Path != "/docs/my orders" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"success": false, "error": "not found"}`)
+			return
+		}
+		query := r.URL.Query()
+		if query.Get("status") != "open" || !reflect.DeepEqual(query["tag"], []string{"a", "b"}) || query.Get("_sort") != "-total" {
+			t.Errorf("query = %v", query)
+		}
+		fmt.Fprint(w, `{"success": true, "data": [{"_id": "o1", "total": 12345678901234567890}]}`)
+	}))
+	defer server.Close()
+
+	c := &client{baseURL: server.URL, token: "secret"}
+	docs, err := queryDocuments(context.Background(), c, "my orders", []string{"status=open&tag=a", "tag=b", "_sort=-total"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Numbers keep their exact text
+	if len(docs) != 1 || docs[0]["total"] != json.Number("12345678901234567890") {
+		t.Fatalf("documents = %v", docs)
+	}
+
+	if _, err := queryDocuments(context.Background(), c, "orders", []string{"status=%zz"}); err == nil {
+		t.Fatal("invalid filter accepted")
+	}
+	c.token = ""
+	if _, err := queryDocuments(context.Background(), c, "my orders", nil); err == nil || err.Error() != "missing or invalid API token" {
+		t.Fatalf("request without the token: %v", err)
+	}
+}
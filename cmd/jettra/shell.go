@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// shellCommands describes the commands of the interactive shell, in help order
+var shellCommands = []struct{ name, args, description string }{
+	{"query", "<collection> [filter ...]", "run a document query"},
+	{"schema", "<collection>", "list the fields inferred from a collection"},
+	{"collections", "", "list the collections"},
+	{"labels", "[node|edge]", "list the graph's node labels and edge types"},
+	{"watch", "[label=<label>] [type=<type>]", "stream graph changes until Ctrl-C"},
+	{"format", "[table|json|ndjson|csv]", "show or set the output format"},
+	{"refresh", "", "forget the names cached for completion"},
+	{"help", "", "list the commands"},
+	{"exit", "", "leave the shell, as does Ctrl-D"},
+}
+
+func shellCommandNames() []string {
+	names := make([]string, len(shellCommands))
+	for i, command := range shellCommands {
+		names[i] = command.name
+	}
+	return names
+}
+
+// shell runs the commands read by the interactive shell
+type shell struct {
+	client    *client
+	format    string
+	completer *completer
+	out       io.Writer
+}
+
+// runShell starts an interactive shell running queries against the server, with
+// Tab completing commands, collection names, field names and graph labels
+func runShell(args []string) error {
+	c := &client{}
+	flags := newFlagSet("shell", c)
+	format := flags.String("format", formatTable, "output format: table, json, ndjson or csv")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: jettra shell [flags]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return errUsage
+	}
+	if _, err := newResultWriter(*format, os.Stdout); err != nil {
+		return err
+	}
+
+	s := &shell{client: c, format: *format, completer: newCompleter(c), out: os.Stdout}
+	editor := newLineEditor(os.Stdin, os.Stdout, s.completer.complete)
+	if editor.terminal {
+		fmt.Fprintf(s.out, "Connected to %s. Tab completes, help lists the commands.\n", c.baseURL)
+	}
+	for {
+		line, err := editor.readLine("jettra> ")
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if line == "exit" || line == "quit" {
+			return nil
+		}
+		if err := s.run(line); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+	}
+}
+
+// run runs a command line, cancelled by Ctrl-C
+func (s *shell) run(line string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	words := strings.Fields(line)
+	command, args := words[0], words[1:]
+	err := s.command(ctx, command, args)
+	if ctx.Err() != nil && errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+func (s *shell) command(ctx context.Context, command string, args []string) error {
+	switch command {
+	case "query":
+		if len(args) < 1 {
+			return fmt.Errorf("usage: query <collection> [filter ...]")
+		}
+		docs, err := queryDocuments(ctx, s.client, args[0], args[1:])
+		if err != nil {
+			return err
+		}
+		return s.print(docs)
+	case "schema":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: schema <collection>")
+		}
+		return s.schema(ctx, args[0])
+	case "collections":
+		docs, err := queryDocuments(ctx, s.client, "_system.collections", []string{"_sort=name"})
+		if err != nil {
+			return err
+		}
+		return s.print(docs)
+	case "labels":
+		filters := []string{"_sort=name"}
+		if len(args) > 0 {
+			filters = append(filters, "kind="+url.QueryEscape(args[0]))
+		}
+		docs, err := queryDocuments(ctx, s.client, "_system.labels", filters)
+		if err != nil {
+			return err
+		}
+		return s.print(docs)
+	case "watch":
+		query, err := parseFilters(args)
+		if err != nil {
+			return err
+		}
+		return s.client.stream(ctx, "/graph/_watch", query, func(event, data string) error {
+			_, err := fmt.Fprintf(s.out, "%s %s\n", event, data)
+			return err
+		})
+	case "format":
+		if len(args) != 1 {
+			fmt.Fprintln(s.out, s.format)
+			return nil
+		}
+		if _, err := newResultWriter(args[0], s.out); err != nil {
+			return err
+		}
+		s.format = args[0]
+		return nil
+	case "refresh":
+		s.completer.forget()
+		return nil
+	case "help":
+		table := tabwriter.NewWriter(s.out, 0, 0, 2, ' ', 0)
+		for _, command := range shellCommands {
+			fmt.Fprintf(table, "  %s %s\t%s\n", command.name, command.args, command.description)
+		}
+		table.Flush()
+		fmt.Fprintln(s.out, "Filters are written as in query strings, e.g. status=open total:int=30 _sort=-total")
+		return nil
+	}
+	return fmt.Errorf("unknown command %q, help lists the commands", command)
+}
+
+// schema prints a row per field inferred from collection, nested fields as dot paths
+func (s *shell) schema(ctx context.Context, collection string) error {
+	var schema struct {
+		Sampled int                      `json:"sampled"`
+		Fields  map[string]*fieldSummary `json:"fields"`
+	}
+	if err := s.client.get(ctx, "/docs/"+url.PathEscape(collection)+"/_schema", nil, &schema); err != nil {
+		return err
+	}
+	var docs []document
+	var walk func(prefix string, fields map[string]*fieldSummary)
+	walk = func(prefix string, fields map[string]*fieldSummary) {
+		for name, field := range fields {
+			if field == nil {
+				continue
+			}
+			types := make([]string, 0, len(field.Types))
+			for name := range field.Types {
+				types = append(types, name)
+			}
+			sort.Strings(types)
+			docs = append(docs, document{"field": prefix + name, "types": strings.Join(types, ","), "presence": field.Presence})
+			walk(prefix+name+".", field.Fields)
+		}
+	}
+	walk("", schema.Fields)
+	sort.Slice(docs, func(i, j int) bool { return docs[i]["field"].(string) < docs[j]["field"].(string) })
+	return s.print(docs)
+}
+
+// fieldSummary is the part of a field's inferred schema the shell prints
+type fieldSummary struct {
+	Types    map[string]int           `json:"types"`
+	Presence float64                  `json:"presence"`
+	Fields   map[string]*fieldSummary `json:"fields"`
+}
+
+func (s *shell) print(docs []document) error {
+	writer, err := newResultWriter(s.format, s.out)
+	if err != nil {
+		return err
+	}
+	return writer(docs)
+}
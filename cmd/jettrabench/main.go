@@ -0,0 +1,325 @@
+// Command jettrabench drives a configurable workload against a database server or an
+// embedded engine and reports throughput and latency percentiles per model and
+// operation. Use -json to record results for regression tracking.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// options configures a benchmark run
+type options struct {
+	URL         string
+	Duration    time.Duration
+	Concurrency int
+	ReadRatio   float64
+	ValueSize   int
+	Keys        int
+	Models      map[string]int // model name to relative weight
+	Seed        int64
+}
+
+// result summarizes the operations of one model and kind
+type result struct {
+	Model      string  `json:"model"`
+	Op         string  `json:"op"`
+	Count      int     `json:"count"`
+	Errors     int     `json:"errors"`
+	Throughput float64 `json:"ops_per_sec"`
+	P50        float64 `json:"p50_ms"`
+	P90        float64 `json:"p90_ms"`
+	P99        float64 `json:"p99_ms"`
+	Max        float64 `json:"max_ms"`
+}
+
+// report is the machine-readable output of a run
+type report struct {
+	Target      string        `json:"target"`
+	Duration    float64       `json:"duration_sec"`
+	Concurrency int           `json:"concurrency"`
+	ReadRatio   float64       `json:"read_ratio"`
+	ValueSize   int           `json:"value_size"`
+	Keys        int           `json:"keys"`
+	Total       result        `json:"total"`
+	Results     []result      `json:"results"`
+	FirstError  string        `json:"first_error,omitempty"`
+	elapsed     time.Duration // actual run time
+}
+
+type opKey struct {
+	model string
+	op    string
+}
+
+// samples collects the latencies of one worker, merged after the run
+type samples struct {
+	latencies  map[opKey][]time.Duration
+	errors     map[opKey]int
+	firstError error
+}
+
+func main() {
+	opts := options{}
+	models := flag.String("models", "document=1,kv=1,column=1,graph=1", "model mix as model=weight pairs")
+	flag.StringVar(&opts.URL, "url", "", "server base URL, e.g. http://localhost:8080; empty benchmarks an embedded engine")
+	flag.DurationVar(&opts.Duration, "duration", 10*time.Second, "how long to run the workload")
+	flag.IntVar(&opts.Concurrency, "concurrency", 16, "number of concurrent workers")
+	flag.Float64Var(&opts.ReadRatio, "reads", 0.8, "fraction of operations that are reads")
+	flag.IntVar(&opts.ValueSize, "value-size", 256, "size of written values in bytes")
+	flag.IntVar(&opts.Keys, "keys", 10000, "number of keys per model, preloaded before the run")
+	flag.Int64Var(&opts.Seed, "seed", 1, "random seed for key and operation selection")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	var err error
+	if opts.Models, err = parseModels(*models); err != nil {
+		log.Fatal(err)
+	}
+	if opts.Concurrency <= 0 || opts.Keys <= 0 || opts.ReadRatio < 0 || opts.ReadRatio > 1 {
+		log.Fatal("concurrency and keys must be positive and reads between 0 and 1")
+	}
+
+	var t target
+	targetName := opts.URL
+	if opts.URL == "" {
+		embedded, err := newEmbeddedTarget()
+		if err != nil {
+			log.Fatal(err)
+		}
+		t, targetName = embedded, "embedded"
+	} else {
+		t = newHTTPTarget(strings.TrimRight(opts.URL, "/"), opts.Concurrency)
+	}
+	defer t.close()
+
+	if err := preload(t, opts); err != nil {
+		log.Fatalf("preload failed: %v", err)
+	}
+
+	rep := run(t, opts)
+	rep.Target = targetName
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(rep)
+		return
+	}
+	printReport(rep)
+}
+
+// parseModels parses "document=2,kv=1"; a model without weight counts as 1
+func parseModels(spec string) (map[string]int, error) {
+	models := make(map[string]int)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, weightText, hasWeight := strings.Cut(part, "=")
+		weight := 1
+		if hasWeight {
+			var err error
+			if weight, err = strconv.Atoi(weightText); err != nil || weight < 0 {
+				return nil, fmt.Errorf("invalid weight for model %s", name)
+			}
+		}
+		switch name {
+		case modelDocument, modelKV, modelColumn, modelGraph:
+		default:
+			return nil, fmt.Errorf("unknown model %q", name)
+		}
+		if weight > 0 {
+			models[name] = weight
+		}
+	}
+	if len(models) == 0 {
+		return nil, fmt.Errorf("no models selected")
+	}
+	return models, nil
+}
+
+// preload writes every key of every selected model so reads and updates hit
+func preload(t target, opts options) error {
+	value := strings.Repeat("x", opts.ValueSize)
+	for model := range opts.Models {
+		keys := make(chan int)
+		errs := make(chan error, opts.Concurrency)
+		var wg sync.WaitGroup
+		for w := 0; w < opts.Concurrency; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range keys {
+					if err := t.write(model, strconv.Itoa(i), value, true); err != nil {
+						errs <- fmt.Errorf("%s key %d: %w", model, i, err)
+						return
+					}
+				}
+			}()
+		}
+		for i := 0; i < opts.Keys; i++ {
+			keys <- i
+		}
+		close(keys)
+		wg.Wait()
+		close(errs)
+		if err := <-errs; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func run(t target, opts options) *report {
+	// Weighted model selection from a flat slice
+	var mix []string
+	names := make([]string, 0, len(opts.Models))
+	for model := range opts.Models {
+		names = append(names, model)
+	}
+	sort.Strings(names)
+	for _, model := range names {
+		for i := 0; i < opts.Models[model]; i++ {
+			mix = append(mix, model)
+		}
+	}
+
+	value := strings.Repeat("y", opts.ValueSize)
+	deadline := time.Now().Add(opts.Duration)
+	results := make([]*samples, opts.Concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < opts.Concurrency; w++ {
+		s := &samples{latencies: make(map[opKey][]time.Duration), errors: make(map[opKey]int)}
+		results[w] = s
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(opts.Seed + int64(worker)))
+			for n := 0; time.Now().Before(deadline); n++ {
+				model := mix[rng.Intn(len(mix))]
+				key := strconv.Itoa(rng.Intn(opts.Keys))
+				k := opKey{model, "write"}
+				if rng.Float64() < opts.ReadRatio {
+					k.op = "read"
+				}
+
+				began := time.Now()
+				var err error
+				switch {
+				case k.op == "read":
+					err = t.read(model, key)
+				case model == modelGraph:
+					err = t.write(model, fmt.Sprintf("w%d-%d", worker, n), value, true)
+				default:
+					err = t.write(model, key, value, false)
+				}
+				s.latencies[k] = append(s.latencies[k], time.Since(began))
+				if err != nil {
+					s.errors[k]++
+					if s.firstError == nil {
+						s.firstError = err
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	merged := make(map[opKey][]time.Duration)
+	errors := make(map[opKey]int)
+	rep := &report{
+		Duration:    elapsed.Seconds(),
+		Concurrency: opts.Concurrency,
+		ReadRatio:   opts.ReadRatio,
+		ValueSize:   opts.ValueSize,
+		Keys:        opts.Keys,
+		elapsed:     elapsed,
+	}
+	var all []time.Duration
+	for _, s := range results {
+		for k, latencies := range s.latencies {
+			merged[k] = append(merged[k], latencies...)
+			all = append(all, latencies...)
+		}
+		for k, count := range s.errors {
+			errors[k] += count
+		}
+		if rep.FirstError == "" && s.firstError != nil {
+			rep.FirstError = s.firstError.Error()
+		}
+	}
+
+	totalErrors := 0
+	for k, latencies := range merged {
+		rep.Results = append(rep.Results, summarize(k.model, k.op, latencies, errors[k], elapsed))
+		totalErrors += errors[k]
+	}
+	sort.Slice(rep.Results, func(i, j int) bool {
+		if rep.Results[i].Model != rep.Results[j].Model {
+			return rep.Results[i].Model < rep.Results[j].Model
+		}
+		return rep.Results[i].Op < rep.Results[j].Op
+	})
+	rep.Total = summarize("all", "all", all, totalErrors, elapsed)
+	return rep
+}
+
+func summarize(model, op string, latencies []time.Duration, errors int, elapsed time.Duration) result {
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	r := result{Model: model, Op: op, Count: len(latencies), Errors: errors}
+	if len(latencies) == 0 {
+		return r
+	}
+	r.Throughput = float64(len(latencies)) / elapsed.Seconds()
+	r.P50 = percentile(latencies, 0.50)
+	r.P90 = percentile(latencies, 0.90)
+	r.P99 = percentile(latencies, 0.99)
+	r.Max = milliseconds(latencies[len(latencies)-1])
+	return r
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies in milliseconds
+func percentile(sorted []time.Duration, p float64) float64 {
+	idx := int(p*float64(len(sorted))+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return milliseconds(sorted[idx])
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func printReport(rep *report) {
+	fmt.Printf("target %s, %d workers, %.0f%% reads, %d byte values, %d keys, %s\n\n",
+		rep.Target, rep.Concurrency, rep.ReadRatio*100, rep.ValueSize, rep.Keys, rep.elapsed.Round(time.Millisecond))
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "model\top\tcount\terrors\tops/s\tp50 ms\tp90 ms\tp99 ms\tmax ms\t")
+	for _, r := range append(rep.Results, rep.Total) {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.0f\t%.3f\t%.3f\t%.3f\t%.3f\t\n",
+			r.Model, r.Op, r.Count, r.Errors, r.Throughput, r.P50, r.P90, r.P99, r.Max)
+	}
+	tw.Flush()
+
+	if rep.FirstError != "" {
+		fmt.Printf("\nfirst error: %s\n", rep.FirstError)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"multimodel-db-engine/internal/config"
+	"multimodel-db-engine/internal/database"
+)
+
+// Data models a workload can exercise
+const (
+	modelDocument = "document"
+	modelKV       = "kv"
+	modelColumn   = "column"
+	modelGraph    = "graph"
+)
+
+// benchNamespace is the collection, bucket and column family the benchmark writes to
+const benchNamespace = "jettrabench"
+
+// target executes benchmark operations against a server or an embedded engine.
+// create is set while preloading; afterwards writes update existing entries, except
+// for the graph model which has no node updates and creates a new node per write.
+type target interface {
+	write(model, key string, value string, create bool) error
+	read(model, key string) error
+	close()
+}
+
+// embeddedTarget calls an in-process engine, measuring the engine without HTTP overhead
+type embeddedTarget struct {
+	db      *database.MultiModelDatabase
+	dataDir string
+}
+
+func newEmbeddedTarget() (*embeddedTarget, error) {
+	dataDir, err := os.MkdirTemp("", "jettrabench-")
+	if err != nil {
+		return nil, err
+	}
+	db := database.NewMultiModelDatabase(&config.Config{DataDir: dataDir, ReplicationFactor: 1})
+	return &embeddedTarget{db: db, dataDir: dataDir}, nil
+}
+
+func (t *embeddedTarget) write(model, key string, value string, create bool) error {
+	switch model {
+	case modelDocument:
+		doc := database.Document{"value": value}
+		if create {
+			return t.db.InsertDocument(benchNamespace, key, doc)
+		}
+		return t.db.UpdateDocument(benchNamespace, key, doc)
+	case modelKV:
+		_, err := t.db.PutBucketValue(benchNamespace, key, value, database.PutOptions{})
+		return err
+	case modelColumn:
+		return t.db.InsertColumn(benchNamespace, key, "value", value)
+	case modelGraph:
+		return t.db.CreateNode(key, []string{benchNamespace}, map[string]interface{}{"value": value})
+	}
+	return fmt.Errorf("unknown model %q", model)
+}
+
+func (t *embeddedTarget) read(model, key string) error {
+	var err error
+	switch model {
+	case modelDocument:
+		_, err = t.db.GetDocument(benchNamespace, key)
+	case modelKV:
+		_, err = t.db.GetBucketValue(benchNamespace, key)
+	case modelColumn:
+		_, err = t.db.GetColumn(benchNamespace, key, "value")
+	case modelGraph:
+		_, err = t.db.GetNode(key)
+	default:
+		err = fmt.Errorf("unknown model %q", model)
+	}
+	return err
+}
+
+func (t *embeddedTarget) close() {
+	t.db.Close()
+	os.RemoveAll(t.dataDir)
+}
+
+// httpTarget drives a running server through its REST API
+type httpTarget struct {
+	baseURL string
+	client  *http.Client
+}
+
+func newHTTPTarget(baseURL string, concurrency int) *httpTarget {
+	return &httpTarget{
+		baseURL: baseURL,
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{MaxIdleConnsPerHost: concurrency},
+		},
+	}
+}
+
+func (t *httpTarget) write(model, key string, value string, create bool) error {
+	switch model {
+	case modelDocument:
+		method := http.MethodPut
+		if create {
+			method = http.MethodPost
+		}
+		return t.do(method, "/docs/"+benchNamespace+"/"+key, map[string]interface{}{"value": value})
+	case modelKV:
+		return t.do(http.MethodPut, "/kv/"+benchNamespace+"/"+key, value)
+	case modelColumn:
+		return t.do(http.MethodPut, "/columns/"+benchNamespace+"/"+key+"/value", value)
+	case modelGraph:
+		return t.do(http.MethodPost, "/graph/nodes", map[string]interface{}{
+			"id":     key,
+			"labels": []string{benchNamespace},
+			"props":  map[string]interface{}{"value": value},
+		})
+	}
+	return fmt.Errorf("unknown model %q", model)
+}
+
+func (t *httpTarget) read(model, key string) error {
+	switch model {
+	case modelDocument:
+		return t.do(http.MethodGet, "/docs/"+benchNamespace+"/"+key, nil)
+	case modelKV:
+		return t.do(http.MethodGet, "/kv/"+benchNamespace+"/"+key, nil)
+	case modelColumn:
+		return t.do(http.MethodGet, "/columns/"+benchNamespace+"/"+key+"/value", nil)
+	case modelGraph:
+		return t.do(http.MethodGet, "/graph/nodes/"+key, nil)
+	}
+	return fmt.Errorf("unknown model %q", model)
+}
+
+func (t *httpTarget) do(method, path string, body interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, t.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Drain the body so the connection is reused
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s returned status %d", method, path, resp.StatusCode)
+	}
+	return nil
+}
+
+func (t *httpTarget) close() {
+	t.client.CloseIdleConnections()
+}
@@ -9,10 +9,59 @@ import (
 type Config struct {
 	Port           string
 	DataDir        string
+	Ephemeral      bool // keep data in a temporary directory removed on shutdown, for test environments
 	ClusterEnabled bool
 	ClusterPort    string
+	NodeID         string // stable cluster node id, generated when empty
+	NodeZone       string // zone label replicas are spread across
+	NodeRack       string // rack label within the zone
+	ClusterSecret  string // shared secret signing node to node messages, empty disables
+	ClusterSeed    string // "host:port" of a member's cluster port joined at startup
 	ReplicationFactor int
 	ConsistencyLevel  string
+	PlacementRules    string // per-collection replica placement, e.g. orders=zone:3,logs=none:1
+	CRDTCollections   string // comma-separated collections whose documents merge as CRDTs
+	TransferChunkSize int // keys per chunk when a joining node streams its partitions
+	TransferRate      int // keys per second a joining node receives, 0 disables throttling
+	PartitionCount    int // hash ranges the key space is divided into
+	PartitionMaxMB    int // partition size the rebalancer splits above, 0 disables
+	PartitionMaxQPS   int // partition request rate the rebalancer splits above, 0 disables
+	CacheMaxAge       int // seconds HTTP caches may reuse query responses without revalidating
+	BlobDedup         bool // store identical blobs once
+	ReadOnly          bool // reject mutations from startup
+	RequestTimeout    int  // seconds before a request's context is cancelled, 0 disables
+	QueryTimeout      int  // milliseconds a document query may scan, 0 disables
+	QueryMaxExamined  int  // documents a document query may examine, 0 disables
+	DocCompression    string // codec keeping large document strings compressed in memory, empty disables
+	DocCompressAbove  int    // string length in bytes from which document strings are compressed
+	DocRawCacheMB     int    // megabytes of encoded documents kept for reads, 0 disables
+	MemoryLimitMB     int    // soft memory budget in megabytes, 0 disables eviction
+	MemoryEviction    string // stores evicted in order once over the budget, e.g. rawcache,kv,archives
+	MemoryWarnAt      string // percentages of the budget whose crossing emits a warning event
+	TrashRetention    int    // minutes dropped collections and column families stay restorable, 0 makes drops final
+	MaxInFlight       int  // concurrent requests per data model, 0 disables admission control
+	MaxQueued         int  // requests per data model waiting for a slot before load is shed
+	MaxBulkInFlight   int    // concurrent requests per data model for bulk priority collections
+	PriorityClasses   string // per-collection priority classes, e.g. orders=interactive,imports=bulk
+	RateLimit         int  // requests per second each client may send, 0 disables rate limiting
+	RateBurst         int  // requests a client may send at once before the rate limit applies
+	APIToken          string // bearer token the API requires, empty allows any client
+	AccessLog         bool   // log every API request with its status and duration
+	FaultInjection    bool // enable /admin/faults for crash-recovery and cluster testing
+	DebugAddr         string // listen address of the pprof and runtime diagnostics server, empty disables
+	AdminToken        string // bearer token the diagnostics server requires, empty allows any client
+	MutexProfileRate  int    // 1 in N mutex contention events sampled while diagnostics are served
+	KafkaRestURL      string // Kafka REST proxy receiving the change stream, empty disables
+	KafkaTopicPrefix  string // change topics are <prefix>.<model>.<namespace>
+	KafkaFormat       string // change record serialization: json or avro
+	TierEndpoint      string // S3-compatible endpoint receiving cold data
+	TierBucket        string // bucket for cold data, empty disables tiering
+	TierRegion        string
+	TierPrefix        string // object key prefix
+	TierAccessKey     string
+	TierSecretKey     string
+	TierColdDays      int // days without access after which documents and rows are tiered
+	SeedDir           string // fixture directory loaded at startup and by /admin/seed, empty disables
 }
 
 // LoadConfig loads configuration from environment variables or uses defaults
@@ -20,10 +69,59 @@ func LoadConfig() *Config {
 	return &Config{
 		Port:              getEnvOrDefault("DB_PORT", "8080"),
 		DataDir:           getEnvOrDefault("DB_DATA_DIR", "./data"),
+		Ephemeral:         getEnvOrDefaultBool("EPHEMERAL", false),
 		ClusterEnabled:    getEnvOrDefaultBool("CLUSTER_ENABLED", false),
 		ClusterPort:       getEnvOrDefault("CLUSTER_PORT", "9090"),
+		NodeID:            getEnvOrDefault("NODE_ID", ""),
+		NodeZone:          getEnvOrDefault("NODE_ZONE", ""),
+		NodeRack:          getEnvOrDefault("NODE_RACK", ""),
+		ClusterSecret:     getEnvOrDefault("CLUSTER_SECRET", ""),
+		ClusterSeed:       getEnvOrDefault("CLUSTER_SEED", ""),
 		ReplicationFactor: getEnvOrDefaultInt("REPLICATION_FACTOR", 1),
 		ConsistencyLevel:  getEnvOrDefault("CONSISTENCY_LEVEL", "quorum"),
+		PlacementRules:    getEnvOrDefault("PLACEMENT_RULES", ""),
+		CRDTCollections:   getEnvOrDefault("CRDT_COLLECTIONS", ""),
+		TransferChunkSize: getEnvOrDefaultInt("TRANSFER_CHUNK_SIZE", 500),
+		TransferRate:      getEnvOrDefaultInt("TRANSFER_RATE", 0),
+		PartitionCount:    getEnvOrDefaultInt("PARTITION_COUNT", 16),
+		PartitionMaxMB:    getEnvOrDefaultInt("PARTITION_MAX_MB", 64),
+		PartitionMaxQPS:   getEnvOrDefaultInt("PARTITION_MAX_QPS", 1000),
+		CacheMaxAge:       getEnvOrDefaultInt("CACHE_MAX_AGE", 0),
+		BlobDedup:         getEnvOrDefaultBool("BLOB_DEDUP", false),
+		ReadOnly:          getEnvOrDefaultBool("READ_ONLY", false),
+		RequestTimeout:    getEnvOrDefaultInt("REQUEST_TIMEOUT", 0),
+		QueryTimeout:      getEnvOrDefaultInt("QUERY_TIMEOUT_MS", 0),
+		QueryMaxExamined:  getEnvOrDefaultInt("QUERY_MAX_EXAMINED", 0),
+		DocCompression:    getEnvOrDefault("DOC_COMPRESSION", ""),
+		DocCompressAbove:  getEnvOrDefaultInt("DOC_COMPRESSION_THRESHOLD", 256),
+		DocRawCacheMB:     getEnvOrDefaultInt("DOC_RAW_CACHE_MB", 64),
+		MemoryLimitMB:     getEnvOrDefaultInt("MEMORY_LIMIT_MB", 0),
+		MemoryEviction:    getEnvOrDefault("MEMORY_EVICTION_ORDER", "rawcache,kv,archives"),
+		MemoryWarnAt:      getEnvOrDefault("MEMORY_WARN_PERCENT", "75,90"),
+		TrashRetention:    getEnvOrDefaultInt("TRASH_RETENTION_MINUTES", 1440),
+		MaxInFlight:       getEnvOrDefaultInt("MAX_INFLIGHT", 0),
+		MaxQueued:         getEnvOrDefaultInt("MAX_QUEUED", 0),
+		MaxBulkInFlight:   getEnvOrDefaultInt("MAX_BULK_INFLIGHT", 2),
+		PriorityClasses:   getEnvOrDefault("COLLECTION_PRIORITIES", ""),
+		RateLimit:         getEnvOrDefaultInt("RATE_LIMIT", 0),
+		RateBurst:         getEnvOrDefaultInt("RATE_BURST", 50),
+		APIToken:          getEnvOrDefault("API_TOKEN", ""),
+		AccessLog:         getEnvOrDefaultBool("ACCESS_LOG", false),
+		FaultInjection:    getEnvOrDefaultBool("FAULT_INJECTION", false),
+		DebugAddr:         getEnvOrDefault("DEBUG_ADDR", ""),
+		AdminToken:        getEnvOrDefault("ADMIN_TOKEN", ""),
+		MutexProfileRate:  getEnvOrDefaultInt("MUTEX_PROFILE_FRACTION", 100),
+		KafkaRestURL:      getEnvOrDefault("KAFKA_REST_URL", ""),
+		KafkaTopicPrefix:  getEnvOrDefault("KAFKA_TOPIC_PREFIX", "jettradb"),
+		KafkaFormat:       getEnvOrDefault("KAFKA_FORMAT", "json"),
+		TierEndpoint:      getEnvOrDefault("TIER_S3_ENDPOINT", "https://s3.amazonaws.com"),
+		TierBucket:        getEnvOrDefault("TIER_S3_BUCKET", ""),
+		TierRegion:        getEnvOrDefault("TIER_S3_REGION", "us-east-1"),
+		TierPrefix:        getEnvOrDefault("TIER_S3_PREFIX", ""),
+		TierAccessKey:     getEnvOrDefault("TIER_S3_ACCESS_KEY", ""),
+		TierSecretKey:     getEnvOrDefault("TIER_S3_SECRET_KEY", ""),
+		TierColdDays:      getEnvOrDefaultInt("TIER_COLD_DAYS", 0),
+		SeedDir:           getEnvOrDefault("SEED_DIR", ""),
 	}
 }
 
@@ -0,0 +1,45 @@
+package kafka
+
+// avroChangeSchema is the Avro schema of Change records. Values are schemaless in
+// the engine, so they are carried as JSON text; the proxy registers the schema with
+// the schema registry on first use.
+const avroChangeSchema = `{
+  "type": "record",
+  "name": "Change",
+  "namespace": "io.jettradb",
+  "fields": [
+    {"name": "op", "type": "string"},
+    {"name": "model", "type": "string"},
+    {"name": "namespace", "type": "string"},
+    {"name": "key", "type": "string"},
+    {"name": "field", "type": ["null", "string"], "default": null},
+    {"name": "value", "type": ["null", "string"], "default": null},
+    {"name": "ts", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "hlc", "type": ["null", "string"], "default": null}
+  ]
+}`
+
+// avroChange returns change in the Avro JSON encoding the REST proxy expects, where
+// non-null union values are wrapped in an object naming their branch
+func avroChange(change Change) map[string]interface{} {
+	value := map[string]interface{}{
+		"op":        string(change.Op),
+		"model":     string(change.Model),
+		"namespace": change.Namespace,
+		"key":       change.Key,
+		"field":     nil,
+		"value":     nil,
+		"ts":        change.Timestamp,
+		"hlc":       nil,
+	}
+	if change.Field != "" {
+		value["field"] = map[string]string{"string": change.Field}
+	}
+	if change.Value != nil {
+		value["value"] = map[string]string{"string": string(change.Value)}
+	}
+	if change.HLC != "" {
+		value["hlc"] = map[string]string{"string": change.HLC}
+	}
+	return value
+}
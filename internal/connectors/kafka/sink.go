@@ -0,0 +1,304 @@
+// Package kafka publishes the engine's change stream to Kafka. It talks to a Kafka
+// REST Proxy (Confluent REST Proxy v2 API) over HTTP, so the engine needs no Kafka
+// client library; the proxy handles partitioning, acks and schema registration.
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// Serialization formats
+const (
+	FormatJSON = "json"
+	FormatAvro = "avro"
+)
+
+// Options configures a Sink
+type Options struct {
+	ProxyURL      string        // REST proxy base URL, e.g. http://kafka-rest:8082
+	TopicPrefix   string        // topics are <prefix>.<model>.<namespace>
+	Format        string        // FormatJSON or FormatAvro
+	BufferSize    int           // events buffered before new ones are dropped
+	BatchSize     int           // records per produce request
+	FlushInterval time.Duration // maximum time an event waits in a partial batch
+	MaxRetries    int           // attempts per batch before it is dropped
+}
+
+// Change is the record value published for every applied write
+type Change struct {
+	Op        database.Operation `json:"op"`
+	Model     database.Model     `json:"model"`
+	Namespace string             `json:"namespace"`
+	Key       string             `json:"key"`
+	Field     string             `json:"field,omitempty"`
+	Value     json.RawMessage    `json:"value,omitempty"`
+	Timestamp int64              `json:"ts"`            // Unix milliseconds
+	HLC       string             `json:"hlc,omitempty"` // hybrid logical clock reading ordering changes across nodes
+}
+
+// SinkStats counts published and lost events
+type SinkStats struct {
+	Published uint64 `json:"published"`
+	Dropped   uint64 `json:"dropped"` // buffer full
+	Failed    uint64 `json:"failed"`  // unencodable or rejected after all retries
+}
+
+// Sink is a plugin that publishes every applied write to a topic per model and
+// namespace. Publishing is asynchronous and never blocks or fails a write; events
+// are dropped and counted when the proxy falls behind.
+type Sink struct {
+	database.BasePlugin
+	options Options
+	client  *http.Client
+	events  chan Change
+	done    chan struct{}
+	wg      sync.WaitGroup
+	once    sync.Once
+	stats   struct{ published, dropped, failed uint64 }
+}
+
+// NewSink creates a sink and starts its publisher
+func NewSink(options Options) (*Sink, error) {
+	if options.ProxyURL == "" {
+		return nil, fmt.Errorf("kafka sink requires a REST proxy URL")
+	}
+	if options.Format == "" {
+		options.Format = FormatJSON
+	}
+	if options.Format != FormatJSON && options.Format != FormatAvro {
+		return nil, fmt.Errorf("unsupported kafka serialization %q, expected json or avro", options.Format)
+	}
+	if options.TopicPrefix == "" {
+		options.TopicPrefix = "jettradb"
+	}
+	if options.BufferSize <= 0 {
+		options.BufferSize = 10000
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = 500
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = 100 * time.Millisecond
+	}
+	if options.MaxRetries <= 0 {
+		options.MaxRetries = 3
+	}
+	options.ProxyURL = strings.TrimRight(options.ProxyURL, "/")
+
+	sink := &Sink{
+		options: options,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		events:  make(chan Change, options.BufferSize),
+		done:    make(chan struct{}),
+	}
+	sink.wg.Add(1)
+	go sink.run()
+	return sink, nil
+}
+
+// Name implements database.Plugin
+func (s *Sink) Name() string { return "kafka-sink" }
+
+// AfterWrite implements database.WriteObserver. The value is encoded here rather
+// than by the publisher because stored documents may be updated in place later.
+func (s *Sink) AfterWrite(op database.Operation, event *database.WriteEvent) {
+	change := Change{
+		Op:        op,
+		Model:     event.Model,
+		Namespace: event.Namespace,
+		Key:       event.Key,
+		Field:     event.Field,
+		Timestamp: time.Now().UnixMilli(),
+	}
+	if !event.Timestamp.IsZero() {
+		change.Timestamp = event.Timestamp.Time().UnixMilli()
+		change.HLC = event.Timestamp.String()
+	}
+	if event.Value != nil {
+		value, err := json.Marshal(event.Value)
+		if err != nil {
+			log.Printf("Kafka sink: failed to encode %s %s/%s: %v", event.Model, event.Namespace, event.Key, err)
+			atomic.AddUint64(&s.stats.failed, 1)
+			return
+		}
+		change.Value = value
+	}
+	select {
+	case s.events <- change:
+	default:
+		atomic.AddUint64(&s.stats.dropped, 1)
+	}
+}
+
+// Stats returns the publishing counters
+func (s *Sink) Stats() SinkStats {
+	return SinkStats{
+		Published: atomic.LoadUint64(&s.stats.published),
+		Dropped:   atomic.LoadUint64(&s.stats.dropped),
+		Failed:    atomic.LoadUint64(&s.stats.failed),
+	}
+}
+
+// Close publishes buffered events and stops the publisher
+func (s *Sink) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+	})
+}
+
+// Topic returns the topic for events of model in namespace. Characters Kafka does
+// not allow in topic names are replaced with underscores.
+func (s *Sink) Topic(model database.Model, namespace string) string {
+	topic := []byte(s.options.TopicPrefix + "." + string(model) + "." + namespace)
+	for i, c := range topic {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			topic[i] = '_'
+		}
+	}
+	if len(topic) > 249 {
+		topic = topic[:249]
+	}
+	return string(topic)
+}
+
+func (s *Sink) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.options.FlushInterval)
+	defer ticker.Stop()
+
+	batches := make(map[string][]Change)
+	pending := 0
+	flush := func() {
+		for topic, batch := range batches {
+			s.publish(topic, batch)
+		}
+		batches = make(map[string][]Change)
+		pending = 0
+	}
+
+	for {
+		select {
+		case change := <-s.events:
+			topic := s.Topic(change.Model, change.Namespace)
+			batches[topic] = append(batches[topic], change)
+			if pending++; len(batches[topic]) >= s.options.BatchSize {
+				s.publish(topic, batches[topic])
+				pending -= len(batches[topic])
+				delete(batches, topic)
+			}
+		case <-ticker.C:
+			if pending > 0 {
+				flush()
+			}
+		case <-s.done:
+			for {
+				select {
+				case change := <-s.events:
+					topic := s.Topic(change.Model, change.Namespace)
+					batches[topic] = append(batches[topic], change)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// publish sends batch to topic, retrying with backoff
+func (s *Sink) publish(topic string, batch []Change) {
+	body, contentType, err := s.encode(batch)
+	if err != nil {
+		log.Printf("Kafka sink: failed to encode batch for %s: %v", topic, err)
+		atomic.AddUint64(&s.stats.failed, uint64(len(batch)))
+		return
+	}
+
+	backoff := 100 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		if err = s.post(topic, body, contentType); err == nil {
+			atomic.AddUint64(&s.stats.published, uint64(len(batch)))
+			return
+		}
+		if attempt == s.options.MaxRetries {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	log.Printf("Kafka sink: dropped %d events for %s: %v", len(batch), topic, err)
+	atomic.AddUint64(&s.stats.failed, uint64(len(batch)))
+}
+
+func (s *Sink) post(topic string, body []byte, contentType string) error {
+	req, err := http.NewRequest(http.MethodPost, s.options.ProxyURL+"/topics/"+topic, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Offsets []struct {
+			ErrorCode *int   `json:"error_code"`
+			Error     string `json:"error"`
+		} `json:"offsets"`
+		Message string `json:"message"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy returned %d: %s", resp.StatusCode, result.Message)
+	}
+	for _, offset := range result.Offsets {
+		if offset.ErrorCode != nil {
+			return fmt.Errorf("produce failed: %s", offset.Error)
+		}
+	}
+	return nil
+}
+
+// encode returns the produce request body for batch. Records are keyed by the
+// document id, KV key, row key or node/edge id so updates to one key stay ordered
+// within a partition.
+func (s *Sink) encode(batch []Change) ([]byte, string, error) {
+	type record struct {
+		Key   string      `json:"key"`
+		Value interface{} `json:"value"`
+	}
+	records := make([]record, len(batch))
+
+	if s.options.Format == FormatJSON {
+		for i, change := range batch {
+			records[i] = record{Key: change.Key, Value: change}
+		}
+		body, err := json.Marshal(map[string]interface{}{"records": records})
+		return body, "application/vnd.kafka.json.v2+json", err
+	}
+
+	for i, change := range batch {
+		records[i] = record{Key: change.Key, Value: avroChange(change)}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"key_schema":   `"string"`,
+		"value_schema": avroChangeSchema,
+		"records":      records,
+	})
+	return body, "application/vnd.kafka.avro.v2+json", err
+}
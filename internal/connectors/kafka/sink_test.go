@@ -0,0 +1,108 @@
+package kafka
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// fakeProxy records produce requests by topic
+type fakeProxy struct {
+	mutex        sync.Mutex
+	records      map[string][]json.RawMessage
+	contentTypes map[string]string
+	failures     int // requests to reject before accepting
+}
+
+func (p *fakeProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.failures > 0 {
+		p.failures--
+		http.Error(w, `{"error_code":50302,"message":"unavailable"}`, http.StatusServiceUnavailable)
+		return
+	}
+	var body struct {
+		ValueSchema string `json:"value_schema"`
+		Records     []struct {
+			Key   string          `json:"key"`
+			Value json.RawMessage `json:"value"`
+		} `json:"records"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	topic := r.URL.Path[len("/topics/"):]
+	for _, record := range body.Records {
+		p.records[topic] = append(p.records[topic], record.Value)
+	}
+	p.contentTypes[topic] = r.Header.Get("Content-Type")
+	w.Write([]byte(`{"offsets":[{"partition":0,"offset":1,"error_code":null,"error":null}]}`))
+}
+
+func newFakeProxy(t *testing.T, failures int) (*fakeProxy, string) {
+	proxy := &fakeProxy{records: make(map[string][]json.RawMessage), contentTypes: make(map[string]string), failures: failures}
+	server := httptest.NewServer(proxy)
+	t.Cleanup(server.Close)
+	return proxy, server.URL
+}
+
+func TestSinkPublishesPerTopic(t *testing.T) {
+	proxy, url := newFakeProxy(t, 1)
+	sink, err := NewSink(Options{ProxyURL: url, FlushInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink.AfterWrite(database.OpInsert, &database.WriteEvent{Model: database.ModelDocument, Namespace: "users", Key: "alice", Value: database.Document{"age": 30}})
+	sink.AfterWrite(database.OpDelete, &database.WriteEvent{Model: database.ModelDocument, Namespace: "users", Key: "bob"})
+	sink.AfterWrite(database.OpInsert, &database.WriteEvent{Model: database.ModelKeyValue, Namespace: "cache/1", Key: "k", Value: "v"})
+	sink.Close()
+
+	if stats := sink.Stats(); stats.Published != 3 || stats.Failed != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	users := proxy.records["jettradb.document.users"]
+	if len(users) != 2 {
+		t.Fatalf("expected 2 user changes, got %v", proxy.records)
+	}
+	var change Change
+	if err := json.Unmarshal(users[0], &change); err != nil || change.Op != database.OpInsert || string(change.Value) != `{"age":30}` {
+		t.Fatalf("unexpected change %s", users[0])
+	}
+	if len(proxy.records["jettradb.kv.cache_1"]) != 1 {
+		t.Fatalf("expected a sanitized kv topic, got %v", proxy.records)
+	}
+}
+
+func TestSinkAvroEncoding(t *testing.T) {
+	proxy, url := newFakeProxy(t, 0)
+	sink, err := NewSink(Options{ProxyURL: url, Format: FormatAvro})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.AfterWrite(database.OpUpdate, &database.WriteEvent{Model: database.ModelColumn, Namespace: "metrics", Key: "row1", Field: "cpu", Value: 0.5})
+	sink.Close()
+
+	topic := "jettradb.column.metrics"
+	if proxy.contentTypes[topic] != "application/vnd.kafka.avro.v2+json" {
+		t.Fatalf("unexpected content type %q", proxy.contentTypes[topic])
+	}
+	var value map[string]interface{}
+	json.Unmarshal(proxy.records[topic][0], &value)
+	if field := value["field"].(map[string]interface{}); field["string"] != "cpu" {
+		t.Fatalf("unexpected avro value %v", value)
+	}
+	if v := value["value"].(map[string]interface{}); v["string"] != "0.5" {
+		t.Fatalf("unexpected avro value %v", value)
+	}
+}
+
+func TestNewSinkRejectsUnknownFormat(t *testing.T) {
+	if _, err := NewSink(Options{ProxyURL: "http://localhost", Format: "protobuf"}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
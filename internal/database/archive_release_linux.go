@@ -0,0 +1,17 @@
+//go:build linux
+
+package database
+
+import "syscall"
+
+// releaseFile drops the resident pages of a read-only file mapping, which the kernel
+// reads back from the file when they are next touched, returning the bytes released
+func releaseFile(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	if err := syscall.Madvise(data, syscall.MADV_DONTNEED); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
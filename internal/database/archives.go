@@ -0,0 +1,351 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrArchived is returned for writes to archived collections
+var ErrArchived = errors.New("collection is archived")
+
+// archiveExt is the extension of archive files, named after their collection
+const archiveExt = ".arc"
+
+// Archive files hold the documents of a collection in id order:
+//
+//	magic | document JSON ... | ids ... | entry table | footer
+//
+// Each table entry holds the offset and length of a document and of its id, and
+// the footer the offset of the table and the number of entries. Lookups binary
+// search the table in the mapped file, so opening an archive reads nothing but the
+// footer however large it is.
+var (
+	archiveMagic  = []byte("JTARCHV1")
+	archiveFooter = []byte("JTARCEND")
+)
+
+const (
+	archiveEntrySize  = 24 // document offset, length, id offset, length
+	archiveFooterSize = 24 // table offset, entry count, archiveFooter
+)
+
+// ArchiveInfo describes an archived collection
+type ArchiveInfo struct {
+	Collection string    `json:"collection"`
+	Documents  int       `json:"documents"`
+	Bytes      int       `json:"bytes"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// archive is an immutable memory-mapped file holding the documents of an archived
+// collection
+type archive struct {
+	info  ArchiveInfo
+	path  string
+	data  []byte
+	table int // offset of the entry table
+}
+
+// writeArchive writes docs to path in id order, through a temporary file renamed
+// into place once complete
+func writeArchive(path string, docs map[string]Document) error {
+	ids := sortedKeys(docs)
+	var body, idBlob bytes.Buffer
+	body.Write(archiveMagic)
+	table := make([]byte, 0, len(ids)*archiveEntrySize)
+	docOffsets := make([]int, len(ids))
+	for i, id := range ids {
+		encoded, err := json.Marshal(docs[id])
+		if err != nil {
+			return fmt.Errorf("failed to encode document %s: %w", id, err)
+		}
+		docOffsets[i] = body.Len()
+		body.Write(encoded)
+	}
+	idsStart := body.Len()
+	for i, id := range ids {
+		docEnd := idsStart
+		if i+1 < len(ids) {
+			docEnd = docOffsets[i+1]
+		}
+		table = binary.LittleEndian.AppendUint64(table, uint64(docOffsets[i]))
+		table = binary.LittleEndian.AppendUint32(table, uint32(docEnd-docOffsets[i]))
+		table = binary.LittleEndian.AppendUint64(table, uint64(idsStart+idBlob.Len()))
+		table = binary.LittleEndian.AppendUint32(table, uint32(len(id)))
+		idBlob.WriteString(id)
+	}
+	body.Write(idBlob.Bytes())
+	tableOffset := body.Len()
+	body.Write(table)
+
+	footer := make([]byte, 0, archiveFooterSize)
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(tableOffset))
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(len(ids)))
+	body.Write(append(footer, archiveFooter...))
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, body.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// openArchive maps the archive file at path
+func openArchive(path string) (*archive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := int(stat.Size())
+	if size < len(archiveMagic)+archiveFooterSize {
+		return nil, fmt.Errorf("archive %s is truncated", path)
+	}
+	data, err := mapFile(f, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map archive %s: %w", path, err)
+	}
+
+	footer := data[size-archiveFooterSize:]
+	table := int(binary.LittleEndian.Uint64(footer))
+	count := int(binary.LittleEndian.Uint64(footer[8:]))
+	if !bytes.Equal(data[:len(archiveMagic)], archiveMagic) || !bytes.Equal(footer[16:], archiveFooter) ||
+		table < len(archiveMagic) || count < 0 || table+count*archiveEntrySize != size-archiveFooterSize {
+		unmapFile(data)
+		return nil, fmt.Errorf("archive %s is corrupt", path)
+	}
+
+	return &archive{
+		info: ArchiveInfo{
+			Collection: strings.TrimSuffix(filepath.Base(path), archiveExt),
+			Documents:  count,
+			Bytes:      size,
+			CreatedAt:  stat.ModTime().UTC(),
+		},
+		path:  path,
+		data:  data,
+		table: table,
+	}, nil
+}
+
+// close unmaps the archive; it must not be used afterwards
+func (a *archive) close() error {
+	return unmapFile(a.data)
+}
+
+// release drops the pages of the archive held in memory, which are read back from
+// its file on the next access, returning the bytes released
+func (a *archive) release() int {
+	released, err := releaseFile(a.data)
+	if err != nil {
+		log.Printf("Failed to release archive of %s: %v", a.info.Collection, err)
+	}
+	return released
+}
+
+// discard closes the archive and removes its file, once its documents live elsewhere
+func (a *archive) discard() {
+	if err := a.close(); err != nil {
+		log.Printf("Failed to unmap archive of %s: %v", a.info.Collection, err)
+	}
+	if err := os.Remove(a.path); err != nil {
+		log.Printf("Failed to remove archive of %s: %v", a.info.Collection, err)
+	}
+}
+
+func (a *archive) len() int {
+	return a.info.Documents
+}
+
+// entry returns the id and the encoded document of the i-th document in id order
+func (a *archive) entry(i int) (string, []byte) {
+	e := a.data[a.table+i*archiveEntrySize:]
+	docOffset := int(binary.LittleEndian.Uint64(e))
+	docLen := int(binary.LittleEndian.Uint32(e[8:]))
+	idOffset := int(binary.LittleEndian.Uint64(e[12:]))
+	idLen := int(binary.LittleEndian.Uint32(e[20:]))
+	return string(a.data[idOffset : idOffset+idLen]), a.data[docOffset : docOffset+docLen]
+}
+
+// document decodes the i-th document in id order
+func (a *archive) document(i int) (string, Document, error) {
+	id, encoded := a.entry(i)
+	var doc Document
+	if err := DecodeJSON(encoded, &doc); err != nil {
+		return id, nil, fmt.Errorf("invalid document %s in archive %s: %w", id, a.info.Collection, err)
+	}
+	return id, doc, nil
+}
+
+// find returns the position of the document with id
+func (a *archive) find(id string) (int, bool) {
+	i := sort.Search(a.len(), func(i int) bool {
+		candidate, _ := a.entry(i)
+		return candidate >= id
+	})
+	if i == a.len() {
+		return 0, false
+	}
+	candidate, _ := a.entry(i)
+	return i, candidate == id
+}
+
+// get returns the document with id
+func (a *archive) get(id string) (Document, bool, error) {
+	i, exists := a.find(id)
+	if !exists {
+		return nil, false, nil
+	}
+	_, doc, err := a.document(i)
+	return doc, err == nil, err
+}
+
+// each calls fn with every document in id order until it returns false
+func (a *archive) each(fn func(id string, doc Document) bool) error {
+	for i := 0; i < a.len(); i++ {
+		id, doc, err := a.document(i)
+		if err != nil {
+			return err
+		}
+		if !fn(id, doc) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (db *MultiModelDatabase) archiveDir() string {
+	return filepath.Join(db.config.DataDir, "archives")
+}
+
+// loadArchives maps the archives left by earlier runs
+func (db *MultiModelDatabase) loadArchives() {
+	paths, _ := filepath.Glob(filepath.Join(db.archiveDir(), "*"+archiveExt))
+	for _, path := range paths {
+		a, err := openArchive(path)
+		if err != nil {
+			log.Printf("Skipping archive: %v", err)
+			continue
+		}
+		db.archives[a.info.Collection] = a
+	}
+}
+
+// archived returns the archive of collection, or nil. Callers must hold the docMutex.
+func (db *MultiModelDatabase) archived(collection string) *archive {
+	return db.archives[collection]
+}
+
+// ArchiveCollection moves the documents of collection out of memory into an
+// immutable memory-mapped file. The collection stays readable, through gets,
+// queries, indexes and exports, and rejects writes until it is unarchived.
+func (db *MultiModelDatabase) ArchiveCollection(collection string) (*ArchiveInfo, error) {
+	if err := ValidateCollectionName(collection); err != nil {
+		return nil, err
+	}
+	if db.crdt.enabled(collection) {
+		return nil, fmt.Errorf("collection %s merges as CRDTs and cannot be archived", collection)
+	}
+	if err := db.warmCollection(collection); err != nil {
+		return nil, err
+	}
+
+	db.docMutex.Lock()
+	defer db.docMutex.Unlock()
+
+	if db.archived(collection) != nil {
+		return nil, fmt.Errorf("%w: %s", ErrArchived, collection)
+	}
+	prefix := collection + "."
+	docs := make(map[string]Document)
+	for key, doc := range db.documents {
+		if strings.HasPrefix(key, prefix) {
+			docs[key[len(prefix):]] = db.expandDocument(doc)
+		}
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("collection %s not found", collection)
+	}
+
+	path := filepath.Join(db.archiveDir(), collection+archiveExt)
+	if err := writeArchive(path, docs); err != nil {
+		return nil, fmt.Errorf("failed to write archive of %s: %w", collection, err)
+	}
+	a, err := openArchive(path)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	for id := range docs {
+		delete(db.documents, prefix+id)
+	}
+	db.archives[collection] = a
+	db.touchCollection(collection)
+	info := a.info
+	return &info, nil
+}
+
+// UnarchiveCollection loads the documents of an archived collection back into
+// memory, making it writable again, and removes its archive file
+func (db *MultiModelDatabase) UnarchiveCollection(collection string) (int, error) {
+	db.docMutex.Lock()
+	defer db.docMutex.Unlock()
+
+	a := db.archived(collection)
+	if a == nil {
+		return 0, fmt.Errorf("collection %s is not archived", collection)
+	}
+	prefix := collection + "."
+	docs := make(map[string]Document, a.len())
+	if err := a.each(func(id string, doc Document) bool {
+		docs[prefix+id] = db.compressDocument(doc)
+		return true
+	}); err != nil {
+		return 0, err
+	}
+	for key, doc := range docs {
+		db.documents[key] = doc
+	}
+	delete(db.archives, collection)
+	db.touchCollection(collection)
+	a.discard()
+	return len(docs), nil
+}
+
+// Archives returns the archived collections ordered by name
+func (db *MultiModelDatabase) Archives() []ArchiveInfo {
+	db.docMutex.RLock()
+	defer db.docMutex.RUnlock()
+
+	infos := make([]ArchiveInfo, 0, len(db.archives))
+	for _, name := range sortedKeys(db.archives) {
+		infos = append(infos, db.archives[name].info)
+	}
+	return infos
+}
+
+// closeArchives unmaps every archive
+func (db *MultiModelDatabase) closeArchives() {
+	db.docMutex.Lock()
+	defer db.docMutex.Unlock()
+	for name, a := range db.archives {
+		a.close()
+		delete(db.archives, name)
+	}
+}
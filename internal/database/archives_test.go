@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"multimodel-db-engine/internal/config"
+)
+
+func TestArchiveCollection(t *testing.T) {
+	cfg := &config.Config{DataDir: t.TempDir(), ReplicationFactor: 1}
+	db := NewMultiModelDatabase(cfg)
+	for i := 0; i < 50; i++ {
+		doc := Document{"n": float64(i), "parity": []string{"even", "odd"}[i%2]}
+		if err := db.InsertDocument("events", fmt.Sprintf("e%02d", i), doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, err := db.ArchiveCollection("events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Documents != 50 || info.Bytes == 0 {
+		t.Fatalf("archive info = %+v", info)
+	}
+	db.docMutex.RLock()
+	inMemory := len(db.documents)
+	db.docMutex.RUnlock()
+	if inMemory != 0 {
+		t.Fatalf("%d documents left in memory", inMemory)
+	}
+
+	// Reads see the archived documents, writes are rejected
+	check := func(db *MultiModelDatabase) {
+		t.Helper()
+		doc, err := db.GetDocument("events", "e07")
+		if err != nil || !numbersEqual(doc["n"], 7) {
+			t.Fatalf("get = %v, %v", doc, err)
+		}
+		if _, err := db.GetDocument("events", "e99"); err == nil {
+			t.Fatal("got a missing document")
+		}
+		docs, err := db.FindDocuments(context.Background(), "events", DocumentQuery{Filter: map[string]interface{}{"parity": "odd"}})
+		if err != nil || len(docs) != 25 {
+			t.Fatalf("query found %d documents, %v", len(docs), err)
+		}
+		if names := db.ListCollections(); len(names) != 1 || names[0] != "events" {
+			t.Fatalf("collections = %v", names)
+		}
+	}
+	check(db)
+	if err := db.CreateIndex(IndexSpec{Collection: "events", Field: "parity"}); err != nil {
+		t.Fatal(err)
+	}
+	if plan, err := db.ExplainQuery("events", DocumentQuery{Filter: map[string]interface{}{"parity": "even"}}); err != nil || plan.Strategy != PlanIndex || plan.Estimated != 25 {
+		t.Fatalf("plan = %+v, %v", plan, err)
+	}
+	check(db)
+	for name, write := range map[string]func() error{
+		"insert": func() error { return db.InsertDocument("events", "e50", Document{}) },
+		"update": func() error { return db.UpdateDocument("events", "e01", Document{"n": 0}) },
+		"delete": func() error { return db.DeleteDocument("events", "e01") },
+	} {
+		if err := write(); !errors.Is(err, ErrArchived) {
+			t.Errorf("%s on an archived collection: %v", name, err)
+		}
+	}
+
+	// Archives are mapped again on startup
+	db.Close()
+	db = NewMultiModelDatabase(cfg)
+	t.Cleanup(db.Close)
+	if archives := db.Archives(); len(archives) != 1 || archives[0].Documents != 50 {
+		t.Fatalf("archives after restart = %+v", archives)
+	}
+	check(db)
+
+	restored, err := db.UnarchiveCollection("events")
+	if err != nil || restored != 50 {
+		t.Fatalf("unarchive = %d, %v", restored, err)
+	}
+	if err := db.UpdateDocument("events", "e01", Document{"n": float64(100)}); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Archives()) != 0 {
+		t.Fatal("archive kept after unarchiving")
+	}
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Array operators of document filters, written {"tags": {"$contains": "go"}} or in
+// query strings as tags:contains=go
+const (
+	OpContains  = "$contains"  // an element matches the value
+	OpAll       = "$all"       // every value is matched by an element
+	OpSize      = "$size"      // the array has this many elements
+	OpElemMatch = "$elemMatch" // an element is an object matching every field filter
+)
+
+// arrayQueryOps maps the query string operators onto the array operators
+var arrayQueryOps = map[string]string{
+	"contains":  OpContains,
+	"all":       OpAll,
+	"size":      OpSize,
+	"elemMatch": OpElemMatch,
+}
+
+// parseArrayFilter parses the query string value of an array operator. $all takes
+// comma separated values and $elemMatch a JSON object of field filters.
+func parseArrayFilter(op, raw string) (map[string]interface{}, error) {
+	var value interface{}
+	switch op {
+	case OpContains:
+		value = QueryParam(raw)
+	case OpAll:
+		values := make([]interface{}, 0)
+		for _, v := range strings.Split(raw, ",") {
+			values = append(values, QueryParam(v))
+		}
+		value = values
+	case OpSize:
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("expected a non-negative integer")
+		}
+		value = n
+	case OpElemMatch:
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(raw), &fields); err != nil || fields == nil {
+			return nil, fmt.Errorf("expected a JSON object")
+		}
+		value = fields
+	}
+	return map[string]interface{}{op: value}, nil
+}
+
+// arrayOperators returns the operators of a filter value made only of array
+// operators
+func arrayOperators(filter interface{}) (map[string]interface{}, bool) {
+	ops, isMap := filter.(map[string]interface{})
+	if !isMap || len(ops) == 0 {
+		return nil, false
+	}
+	for op := range ops {
+		switch op {
+		case OpContains, OpAll, OpSize, OpElemMatch:
+		default:
+			return nil, false
+		}
+	}
+	return ops, true
+}
+
+// arrayMatches reports whether actual is an array satisfying every operator
+func (c Collation) arrayMatches(actual interface{}, ops map[string]interface{}) bool {
+	elements, isArray := actual.([]interface{})
+	if !isArray {
+		return false
+	}
+	for op, value := range ops {
+		switch op {
+		case OpContains:
+			if !c.containsMatch(elements, value) {
+				return false
+			}
+		case OpAll:
+			values, ok := value.([]interface{})
+			if !ok {
+				return false
+			}
+			for _, v := range values {
+				if !c.containsMatch(elements, v) {
+					return false
+				}
+			}
+		case OpSize:
+			n, ok := numberValue(value)
+			if !ok || float64(len(elements)) != n {
+				return false
+			}
+		case OpElemMatch:
+			fields, ok := value.(map[string]interface{})
+			if !ok || !c.elemMatch(elements, fields) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// containsMatch reports whether an element matches value
+func (c Collation) containsMatch(elements []interface{}, value interface{}) bool {
+	for _, element := range elements {
+		if c.filterMatches(element, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// elemMatch reports whether an object element matches every field filter
+func (c Collation) elemMatch(elements []interface{}, fields map[string]interface{}) bool {
+	for _, element := range elements {
+		object, isObject := element.(map[string]interface{})
+		if isObject && c.objectMatches(object, fields) {
+			return true
+		}
+	}
+	return false
+}
+
+// objectMatches reports whether object holds every filtered field, a key or a dot
+// path, with a matching value
+func (c Collation) objectMatches(object map[string]interface{}, filter map[string]interface{}) bool {
+	for field, expected := range filter {
+		if actual, exists := lookupPath(object, field); !exists || !c.filterMatches(actual, expected) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestArrayOperators(t *testing.T) {
+	db := newTestDatabase(t)
+	docs := map[string]Document{
+		"ann": {"name": "ann", "roles": []interface{}{"admin", "dev"}, "items": []interface{}{
+			map[string]interface{}{"sku": "a1", "qty": float64(2)},
+			map[string]interface{}{"sku": "b2", "qty": float64(1)},
+		}},
+		"bob": {"name": "bob", "roles": []interface{}{"dev"}, "items": []interface{}{
+			map[string]interface{}{"sku": "a1", "qty": float64(1)},
+		}},
+		"cy": {"name": "cy", "roles": "dev", "scores": []interface{}{float64(3), float64(5)}},
+	}
+	for id, doc := range docs {
+		if err := db.InsertDocument("users", id, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"roles:contains=dev", []string{"ann", "bob"}},
+		{"roles:all=dev,admin", []string{"ann"}},
+		{"roles:size=1", []string{"bob"}},
+		{"roles:contains=dev&roles:size=2", []string{"ann"}},
+		{"scores:contains=5", []string{"cy"}},
+		{`items:elemMatch={"sku":"a1","qty":2}`, []string{"ann"}},
+		{`items:elemMatch={"sku":"a1"}`, []string{"ann", "bob"}},
+	} {
+		query, err := url.ParseQuery(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filters, err := ParseQueryFilters(query)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.query, err)
+		}
+		results, err := db.QueryDocuments("users", filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, doc := range results {
+			got = append(got, doc["name"].(string))
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s matched %v, want %v", tc.query, got, tc.want)
+		}
+	}
+
+	// Filters built in code use the same operators
+	results, err := db.QueryDocuments("users", map[string]interface{}{"roles": map[string]interface{}{OpAll: []interface{}{"admin"}}})
+	if err != nil || len(results) != 1 || results[0]["name"] != "ann" {
+		t.Fatalf("$all matched %v, %v", results, err)
+	}
+
+	if _, err := ParseQueryFilters(url.Values{"roles:size": {"two"}}); err == nil {
+		t.Fatal("expected an error for a size that is not a number")
+	}
+}
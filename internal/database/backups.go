@@ -0,0 +1,378 @@
+package database
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrBackupNotFound is returned for backup ids missing from the catalog
+var ErrBackupNotFound = errors.New("backup not found")
+
+// BackupInfo is a catalog entry. Incremental backups name the backup they apply to
+// in Base; following Base links back to a full backup gives the restore chain.
+type BackupInfo struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"` // SnapshotFull or SnapshotIncremental
+	Base      string    `json:"base,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Records   int       `json:"records"` // records and tombstones in this backup alone
+	Size      int64     `json:"size"`
+}
+
+// BackupChain is a full backup followed by the incremental backups taken on top of
+// it, oldest first
+type BackupChain struct {
+	Full         BackupInfo   `json:"full"`
+	Incrementals []BackupInfo `json:"incrementals"`
+	Size         int64        `json:"size"`
+}
+
+// BackupStore keeps snapshot backups under DataDir with a JSON catalog. Incremental
+// backups hold only the records that changed since the previous backup, found by
+// comparing record lines against the state the existing chain restores to.
+type BackupStore struct {
+	db      *MultiModelDatabase
+	dir     string
+	backups []*BackupInfo // creation order
+	mutex   sync.Mutex
+}
+
+// newBackupStore creates a store in dir and loads its catalog
+func newBackupStore(db *MultiModelDatabase, dir string) *BackupStore {
+	s := &BackupStore{db: db, dir: dir}
+	data, err := os.ReadFile(s.catalogPath())
+	if err == nil {
+		err = json.Unmarshal(data, &s.backups)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to load backup catalog: %v", err)
+	}
+	return s
+}
+
+func (s *BackupStore) catalogPath() string {
+	return filepath.Join(s.dir, "catalog.json")
+}
+
+func (s *BackupStore) snapshotPath(id string) string {
+	return filepath.Join(s.dir, id+".snapshot")
+}
+
+// Create takes a backup. Incremental backups apply to the most recent backup; when
+// there is none, a full backup is taken instead.
+func (s *BackupStore) Create(incremental bool) (*BackupInfo, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sections, err := s.db.takeSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	info := &BackupInfo{ID: s.nextID(now), Kind: SnapshotFull, CreatedAt: now}
+	header := &SnapshotHeader{Version: SnapshotVersion, CreatedAt: now}
+	if incremental && len(s.backups) > 0 {
+		base := s.backups[len(s.backups)-1]
+		chain, err := s.plan(base.ID)
+		if err != nil {
+			return nil, err
+		}
+		previous, err := s.chainLines(chain)
+		if err != nil {
+			return nil, err
+		}
+		if sections, err = diffSections(sections, previous); err != nil {
+			return nil, err
+		}
+		info.Kind, info.Base = SnapshotIncremental, base.ID
+		header.Kind, header.Base = SnapshotIncremental, base.ID
+	}
+
+	var encoded bytes.Buffer
+	if err := writeSnapshotSections(&encoded, header, sections); err != nil {
+		return nil, err
+	}
+	for _, manifest := range header.Models {
+		info.Records += manifest.Records
+	}
+	info.Size = int64(encoded.Len())
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return nil, err
+	}
+	tmp := s.snapshotPath(info.ID) + ".tmp"
+	if err := os.WriteFile(tmp, encoded.Bytes(), 0o644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, s.snapshotPath(info.ID)); err != nil {
+		return nil, err
+	}
+
+	s.backups = append(s.backups, info)
+	if err := s.save(); err != nil {
+		s.backups = s.backups[:len(s.backups)-1]
+		os.Remove(s.snapshotPath(info.ID))
+		return nil, err
+	}
+	copied := *info
+	return &copied, nil
+}
+
+// nextID returns a sortable id that is unique within the catalog
+func (s *BackupStore) nextID(now time.Time) string {
+	base := now.Format("20060102T150405Z")
+	id := base
+	for n := 2; s.find(id) != nil; n++ {
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+	return id
+}
+
+func (s *BackupStore) find(id string) *BackupInfo {
+	for _, backup := range s.backups {
+		if backup.ID == id {
+			return backup
+		}
+	}
+	return nil
+}
+
+// List returns the catalog grouped into chains, oldest first
+func (s *BackupStore) List() []BackupChain {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	chains := make([]BackupChain, 0)
+	index := make(map[string]int) // backup id -> chain
+	for _, backup := range s.backups {
+		if backup.Kind == SnapshotFull {
+			index[backup.ID] = len(chains)
+			chains = append(chains, BackupChain{Full: *backup, Incrementals: []BackupInfo{}, Size: backup.Size})
+			continue
+		}
+		i, exists := index[backup.Base]
+		if !exists {
+			continue // base missing from the catalog
+		}
+		index[backup.ID] = i
+		chains[i].Incrementals = append(chains[i].Incrementals, *backup)
+		chains[i].Size += backup.Size
+	}
+	return chains
+}
+
+// Plan returns the backups restored, in order, to reach the state of backup id:
+// its full backup followed by every incremental backup up to and including id
+func (s *BackupStore) Plan(id string) ([]BackupInfo, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	chain, err := s.plan(id)
+	if err != nil {
+		return nil, err
+	}
+	plan := make([]BackupInfo, len(chain))
+	for i, backup := range chain {
+		plan[i] = *backup
+	}
+	return plan, nil
+}
+
+func (s *BackupStore) plan(id string) ([]*BackupInfo, error) {
+	var chain []*BackupInfo
+	for current := id; ; {
+		backup := s.find(current)
+		if backup == nil {
+			if current == id {
+				return nil, fmt.Errorf("%w: %s", ErrBackupNotFound, id)
+			}
+			return nil, fmt.Errorf("backup %s is missing base %s", chain[len(chain)-1].ID, current)
+		}
+		chain = append(chain, backup)
+		if backup.Kind == SnapshotFull {
+			break
+		}
+		current = backup.Base
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
+
+// Restore replaces the database contents with the state as of backup id. Every
+// backup in the chain is read and verified before anything is replaced.
+func (s *BackupStore) Restore(id string) (*SnapshotResult, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	chain, err := s.plan(id)
+	if err != nil {
+		return nil, err
+	}
+
+	replayed := make(map[Model]map[backupKey]snapshotRecord)
+	var final *parsedSnapshot
+	skipped := make(map[Model]struct{})
+	for _, backup := range chain {
+		parsed, err := s.read(backup, false)
+		if err != nil {
+			return nil, err
+		}
+		for model, records := range parsed.records {
+			if replayed[model] == nil {
+				replayed[model] = make(map[backupKey]snapshotRecord)
+			}
+			for _, record := range records {
+				key := backupKey{record.Namespace, record.Key}
+				if record.Deleted {
+					delete(replayed[model], key)
+				} else {
+					replayed[model][key] = record
+				}
+			}
+		}
+		for _, model := range parsed.skipped {
+			skipped[model] = struct{}{}
+		}
+		final = parsed
+	}
+
+	records := make(map[Model][]snapshotRecord)
+	for model, entries := range replayed {
+		for _, record := range entries {
+			records[model] = append(records[model], record)
+		}
+	}
+	var skippedModels []Model
+	for model := range skipped {
+		skippedModels = append(skippedModels, model)
+	}
+	sort.Slice(skippedModels, func(i, j int) bool { return skippedModels[i] < skippedModels[j] })
+
+	// The last backup's manifests carry the current bucket and family options
+	return s.db.restoreParsed(final.header.Version, final.manifests, records, skippedModels)
+}
+
+func (s *BackupStore) read(backup *BackupInfo, keepLines bool) (*parsedSnapshot, error) {
+	file, err := os.Open(s.snapshotPath(backup.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup %s: %w", backup.ID, err)
+	}
+	defer file.Close()
+	parsed, err := readSnapshot(file, keepLines)
+	if err != nil {
+		return nil, fmt.Errorf("backup %s: %w", backup.ID, err)
+	}
+	return parsed, nil
+}
+
+// save writes the catalog. Callers must hold the store mutex.
+func (s *BackupStore) save() error {
+	data, err := json.MarshalIndent(s.backups, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	tmp := s.catalogPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.catalogPath())
+}
+
+// backupKey identifies a record within a model
+type backupKey struct {
+	namespace, key string
+}
+
+// chainLines replays chain and returns the hash of every live record line per model
+func (s *BackupStore) chainLines(chain []*BackupInfo) (map[Model]map[backupKey][sha256.Size]byte, error) {
+	lines := make(map[Model]map[backupKey][sha256.Size]byte)
+	for _, backup := range chain {
+		parsed, err := s.read(backup, true)
+		if err != nil {
+			return nil, err
+		}
+		for model, records := range parsed.records {
+			if lines[model] == nil {
+				lines[model] = make(map[backupKey][sha256.Size]byte)
+			}
+			for i, record := range records {
+				key := backupKey{record.Namespace, record.Key}
+				if record.Deleted {
+					delete(lines[model], key)
+				} else {
+					lines[model][key] = sha256.Sum256(parsed.lines[model][i])
+				}
+			}
+		}
+	}
+	return lines, nil
+}
+
+// diffSections reduces full sections to the records that differ from previous, plus
+// sorted tombstones for records that no longer exist. Namespace options are kept
+// whole so the last backup of a chain always describes every bucket and family.
+func diffSections(sections []*snapshotSection, previous map[Model]map[backupKey][sha256.Size]byte) ([]*snapshotSection, error) {
+	diffed := make([]*snapshotSection, 0, len(sections))
+	for _, section := range sections {
+		model := section.manifest.Model
+		out := newSnapshotSection(model)
+		out.manifest.Namespaces = section.manifest.Namespaces
+		known := previous[model]
+		seen := make(map[backupKey]struct{}, len(known))
+
+		for _, line := range bytes.SplitAfter(section.lines.Bytes(), []byte("\n")) {
+			if len(line) == 0 {
+				continue
+			}
+			var id struct {
+				Namespace string `json:"namespace"`
+				Key       string `json:"key"`
+			}
+			if err := json.Unmarshal(line, &id); err != nil {
+				return nil, err
+			}
+			key := backupKey{id.Namespace, id.Key}
+			seen[key] = struct{}{}
+			if sum, exists := known[key]; exists && sum == sha256.Sum256(line) {
+				continue
+			}
+			out.lines.Write(line)
+			out.manifest.Records++
+		}
+
+		var deleted []backupKey
+		for key := range known {
+			if _, exists := seen[key]; !exists {
+				deleted = append(deleted, key)
+			}
+		}
+		sort.Slice(deleted, func(i, j int) bool {
+			if deleted[i].namespace != deleted[j].namespace {
+				return deleted[i].namespace < deleted[j].namespace
+			}
+			return deleted[i].key < deleted[j].key
+		})
+		for _, key := range deleted {
+			if err := out.add(snapshotRecord{Model: model, Namespace: key.namespace, Key: key.key, Deleted: true}); err != nil {
+				return nil, err
+			}
+		}
+		diffed = append(diffed, out)
+	}
+	return diffed, nil
+}
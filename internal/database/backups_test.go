@@ -0,0 +1,97 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIncrementalBackupChain(t *testing.T) {
+	db := seedSnapshotDatabase(t)
+	full, err := db.Backups.Create(true) // no backup to apply to yet
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.Kind != SnapshotFull {
+		t.Fatalf("first backup is %s, want full", full.Kind)
+	}
+
+	if err := db.UpdateDocument("users", "alice", Document{"name": "Alice B"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertDocument("users", "bob", Document{"name": "Bob"}); err != nil {
+		t.Fatal(err)
+	}
+	first, err := db.Backups.Create(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Kind != SnapshotIncremental || first.Base != full.ID || first.Records != 2 {
+		t.Fatalf("unexpected incremental backup %+v", first)
+	}
+
+	if err := db.DeleteDocument("users", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	second, err := db.Backups.Create(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Base != first.ID || second.Records != 1 {
+		t.Fatalf("expected a single tombstone, got %+v", second)
+	}
+
+	chains := db.Backups.List()
+	if len(chains) != 1 || len(chains[0].Incrementals) != 2 {
+		t.Fatalf("unexpected catalog %+v", chains)
+	}
+	plan, err := db.Backups.Plan(second.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 3 || plan[0].ID != full.ID || plan[2].ID != second.ID {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+
+	if err := db.InsertDocument("users", "carol", Document{"name": "Carol"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Backups.Restore(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	alice, err := db.GetDocument("users", "alice")
+	if err != nil || alice["name"] != "Alice B" {
+		t.Fatalf("alice = %v, %v", alice, err)
+	}
+	if _, err := db.GetDocument("users", "carol"); err == nil {
+		t.Fatal("document written after the backup survived the restore")
+	}
+	if value, err := db.GetBucketValue("cache", "raw"); err != nil || string(value.([]byte)) != "bytes" {
+		t.Fatalf("raw value = %v, %v", value, err)
+	}
+
+	if _, err := db.Backups.Restore(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetDocument("users", "alice"); err == nil {
+		t.Fatal("deleted document restored")
+	}
+	if _, err := db.GetDocument("users", "bob"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackupCatalogPersists(t *testing.T) {
+	db := seedSnapshotDatabase(t)
+	backup, err := db.Backups.Create(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := newBackupStore(db, db.Backups.dir)
+	if _, err := reloaded.Plan(backup.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloaded.Plan("missing"); !errors.Is(err, ErrBackupNotFound) {
+		t.Fatalf("expected ErrBackupNotFound, got %v", err)
+	}
+}
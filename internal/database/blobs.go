@@ -0,0 +1,541 @@
+package database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	blobDataSuffix = ".data"
+	blobMetaSuffix = ".meta.json"
+	blobUploadsDir = "_uploads"
+	blobContentDir = "_content"
+)
+
+// BlobInfo describes a stored blob
+type BlobInfo struct {
+	Bucket      string            `json:"bucket"`
+	Name        string            `json:"name"`
+	Size        int64             `json:"size"`
+	ContentType string            `json:"content_type"`
+	SHA256      string            `json:"sha256"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	// Deduplicated blobs keep their data in the shared content directory under SHA256
+	Deduplicated bool `json:"deduplicated,omitempty"`
+}
+
+// BlobUpload is an in-progress chunked upload. Parts are numbered from 1 and are
+// concatenated in order when the upload is completed.
+type BlobUpload struct {
+	ID          string            `json:"id"`
+	Bucket      string            `json:"bucket"`
+	Name        string            `json:"name"`
+	ContentType string            `json:"content_type"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Parts       map[int]int64     `json:"parts"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// BlobStore keeps large objects as files under <DataDir>/blobs/<bucket>/ with a JSON
+// metadata file next to each one. Upload sessions live in memory while their parts
+// are spooled to <DataDir>/blobs/_uploads/<id>/.
+//
+// With Dedup enabled, blob data is stored once per distinct content under
+// <DataDir>/blobs/_content/<sha256> and shared between blobs. Reference counts are
+// rebuilt from the metadata files on first use, so they never drift from disk.
+type BlobStore struct {
+	root    string
+	uploads map[string]*BlobUpload
+	mutex   sync.RWMutex
+
+	// Dedup must be set before the store is used
+	Dedup   bool
+	content map[string]*blobContent // nil until loaded
+}
+
+type blobContent struct {
+	size int64
+	refs int
+}
+
+// NewBlobStore creates a blob store rooted at dir; directories are created on first write
+func NewBlobStore(dir string) *BlobStore {
+	return &BlobStore{
+		root:    dir,
+		uploads: make(map[string]*BlobUpload),
+	}
+}
+
+// validateBlobPathElement rejects names that could escape the store or collide with
+// its bookkeeping files
+func validateBlobPathElement(kind, name string) error {
+	if name == "" {
+		return fmt.Errorf("blob %s must not be empty", kind)
+	}
+	if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return fmt.Errorf("blob %s %q contains invalid characters", kind, name)
+	}
+	if strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("blob %s %q must not start with '_' or '.'", kind, name)
+	}
+	return nil
+}
+
+func (s *BlobStore) blobPaths(bucket, name string) (dataPath, metaPath string, err error) {
+	if err := validateBlobPathElement("bucket", bucket); err != nil {
+		return "", "", err
+	}
+	if err := validateBlobPathElement("name", name); err != nil {
+		return "", "", err
+	}
+	dir := filepath.Join(s.root, bucket)
+	return filepath.Join(dir, name+blobDataSuffix), filepath.Join(dir, name+blobMetaSuffix), nil
+}
+
+// PutBlob stores the contents of r as bucket/name, replacing any existing blob. The data
+// is written to a temporary file first so readers never observe a partial blob.
+func (s *BlobStore) PutBlob(bucket, name, contentType string, metadata map[string]string, r io.Reader) (*BlobInfo, error) {
+	dataPath, metaPath, err := s.blobPaths(bucket, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dataPath), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create blob bucket %s: %w", bucket, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dataPath), ".upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary blob file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write blob %s/%s: %w", bucket, name, err)
+	}
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	info := &BlobInfo{
+		Bucket:      bucket,
+		Name:        name,
+		Size:        size,
+		ContentType: contentType,
+		SHA256:      hex.EncodeToString(hash.Sum(nil)),
+		Metadata:    metadata,
+		CreatedAt:   time.Now().UTC(),
+	}
+	encoded, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.Dedup {
+		return info, s.putDedupBlob(tmp.Name(), dataPath, metaPath, info)
+	}
+
+	previous, _ := readBlobInfo(metaPath, bucket, name)
+	if err := os.Rename(tmp.Name(), dataPath); err != nil {
+		return nil, fmt.Errorf("failed to store blob %s/%s: %w", bucket, name, err)
+	}
+	if previous != nil && previous.Deduplicated {
+		if err := s.releaseContent(previous); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.WriteFile(metaPath, encoded, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to store metadata for blob %s/%s: %w", bucket, name, err)
+	}
+	return info, nil
+}
+
+// StatBlob returns the metadata of bucket/name
+func (s *BlobStore) StatBlob(bucket, name string) (*BlobInfo, error) {
+	_, metaPath, err := s.blobPaths(bucket, name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return readBlobInfo(metaPath, bucket, name)
+}
+
+func readBlobInfo(metaPath, bucket, name string) (*BlobInfo, error) {
+	encoded, err := os.ReadFile(metaPath)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("blob %s not found in bucket %s", name, bucket)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata for blob %s/%s: %w", bucket, name, err)
+	}
+
+	var info BlobInfo
+	if err := json.Unmarshal(encoded, &info); err != nil {
+		return nil, fmt.Errorf("corrupt metadata for blob %s/%s: %w", bucket, name, err)
+	}
+	return &info, nil
+}
+
+// OpenBlob opens bucket/name for reading. The caller must close the returned file.
+func (s *BlobStore) OpenBlob(bucket, name string) (*os.File, *BlobInfo, error) {
+	dataPath, metaPath, err := s.blobPaths(bucket, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	info, err := readBlobInfo(metaPath, bucket, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Deduplicated {
+		dataPath = s.contentPath(info.SHA256)
+	}
+	file, err := os.Open(dataPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open blob %s/%s: %w", bucket, name, err)
+	}
+	return file, info, nil
+}
+
+// DeleteBlob removes bucket/name
+func (s *BlobStore) DeleteBlob(bucket, name string) error {
+	dataPath, metaPath, err := s.blobPaths(bucket, name)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	info, err := readBlobInfo(metaPath, bucket, name)
+	if err != nil {
+		return err
+	}
+	if info.Deduplicated {
+		if err := os.Remove(metaPath); err != nil {
+			return err
+		}
+		return s.releaseContent(info)
+	}
+	if err := os.Remove(dataPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete blob %s/%s: %w", bucket, name, err)
+	}
+	return os.Remove(metaPath)
+}
+
+// ListBlobs returns the metadata of every blob in bucket, sorted by name
+func (s *BlobStore) ListBlobs(bucket string) ([]*BlobInfo, error) {
+	if err := validateBlobPathElement("bucket", bucket); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	entries, err := os.ReadDir(filepath.Join(s.root, bucket))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("blob bucket %s not found", bucket)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := make([]*BlobInfo, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), blobMetaSuffix) {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), blobMetaSuffix)
+		info, err := readBlobInfo(filepath.Join(s.root, bucket, entry.Name()), bucket, name)
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, info)
+	}
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].Name < blobs[j].Name })
+	return blobs, nil
+}
+
+// CreateUpload starts a chunked upload for bucket/name
+func (s *BlobStore) CreateUpload(bucket, name, contentType string, metadata map[string]string) (*BlobUpload, error) {
+	if _, _, err := s.blobPaths(bucket, name); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate upload id: %w", err)
+	}
+	upload := &BlobUpload{
+		ID:          "upload-" + hex.EncodeToString(buf),
+		Bucket:      bucket,
+		Name:        name,
+		ContentType: contentType,
+		Metadata:    metadata,
+		Parts:       make(map[int]int64),
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err := os.MkdirAll(s.uploadDir(upload.ID), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+
+	s.mutex.Lock()
+	s.uploads[upload.ID] = upload
+	s.mutex.Unlock()
+	return upload, nil
+}
+
+func (s *BlobStore) uploadDir(uploadID string) string {
+	return filepath.Join(s.root, blobUploadsDir, uploadID)
+}
+
+func (s *BlobStore) partPath(uploadID string, part int) string {
+	return filepath.Join(s.uploadDir(uploadID), fmt.Sprintf("part-%06d", part))
+}
+
+// getUpload returns the upload with id if it belongs to bucket/name
+func (s *BlobStore) getUpload(uploadID, bucket, name string) (*BlobUpload, error) {
+	upload, exists := s.uploads[uploadID]
+	if !exists || upload.Bucket != bucket || upload.Name != name {
+		return nil, fmt.Errorf("upload %s not found for blob %s/%s", uploadID, bucket, name)
+	}
+	return upload, nil
+}
+
+// PutUploadPart stores one part of a chunked upload. Re-sending a part replaces it,
+// which lets clients resume an interrupted upload.
+func (s *BlobStore) PutUploadPart(bucket, name, uploadID string, part int, r io.Reader) (int64, error) {
+	if part < 1 {
+		return 0, fmt.Errorf("part numbers start at 1")
+	}
+
+	s.mutex.RLock()
+	_, err := s.getUpload(uploadID, bucket, name)
+	s.mutex.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := os.Create(s.partPath(uploadID, part))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create part %d: %w", part, err)
+	}
+	size, err := io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to write part %d: %w", part, err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	upload, err := s.getUpload(uploadID, bucket, name)
+	if err != nil {
+		return 0, err
+	}
+	upload.Parts[part] = size
+	return size, nil
+}
+
+// GetUpload returns the state of an in-progress upload
+func (s *BlobStore) GetUpload(bucket, name, uploadID string) (*BlobUpload, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.getUpload(uploadID, bucket, name)
+}
+
+// CompleteUpload assembles the uploaded parts, which must be numbered 1..N without
+// gaps, into the final blob
+func (s *BlobStore) CompleteUpload(bucket, name, uploadID string) (*BlobInfo, error) {
+	s.mutex.Lock()
+	upload, err := s.getUpload(uploadID, bucket, name)
+	if err == nil {
+		// Remove the session up front so concurrent parts or completions fail fast
+		delete(s.uploads, uploadID)
+	}
+	s.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(s.uploadDir(uploadID))
+
+	if len(upload.Parts) == 0 {
+		return nil, fmt.Errorf("upload %s has no parts", uploadID)
+	}
+	readers := make([]io.Reader, 0, len(upload.Parts))
+	for part := 1; part <= len(upload.Parts); part++ {
+		if _, exists := upload.Parts[part]; !exists {
+			return nil, fmt.Errorf("upload %s is missing part %d", uploadID, part)
+		}
+		file, err := os.Open(s.partPath(uploadID, part))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open part %d: %w", part, err)
+		}
+		defer file.Close()
+		readers = append(readers, file)
+	}
+
+	return s.PutBlob(bucket, name, upload.ContentType, upload.Metadata, io.MultiReader(readers...))
+}
+
+// AbortUpload discards an in-progress upload and its parts
+func (s *BlobStore) AbortUpload(bucket, name, uploadID string) error {
+	s.mutex.Lock()
+	_, err := s.getUpload(uploadID, bucket, name)
+	if err == nil {
+		delete(s.uploads, uploadID)
+	}
+	s.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(s.uploadDir(uploadID))
+}
+
+func (s *BlobStore) contentPath(sum string) string {
+	return filepath.Join(s.root, blobContentDir, sum)
+}
+
+// putDedupBlob stores the data in tmpPath as shared content and points the blob's
+// metadata at it. Callers must hold the write lock.
+func (s *BlobStore) putDedupBlob(tmpPath, dataPath, metaPath string, info *BlobInfo) error {
+	if err := s.loadContentRefs(); err != nil {
+		return err
+	}
+
+	previous, _ := readBlobInfo(metaPath, info.Bucket, info.Name)
+	content, exists := s.content[info.SHA256]
+	if !exists {
+		if err := os.MkdirAll(filepath.Join(s.root, blobContentDir), 0o755); err != nil {
+			return fmt.Errorf("failed to create blob content directory: %w", err)
+		}
+		if err := os.Rename(tmpPath, s.contentPath(info.SHA256)); err != nil {
+			return fmt.Errorf("failed to store blob %s/%s: %w", info.Bucket, info.Name, err)
+		}
+		content = &blobContent{size: info.Size}
+		s.content[info.SHA256] = content
+	}
+	content.refs++
+
+	info.Deduplicated = true
+	encoded, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(metaPath, encoded, 0o644); err != nil {
+		return fmt.Errorf("failed to store metadata for blob %s/%s: %w", info.Bucket, info.Name, err)
+	}
+
+	// Release what the blob pointed at before
+	if previous != nil {
+		if previous.Deduplicated {
+			return s.releaseContent(previous)
+		}
+		os.Remove(dataPath)
+	}
+	return nil
+}
+
+// releaseContent drops a reference to a blob's shared content and removes the data
+// once it is unreferenced. Callers must hold the write lock.
+func (s *BlobStore) releaseContent(info *BlobInfo) error {
+	if err := s.loadContentRefs(); err != nil {
+		return err
+	}
+	content, exists := s.content[info.SHA256]
+	if !exists {
+		return nil
+	}
+	content.refs--
+	if content.refs > 0 {
+		return nil
+	}
+	delete(s.content, info.SHA256)
+	if err := os.Remove(s.contentPath(info.SHA256)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete blob content %s: %w", info.SHA256, err)
+	}
+	return nil
+}
+
+// loadContentRefs counts references to shared content by scanning blob metadata.
+// Callers must hold the write lock.
+func (s *BlobStore) loadContentRefs() error {
+	if s.content != nil {
+		return nil
+	}
+
+	content := make(map[string]*blobContent)
+	buckets, err := os.ReadDir(s.root)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, bucket := range buckets {
+		if !bucket.IsDir() || validateBlobPathElement("bucket", bucket.Name()) != nil {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(s.root, bucket.Name()))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if !strings.HasSuffix(entry.Name(), blobMetaSuffix) {
+				continue
+			}
+			name := strings.TrimSuffix(entry.Name(), blobMetaSuffix)
+			info, err := readBlobInfo(filepath.Join(s.root, bucket.Name(), entry.Name()), bucket.Name(), name)
+			if err != nil || !info.Deduplicated {
+				continue
+			}
+			if c, exists := content[info.SHA256]; exists {
+				c.refs++
+			} else {
+				content[info.SHA256] = &blobContent{size: info.Size, refs: 1}
+			}
+		}
+	}
+	s.content = content
+	return nil
+}
+
+// DedupStats returns deduplication statistics for the blob store
+func (s *BlobStore) DedupStats() (DedupStats, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var stats DedupStats
+	if err := s.loadContentRefs(); err != nil {
+		return stats, err
+	}
+	for _, content := range s.content {
+		stats.UniqueValues++
+		stats.References += content.refs
+		stats.StoredBytes += content.size
+		stats.LogicalBytes += content.size * int64(content.refs)
+	}
+	stats.SavedBytes = stats.LogicalBytes - stats.StoredBytes
+	return stats, nil
+}
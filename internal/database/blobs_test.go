@@ -0,0 +1,79 @@
+package database
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestBlobNamesAreValidated(t *testing.T) {
+	store := NewBlobStore(t.TempDir())
+	for _, tt := range []struct {
+		bucket, name string
+		valid        bool
+	}{
+		{"media", "cat.png", true},
+		{"media", "notes v2", true},
+		{"media", "", false},
+		{"", "cat.png", false},
+		{"media", "../escape", false},
+		{"..", "cat.png", false},
+		{"media", "a/b", false},
+		{"media", `a\b`, false},
+		{"media", ".", false},
+		{"media", ".hidden", false},
+		{"media", "_uploads", false},
+		{"_content", "cat.png", false},
+	} {
+		_, err := store.PutBlob(tt.bucket, tt.name, "text/plain", nil, strings.NewReader("x"))
+		if valid := err == nil; valid != tt.valid {
+			t.Errorf("blob %q/%q stored: %v, want valid %v", tt.bucket, tt.name, err, tt.valid)
+		}
+		if _, _, err := store.OpenBlob(tt.bucket, tt.name); (err == nil) != tt.valid {
+			t.Errorf("blob %q/%q opened: %v", tt.bucket, tt.name, err)
+		}
+	}
+	if _, err := store.CreateUpload("media", "../escape", "", nil); err == nil {
+		t.Fatal("upload of an invalid name created")
+	}
+}
+
+func TestBlobChunkedUpload(t *testing.T) {
+	store := NewBlobStore(t.TempDir())
+	upload, err := store.CreateUpload("media", "video.bin", "application/octet-stream", map[string]string{"camera": "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Parts may arrive out of order and are joined by number
+	for _, part := range []struct {
+		number int
+		data   string
+	}{{2, "world"}, {1, "hello "}} {
+		if _, err := store.PutUploadPart("media", "video.bin", upload.ID, part.number, strings.NewReader(part.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.PutUploadPart("media", "other.bin", upload.ID, 3, strings.NewReader("x")); err == nil {
+		t.Fatal("part accepted for another blob")
+	}
+	info, err := store.CompleteUpload("media", "video.bin", upload.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len("hello world")) || info.Metadata["camera"] != "a" {
+		t.Fatalf("completed blob = %+v", info)
+	}
+
+	file, _, err := store.OpenBlob("media", "video.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil || string(data) != "hello world" {
+		t.Fatalf("blob data = %q, %v", data, err)
+	}
+	if _, err := store.CompleteUpload("media", "video.bin", upload.ID); err == nil {
+		t.Fatal("upload completed twice")
+	}
+}
@@ -0,0 +1,606 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultBucket is the bucket used by the unnamespaced /kv/{key} routes
+const DefaultBucket = "default"
+
+// ErrBucketAccessDenied is returned when a request does not carry a bucket's access token
+var ErrBucketAccessDenied = errors.New("bucket access denied")
+
+// BucketOptions configures a key-value bucket
+type BucketOptions struct {
+	DefaultTTLSeconds int    `json:"default_ttl_seconds"`    // applied to writes without an explicit TTL, 0 disables
+	AccessToken       string `json:"access_token,omitempty"` // required on every request when set
+	ReadOnly          bool   `json:"read_only"`              // rejects writes, deletes included
+	Dedup             bool   `json:"dedup"`                  // stores identical values once, reference-counted
+	Evictable         bool   `json:"evictable"`              // keys may be dropped to stay within the memory budget
+}
+
+// BucketStats summarizes the contents of a bucket
+type BucketStats struct {
+	Name              string `json:"name"`
+	Keys              int    `json:"keys"`
+	ExpiringKeys      int    `json:"expiring_keys"`
+	DefaultTTLSeconds int    `json:"default_ttl_seconds"`
+	Protected         bool   `json:"protected"`
+	ReadOnly          bool   `json:"read_only"`
+	Dedup             bool   `json:"dedup"`
+	DedupedKeys       int    `json:"deduped_keys,omitempty"` // keys whose value is shared with another key
+	Evictable         bool   `json:"evictable"`
+}
+
+// KVItem is a stored value together with its metadata
+type KVItem struct {
+	Key       string      `json:"key"`
+	Value     interface{} `json:"value"`
+	Revision  int64       `json:"revision"`
+	ExpiresAt *time.Time  `json:"expires_at,omitempty"`
+	LeaseID   string      `json:"lease_id,omitempty"`
+	// ContentType is set for raw values stored as []byte; JSON values leave it empty
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// PutOptions controls how PutBucketValue stores a value
+type PutOptions struct {
+	TTL      time.Duration // zero uses the bucket default, negative disables expiry
+	LeaseID  string        // attaches the key to a lease; it is deleted when the lease expires
+	IfAbsent bool          // fails with ErrKeyExists when a live value is already stored
+	// ContentType marks value as raw bytes of the given media type
+	ContentType string
+}
+
+// ErrKeyExists is returned by PutBucketValue with IfAbsent when the key already holds a value
+var ErrKeyExists = errors.New("key already exists")
+
+// kvEntry is a stored value plus its expiry
+type kvEntry struct {
+	value     interface{}
+	expiresAt time.Time // zero means the entry never expires
+	revision  int64
+	leaseID   string
+	// contentType is set when value holds raw bytes rather than decoded JSON
+	contentType string
+	// shared is set when value is held in the dedup content store
+	shared *sharedValue
+}
+
+func (e *kvEntry) item(key string) *KVItem {
+	item := &KVItem{Key: key, Value: e.value, Revision: e.revision, LeaseID: e.leaseID, ContentType: e.contentType}
+	if !e.expiresAt.IsZero() {
+		expiresAt := e.expiresAt
+		item.ExpiresAt = &expiresAt
+	}
+	return item
+}
+
+func (e *kvEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// kvBucket is an isolated key space within the key-value store
+type kvBucket struct {
+	entries map[string]*kvEntry
+	options BucketOptions
+}
+
+func newKVBucket() *kvBucket {
+	return &kvBucket{entries: make(map[string]*kvEntry)}
+}
+
+// lookup returns a live entry, dropping it if it has expired. Callers must hold the
+// write lock when prune is true.
+func (b *kvBucket) lookup(key string, now time.Time, prune bool) (*kvEntry, bool) {
+	entry, exists := b.entries[key]
+	if !exists {
+		return nil, false
+	}
+	if entry.expired(now) {
+		if prune {
+			b.remove(key)
+		}
+		return nil, false
+	}
+	return entry, true
+}
+
+// set stores entry under key, releasing the content of the entry it replaces
+func (b *kvBucket) set(key string, entry *kvEntry) {
+	if previous, exists := b.entries[key]; exists && previous.shared != nil {
+		previous.shared.release()
+	}
+	b.entries[key] = entry
+}
+
+// remove deletes key, releasing its content
+func (b *kvBucket) remove(key string) {
+	if entry, exists := b.entries[key]; exists && entry.shared != nil {
+		entry.shared.release()
+	}
+	delete(b.entries, key)
+}
+
+// dedupValue interns value when the bucket deduplicates. Callers must hold the KV
+// write lock.
+func (db *MultiModelDatabase) dedupValue(b *kvBucket, entry *kvEntry) error {
+	if !b.options.Dedup {
+		return nil
+	}
+	shared, err := db.kvContent.intern(entry.value, entry.contentType)
+	if err != nil {
+		return err
+	}
+	entry.shared = shared
+	entry.value = shared.value
+	return nil
+}
+
+// ValidateBucketName checks that a bucket name can be used in /kv/{bucket}/{key} routes
+func ValidateBucketName(name string) error {
+	if name == "" {
+		return fmt.Errorf("bucket name must not be empty")
+	}
+	if strings.HasPrefix(name, "_") {
+		return fmt.Errorf("bucket names starting with '_' are reserved")
+	}
+	return nil
+}
+
+// CheckBucketAccess verifies token against the bucket's access rules. Buckets that do not
+// exist yet are open so that the first write can create them.
+func (db *MultiModelDatabase) CheckBucketAccess(bucket, token string, write bool) error {
+	if strings.HasPrefix(bucket, "_") {
+		return fmt.Errorf("%w: bucket %s is reserved", ErrBucketAccessDenied, bucket)
+	}
+
+	db.kvMutex.RLock()
+	defer db.kvMutex.RUnlock()
+
+	b, exists := db.kvBuckets[bucket]
+	if !exists {
+		return nil
+	}
+	if b.options.AccessToken != "" && b.options.AccessToken != token {
+		return ErrBucketAccessDenied
+	}
+	if write && b.options.ReadOnly {
+		return fmt.Errorf("%w: bucket %s is read-only", ErrBucketAccessDenied, bucket)
+	}
+	return nil
+}
+
+// SetBucketValue stores value under key in bucket. A zero ttl falls back to the
+// bucket's default TTL; a negative ttl stores the value without expiry.
+func (db *MultiModelDatabase) SetBucketValue(bucket, key string, value interface{}, ttl time.Duration) error {
+	_, err := db.PutBucketValue(bucket, key, value, PutOptions{TTL: ttl})
+	return err
+}
+
+// PutBucketValue stores value under key in bucket and returns the new revision
+func (db *MultiModelDatabase) PutBucketValue(bucket, key string, value interface{}, opts PutOptions) (int64, error) {
+	if err := ValidateBucketName(bucket); err != nil {
+		return 0, err
+	}
+
+	op := OpInsert
+	if _, err := db.getBucketItem(bucket, key); err == nil {
+		op = OpUpdate
+	}
+
+	var revision int64
+	event := &WriteEvent{Model: ModelKeyValue, Namespace: bucket, Key: key, Value: value}
+	err := db.withWriteHooks(op, event, func() error {
+		var err error
+		revision, err = db.putBucketValue(bucket, key, event.Value, opts)
+		return err
+	})
+	return revision, err
+}
+
+// putBucketValue stores a value without validating the bucket name, so that engine
+// subsystems can keep their data in reserved "_" buckets
+func (db *MultiModelDatabase) putBucketValue(bucket, key string, value interface{}, opts PutOptions) (int64, error) {
+	if opts.ContentType != "" {
+		if _, ok := value.([]byte); !ok {
+			return 0, fmt.Errorf("values with a content type must be raw bytes")
+		}
+	}
+
+	db.kvMutex.Lock()
+	defer db.kvMutex.Unlock()
+
+	var lease *kvLease
+	if opts.LeaseID != "" {
+		var exists bool
+		lease, exists = db.kvLeases[opts.LeaseID]
+		if !exists || lease.expired(time.Now()) {
+			return 0, fmt.Errorf("lease %s not found", opts.LeaseID)
+		}
+	}
+
+	b, exists := db.kvBuckets[bucket]
+	if !exists {
+		b = newKVBucket()
+		db.kvBuckets[bucket] = b
+	}
+
+	now := time.Now()
+	previous, live := b.lookup(key, now, true)
+	if opts.IfAbsent && live {
+		return 0, fmt.Errorf("%w: %s in bucket %s", ErrKeyExists, key, bucket)
+	}
+	if live && previous.leaseID != "" && previous.leaseID != opts.LeaseID {
+		db.detachFromLease(previous.leaseID, bucket, key)
+	}
+
+	ttl := opts.TTL
+	if ttl == 0 && b.options.DefaultTTLSeconds > 0 {
+		ttl = time.Duration(b.options.DefaultTTLSeconds) * time.Second
+	}
+
+	entry := &kvEntry{value: value, leaseID: opts.LeaseID, contentType: opts.ContentType}
+	if err := db.dedupValue(b, entry); err != nil {
+		return 0, err
+	}
+	if ttl > 0 {
+		entry.expiresAt = now.Add(ttl)
+	}
+	db.kvRevision++
+	entry.revision = db.kvRevision
+	b.set(key, entry)
+	if lease != nil {
+		lease.keys[leaseKey{bucket: bucket, key: key}] = struct{}{}
+	}
+
+	db.recordLoad(bucket, key, true)
+	db.notifyKVWatchers(&KVEvent{Type: "put", Bucket: bucket, Key: key, Value: value, Revision: entry.revision})
+	return entry.revision, nil
+}
+
+// GetBucketValue returns the live value stored under key in bucket
+func (db *MultiModelDatabase) GetBucketValue(bucket, key string) (interface{}, error) {
+	item, err := db.GetBucketItem(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	return item.Value, nil
+}
+
+// GetBucketItem returns the live value stored under key in bucket with its metadata
+func (db *MultiModelDatabase) GetBucketItem(bucket, key string) (*KVItem, error) {
+	db.recordLoad(bucket, key, false)
+	return db.getBucketItem(bucket, key)
+}
+
+// getBucketItem is GetBucketItem for lookups of the engine itself, which are not
+// counted as partition load
+func (db *MultiModelDatabase) getBucketItem(bucket, key string) (*KVItem, error) {
+	db.kvMutex.RLock()
+	defer db.kvMutex.RUnlock()
+
+	b, exists := db.kvBuckets[bucket]
+	if !exists {
+		return nil, fmt.Errorf("bucket %s not found", bucket)
+	}
+
+	entry, exists := b.lookup(key, time.Now(), false)
+	if !exists {
+		return nil, fmt.Errorf("key %s not found in bucket %s", key, bucket)
+	}
+	return entry.item(key), nil
+}
+
+// MultiGetBucketValues reads several keys from bucket under a single lock acquisition.
+// Live keys are returned in values; absent or expired keys are listed in missing.
+func (db *MultiModelDatabase) MultiGetBucketValues(bucket string, keys []string) (values map[string]interface{}, missing []string, err error) {
+	items, missing, err := db.MultiGetBucketItems(bucket, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	values = make(map[string]interface{}, len(items))
+	for key, item := range items {
+		values[key] = item.Value
+	}
+	return values, missing, nil
+}
+
+// MultiGetBucketItems is MultiGetBucketValues returning each live key with its metadata,
+// so raw values can be told apart from JSON ones by their content type
+func (db *MultiModelDatabase) MultiGetBucketItems(bucket string, keys []string) (items map[string]*KVItem, missing []string, err error) {
+	db.kvMutex.RLock()
+	defer db.kvMutex.RUnlock()
+
+	items = make(map[string]*KVItem, len(keys))
+	missing = make([]string, 0)
+
+	b, exists := db.kvBuckets[bucket]
+	if !exists {
+		return nil, nil, fmt.Errorf("bucket %s not found", bucket)
+	}
+
+	now := time.Now()
+	for _, key := range keys {
+		db.recordLoad(bucket, key, false)
+		if entry, live := b.lookup(key, now, false); live {
+			items[key] = entry.item(key)
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	return items, missing, nil
+}
+
+// MultiSetBucketValues writes several pairs to bucket under a single lock acquisition,
+// applying ttl to each with the same rules as SetBucketValue
+func (db *MultiModelDatabase) MultiSetBucketValues(bucket string, pairs []KeyValue, ttl time.Duration) error {
+	_, err := db.MultiSetBucketValuesIf(bucket, pairs, nil, ttl)
+	return err
+}
+
+// MultiSetBucketValuesIf writes pairs as MultiSetBucketValues does, except that
+// revisions[i], when not nil, is the revision the key of pairs[i] must still be at,
+// 0 for a key that must not exist. Revisions are checked under the same lock the
+// pairs are written with. Pairs whose key moved on are skipped and returned as
+// conflicts while the others are written, so clients only retry the conflicts.
+func (db *MultiModelDatabase) MultiSetBucketValuesIf(bucket string, pairs []KeyValue, revisions []*int64, ttl time.Duration) ([]Conflict, error) {
+	if err := ValidateBucketName(bucket); err != nil {
+		return nil, err
+	}
+	if revisions != nil && len(revisions) != len(pairs) {
+		return nil, fmt.Errorf("%d revisions given for %d pairs", len(revisions), len(pairs))
+	}
+	for i, pair := range pairs {
+		if pair.Key == "" {
+			return nil, fmt.Errorf("pair %d has an empty key", i)
+		}
+	}
+
+	// Hooks see every pair before any is written, so a rejection leaves the bucket untouched
+	events := make([]*WriteEvent, len(pairs))
+	ops := make([]Operation, len(pairs))
+	applied := make([]KeyValue, len(pairs))
+	for i, pair := range pairs {
+		ops[i] = OpInsert
+		if _, err := db.getBucketItem(bucket, pair.Key); err == nil {
+			ops[i] = OpUpdate
+		}
+		events[i] = &WriteEvent{Model: ModelKeyValue, Namespace: bucket, Key: pair.Key, Value: pair.Value, Timestamp: db.Clock.Now()}
+		if err := db.beforeWrite(ops[i], events[i]); err != nil {
+			return nil, err
+		}
+		applied[i] = KeyValue{Key: pair.Key, Value: events[i].Value}
+	}
+
+	conflicts, err := db.multiSetBucketValues(bucket, applied, revisions, ttl)
+	if err != nil {
+		return nil, err
+	}
+	skipped := make(map[int]bool, len(conflicts))
+	for _, conflict := range conflicts {
+		skipped[conflict.Index] = true
+	}
+	for i := range events {
+		if !skipped[i] {
+			db.afterWrite(ops[i], events[i])
+		}
+	}
+	return conflicts, nil
+}
+
+func (db *MultiModelDatabase) multiSetBucketValues(bucket string, pairs []KeyValue, revisions []*int64, ttl time.Duration) ([]Conflict, error) {
+	db.kvMutex.Lock()
+	defer db.kvMutex.Unlock()
+
+	b, exists := db.kvBuckets[bucket]
+	if !exists {
+		b = newKVBucket()
+		db.kvBuckets[bucket] = b
+	}
+
+	if ttl == 0 && b.options.DefaultTTLSeconds > 0 {
+		ttl = time.Duration(b.options.DefaultTTLSeconds) * time.Second
+	}
+	now := time.Now()
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = now.Add(ttl)
+	}
+
+	var conflicts []Conflict
+	for i, pair := range pairs {
+		previous, live := b.lookup(pair.Key, now, true)
+		if revisions != nil && revisions[i] != nil {
+			var current int64
+			if live {
+				current = previous.revision
+			}
+			if current != *revisions[i] {
+				conflicts = append(conflicts, revisionConflict(i, pair.Key, revisions[i], current))
+				continue
+			}
+		}
+		if live && previous.leaseID != "" {
+			db.detachFromLease(previous.leaseID, bucket, pair.Key)
+		}
+		entry := &kvEntry{value: pair.Value, expiresAt: expiresAt}
+		if err := db.dedupValue(b, entry); err != nil {
+			return nil, err
+		}
+		db.kvRevision++
+		entry.revision = db.kvRevision
+		b.set(pair.Key, entry)
+		db.recordLoad(bucket, pair.Key, true)
+		db.notifyKVWatchers(&KVEvent{Type: "put", Bucket: bucket, Key: pair.Key, Value: pair.Value, Revision: db.kvRevision})
+	}
+	return conflicts, nil
+}
+
+// TouchBucketKey resets the expiry of a live key to ttl from now
+func (db *MultiModelDatabase) TouchBucketKey(bucket, key string, ttl time.Duration) (*KVItem, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("ttl must be positive")
+	}
+
+	db.kvMutex.Lock()
+	defer db.kvMutex.Unlock()
+
+	b, exists := db.kvBuckets[bucket]
+	if !exists {
+		return nil, fmt.Errorf("bucket %s not found", bucket)
+	}
+	entry, exists := b.lookup(key, time.Now(), true)
+	if !exists {
+		return nil, fmt.Errorf("key %s not found in bucket %s", key, bucket)
+	}
+	entry.expiresAt = time.Now().Add(ttl)
+	return entry.item(key), nil
+}
+
+// DeleteBucketKey removes key from bucket
+func (db *MultiModelDatabase) DeleteBucketKey(bucket, key string) error {
+	event := &WriteEvent{Model: ModelKeyValue, Namespace: bucket, Key: key}
+	return db.withWriteHooks(OpDelete, event, func() error {
+		return db.deleteBucketKey(bucket, key)
+	})
+}
+
+func (db *MultiModelDatabase) deleteBucketKey(bucket, key string) error {
+	db.kvMutex.Lock()
+	defer db.kvMutex.Unlock()
+
+	b, exists := db.kvBuckets[bucket]
+	if !exists {
+		return fmt.Errorf("bucket %s not found", bucket)
+	}
+
+	if _, exists := b.lookup(key, time.Now(), true); !exists {
+		return fmt.Errorf("key %s not found in bucket %s", key, bucket)
+	}
+	db.removeBucketEntry(bucket, b, key, "delete")
+	db.recordLoad(bucket, key, true)
+	return nil
+}
+
+// removeBucketEntry deletes key from b, detaches it from its lease and notifies
+// watchers. Callers must hold the KV write lock.
+func (db *MultiModelDatabase) removeBucketEntry(bucket string, b *kvBucket, key, eventType string) {
+	entry, exists := b.entries[key]
+	if !exists {
+		return
+	}
+	if entry.leaseID != "" {
+		db.detachFromLease(entry.leaseID, bucket, key)
+	}
+	b.remove(key)
+
+	db.kvRevision++
+	db.notifyKVWatchers(&KVEvent{Type: eventType, Bucket: bucket, Key: key, Revision: db.kvRevision})
+}
+
+// ListBucketKeys returns the sorted live keys of bucket that start with prefix
+func (db *MultiModelDatabase) ListBucketKeys(bucket, prefix string) ([]string, error) {
+	return db.ListBucketKeysContext(context.Background(), bucket, prefix)
+}
+
+// ListBucketKeysContext is ListBucketKeys that stops with ctx's error once ctx is done
+func (db *MultiModelDatabase) ListBucketKeysContext(ctx context.Context, bucket, prefix string) ([]string, error) {
+	db.kvMutex.Lock()
+	defer db.kvMutex.Unlock()
+
+	b, exists := db.kvBuckets[bucket]
+	if !exists {
+		return nil, fmt.Errorf("bucket %s not found", bucket)
+	}
+
+	now := time.Now()
+	keys := make([]string, 0, len(b.entries))
+	check := cancelCheck{ctx: ctx}
+	for key := range b.entries {
+		if err := check.err(); err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if _, live := b.lookup(key, now, true); live {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// ListBuckets returns the names of all buckets
+func (db *MultiModelDatabase) ListBuckets() []string {
+	db.kvMutex.RLock()
+	defer db.kvMutex.RUnlock()
+
+	names := make([]string, 0, len(db.kvBuckets))
+	for name := range db.kvBuckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetBucketStats returns key counts and configuration for bucket
+func (db *MultiModelDatabase) GetBucketStats(bucket string) (*BucketStats, error) {
+	db.kvMutex.RLock()
+	defer db.kvMutex.RUnlock()
+
+	b, exists := db.kvBuckets[bucket]
+	if !exists {
+		return nil, fmt.Errorf("bucket %s not found", bucket)
+	}
+
+	stats := &BucketStats{
+		Name:              bucket,
+		DefaultTTLSeconds: b.options.DefaultTTLSeconds,
+		Protected:         b.options.AccessToken != "",
+		ReadOnly:          b.options.ReadOnly,
+		Dedup:             b.options.Dedup,
+		Evictable:         b.options.Evictable,
+	}
+	now := time.Now()
+	for _, entry := range b.entries {
+		if entry.expired(now) {
+			continue
+		}
+		stats.Keys++
+		if !entry.expiresAt.IsZero() {
+			stats.ExpiringKeys++
+		}
+		if entry.shared != nil && entry.shared.refs > 1 {
+			stats.DedupedKeys++
+		}
+	}
+	return stats, nil
+}
+
+// SetBucketOptions configures bucket, creating it if needed
+func (db *MultiModelDatabase) SetBucketOptions(bucket string, options BucketOptions) error {
+	if err := ValidateBucketName(bucket); err != nil {
+		return err
+	}
+	if options.DefaultTTLSeconds < 0 {
+		return fmt.Errorf("default TTL must not be negative")
+	}
+
+	db.kvMutex.Lock()
+	defer db.kvMutex.Unlock()
+
+	b, exists := db.kvBuckets[bucket]
+	if !exists {
+		b = newKVBucket()
+		db.kvBuckets[bucket] = b
+	}
+	b.options = options
+	return nil
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBucketAccessTokens(t *testing.T) {
+	db := newTestDatabase(t)
+	if err := db.SetBucketOptions("secrets", BucketOptions{AccessToken: "s3cret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetBucketOptions("frozen", BucketOptions{AccessToken: "s3cret", ReadOnly: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetBucketOptions("open", BucketOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		bucket string
+		token  string
+		write  bool
+		denied bool
+	}{
+		{"secrets", "s3cret", false, false},
+		{"secrets", "s3cret", true, false},
+		{"secrets", "", false, true},
+		{"secrets", "wrong", true, true},
+		{"secrets", "S3CRET", false, true},
+		{"frozen", "s3cret", false, false},
+		{"frozen", "s3cret", true, true},
+		{"frozen", "", false, true},
+		{"open", "", true, false},
+		{"open", "anything", false, false},
+		{"new", "", true, false}, // created by its first write
+		{"_system", "", false, true},
+	}
+	for _, tt := range tests {
+		err := db.CheckBucketAccess(tt.bucket, tt.token, tt.write)
+		if denied := errors.Is(err, ErrBucketAccessDenied); denied != tt.denied || (err != nil && !denied) {
+			t.Errorf("access to %s with %q (write %v) = %v, want denied %v", tt.bucket, tt.token, tt.write, err, tt.denied)
+		}
+	}
+
+	// Stats tell a bucket is protected without revealing the token
+	stats, err := db.GetBucketStats("secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stats.Protected {
+		t.Fatalf("stats = %+v", stats)
+	}
+	// Dropping the token opens the bucket again
+	if err := db.SetBucketOptions("secrets", BucketOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CheckBucketAccess("secrets", "", true); err != nil {
+		t.Fatalf("access after dropping the token: %v", err)
+	}
+	if err := db.SetBucketOptions("_system", BucketOptions{}); err == nil {
+		t.Fatal("reserved bucket configured")
+	}
+}
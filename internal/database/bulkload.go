@@ -0,0 +1,101 @@
+package database
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BulkChunk reports the part of a bulk load stored by one owner
+type BulkChunk struct {
+	NodeID    string  `json:"node_id"`
+	Keys      int     `json:"keys"`
+	Stored    bool    `json:"stored"`
+	Local     bool    `json:"local,omitempty"` // stored by the coordinating node itself
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// BulkLoadResult summarizes a bulk load
+type BulkLoadResult struct {
+	Keys   int         `json:"keys"`
+	Stored int         `json:"stored"`
+	Chunks []BulkChunk `json:"chunks"`
+}
+
+// BulkLoad stores pairs in the default bucket. With clustering enabled the pairs are
+// split by partition owner and each chunk is sent straight to its owner in parallel;
+// owners store their chunk and replicate it. Chunks succeed or fail independently,
+// so a partial failure leaves the other chunks stored.
+func (db *MultiModelDatabase) BulkLoad(pairs []KeyValue) (*BulkLoadResult, error) {
+	for i, pair := range pairs {
+		if pair.Key == "" {
+			return nil, fmt.Errorf("pair %d has an empty key", i)
+		}
+	}
+
+	result := &BulkLoadResult{Keys: len(pairs), Chunks: make([]BulkChunk, 0)}
+	if db.Cluster == nil {
+		if err := db.MultiSetBucketValues(DefaultBucket, pairs, 0); err != nil {
+			return nil, err
+		}
+		result.Stored = len(pairs)
+		return result, nil
+	}
+
+	chunks := make(map[string][]KeyValue)
+	owners := make(map[string]*Node)
+	for _, pair := range pairs {
+		owner := db.Cluster.GetPartitionForKey(pair.Key)
+		if owner == nil {
+			return nil, fmt.Errorf("no active node owns key %s", pair.Key)
+		}
+		chunks[owner.ID] = append(chunks[owner.ID], pair)
+		owners[owner.ID] = owner
+	}
+	nodeIDs := sortedKeys(chunks)
+
+	self := db.Cluster.Self().ID
+	result.Chunks = make([]BulkChunk, len(nodeIDs))
+	var wg sync.WaitGroup
+	for i, nodeID := range nodeIDs {
+		chunk := &result.Chunks[i]
+		chunk.NodeID, chunk.Keys, chunk.Local = nodeID, len(chunks[nodeID]), nodeID == self
+		wg.Add(1)
+		go func(owner *Node, pairs []KeyValue) {
+			defer wg.Done()
+			start := time.Now()
+			var err error
+			if chunk.Local {
+				err = db.StoreOwnedChunk(pairs)
+			} else {
+				err = db.Cluster.SendChunk(owner, pairs)
+			}
+			chunk.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+			chunk.Stored = err == nil
+			if err != nil {
+				chunk.Error = err.Error()
+			}
+		}(owners[nodeID], chunks[nodeID])
+	}
+	wg.Wait()
+
+	for _, chunk := range result.Chunks {
+		if chunk.Stored {
+			result.Stored += chunk.Keys
+		}
+	}
+	return result, nil
+}
+
+// StoreOwnedChunk stores a bulk load chunk this node owns in the default bucket and
+// replicates it to the other replicas of its keys
+func (db *MultiModelDatabase) StoreOwnedChunk(pairs []KeyValue) error {
+	if err := db.MultiSetBucketValues(DefaultBucket, pairs, 0); err != nil {
+		return err
+	}
+	if db.Cluster != nil {
+		db.Cluster.ReplicateBatch(pairs)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// cloneBatchSize is the number of documents sent to the target per request
+const cloneBatchSize = 500
+
+// cloneTimeout bounds each request to the target instance
+const cloneTimeout = 30 * time.Second
+
+// CloneTarget is the engine instance a collection is cloned to
+type CloneTarget struct {
+	URL        string `json:"url"`                  // base URL of its API, e.g. https://staging.example.com/v1
+	Token      string `json:"token,omitempty"`      // its API_TOKEN, sent as a bearer token
+	Collection string `json:"collection,omitempty"` // name on the target, the source name when empty
+}
+
+// CloneResult reports a collection cloned to another instance
+type CloneResult struct {
+	Collection     string   `json:"collection"`
+	Target         string   `json:"target"`
+	Documents      int      `json:"documents"` // inserted on the target
+	Skipped        int      `json:"skipped"`   // ids the target already held, left unchanged
+	Indexes        int      `json:"indexes"`
+	ComputedFields int      `json:"computed_fields"`
+	Errors         []string `json:"errors,omitempty"` // documents the target rejected
+}
+
+// CloneCollection copies collection to another engine instance through its HTTP API:
+// computed field definitions first, then indexes, then the documents in id order,
+// in batches, so a collection of any size is streamed rather than sent at once.
+// Documents whose id the target already holds are skipped and left unchanged, so
+// cloning again after a failure resumes where it stopped. Documents changed on the
+// source while the clone runs are sent as read when their batch is sent.
+func (db *MultiModelDatabase) CloneCollection(ctx context.Context, collection string, target CloneTarget) (*CloneResult, error) {
+	if err := ValidateCollectionName(collection); err != nil {
+		return nil, err
+	}
+	if IsSystemCollection(collection) {
+		return nil, fmt.Errorf("system collection %s cannot be cloned", collection)
+	}
+	if target.Collection == "" {
+		target.Collection = collection
+	}
+	if err := ValidateCollectionName(target.Collection); err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(target.URL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("target url must be an http or https URL")
+	}
+	if err := db.warmCollection(collection); err != nil {
+		return nil, err
+	}
+	ids := db.collectionIDs(collection)
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("collection %s not found", collection)
+	}
+
+	client := &cloneClient{
+		base:   strings.TrimSuffix(target.URL, "/") + "/docs/" + url.PathEscape(target.Collection),
+		token:  target.Token,
+		client: &http.Client{Timeout: cloneTimeout},
+	}
+	result := &CloneResult{Collection: collection, Target: target.URL}
+
+	for _, field := range db.ComputedFields(collection) {
+		if err := client.post(ctx, "/_computed", field, nil); err != nil {
+			return result, fmt.Errorf("failed to define computed field %s: %w", field.Name, err)
+		}
+		result.ComputedFields++
+	}
+	for _, spec := range db.ListIndexes(collection) {
+		if err := client.post(ctx, "/_indexes", spec, nil); err != nil {
+			return result, fmt.Errorf("failed to create index on %s: %w", spec.Field, err)
+		}
+		result.Indexes++
+	}
+
+	for start := 0; start < len(ids); start += cloneBatchSize {
+		end := start + cloneBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		docs, err := db.storedDocuments(collection, ids[start:end])
+		if err != nil {
+			return result, err
+		}
+		if len(docs) == 0 {
+			continue
+		}
+		var inserted InsertManyResult
+		request := map[string]interface{}{"documents": docs}
+		if err := client.post(ctx, "/_insertMany", request, &inserted); err != nil {
+			return result, fmt.Errorf("failed to send documents %s to %s: %w", ids[start], ids[end-1], err)
+		}
+		result.Documents += inserted.Inserted
+		result.Skipped += len(inserted.Conflicts)
+		taken := make(map[int]bool, len(inserted.Conflicts))
+		for _, conflict := range inserted.Conflicts {
+			taken[conflict.Index] = true
+		}
+		for _, failure := range inserted.Errors {
+			if !taken[failure.Index] {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %s", failure.ID, failure.Error))
+			}
+		}
+	}
+	return result, nil
+}
+
+// collectionIDs returns the ids of the documents of collection in id order
+func (db *MultiModelDatabase) collectionIDs(collection string) []string {
+	db.docMutex.RLock()
+	defer db.docMutex.RUnlock()
+
+	prefix := collection + "."
+	var ids []string
+	for key := range db.documents {
+		if strings.HasPrefix(key, prefix) {
+			ids = append(ids, key[len(prefix):])
+		}
+	}
+	if a := db.archived(collection); a != nil {
+		for i := 0; i < a.len(); i++ {
+			id, _ := a.entry(i)
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// storedDocuments returns the documents of collection with ids as stored, without
+// virtual computed fields and with their id under IDField. Documents deleted since
+// their ids were listed are left out.
+func (db *MultiModelDatabase) storedDocuments(collection string, ids []string) ([]Document, error) {
+	db.docMutex.RLock()
+	defer db.docMutex.RUnlock()
+
+	a := db.archived(collection)
+	docs := make([]Document, 0, len(ids))
+	for _, id := range ids {
+		doc, exists := db.documents[collection+"."+id]
+		if a != nil {
+			var err error
+			if doc, exists, err = a.get(id); err != nil {
+				return nil, err
+			}
+		}
+		if !exists {
+			continue
+		}
+		expanded := db.expandDocument(doc)
+		withID := make(Document, len(expanded)+1)
+		for field, value := range expanded {
+			withID[field] = value
+		}
+		withID[IDField] = id
+		docs = append(docs, withID)
+	}
+	return docs, nil
+}
+
+// cloneClient sends requests to the document API of a collection on another instance
+type cloneClient struct {
+	base   string
+	token  string
+	client *http.Client
+}
+
+// post sends body to the path below the collection and decodes the data of the
+// response into out, when given. Responses other than 200 and 201 are errors.
+func (c *cloneClient) post(ctx context.Context, path string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.base+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var response struct {
+		Data  json.RawMessage `json:"data"`
+		Error string          `json:"error"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return fmt.Errorf("target answered %s with an invalid body", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		if response.Error == "" {
+			response.Error = resp.Status
+		}
+		return fmt.Errorf("target answered %d: %s", resp.StatusCode, response.Error)
+	}
+	if out != nil && len(response.Data) > 0 {
+		return json.Unmarshal(response.Data, out)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// cloneTargetServer serves the document endpoints a clone uses from target, requiring
+// token as a bearer token
+func cloneTargetServer(t *testing.T, target *MultiModelDatabase, token string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "unauthorized"})
+			return
+		}
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/docs/"), "/")
+		collection, action := parts[0], parts[1]
+		var data interface{}
+		var err error
+		switch action {
+		case "_computed":
+			var field ComputedField
+			json.NewDecoder(r.Body).Decode(&field)
+			field.Collection = collection
+			err = target.DefineComputedField(field)
+		case "_indexes":
+			var spec IndexSpec
+			json.NewDecoder(r.Body).Decode(&spec)
+			spec.Collection = collection
+			err = target.CreateIndex(spec)
+		case "_insertMany":
+			var request struct {
+				Documents []Document `json:"documents"`
+			}
+			json.NewDecoder(r.Body).Decode(&request)
+			data, err = target.InsertMany(collection, request.Documents, false)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": data})
+	}))
+}
+
+func TestCloneCollection(t *testing.T) {
+	source, target := newTestDatabase(t), newTestDatabase(t)
+	server := cloneTargetServer(t, target, "secret")
+	defer server.Close()
+
+	for i, id := range []string{"a", "b", "c"} {
+		if err := source.InsertDocument("orders", id, Document{"qty": i + 1, "price": 10}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := source.DefineComputedField(ComputedField{Collection: "orders", Name: "total", Expression: "price * qty", Stored: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.CreateIndex(IndexSpec{Collection: "orders", Field: "total"}); err != nil {
+		t.Fatal(err)
+	}
+	// A document the target already holds is left unchanged
+	if err := target.InsertDocument("staging_orders", "a", Document{"qty": 99}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := source.CloneCollection(context.Background(), "orders", CloneTarget{URL: server.URL + "/v1", Token: "wrong"}); err == nil {
+		t.Fatal("expected a clone with the wrong token to fail")
+	}
+
+	result, err := source.CloneCollection(context.Background(), "orders", CloneTarget{URL: server.URL + "/v1", Token: "secret", Collection: "staging_orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Documents != 2 || result.Skipped != 1 || result.Indexes != 1 || result.ComputedFields != 1 || len(result.Errors) != 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	doc, err := target.GetDocument("staging_orders", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc["total"] != 30.0 {
+		t.Fatalf("expected the stored computed field on the target, got %v", doc)
+	}
+	if doc, _ := target.GetDocument("staging_orders", "a"); doc["qty"] != 99 {
+		t.Fatalf("expected the existing document to be kept, got %v", doc)
+	}
+	if indexes := target.ListIndexes("staging_orders"); len(indexes) != 1 || indexes[0].Field != "total" {
+		t.Fatalf("expected the index on the target, got %v", indexes)
+	}
+}
+
+func TestCloneCollectionRejectsInvalidTargets(t *testing.T) {
+	db := newTestDatabase(t)
+	if err := db.InsertDocument("orders", "a", Document{"qty": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CloneCollection(context.Background(), "orders", CloneTarget{URL: "ftp://example.com"}); err == nil {
+		t.Fatal("expected a non-HTTP target to be rejected")
+	}
+	if _, err := db.CloneCollection(context.Background(), "missing", CloneTarget{URL: "http://example.com"}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected a missing collection to be reported, got %v", err)
+	}
+}
@@ -5,22 +5,42 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"errors"
+	"io"
 	"log"
 	"math/rand"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"multimodel-db-engine/internal/config"
 )
 
+// ErrStaleEpoch is returned for replication and forwarded writes sent under an older
+// partition map than the receiver's
+var ErrStaleEpoch = errors.New("stale cluster epoch")
+
+// EpochHeader carries the sender's partition map epoch on node to node requests and
+// their responses
+const EpochHeader = "X-Cluster-Epoch"
+
+// ErrNoFreshReplica is returned when no replica of a key is within a read's
+// staleness bound
+var ErrNoFreshReplica = errors.New("no replica within the staleness bound")
+
 // Node represents a node in the distributed cluster
 type Node struct {
 	ID       string `json:"id"`
 	Address  string `json:"address"`
 	Port     string `json:"port"`
 	Status   string `json:"status"` // active, inactive, joining, leaving
-	LastSeen int64  `json:"last_seen"`
+	LastSeen Timestamp `json:"last_seen"` // clock reading of the last successful heartbeat
+	Zone     string `json:"zone,omitempty"` // failure domain labels used for replica placement
+	Rack     string `json:"rack,omitempty"`
 }
 
 // Cluster represents the distributed cluster component
@@ -28,36 +48,104 @@ type Cluster struct {
 	selfNode    *Node
 	nodes       map[string]*Node
 	nodesMutex  sync.RWMutex
+	
+	// Partition map epoch, raised on every membership change this node observes
+	// and to the highest epoch seen from peers. Guarded by nodesMutex.
+	epoch uint64
+	
+	// Hybrid logical clock stamped on outgoing messages and advanced by incoming ones
+	clock *HLC
+	
+	// Clock reading of the latest replicated write applied or coordinated per key;
+	// older replicated writes are dropped so replicas settle on the same value
+	stamps     map[string]Timestamp
+	stampMutex sync.Mutex
+	
+	// Hash ranges of the key space, each owned by one node, and the version of
+	// the map raised by every split
+	partitions       []Partition
+	partitionVersion uint64
+	partitionMutex   sync.RWMutex
+	
+	// Topology changes streamed to operators
+	events *eventHub
+	
 	config      *config.Config
+	placement   map[string]PlacementRule // by collection, fixed at startup
 	httpClient  *http.Client
+	faults      *FaultInjector
+	
+	// Heartbeat round trip time per node, used to pick the closest replica
+	latencies map[string]time.Duration
+	
+	// Replications this node coordinated that a replica missed: key -> node ID ->
+	// time of the first missed write. A later successful replication of the key
+	// to the node clears the entry.
+	missed       map[string]map[string]time.Time
+	replicaMutex sync.Mutex
+	
+	// Nonces of signed messages accepted within the signature window
+	nonces *nonceCache
+	
 	ctx         context.Context
 	cancelFunc  context.CancelFunc
+	routines    *supervisor
 }
 
 // NewCluster creates a new cluster instance
 func NewCluster(cfg *config.Config) *Cluster {
+	return newCluster(cfg, nil, NewHLC())
+}
+
+// newCluster creates a cluster sharing the database's clock whose network
+// operations are subject to faults
+func newCluster(cfg *config.Config, faults *FaultInjector, clock *HLC) *Cluster {
 	ctx, cancel := context.WithCancel(context.Background())
 	
+	nodeID := cfg.NodeID
+	if nodeID == "" {
+		nodeID = generateNodeID()
+	}
+	
 	cluster := &Cluster{
 		selfNode: &Node{
-			ID:      generateNodeID(),
+			ID:      nodeID,
 			Address: "localhost", // In production, get actual IP
 			Port:    cfg.ClusterPort,
 			Status:  "active",
+			Zone:    cfg.NodeZone,
+			Rack:    cfg.NodeRack,
 		},
 		nodes:      make(map[string]*Node),
 		config:     cfg,
 		httpClient: &http.Client{Timeout: 10 * time.Second},
+		faults:     faults,
+		clock:      clock,
+		stamps:     make(map[string]Timestamp),
+		partitions: newPartitions(cfg.PartitionCount),
+		events:     newEventHub(),
+		latencies:  make(map[string]time.Duration),
+		missed:     make(map[string]map[string]time.Time),
+		nonces:     newNonceCache(),
 		ctx:        ctx,
 		cancelFunc: cancel,
+		routines:   newSupervisor(ctx),
 	}
 	
 	// Add self to the cluster
 	cluster.nodes[cluster.selfNode.ID] = cluster.selfNode
 	
+	placement, err := ParsePlacementRules(cfg.PlacementRules)
+	if err != nil {
+		log.Printf("Ignoring placement rules: %v", err)
+		placement = nil
+	}
+	cluster.placement = placement
+	cluster.loadPartitionMap()
+	
 	// Start cluster maintenance routines
-	go cluster.startHeartbeat()
-	go cluster.startGossipProtocol()
+	cluster.routines.run("heartbeat", cluster.startHeartbeat)
+	cluster.routines.run("gossip", cluster.startGossipProtocol)
 	
 	return cluster
 }
@@ -72,8 +160,8 @@ func generateNodeID() string {
 func (c *Cluster) Join(seedAddress string) error {
 	url := fmt.Sprintf("http://%s/cluster/join", seedAddress)
 	
-	reqBody, _ := json.Marshal(c.selfNode)
-	resp, err := c.httpClient.Post(url, "application/json", bytes.NewBuffer(reqBody))
+	reqBody, _ := json.Marshal(c.Self())
+	resp, err := c.send(http.MethodPost, url, reqBody)
 	if err != nil {
 		return fmt.Errorf("failed to join cluster: %w", err)
 	}
@@ -83,18 +171,86 @@ func (c *Cluster) Join(seedAddress string) error {
 		return fmt.Errorf("join request failed with status: %d", resp.StatusCode)
 	}
 	
+	// The seed answers with its membership so the new node learns the cluster
+	c.mergeMembershipResponse(resp)
 	return nil
 }
 
+// Self returns the local node
+func (c *Cluster) Self() *Node {
+	c.nodesMutex.RLock()
+	defer c.nodesMutex.RUnlock()
+	
+	self := *c.selfNode
+	return &self
+}
+
+// MergeMembership adds nodes learned from join or gossip messages that are not
+// known yet. The status of known nodes is left to the local heartbeat.
+func (c *Cluster) MergeMembership(nodes []*Node) {
+	for _, node := range nodes {
+		if node == nil || node.ID == "" {
+			continue
+		}
+		if _, known := c.GetNode(node.ID); known {
+			continue
+		}
+		
+		added := *node
+		added.Status = "active"
+		c.AddNode(&added)
+	}
+}
+
+// mergeMembershipResponse merges the node list carried by a join or gossip response.
+// The epoch is only adopted here, together with the membership it describes, so a
+// node cannot pass fencing without having refreshed its partition map.
+func (c *Cluster) mergeMembershipResponse(resp *http.Response) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	if err := c.verifyResponse(resp, body); err != nil {
+		log.Printf("Ignoring membership response: %v", err)
+		return
+	}
+	
+	var membership struct {
+		Data []*Node `json:"data"`
+	}
+	if err := json.Unmarshal(body, &membership); err == nil {
+		c.MergeMembership(membership.Data)
+		if epoch, err := strconv.ParseUint(resp.Header.Get(EpochHeader), 10, 64); err == nil {
+			c.ObserveEpoch(epoch)
+		}
+	}
+}
+
+// SetTransport replaces the transport used for inter-node requests, e.g. with an
+// in-memory network when simulating a cluster in one process
+func (c *Cluster) SetTransport(transport http.RoundTripper) {
+	c.httpClient.Transport = transport
+}
+
+// Tick runs a heartbeat and a gossip round immediately instead of waiting for the
+// periodic ones
+func (c *Cluster) Tick() {
+	c.performHeartbeat()
+	c.runGossipRound()
+}
+
 // AddNode adds a new node to the cluster
 func (c *Cluster) AddNode(node *Node) {
 	c.nodesMutex.Lock()
 	defer c.nodesMutex.Unlock()
 	
-	node.LastSeen = time.Now().Unix()
+	before := c.activeNodes()
+	node.LastSeen = c.clock.Now()
 	c.nodes[node.ID] = node
+	c.epoch++
 	
 	log.Printf("Added node %s to cluster", node.ID)
+	c.membershipChanged(EventNodeJoined, node.ID, before)
 }
 
 // RemoveNode removes a node from the cluster
@@ -103,23 +259,50 @@ func (c *Cluster) RemoveNode(nodeID string) {
 	defer c.nodesMutex.Unlock()
 	
 	if node, exists := c.nodes[nodeID]; exists {
+		before := c.activeNodes()
+		if node.Status == "active" {
+			c.epoch++
+		}
 		node.Status = "inactive"
 		log.Printf("Removed node %s from cluster", nodeID)
+		c.membershipChanged(EventNodeLeft, nodeID, before)
 	}
 }
 
-// GetActiveNodes returns all active nodes in the cluster
+// GetActiveNodes returns copies of all active nodes in the cluster ordered by ID,
+// so every node derives the same partition placement from the same membership
 func (c *Cluster) GetActiveNodes() []*Node {
 	c.nodesMutex.RLock()
 	defer c.nodesMutex.RUnlock()
 	
+	return c.activeNodes()
+}
+
+// Nodes returns every known node, whatever its status, ordered by ID
+func (c *Cluster) Nodes() []*Node {
+	c.nodesMutex.RLock()
+	defer c.nodesMutex.RUnlock()
+	
+	nodes := make([]*Node, 0, len(c.nodes))
+	for _, node := range c.nodes {
+		copied := *node
+		nodes = append(nodes, &copied)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// activeNodes is GetActiveNodes for callers holding nodesMutex
+func (c *Cluster) activeNodes() []*Node {
 	var activeNodes []*Node
 	for _, node := range c.nodes {
 		if node.Status == "active" {
-			activeNodes = append(activeNodes, node)
+			active := *node
+			activeNodes = append(activeNodes, &active)
 		}
 	}
 	
+	sort.Slice(activeNodes, func(i, j int) bool { return activeNodes[i].ID < activeNodes[j].ID })
 	return activeNodes
 }
 
@@ -129,7 +312,11 @@ func (c *Cluster) GetNode(nodeID string) (*Node, bool) {
 	defer c.nodesMutex.RUnlock()
 	
 	node, exists := c.nodes[nodeID]
-	return node, exists
+	if !exists {
+		return nil, false
+	}
+	copied := *node
+	return &copied, true
 }
 
 // startHeartbeat starts the heartbeat mechanism to detect node failures
@@ -152,7 +339,8 @@ func (c *Cluster) performHeartbeat() {
 	c.nodesMutex.RLock()
 	nodes := make([]*Node, 0, len(c.nodes))
 	for _, node := range c.nodes {
-		nodes = append(nodes, node)
+		copied := *node
+		nodes = append(nodes, &copied)
 	}
 	c.nodesMutex.RUnlock()
 	
@@ -161,13 +349,22 @@ func (c *Cluster) performHeartbeat() {
 			continue // Skip self
 		}
 		
+		start := time.Now()
 		alive := c.pingNode(node)
-		c.updateNodeStatus(node.ID, alive)
+		c.updateNodeStatus(node.ID, alive, time.Since(start))
 	}
 }
 
 // pingNode checks if a node is alive
 func (c *Cluster) pingNode(node *Node) bool {
+	if delay, fired := c.faults.trigger(FaultHeartbeatDelay); fired {
+		select {
+		case <-time.After(delay):
+		case <-c.ctx.Done():
+			return false
+		}
+	}
+	
 	url := fmt.Sprintf("http://%s:%s/health", node.Address, node.Port)
 	
 	resp, err := c.httpClient.Get(url)
@@ -179,18 +376,31 @@ func (c *Cluster) pingNode(node *Node) bool {
 	return resp.StatusCode == http.StatusOK
 }
 
-// updateNodeStatus updates the status of a node based on heartbeat results
-func (c *Cluster) updateNodeStatus(nodeID string, alive bool) {
+// updateNodeStatus updates the status and round trip time of a node based on
+// heartbeat results
+func (c *Cluster) updateNodeStatus(nodeID string, alive bool, rtt time.Duration) {
 	c.nodesMutex.Lock()
 	defer c.nodesMutex.Unlock()
 	
 	if node, exists := c.nodes[nodeID]; exists {
+		before := c.activeNodes()
+		changed := alive != (node.Status == "active")
+		if changed {
+			c.epoch++
+		}
 		if alive {
 			node.Status = "active"
-			node.LastSeen = time.Now().Unix()
+			node.LastSeen = c.clock.Now()
+			c.latencies[nodeID] = rtt
 		} else {
 			node.Status = "inactive"
 		}
+		switch {
+		case changed && alive:
+			c.membershipChanged(EventNodeUp, nodeID, before)
+		case changed:
+			c.membershipChanged(EventNodeDown, nodeID, before)
+		}
 	}
 }
 
@@ -242,7 +452,7 @@ func (c *Cluster) exchangeGossip(node *Node) {
 	localNodes := c.GetActiveNodes()
 	reqBody, _ := json.Marshal(localNodes)
 	
-	resp, err := c.httpClient.Post(url, "application/json", bytes.NewBuffer(reqBody))
+	resp, err := c.send(http.MethodPost, url, reqBody)
 	if err != nil {
 		log.Printf("Failed to gossip with node %s: %v", node.ID, err)
 		return
@@ -255,100 +465,425 @@ func (c *Cluster) exchangeGossip(node *Node) {
 	}
 	
 	// Process response with other node's membership info
-	// This would normally merge the membership lists
+	c.mergeMembershipResponse(resp)
 }
 
-// GetPartitionForKey determines which node should handle a given key
+// GetPartitionForKey determines which node should handle a given key: the owner of
+// the partition holding it
 func (c *Cluster) GetPartitionForKey(key string) *Node {
-	activeNodes := c.GetActiveNodes()
-	if len(activeNodes) == 0 {
-		return nil
+	return partitionOwner(c.PartitionForKey(key), c.GetActiveNodes())
+}
+
+// ReplicaAck reports how one replica handled a replicated write
+type ReplicaAck struct {
+	NodeID       string        `json:"node_id"`
+	Acknowledged bool          `json:"acknowledged"`
+	Local        bool          `json:"local,omitempty"` // the coordinating node itself
+	Latency      time.Duration `json:"-"`
+	LatencyMs    float64       `json:"latency_ms"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// ReplicationResult lists the replicas of a write and which of them acknowledged it
+type ReplicationResult struct {
+	Key          string       `json:"key"`
+	Required     int          `json:"required"` // the replication factor
+	Acknowledged int          `json:"acknowledged"`
+	Replicas     []ReplicaAck `json:"replicas"`
+}
+
+// ReplicateData replicates data to other nodes based on replication factor. Replicas
+// are written in parallel; the result reports each replica's acknowledgment and
+// round trip time. Without replication the result is nil.
+func (c *Cluster) ReplicateData(key string, value interface{}) (*ReplicationResult, error) {
+	replicationFactor := c.PlacementFor(keyCollection(key)).Replicas
+	if replicationFactor <= 1 {
+		return nil, nil // No replication needed
 	}
 	
-	// Simple hash-based partitioning
-	hash := 0
-	for _, r := range key {
-		hash = (hash << 5) - hash + int(r)
+	activeNodes := c.GetActiveNodes()
+	if len(activeNodes) < replicationFactor {
+		return nil, fmt.Errorf("not enough active nodes for replication factor %d", replicationFactor)
 	}
 	
-	index := hash % len(activeNodes)
-	if index < 0 {
-		index = -index
+	// Replicate to the nodes responsible for this key
+	stamp := c.stampWrites([]KeyValue{{Key: key}})
+	nodes := c.ReplicaNodes(key)
+	result := &ReplicationResult{Key: key, Required: replicationFactor, Replicas: make([]ReplicaAck, len(nodes))}
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		ack := &result.Replicas[i]
+		ack.NodeID = node.ID
+		if node.ID == c.selfNode.ID {
+			ack.Acknowledged, ack.Local = true, true // Skip self, we already have the data
+			continue
+		}
+		
+		wg.Add(1)
+		go func(node *Node) {
+			defer wg.Done()
+			start := time.Now()
+			err := c.replicateToNode(node, key, value, stamp)
+			ack.Latency = time.Since(start)
+			ack.Acknowledged = err == nil
+			c.recordReplication(key, node.ID, err == nil)
+			if err != nil {
+				ack.Error = err.Error()
+				log.Printf("Failed to replicate key %s to node %s: %v", key, node.ID, err)
+			}
+		}(node)
 	}
+	wg.Wait()
 	
-	return activeNodes[index]
+	for i := range result.Replicas {
+		ack := &result.Replicas[i]
+		ack.LatencyMs = float64(ack.Latency.Microseconds()) / 1000
+		if ack.Acknowledged {
+			result.Acknowledged++
+		}
+	}
+	return result, nil
 }
 
-// ReplicateData replicates data to other nodes based on replication factor
-func (c *Cluster) ReplicateData(key string, value interface{}) error {
-	replicationFactor := c.config.ReplicationFactor
-	if replicationFactor <= 1 {
-		return nil // No replication needed
+// stampWrites takes a clock reading for writes of pairs this node coordinates and
+// records it as the latest write of their keys
+func (c *Cluster) stampWrites(pairs []KeyValue) Timestamp {
+	c.stampMutex.Lock()
+	defer c.stampMutex.Unlock()
+	
+	stamp := c.clock.Now()
+	for _, pair := range pairs {
+		c.stamps[pair.Key] = stamp
 	}
-	
+	return stamp
+}
+
+// ApplyReplicated stores replicated pairs written at stamp with store, skipping keys
+// that already hold a later write, and returns how many pairs were stored. Replicas
+// therefore settle on the latest write whatever order replication messages arrive
+// in. Unstamped pairs are always stored.
+func (c *Cluster) ApplyReplicated(pairs []KeyValue, stamp Timestamp, store func([]KeyValue) error) (int, error) {
+	c.stampMutex.Lock()
+	defer c.stampMutex.Unlock()
+	
+	if !stamp.IsZero() {
+		if err := c.clock.Update(stamp); err != nil {
+			log.Printf("Not adopting replication clock: %v", err)
+		}
+	}
+	newer := make([]KeyValue, 0, len(pairs))
+	for _, pair := range pairs {
+		if latest, exists := c.stamps[pair.Key]; stamp.IsZero() || !exists || latest.Less(stamp) {
+			newer = append(newer, pair)
+		}
+	}
+	if len(newer) == 0 {
+		return 0, nil
+	}
+	if err := store(newer); err != nil {
+		return 0, err
+	}
+	if !stamp.IsZero() {
+		for _, pair := range newer {
+			c.stamps[pair.Key] = stamp
+		}
+	}
+	return len(newer), nil
+}
+
+// Clock returns the cluster's hybrid logical clock
+func (c *Cluster) Clock() *HLC {
+	return c.clock
+}
+
+// ObserveClock advances the clock past the encoded timestamp a peer sent, ignoring
+// missing or malformed values
+func (c *Cluster) ObserveClock(encoded string) {
+	if encoded == "" {
+		return
+	}
+	stamp, err := ParseTimestamp(encoded)
+	if err != nil {
+		return
+	}
+	if err := c.clock.Update(stamp); err != nil {
+		log.Printf("Not adopting peer clock: %v", err)
+	}
+}
+
+// ReplicaNodes returns the nodes holding key: its partition owner followed by further
+// nodes in the ring, spread over zones or racks and up to the replica count of the
+// placement rule for key's collection
+func (c *Cluster) ReplicaNodes(key string) []*Node {
 	activeNodes := c.GetActiveNodes()
-	if len(activeNodes) < replicationFactor {
-		return fmt.Errorf("not enough active nodes for replication factor %d", replicationFactor)
+	primary := c.GetPartitionForKey(key)
+	if primary == nil {
+		return nil
 	}
 	
-	// Find nodes responsible for this key
-	nodes := make([]*Node, 0, replicationFactor)
-	nodes = append(nodes, c.GetPartitionForKey(key)) // Primary
+	rule := c.PlacementFor(keyCollection(key))
+	
+	primaryIdx := 0
+	for j, node := range activeNodes {
+		if node.ID == primary.ID {
+			primaryIdx = j
+			break
+		}
+	}
 	
-	// Add additional replicas
-	for i := 1; i < replicationFactor && i < len(activeNodes); i++ {
-		// Add next node in ring
-		primaryIdx := 0
-		for j, node := range activeNodes {
-			if node.ID == nodes[0].ID {
-				primaryIdx = j
-				break
+	return placeReplicas(activeNodes, primaryIdx, rule.Replicas, rule.Spread)
+}
+
+// recordReplication tracks whether node received the latest write of key
+func (c *Cluster) recordReplication(key, nodeID string, acknowledged bool) {
+	c.replicaMutex.Lock()
+	defer c.replicaMutex.Unlock()
+	
+	if acknowledged {
+		if nodes, exists := c.missed[key]; exists {
+			delete(nodes, nodeID)
+			if len(nodes) == 0 {
+				delete(c.missed, key)
 			}
 		}
-		
-		replicaIdx := (primaryIdx + i) % len(activeNodes)
-		nodes = append(nodes, activeNodes[replicaIdx])
+		return
+	}
+	if c.missed[key] == nil {
+		c.missed[key] = make(map[string]time.Time)
+	}
+	if _, exists := c.missed[key][nodeID]; !exists {
+		c.missed[key][nodeID] = time.Now()
+	}
+}
+
+// Staleness returns how far behind node's copy of key is, as far as this node
+// knows: the time since the first write of key it coordinated that node missed,
+// or zero when node received them all
+func (c *Cluster) Staleness(nodeID, key string) time.Duration {
+	if nodeID == c.selfNode.ID {
+		return 0
 	}
 	
-	// Replicate to selected nodes
-	for _, node := range nodes {
-		if node.ID == c.selfNode.ID {
-			continue // Skip self, we already have the data
+	c.replicaMutex.Lock()
+	defer c.replicaMutex.Unlock()
+	
+	if missedAt, exists := c.missed[key][nodeID]; exists {
+		return time.Since(missedAt)
+	}
+	return 0
+}
+
+// Latency returns the last heartbeat round trip time to node; zero for the local
+// node
+func (c *Cluster) Latency(nodeID string) time.Duration {
+	if nodeID == c.selfNode.ID {
+		return 0
+	}
+	
+	c.nodesMutex.RLock()
+	defer c.nodesMutex.RUnlock()
+	
+	if latency, measured := c.latencies[nodeID]; measured {
+		return latency
+	}
+	return c.httpClient.Timeout // not measured yet, prefer any measured node
+}
+
+// SelectReplica picks the replica of key to read from: the closest one whose copy
+// is at most maxStaleness behind. The local node, when it holds key, is always the
+// closest.
+func (c *Cluster) SelectReplica(key string, maxStaleness time.Duration) (*Node, error) {
+	var selected *Node
+	var selectedLatency time.Duration
+	for _, node := range c.ReplicaNodes(key) {
+		if c.Staleness(node.ID, key) > maxStaleness {
+			continue
 		}
-		
-		err := c.replicateToNode(node, key, value)
-		if err != nil {
-			log.Printf("Failed to replicate key %s to node %s: %v", key, node.ID, err)
+		latency := c.Latency(node.ID)
+		if selected == nil || latency < selectedLatency {
+			selected, selectedLatency = node, latency
 		}
 	}
-	
-	return nil
+	if selected == nil {
+		return nil, fmt.Errorf("%w of %s: %s", ErrNoFreshReplica, key, maxStaleness)
+	}
+	return selected, nil
+}
+
+// ReadFromReplica fetches key from node's default bucket. The caller must close
+// the response body.
+func (c *Cluster) ReadFromReplica(node *Node, key string) (*http.Response, error) {
+	target := fmt.Sprintf("http://%s:%s/data/kv/%s", node.Address, node.Port, url.PathEscape(key))
+	resp, err := c.send(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from node %s: %w", node.ID, err)
+	}
+	return resp, nil
 }
 
 // replicateToNode sends data to a specific node for replication
-func (c *Cluster) replicateToNode(node *Node, key string, value interface{}) error {
-	url := fmt.Sprintf("http://%s:%s/data/replicate", node.Address, node.Port)
+func (c *Cluster) replicateToNode(node *Node, key string, value interface{}, stamp Timestamp) error {
+	if _, fired := c.faults.trigger(FaultReplicationDrop); fired {
+		return fmt.Errorf("failed to replicate to node %s: %w", node.ID, ErrInjectedFault)
+	}
 	
 	data := map[string]interface{}{
 		"key":   key,
 		"value": value,
+		"stamp": stamp,
+	}
+	if err := c.post(node, "/data/replicate", data); err != nil {
+		return fmt.Errorf("failed to replicate to node %s: %w", node.ID, err)
+	}
+	return nil
+}
+
+// ReplicateBatch replicates pairs owned by this node to their other replicas, with
+// one request per replica
+func (c *Cluster) ReplicateBatch(pairs []KeyValue) {
+	stamp := c.stampWrites(pairs)
+	batches := make(map[string][]KeyValue)
+	targets := make(map[string]*Node)
+	for _, pair := range pairs {
+		for _, node := range c.ReplicaNodes(pair.Key) {
+			if node.ID == c.selfNode.ID {
+				continue
+			}
+			batches[node.ID] = append(batches[node.ID], pair)
+			targets[node.ID] = node
+		}
 	}
 	
-	reqBody, _ := json.Marshal(data)
-	resp, err := c.httpClient.Post(url, "application/json", bytes.NewBuffer(reqBody))
-	if err != nil {
+	var wg sync.WaitGroup
+	for nodeID, batch := range batches {
+		wg.Add(1)
+		go func(node *Node, batch []KeyValue) {
+			defer wg.Done()
+			err := c.replicateBatchToNode(node, batch, stamp)
+			for _, pair := range batch {
+				c.recordReplication(pair.Key, node.ID, err == nil)
+			}
+			if err != nil {
+				log.Printf("Failed to replicate %d keys to node %s: %v", len(batch), node.ID, err)
+			}
+		}(targets[nodeID], batch)
+	}
+	wg.Wait()
+}
+
+func (c *Cluster) replicateBatchToNode(node *Node, pairs []KeyValue, stamp Timestamp) error {
+	if _, fired := c.faults.trigger(FaultReplicationDrop); fired {
+		return fmt.Errorf("failed to replicate to node %s: %w", node.ID, ErrInjectedFault)
+	}
+	if err := c.post(node, "/data/replicate", map[string]interface{}{"pairs": pairs, "stamp": stamp}); err != nil {
 		return fmt.Errorf("failed to replicate to node %s: %w", node.ID, err)
 	}
+	return nil
+}
+
+// SendChunk hands pairs owned by node to it for storage and replication
+func (c *Cluster) SendChunk(node *Node, pairs []KeyValue) error {
+	if err := c.post(node, "/data/bulk", map[string]interface{}{"pairs": pairs}); err != nil {
+		return fmt.Errorf("failed to load chunk on node %s: %w", node.ID, err)
+	}
+	return nil
+}
+
+// post sends payload as JSON to path on node and expects 200 OK
+func (c *Cluster) post(node *Node, path string, payload interface{}) error {
+	return c.call(node, path, payload, nil)
+}
+
+// peerErrors are the errors a peer's response is mapped back to, by message
+var peerErrors = []error{ErrStaleEpoch, ErrLockHeld, ErrLockNotHeld, ErrUnknownPartition, ErrPartitionTooSmall}
+
+// call sends payload as JSON to path on node and decodes the response data into out
+// when it is not nil. Errors reported by the peer are mapped back to the sentinel
+// errors in peerErrors.
+func (c *Cluster) call(node *Node, path string, payload interface{}, out interface{}) error {
+	url := fmt.Sprintf("http://%s:%s%s", node.Address, node.Port, path)
+	
+	reqBody, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := c.send(http.MethodPost, url, reqBody)
+	if err != nil {
+		return err
+	}
 	defer resp.Body.Close()
+	c.ObserveClock(resp.Header.Get(ClockHeader))
 	
+	var response struct {
+		Data  json.RawMessage `json:"data"`
+		Error string          `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&response)
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("replication request failed with status: %d", resp.StatusCode)
+		for _, sentinel := range peerErrors {
+			if strings.HasPrefix(response.Error, sentinel.Error()) {
+				return fmt.Errorf("%w: node %s: %s", sentinel, node.ID, strings.TrimPrefix(response.Error, sentinel.Error()+": "))
+			}
+		}
+		return fmt.Errorf("request failed with status: %d", resp.StatusCode)
+	}
+	if out != nil && len(response.Data) > 0 {
+		return json.Unmarshal(response.Data, out)
 	}
 	
 	return nil
 }
 
+// send performs a node to node request stamped with the local epoch and signed when
+// a cluster secret is configured
+func (c *Cluster) send(method, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set(EpochHeader, strconv.FormatUint(c.Epoch(), 10))
+	req.Header.Set(ClockHeader, c.clock.Now().String())
+	c.signHeader(req.Header, method, req.URL.RequestURI(), body)
+	
+	return c.httpClient.Do(req)
+}
+
+// Epoch returns the local partition map epoch
+func (c *Cluster) Epoch() uint64 {
+	c.nodesMutex.RLock()
+	defer c.nodesMutex.RUnlock()
+	
+	return c.epoch
+}
+
+// ObserveEpoch adopts epoch when it is newer than the local one
+func (c *Cluster) ObserveEpoch(epoch uint64) {
+	c.nodesMutex.Lock()
+	defer c.nodesMutex.Unlock()
+	
+	if epoch > c.epoch {
+		c.epoch = epoch
+	}
+}
+
+// CheckEpoch fences a replication or forwarded write sent under epoch. Writes from
+// a sender whose partition map is older than the local one are rejected, so a node
+// that missed membership changes cannot write to replicas it no longer owns.
+func (c *Cluster) CheckEpoch(epoch uint64) error {
+	c.ObserveEpoch(epoch)
+	if local := c.Epoch(); epoch < local {
+		return fmt.Errorf("%w: request epoch %d is older than %d", ErrStaleEpoch, epoch, local)
+	}
+	return nil
+}
+
 // Close shuts down the cluster component gracefully
 func (c *Cluster) Close() {
 	c.cancelFunc()
+	if !c.routines.wait(stopTimeout) {
+		log.Printf("Cluster routines still running after %v", stopTimeout)
+	}
 }
\ No newline at end of file
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"multimodel-db-engine/internal/config"
+)
+
+func newTestCluster(t *testing.T, nodeID, secret string) *Cluster {
+	t.Helper()
+	cluster := NewCluster(&config.Config{NodeID: nodeID, ClusterSecret: secret, ReplicationFactor: 1})
+	t.Cleanup(cluster.Close)
+	return cluster
+}
+
+func TestClusterRequestSignatures(t *testing.T) {
+	sender := newTestCluster(t, "a", "s3cret")
+	receiver := newTestCluster(t, "b", "s3cret")
+	outsider := newTestCluster(t, "c", "other")
+
+	signed := func(cluster *Cluster, body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/data/replicate?x=1", strings.NewReader(body))
+		req.Header.Set(EpochHeader, "3")
+		cluster.signHeader(req.Header, req.Method, req.URL.RequestURI(), []byte(body))
+		return req
+	}
+
+	accepted := signed(sender, `{"key":"k"}`)
+	if err := receiver.VerifyRequest(accepted, []byte(`{"key":"k"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	epoch := signed(sender, "{}")
+	epoch.Header.Set(EpochHeader, "4")
+	nonce := signed(sender, "{}")
+	nonce.Header.Set(NonceHeader, "other")
+	unnonced := signed(sender, "{}")
+	unnonced.Header.Del(NonceHeader)
+	expired := signed(sender, "{}")
+	timestamp := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	expired.Header.Set(TimestampHeader, timestamp)
+	expired.Header.Set(SignatureHeader, clusterSignature("s3cret", expired.Method, expired.URL.RequestURI(), "a", timestamp, expired.Header.Get(NonceHeader), "3", []byte("{}")))
+
+	cases := map[string]struct {
+		req  *http.Request
+		body string
+	}{
+		"body":     {signed(sender, `{"key":"k"}`), `{"key":"x"}`},
+		"unsigned": {httptest.NewRequest(http.MethodPost, "/data/replicate", nil), ""},
+		"secret":   {signed(outsider, "{}"), "{}"},
+		"epoch":    {epoch, "{}"},
+		"nonce":    {nonce, "{}"},
+		"unnonced": {unnonced, "{}"},
+		"expired":  {expired, "{}"},
+		"replayed": {accepted, `{"key":"k"}`},
+	}
+	for name, c := range cases {
+		if err := receiver.VerifyRequest(c.req, []byte(c.body)); !errors.Is(err, ErrUnauthenticated) {
+			t.Errorf("%s: expected ErrUnauthenticated, got %v", name, err)
+		}
+	}
+}
+
+func TestNonceCacheForgetsExpiredNonces(t *testing.T) {
+	nonces := newNonceCache()
+	now := time.Now()
+	if !nonces.add("a/1", now.Add(signatureWindow), now) {
+		t.Fatal("fresh nonce rejected")
+	}
+	if nonces.add("a/1", now.Add(signatureWindow), now.Add(signatureWindow/2)) {
+		t.Fatal("nonce accepted twice within the window")
+	}
+	if !nonces.add("b/1", now.Add(signatureWindow), now) {
+		t.Fatal("nonce of another node rejected")
+	}
+
+	// Past the window the timestamp check rejects the message, so the nonce is dropped
+	later := now.Add(2 * signatureWindow)
+	nonces.add("a/2", later.Add(signatureWindow), later)
+	if len(nonces.seen) != 1 {
+		t.Fatalf("cache holds %d nonces after pruning", len(nonces.seen))
+	}
+}
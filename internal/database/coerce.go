@@ -0,0 +1,465 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Type hints of query string filters, written field:hint=value
+const (
+	HintString = "string"
+	HintInt    = "int"
+	HintFloat  = "float"
+	HintBool   = "bool"
+	HintDate   = "date"
+	HintNull   = "null"
+)
+
+// Time range operators of query string filters, written field:op=value. Bounds of
+// before and after are exclusive; between takes two comma separated inclusive bounds.
+const (
+	OpBefore  = "before"
+	OpAfter   = "after"
+	OpBetween = "between"
+)
+
+// NowFunc is the time query filters written as now() resolve to, now()-24h and
+// now()+7d being offsets from it. It is a variable for tests.
+var NowFunc = time.Now
+
+// TimeBound is one end of a TimeRange
+type TimeBound struct {
+	Time      time.Time `json:"time"`
+	Inclusive bool      `json:"inclusive"`
+}
+
+// TimeRange is a filter value matching timestamps between its bounds; a nil bound is
+// open
+type TimeRange struct {
+	From *TimeBound `json:"from,omitempty"`
+	To   *TimeBound `json:"to,omitempty"`
+}
+
+// contains reports whether t lies within the range
+func (r TimeRange) contains(t time.Time) bool {
+	if r.From != nil && (t.Before(r.From.Time) || t.Equal(r.From.Time) && !r.From.Inclusive) {
+		return false
+	}
+	if r.To != nil && (t.After(r.To.Time) || t.Equal(r.To.Time) && !r.To.Inclusive) {
+		return false
+	}
+	return true
+}
+
+// ParseQueryFilters turns query string parameters into filters for QueryDocuments.
+// Every parameter but the query options, such as SortParam, is a filter as parsed by ParseQueryFilter; the
+// ranges of several time operators on a field combine, as in
+// joined:after=2024-01-01&joined:before=now(), and so do array and string operators.
+func ParseQueryFilters(query url.Values) (map[string]interface{}, error) {
+	filters := make(map[string]interface{})
+	for key, values := range query {
+		if queryOptionParams[key] || len(values) == 0 {
+			continue
+		}
+		// For simplicity, take the first value
+		field, value, err := ParseQueryFilter(key, values[0])
+		if err != nil {
+			return nil, err
+		}
+		if r, isRange := value.(TimeRange); isRange {
+			if existing, ok := filters[field].(TimeRange); ok {
+				if r.From == nil {
+					r.From = existing.From
+				}
+				if r.To == nil {
+					r.To = existing.To
+				}
+				value = r
+			}
+		}
+		if ops, isArrayOp := arrayOperators(value); isArrayOp {
+			if existing, ok := arrayOperators(filters[field]); ok {
+				for op, v := range ops {
+					existing[op] = v
+				}
+				value = existing
+			}
+		}
+		if ops, isStringOp := stringOperators(value); isStringOp {
+			if existing, ok := stringOperators(filters[field]); ok {
+				for op, v := range ops {
+					existing[op] = v
+				}
+				value = existing
+			}
+		}
+		filters[field] = value
+	}
+	return filters, nil
+}
+
+// QueryParam is a filter value taken from a query string without a type hint. It
+// matches a document value of whatever type it converts to, so age=30 matches the
+// number 30, active=true the boolean true and zip=0150 the string "0150".
+type QueryParam string
+
+// ParseQueryFilter returns the field and the filter value of a query string
+// parameter. A key ending in a type hint, as in age:int, converts the value to that
+// type and fails when it does not convert, and one ending in a time operator, as in
+// joined:after, gives a TimeRange. Array operators, as in tags:contains, and string
+// operators, as in name:startsWith, give their operator object. Other values are
+// QueryParams.
+func ParseQueryFilter(key, raw string) (string, interface{}, error) {
+	idx := strings.LastIndex(key, ":")
+	if idx <= 0 {
+		return key, QueryParam(raw), nil
+	}
+	field, hint := key[:idx], key[idx+1:]
+	if op, isArrayOp := arrayQueryOps[hint]; isArrayOp {
+		value, err := parseArrayFilter(op, raw)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid %s value %q for field %s: %w", hint, raw, field, err)
+		}
+		return field, value, nil
+	}
+	if op, isStringOp := stringQueryOps[hint]; isStringOp {
+		value, err := parseStringFilter(op, raw)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid %s value %q for field %s: %w", hint, raw, field, err)
+		}
+		return field, value, nil
+	}
+
+	var value interface{}
+	var err error
+	switch hint {
+	case HintString:
+		value = raw
+	case HintInt:
+		value, err = strconv.ParseInt(raw, 10, 64)
+	case HintFloat:
+		value, err = strconv.ParseFloat(raw, 64)
+	case HintBool:
+		value, err = strconv.ParseBool(raw)
+	case HintDate:
+		value, err = parseTimeExpr(raw)
+	case OpBefore:
+		var t time.Time
+		t, err = parseTimeExpr(raw)
+		value = TimeRange{To: &TimeBound{Time: t}}
+	case OpAfter:
+		var t time.Time
+		t, err = parseTimeExpr(raw)
+		value = TimeRange{From: &TimeBound{Time: t}}
+	case OpBetween:
+		value, err = parseBetween(raw)
+	case HintNull:
+		if raw != "" && raw != "null" {
+			err = fmt.Errorf("expected null")
+		}
+	default:
+		// Not a hint: the colon is part of the field name
+		return key, QueryParam(raw), nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid %s value %q for field %s: %w", hint, raw, field, err)
+	}
+	return field, value, nil
+}
+
+// filterMatches reports whether a document value satisfies a filter value. Numbers
+// match whatever their Go type, times match RFC 3339 strings of the same instant and
+// strings compare under the collation.
+func (c Collation) filterMatches(actual, expected interface{}) bool {
+	switch e := expected.(type) {
+	case QueryParam:
+		return c.paramMatches(actual, string(e))
+	case time.Time:
+		t, ok := timeValue(actual)
+		return ok && t.Equal(e)
+	case TimeRange:
+		t, ok := timeValue(actual)
+		return ok && e.contains(t)
+	case map[string]interface{}:
+		if ops, isArrayOp := arrayOperators(e); isArrayOp {
+			return c.arrayMatches(actual, ops)
+		}
+		if ops, isStringOp := stringOperators(e); isStringOp {
+			return c.stringMatches(actual, ops)
+		}
+	}
+	if _, ok := numberValue(actual); ok {
+		return numbersEqual(actual, expected)
+	}
+	if a, ok := actual.(string); ok {
+		e, ok := expected.(string)
+		return ok && c.equalStrings(a, e)
+	}
+	return valuesEqual(actual, expected)
+}
+
+// paramMatches converts an untyped query string value to the type of actual and
+// compares them
+func (c Collation) paramMatches(actual interface{}, raw string) bool {
+	switch v := actual.(type) {
+	case nil:
+		return raw == "null"
+	case string:
+		if c.equalStrings(v, raw) {
+			return true
+		}
+		// Timestamps match in any notation of the same instant
+		a, aOK := parseTime(v)
+		e, eOK := parseTime(raw)
+		return aOK && eOK && a.Equal(e)
+	case bool:
+		b, err := strconv.ParseBool(raw)
+		return err == nil && b == v
+	case map[string]interface{}, Document, []interface{}:
+		if t, ok := timeValue(actual); ok {
+			e, ok := parseTime(raw)
+			return ok && t.Equal(e)
+		}
+		var decoded interface{}
+		return DecodeJSON([]byte(raw), &decoded) == nil && c.filterMatches(actual, decoded)
+	}
+	if _, ok := numberValue(actual); ok {
+		_, err := strconv.ParseFloat(raw, 64)
+		return err == nil && numbersEqual(actual, json.Number(raw))
+	}
+	return false
+}
+
+// numberValue returns a numeric value as a float64. Unlike toFloat it does not parse
+// strings, which only match filters as strings.
+func numberValue(v interface{}) (float64, bool) {
+	if _, isString := v.(string); isString {
+		return 0, false
+	}
+	return toFloat(v)
+}
+
+// integerValue returns an integer of an integer type or an integral json.Number as
+// an int64, which compares exactly where float64 would round beyond 2^53
+func integerValue(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// numbersEqual reports whether two values are equal numbers, whatever their Go type
+func numbersEqual(a, b interface{}) bool {
+	if ai, ok := integerValue(a); ok {
+		if bi, ok := integerValue(b); ok {
+			return ai == bi
+		}
+	}
+	af, aOK := numberValue(a)
+	bf, bOK := numberValue(b)
+	return aOK && bOK && af == bf
+}
+
+// valuesEqual compares arrays and objects deeply, numbers by value so that documents
+// decoded with json.Number match filters holding float64 or int values
+func valuesEqual(a, b interface{}) bool {
+	if _, ok := numberValue(a); ok {
+		return numbersEqual(a, b)
+	}
+	switch av := a.(type) {
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !valuesEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		return objectsEqual(av, b)
+	case Document:
+		return objectsEqual(av, b)
+	}
+	// DeepEqual rather than == as other values may not be comparable
+	return reflect.DeepEqual(a, b)
+}
+
+func objectsEqual(a map[string]interface{}, b interface{}) bool {
+	var bv map[string]interface{}
+	switch object := b.(type) {
+	case map[string]interface{}:
+		bv = object
+	case Document:
+		bv = object
+	default:
+		return false
+	}
+	if len(a) != len(bv) {
+		return false
+	}
+	for key, value := range a {
+		other, exists := bv[key]
+		if !exists || !valuesEqual(value, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseBetween parses the two comma separated bounds of a between filter
+func parseBetween(raw string) (TimeRange, error) {
+	from, to, found := strings.Cut(raw, ",")
+	if !found {
+		return TimeRange{}, fmt.Errorf("expected two comma separated times")
+	}
+	start, err := parseTimeExpr(from)
+	if err != nil {
+		return TimeRange{}, err
+	}
+	end, err := parseTimeExpr(to)
+	if err != nil {
+		return TimeRange{}, err
+	}
+	return TimeRange{From: &TimeBound{Time: start, Inclusive: true}, To: &TimeBound{Time: end, Inclusive: true}}, nil
+}
+
+// parseTimeExpr parses a timestamp or now() with an optional offset such as
+// now()-24h; offsets take Go durations and whole days like 7d
+func parseTimeExpr(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "now()") {
+		if t, ok := parseTime(s); ok {
+			return t, nil
+		}
+		return time.Time{}, fmt.Errorf("not an RFC 3339 time or now()")
+	}
+
+	now := NowFunc()
+	offset := s[len("now()"):]
+	if offset == "" {
+		return now, nil
+	}
+	if offset[0] != '+' && offset[0] != '-' {
+		return time.Time{}, fmt.Errorf("expected + or - after now()")
+	}
+	var d time.Duration
+	if days := strings.TrimSuffix(offset[1:], "d"); days != offset[1:] {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid offset %q", offset)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(offset[1:]); err != nil {
+			return time.Time{}, fmt.Errorf("invalid offset %q", offset)
+		}
+	}
+	if offset[0] == '-' {
+		d = -d
+	}
+	return now.Add(d), nil
+}
+
+// parseTime parses an RFC 3339 timestamp or a plain date
+func parseTime(s string) (time.Time, bool) {
+	// Both start with a date; rejecting other strings up front spares filters and
+	// sorts the error time.Parse allocates for each of them
+	if len(s) < len("2006-01-02") || s[4] != '-' || s[7] != '-' || !isDigit(rune(s[0])) {
+		return time.Time{}, false
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// timeValue returns the instant held by a time, a timestamp string or a $date
+// wrapper, whose value is a timestamp string or milliseconds since the epoch
+func timeValue(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		return parseTime(t)
+	case map[string]interface{}:
+		return dateWrapper(t)
+	case Document:
+		return dateWrapper(t)
+	}
+	return time.Time{}, false
+}
+
+func dateWrapper(m map[string]interface{}) (time.Time, bool) {
+	date, exists := m["$date"]
+	if !exists || len(m) != 1 {
+		return time.Time{}, false
+	}
+	if s, ok := date.(string); ok {
+		return parseTime(s)
+	}
+	if ms, ok := numberValue(date); ok {
+		return time.UnixMilli(int64(ms)), true
+	}
+	return time.Time{}, false
+}
+
+// SortDocuments orders docs by field, descending when desc is set. Timestamps,
+// including $date wrappers, sort chronologically, numbers numerically, strings under
+// the collation and other values by their string form; documents lacking the field
+// come last.
+func SortDocuments(docs []Document, field string, desc bool, collation Collation) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		a, aExists := lookupPath(docs[i], field)
+		b, bExists := lookupPath(docs[j], field)
+		if !aExists || !bExists {
+			return aExists && !bExists
+		}
+		cmp := collation.compareSortValues(a, b)
+		if desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+}
+
+// compareSortValues orders two field values, comparing timestamps as instants
+func (c Collation) compareSortValues(a, b interface{}) int {
+	at, aTime := timeValue(a)
+	bt, bTime := timeValue(b)
+	if aTime && bTime {
+		switch {
+		case at.Before(bt):
+			return -1
+		case at.After(bt):
+			return 1
+		}
+		return 0
+	}
+	if as, ok := a.(string); ok && c != (Collation{}) {
+		if bs, ok := b.(string); ok {
+			return c.compareStrings(as, bs)
+		}
+	}
+	return compareValues(a, b)
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestQueryParamsMatchStoredTypes(t *testing.T) {
+	db := newTestDatabase(t)
+	docs := map[string]Document{
+		"a": {"name": "a", "age": float64(30), "active": true, "zip": "0150", "joined": "2024-05-01T10:00:00Z", "note": nil},
+		"b": {"name": "b", "age": 30.5, "active": false, "zip": float64(150), "joined": "2024-05-01T12:00:00+02:00"},
+	}
+	for id, doc := range docs {
+		if err := db.InsertDocument("people", id, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		key, value string
+		want       []string
+	}{
+		{"age", "30", []string{"a"}},
+		{"age", "30.50", []string{"b"}},
+		{"age:int", "30", []string{"a"}},
+		{"active", "false", []string{"b"}},
+		{"zip", "0150", []string{"a", "b"}},
+		{"zip:string", "0150", []string{"a"}},
+		{"zip:string", "150", nil},
+		{"joined", "2024-05-01T10:00:00Z", []string{"a", "b"}},
+		{"joined:date", "2024-05-01T11:00:00+01:00", []string{"a", "b"}},
+		{"note", "null", []string{"a"}},
+		{"note:null", "", []string{"a"}},
+	} {
+		field, value, err := ParseQueryFilter(tc.key, tc.value)
+		if err != nil {
+			t.Fatalf("%s=%s: %v", tc.key, tc.value, err)
+		}
+		results, err := db.QueryDocuments("people", map[string]interface{}{field: value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, doc := range results {
+			got = append(got, doc["name"].(string))
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s=%s matched %v, want %v", tc.key, tc.value, got, tc.want)
+		}
+	}
+
+	if _, _, err := ParseQueryFilter("age:int", "thirty"); err == nil {
+		t.Fatal("expected an error for a value not matching its hint")
+	}
+	if field, value, _ := ParseQueryFilter("ns:key", "v"); field != "ns:key" || value != QueryParam("v") {
+		t.Fatalf("unknown hint parsed as %q = %v", field, value)
+	}
+}
+
+func TestTimeRangesAndSorting(t *testing.T) {
+	db := newTestDatabase(t)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	NowFunc = func() time.Time { return now }
+	defer func() { NowFunc = time.Now }()
+
+	docs := map[string]Document{
+		"old":    {"name": "old", "at": "2024-01-15T08:00:00Z"},
+		"recent": {"name": "recent", "at": map[string]interface{}{"$date": "2024-05-31T18:00:00+02:00"}},
+		"millis": {"name": "millis", "at": map[string]interface{}{"$date": float64(now.Add(-time.Hour).UnixMilli())}},
+		"none":   {"name": "none"},
+	}
+	for id, doc := range docs {
+		if err := db.InsertDocument("events", id, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"at:after=2024-05-01", []string{"millis", "recent"}},
+		{"at:before=2024-05-31T16:00:00Z", []string{"old"}},
+		{"at:after=now()-1d&at:before=now()", []string{"millis", "recent"}},
+		{"at:between=2024-01-15T08:00:00Z,2024-05-31T16:00:00Z", []string{"old", "recent"}},
+		{"at=2024-05-31T16:00:00Z", []string{"recent"}},
+		{"at:date=now()-1h", []string{"millis"}},
+	} {
+		query, err := url.ParseQuery(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filters, err := ParseQueryFilters(query)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.query, err)
+		}
+		results, err := db.QueryDocuments("events", filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, doc := range results {
+			got = append(got, doc["name"].(string))
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s matched %v, want %v", tc.query, got, tc.want)
+		}
+	}
+
+	if _, err := ParseQueryFilters(url.Values{"at:after": {"yesterday"}}); err == nil {
+		t.Fatal("expected an error for a bound that is not a time")
+	}
+
+	all, err := db.QueryDocuments("events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SortDocuments(all, "at", true, Collation{})
+	var order []string
+	for _, doc := range all {
+		order = append(order, doc["name"].(string))
+	}
+	if want := []string{"millis", "recent", "old", "none"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("descending order = %v, want %v", order, want)
+	}
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// CollationParam is the query string parameter setting the collation of a query:
+// _collation=ci,ai,numeric
+const CollationParam = "_collation"
+
+// Collation controls how strings compare in filters and sorts. The zero Collation
+// compares them byte by byte.
+type Collation struct {
+	CaseInsensitive   bool `json:"case_insensitive,omitempty"`   // "Oslo" equals "oslo"
+	AccentInsensitive bool `json:"accent_insensitive,omitempty"` // "Málaga" equals "Malaga"
+	Numeric           bool `json:"numeric,omitempty"`            // "item2" sorts before "item10"
+}
+
+// ParseCollation parses a comma separated list of collation options: ci (case
+// insensitive), ai (accent insensitive) and numeric
+func ParseCollation(s string) (Collation, error) {
+	var c Collation
+	for _, option := range strings.Split(s, ",") {
+		switch strings.TrimSpace(option) {
+		case "":
+		case "ci", "case_insensitive":
+			c.CaseInsensitive = true
+		case "ai", "accent_insensitive":
+			c.AccentInsensitive = true
+		case "numeric":
+			c.Numeric = true
+		default:
+			return Collation{}, fmt.Errorf("unknown collation option %q, expected ci, ai or numeric", option)
+		}
+	}
+	return c, nil
+}
+
+// accentFolds maps accented Latin letters onto their base letter
+var accentFolds = func() map[rune]rune {
+	folds := make(map[rune]rune)
+	for base, accented := range map[rune]string{
+		'A': "ÀÁÂÃÄÅĀĂĄ", 'a': "àáâãäåāăą",
+		'C': "ÇĆĈĊČ", 'c': "çćĉċč",
+		'D': "ĎĐ", 'd': "ďđ",
+		'E': "ÈÉÊËĒĔĖĘĚ", 'e': "èéêëēĕėęě",
+		'G': "ĜĞĠĢ", 'g': "ĝğġģ",
+		'I': "ÌÍÎÏĨĪĬĮİ", 'i': "ìíîïĩīĭįı",
+		'L': "ĹĻĽĿŁ", 'l': "ĺļľŀł",
+		'N': "ÑŃŅŇ", 'n': "ñńņň",
+		'O': "ÒÓÔÕÖØŌŎŐ", 'o': "òóôõöøōŏő",
+		'R': "ŔŖŘ", 'r': "ŕŗř",
+		'S': "ŚŜŞŠ", 's': "śŝşš",
+		'T': "ŢŤŦ", 't': "ţťŧ",
+		'U': "ÙÚÛÜŨŪŬŮŰŲ", 'u': "ùúûüũūŭůűų",
+		'Y': "ÝŸŶ", 'y': "ýÿŷ",
+		'Z': "ŹŻŽ", 'z': "źżž",
+	} {
+		for _, r := range accented {
+			folds[r] = base
+		}
+	}
+	return folds
+}()
+
+// fold returns the form of s that the collation compares
+func (c Collation) fold(s string) string {
+	if c.AccentInsensitive {
+		s = strings.Map(func(r rune) rune {
+			if base, accented := accentFolds[r]; accented {
+				return base
+			}
+			return r
+		}, s)
+	}
+	if c.CaseInsensitive {
+		s = strings.ToLower(s)
+	}
+	return s
+}
+
+// compareStrings orders two strings under the collation
+func (c Collation) compareStrings(a, b string) int {
+	a, b = c.fold(a), c.fold(b)
+	if !c.Numeric {
+		return strings.Compare(a, b)
+	}
+
+	// Runs of digits compare by their value, other characters one by one
+	scratch := runeScratches.Get().(*runeScratch)
+	defer runeScratches.Put(scratch)
+	scratch.a, scratch.b = appendRunes(scratch.a[:0], a), appendRunes(scratch.b[:0], b)
+	ar, br := scratch.a, scratch.b
+	i, j := 0, 0
+	for i < len(ar) && j < len(br) {
+		if isDigit(ar[i]) && isDigit(br[j]) {
+			startA, startB := i, j
+			for i < len(ar) && isDigit(ar[i]) {
+				i++
+			}
+			for j < len(br) && isDigit(br[j]) {
+				j++
+			}
+			numA, numB := trimZeros(ar[startA:i]), trimZeros(br[startB:j])
+			if len(numA) != len(numB) {
+				if len(numA) < len(numB) {
+					return -1
+				}
+				return 1
+			}
+			for k := range numA {
+				if numA[k] != numB[k] {
+					if numA[k] < numB[k] {
+						return -1
+					}
+					return 1
+				}
+			}
+			continue
+		}
+		if ar[i] != br[j] {
+			if ar[i] < br[j] {
+				return -1
+			}
+			return 1
+		}
+		i++
+		j++
+	}
+	switch {
+	case len(ar)-i < len(br)-j:
+		return -1
+	case len(ar)-i > len(br)-j:
+		return 1
+	}
+	return 0
+}
+
+// equalStrings reports whether two strings are equal under the collation
+func (c Collation) equalStrings(a, b string) bool {
+	if c == (Collation{}) {
+		return a == b
+	}
+	return c.compareStrings(a, b) == 0
+}
+
+// runeScratch holds the buffers numeric comparisons decode strings into, pooled as
+// sorts compare every pair of values
+type runeScratch struct {
+	a, b []rune
+}
+
+var runeScratches = sync.Pool{
+	New: func() interface{} { return new(runeScratch) },
+}
+
+func appendRunes(dst []rune, s string) []rune {
+	for _, r := range s {
+		dst = append(dst, r)
+	}
+	return dst
+}
+
+// trimZeros drops the leading zeros of a run of digits
+func trimZeros(digits []rune) []rune {
+	for len(digits) > 0 && digits[0] == '0' {
+		digits = digits[1:]
+	}
+	return digits
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
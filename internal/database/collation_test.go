@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestCollationsInFiltersAndSorts(t *testing.T) {
+	db := newTestDatabase(t)
+	for id, name := range map[string]string{"1": "Málaga", "2": "malaga", "3": "item10", "4": "item2", "5": "Oslo"} {
+		if err := db.InsertDocument("places", id, Document{"name": name, "tags": []interface{}{name}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	find := func(raw string) []string {
+		t.Helper()
+		query, err := url.ParseQuery(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := ParseDocumentQuery(query)
+		if err != nil {
+			t.Fatalf("%s: %v", raw, err)
+		}
+		docs, err := db.FindDocuments(context.Background(), "places", q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := make([]string, 0, len(docs))
+		for _, doc := range docs {
+			names = append(names, doc["name"].(string))
+		}
+		return names
+	}
+
+	if got := find("name=MALAGA&_collation=ci"); len(got) != 1 || got[0] != "malaga" {
+		t.Fatalf("case insensitive match = %v", got)
+	}
+	if got := find("name=MALAGA&_collation=ci,ai&_sort=name"); !reflect.DeepEqual(got, []string{"Málaga", "malaga"}) && !reflect.DeepEqual(got, []string{"malaga", "Málaga"}) {
+		t.Fatalf("accent insensitive match = %v", got)
+	}
+	if got := find("tags:contains=oslo&_collation=ci"); !reflect.DeepEqual(got, []string{"Oslo"}) {
+		t.Fatalf("case insensitive array match = %v", got)
+	}
+	if got := find("name=malaga"); !reflect.DeepEqual(got, []string{"malaga"}) {
+		t.Fatalf("binary match = %v", got)
+	}
+
+	if got := find("_sort=name&_collation=numeric,ci,ai&_fields=name"); !reflect.DeepEqual(got[:3], []string{"item2", "item10", "Málaga"}) && !reflect.DeepEqual(got[:3], []string{"item2", "item10", "malaga"}) {
+		t.Fatalf("numeric order = %v", got)
+	}
+	if got := find("_sort=name"); !reflect.DeepEqual(got, []string{"Málaga", "Oslo", "item10", "item2", "malaga"}) {
+		t.Fatalf("binary order = %v", got)
+	}
+
+	if _, err := ParseCollation("ci,fuzzy"); err == nil {
+		t.Fatal("expected an error for an unknown collation option")
+	}
+}
+
+func BenchmarkNumericCollationSort(b *testing.B) {
+	docs := make([]Document, 1000)
+	for i := range docs {
+		docs[i] = Document{"name": fmt.Sprintf("item%d-v%d", (i*7919)%1000, i%7)}
+	}
+	collation := Collation{Numeric: true, CaseInsensitive: true}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sorted := append([]Document(nil), docs...)
+		SortDocuments(sorted, "name", false, collation)
+	}
+}
@@ -0,0 +1,490 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CollectionStamp identifies the state of a collection. Version changes on every
+// mutation and Modified is the time of the last one, or the server start for
+// collections unchanged since then.
+type CollectionStamp struct {
+	Version  int64
+	Modified time.Time
+}
+
+// CollectionStamp returns the change stamp of collection
+func (db *MultiModelDatabase) CollectionStamp(collection string) CollectionStamp {
+	db.docMutex.RLock()
+	defer db.docMutex.RUnlock()
+
+	if stamp, exists := db.docStamps[collection]; exists {
+		return stamp
+	}
+	return CollectionStamp{Modified: db.startedAt}
+}
+
+// touchCollection records a mutation of collection and wakes the watchers of its
+// documents. Callers must hold the docMutex write lock.
+func (db *MultiModelDatabase) touchCollection(collection string) {
+	db.docRevision++
+	db.docStamps[collection] = CollectionStamp{Version: db.docRevision, Modified: time.Now()}
+	for _, ch := range db.docWatchers[collection] {
+		close(ch)
+	}
+	delete(db.docWatchers, collection)
+}
+
+// ValidateCollectionName rejects names that cannot be addressed unambiguously.
+// Names starting with "_" are reserved for system collections.
+func ValidateCollectionName(name string) error {
+	if name == "" {
+		return fmt.Errorf("collection name must not be empty")
+	}
+	if strings.HasPrefix(name, "_") {
+		return fmt.Errorf("collection names starting with _ are reserved")
+	}
+	if strings.ContainsAny(name, "./") {
+		return fmt.Errorf("collection name %q must not contain . or /", name)
+	}
+	return nil
+}
+
+// ListCollections returns the names of collections holding at least one document
+func (db *MultiModelDatabase) ListCollections() []string {
+	db.docMutex.RLock()
+	defer db.docMutex.RUnlock()
+
+	seen := make(map[string]struct{})
+	for key := range db.documents {
+		if idx := strings.Index(key, "."); idx > 0 {
+			seen[key[:idx]] = struct{}{}
+		}
+	}
+	// Collections whose documents are all tiered or archived still exist
+	for key := range db.coldDocs {
+		if idx := strings.Index(key, "."); idx > 0 {
+			seen[key[:idx]] = struct{}{}
+		}
+	}
+	for name := range db.archives {
+		seen[name] = struct{}{}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RenameCollection moves every document of from into to in one step. The target
+// must be empty unless overwrite is set, in which case its documents are replaced.
+func (db *MultiModelDatabase) RenameCollection(from, to string, overwrite bool) (int, error) {
+	return db.transferCollection(from, to, overwrite, true)
+}
+
+// CopyCollection duplicates every document of from into to in one step. Documents
+// are deep-copied so later updates to either collection do not affect the other.
+func (db *MultiModelDatabase) CopyCollection(from, to string, overwrite bool) (int, error) {
+	return db.transferCollection(from, to, overwrite, false)
+}
+
+func (db *MultiModelDatabase) transferCollection(from, to string, overwrite, move bool) (int, error) {
+	if err := ValidateCollectionName(from); err != nil {
+		return 0, err
+	}
+	if err := ValidateCollectionName(to); err != nil {
+		return 0, err
+	}
+	if from == to {
+		return 0, fmt.Errorf("source and target collection are the same")
+	}
+	for _, collection := range []string{from, to} {
+		if err := db.warmCollection(collection); err != nil {
+			return 0, err
+		}
+	}
+
+	count, events, err := db.transferDocuments(from, to, overwrite, move)
+	if err != nil {
+		return 0, err
+	}
+
+	// Let observers such as plugin-maintained indexes follow the documents
+	for _, event := range events {
+		db.afterWrite(event.op, event.event)
+	}
+	return count, nil
+}
+
+type pendingWrite struct {
+	op    Operation
+	event *WriteEvent
+}
+
+// transferDocuments applies the transfer under the document lock and returns the
+// number of documents transferred with the writes to report to observers
+func (db *MultiModelDatabase) transferDocuments(from, to string, overwrite, move bool) (int, []pendingWrite, error) {
+	db.docMutex.Lock()
+	defer db.docMutex.Unlock()
+
+	for _, collection := range []string{from, to} {
+		if db.archived(collection) != nil {
+			return 0, nil, fmt.Errorf("%w: %s", ErrArchived, collection)
+		}
+	}
+	fromPrefix, toPrefix := from+".", to+"."
+	var sourceKeys, targetKeys []string
+	for key := range db.documents {
+		switch {
+		case strings.HasPrefix(key, fromPrefix):
+			sourceKeys = append(sourceKeys, key)
+		case strings.HasPrefix(key, toPrefix):
+			targetKeys = append(targetKeys, key)
+		}
+	}
+	if len(sourceKeys) == 0 {
+		return 0, nil, fmt.Errorf("collection %s not found", from)
+	}
+	if len(targetKeys) > 0 && !overwrite {
+		return 0, nil, fmt.Errorf("collection %s already exists", to)
+	}
+
+	events := make([]pendingWrite, 0, 2*len(sourceKeys)+len(targetKeys))
+	for _, key := range targetKeys {
+		delete(db.documents, key)
+		db.rawDocs.forget(key)
+		events = append(events, pendingWrite{OpDelete, &WriteEvent{Model: ModelDocument, Namespace: to, Key: strings.TrimPrefix(key, toPrefix), Timestamp: db.Clock.Now()}})
+	}
+	sort.Strings(sourceKeys)
+	for _, key := range sourceKeys {
+		id := strings.TrimPrefix(key, fromPrefix)
+		doc := db.documents[key]
+		if move {
+			delete(db.documents, key)
+			db.rawDocs.forget(key)
+			events = append(events, pendingWrite{OpDelete, &WriteEvent{Model: ModelDocument, Namespace: from, Key: id, Timestamp: db.Clock.Now()}})
+		} else {
+			doc = deepCopyValue(doc).(Document)
+		}
+		// The target's computed fields and compression apply to the documents it receives
+		doc = db.prepareDocument(to, doc)
+		db.documents[toPrefix+id] = doc
+		events = append(events, pendingWrite{OpInsert, &WriteEvent{Model: ModelDocument, Namespace: to, Key: id, Value: doc, Timestamp: db.Clock.Now()}})
+	}
+
+	db.touchCollection(to)
+	if move {
+		db.touchCollection(from)
+	}
+	return len(sourceKeys), events, nil
+}
+
+// deepCopyValue copies JSON-like values so nested maps and slices are not shared
+func deepCopyValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case Document:
+		copied := make(Document, len(value))
+		for k, inner := range value {
+			copied[k] = deepCopyValue(inner)
+		}
+		return copied
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for k, inner := range value {
+			copied[k] = deepCopyValue(inner)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, inner := range value {
+			copied[i] = deepCopyValue(inner)
+		}
+		return copied
+	}
+	return v
+}
+
+// MoveOptions controls MoveDocument
+type MoveOptions struct {
+	NewID       string `json:"new_id,omitempty"` // defaults to the current id
+	UpdateRefs  bool   `json:"update_refs"`      // rewrite {"$ref", "$id"} references in all documents
+	UpdateEdges bool   `json:"update_edges"`     // re-key the "collection:id" graph node and its edges
+}
+
+// MoveResult reports what MoveDocument changed
+type MoveResult struct {
+	From              string `json:"from"`
+	To                string `json:"to"`
+	ID                string `json:"id"`
+	NewID             string `json:"new_id"`
+	ReferencesUpdated int    `json:"references_updated"`
+	EdgesUpdated      int    `json:"edges_updated"`
+}
+
+// DocumentNodeID is the graph node id that represents a document
+func DocumentNodeID(collection, id string) string {
+	return collection + ":" + id
+}
+
+// MoveDocument moves a document to another collection. References of the form
+// {"$ref": collection, "$id": id} and the document's graph node (see DocumentNodeID)
+// with its edges can be rewritten in the same step; all changes are applied while
+// holding the document and graph locks, so readers never see a partial move.
+func (db *MultiModelDatabase) MoveDocument(collection, id, target string, opts MoveOptions) (*MoveResult, error) {
+	if err := ValidateCollectionName(target); err != nil {
+		return nil, err
+	}
+	newID := opts.NewID
+	if newID == "" {
+		newID = id
+	}
+	if collection == target && id == newID {
+		return nil, fmt.Errorf("document is already at %s/%s", target, newID)
+	}
+
+	// Bring back tiered documents the move checks or may rewrite
+	if err := db.warmDocument(collection, id); err != nil {
+		return nil, err
+	}
+	if err := db.warmDocument(target, newID); err != nil {
+		return nil, err
+	}
+	if opts.UpdateRefs {
+		if err := db.warmCollection(""); err != nil {
+			return nil, err
+		}
+	}
+	deleteEvent := &WriteEvent{Model: ModelDocument, Namespace: collection, Key: id, Timestamp: db.Clock.Now()}
+	if err := db.beforeWrite(OpDelete, deleteEvent); err != nil {
+		return nil, err
+	}
+	// The hooks get a copy of the stored document, which must not change before the
+	// move stores what they leave
+	seen, err := db.storedDocument(collection, id)
+	if err != nil {
+		return nil, err
+	}
+	doc := deepCopyValue(seen).(Document)
+	insertEvent := &WriteEvent{Model: ModelDocument, Namespace: target, Key: newID, Value: doc, Timestamp: db.Clock.Now()}
+	if err := db.beforeWrite(OpInsert, insertEvent); err != nil {
+		return nil, err
+	}
+	if moved, ok := insertEvent.Value.(Document); ok {
+		doc = moved
+	}
+
+	result, updated, err := db.moveDocument(collection, id, target, newID, seen, doc, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	db.afterWrite(OpDelete, deleteEvent)
+	db.afterWrite(OpInsert, insertEvent)
+	for _, event := range updated {
+		db.afterWrite(OpUpdate, event)
+	}
+	return result, nil
+}
+
+// storedDocument returns the document id of collection as stored, without the
+// virtual computed fields
+func (db *MultiModelDatabase) storedDocument(collection, id string) (Document, error) {
+	db.docMutex.RLock()
+	defer db.docMutex.RUnlock()
+
+	doc, exists := db.documents[collection+"."+id]
+	if !exists {
+		return nil, fmt.Errorf("document with id %s not found in collection %s", id, collection)
+	}
+	return db.expandDocument(doc), nil
+}
+
+// moveDocument moves the document, stored as seen, to target as doc
+func (db *MultiModelDatabase) moveDocument(collection, id, target, newID string, seen, doc Document, opts MoveOptions) (*MoveResult, []*WriteEvent, error) {
+	// Lock order: documents before graph
+	db.docMutex.Lock()
+	defer db.docMutex.Unlock()
+	db.graphMutex.Lock()
+	defer db.graphMutex.Unlock()
+
+	if db.archived(target) != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrArchived, target)
+	}
+	sourceKey, targetKey := collection+"."+id, target+"."+newID
+	stored, exists := db.documents[sourceKey]
+	if !exists {
+		return nil, nil, fmt.Errorf("document with id %s not found in collection %s", id, collection)
+	}
+	if !reflect.DeepEqual(db.expandDocument(stored), seen) {
+		return nil, nil, &ConflictError{Conflicts: []Conflict{{Key: id, Reason: fmt.Sprintf("document %s changed while being moved", id)}}}
+	}
+	if _, exists := db.documents[targetKey]; exists {
+		return nil, nil, fmt.Errorf("%w: %s in collection %s", ErrDocumentExists, newID, target)
+	}
+
+	oldNode, newNode := DocumentNodeID(collection, id), DocumentNodeID(target, newID)
+	if opts.UpdateEdges {
+		if _, exists := db.graphNodes[newNode]; exists {
+			return nil, nil, fmt.Errorf("node with id %s already exists", newNode)
+		}
+	}
+
+	result := &MoveResult{From: collection, To: target, ID: id, NewID: newID}
+	delete(db.documents, sourceKey)
+	db.rawDocs.forget(sourceKey)
+	db.documents[targetKey] = db.prepareDocument(target, doc)
+	db.touchCollection(collection)
+	db.touchCollection(target)
+
+	var updated []*WriteEvent
+	if opts.UpdateRefs {
+		for key, other := range db.documents {
+			rewritten, count := rewriteRefs(other, collection, id, target, newID)
+			if count == 0 {
+				continue
+			}
+			idx := strings.Index(key, ".")
+			db.documents[key] = db.prepareDocument(key[:idx], rewritten.(Document))
+			db.rawDocs.forget(key)
+			result.ReferencesUpdated += count
+
+			db.touchCollection(key[:idx])
+			updated = append(updated, &WriteEvent{Model: ModelDocument, Namespace: key[:idx], Key: key[idx+1:], Value: rewritten, Timestamp: db.Clock.Now()})
+		}
+	}
+
+	if opts.UpdateEdges {
+		if node, exists := db.graphNodes[oldNode]; exists {
+			delete(db.graphNodes, oldNode)
+			moved := *node
+			moved.ID = newNode
+			db.graphNodes[newNode] = &moved
+		}
+		for edgeID, edge := range db.graphEdges {
+			if edge.From != oldNode && edge.To != oldNode {
+				continue
+			}
+			rewired := *edge
+			if rewired.From == oldNode {
+				rewired.From = newNode
+			}
+			if rewired.To == oldNode {
+				rewired.To = newNode
+			}
+			db.graphEdges[edgeID] = &rewired
+			result.EdgesUpdated++
+		}
+	}
+
+	return result, updated, nil
+}
+
+// rewriteRefs returns a copy of v with references to collection/id pointed at
+// target/newID, and the number of references rewritten. Unchanged values are
+// returned as is.
+func rewriteRefs(v interface{}, collection, id, target, newID string) (interface{}, int) {
+	switch value := v.(type) {
+	case Document:
+		rewritten, count := rewriteRefs(map[string]interface{}(value), collection, id, target, newID)
+		if count == 0 {
+			return v, 0
+		}
+		return Document(rewritten.(map[string]interface{})), count
+	case map[string]interface{}:
+		if ref, ok := value["$ref"].(string); ok && ref == collection && fmt.Sprint(value["$id"]) == id {
+			copied := make(map[string]interface{}, len(value))
+			for k, inner := range value {
+				copied[k] = inner
+			}
+			copied["$ref"], copied["$id"] = target, newID
+			return copied, 1
+		}
+		var copied map[string]interface{}
+		total := 0
+		for k, inner := range value {
+			rewritten, count := rewriteRefs(inner, collection, id, target, newID)
+			if count == 0 {
+				continue
+			}
+			if copied == nil {
+				copied = make(map[string]interface{}, len(value))
+				for k2, v2 := range value {
+					copied[k2] = v2
+				}
+			}
+			copied[k] = rewritten
+			total += count
+		}
+		if copied == nil {
+			return v, 0
+		}
+		return copied, total
+	case []interface{}:
+		var copied []interface{}
+		total := 0
+		for i, inner := range value {
+			rewritten, count := rewriteRefs(inner, collection, id, target, newID)
+			if count == 0 {
+				continue
+			}
+			if copied == nil {
+				copied = append([]interface{}(nil), value...)
+			}
+			copied[i] = rewritten
+			total += count
+		}
+		if copied == nil {
+			return v, 0
+		}
+		return copied, total
+	}
+	return v, 0
+}
+
+// collectionDocuments returns the documents of collection by id, with the ids in order
+func (db *MultiModelDatabase) collectionDocuments(ctx context.Context, collection string) ([]string, map[string]Document, error) {
+	if err := db.warmCollection(collection); err != nil {
+		return nil, nil, err
+	}
+
+	db.docMutex.RLock()
+	defer db.docMutex.RUnlock()
+	prefix := collection + "."
+	var ids []string
+	docs := make(map[string]Document)
+	check := cancelCheck{ctx: ctx}
+	for key, doc := range db.documents {
+		if err := check.err(); err != nil {
+			return nil, nil, err
+		}
+		if strings.HasPrefix(key, prefix) {
+			id := key[len(prefix):]
+			ids = append(ids, id)
+			docs[id] = db.expandDocument(doc)
+		}
+	}
+	if a := db.archived(collection); a != nil {
+		var cancelled error
+		err := a.each(func(id string, doc Document) bool {
+			ids = append(ids, id)
+			docs[id] = doc
+			cancelled = check.err()
+			return cancelled == nil
+		})
+		if err == nil {
+			err = cancelled
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	sort.Strings(ids)
+	return ids, docs, nil
+}
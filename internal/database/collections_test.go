@@ -0,0 +1,188 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRenameAndCopyCollections(t *testing.T) {
+	db := newTestDatabase(t)
+	db.rawDocs = newRawDocuments(1 << 20)
+	for id, doc := range map[string]Document{
+		"1": {"price": float64(3), "qty": float64(2), "tags": []interface{}{"a"}},
+		"2": {"price": float64(5), "qty": float64(1), "tags": []interface{}{"b"}},
+	} {
+		if err := db.InsertDocument("orders", id, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.InsertDocument("archive", "old", Document{"price": float64(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DefineComputedField(ComputedField{Collection: "archive", Name: "total", Expression: "price * qty", Stored: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetDocumentJSON("orders", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Copies are independent of their source
+	if n, err := db.CopyCollection("orders", "backup", false); err != nil || n != 2 {
+		t.Fatalf("copy = %d, %v", n, err)
+	}
+	if err := db.UpdateDocument("orders", "1", Document{"qty": float64(7)}); err != nil {
+		t.Fatal(err)
+	}
+	copied := mustGet(t, db, "backup", "1")
+	copied["tags"].([]interface{})[0] = "changed"
+	if got := mustGet(t, db, "orders", "1"); got["qty"] != float64(7) || got["tags"].([]interface{})[0] != "a" {
+		t.Fatalf("source after copy = %v", got)
+	}
+	if _, err := db.CopyCollection("orders", "backup", false); err == nil {
+		t.Fatal("copy onto an existing collection without overwrite")
+	}
+	if _, err := db.RenameCollection("orders", "orders", false); err == nil {
+		t.Fatal("collection renamed onto itself")
+	}
+	if _, err := db.RenameCollection("missing", "other", false); err == nil {
+		t.Fatal("missing collection renamed")
+	}
+
+	// An overwriting rename replaces the target and takes its computed fields
+	if _, err := db.GetDocumentJSON("archive", "old"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.RenameCollection("orders", "archive", true); err != nil || n != 2 {
+		t.Fatalf("rename = %d, %v", n, err)
+	}
+	if _, err := db.GetDocument("orders", "1"); err == nil {
+		t.Fatal("renamed document still in its source")
+	}
+	if _, err := db.GetDocument("archive", "old"); err == nil {
+		t.Fatal("overwritten document survived")
+	}
+	if _, err := db.GetDocumentJSON("orders", "1"); err == nil {
+		t.Fatal("encoding of a renamed document still served")
+	}
+	if got := mustGet(t, db, "archive", "1"); got["total"] != float64(21) {
+		t.Fatalf("renamed document = %v", got)
+	}
+	if stats := db.RawCacheStats(); stats.Documents != 0 {
+		t.Fatalf("cache keeps %d encodings of removed documents", stats.Documents)
+	}
+	if got := db.ListCollections(); !reflect.DeepEqual(got, []string{"archive", "backup"}) {
+		t.Fatalf("collections = %v", got)
+	}
+}
+
+func TestMoveDocumentAcrossCollections(t *testing.T) {
+	db := newTestDatabase(t)
+	db.rawDocs = newRawDocuments(1 << 20)
+	if err := db.InsertDocument("users", "ann", Document{"first": "Ann", "last": "Lee"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertDocument("orders", "o1", Document{"owner": map[string]interface{}{"$ref": "users", "$id": "ann"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertDocument("staff", "bob", Document{"first": "Bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DefineComputedField(ComputedField{Collection: "staff", Name: "name", Expression: "first + ' ' + last", Stored: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateNode(DocumentNodeID("users", "ann"), []string{"Person"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateNode("team", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateEdge("e1", DocumentNodeID("users", "ann"), "team", "MEMBER_OF", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetDocumentJSON("users", "ann"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.MoveDocument("users", "ann", "staff", MoveOptions{NewID: "bob"}); err == nil {
+		t.Fatal("move onto an existing document")
+	}
+	result, err := db.MoveDocument("users", "ann", "staff", MoveOptions{NewID: "a1", UpdateRefs: true, UpdateEdges: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ReferencesUpdated != 1 || result.EdgesUpdated != 1 {
+		t.Fatalf("move result = %+v", result)
+	}
+	if _, err := db.GetDocumentJSON("users", "ann"); err == nil {
+		t.Fatal("encoding of a moved document still served")
+	}
+	if got := mustGet(t, db, "staff", "a1"); got["name"] != "Ann Lee" {
+		t.Fatalf("moved document = %v", got)
+	}
+	owner := mustGet(t, db, "orders", "o1")["owner"].(map[string]interface{})
+	if owner["$ref"] != "staff" || owner["$id"] != "a1" {
+		t.Fatalf("reference after move = %v", owner)
+	}
+	if _, err := db.GetNode(DocumentNodeID("users", "ann")); err == nil {
+		t.Fatal("node of the moved document kept its id")
+	}
+	if edge, err := db.GetEdge("e1"); err != nil || edge.From != DocumentNodeID("staff", "a1") {
+		t.Fatalf("edge after move = %+v, %v", edge, err)
+	}
+	if _, err := db.MoveDocument("staff", "a1", "staff", MoveOptions{}); err == nil {
+		t.Fatal("document moved onto itself")
+	}
+}
+
+// moveHook stamps the documents moved into staff and, when racing, updates the
+// moved document from within the hook
+type moveHook struct {
+	BasePlugin
+	db     *MultiModelDatabase
+	racing bool
+}
+
+func (h *moveHook) Name() string { return "move" }
+
+func (h *moveHook) OnInsert(event *WriteEvent) error {
+	if event.Namespace != "staff" {
+		return nil
+	}
+	event.Value.(Document)["moved"] = true
+	if h.racing {
+		h.racing = false
+		return h.db.UpdateDocument("users", "bob", Document{"name": "Robert"})
+	}
+	return nil
+}
+
+func TestMoveDocumentStoresHookChanges(t *testing.T) {
+	db := newTestDatabase(t)
+	hook := &moveHook{db: db}
+	if err := db.RegisterPlugin(hook); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"ann", "bob"} {
+		if err := db.InsertDocument("users", id, Document{"name": id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := db.MoveDocument("users", "ann", "staff", MoveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, db, "staff", "ann"); got["moved"] != true || got["name"] != "ann" {
+		t.Fatalf("moved document = %v", got)
+	}
+
+	// A write landing between the hooks and the move is not overwritten
+	hook.racing = true
+	var conflict *ConflictError
+	if _, err := db.MoveDocument("users", "bob", "staff", MoveOptions{}); !errors.As(err, &conflict) {
+		t.Fatalf("move of a document changed meanwhile: %v", err)
+	}
+	if got := mustGet(t, db, "users", "bob"); got["name"] != "Robert" {
+		t.Fatalf("document changed during the move = %v", got)
+	}
+}
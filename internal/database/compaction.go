@@ -0,0 +1,164 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// CompactOptions selects the optional work of a compaction
+type CompactOptions struct {
+	Defragment bool `json:"defragment"` // rewrite the archive file of an archived collection
+}
+
+// CompactionResult reports what a compaction did and the space it reclaimed.
+// Bytes count the stored form of documents, compressed strings at their
+// compressed size, the dropped CRDT states and the archive file of an archived
+// collection.
+type CompactionResult struct {
+	Collection   string                `json:"collection"`
+	Documents    int                   `json:"documents"`
+	Compressed   int                   `json:"compressed"` // documents stored smaller under the current compression
+	Tombstones   int                   `json:"tombstones"` // CRDT states of deleted documents dropped
+	Indexes      map[string]IndexStats `json:"indexes"`    // rebuilt, by field
+	Defragmented bool                  `json:"defragmented"`
+	BytesBefore  int64                 `json:"bytes_before"`
+	BytesAfter   int64                 `json:"bytes_after"`
+	Reclaimed    int64                 `json:"bytes_reclaimed"`
+	DurationMs   float64               `json:"duration_ms"`
+}
+
+// CompactCollection reclaims the space held by collection and refreshes what is
+// derived from its documents:
+//   - documents written before compression was enabled are compressed
+//   - CRDT states of deleted documents are dropped once every replica has them
+//   - indexes are rebuilt from scratch, recomputing their statistics
+//   - with Defragment, the archive file of an archived collection is rewritten
+//
+// Documents are not changed, so the collection stamp and cached reads stay valid.
+// Documents tiered to the object store are left where they are.
+func (db *MultiModelDatabase) CompactCollection(collection string, opts CompactOptions) (*CompactionResult, error) {
+	if err := ValidateCollectionName(collection); err != nil {
+		return nil, err
+	}
+	started := time.Now()
+	result := &CompactionResult{Collection: collection}
+
+	db.docMutex.Lock()
+	found := db.compactDocuments(collection, result)
+	if a := db.archived(collection); a != nil {
+		found = true
+		result.Documents += a.len()
+		result.BytesBefore += int64(a.info.Bytes)
+		if opts.Defragment {
+			if err := db.rewriteArchive(collection, a); err != nil {
+				db.docMutex.Unlock()
+				return nil, err
+			}
+			result.Defragmented = true
+		}
+		result.BytesAfter += int64(db.archived(collection).info.Bytes)
+	}
+	db.docMutex.Unlock()
+	if !found {
+		return nil, fmt.Errorf("collection %s not found", collection)
+	}
+
+	db.indexes.invalidate(collection)
+	result.Indexes = make(map[string]IndexStats)
+	for _, spec := range db.ListIndexes(collection) {
+		if index := db.indexes.get(collection, spec.Field); index != nil {
+			_, result.Indexes[spec.Field] = index.ids(db, nil)
+		}
+	}
+
+	result.Reclaimed = result.BytesBefore - result.BytesAfter
+	result.DurationMs = float64(time.Since(started).Microseconds()) / 1000
+	return result, nil
+}
+
+// compactDocuments compresses the in-memory documents of collection and drops its
+// CRDT tombstones, reporting whether the collection holds any document or state.
+// Callers must hold the docMutex write lock.
+func (db *MultiModelDatabase) compactDocuments(collection string, result *CompactionResult) bool {
+	prefix := collection + "."
+	found := false
+	for key, doc := range db.documents {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		found = true
+		result.Documents++
+		before := storedBytes(doc)
+		result.BytesBefore += before
+		if compressed := db.compressDocument(doc); storedBytes(compressed) < before {
+			db.documents[key] = compressed
+			result.Compressed++
+			doc = compressed
+		}
+		result.BytesAfter += storedBytes(doc)
+	}
+	for key := range db.coldDocs {
+		found = found || strings.HasPrefix(key, prefix)
+	}
+
+	db.crdt.pendingMutex.Lock()
+	defer db.crdt.pendingMutex.Unlock()
+	for key, state := range db.crdt.states {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		found = true
+		// A replica that missed the delete could otherwise bring the document back
+		if state.live() || len(db.crdt.pending[key]) > 0 {
+			continue
+		}
+		encoded, _ := json.Marshal(state)
+		result.BytesBefore += int64(len(encoded))
+		delete(db.crdt.states, key)
+		result.Tombstones++
+	}
+	return found
+}
+
+// rewriteArchive writes the documents of an archive to a new file and maps it in
+// place of the old one. Callers must hold the docMutex write lock.
+func (db *MultiModelDatabase) rewriteArchive(collection string, a *archive) error {
+	docs := make(map[string]Document, a.len())
+	if err := a.each(func(id string, doc Document) bool {
+		docs[id] = doc
+		return true
+	}); err != nil {
+		return err
+	}
+	if err := writeArchive(a.path, docs); err != nil {
+		return fmt.Errorf("failed to rewrite archive of %s: %w", collection, err)
+	}
+	rewritten, err := openArchive(a.path)
+	if err != nil {
+		return err // the old mapping stays valid and keeps serving reads
+	}
+	db.archives[collection] = rewritten
+	if err := a.close(); err != nil {
+		log.Printf("Failed to unmap archive of %s: %v", collection, err)
+	}
+	return nil
+}
+
+// storedBytes estimates the memory held by a stored document: its keys and the JSON
+// size of its values, compressed strings counting their compressed bytes
+func storedBytes(doc Document) int64 {
+	var size int64
+	for key, value := range doc {
+		size += int64(len(key))
+		if cs, compressed := value.(*compressedString); compressed {
+			size += int64(len(cs.data))
+			continue
+		}
+		encoded, _ := json.Marshal(value)
+		size += int64(len(encoded))
+	}
+	return size
+}
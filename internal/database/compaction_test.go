@@ -0,0 +1,77 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompactCollection(t *testing.T) {
+	db := newTestDatabase(t)
+	body := strings.Repeat("compaction reclaims space ", 20)
+	for _, id := range []string{"a", "b", "c"} {
+		if err := db.InsertDocument("pages", id, Document{"body": body, "lang": "en"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.CreateIndex(IndexSpec{Collection: "pages", Field: "lang"}); err != nil {
+		t.Fatal(err)
+	}
+	stamp := db.CollectionStamp("pages")
+
+	// Documents written before compression was enabled are compressed by compaction
+	db.enableDocumentCompression("gzip", 64)
+	result, err := db.CompactCollection("pages", CompactOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Documents != 3 || result.Compressed != 3 || result.Reclaimed <= 0 || result.BytesAfter >= result.BytesBefore {
+		t.Fatalf("result = %+v", result)
+	}
+	if stats := result.Indexes["lang"]; stats.Documents != 3 || stats.Cardinality != 1 {
+		t.Fatalf("index stats = %+v", stats)
+	}
+	if doc, _ := db.GetDocument("pages", "b"); doc["body"] != body {
+		t.Fatalf("document changed: %v", doc)
+	}
+	if db.CollectionStamp("pages") != stamp {
+		t.Fatal("compaction changed the collection stamp")
+	}
+	if again, _ := db.CompactCollection("pages", CompactOptions{}); again.Compressed != 0 || again.Reclaimed != 0 {
+		t.Fatalf("second compaction = %+v", again)
+	}
+
+	// Deleted CRDT documents leave tombstones until compacted
+	if err := db.SetCollectionConsistency("carts", ConsistencyCRDT); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"kept", "gone"} {
+		if err := db.InsertDocument("carts", id, Document{"items": []interface{}{"x"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.DeleteDocument("carts", "gone"); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := db.CompactCollection("carts", CompactOptions{}); err != nil || result.Tombstones != 1 || result.Documents != 1 {
+		t.Fatalf("carts: %+v, %v", result, err)
+	}
+	if err := db.InsertDocument("carts", "gone", Document{"items": []interface{}{"y"}}); err != nil {
+		t.Fatalf("insert after dropping the tombstone: %v", err)
+	}
+
+	// Archive files are rewritten on request
+	if _, err := db.ArchiveCollection("pages"); err != nil {
+		t.Fatal(err)
+	}
+	result, err = db.CompactCollection("pages", CompactOptions{Defragment: true})
+	if err != nil || !result.Defragmented || result.Documents != 3 {
+		t.Fatalf("archive: %+v, %v", result, err)
+	}
+	if doc, err := db.GetDocument("pages", "c"); err != nil || doc["body"] != body {
+		t.Fatalf("archived document after defragmenting: %v, %v", doc, err)
+	}
+
+	if _, err := db.CompactCollection("missing", CompactOptions{}); err == nil {
+		t.Fatal("compacted a missing collection")
+	}
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// DefaultCompressionThreshold is the encoded size in bytes below which values are
+// stored uncompressed, since small values rarely shrink enough to pay for the CPU
+const DefaultCompressionThreshold = 256
+
+// valueCodec compresses and decompresses encoded cell values
+type valueCodec interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// valueCodecs holds the codecs that can be selected by name. Only standard library
+// codecs are registered so the engine builds without extra dependencies; snappy or
+// zstd can be added here by registering another valueCodec.
+var valueCodecs = map[string]valueCodec{
+	"gzip":  gzipCodec{},
+	"flate": flateCodec{},
+}
+
+// compressedValue is a cell value held in compressed form
+type compressedValue struct {
+	codec string
+	data  []byte
+}
+
+// IsSupportedCompression reports whether name is a registered codec ("" means none)
+func IsSupportedCompression(name string) bool {
+	if name == "" {
+		return true
+	}
+	_, ok := valueCodecs[name]
+	return ok
+}
+
+// compressValue encodes value with the named codec when its JSON form is at least
+// threshold bytes and compression actually saves space; otherwise value is returned as is
+func compressValue(codecName string, threshold int, value interface{}) (interface{}, error) {
+	if codecName == "" {
+		return value, nil
+	}
+	codec, ok := valueCodecs[codecName]
+	if !ok {
+		return nil, fmt.Errorf("unsupported compression codec %s", codecName)
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode value for compression: %w", err)
+	}
+	if len(encoded) < threshold {
+		return value, nil
+	}
+
+	compressed, err := codec.Compress(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress value with %s: %w", codecName, err)
+	}
+	if len(compressed) >= len(encoded) {
+		return value, nil
+	}
+
+	return &compressedValue{codec: codecName, data: compressed}, nil
+}
+
+// decompressValue returns the plain form of a possibly compressed value
+func decompressValue(value interface{}) (interface{}, error) {
+	cv, ok := value.(*compressedValue)
+	if !ok {
+		return value, nil
+	}
+
+	codec, ok := valueCodecs[cv.codec]
+	if !ok {
+		return nil, fmt.Errorf("unsupported compression codec %s", cv.codec)
+	}
+
+	encoded, err := codec.Decompress(cv.data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress value with %s: %w", cv.codec, err)
+	}
+
+	var decoded interface{}
+	if err := DecodeJSON(encoded, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to decode decompressed value: %w", err)
+	}
+	return decoded, nil
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) Decompress(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+type flateCodec struct{}
+
+func (flateCodec) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (flateCodec) Decompress(data []byte) ([]byte, error) {
+	zr := flate.NewReader(bytes.NewReader(data))
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
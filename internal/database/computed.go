@@ -0,0 +1,141 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ComputedField derives a document field from an expression over the other fields,
+// as in total = price * qty. Stored fields are evaluated on every write and saved
+// with the document, so they can be indexed and filtered like any field. Virtual
+// fields are evaluated on every read instead, for documents returned by gets and
+// queries, whose filters see them too.
+type ComputedField struct {
+	Collection string `json:"collection"`
+	Name       string `json:"name"`       // a key or a dot path
+	Expression string `json:"expression"` // see Expression
+	Stored     bool   `json:"stored"`
+
+	expr *Expression
+}
+
+// computedSet holds the computed fields of the document store, in definition
+// order per collection so that fields may use the ones defined before them
+type computedSet struct {
+	fields map[string][]*ComputedField
+	mutex  sync.RWMutex
+}
+
+func newComputedSet() *computedSet {
+	return &computedSet{fields: make(map[string][]*ComputedField)}
+}
+
+// get returns the stored or the virtual computed fields of collection
+func (s *computedSet) get(collection string, stored bool) []*ComputedField {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var fields []*ComputedField
+	for _, field := range s.fields[collection] {
+		if field.Stored == stored {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// DefineComputedField adds a computed field, replacing any of the same name. The
+// values of a stored field are computed for the documents already in the collection.
+func (db *MultiModelDatabase) DefineComputedField(field ComputedField) error {
+	if err := ValidateCollectionName(field.Collection); err != nil {
+		return err
+	}
+	if field.Name == "" || field.Name == IDField {
+		return fmt.Errorf("computed field name %q is not allowed", field.Name)
+	}
+	expr, err := ParseExpression(field.Expression)
+	if err != nil {
+		return err
+	}
+	for _, used := range expr.Fields() {
+		if used == field.Name || strings.HasPrefix(used, field.Name+".") {
+			return fmt.Errorf("computed field %s must not use itself", field.Name)
+		}
+	}
+	if !field.Stored && db.indexes.get(field.Collection, field.Name) != nil {
+		return fmt.Errorf("field %s is indexed, so it must be stored", field.Name)
+	}
+	field.expr = expr
+
+	db.computed.mutex.Lock()
+	fields := db.computed.fields[field.Collection]
+	replaced := false
+	for i, existing := range fields {
+		if existing.Name == field.Name {
+			fields[i] = &field
+			replaced = true
+		}
+	}
+	if !replaced {
+		db.computed.fields[field.Collection] = append(fields, &field)
+	}
+	db.computed.mutex.Unlock()
+
+	if field.Stored {
+		db.docMutex.Lock()
+		prefix := field.Collection + "."
+		for key, doc := range db.documents {
+			if strings.HasPrefix(key, prefix) {
+				db.documents[key] = db.prepareDocument(field.Collection, doc)
+			}
+		}
+		db.touchCollection(field.Collection)
+		db.docMutex.Unlock()
+	}
+	return nil
+}
+
+// DropComputedField removes a computed field. Values already saved for a stored
+// field stay in the documents until overwritten.
+func (db *MultiModelDatabase) DropComputedField(collection, name string) error {
+	db.computed.mutex.Lock()
+	defer db.computed.mutex.Unlock()
+
+	fields := db.computed.fields[collection]
+	for i, field := range fields {
+		if field.Name == name {
+			db.computed.fields[collection] = append(fields[:i:i], fields[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("computed field %s not found in collection %s", name, collection)
+}
+
+// ComputedFields returns the computed fields of collection in definition order
+func (db *MultiModelDatabase) ComputedFields(collection string) []ComputedField {
+	db.computed.mutex.RLock()
+	defer db.computed.mutex.RUnlock()
+
+	fields := make([]ComputedField, 0, len(db.computed.fields[collection]))
+	for _, field := range db.computed.fields[collection] {
+		fields = append(fields, *field)
+	}
+	return fields
+}
+
+// computeFields returns a copy of doc holding the values of fields, or doc itself
+// when there are none. Fields whose path cannot be set are left out.
+func computeFields(doc Document, fields []*ComputedField) Document {
+	if len(fields) == 0 || doc == nil {
+		return doc
+	}
+	computed := make(Document, len(doc)+len(fields))
+	for k, v := range doc {
+		computed[k] = v
+	}
+	for _, field := range fields {
+		_ = setPath(computed, field.Name, field.expr.Evaluate(computed))
+	}
+	return computed
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"net/url"
+	"testing"
+)
+
+func TestExpressions(t *testing.T) {
+	doc := Document{
+		"price": float64(2.5), "qty": 4, "first": "Ann", "last": "Lee",
+		"address": map[string]interface{}{"city": "Oslo"},
+		"scores":  []interface{}{float64(3), float64(9), float64(6)},
+	}
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{"price * qty", float64(10)},
+		{"price * qty + 1", float64(11)},
+		{"price * (qty + 1)", float64(12.5)},
+		{"-price + 3", float64(0.5)},
+		{"qty % 3", float64(1)},
+		{"qty / 0", nil},
+		{"missing * 2", nil},
+		{"first + ' ' + last", "Ann Lee"},
+		{`concat(upper(first), "-", qty)`, "ANN-4"},
+		{"lower(address.city)", "oslo"},
+		{"len(scores)", float64(3)},
+		{"sum(scores)", float64(18)},
+		{"max(scores)", float64(9)},
+		{"min(qty, price)", float64(2.5)},
+		{"round(price / 3, 2)", float64(0.83)},
+		{"coalesce(nickname, first)", "Ann"},
+		{"first * 2", nil},
+		{"true", true},
+	}
+	for _, tt := range tests {
+		expr, err := ParseExpression(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.expr, err)
+		}
+		if got := expr.Evaluate(doc); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, invalid := range []string{"", "price *", "(price", "nope(1)", "'open", "price qty", "round(1,"} {
+		if _, err := ParseExpression(invalid); err == nil {
+			t.Errorf("%q parsed", invalid)
+		}
+	}
+}
+
+func TestComputedFields(t *testing.T) {
+	db := newTestDatabase(t)
+	if err := db.InsertDocument("orders", "o1", Document{"price": float64(3), "qty": float64(2)}); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := ComputedField{Collection: "orders", Name: "total", Expression: "price * qty", Stored: true}
+	if err := db.DefineComputedField(stored); err != nil {
+		t.Fatal(err)
+	}
+	virtual := ComputedField{Collection: "orders", Name: "summary.label", Expression: "concat('total ', total)"}
+	if err := db.DefineComputedField(virtual); err != nil {
+		t.Fatal(err)
+	}
+
+	label := func(doc Document) interface{} {
+		value, _ := lookupPath(doc, "summary.label")
+		return value
+	}
+
+	// Existing documents receive stored fields, writes recompute them
+	doc, err := db.GetDocument("orders", "o1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc["total"] != float64(6) || label(doc) != "total 6" {
+		t.Fatalf("computed document = %v", doc)
+	}
+	if err := db.InsertDocument("orders", "o2", Document{"price": float64(5), "qty": float64(3)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateDocument("orders", "o1", Document{"qty": float64(10)}); err != nil {
+		t.Fatal(err)
+	}
+	db.docMutex.RLock()
+	raw := db.documents["orders.o1"]
+	db.docMutex.RUnlock()
+	if raw["total"] != float64(30) {
+		t.Fatalf("stored total after update = %v", raw["total"])
+	}
+	if _, saved := raw["summary"]; saved {
+		t.Fatal("virtual field was stored")
+	}
+
+	// Stored fields are indexed, virtual ones are filtered on reads
+	if err := db.CreateIndex(IndexSpec{Collection: "orders", Field: "total"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateIndex(IndexSpec{Collection: "orders", Field: "summary.label"}); err == nil {
+		t.Fatal("virtual field indexed")
+	}
+	for raw, want := range map[string]string{"total=15": "total 15", "summary.label=total 30": "total 30"} {
+		query, _ := url.ParseQuery(raw)
+		q, err := ParseDocumentQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs, err := db.FindDocuments(context.Background(), "orders", q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(docs) != 1 || label(docs[0]) != want {
+			t.Errorf("%s found %v", raw, docs)
+		}
+	}
+
+	for _, invalid := range []ComputedField{
+		{Collection: "orders", Name: "total", Expression: "total + 1", Stored: true},
+		{Collection: "orders", Name: "x", Expression: "price *"},
+		{Collection: "orders", Name: IDField, Expression: "1"},
+	} {
+		if err := db.DefineComputedField(invalid); err == nil {
+			t.Errorf("%+v defined", invalid)
+		}
+	}
+
+	if err := db.DropComputedField("orders", "summary.label"); err != nil {
+		t.Fatal(err)
+	}
+	if fields := db.ComputedFields("orders"); len(fields) != 1 || fields[0].Name != "total" {
+		t.Fatalf("computed fields after drop = %+v", fields)
+	}
+	if err := db.DropComputedField("orders", "summary.label"); err == nil {
+		t.Fatal("dropped a missing computed field")
+	}
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errConditionNotMet stops a conditional write whose document does not match
+var errConditionNotMet = errors.New("condition not met")
+
+// documentMatches reports whether a stored document of collection matches condition,
+// as FindDocuments would match it against a filter. A nil condition always matches.
+// The caller holds docMutex.
+func (db *MultiModelDatabase) documentMatches(collection string, doc Document, condition map[string]interface{}) bool {
+	if condition == nil {
+		return true
+	}
+	doc = computeFields(db.expandDocument(doc), db.computed.get(collection, false))
+	return Collation{}.objectMatches(doc, condition)
+}
+
+// UpdateDocumentIf applies updates as UpdateDocument does, but only to a document
+// matching condition, a filter such as {"status": "pending"}. The condition is
+// evaluated and the update applied under the same lock, so no other write can come
+// in between, which makes it suitable for state transitions. It reports whether the
+// condition matched; a missing document is an error.
+func (db *MultiModelDatabase) UpdateDocumentIf(collection, id string, condition map[string]interface{}, updates Document) (bool, error) {
+	event := &WriteEvent{Model: ModelDocument, Namespace: collection, Key: id, Value: updates}
+	err := db.withWriteHooks(OpUpdate, event, func() error {
+		return db.updateDocument(collection, id, condition, updates)
+	})
+	return conditionResult(err)
+}
+
+// DeleteDocumentIf deletes a document only when it matches condition, atomically as
+// UpdateDocumentIf updates one, and reports whether the condition matched
+func (db *MultiModelDatabase) DeleteDocumentIf(collection, id string, condition map[string]interface{}) (bool, error) {
+	event := &WriteEvent{Model: ModelDocument, Namespace: collection, Key: id}
+	err := db.withWriteHooks(OpDelete, event, func() error {
+		return db.deleteDocument(collection, id, condition)
+	})
+	return conditionResult(err)
+}
+
+func conditionResult(err error) (bool, error) {
+	if errors.Is(err, errConditionNotMet) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// FindAndModify applies updates as UpdateDocumentIf does and returns the document as
+// it was before the update, or after it when returnNew is set, both read under the
+// lock of the write. It reports whether condition matched; when it did not, no
+// document is returned. CRDT collections merge writes from every replica,
+// so they have no single previous version to return.
+func (db *MultiModelDatabase) FindAndModify(collection, id string, condition map[string]interface{}, updates Document, returnNew bool) (Document, bool, error) {
+	if db.crdt.enabled(collection) {
+		return nil, false, fmt.Errorf("find-and-modify is not supported on CRDT collection %s", collection)
+	}
+
+	var previous, updated Document
+	event := &WriteEvent{Model: ModelDocument, Namespace: collection, Key: id, Value: updates}
+	err := db.withWriteHooks(OpUpdate, event, func() error {
+		var err error
+		previous, updated, err = db.modifyDocument(collection, id, condition, updates)
+		return err
+	})
+	if matched, err := conditionResult(err); !matched {
+		return nil, false, err
+	}
+
+	// Stored documents are never changed in place, so they can be read without the lock
+	doc := previous
+	if returnNew {
+		doc = updated
+	}
+	return computeFields(db.expandDocument(doc), db.computed.get(collection, false)), true, nil
+}
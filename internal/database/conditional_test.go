@@ -0,0 +1,99 @@
+package database
+
+import (
+	"encoding/json"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestConditionalWrites(t *testing.T) {
+	db := newTestDatabase(t)
+	if err := db.InsertDocument("jobs", "j1", Document{"status": "pending", "attempts": json.Number("0")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Of concurrent claims, exactly one finds the job pending
+	var claimed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			matched, err := db.UpdateDocumentIf("jobs", "j1", map[string]interface{}{"status": "pending"}, Document{"status": "running"})
+			if err != nil {
+				t.Error(err)
+			}
+			if matched {
+				atomic.AddInt32(&claimed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if claimed != 1 {
+		t.Fatalf("%d claims succeeded", claimed)
+	}
+
+	// Conditions take the operators of query filters
+	for _, test := range []struct {
+		query   url.Values
+		matches bool
+	}{
+		{url.Values{"status:startsWith": {"pend"}}, false},
+		{url.Values{"status:startsWith": {"run"}, "attempts:int": {"0"}}, true},
+	} {
+		condition, err := ParseQueryFilters(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matched, err := db.UpdateDocumentIf("jobs", "j1", condition, Document{"attempts": json.Number("1")})
+		if err != nil || matched != test.matches {
+			t.Fatalf("%v matched %v, %v", test.query, matched, err)
+		}
+	}
+	if doc, _ := db.GetDocument("jobs", "j1"); doc["status"] != "running" || doc["attempts"] != json.Number("1") {
+		t.Fatalf("document after conditional updates: %v", doc)
+	}
+
+	if matched, err := db.DeleteDocumentIf("jobs", "j1", map[string]interface{}{"status": "pending"}); err != nil || matched {
+		t.Fatalf("delete matched %v, %v", matched, err)
+	}
+	if matched, err := db.DeleteDocumentIf("jobs", "j1", map[string]interface{}{"status": "running"}); err != nil || !matched {
+		t.Fatalf("delete matched %v, %v", matched, err)
+	}
+	if _, err := db.GetDocument("jobs", "j1"); err == nil {
+		t.Fatal("document not deleted")
+	}
+	if _, err := db.UpdateDocumentIf("jobs", "j1", map[string]interface{}{"status": "running"}, Document{}); err == nil {
+		t.Fatal("conditional update of a missing document succeeded")
+	}
+}
+
+func TestFindAndModify(t *testing.T) {
+	db := newTestDatabase(t)
+	if err := db.InsertDocument("items", "i1", Document{"name": "lamp", "stock": json.Number("5")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DefineComputedField(ComputedField{Collection: "items", Name: "label", Expression: "upper(name)"}); err != nil {
+		t.Fatal(err)
+	}
+
+	previous, matched, err := db.FindAndModify("items", "i1", map[string]interface{}{"stock": json.Number("5")}, Document{"stock": json.Number("4")}, false)
+	if err != nil || !matched || previous["stock"] != json.Number("5") || previous["label"] != "LAMP" {
+		t.Fatalf("previous = %v, matched %v, %v", previous, matched, err)
+	}
+	updated, matched, err := db.FindAndModify("items", "i1", nil, Document{"name": "desk lamp"}, true)
+	if err != nil || !matched || updated["stock"] != json.Number("4") || updated["label"] != "DESK LAMP" {
+		t.Fatalf("updated = %v, matched %v, %v", updated, matched, err)
+	}
+
+	// A stale condition changes nothing
+	doc, matched, err := db.FindAndModify("items", "i1", map[string]interface{}{"stock": json.Number("5")}, Document{"stock": json.Number("3")}, true)
+	if err != nil || matched || doc != nil {
+		t.Fatalf("stale condition returned %v, matched %v, %v", doc, matched, err)
+	}
+	if current, _ := db.GetDocument("items", "i1"); current["stock"] != json.Number("4") {
+		t.Fatalf("stale condition applied: %v", current)
+	}
+}
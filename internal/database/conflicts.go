@@ -0,0 +1,59 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrDocumentExists is returned when inserting a document under a taken id
+var ErrDocumentExists = errors.New("document already exists")
+
+// Conflict is an operation of a batch that was not applied because the stored item
+// is not in the state the client expected, typically because it changed since the
+// client read it. Clients resolve it from the current state and retry only the
+// conflicting operations.
+type Conflict struct {
+	Index    int    `json:"index"`              // of the operation in the batch
+	Key      string `json:"key"`                // key or document id
+	Field    string `json:"field,omitempty"`    // document field holding the conflicting value
+	Expected *int64 `json:"expected,omitempty"` // revision the operation expected
+	Revision int64  `json:"revision"`           // current revision, 0 when the item does not exist
+	Reason   string `json:"reason"`
+}
+
+// ConflictError fails a batch applied all or nothing, listing every conflicting
+// operation rather than only the first
+type ConflictError struct {
+	Conflicts []Conflict
+}
+
+func (e *ConflictError) Error() string {
+	first := e.Conflicts[0]
+	if len(e.Conflicts) == 1 {
+		return fmt.Sprintf("operation %d conflicts: %s", first.Index, first.Reason)
+	}
+	return fmt.Sprintf("%d operations conflict, first %d: %s", len(e.Conflicts), first.Index, first.Reason)
+}
+
+// revisionConflict reports a pair of an optimistic multi-set whose key is at current
+// rather than the expected revision
+func revisionConflict(index int, key string, expected *int64, current int64) Conflict {
+	reason := fmt.Sprintf("key %s is at revision %d, not %d", key, current, *expected)
+	switch {
+	case current == 0:
+		reason = fmt.Sprintf("key %s does not exist", key)
+	case *expected == 0:
+		reason = fmt.Sprintf("key %s already exists", key)
+	}
+	return Conflict{Index: index, Key: key, Expected: expected, Revision: current, Reason: reason}
+}
+
+// documentConflict reports an insert of a document whose id is taken
+func documentConflict(index int, collection, id string) Conflict {
+	return Conflict{
+		Index:  index,
+		Key:    id,
+		Field:  IDField,
+		Reason: fmt.Sprintf("document with id %s already exists in collection %s", id, collection),
+	}
+}
@@ -0,0 +1,42 @@
+package database
+
+import "testing"
+
+func TestOptimisticMultiSetSkipsConflicts(t *testing.T) {
+	db := newTestDatabase(t)
+	if err := db.MultiSetBucketValues("stock", []KeyValue{{Key: "a", Value: 1}, {Key: "b", Value: 1}}, 0); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := db.GetBucketItem("stock", "a")
+	b, _ := db.GetBucketItem("stock", "b")
+	if err := db.SetBucketValue("stock", "b", 2, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	stale, absent := b.Revision, int64(0)
+	pairs := []KeyValue{{Key: "a", Value: 10}, {Key: "b", Value: 10}, {Key: "c", Value: 10}, {Key: "a", Value: 11}}
+	conflicts, err := db.MultiSetBucketValuesIf("stock", pairs, []*int64{&a.Revision, &stale, &absent, nil}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 {
+		t.Fatalf("conflicts = %+v", conflicts)
+	}
+	current, _ := db.GetBucketItem("stock", "b")
+	if got := conflicts[0]; got.Index != 1 || got.Key != "b" || *got.Expected != stale || got.Revision != current.Revision {
+		t.Fatalf("conflict = %+v, current revision %d", got, current.Revision)
+	}
+
+	// The other pairs are written, the unconditional one after the checked one
+	for key, want := range map[string]interface{}{"a": 11, "b": 2, "c": 10} {
+		if value, _ := db.GetBucketValue("stock", key); value != want {
+			t.Errorf("%s = %v, want %v", key, value, want)
+		}
+	}
+
+	// Creating a key that exists by now conflicts too
+	conflicts, _ = db.MultiSetBucketValuesIf("stock", []KeyValue{{Key: "c", Value: 0}}, []*int64{&absent}, 0)
+	if len(conflicts) != 1 || conflicts[0].Reason != "key c already exists" {
+		t.Fatalf("conflicts = %+v", conflicts)
+	}
+}
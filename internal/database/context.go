@@ -0,0 +1,26 @@
+package database
+
+import "context"
+
+// cancelCheckInterval is how many elements a scan visits between context checks
+const cancelCheckInterval = 256
+
+// cancelCheck lets loops over a store stop once ctx is done, so abandoned requests
+// release their locks early. Document queries and joins, column scans, key listings,
+// search, export, schema inference and the collection scans behind projections and
+// references check it; graph reads, index builds, imports and collection transfers
+// run to completion. ctx.Err is only consulted every cancelCheckInterval steps to
+// keep the common path cheap.
+type cancelCheck struct {
+	ctx   context.Context
+	steps int
+}
+
+// err returns ctx's error if it is done, checking at most every cancelCheckInterval steps
+func (c *cancelCheck) err() error {
+	c.steps++
+	if c.steps%cancelCheckInterval != 0 {
+		return nil
+	}
+	return c.ctx.Err()
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestCancelledContextStopsScans(t *testing.T) {
+	db := newTestDatabase(t)
+	for i := 0; i < 2*cancelCheckInterval; i++ {
+		if err := db.CreateNode(fmt.Sprint("n", i), []string{"item"}, map[string]interface{}{"name": "item"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.InsertDocument("items", fmt.Sprint(i), Document{"name": "item"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.SetBucketValue("items", fmt.Sprint(i), "item", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := db.Search(ctx, "nothing matches", 10); err != context.Canceled {
+		t.Fatalf("search = %v, want %v", err, context.Canceled)
+	}
+	if _, err := db.ExportCollection(ctx, "items"); err != context.Canceled {
+		t.Fatalf("export = %v, want %v", err, context.Canceled)
+	}
+	if _, err := db.ListBucketKeysContext(ctx, "items", ""); err != context.Canceled {
+		t.Fatalf("key listing = %v, want %v", err, context.Canceled)
+	}
+
+	// The search of the graph checks the context too, with no other model to scan
+	graphOnly := newTestDatabase(t)
+	for i := 0; i < 2*cancelCheckInterval; i++ {
+		if err := graphOnly.CreateNode(fmt.Sprint("n", i), nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := graphOnly.Search(ctx, "nothing matches", 10); err != context.Canceled {
+		t.Fatalf("search over nodes = %v, want %v", err, context.Canceled)
+	}
+	if _, err := graphOnly.Search(context.Background(), "nothing matches", 10); err != nil {
+		t.Fatalf("search with a live context: %v", err)
+	}
+}
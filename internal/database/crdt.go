@@ -0,0 +1,521 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Consistency modes of document collections
+const (
+	ConsistencyStrong = "strong" // writes apply to this node's copy only
+	ConsistencyCRDT   = "crdt"   // multi-master writes that merge without coordination
+)
+
+// crdtSyncInterval is how often pushes that did not reach a replica are retried
+const crdtSyncInterval = 5 * time.Second
+
+// crdtStamp orders writes: the later clock reading wins and the node ID breaks ties,
+// so every replica picks the same winner
+type crdtStamp struct {
+	Time Timestamp `json:"t"`
+	Node string    `json:"n"`
+}
+
+func (s crdtStamp) after(other crdtStamp) bool {
+	if s.Time != other.Time {
+		return other.Time.Less(s.Time)
+	}
+	return s.Node > other.Node
+}
+
+// crdtState is the replicated state of a document in a CRDT collection. The
+// document exists while one of the tags added by inserts and updates has not been
+// removed by a delete that observed it, so an update concurrent with a delete keeps
+// the document. Each field is a last-writer-wins register; array fields are
+// observed-remove sets, so concurrent additions to an array are all kept.
+type crdtState struct {
+	Tags    map[string]bool       `json:"tags"`
+	Removed map[string]bool       `json:"removed"`
+	Fields  map[string]*crdtField `json:"fields"`
+}
+
+type crdtField struct {
+	Stamp   crdtStamp   `json:"stamp"`
+	Deleted bool        `json:"deleted,omitempty"`
+	Value   interface{} `json:"value,omitempty"`
+	Set     *orSet      `json:"set,omitempty"` // array values
+}
+
+// orSet is an observed-remove set. Every addition gets a unique tag; removals
+// tombstone the tags they observed, so an element added concurrently survives.
+type orSet struct {
+	Elements map[string]orElement `json:"elements"` // tag -> element
+	Removed  map[string]bool      `json:"removed"`
+}
+
+type orElement struct {
+	Value interface{} `json:"value"`
+	Stamp crdtStamp   `json:"stamp"`
+}
+
+func newCRDTState() *crdtState {
+	return &crdtState{Tags: make(map[string]bool), Removed: make(map[string]bool), Fields: make(map[string]*crdtField)}
+}
+
+func newORSet() *orSet {
+	return &orSet{Elements: make(map[string]orElement), Removed: make(map[string]bool)}
+}
+
+func (s *crdtState) live() bool {
+	for tag := range s.Tags {
+		if !s.Removed[tag] {
+			return true
+		}
+	}
+	return false
+}
+
+// document materializes the state, nil when the document is deleted
+func (s *crdtState) document() Document {
+	if !s.live() {
+		return nil
+	}
+	doc := make(Document, len(s.Fields))
+	for name, field := range s.Fields {
+		if field.Deleted {
+			continue
+		}
+		if field.Set != nil {
+			doc[name] = field.Set.values()
+		} else {
+			doc[name] = field.Value
+		}
+	}
+	return doc
+}
+
+// mergeCRDTStates returns the join of a and b. It is commutative, associative and
+// idempotent, so replicas receiving the same states in any order converge.
+func mergeCRDTStates(a, b *crdtState) *crdtState {
+	merged := newCRDTState()
+	for _, state := range []*crdtState{a, b} {
+		for tag := range state.Tags {
+			merged.Tags[tag] = true
+		}
+		for tag := range state.Removed {
+			merged.Removed[tag] = true
+		}
+		for name, field := range state.Fields {
+			merged.Fields[name] = mergeCRDTFields(merged.Fields[name], field)
+		}
+	}
+	return merged
+}
+
+func mergeCRDTFields(a, b *crdtField) *crdtField {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if a.Set != nil && b.Set != nil && !a.Deleted && !b.Deleted {
+		stamp := a.Stamp
+		if b.Stamp.after(stamp) {
+			stamp = b.Stamp
+		}
+		return &crdtField{Stamp: stamp, Set: mergeORSets(a.Set, b.Set)}
+	}
+	if b.Stamp.after(a.Stamp) {
+		return b
+	}
+	return a
+}
+
+func mergeORSets(a, b *orSet) *orSet {
+	merged := newORSet()
+	for _, set := range []*orSet{a, b} {
+		for tag, element := range set.Elements {
+			merged.Elements[tag] = element
+		}
+		for tag := range set.Removed {
+			merged.Removed[tag] = true
+		}
+	}
+	return merged
+}
+
+// values returns the live elements of the set, distinct and in order of addition
+func (s *orSet) values() []interface{} {
+	type entry struct {
+		key     string
+		element orElement
+	}
+	first := make(map[string]entry)
+	for tag, element := range s.Elements {
+		if s.Removed[tag] {
+			continue
+		}
+		key := crdtElementKey(element.Value)
+		if existing, seen := first[key]; !seen || existing.element.Stamp.after(element.Stamp) {
+			first[key] = entry{key, element}
+		}
+	}
+	entries := make([]entry, 0, len(first))
+	for _, e := range first {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].element.Stamp != entries[j].element.Stamp {
+			return entries[j].element.Stamp.after(entries[i].element.Stamp)
+		}
+		return entries[i].key < entries[j].key
+	})
+	values := make([]interface{}, len(entries))
+	for i, e := range entries {
+		values[i] = e.element.Value
+	}
+	return values
+}
+
+// crdtElementKey identifies equal set elements by their canonical JSON encoding
+func crdtElementKey(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+// crdtStore holds the consistency mode of collections and the state of documents in
+// CRDT collections. States are guarded by the docMutex, like the documents they
+// materialize into.
+type crdtStore struct {
+	collections map[string]bool // collections in CRDT mode
+	modeMutex   sync.RWMutex
+
+	states       map[string]*crdtState      // collection.id -> state
+	pending      map[string]map[string]bool // collection.id -> replicas that missed the latest state
+	pendingMutex sync.Mutex
+}
+
+func newCRDTStore(collections string) *crdtStore {
+	store := &crdtStore{
+		collections: make(map[string]bool),
+		states:      make(map[string]*crdtState),
+		pending:     make(map[string]map[string]bool),
+	}
+	for _, name := range strings.Split(collections, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			store.collections[name] = true
+		}
+	}
+	return store
+}
+
+func (s *crdtStore) enabled(collection string) bool {
+	s.modeMutex.RLock()
+	defer s.modeMutex.RUnlock()
+	return s.collections[collection]
+}
+
+// CollectionConsistency returns the consistency mode of collection
+func (db *MultiModelDatabase) CollectionConsistency(collection string) string {
+	if db.crdt.enabled(collection) {
+		return ConsistencyCRDT
+	}
+	return ConsistencyStrong
+}
+
+// SetCollectionConsistency switches collection between strong and CRDT mode.
+// Documents already in the collection start their CRDT history on their next
+// write; switching back to strong mode drops the CRDT states.
+func (db *MultiModelDatabase) SetCollectionConsistency(collection, mode string) error {
+	if err := ValidateCollectionName(collection); err != nil {
+		return err
+	}
+	if mode != ConsistencyStrong && mode != ConsistencyCRDT {
+		return fmt.Errorf("unknown consistency mode %q, expected %s or %s", mode, ConsistencyStrong, ConsistencyCRDT)
+	}
+
+	db.crdt.modeMutex.Lock()
+	if mode == ConsistencyCRDT {
+		db.crdt.collections[collection] = true
+	} else {
+		delete(db.crdt.collections, collection)
+	}
+	db.crdt.modeMutex.Unlock()
+
+	if mode == ConsistencyStrong {
+		db.docMutex.Lock()
+		prefix := collection + "."
+		for key := range db.crdt.states {
+			if strings.HasPrefix(key, prefix) {
+				delete(db.crdt.states, key)
+			}
+		}
+		db.docMutex.Unlock()
+	}
+	return nil
+}
+
+// crdtNodeID names this node in stamps and tags
+func (db *MultiModelDatabase) crdtNodeID() string {
+	if db.Cluster != nil {
+		return db.Cluster.Self().ID
+	}
+	return "local"
+}
+
+// nextStamp issues a stamp later than every stamp issued or merged before
+func (db *MultiModelDatabase) nextStamp() crdtStamp {
+	return crdtStamp{Time: db.Clock.Now(), Node: db.crdtNodeID()}
+}
+
+// nextTag returns a tag no other write carries, since clock readings of a node never
+// repeat
+func (db *MultiModelDatabase) nextTag() string {
+	return db.crdtNodeID() + ":" + db.Clock.Now().String()
+}
+
+// crdtStateFor returns the state of key, seeding it from a document written before
+// the collection switched to CRDT mode. Callers must hold the docMutex write lock.
+func (db *MultiModelDatabase) crdtStateFor(key string) *crdtState {
+	if state, exists := db.crdt.states[key]; exists {
+		return state
+	}
+	state := newCRDTState()
+	if doc, exists := db.documents[key]; exists {
+		state.Tags[db.crdtNodeID()+":seed:"+key] = true
+		for name, value := range db.expandDocument(doc) {
+			state.Fields[name] = &crdtField{Value: value} // zero stamp: any write wins
+		}
+	}
+	db.crdt.states[key] = state
+	return state
+}
+
+// writeCRDTDocument applies an insert, update or delete (doc nil) of a document in
+// a CRDT collection and pushes the new state to the document's other replicas
+func (db *MultiModelDatabase) writeCRDTDocument(collection, id string, doc Document, insert bool) error {
+	key := collection + "." + id
+	db.docMutex.Lock()
+	state := db.crdtStateFor(key)
+	switch {
+	case insert && state.live():
+		db.docMutex.Unlock()
+		return fmt.Errorf("%w: %s in collection %s", ErrDocumentExists, id, collection)
+	case !insert && !state.live():
+		db.docMutex.Unlock()
+		return fmt.Errorf("document with id %s not found in collection %s", id, collection)
+	}
+
+	stamp := db.nextStamp()
+	if doc == nil {
+		for tag := range state.Tags {
+			state.Removed[tag] = true
+		}
+		for name := range state.Fields {
+			state.Fields[name] = &crdtField{Stamp: stamp, Deleted: true}
+		}
+	} else {
+		state.Tags[db.nextTag()] = true
+		for name, value := range doc {
+			state.Fields[name] = db.writeCRDTField(state.Fields[name], value, stamp)
+		}
+	}
+	db.materializeCRDT(collection, key, state)
+	pushed := mergeCRDTStates(state, newCRDTState()) // copy sent outside the lock
+	db.docMutex.Unlock()
+
+	db.pushCRDTState(collection, id, pushed)
+	return nil
+}
+
+// writeCRDTField returns the field after setting value. Fields are replaced rather
+// than modified, since copies of the state are encoded outside the lock. Arrays
+// update a copy of the existing set, removing the elements that are no longer listed and adding new ones,
+// so concurrent changes to other elements are kept. Callers must hold the docMutex
+// write lock.
+func (db *MultiModelDatabase) writeCRDTField(field *crdtField, value interface{}, stamp crdtStamp) *crdtField {
+	elements, isArray := value.([]interface{})
+	if !isArray {
+		return &crdtField{Stamp: stamp, Value: value}
+	}
+
+	set := newORSet()
+	if field != nil && field.Set != nil && !field.Deleted {
+		set = mergeORSets(field.Set, newORSet())
+	}
+	wanted := make(map[string]interface{}, len(elements))
+	for _, element := range elements {
+		wanted[crdtElementKey(element)] = element
+	}
+	present := make(map[string]bool)
+	for tag, element := range set.Elements {
+		if set.Removed[tag] {
+			continue
+		}
+		elementKey := crdtElementKey(element.Value)
+		if _, keep := wanted[elementKey]; keep {
+			present[elementKey] = true
+		} else {
+			set.Removed[tag] = true
+		}
+	}
+	for _, element := range elements {
+		elementKey := crdtElementKey(element)
+		if present[elementKey] {
+			continue
+		}
+		present[elementKey] = true
+		set.Elements[db.nextTag()] = orElement{Value: element, Stamp: stamp}
+	}
+	return &crdtField{Stamp: stamp, Set: set}
+}
+
+// materializeCRDT stores the document state represents. Callers must hold the
+// docMutex write lock.
+func (db *MultiModelDatabase) materializeCRDT(collection, key string, state *crdtState) {
+	id := key[len(collection)+1:]
+	doc := state.document()
+	if doc != nil {
+		db.documents[key] = db.prepareDocument(collection, doc)
+	} else {
+		delete(db.documents, key)
+	}
+	db.touchDocuments(collection, id)
+	db.syncLog.note(collection, id, doc == nil)
+}
+
+// MergeCRDTState merges a document state pushed by a peer. A collection receiving
+// its first state from a peer switches to CRDT mode, since replicas in different
+// modes would never converge.
+func (db *MultiModelDatabase) MergeCRDTState(collection, id string, encoded json.RawMessage) error {
+	var remote crdtState
+	if err := json.Unmarshal(encoded, &remote); err != nil {
+		return fmt.Errorf("invalid CRDT state: %w", err)
+	}
+	if remote.Tags == nil || remote.Removed == nil || remote.Fields == nil {
+		return fmt.Errorf("invalid CRDT state for %s.%s", collection, id)
+	}
+	if !db.crdt.enabled(collection) {
+		if err := db.SetCollectionConsistency(collection, ConsistencyCRDT); err != nil {
+			return err
+		}
+		log.Printf("Collection %s switched to CRDT mode by a peer", collection)
+	}
+
+	key := collection + "." + id
+	db.docMutex.Lock()
+	defer db.docMutex.Unlock()
+
+	merged := mergeCRDTStates(db.crdtStateFor(key), &remote)
+	var latest Timestamp
+	for _, field := range remote.Fields {
+		if latest.Less(field.Stamp.Time) {
+			latest = field.Stamp.Time
+		}
+	}
+	if err := db.Clock.Update(latest); err != nil {
+		log.Printf("Not adopting CRDT clock of %s: %v", key, err)
+	}
+	db.crdt.states[key] = merged
+	db.materializeCRDT(collection, key, merged)
+	return nil
+}
+
+// crdtMessage is the body of node to node CRDT pushes
+type crdtMessage struct {
+	Collection string     `json:"collection"`
+	ID         string     `json:"id"`
+	State      *crdtState `json:"state"`
+}
+
+// pushCRDTState sends state to the other replicas of the document, remembering the
+// replicas it did not reach for SyncCRDT
+func (db *MultiModelDatabase) pushCRDTState(collection, id string, state *crdtState) {
+	if db.Cluster == nil {
+		return
+	}
+	key := collection + "." + id
+	self := db.Cluster.Self().ID
+	var replicas []*Node
+	for _, node := range db.Cluster.ReplicaNodes(key) {
+		if node.ID != self {
+			replicas = append(replicas, node)
+		}
+	}
+
+	errs := make([]error, len(replicas))
+	db.eachNode(replicas, func(i int, node *Node, local bool) {
+		errs[i] = db.Cluster.call(node, "/data/crdt", crdtMessage{Collection: collection, ID: id, State: state}, nil)
+	})
+
+	db.crdt.pendingMutex.Lock()
+	defer db.crdt.pendingMutex.Unlock()
+	for i, node := range replicas {
+		if errs[i] == nil {
+			delete(db.crdt.pending[key], node.ID)
+			continue
+		}
+		if db.crdt.pending[key] == nil {
+			db.crdt.pending[key] = make(map[string]bool)
+		}
+		db.crdt.pending[key][node.ID] = true
+	}
+	if len(db.crdt.pending[key]) == 0 {
+		delete(db.crdt.pending, key)
+	}
+}
+
+// SyncCRDT pushes the state of every document whose last push missed a replica
+// again and returns how many documents are still pending
+func (db *MultiModelDatabase) SyncCRDT() int {
+	db.crdt.pendingMutex.Lock()
+	keys := make([]string, 0, len(db.crdt.pending))
+	for key := range db.crdt.pending {
+		keys = append(keys, key)
+	}
+	db.crdt.pendingMutex.Unlock()
+
+	for _, key := range keys {
+		collection, id, _ := strings.Cut(key, ".")
+		db.docMutex.RLock()
+		state, exists := db.crdt.states[key]
+		if exists {
+			state = mergeCRDTStates(state, newCRDTState())
+		}
+		db.docMutex.RUnlock()
+		if exists {
+			db.pushCRDTState(collection, id, state)
+			continue
+		}
+		db.crdt.pendingMutex.Lock()
+		delete(db.crdt.pending, key) // collection left CRDT mode
+		db.crdt.pendingMutex.Unlock()
+	}
+
+	db.crdt.pendingMutex.Lock()
+	defer db.crdt.pendingMutex.Unlock()
+	return len(db.crdt.pending)
+}
+
+func (db *MultiModelDatabase) startCRDTSync() {
+	ticker := time.NewTicker(crdtSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-db.ctx.Done():
+			return
+		case <-ticker.C:
+			db.SyncCRDT()
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// crdtReplica returns a database with collection "carts" in CRDT mode
+func crdtReplica(t *testing.T) *MultiModelDatabase {
+	t.Helper()
+	db := newTestDatabase(t)
+	if err := db.SetCollectionConsistency("carts", ConsistencyCRDT); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// exchange merges the states of carts.id between a and b in both directions
+func exchange(t *testing.T, a, b *MultiModelDatabase, id string) {
+	t.Helper()
+	for _, pair := range [][2]*MultiModelDatabase{{a, b}, {b, a}} {
+		pair[0].docMutex.RLock()
+		encoded, err := json.Marshal(pair[0].crdt.states["carts."+id])
+		pair[0].docMutex.RUnlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pair[1].MergeCRDTState("carts", id, encoded); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCRDTConcurrentWritesConverge(t *testing.T) {
+	a, b := crdtReplica(t), crdtReplica(t)
+	if err := a.InsertDocument("carts", "c1", Document{"owner": "alice", "items": []interface{}{"apple"}}); err != nil {
+		t.Fatal(err)
+	}
+	exchange(t, a, b, "c1")
+
+	// Concurrent edits: both add an item, a removes one, b changes the owner last
+	if err := a.UpdateDocument("carts", "c1", Document{"items": []interface{}{"pear"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.UpdateDocument("carts", "c1", Document{"items": []interface{}{"apple", "plum"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.UpdateDocument("carts", "c1", Document{"owner": "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	exchange(t, a, b, "c1")
+	exchange(t, a, b, "c1") // merging again changes nothing
+
+	docA, errA := a.GetDocument("carts", "c1")
+	docB, errB := b.GetDocument("carts", "c1")
+	if errA != nil || errB != nil || !reflect.DeepEqual(docA, docB) {
+		t.Fatalf("replicas diverged: %v %v (%v, %v)", docA, docB, errA, errB)
+	}
+	if docA["owner"] != "bob" {
+		t.Fatalf("expected the last owner to win, got %v", docA["owner"])
+	}
+	// apple was removed by a, pear and plum were added concurrently
+	if items := docA["items"].([]interface{}); len(items) != 2 || items[0] == "apple" || items[1] == "apple" {
+		t.Fatalf("unexpected items %v", items)
+	}
+}
+
+func TestCRDTUpdateWinsOverConcurrentDelete(t *testing.T) {
+	a, b := crdtReplica(t), crdtReplica(t)
+	if err := a.InsertDocument("carts", "c1", Document{"owner": "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	exchange(t, a, b, "c1")
+
+	if err := a.DeleteDocument("carts", "c1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.UpdateDocument("carts", "c1", Document{"note": "keep"}); err != nil {
+		t.Fatal(err)
+	}
+	exchange(t, a, b, "c1")
+
+	for _, db := range []*MultiModelDatabase{a, b} {
+		doc, err := db.GetDocument("carts", "c1")
+		if err != nil || doc["note"] != "keep" {
+			t.Fatalf("concurrent update lost: %v %v", doc, err)
+		}
+	}
+
+	// A delete that observed every write removes the document everywhere
+	if err := b.DeleteDocument("carts", "c1"); err != nil {
+		t.Fatal(err)
+	}
+	exchange(t, a, b, "c1")
+	if _, err := a.GetDocument("carts", "c1"); err == nil {
+		t.Fatal("deleted document still exists")
+	}
+}
+
+func TestCRDTModeSeedsExistingDocuments(t *testing.T) {
+	db := newTestDatabase(t)
+	if err := db.InsertDocument("carts", "c1", Document{"owner": "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetCollectionConsistency("carts", "eventual"); err == nil {
+		t.Fatal("expected an unknown mode to be rejected")
+	}
+	if err := db.SetCollectionConsistency("carts", ConsistencyCRDT); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertDocument("carts", "c1", Document{}); err == nil {
+		t.Fatal("insert over an existing document succeeded")
+	}
+	if err := db.UpdateDocument("carts", "c1", Document{"tags": []interface{}{"a", "a", "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := db.GetDocument("carts", "c1")
+	if err != nil || doc["owner"] != "alice" || !reflect.DeepEqual(doc["tags"], []interface{}{"a", "b"}) {
+		t.Fatalf("unexpected document %v, %v", doc, err)
+	}
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// DedupStats reports how much space content-hash deduplication saves
+type DedupStats struct {
+	UniqueValues int   `json:"unique_values"`
+	References   int   `json:"references"`
+	StoredBytes  int64 `json:"stored_bytes"`  // size of the unique values
+	LogicalBytes int64 `json:"logical_bytes"` // size without deduplication
+	SavedBytes   int64 `json:"saved_bytes"`
+}
+
+// contentStore holds the values of deduplicating KV buckets once per distinct
+// content, shared across buckets. It is guarded by the KV mutex.
+type contentStore struct {
+	values map[string]*sharedValue
+}
+
+// sharedValue is a stored value referenced by one or more KV entries
+type sharedValue struct {
+	store *contentStore
+	hash  string
+	value interface{}
+	size  int64
+	refs  int
+}
+
+func newContentStore() *contentStore {
+	return &contentStore{values: make(map[string]*sharedValue)}
+}
+
+// intern returns the shared copy of value, adding a reference. Raw values are
+// hashed together with their length-prefixed content type so identical bytes
+// served with different types stay distinct.
+func (s *contentStore) intern(value interface{}, contentType string) (*sharedValue, error) {
+	var encoded []byte
+	if raw, ok := value.([]byte); ok {
+		encoded = raw
+	} else {
+		var err error
+		if encoded, err = json.Marshal(value); err != nil {
+			return nil, fmt.Errorf("failed to encode value for deduplication: %w", err)
+		}
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d:%s", len(contentType), contentType)
+	hash.Write(encoded)
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	shared, exists := s.values[sum]
+	if !exists {
+		shared = &sharedValue{store: s, hash: sum, value: value, size: int64(len(encoded))}
+		s.values[sum] = shared
+	}
+	shared.refs++
+	return shared, nil
+}
+
+// release drops a reference and forgets the value once it is unreferenced
+func (v *sharedValue) release() {
+	v.refs--
+	if v.refs <= 0 {
+		delete(v.store.values, v.hash)
+	}
+}
+
+func (s *contentStore) stats() DedupStats {
+	var stats DedupStats
+	for _, shared := range s.values {
+		stats.UniqueValues++
+		stats.References += shared.refs
+		stats.StoredBytes += shared.size
+		stats.LogicalBytes += shared.size * int64(shared.refs)
+	}
+	stats.SavedBytes = stats.LogicalBytes - stats.StoredBytes
+	return stats
+}
+
+// KVDedupStats returns deduplication statistics for all deduplicating buckets
+func (db *MultiModelDatabase) KVDedupStats() DedupStats {
+	db.kvMutex.RLock()
+	defer db.kvMutex.RUnlock()
+	return db.kvContent.stats()
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKVDedupKeepsDistinctValuesApart(t *testing.T) {
+	db := newTestDatabase(t)
+	for _, bucket := range []string{"a", "b"} {
+		if err := db.SetBucketOptions(bucket, BucketOptions{Dedup: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	puts := []struct {
+		bucket, key string
+		value       interface{}
+		contentType string
+	}{
+		{"a", "json", map[string]interface{}{"x": "1", "y": "2"}, ""},
+		{"b", "json", map[string]interface{}{"y": "2", "x": "1"}, ""}, // same content, other key order
+		{"a", "string", `{"x":"1","y":"2"}`, ""},
+		{"a", "raw", []byte(`{"x":"1","y":"2"}`), "application/json"},
+		{"b", "text", []byte(`{"x":"1","y":"2"}`), "text/plain"},
+		{"a", "split1", []byte("\x00b"), "a"},
+		{"a", "split2", []byte("b"), "a\x00"},
+	}
+	for _, put := range puts {
+		if _, err := db.PutBucketValue(put.bucket, put.key, put.value, PutOptions{ContentType: put.contentType}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the two equal JSON documents share storage
+	if stats := db.KVDedupStats(); stats.UniqueValues != len(puts)-1 || stats.References != len(puts) {
+		t.Fatalf("dedup stats = %+v", stats)
+	}
+	for _, put := range puts {
+		item, err := db.GetBucketItem(put.bucket, put.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(item.Value, put.value) || item.ContentType != put.contentType {
+			t.Errorf("%s/%s = %#v (%q), want %#v (%q)", put.bucket, put.key, item.Value, item.ContentType, put.value, put.contentType)
+		}
+	}
+
+	// Overwriting and deleting references release them
+	if _, err := db.PutBucketValue("b", "json", "changed", PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteBucketKey("a", "split1"); err != nil {
+		t.Fatal(err)
+	}
+	if stats := db.KVDedupStats(); stats.UniqueValues != len(puts)-1 || stats.References != len(puts)-1 || stats.SavedBytes != 0 {
+		t.Fatalf("dedup stats after release = %+v", stats)
+	}
+	if value, err := db.GetBucketValue("a", "json"); err != nil || !reflect.DeepEqual(value, puts[0].value) {
+		t.Fatalf("value of the remaining reference = %v, %v", value, err)
+	}
+}
+
+func TestBlobDedupSharesOnlyEqualContent(t *testing.T) {
+	store := NewBlobStore(t.TempDir())
+	store.Dedup = true
+	for _, blob := range []struct{ name, contentType, data string }{
+		{"a.txt", "text/plain", "same"},
+		{"a.json", "application/json", "same"},
+		{"b.txt", "text/plain", "other"},
+	} {
+		if _, err := store.PutBlob("media", blob.name, blob.contentType, nil, strings.NewReader(blob.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats, err := store.DedupStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.UniqueValues != 2 || stats.References != 3 || stats.SavedBytes != int64(len("same")) {
+		t.Fatalf("dedup stats = %+v", stats)
+	}
+
+	// Blobs sharing content keep their own metadata and outlive each other
+	if info, err := store.StatBlob("media", "a.json"); err != nil || info.ContentType != "application/json" {
+		t.Fatalf("shared blob = %+v, %v", info, err)
+	}
+	if err := store.DeleteBlob("media", "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.PutBlob("media", "b.txt", "text/plain", nil, strings.NewReader("replaced")); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"a.json": "same", "b.txt": "replaced"} {
+		file, _, err := store.OpenBlob("media", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil || string(data) != want {
+			t.Fatalf("%s = %q, %v", name, data, err)
+		}
+	}
+	if stats, _ := store.DedupStats(); stats.UniqueValues != 2 || stats.References != 2 {
+		t.Fatalf("dedup stats after release = %+v", stats)
+	}
+}
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"encoding/json"
+	"log"
+	"sync/atomic"
+)
+
+// docCompression keeps large top-level strings of documents compressed in memory,
+// trading CPU on every access for a smaller footprint on text-heavy collections
+type docCompression struct {
+	codec     string // empty disables compression
+	threshold int    // minimum string length to compress
+
+	compressed uint64 // strings held compressed
+	saved      int64  // bytes saved by them
+}
+
+// compressedString is a document string held compressed. It encodes to JSON as the
+// plain string, so snapshots, tiering and responses see the document unchanged.
+type compressedString struct {
+	codec string
+	data  []byte
+}
+
+// DocumentCompressionStats reports the savings of document compression
+type DocumentCompressionStats struct {
+	Codec      string `json:"codec"`
+	Threshold  int    `json:"threshold"`
+	Compressed uint64 `json:"compressed"`  // strings compressed on write
+	SavedBytes int64  `json:"saved_bytes"` // by the strings compressed on write
+}
+
+// enableDocumentCompression compresses the strings of documents written from now on
+func (db *MultiModelDatabase) enableDocumentCompression(codec string, threshold int) {
+	if !IsSupportedCompression(codec) {
+		log.Printf("Document compression disabled: unsupported codec %s", codec)
+		return
+	}
+	if threshold <= 0 {
+		threshold = DefaultCompressionThreshold
+	}
+	db.docCompression.codec = codec
+	db.docCompression.threshold = threshold
+}
+
+// DocumentCompressionStats returns the codec and the savings of document compression
+func (db *MultiModelDatabase) DocumentCompressionStats() DocumentCompressionStats {
+	return DocumentCompressionStats{
+		Codec:      db.docCompression.codec,
+		Threshold:  db.docCompression.threshold,
+		Compressed: atomic.LoadUint64(&db.docCompression.compressed),
+		SavedBytes: atomic.LoadInt64(&db.docCompression.saved),
+	}
+}
+
+// compressDocument returns doc with its top-level strings of at least the threshold
+// compressed, or doc itself when none is. Strings that do not shrink stay plain.
+func (db *MultiModelDatabase) compressDocument(doc Document) Document {
+	c := &db.docCompression
+	if c.codec == "" || doc == nil {
+		return doc
+	}
+	codec := valueCodecs[c.codec]
+
+	var compressed Document
+	for field, value := range doc {
+		s, isString := value.(string)
+		if !isString || len(s) < c.threshold {
+			continue
+		}
+		data, err := codec.Compress([]byte(s))
+		if err != nil || len(data) >= len(s) {
+			continue
+		}
+		if compressed == nil {
+			compressed = make(Document, len(doc))
+			for k, v := range doc {
+				compressed[k] = v
+			}
+		}
+		compressed[field] = &compressedString{codec: c.codec, data: data}
+		atomic.AddUint64(&c.compressed, 1)
+		atomic.AddInt64(&c.saved, int64(len(s)-len(data)))
+	}
+	if compressed == nil {
+		return doc
+	}
+	return compressed
+}
+
+// expandDocument returns doc with its compressed strings decompressed, or doc itself
+// when it holds none
+func (db *MultiModelDatabase) expandDocument(doc Document) Document {
+	if db.docCompression.codec == "" {
+		return doc
+	}
+	var expanded Document
+	for field, value := range doc {
+		if _, isCompressed := value.(*compressedString); !isCompressed {
+			continue
+		}
+		if expanded == nil {
+			expanded = make(Document, len(doc))
+			for k, v := range doc {
+				expanded[k] = v
+			}
+		}
+		expanded[field] = expandValue(value)
+	}
+	if expanded == nil {
+		return doc
+	}
+	return expanded
+}
+
+// expandValue returns the plain form of a document value
+func expandValue(value interface{}) interface{} {
+	cs, isCompressed := value.(*compressedString)
+	if !isCompressed {
+		return value
+	}
+	s, err := cs.plain()
+	if err != nil {
+		// Only memory corruption gets here; keep the value rather than lose it
+		return value
+	}
+	return s
+}
+
+func (cs *compressedString) plain() (string, error) {
+	data, err := valueCodecs[cs.codec].Decompress(cs.data)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// MarshalJSON encodes the plain string
+func (cs *compressedString) MarshalJSON() ([]byte, error) {
+	s, err := cs.plain()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(s)
+}
+
+// prepareDocument computes the stored fields of a document about to be written to
+// collection and compresses it
+func (db *MultiModelDatabase) prepareDocument(collection string, doc Document) Document {
+	if stored := db.computed.get(collection, true); len(stored) > 0 {
+		doc = computeFields(db.expandDocument(doc), stored)
+	}
+	return db.compressDocument(doc)
+}
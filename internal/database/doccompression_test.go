@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDocumentCompression(t *testing.T) {
+	db := newTestDatabase(t)
+	db.enableDocumentCompression("gzip", 64)
+
+	body := strings.Repeat("the quick brown fox jumps over the lazy dog ", 20)
+	if err := db.InsertDocument("articles", "a1", Document{"title": "Foxes", "body": body}); err != nil {
+		t.Fatal(err)
+	}
+	raw := func() Document {
+		db.docMutex.RLock()
+		defer db.docMutex.RUnlock()
+		return db.documents["articles.a1"]
+	}
+	if _, compressed := raw()["body"].(*compressedString); !compressed {
+		t.Fatalf("long string held as %T", raw()["body"])
+	}
+	if _, plain := raw()["title"].(string); !plain {
+		t.Fatal("short string was compressed")
+	}
+	if stats := db.DocumentCompressionStats(); stats.Compressed != 1 || stats.SavedBytes <= 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	doc, err := db.GetDocument("articles", "a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc["body"] != body {
+		t.Fatal("read did not decompress the body")
+	}
+	encoded, err := json.Marshal(raw())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Document
+	if err := json.Unmarshal(encoded, &decoded); err != nil || decoded["body"] != body {
+		t.Fatalf("encoded document = %s", encoded)
+	}
+
+	// Updates keep compressed strings, queries and indexes see plain ones
+	if err := db.UpdateDocument("articles", "a1", Document{"title": "Dogs"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, compressed := raw()["body"].(*compressedString); !compressed {
+		t.Fatal("update decompressed the body")
+	}
+	if err := db.CreateIndex(IndexSpec{Collection: "articles", Field: "body", Type: IndexTrigram}); err != nil {
+		t.Fatal(err)
+	}
+	docs, err := db.FindDocuments(context.Background(), "articles", DocumentQuery{
+		Filter: map[string]interface{}{"body": map[string]interface{}{OpRegex: "lazy dog"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 || docs[0]["body"] != body || docs[0]["title"] != "Dogs" {
+		t.Fatalf("query found %v", docs)
+	}
+}
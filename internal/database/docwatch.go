@@ -0,0 +1,87 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+)
+
+// WatchDocument blocks until the document id in collection differs from its state
+// when the watch began, ctx is done, or the database is closed, and reports whether
+// it changed. Creating and deleting the document are changes too. Watchers wake on
+// every change of the collection and compare the document's encoding, so unrelated
+// writes to the collection only cost a read.
+func (db *MultiModelDatabase) WatchDocument(ctx context.Context, collection, id string) (bool, error) {
+	return db.watchDocument(ctx, collection, id, nil)
+}
+
+// WatchDocumentSince is WatchDocument for a caller that last read the document at
+// version of the collection (CollectionStamp.Version). It reports a change at once
+// when the collection has changed since, as the document may have changed with it.
+func (db *MultiModelDatabase) WatchDocumentSince(ctx context.Context, collection, id string, version int64) (bool, error) {
+	return db.watchDocument(ctx, collection, id, &version)
+}
+
+func (db *MultiModelDatabase) watchDocument(ctx context.Context, collection, id string, since *int64) (bool, error) {
+	if IsSystemCollection(collection) {
+		// System documents change without touching their collection
+		return false, fmt.Errorf("system collection %s cannot be watched", collection)
+	}
+
+	// Registered before reading the baseline so no change can slip in between
+	changed, version := db.watchCollection(collection)
+	if since != nil && version != *since {
+		db.unwatchCollection(collection, changed)
+		return true, nil
+	}
+	baseline, _ := db.GetDocumentJSON(collection, id)
+	baseline = append([]byte(nil), baseline...)
+	for {
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			db.unwatchCollection(collection, changed)
+			return false, nil
+		case <-db.ctx.Done():
+			db.unwatchCollection(collection, changed)
+			return false, nil
+		}
+
+		changed, _ = db.watchCollection(collection)
+		current, _ := db.GetDocumentJSON(collection, id)
+		if !bytes.Equal(current, baseline) {
+			db.unwatchCollection(collection, changed)
+			return true, nil
+		}
+	}
+}
+
+// watchCollection returns a channel closed on the next change of collection, with
+// the collection's current version
+func (db *MultiModelDatabase) watchCollection(collection string) (chan struct{}, int64) {
+	db.docMutex.Lock()
+	defer db.docMutex.Unlock()
+
+	ch := make(chan struct{})
+	db.docWatchers[collection] = append(db.docWatchers[collection], ch)
+	return ch, db.docStamps[collection].Version
+}
+
+// unwatchCollection removes a watcher that has not been woken
+func (db *MultiModelDatabase) unwatchCollection(collection string, ch chan struct{}) {
+	db.docMutex.Lock()
+	defer db.docMutex.Unlock()
+
+	watchers := db.docWatchers[collection]
+	for i, candidate := range watchers {
+		if candidate == ch {
+			watchers = append(watchers[:i], watchers[i+1:]...)
+			break
+		}
+	}
+	if len(watchers) == 0 {
+		delete(db.docWatchers, collection)
+	} else {
+		db.docWatchers[collection] = watchers
+	}
+}
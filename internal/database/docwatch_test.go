@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWatchDocumentWakesOnlyOnItsChanges(t *testing.T) {
+	db := newTestDatabase(t)
+	if err := db.InsertDocument("orders", "o1", Document{"status": "new"}); err != nil {
+		t.Fatal(err)
+	}
+
+	result := make(chan bool, 1)
+	go func() {
+		changed, err := db.WatchDocument(context.Background(), "orders", "o1")
+		if err != nil {
+			t.Error(err)
+		}
+		result <- changed
+	}()
+	waitForWatchers(t, db, "orders")
+
+	// Writes to other documents of the collection do not end the watch
+	if err := db.InsertDocument("orders", "o2", Document{"status": "new"}); err != nil {
+		t.Fatal(err)
+	}
+	waitForWatchers(t, db, "orders")
+	select {
+	case <-result:
+		t.Fatal("watch ended on a change to another document")
+	default:
+	}
+
+	if err := db.UpdateDocument("orders", "o1", Document{"status": "paid"}); err != nil {
+		t.Fatal(err)
+	}
+	if changed := <-result; !changed {
+		t.Fatal("watch did not report the update")
+	}
+
+	// Watching a missing document waits for its creation, and times out without one
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if changed, err := db.WatchDocument(ctx, "orders", "o3"); err != nil || changed {
+		t.Fatalf("changed = %v, err = %v without writes", changed, err)
+	}
+	if len(db.docWatchers) != 0 {
+		t.Fatalf("watchers left behind: %v", db.docWatchers)
+	}
+}
+
+func TestWatchDocumentSinceVersion(t *testing.T) {
+	db := newTestDatabase(t)
+	if err := db.InsertDocument("orders", "o1", Document{"status": "new"}); err != nil {
+		t.Fatal(err)
+	}
+	seen := db.CollectionStamp("orders").Version
+	if err := db.UpdateDocument("orders", "o1", Document{"status": "paid"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A change between the caller's read and its watch is reported at once
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	if changed, err := db.WatchDocumentSince(ctx, "orders", "o1", seen); err != nil || !changed || time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("stale version: changed = %v, err = %v after %s", changed, err, time.Since(start))
+	}
+
+	// At the current version only changes of the document end the watch
+	current := db.CollectionStamp("orders").Version
+	result := make(chan bool, 1)
+	go func() {
+		changed, err := db.WatchDocumentSince(context.Background(), "orders", "o1", current)
+		if err != nil {
+			t.Error(err)
+		}
+		result <- changed
+	}()
+	waitForWatchers(t, db, "orders")
+	if err := db.InsertDocument("orders", "o2", Document{"status": "new"}); err != nil {
+		t.Fatal(err)
+	}
+	waitForWatchers(t, db, "orders")
+	select {
+	case <-result:
+		t.Fatal("watch ended on a change to another document")
+	default:
+	}
+	if err := db.DeleteDocument("orders", "o1"); err != nil {
+		t.Fatal(err)
+	}
+	if changed := <-result; !changed {
+		t.Fatal("watch did not report the delete")
+	}
+}
+
+func waitForWatchers(t *testing.T, db *MultiModelDatabase, collection string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		db.docMutex.RLock()
+		watching := len(db.docWatchers[collection]) > 0
+		db.docMutex.RUnlock()
+		if watching {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no watcher registered")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
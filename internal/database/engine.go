@@ -1,9 +1,16 @@
 package database
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"multimodel-db-engine/internal/config"
 )
@@ -13,12 +20,54 @@ type Document map[string]interface{}
 
 // KeyValue represents a key-value pair
 type KeyValue struct {
-	Key   string
-	Value interface{}
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
 }
 
-// ColumnFamily represents a column family in the column store
-type ColumnFamily map[string]map[string]interface{}
+// ColumnFamily represents a column family in the column store. Rows are kept ordered
+// by row key so range and prefix scans over composite keys are efficient and deterministic.
+type ColumnFamily struct {
+	rows    *skipList
+	options ColumnFamilyOptions
+	cold    map[string]coldStub // rows moved to the object store by tiering
+}
+
+// ColumnFamilyOptions configures per-family storage behavior
+type ColumnFamilyOptions struct {
+	Compression          string `json:"compression"`           // codec name, empty disables compression
+	CompressionThreshold int    `json:"compression_threshold"` // minimum encoded value size to compress
+}
+
+func newColumnFamily() *ColumnFamily {
+	return &ColumnFamily{rows: newSkipList()}
+}
+
+// decodeRow returns row with any compressed cells expanded. Rows without compressed
+// cells are returned as is to avoid copying on the common path.
+func (cf *ColumnFamily) decodeRow(row map[string]interface{}) (map[string]interface{}, error) {
+	var decoded map[string]interface{}
+	for name, value := range row {
+		if _, ok := value.(*compressedValue); !ok {
+			continue
+		}
+		if decoded == nil {
+			decoded = make(map[string]interface{}, len(row))
+			for k, v := range row {
+				decoded[k] = v
+			}
+		}
+		plain, err := decompressValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", name, err)
+		}
+		decoded[name] = plain
+	}
+
+	if decoded == nil {
+		return row, nil
+	}
+	return decoded, nil
+}
 
 // GraphNode represents a node in the graph store
 type GraphNode struct {
@@ -42,14 +91,45 @@ type MultiModelDatabase struct {
 	
 	// Document store
 	documents map[string]Document
+	coldDocs  map[string]coldStub // documents moved to the object store by tiering
+	archives  map[string]*archive // read-only collections mapped from archive files
 	docMutex  sync.RWMutex
 	
-	// Key-value store
-	keyValues map[string]interface{}
-	kvMutex   sync.RWMutex
+	// Per-collection change stamps for HTTP caching, guarded by docMutex
+	docStamps   map[string]CollectionStamp
+	docRevision int64
+	docWatchers map[string][]chan struct{} // closed on the next change of a collection
+	syncLog     *syncJournal                 // documents changed, for clients syncing offline copies
+	startedAt   time.Time
+	
+	// Secondary indexes on document fields
+	indexes *indexSet
+	
+	// Computed document fields
+	computed *computedSet
+	
+	// Declared document references, materialized as graph edges
+	references *referenceSet
+	
+	// How the data derived across models was produced
+	lineage *lineageSet
+	
+	// In-memory compression of large document strings
+	docCompression docCompression
+	
+	// Encoded documents served by GetDocumentJSON
+	rawDocs *rawDocuments
+	
+	// Key-value store, partitioned into buckets
+	kvBuckets  map[string]*kvBucket
+	kvLeases   map[string]*kvLease
+	kvWatchers map[string][]chan *KVEvent
+	kvRevision int64
+	kvContent  *contentStore // values of deduplicating buckets
+	kvMutex    sync.RWMutex
 	
 	// Column store
-	columnFamilies map[string]ColumnFamily
+	columnFamilies map[string]*ColumnFamily
 	colMutex       sync.RWMutex
 	
 	// Graph store
@@ -57,141 +137,426 @@ type MultiModelDatabase struct {
 	graphEdges map[string]*GraphEdge
 	graphMutex sync.RWMutex
 	
+	// Subscribers to graph mutations
+	graphWatchers *graphWatchers
+	
+	// Large object store persisted under DataDir
+	Blobs *BlobStore
+	
+	// Durable work queues journaled under DataDir
+	Queues *QueueStore
+	
+	// Cron-style job scheduler
+	Scheduler *Scheduler
+	
+	// Distributed locks granted by this node
+	locks *lockTable
+	
+	// Consistency modes of collections and states of CRDT documents
+	crdt *crdtStore
+	
+	// Bootstrap of this node's partitions after joining, cursors kept under DataDir
+	transfer *stateTransfer
+	
+	// Requests served per partition, feeding the rebalancer
+	load *loadTracker
+	
+	// Serializes the partition splits this node coordinates as the leader
+	splitMutex sync.Mutex
+	
+	// Full and incremental snapshot backups cataloged under DataDir
+	Backups *BackupStore
+	
+	// Hooks registered by embedding applications
+	plugins     []Plugin
+	pluginMutex sync.RWMutex
+	
+	// Versioned data migrations registered by embedding applications
+	migrations migrationRegistry
+	
+	// Priority classes of collections, enforced by the admission layer
+	priorities *priorityClasses
+	
+	// Dropped collections and column families kept restorable
+	trash      map[string]*trashed
+	trashMutex sync.Mutex
+	
+	// Read-only mode toggled for backups and maintenance
+	readOnly readOnlyState
+	
 	// Distributed cluster components
 	Cluster *Cluster  // Public field to access cluster from other packages
+	
+	// Hybrid logical clock timestamping mutations, shared with the cluster
+	Clock *HLC
+	
+	// Test-only fault injection, nil unless enabled in the configuration
+	Faults *FaultInjector
+	
+	// Tiering of cold data to object storage, nil unless enabled
+	Tiering *Tiering
+	
+	// Memory budget enforcement, nil unless a limit is configured
+	memory *memoryGovernor
+	
+	// Lifecycle of background routines
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+	routines   *supervisor
 }
 
 // NewMultiModelDatabase creates a new instance of the multi-model database
 func NewMultiModelDatabase(cfg *config.Config) *MultiModelDatabase {
+	if cfg.Ephemeral {
+		ephemeral, err := ephemeralConfig(cfg)
+		if err != nil {
+			log.Fatalf("Ephemeral mode: %v", err)
+		}
+		log.Printf("WARNING: ephemeral mode, nothing is persisted and %s is removed on shutdown", ephemeral.DataDir)
+		cfg = ephemeral
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	
 	db := &MultiModelDatabase{
 		config:         cfg,
 		documents:      make(map[string]Document),
-		keyValues:      make(map[string]interface{}),
-		columnFamilies: make(map[string]ColumnFamily),
+		coldDocs:       make(map[string]coldStub),
+		archives:       make(map[string]*archive),
+		docStamps:      make(map[string]CollectionStamp),
+		docWatchers:    make(map[string][]chan struct{}),
+		syncLog:        newSyncJournal(),
+		startedAt:      time.Now(),
+		indexes:        newIndexSet(),
+		computed:       newComputedSet(),
+		references:     newReferenceSet(),
+		lineage:        newLineageSet(),
+		rawDocs:        newRawDocuments(cfg.DocRawCacheMB << 20),
+		kvBuckets:      map[string]*kvBucket{DefaultBucket: newKVBucket()},
+		kvLeases:       make(map[string]*kvLease),
+		locks:          newLockTable(),
+		Clock:          NewHLC(),
+		crdt:           newCRDTStore(cfg.CRDTCollections),
+		transfer:       newStateTransfer(filepath.Join(cfg.DataDir, "transfer.json")),
+		load:           newLoadTracker(),
+		kvWatchers:     make(map[string][]chan *KVEvent),
+		kvContent:      newContentStore(),
+		columnFamilies: make(map[string]*ColumnFamily),
 		graphNodes:     make(map[string]*GraphNode),
 		graphEdges:     make(map[string]*GraphEdge),
+		graphWatchers:  newGraphWatchers(),
+		Blobs:          NewBlobStore(filepath.Join(cfg.DataDir, "blobs")),
+		Queues:         NewQueueStore(filepath.Join(cfg.DataDir, "queues")),
+		ctx:            ctx,
+		cancelFunc:     cancel,
+		routines:       newSupervisor(ctx),
+		trash:          make(map[string]*trashed),
+		priorities:     &priorityClasses{classes: make(map[string]string)},
+	}
+	
+	db.Blobs.Dedup = cfg.BlobDedup
+	db.loadArchives()
+	if cfg.DocCompression != "" {
+		db.enableDocumentCompression(cfg.DocCompression, cfg.DocCompressAbove)
+	}
+	if cfg.FaultInjection {
+		db.Faults = NewFaultInjector()
+		db.Queues.faults = db.Faults
+	}
+	if cfg.ReadOnly {
+		db.SetReadOnly(true, "started in read-only mode")
+	}
+	if classes, err := ParsePriorityClasses(cfg.PriorityClasses); err != nil {
+		log.Printf("Ignoring collection priorities: %v", err)
+	} else {
+		db.priorities.classes = classes
 	}
 	
 	// Initialize cluster if enabled
 	if cfg.ClusterEnabled {
-		db.Cluster = NewCluster(cfg)
+		db.Cluster = newCluster(cfg, db.Faults, db.Clock)
+		db.Queues.replicate = db.Cluster.ReplicateQueueRecord
+		db.routines.run("crdt-sync", db.startCRDTSync)
+		db.routines.run("partition-splitter", db.startPartitionSplitter)
 	}
 	
+	if cfg.TierBucket != "" && cfg.TierColdDays > 0 {
+		db.enableS3Tiering(cfg)
+	}
+	if cfg.MemoryLimitMB > 0 {
+		db.enableMemoryLimit(cfg)
+	}
+	
+	// Actively expire keys and leases so watchers observe expirations
+	db.routines.run("kv-sweeper", func() { db.startKVSweeper(ctx) })
+	db.routines.run("trash-sweeper", func() { db.startTrashSweeper(ctx) })
+	
+	db.Backups = newBackupStore(db, filepath.Join(cfg.DataDir, "backups"))
+	db.Scheduler = newScheduler(db, filepath.Join(cfg.DataDir, "jobs.json"))
+	db.routines.run("scheduler", func() { db.Scheduler.start(ctx) })
+	
 	return db
 }
 
+// Config returns the configuration the database was created with
+func (db *MultiModelDatabase) Config() *config.Config {
+	return db.config
+}
+
+// StartedAt returns when the database was created
+func (db *MultiModelDatabase) StartedAt() time.Time {
+	return db.startedAt
+}
+
+// Close stops background routines and the cluster component
+func (db *MultiModelDatabase) Close() {
+	db.cancelFunc()
+	if !db.routines.wait(stopTimeout) {
+		log.Printf("Background routines still running after %v", stopTimeout)
+	}
+	db.Queues.Close()
+	if db.Cluster != nil {
+		db.Cluster.Close()
+	}
+	db.closeArchives()
+	db.removeEphemeralData()
+}
+
 // Document Store Operations
 func (db *MultiModelDatabase) InsertDocument(collection, id string, doc Document) error {
+	event := &WriteEvent{Model: ModelDocument, Namespace: collection, Key: id, Value: doc}
+	return db.withWriteHooks(OpInsert, event, func() error {
+		return db.insertDocument(collection, id, doc)
+	})
+}
+
+func (db *MultiModelDatabase) insertDocument(collection, id string, doc Document) error {
+	if db.crdt.enabled(collection) {
+		return db.writeCRDTDocument(collection, id, doc, true)
+	}
+	
 	db.docMutex.Lock()
 	defer db.docMutex.Unlock()
 	
+	if db.archived(collection) != nil {
+		return fmt.Errorf("%w: %s", ErrArchived, collection)
+	}
 	if _, exists := db.documents[collection+"."+id]; exists {
-		return fmt.Errorf("document with id %s already exists in collection %s", id, collection)
+		return fmt.Errorf("%w: %s in collection %s", ErrDocumentExists, id, collection)
+	}
+	if _, cold := db.coldDocs[collection+"."+id]; cold {
+		return fmt.Errorf("%w: %s in collection %s", ErrDocumentExists, id, collection)
 	}
 	
-	db.documents[collection+"."+id] = doc
+	db.documents[collection+"."+id] = db.prepareDocument(collection, doc)
+	db.touchDocuments(collection, id)
 	return nil
 }
 
 func (db *MultiModelDatabase) GetDocument(collection, id string) (Document, error) {
+	if family, isView := viewedFamily(collection); isView {
+		return db.getFamilyDocument(collection, family, id)
+	}
+	if IsSystemCollection(collection) {
+		docs, err := db.systemDocuments(collection)
+		if err != nil {
+			return nil, err
+		}
+		if doc, exists := docs[id]; exists {
+			return doc, nil
+		}
+		return nil, fmt.Errorf("document with id %s not found in collection %s", id, collection)
+	}
+	if err := db.warmDocument(collection, id); err != nil {
+		return nil, err
+	}
+	
 	db.docMutex.RLock()
 	defer db.docMutex.RUnlock()
 	
 	doc, exists := db.documents[collection+"."+id]
+	if a := db.archived(collection); a != nil {
+		var err error
+		if doc, exists, err = a.get(id); err != nil {
+			return nil, err
+		}
+	}
 	if !exists {
 		return nil, fmt.Errorf("document with id %s not found in collection %s", id, collection)
 	}
 	
-	return doc, nil
+	return computeFields(db.expandDocument(doc), db.computed.get(collection, false)), nil
 }
 
 func (db *MultiModelDatabase) UpdateDocument(collection, id string, updates Document) error {
+	event := &WriteEvent{Model: ModelDocument, Namespace: collection, Key: id, Value: updates}
+	return db.withWriteHooks(OpUpdate, event, func() error {
+		return db.updateDocument(collection, id, nil, updates)
+	})
+}
+
+// updateDocument merges updates into a document matching condition, which nil always does
+func (db *MultiModelDatabase) updateDocument(collection, id string, condition map[string]interface{}, updates Document) error {
+	if db.crdt.enabled(collection) {
+		if err := db.warmDocument(collection, id); err != nil {
+			return err
+		}
+		if condition != nil {
+			return fmt.Errorf("conditional writes are not supported on CRDT collection %s", collection)
+		}
+		if hasUpdateOperators(updates) {
+			return fmt.Errorf("%w: operators are not supported on CRDT collection %s", ErrInvalidUpdate, collection)
+		}
+		return db.writeCRDTDocument(collection, id, updates, false)
+	}
+	_, _, err := db.modifyDocument(collection, id, condition, updates)
+	return err
+}
+
+// modifyDocument merges updates into a document matching condition and returns the
+// stored document before and after. CRDT collections are left to the caller.
+func (db *MultiModelDatabase) modifyDocument(collection, id string, condition map[string]interface{}, updates Document) (Document, Document, error) {
+	if err := db.warmDocument(collection, id); err != nil {
+		return nil, nil, err
+	}
+	
 	db.docMutex.Lock()
 	defer db.docMutex.Unlock()
 	
+	if db.archived(collection) != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrArchived, collection)
+	}
 	key := collection + "." + id
 	doc, exists := db.documents[key]
 	if !exists {
-		return fmt.Errorf("document with id %s not found in collection %s", id, collection)
+		return nil, nil, fmt.Errorf("document with id %s not found in collection %s", id, collection)
+	}
+	if !db.documentMatches(collection, doc, condition) {
+		return nil, nil, errConditionNotMet
 	}
 	
-	// Merge updates into existing document
-	for k, v := range updates {
-		doc[k] = v
+	// Merge updates into a copy of the document, so a failed path leaves it untouched.
+	// Dotted keys such as address.city set nested fields, and operators such as $inc
+	// change fields in place.
+	merged := make(Document, len(doc)+len(updates))
+	for k, v := range doc {
+		merged[k] = v
+	}
+	if err := applyUpdate(merged, updates); err != nil {
+		return nil, nil, err
 	}
 	
-	db.documents[key] = doc
-	return nil
+	updated := db.prepareDocument(collection, merged)
+	db.documents[key] = updated
+	db.touchDocuments(collection, id)
+	return doc, updated, nil
 }
 
 func (db *MultiModelDatabase) DeleteDocument(collection, id string) error {
+	event := &WriteEvent{Model: ModelDocument, Namespace: collection, Key: id}
+	return db.withWriteHooks(OpDelete, event, func() error {
+		return db.deleteDocument(collection, id, nil)
+	})
+}
+
+// deleteDocument deletes a document matching condition, which nil always does
+func (db *MultiModelDatabase) deleteDocument(collection, id string, condition map[string]interface{}) error {
+	if db.crdt.enabled(collection) {
+		if condition != nil {
+			return fmt.Errorf("conditional writes are not supported on CRDT collection %s", collection)
+		}
+		return db.writeCRDTDocument(collection, id, nil, false)
+	}
+	if condition != nil {
+		// The condition is evaluated on the document, which must be in memory
+		if err := db.warmDocument(collection, id); err != nil {
+			return err
+		}
+	}
+	
 	db.docMutex.Lock()
 	defer db.docMutex.Unlock()
 	
+	if db.archived(collection) != nil {
+		return fmt.Errorf("%w: %s", ErrArchived, collection)
+	}
 	key := collection + "." + id
-	if _, exists := db.documents[key]; !exists {
+	doc, exists := db.documents[key]
+	if exists && !db.documentMatches(collection, doc, condition) {
+		return errConditionNotMet
+	}
+	if !exists {
+		// A conditional delete only removes documents it evaluated
+		if condition == nil && db.dropColdDocument(key) {
+			db.touchDocuments(collection, id)
+			return nil
+		}
 		return fmt.Errorf("document with id %s not found in collection %s", id, collection)
 	}
 	
 	delete(db.documents, key)
+	db.rawDocs.forget(key)
+	db.touchDocuments(collection, id)
 	return nil
 }
 
-// Key-Value Store Operations
+// Key-Value Store Operations (default bucket, see buckets.go for namespaced access)
 func (db *MultiModelDatabase) SetKeyValue(key string, value interface{}) error {
-	db.kvMutex.Lock()
-	defer db.kvMutex.Unlock()
-	
-	db.keyValues[key] = value
-	return nil
+	return db.SetBucketValue(DefaultBucket, key, value, 0)
 }
 
 func (db *MultiModelDatabase) GetKeyValue(key string) (interface{}, error) {
-	db.kvMutex.RLock()
-	defer db.kvMutex.RUnlock()
-	
-	value, exists := db.keyValues[key]
-	if !exists {
-		return nil, fmt.Errorf("key %s not found", key)
-	}
-	
-	return value, nil
+	return db.GetBucketValue(DefaultBucket, key)
 }
 
 func (db *MultiModelDatabase) DeleteKey(key string) error {
-	db.kvMutex.Lock()
-	defer db.kvMutex.Unlock()
-	
-	if _, exists := db.keyValues[key]; !exists {
-		return fmt.Errorf("key %s not found", key)
-	}
-	
-	delete(db.keyValues, key)
-	return nil
+	return db.DeleteBucketKey(DefaultBucket, key)
 }
 
 // Column Store Operations
 func (db *MultiModelDatabase) InsertColumn(columnFamily, rowKey, columnName string, value interface{}) error {
+	op := OpInsert
+	if _, err := db.GetColumn(columnFamily, rowKey, columnName); err == nil {
+		op = OpUpdate
+	}
+	
+	event := &WriteEvent{Model: ModelColumn, Namespace: columnFamily, Key: rowKey, Field: columnName, Value: value}
+	return db.withWriteHooks(op, event, func() error {
+		return db.insertColumn(columnFamily, rowKey, columnName, event.Value)
+	})
+}
+
+func (db *MultiModelDatabase) insertColumn(columnFamily, rowKey, columnName string, value interface{}) error {
+	if err := db.warmRow(columnFamily, rowKey); err != nil {
+		return err
+	}
+	
 	db.colMutex.Lock()
 	defer db.colMutex.Unlock()
 	
 	cf, exists := db.columnFamilies[columnFamily]
 	if !exists {
-		cf = make(map[string]map[string]interface{})
+		cf = newColumnFamily()
 		db.columnFamilies[columnFamily] = cf
 	}
 	
-	row, exists := cf[rowKey]
-	if !exists {
-		row = make(map[string]interface{})
-		cf[rowKey] = row
+	stored, err := compressValue(cf.options.Compression, cf.options.CompressionThreshold, value)
+	if err != nil {
+		return err
 	}
 	
-	row[columnName] = value
+	row := cf.rows.GetOrCreate(rowKey)
+	row[columnName] = stored
 	return nil
 }
 
 func (db *MultiModelDatabase) GetColumn(columnFamily, rowKey, columnName string) (interface{}, error) {
+	if collection, isView := viewedCollection(columnFamily); isView {
+		return db.getCollectionViewColumn(columnFamily, collection, rowKey, columnName)
+	}
+	if err := db.warmRow(columnFamily, rowKey); err != nil {
+		return nil, err
+	}
+	
 	db.colMutex.RLock()
 	defer db.colMutex.RUnlock()
 	
@@ -200,7 +565,7 @@ func (db *MultiModelDatabase) GetColumn(columnFamily, rowKey, columnName string)
 		return nil, fmt.Errorf("column family %s not found", columnFamily)
 	}
 	
-	row, exists := cf[rowKey]
+	row, exists := cf.rows.Get(rowKey)
 	if !exists {
 		return nil, fmt.Errorf("row %s not found in column family %s", rowKey, columnFamily)
 	}
@@ -210,26 +575,307 @@ func (db *MultiModelDatabase) GetColumn(columnFamily, rowKey, columnName string)
 		return nil, fmt.Errorf("column %s not found in row %s of column family %s", columnName, rowKey, columnFamily)
 	}
 	
-	return value, nil
+	return decompressValue(value)
+}
+
+// SetColumnFamilyOptions configures a column family, creating it if needed. Changing
+// the codec only affects later writes; existing cells remain readable.
+func (db *MultiModelDatabase) SetColumnFamilyOptions(columnFamily string, options ColumnFamilyOptions) error {
+	if !IsSupportedCompression(options.Compression) {
+		return fmt.Errorf("unsupported compression codec %s", options.Compression)
+	}
+	if options.CompressionThreshold < 0 {
+		return fmt.Errorf("compression threshold must not be negative")
+	}
+	if _, isView := viewedCollection(columnFamily); isView {
+		return fmt.Errorf("%w: %s", ErrReadOnlyView, columnFamily)
+	}
+	if options.Compression != "" && options.CompressionThreshold == 0 {
+		options.CompressionThreshold = DefaultCompressionThreshold
+	}
+
+	db.colMutex.Lock()
+	defer db.colMutex.Unlock()
+
+	cf, exists := db.columnFamilies[columnFamily]
+	if !exists {
+		cf = newColumnFamily()
+		db.columnFamilies[columnFamily] = cf
+	}
+	cf.options = options
+	return nil
+}
+
+// GetColumnFamilyOptions returns the configuration of a column family
+func (db *MultiModelDatabase) GetColumnFamilyOptions(columnFamily string) (ColumnFamilyOptions, error) {
+	db.colMutex.RLock()
+	defer db.colMutex.RUnlock()
+
+	cf, exists := db.columnFamilies[columnFamily]
+	if !exists {
+		return ColumnFamilyOptions{}, fmt.Errorf("column family %s not found", columnFamily)
+	}
+	return cf.options, nil
+}
+
+// ColumnPredicate is a value condition evaluated against a single column during a scan
+type ColumnPredicate struct {
+	Column string      `json:"column"`
+	Op     string      `json:"op"` // eq, ne, gt, gte, lt, lte, exists
+	Value  interface{} `json:"value"`
+}
+
+// ColumnScan describes a range scan over a column family
+type ColumnScan struct {
+	StartRow   string            `json:"start"`   // inclusive, empty means first row
+	EndRow     string            `json:"end"`     // exclusive, empty means last row
+	Prefix     string            `json:"prefix"`  // only rows whose key starts with prefix
+	Columns    []string          `json:"columns"` // qualifiers to return, "prefix*" matches a group
+	Predicates []ColumnPredicate `json:"where"`
+	Limit      int               `json:"limit"`
+	After      string            `json:"after,omitempty"` // exclusive, continues a scan after this row
+}
+
+// ColumnRow is a single row returned by a column scan
+type ColumnRow struct {
+	Key     string                 `json:"key"`
+	Columns map[string]interface{} `json:"columns"`
+}
+
+// ScanColumns returns the rows of a column family within the scan range that satisfy
+// all predicates, projected down to the requested columns
+func (db *MultiModelDatabase) ScanColumns(columnFamily string, scan ColumnScan) ([]ColumnRow, error) {
+	return db.ScanColumnsContext(context.Background(), columnFamily, scan)
+}
+
+// ScanColumnsContext is ScanColumns that stops with ctx's error once ctx is done
+func (db *MultiModelDatabase) ScanColumnsContext(ctx context.Context, columnFamily string, scan ColumnScan) ([]ColumnRow, error) {
+	if collection, isView := viewedCollection(columnFamily); isView {
+		return db.scanCollectionView(ctx, columnFamily, collection, scan)
+	}
+	if err := db.beforeQuery(&QueryEvent{Model: ModelColumn, Namespace: columnFamily, Scan: &scan}); err != nil {
+		return nil, err
+	}
+	if err := db.warmRows(columnFamily, scan); err != nil {
+		return nil, err
+	}
+
+	db.colMutex.RLock()
+	defer db.colMutex.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cf, exists := db.columnFamilies[columnFamily]
+	if !exists {
+		return nil, fmt.Errorf("column family %s not found", columnFamily)
+	}
+	return cf.scan(ctx, scan)
+}
+
+// scan returns the rows of the family matching scan. Callers must hold the colMutex
+// read lock, unless the family is their own.
+func (cf *ColumnFamily) scan(ctx context.Context, scan ColumnScan) ([]ColumnRow, error) {
+	for _, p := range scan.Predicates {
+		if !isValidPredicateOp(p.Op) {
+			return nil, fmt.Errorf("unsupported predicate operator %q on column %s", p.Op, p.Column)
+		}
+	}
+
+	start := scan.StartRow
+	if scan.Prefix > start {
+		start = scan.Prefix
+	}
+	if after := scan.After + "\x00"; scan.After != "" && after > start {
+		// The smallest key following After
+		start = after
+	}
+
+	results := make([]ColumnRow, 0)
+	check := cancelCheck{ctx: ctx}
+	var scanErr error
+	cf.rows.Ascend(start, scan.EndRow, func(rowKey string, row map[string]interface{}) bool {
+		if scanErr = check.err(); scanErr != nil {
+			return false
+		}
+		if !strings.HasPrefix(rowKey, scan.Prefix) {
+			// Keys sharing the prefix are contiguous, so the first miss ends the scan
+			return rowKey < scan.Prefix
+		}
+
+		row, scanErr = cf.decodeRow(row)
+		if scanErr != nil {
+			scanErr = fmt.Errorf("row %s: %w", rowKey, scanErr)
+			return false
+		}
+		if !rowMatchesPredicates(row, scan.Predicates) {
+			return true
+		}
+
+		projected := projectColumns(row, scan.Columns)
+		if len(projected) == 0 {
+			return true
+		}
+
+		results = append(results, ColumnRow{Key: rowKey, Columns: projected})
+		return scan.Limit <= 0 || len(results) < scan.Limit
+	})
+	if scanErr != nil {
+		return nil, scanErr
+	}
+
+	return results, nil
+}
+
+func isValidPredicateOp(op string) bool {
+	switch op {
+	case "eq", "ne", "gt", "gte", "lt", "lte", "exists":
+		return true
+	}
+	return false
+}
+
+// rowMatchesPredicates reports whether a row satisfies every predicate
+func rowMatchesPredicates(row map[string]interface{}, predicates []ColumnPredicate) bool {
+	for _, p := range predicates {
+		actual, exists := row[p.Column]
+		if p.Op == "exists" {
+			if exists != (p.Value != false) {
+				return false
+			}
+			continue
+		}
+		if !exists {
+			return false
+		}
+
+		cmp := compareValues(actual, p.Value)
+		switch p.Op {
+		case "eq":
+			if cmp != 0 {
+				return false
+			}
+		case "ne":
+			if cmp == 0 {
+				return false
+			}
+		case "gt":
+			if cmp <= 0 {
+				return false
+			}
+		case "gte":
+			if cmp < 0 {
+				return false
+			}
+		case "lt":
+			if cmp >= 0 {
+				return false
+			}
+		case "lte":
+			if cmp > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// projectColumns copies the selected qualifiers of a row, or the whole row when none are given
+func projectColumns(row map[string]interface{}, columns []string) map[string]interface{} {
+	projected := make(map[string]interface{})
+	if len(columns) == 0 {
+		for name, value := range row {
+			projected[name] = value
+		}
+		return projected
+	}
+
+	for _, qualifier := range columns {
+		if strings.HasSuffix(qualifier, "*") {
+			prefix := strings.TrimSuffix(qualifier, "*")
+			for name, value := range row {
+				if strings.HasPrefix(name, prefix) {
+					projected[name] = value
+				}
+			}
+			continue
+		}
+		if value, exists := row[qualifier]; exists {
+			projected[qualifier] = value
+		}
+	}
+	return projected
+}
+
+// compareValues orders two values numerically when both are numbers (or numeric strings)
+// and lexically by their string form otherwise
+func compareValues(a, b interface{}) int {
+	if ai, ok := integerValue(a); ok {
+		if bi, ok := integerValue(b); ok {
+			switch {
+			case ai < bi:
+				return -1
+			case ai > bi:
+				return 1
+			}
+			return 0
+		}
+	}
+	af, aNum := toFloat(a)
+	bf, bNum := toFloat(b)
+	if aNum && bNum {
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+		return 0
+	}
+
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
 }
 
 // Graph Store Operations
 func (db *MultiModelDatabase) CreateNode(id string, labels []string, props map[string]interface{}) error {
-	db.graphMutex.Lock()
-	defer db.graphMutex.Unlock()
-	
-	if _, exists := db.graphNodes[id]; exists {
-		return fmt.Errorf("node with id %s already exists", id)
-	}
-	
 	node := &GraphNode{
 		ID:     id,
 		Labels: labels,
 		Props:  props,
 	}
 	
-	db.graphNodes[id] = node
-	return nil
+	event := &WriteEvent{Model: ModelGraph, Namespace: "nodes", Key: id, Value: node}
+	return db.withWriteHooks(OpInsert, event, func() error {
+		db.graphMutex.Lock()
+		defer db.graphMutex.Unlock()
+		
+		if _, exists := db.graphNodes[id]; exists {
+			return fmt.Errorf("node with id %s already exists", id)
+		}
+		
+		db.graphNodes[id] = node
+		return nil
+	})
 }
 
 func (db *MultiModelDatabase) GetNode(id string) (*GraphNode, error) {
@@ -245,6 +891,22 @@ func (db *MultiModelDatabase) GetNode(id string) (*GraphNode, error) {
 }
 
 func (db *MultiModelDatabase) CreateEdge(id, from, to, edgeType string, props interface{}) error {
+	edge := &GraphEdge{
+		ID:    id,
+		From:  from,
+		To:    to,
+		Type:  edgeType,
+		Props: props,
+	}
+	
+	event := &WriteEvent{Model: ModelGraph, Namespace: "edges", Key: id, Value: edge}
+	return db.withWriteHooks(OpInsert, event, func() error {
+		return db.createEdge(edge)
+	})
+}
+
+func (db *MultiModelDatabase) createEdge(edge *GraphEdge) error {
+	id, from, to := edge.ID, edge.From, edge.To
 	db.graphMutex.Lock()
 	defer db.graphMutex.Unlock()
 	
@@ -260,14 +922,6 @@ func (db *MultiModelDatabase) CreateEdge(id, from, to, edgeType string, props in
 		return fmt.Errorf("target node %s does not exist", to)
 	}
 	
-	edge := &GraphEdge{
-		ID:   id,
-		From: from,
-		To:   to,
-		Type: edgeType,
-		Props: props,
-	}
-	
 	db.graphEdges[id] = edge
 	return nil
 }
@@ -286,31 +940,165 @@ func (db *MultiModelDatabase) GetEdge(id string) (*GraphEdge, error) {
 
 // Query methods for each model
 func (db *MultiModelDatabase) QueryDocuments(collection string, filter map[string]interface{}) ([]Document, error) {
+	return db.QueryDocumentsContext(context.Background(), collection, filter)
+}
+
+// QueryDocumentsContext is QueryDocuments that stops with ctx's error once ctx is done
+func (db *MultiModelDatabase) QueryDocumentsContext(ctx context.Context, collection string, filter map[string]interface{}) ([]Document, error) {
+	return db.FindDocuments(ctx, collection, DocumentQuery{Filter: filter})
+}
+
+// FindDocuments returns the documents of collection matching q's filter, ordered,
+// joined and projected as q asks. A scan exceeding q's or the configured limits
+// fails with ErrQueryLimit; with q.Partial set the results found until then are
+// returned along with the error.
+func (db *MultiModelDatabase) FindDocuments(ctx context.Context, collection string, q DocumentQuery) ([]Document, error) {
+	event := &QueryEvent{Model: ModelDocument, Namespace: collection, Filter: q.Filter}
+	if err := db.beforeQuery(event); err != nil {
+		return nil, err
+	}
+	if err := db.warmCollection(collection); err != nil {
+		return nil, err
+	}
+	
+	guard, release := db.newQueryGuard(ctx, q)
+	var results []Document
+	var err error
+	if IsSystemCollection(collection) {
+		results, err = db.findSystemDocuments(guard, collection, event.Filter, q.Collation)
+	} else if plan := db.planQuery(collection, event.Filter, q.Collation); plan.Strategy == PlanIndex {
+		results, err = db.fetchDocuments(guard, collection, plan.ids, event.Filter, q.Collation)
+	} else {
+		results, err = db.scanDocuments(guard, collection, event.Filter, q.Collation)
+	}
+	release()
+	limited := errors.Is(err, ErrQueryLimit) && q.Partial
+	if err != nil && !limited {
+		return nil, err
+	}
+	if limited && results == nil {
+		results = make([]Document, 0)
+	}
+	
+	if q.Sort != "" {
+		SortDocuments(results, strings.TrimPrefix(q.Sort, "-"), strings.HasPrefix(q.Sort, "-"), q.Collation)
+	}
+	for _, lookup := range q.Lookups {
+		var joinErr error
+		if results, joinErr = db.joinDocuments(ctx, results, lookup, q.Collation); joinErr != nil {
+			return nil, joinErr
+		}
+	}
+	if len(q.Fields) > 0 {
+		for i, doc := range results {
+			results[i] = ProjectDocument(doc, q.Fields)
+		}
+	}
+	return results, err
+}
+
+// scanDocuments returns the documents of collection matching filter. When guard
+// stops the scan, the documents found so far are returned with its error.
+func (db *MultiModelDatabase) scanDocuments(guard *queryGuard, collection string, filter map[string]interface{}, collation Collation) ([]Document, error) {
 	db.docMutex.RLock()
 	defer db.docMutex.RUnlock()
 	
 	var results []Document
+	virtual := db.computed.get(collection, false)
 	
 	for key, doc := range db.documents {
 		if collection == "" || len(collection) <= len(key) && key[:len(collection)] == collection {
+			if err := guard.examine(); err != nil {
+				return results, err
+			}
+			doc = computeFields(db.expandDocument(doc), virtual)
 			// Apply filters
-			matches := true
-			for field, expectedValue := range filter {
-				if actualValue, exists := doc[field]; !exists || actualValue != expectedValue {
-					matches = false
-					break
-				}
+			if collation.objectMatches(doc, filter) {
+				results = append(results, doc)
 			}
-			
-			if matches {
+		} else if err := guard.err(); err != nil {
+			return results, err
+		}
+	}
+	for name, a := range db.archives {
+		if collection != "" && name != collection {
+			continue
+		}
+		var err error
+		if eachErr := a.each(func(id string, doc Document) bool {
+			if err = guard.examine(); err != nil {
+				return false
+			}
+			if doc = computeFields(doc, virtual); collation.objectMatches(doc, filter) {
 				results = append(results, doc)
 			}
+			return true
+		}); eachErr != nil {
+			return results, eachErr
+		}
+		if err != nil {
+			return results, err
 		}
 	}
+	return results, nil
+}
+
+// fetchDocuments returns the documents of collection with the given ids that match
+// filter, as scanDocuments does for the whole collection
+func (db *MultiModelDatabase) fetchDocuments(guard *queryGuard, collection string, ids []string, filter map[string]interface{}, collation Collation) ([]Document, error) {
+	db.docMutex.RLock()
+	defer db.docMutex.RUnlock()
 	
+	var results []Document
+	virtual := db.computed.get(collection, false)
+	archived := db.archived(collection)
+	for _, id := range ids {
+		if err := guard.examine(); err != nil {
+			return results, err
+		}
+		doc, exists := db.documents[collection+"."+id]
+		if archived != nil {
+			var err error
+			if doc, exists, err = archived.get(id); err != nil {
+				return results, err
+			}
+		}
+		if doc = computeFields(db.expandDocument(doc), virtual); exists && collation.objectMatches(doc, filter) {
+			results = append(results, doc)
+		}
+	}
 	return results, nil
 }
 
+// ExplainQuery returns the plan FindDocuments would follow for q, without running it
+func (db *MultiModelDatabase) ExplainQuery(collection string, q DocumentQuery) (*QueryPlan, error) {
+	event := &QueryEvent{Model: ModelDocument, Namespace: collection, Filter: q.Filter}
+	if err := db.beforeQuery(event); err != nil {
+		return nil, err
+	}
+	if err := db.warmCollection(collection); err != nil {
+		return nil, err
+	}
+	
+	plan := db.planQuery(collection, event.Filter, q.Collation)
+	if len(plan.Candidates) == 0 {
+		// No index statistics to count the collection from
+		db.docMutex.RLock()
+		prefix := collection + "."
+		for key := range db.documents {
+			if strings.HasPrefix(key, prefix) {
+				plan.Documents++
+			}
+		}
+		if a := db.archived(collection); a != nil {
+			plan.Documents += a.len()
+		}
+		db.docMutex.RUnlock()
+		plan.Estimated = plan.Documents
+	}
+	return plan, nil
+}
+
 // JSON serialization helper
 func (db *MultiModelDatabase) ToJSON(v interface{}) ([]byte, error) {
 	return json.MarshalIndent(v, "", "  ")
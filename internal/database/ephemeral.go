@@ -0,0 +1,38 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"multimodel-db-engine/internal/config"
+)
+
+// ephemeralConfig returns a copy of cfg whose data directory is a fresh temporary
+// directory, removed again when the database is closed
+func ephemeralConfig(cfg *config.Config) (*config.Config, error) {
+	dir, err := os.MkdirTemp("", "jettradb-ephemeral-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ephemeral data directory: %w", err)
+	}
+	ephemeral := *cfg
+	ephemeral.DataDir = dir
+	return &ephemeral, nil
+}
+
+// Ephemeral reports whether the database keeps nothing beyond its lifetime. Blobs,
+// queue journals, jobs, backups and archives then live in a temporary directory that
+// is removed on Close, so tooling must not restore data it cares about into it.
+func (db *MultiModelDatabase) Ephemeral() bool {
+	return db.config.Ephemeral
+}
+
+// removeEphemeralData deletes the temporary data directory of an ephemeral database
+func (db *MultiModelDatabase) removeEphemeralData() {
+	if !db.config.Ephemeral {
+		return
+	}
+	if err := os.RemoveAll(db.config.DataDir); err != nil {
+		log.Printf("Failed to remove ephemeral data directory %s: %v", db.config.DataDir, err)
+	}
+}
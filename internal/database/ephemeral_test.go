@@ -0,0 +1,37 @@
+package database
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"multimodel-db-engine/internal/config"
+)
+
+func TestEphemeralDatabaseRemovesItsData(t *testing.T) {
+	cfg := &config.Config{DataDir: t.TempDir(), ReplicationFactor: 1, Ephemeral: true}
+	db := NewMultiModelDatabase(cfg)
+	dir := db.Config().DataDir
+	if dir == cfg.DataDir || !db.Ephemeral() {
+		t.Fatalf("ephemeral database uses the configured directory %s", dir)
+	}
+	if err := db.InsertDocument("users", "u1", Document{"name": "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetKeyValue("k", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Blobs.PutBlob("files", "a.txt", "text/plain", nil, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := db.Stats()
+	if !stats.Ephemeral || stats.Collections != 1 || stats.Documents != 1 || stats.Keys != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	db.Close()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("ephemeral data directory left behind: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"sync"
+	"time"
+)
+
+// Cluster event types
+const (
+	EventNodeJoined     = "node_joined"     // a node was added to the membership
+	EventNodeLeft       = "node_left"       // a node was removed from the membership
+	EventNodeDown       = "node_down"       // a node stopped answering heartbeats
+	EventNodeUp         = "node_up"         // a node answers heartbeats again
+	EventFailover       = "failover"        // partitions of a lost node passed to other owners
+	EventRebalance      = "rebalance"       // partitions passed to a joined or recovered node
+	EventPartitionSplit = "partition_split" // the leader split a partition
+	EventPartitionMap   = "partition_map"   // a newer partition map was adopted
+	EventRepairStarted  = "repair_started"  // a state transfer began streaming partitions
+	EventRepairProgress = "repair_progress" // a state transfer received a chunk
+	EventRepairFinished = "repair_finished" // a state transfer ended
+	EventMemoryWarning  = "memory_warning"  // memory use crossed a warning threshold of the budget
+	EventMemoryEvicted  = "memory_evicted"  // data was evicted to return within the memory budget
+)
+
+// eventHistory is the number of recent events kept for subscribers that reconnect
+const eventHistory = 256
+
+// eventBuffer is the number of events a subscriber may fall behind before it is
+// dropped
+const eventBuffer = 64
+
+// ClusterEvent is a topology change observed by this node. Ids increase by one per
+// event on each node.
+type ClusterEvent struct {
+	ID   uint64      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Node string      `json:"node,omitempty"` // the node the event concerns
+	Data interface{} `json:"data,omitempty"`
+}
+
+// eventHub fans cluster events out to subscribers and keeps the latest ones
+type eventHub struct {
+	nextID      uint64
+	history     []ClusterEvent
+	subscribers map[chan ClusterEvent]struct{}
+	mutex       sync.Mutex
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{nextID: 1, subscribers: make(map[chan ClusterEvent]struct{})}
+}
+
+// publish records an event and sends it to every subscriber. Subscribers whose
+// buffer is full are dropped rather than blocking the cluster; they reconnect and
+// resume from the last event they received.
+func (h *eventHub) publish(eventType, node string, data interface{}) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	event := ClusterEvent{ID: h.nextID, Type: eventType, Time: time.Now(), Node: node, Data: data}
+	h.nextID++
+	h.history = append(h.history, event)
+	if len(h.history) > eventHistory {
+		h.history = h.history[len(h.history)-eventHistory:]
+	}
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe returns the kept events after id and a channel receiving later ones,
+// closed when the subscriber falls behind, and a function ending the subscription
+func (h *eventHub) subscribe(after uint64) ([]ClusterEvent, <-chan ClusterEvent, func()) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	backlog := make([]ClusterEvent, 0)
+	for _, event := range h.history {
+		if event.ID > after {
+			backlog = append(backlog, event)
+		}
+	}
+	ch := make(chan ClusterEvent, eventBuffer)
+	h.subscribers[ch] = struct{}{}
+	cancel := func() {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		if _, exists := h.subscribers[ch]; exists {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+	return backlog, ch, cancel
+}
+
+// SubscribeEvents returns the kept cluster events with ids after after, a channel
+// receiving the events that follow and a function ending the subscription. The
+// channel is closed when the subscriber falls too far behind.
+func (c *Cluster) SubscribeEvents(after uint64) ([]ClusterEvent, <-chan ClusterEvent, func()) {
+	return c.events.subscribe(after)
+}
+
+// membershipChanged publishes the state change of a node and the partitions whose
+// owner changed with it. Callers must hold nodesMutex; before are the active nodes
+// before the change.
+func (c *Cluster) membershipChanged(eventType, nodeID string, before []*Node) {
+	c.events.publish(eventType, nodeID, nil)
+
+	after := c.activeNodes()
+	owners := make(map[string]string)
+	for _, partition := range c.Partitions() {
+		from, to := partitionOwner(partition, before), partitionOwner(partition, after)
+		if from != nil && to != nil && from.ID != to.ID {
+			owners[partition.ID] = to.ID
+		}
+	}
+	if len(owners) == 0 {
+		return
+	}
+	kind := EventRebalance
+	if eventType == EventNodeDown || eventType == EventNodeLeft {
+		kind = EventFailover
+	}
+	c.events.publish(kind, nodeID, map[string]interface{}{"owners": owners})
+}
@@ -0,0 +1,36 @@
+package database
+
+import "testing"
+
+func TestEventHubReplaysAndDropsSlowSubscribers(t *testing.T) {
+	hub := newEventHub()
+	hub.publish(EventNodeJoined, "node-1", nil)
+	hub.publish(EventNodeDown, "node-1", nil)
+
+	backlog, events, cancel := hub.subscribe(1)
+	defer cancel()
+	if len(backlog) != 1 || backlog[0].ID != 2 || backlog[0].Type != EventNodeDown {
+		t.Fatalf("expected the event after id 1 to be replayed, got %+v", backlog)
+	}
+	hub.publish(EventNodeUp, "node-1", nil)
+	if event := <-events; event.ID != 3 || event.Node != "node-1" {
+		t.Fatalf("unexpected live event %+v", event)
+	}
+
+	// A subscriber that stops reading is dropped instead of blocking publishers
+	for i := 0; i <= eventBuffer; i++ {
+		hub.publish(EventRebalance, "", nil)
+	}
+	received := 0
+	for range events {
+		received++
+	}
+	if received != eventBuffer {
+		t.Fatalf("expected %d buffered events before the channel closed, got %d", eventBuffer, received)
+	}
+	if backlog, _, cancel := hub.subscribe(0); len(backlog) != 3+eventBuffer+1 {
+		t.Fatalf("expected all events to be kept, got %d", len(backlog))
+	} else {
+		cancel()
+	}
+}
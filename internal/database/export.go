@@ -0,0 +1,190 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Export column types, chosen to map directly onto Parquet and pandas dtypes
+const (
+	ExportBoolean = "boolean"
+	ExportInt64   = "int64"
+	ExportDouble  = "double"
+	ExportString  = "string"
+	ExportJSON    = "json" // objects, arrays and fields with conflicting types, JSON-encoded
+)
+
+// ExportIDColumn holds the document id in exports
+const ExportIDColumn = "_id"
+
+// ExportColumn is one column of an export schema
+type ExportColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// ExportTable is a collection flattened into typed columns. Rows hold one value per
+// column, nil where a document lacks the field; values are bool, int64, float64 or
+// string as given by the column type, with ExportJSON columns already encoded.
+type ExportTable struct {
+	Collection string          `json:"collection"`
+	Columns    []ExportColumn  `json:"columns"`
+	Rows       [][]interface{} `json:"-"`
+}
+
+// ExportCollection returns the documents of collection as a table, ordered by id.
+// The schema is inferred from the top-level fields of every document.
+func (db *MultiModelDatabase) ExportCollection(ctx context.Context, collection string) (*ExportTable, error) {
+	ids, docs, err := db.collectionDocuments(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	check := cancelCheck{ctx: ctx}
+
+	types := make(map[string]string)
+	for _, id := range ids {
+		for field, value := range docs[id] {
+			if field == ExportIDColumn {
+				continue
+			}
+			types[field] = mergeExportType(types[field], exportType(value))
+		}
+	}
+
+	table := &ExportTable{Collection: collection, Columns: []ExportColumn{{Name: ExportIDColumn, Type: ExportString}}}
+	for _, field := range sortedKeys(types) {
+		columnType := types[field]
+		if columnType == "" {
+			// Only ever null; strings are the most forgiving type for readers
+			columnType = ExportString
+		}
+		table.Columns = append(table.Columns, ExportColumn{Name: field, Type: columnType})
+	}
+
+	for _, id := range ids {
+		if err := check.err(); err != nil {
+			return nil, err
+		}
+		row := make([]interface{}, len(table.Columns))
+		row[0] = id
+		for i, column := range table.Columns[1:] {
+			value, err := exportValue(docs[id][column.Name], column.Type)
+			if err != nil {
+				return nil, fmt.Errorf("document %s field %s: %w", id, column.Name, err)
+			}
+			row[i+1] = value
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table, nil
+}
+
+// exportType returns the narrowest export type of value, or "" for null
+func exportType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case bool:
+		return ExportBoolean
+	case int, int8, int16, int32, int64, uint8, uint16, uint32:
+		return ExportInt64
+	case float32:
+		return exportFloatType(float64(v))
+	case float64:
+		return exportFloatType(v)
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return ExportInt64
+		}
+		return ExportDouble
+	case string:
+		return ExportString
+	default:
+		return ExportJSON
+	}
+}
+
+// exportFloatType treats integral JSON numbers as integers, as documents decoded
+// from request bodies hold every number as float64
+func exportFloatType(f float64) string {
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return ExportInt64
+	}
+	return ExportDouble
+}
+
+// mergeExportType widens a column type to hold a value of another type
+func mergeExportType(current, next string) string {
+	switch {
+	case current == "" || current == next:
+		return next
+	case next == "":
+		return current
+	case current == ExportInt64 && next == ExportDouble, current == ExportDouble && next == ExportInt64:
+		return ExportDouble
+	default:
+		return ExportJSON
+	}
+}
+
+// exportValue converts value to the representation of columnType
+func exportValue(value interface{}, columnType string) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch columnType {
+	case ExportInt64:
+		switch v := value.(type) {
+		case json.Number:
+			return v.Int64()
+		case float64:
+			return int64(v), nil
+		case float32:
+			return int64(v), nil
+		}
+		return exportInteger(value), nil
+	case ExportDouble:
+		switch v := value.(type) {
+		case json.Number:
+			return v.Float64()
+		case float64:
+			return v, nil
+		case float32:
+			return float64(v), nil
+		}
+		return float64(exportInteger(value)), nil
+	case ExportJSON:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return string(encoded), nil
+	default:
+		return value, nil
+	}
+}
+
+// exportInteger converts the Go integer types accepted by exportType
+func exportInteger(value interface{}) int64 {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	}
+	return 0
+}
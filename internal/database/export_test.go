@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestExportCollectionInfersSchema(t *testing.T) {
+	db := newTestDatabase(t)
+	docs := map[string]Document{
+		"a": {"age": float64(3), "score": 1.5, "tags": []interface{}{"x"}, "mixed": "text"},
+		"b": {"age": float64(4), "score": float64(2), "active": true, "mixed": float64(1)},
+	}
+	for id, doc := range docs {
+		if err := db.InsertDocument("users", id, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.InsertDocument("users2", "c", Document{"other": "field"}); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := db.ExportCollection(context.Background(), "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ExportColumn{
+		{ExportIDColumn, ExportString},
+		{"active", ExportBoolean},
+		{"age", ExportInt64},
+		{"mixed", ExportJSON},
+		{"score", ExportDouble},
+		{"tags", ExportJSON},
+	}
+	if !reflect.DeepEqual(table.Columns, want) {
+		t.Fatalf("columns = %+v", table.Columns)
+	}
+	rows := [][]interface{}{
+		{"a", nil, int64(3), `"text"`, 1.5, `["x"]`},
+		{"b", true, int64(4), "1", float64(2), nil},
+	}
+	if !reflect.DeepEqual(table.Rows, rows) {
+		t.Fatalf("rows = %+v", table.Rows)
+	}
+}
@@ -0,0 +1,458 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Expression is a parsed computed field expression such as price * qty or
+// concat(first, " ", last). Fields are referenced by name or dot path; numbers,
+// 'strings', true, false and null are literals. + - * / % apply to numbers, + also
+// joins strings. A missing field or a value of the wrong type makes the result null.
+type Expression struct {
+	source string
+	root   exprNode
+}
+
+// exprNode evaluates part of an expression against a document
+type exprNode interface {
+	eval(doc Document) interface{}
+}
+
+// exprFunctions are the functions expressions may call, by name
+var exprFunctions = map[string]func(args []interface{}) interface{}{
+	"lower": func(args []interface{}) interface{} {
+		if s, ok := exprArg(args, 0).(string); ok {
+			return strings.ToLower(s)
+		}
+		return nil
+	},
+	"upper": func(args []interface{}) interface{} {
+		if s, ok := exprArg(args, 0).(string); ok {
+			return strings.ToUpper(s)
+		}
+		return nil
+	},
+	"len": func(args []interface{}) interface{} {
+		switch v := exprArg(args, 0).(type) {
+		case string:
+			return float64(len([]rune(v)))
+		case []interface{}:
+			return float64(len(v))
+		case map[string]interface{}:
+			return float64(len(v))
+		}
+		return nil
+	},
+	"concat": func(args []interface{}) interface{} {
+		var b strings.Builder
+		for _, arg := range args {
+			s, ok := exprString(arg)
+			if !ok {
+				return nil
+			}
+			b.WriteString(s)
+		}
+		return b.String()
+	},
+	"coalesce": func(args []interface{}) interface{} {
+		for _, arg := range args {
+			if arg != nil {
+				return arg
+			}
+		}
+		return nil
+	},
+	"abs": func(args []interface{}) interface{} {
+		if f, ok := numberValue(exprArg(args, 0)); ok {
+			return math.Abs(f)
+		}
+		return nil
+	},
+	"round": func(args []interface{}) interface{} {
+		f, ok := numberValue(exprArg(args, 0))
+		if !ok {
+			return nil
+		}
+		places := 0.0
+		if len(args) > 1 {
+			if places, ok = numberValue(args[1]); !ok {
+				return nil
+			}
+		}
+		scale := math.Pow(10, places)
+		return math.Round(f*scale) / scale
+	},
+	"min": func(args []interface{}) interface{} { return exprExtreme(args, -1) },
+	"max": func(args []interface{}) interface{} { return exprExtreme(args, 1) },
+	"sum": func(args []interface{}) interface{} {
+		elements, ok := exprArg(args, 0).([]interface{})
+		if !ok {
+			return nil
+		}
+		total := 0.0
+		for _, element := range elements {
+			f, ok := numberValue(element)
+			if !ok {
+				return nil
+			}
+			total += f
+		}
+		return total
+	},
+}
+
+// ParseExpression parses a computed field expression
+func ParseExpression(source string) (*Expression, error) {
+	p := &exprParser{source: source}
+	p.next()
+	root, err := p.parseSum()
+	if err == nil {
+		err = p.err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", source, err)
+	}
+	if p.token.kind != tokenEnd {
+		return nil, fmt.Errorf("invalid expression %q: unexpected %q at %d", source, p.token.text, p.token.pos)
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+// Evaluate returns the value of the expression for doc
+func (e *Expression) Evaluate(doc Document) interface{} {
+	return e.root.eval(doc)
+}
+
+// String returns the source of the expression
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Fields returns the document fields the expression reads
+func (e *Expression) Fields() []string {
+	fields := make(map[string]bool)
+	var walk func(node exprNode)
+	walk = func(node exprNode) {
+		switch n := node.(type) {
+		case exprField:
+			fields[string(n)] = true
+		case *exprBinary:
+			walk(n.left)
+			walk(n.right)
+		case *exprCall:
+			for _, arg := range n.args {
+				walk(arg)
+			}
+		}
+	}
+	walk(e.root)
+	return sortedKeys(fields)
+}
+
+type exprLiteral struct{ value interface{} }
+
+func (n exprLiteral) eval(Document) interface{} { return n.value }
+
+type exprField string
+
+func (n exprField) eval(doc Document) interface{} {
+	value, _ := lookupPath(doc, string(n))
+	return value
+}
+
+type exprBinary struct {
+	op          byte
+	left, right exprNode
+}
+
+func (n *exprBinary) eval(doc Document) interface{} {
+	left, right := n.left.eval(doc), n.right.eval(doc)
+	if n.op == '+' {
+		_, leftString := left.(string)
+		_, rightString := right.(string)
+		if leftString || rightString {
+			l, lok := exprString(left)
+			r, rok := exprString(right)
+			if !lok || !rok {
+				return nil
+			}
+			return l + r
+		}
+	}
+
+	l, lok := numberValue(left)
+	r, rok := numberValue(right)
+	if !lok || !rok {
+		return nil
+	}
+	switch n.op {
+	case '+':
+		return l + r
+	case '-':
+		return l - r
+	case '*':
+		return l * r
+	case '/':
+		if r == 0 {
+			return nil
+		}
+		return l / r
+	case '%':
+		if r == 0 {
+			return nil
+		}
+		return math.Mod(l, r)
+	}
+	return nil
+}
+
+type exprCall struct {
+	name string
+	fn   func(args []interface{}) interface{}
+	args []exprNode
+}
+
+func (n *exprCall) eval(doc Document) interface{} {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		args[i] = arg.eval(doc)
+	}
+	return n.fn(args)
+}
+
+func exprArg(args []interface{}, i int) interface{} {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
+
+// exprString returns strings and numbers as strings, for concatenation
+func exprString(v interface{}) (string, bool) {
+	if s, ok := v.(string); ok {
+		return s, true
+	}
+	if f, ok := numberValue(v); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+// exprExtreme returns the smallest (sign -1) or largest (sign 1) numeric argument,
+// or element of a single array argument
+func exprExtreme(args []interface{}, sign float64) interface{} {
+	if len(args) == 1 {
+		if elements, isArray := args[0].([]interface{}); isArray {
+			args = elements
+		}
+	}
+	var result interface{}
+	for _, arg := range args {
+		f, ok := numberValue(arg)
+		if !ok {
+			return nil
+		}
+		if best, _ := numberValue(result); result == nil || (f-best)*sign > 0 {
+			result = f
+		}
+	}
+	return result
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOp
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// exprParser is a recursive descent parser over the tokens of an expression
+type exprParser struct {
+	source string
+	pos    int
+	token  exprToken
+	err    error
+}
+
+// next reads the following token
+func (p *exprParser) next() {
+	for p.pos < len(p.source) && p.source[p.pos] == ' ' {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.source) {
+		p.token = exprToken{kind: tokenEnd, pos: start}
+		return
+	}
+
+	c := p.source[p.pos]
+	switch {
+	case c >= '0' && c <= '9' || c == '.':
+		for p.pos < len(p.source) && (p.source[p.pos] >= '0' && p.source[p.pos] <= '9' || p.source[p.pos] == '.') {
+			p.pos++
+		}
+		p.token = exprToken{kind: tokenNumber, text: p.source[start:p.pos], pos: start}
+	case c == '\'' || c == '"':
+		p.pos++
+		var b strings.Builder
+		for p.pos < len(p.source) && p.source[p.pos] != c {
+			if p.source[p.pos] == '\\' && p.pos+1 < len(p.source) {
+				p.pos++
+			}
+			b.WriteByte(p.source[p.pos])
+			p.pos++
+		}
+		if p.pos >= len(p.source) {
+			p.err = fmt.Errorf("unterminated string at %d", start)
+		}
+		p.pos++
+		p.token = exprToken{kind: tokenString, text: b.String(), pos: start}
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		for p.pos < len(p.source) && isIdentByte(p.source[p.pos]) {
+			p.pos++
+		}
+		p.token = exprToken{kind: tokenIdent, text: p.source[start:p.pos], pos: start}
+	default:
+		p.pos++
+		p.token = exprToken{kind: tokenOp, text: p.source[start:p.pos], pos: start}
+	}
+}
+
+// isIdentByte reports whether c may appear in a field name or dot path
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// parseSum parses terms joined by + and -
+func (p *exprParser) parseSum() (exprNode, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.token.kind == tokenOp && (p.token.text == "+" || p.token.text == "-") {
+		op := p.token.text[0]
+		p.next()
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprBinary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseProduct parses operands joined by *, / and %
+func (p *exprParser) parseProduct() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.token.kind == tokenOp && strings.Contains("*/%", p.token.text) {
+		op := p.token.text[0]
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprBinary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.token.kind == tokenOp && p.token.text == "-" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprBinary{op: '-', left: exprLiteral{float64(0)}, right: operand}, nil
+	}
+	return p.parseOperand()
+}
+
+func (p *exprParser) parseOperand() (exprNode, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	token := p.token
+	switch token.kind {
+	case tokenNumber:
+		f, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", token.text, token.pos)
+		}
+		p.next()
+		return exprLiteral{f}, nil
+	case tokenString:
+		p.next()
+		return exprLiteral{token.text}, nil
+	case tokenIdent:
+		p.next()
+		switch token.text {
+		case "true":
+			return exprLiteral{true}, nil
+		case "false":
+			return exprLiteral{false}, nil
+		case "null":
+			return exprLiteral{nil}, nil
+		}
+		if p.token.kind == tokenOp && p.token.text == "(" {
+			return p.parseCall(token)
+		}
+		return exprField(token.text), nil
+	case tokenOp:
+		if token.text == "(" {
+			p.next()
+			inner, err := p.parseSum()
+			if err != nil {
+				return nil, err
+			}
+			if p.token.kind != tokenOp || p.token.text != ")" {
+				return nil, fmt.Errorf("missing ) at %d", p.token.pos)
+			}
+			p.next()
+			return inner, nil
+		}
+	case tokenEnd:
+		return nil, fmt.Errorf("unexpected end")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", token.text, token.pos)
+}
+
+// parseCall parses the arguments of a function call, the current token being (
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	fn, exists := exprFunctions[name.text]
+	if !exists {
+		return nil, fmt.Errorf("unknown function %s at %d", name.text, name.pos)
+	}
+	call := &exprCall{name: name.text, fn: fn}
+	p.next()
+	for !(p.token.kind == tokenOp && p.token.text == ")") {
+		if len(call.args) > 0 {
+			if p.token.kind != tokenOp || p.token.text != "," {
+				return nil, fmt.Errorf("expected , or ) at %d", p.token.pos)
+			}
+			p.next()
+		}
+		arg, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+	}
+	p.next()
+	return call, nil
+}
@@ -0,0 +1,128 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrInjectedFault is returned by operations failed on purpose by the fault injector
+var ErrInjectedFault = errors.New("injected fault")
+
+// FaultPoint identifies where a fault is injected
+type FaultPoint string
+
+// Supported fault points
+const (
+	FaultJournalWrite    FaultPoint = "journal_write"    // tear a queue journal append midway, as if the process died
+	FaultReplicationDrop FaultPoint = "replication_drop" // drop replication messages to other nodes
+	FaultHeartbeatDelay  FaultPoint = "heartbeat_delay"  // delay heartbeats to other nodes by Delay
+)
+
+// Fault describes a fault armed at a fault point
+type Fault struct {
+	Point       FaultPoint `json:"point"`
+	Probability float64    `json:"probability,omitempty"` // chance per operation, 0 means always
+	Delay       string     `json:"delay,omitempty"`       // e.g. "2s", for delay faults
+	Remaining   int        `json:"remaining,omitempty"`   // triggers left before the fault disarms, 0 means unlimited
+	Triggered   int        `json:"triggered"`
+
+	delay time.Duration
+}
+
+// FaultInjector arms faults at fixed points in the engine so crash recovery and
+// cluster behavior can be tested automatically. It only exists when the database is
+// configured with FaultInjection; a nil injector never fires.
+type FaultInjector struct {
+	faults map[FaultPoint]*Fault
+	rng    *rand.Rand
+	mutex  sync.Mutex
+}
+
+// NewFaultInjector creates an injector with no faults armed
+func NewFaultInjector() *FaultInjector {
+	return &FaultInjector{
+		faults: make(map[FaultPoint]*Fault),
+		rng:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Set arms fault, replacing any fault at the same point
+func (f *FaultInjector) Set(fault Fault) error {
+	switch fault.Point {
+	case FaultJournalWrite, FaultReplicationDrop, FaultHeartbeatDelay:
+	default:
+		return fmt.Errorf("unknown fault point %q", fault.Point)
+	}
+	if fault.Probability < 0 || fault.Probability > 1 {
+		return fmt.Errorf("fault probability must be between 0 and 1")
+	}
+	if fault.Remaining < 0 {
+		return fmt.Errorf("fault remaining count must not be negative")
+	}
+	if fault.Delay != "" {
+		delay, err := time.ParseDuration(fault.Delay)
+		if err != nil || delay < 0 {
+			return fmt.Errorf("invalid fault delay %q", fault.Delay)
+		}
+		fault.delay = delay
+	}
+	if fault.Point == FaultHeartbeatDelay && fault.delay == 0 {
+		return fmt.Errorf("fault %s requires a delay", fault.Point)
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	fault.Triggered = 0
+	f.faults[fault.Point] = &fault
+	return nil
+}
+
+// Clear disarms the fault at point
+func (f *FaultInjector) Clear(point FaultPoint) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.faults, point)
+}
+
+// List returns the armed faults ordered by point
+func (f *FaultInjector) List() []Fault {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	faults := make([]Fault, 0, len(f.faults))
+	for _, fault := range f.faults {
+		faults = append(faults, *fault)
+	}
+	sort.Slice(faults, func(i, j int) bool { return faults[i].Point < faults[j].Point })
+	return faults
+}
+
+// trigger reports whether the fault at point fires for this operation, with its delay
+func (f *FaultInjector) trigger(point FaultPoint) (time.Duration, bool) {
+	if f == nil {
+		return 0, false
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	fault, armed := f.faults[point]
+	if !armed {
+		return 0, false
+	}
+	if fault.Probability > 0 && f.rng.Float64() >= fault.Probability {
+		return 0, false
+	}
+	fault.Triggered++
+	if fault.Remaining > 0 {
+		fault.Remaining--
+		if fault.Remaining == 0 {
+			delete(f.faults, point)
+		}
+	}
+	return fault.delay, true
+}
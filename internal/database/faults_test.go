@@ -0,0 +1,177 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"multimodel-db-engine/internal/config"
+)
+
+func newFaultyQueueStore(t *testing.T, dir string) (*QueueStore, *FaultInjector) {
+	t.Helper()
+	store := NewQueueStore(dir)
+	store.faults = NewFaultInjector()
+	t.Cleanup(store.Close)
+	return store, store.faults
+}
+
+func TestQueueJournalCrashRecovery(t *testing.T) {
+	dir := t.TempDir()
+	store, faults := newFaultyQueueStore(t, dir)
+
+	for i := 0; i < 3; i++ {
+		if _, err := store.Enqueue("jobs", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	delivered, err := store.Dequeue("jobs", 1, time.Minute)
+	if err != nil || len(delivered) != 1 {
+		t.Fatalf("dequeue: %v, %v", delivered, err)
+	}
+	if err := store.Ack("jobs", delivered[0].ID, delivered[0].Receipt); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := faults.Set(Fault{Point: FaultJournalWrite, Remaining: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Enqueue("jobs", "lost"); !errors.Is(err, ErrInjectedFault) {
+		t.Fatalf("expected injected fault, got %v", err)
+	}
+
+	// The torn record must neither surface nor swallow the records appended after it
+	if _, err := store.Enqueue("jobs", 3); err != nil {
+		t.Fatalf("enqueue after crash: %v", err)
+	}
+	assertQueue(t, store, []interface{}{1.0, 2.0, 3.0})
+
+	journal, err := os.ReadFile(store.journalPath("jobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(journal, []byte("\n")) || bytes.Contains(journal, []byte("lost")) {
+		t.Fatalf("journal was not repaired:\n%s", journal)
+	}
+
+	// A restarted store sees the same messages
+	restarted, _ := newFaultyQueueStore(t, dir)
+	assertQueue(t, restarted, []interface{}{1.0, 2.0, 3.0})
+}
+
+func TestQueueJournalTornTailOnDisk(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := newFaultyQueueStore(t, dir)
+	if _, err := store.Enqueue("jobs", "kept"); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	file, err := os.OpenFile(store.journalPath("jobs"), os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"op":"enqueue","id":"torn","seq":9,"payl`)
+	file.Close()
+
+	restarted, _ := newFaultyQueueStore(t, dir)
+	if _, err := restarted.Enqueue("jobs", "after"); err != nil {
+		t.Fatal(err)
+	}
+	again, _ := newFaultyQueueStore(t, dir)
+	assertQueue(t, again, []interface{}{"kept", "after"})
+}
+
+// assertQueue dequeues everything and compares the payloads in order
+func assertQueue(t *testing.T, store *QueueStore, expected []interface{}) {
+	t.Helper()
+	messages, err := store.Dequeue("jobs", 100, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != len(expected) {
+		t.Fatalf("expected %d messages, got %d", len(expected), len(messages))
+	}
+	for i, msg := range messages {
+		if normalizeJSON(t, msg.Payload) != expected[i] {
+			t.Fatalf("message %d: expected %v, got %v", i, expected[i], msg.Payload)
+		}
+	}
+}
+
+func TestReplicationDropFault(t *testing.T) {
+	var received int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&received, 1)
+	}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	faults := NewFaultInjector()
+	cluster := newCluster(&config.Config{ReplicationFactor: 2}, faults, NewHLC())
+	defer cluster.Close()
+	peer := &Node{ID: "peer", Address: host, Port: port, Status: "active"}
+
+	if err := faults.Set(Fault{Point: FaultReplicationDrop, Remaining: 2}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		err := cluster.replicateToNode(peer, "key", i, cluster.clock.Now())
+		if dropped := i < 2; dropped != errors.Is(err, ErrInjectedFault) {
+			t.Fatalf("message %d: unexpected result %v", i, err)
+		}
+	}
+	if got := atomic.LoadInt32(&received); got != 1 {
+		t.Fatalf("expected 1 delivered message, got %d", got)
+	}
+	if armed := faults.List(); len(armed) != 0 {
+		t.Fatalf("fault should disarm after its remaining triggers, still armed: %+v", armed)
+	}
+}
+
+func TestHeartbeatDelayFault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	faults := NewFaultInjector()
+	cluster := newCluster(&config.Config{}, faults, NewHLC())
+	defer cluster.Close()
+	peer := &Node{ID: "peer", Address: host, Port: port, Status: "active"}
+
+	if err := faults.Set(Fault{Point: FaultHeartbeatDelay, Delay: "50ms"}); err != nil {
+		t.Fatal(err)
+	}
+	started := time.Now()
+	if !cluster.pingNode(peer) {
+		t.Fatal("delayed heartbeat should still succeed")
+	}
+	if elapsed := time.Since(started); elapsed < 50*time.Millisecond {
+		t.Fatalf("heartbeat was not delayed, took %v", elapsed)
+	}
+}
+
+func TestFaultValidation(t *testing.T) {
+	faults := NewFaultInjector()
+	for _, fault := range []Fault{
+		{Point: "disk_full"},
+		{Point: FaultJournalWrite, Probability: 2},
+		{Point: FaultHeartbeatDelay},
+		{Point: FaultHeartbeatDelay, Delay: "soon"},
+	} {
+		if err := faults.Set(fault); err == nil {
+			t.Errorf("fault %+v was accepted", fault)
+		}
+	}
+
+	var disabled *FaultInjector
+	if _, fired := disabled.trigger(FaultJournalWrite); fired {
+		t.Fatal("a nil injector must never fire")
+	}
+}
@@ -0,0 +1,181 @@
+package database
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func FuzzQueryFilter(f *testing.F) {
+	f.Add([]byte(`{"name":"ada","age":36}`), []byte(`{"name":"ada"}`))
+	f.Add([]byte(`{"tags":["a","b"],"meta":{"x":1}}`), []byte(`{"tags":["a","b"]}`))
+	f.Add([]byte(`{"n":null}`), []byte(`{"meta":{"x":1}}`))
+	f.Add([]byte(`{}`), []byte(`{}`))
+
+	db := newTestDatabase(f)
+	f.Fuzz(func(t *testing.T, docJSON, filterJSON []byte) {
+		var doc Document
+		var filter map[string]interface{}
+		if json.Unmarshal(docJSON, &doc) != nil || json.Unmarshal(filterJSON, &filter) != nil || doc == nil {
+			return
+		}
+
+		// Filters must never panic, whatever the value types
+		documentMatches(doc, filter)
+
+		if !documentMatches(doc, nil) {
+			t.Fatalf("document %s does not match the empty filter", docJSON)
+		}
+		if !documentMatches(doc, map[string]interface{}(doc)) {
+			t.Fatalf("document %s does not match itself", docJSON)
+		}
+
+		db.DeleteDocument("fuzz", "doc")
+		if err := db.InsertDocument("fuzz", "doc", doc); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+		results, err := db.QueryDocuments("fuzz", filter)
+		if err != nil {
+			t.Fatalf("query failed: %v", err)
+		}
+		if len(results) > 1 {
+			t.Fatalf("query returned %d documents from a collection of one", len(results))
+		}
+		if self, _ := db.QueryDocuments("fuzz", map[string]interface{}(doc)); len(self) != 1 {
+			t.Fatalf("querying by all fields of %s did not return it", docJSON)
+		}
+	})
+}
+
+func FuzzCompareValues(f *testing.F) {
+	f.Add("1", "2")
+	f.Add("1.0", "1")
+	f.Add("abc", "10")
+	f.Add("NaN", "Inf")
+
+	f.Fuzz(func(t *testing.T, a, b string) {
+		if got, reversed := compareValues(a, b), compareValues(b, a); got != -reversed {
+			t.Fatalf("compareValues(%q, %q) = %d but compareValues(%q, %q) = %d", a, b, got, b, a, reversed)
+		}
+		if compareValues(a, a) != 0 {
+			t.Fatalf("compareValues(%q, %q) != 0", a, a)
+		}
+	})
+}
+
+func FuzzColumnPredicates(f *testing.F) {
+	f.Add([]byte(`{"status":"active","score":10}`), "score", "gte", "5")
+	f.Add([]byte(`{"tags":["x"]}`), "tags", "eq", "x")
+	f.Add([]byte(`{}`), "missing", "exists", "")
+
+	ops := []string{"eq", "ne", "gt", "gte", "lt", "lte", "exists"}
+	f.Fuzz(func(t *testing.T, rowJSON []byte, column, op, value string) {
+		var row map[string]interface{}
+		if json.Unmarshal(rowJSON, &row) != nil {
+			return
+		}
+
+		for _, candidate := range ops {
+			rowMatchesPredicates(row, []ColumnPredicate{{Column: column, Op: candidate, Value: value}})
+		}
+
+		_, exists := row[column]
+		if got := rowMatchesPredicates(row, []ColumnPredicate{{Column: column, Op: "exists", Value: true}}); got != exists {
+			t.Fatalf("exists predicate on %q returned %v for %s", column, got, rowJSON)
+		}
+		if !isValidPredicateOp(op) {
+			return
+		}
+		rowMatchesPredicates(row, []ColumnPredicate{{Column: column, Op: op, Value: value}})
+	})
+}
+
+func FuzzParseCron(f *testing.F) {
+	f.Add("*/15 9-17 * * mon-fri")
+	f.Add("0 0 30 2 *")
+	f.Add("@every 90s")
+	f.Add("@weekly")
+	f.Add("5,10-20/3 * 1 jan,jul 7")
+
+	from := time.Date(2024, 2, 28, 23, 59, 30, 0, time.UTC)
+	f.Fuzz(func(t *testing.T, expr string) {
+		schedule, err := parseCron(expr)
+		if err != nil {
+			return
+		}
+		next := schedule.Next(from)
+		if next.IsZero() {
+			return
+		}
+		if !next.After(from) {
+			t.Fatalf("Next(%v) of %q = %v, not after the reference time", from, expr, next)
+		}
+		if schedule.every == 0 && next.Second() != 0 {
+			t.Fatalf("Next of %q = %v, not on a minute boundary", expr, next)
+		}
+	})
+}
+
+// FuzzGraphInputs checks that arbitrary node and edge identifiers are stored and
+// returned verbatim and that edges are only created between existing nodes
+func FuzzGraphInputs(f *testing.F) {
+	f.Add("a", "b", "knows")
+	f.Add("users:1", "users/2", "")
+	f.Add("", "\x00", "ü")
+
+	f.Fuzz(func(t *testing.T, from, to, edgeType string) {
+		db := newTestDatabase(t)
+		if err := db.CreateEdge("e", from, to, edgeType, nil); err == nil {
+			t.Fatalf("edge between missing nodes %q and %q was created", from, to)
+		}
+
+		if err := db.CreateNode(from, []string{"fuzz"}, map[string]interface{}{"id": from}); err != nil {
+			t.Fatalf("create node %q: %v", from, err)
+		}
+		if from != to {
+			if err := db.CreateNode(to, nil, nil); err != nil {
+				t.Fatalf("create node %q: %v", to, err)
+			}
+		}
+		if err := db.CreateEdge("e", from, to, edgeType, map[string]interface{}{"w": 1}); err != nil {
+			t.Fatalf("create edge %q -> %q: %v", from, to, err)
+		}
+
+		node, err := db.GetNode(from)
+		if err != nil || node.ID != from || node.Props["id"] != from {
+			t.Fatalf("node %q did not round-trip: %+v, %v", from, node, err)
+		}
+		edge, err := db.GetEdge("e")
+		if err != nil || edge.From != from || edge.To != to || edge.Type != edgeType {
+			t.Fatalf("edge %q -> %q did not round-trip: %+v, %v", from, to, edge, err)
+		}
+	})
+}
+
+func FuzzCompressionRoundTrip(f *testing.F) {
+	f.Add([]byte(`"`+strings.Repeat("a", 512)+`"`), 0)
+	f.Add([]byte(`{"nested":{"list":[1,2,3]},"s":"text"}`), 16)
+	f.Add([]byte(`null`), 0)
+
+	f.Fuzz(func(t *testing.T, valueJSON []byte, threshold int) {
+		var value interface{}
+		if json.Unmarshal(valueJSON, &value) != nil {
+			return
+		}
+		for _, codec := range []string{"gzip", "flate"} {
+			compressed, err := compressValue(codec, threshold, value)
+			if err != nil {
+				t.Fatalf("%s: compress %s: %v", codec, valueJSON, err)
+			}
+			plain, err := decompressValue(compressed)
+			if err != nil {
+				t.Fatalf("%s: decompress %s: %v", codec, valueJSON, err)
+			}
+			if !reflect.DeepEqual(plain, value) {
+				t.Fatalf("%s: %s round-tripped to %#v", codec, valueJSON, plain)
+			}
+		}
+	})
+}
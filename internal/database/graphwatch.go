@@ -0,0 +1,96 @@
+package database
+
+import "sync"
+
+// GraphChange is a graph mutation delivered to watchers. Exactly one of Node and
+// Edge is set.
+type GraphChange struct {
+	Op        Operation  `json:"op"`
+	Node      *GraphNode `json:"node,omitempty"`
+	Edge      *GraphEdge `json:"edge,omitempty"`
+	Timestamp Timestamp  `json:"hlc"`
+}
+
+// GraphFilter selects the graph changes a watcher receives. Label selects the nodes
+// carrying it and Type the edges of that type; with only one of them set, changes
+// of the other kind are left out, and with neither every change is delivered.
+type GraphFilter struct {
+	Label string `json:"label,omitempty"`
+	Type  string `json:"type,omitempty"`
+}
+
+func (f GraphFilter) matches(change *GraphChange) bool {
+	if f.Label == "" && f.Type == "" {
+		return true
+	}
+	if change.Node != nil {
+		if f.Label == "" {
+			return false
+		}
+		for _, label := range change.Node.Labels {
+			if label == f.Label {
+				return true
+			}
+		}
+		return false
+	}
+	return f.Type != "" && change.Edge.Type == f.Type
+}
+
+// graphWatchers fans graph changes out to the watchers whose filter they match
+type graphWatchers struct {
+	watchers map[chan GraphChange]GraphFilter
+	mutex    sync.Mutex
+}
+
+func newGraphWatchers() *graphWatchers {
+	return &graphWatchers{watchers: make(map[chan GraphChange]GraphFilter)}
+}
+
+// WatchGraph returns a channel receiving the graph changes matching filter from now
+// on and a function ending the watch. The channel is closed when the watcher falls
+// more than eventBuffer changes behind, rather than holding up writes.
+func (db *MultiModelDatabase) WatchGraph(filter GraphFilter) (<-chan GraphChange, func()) {
+	w := db.graphWatchers
+	ch := make(chan GraphChange, eventBuffer)
+	w.mutex.Lock()
+	w.watchers[ch] = filter
+	w.mutex.Unlock()
+
+	cancel := func() {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+		if _, watching := w.watchers[ch]; watching {
+			delete(w.watchers, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel
+}
+
+// notify delivers an applied graph write to the watchers it matches
+func (w *graphWatchers) notify(op Operation, event *WriteEvent) {
+	change := GraphChange{Op: op, Timestamp: event.Timestamp}
+	switch value := event.Value.(type) {
+	case *GraphNode:
+		change.Node = value
+	case *GraphEdge:
+		change.Edge = value
+	default:
+		return
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for ch, filter := range w.watchers {
+		if !filter.matches(&change) {
+			continue
+		}
+		select {
+		case ch <- change:
+		default:
+			delete(w.watchers, ch)
+			close(ch)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package database
+
+import "testing"
+
+func TestWatchGraphFilters(t *testing.T) {
+	db := newTestDatabase(t)
+	people, stopPeople := db.WatchGraph(GraphFilter{Label: "Person"})
+	defer stopPeople()
+	follows, stopFollows := db.WatchGraph(GraphFilter{Type: "FOLLOWS"})
+	defer stopFollows()
+	all, stopAll := db.WatchGraph(GraphFilter{})
+	defer stopAll()
+
+	if err := db.CreateNode("alice", []string{"Person"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateNode("acme", []string{"Company"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateEdge("e1", "alice", "acme", "WORKS_AT", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateEdge("e2", "alice", "alice", "FOLLOWS", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if change := <-people; change.Node == nil || change.Node.ID != "alice" || change.Op != OpInsert {
+		t.Fatalf("expected alice, got %+v", change)
+	}
+	if change := <-follows; change.Edge == nil || change.Edge.ID != "e2" {
+		t.Fatalf("expected e2, got %+v", change)
+	}
+	if len(people) != 0 || len(follows) != 0 {
+		t.Fatalf("expected filtered changes to be left out, got %d and %d more", len(people), len(follows))
+	}
+	if len(all) != 4 {
+		t.Fatalf("expected every change without a filter, got %d", len(all))
+	}
+
+	// Ending a watch closes its channel
+	stopPeople()
+	if _, open := <-people; open {
+		t.Fatal("expected the channel to be closed")
+	}
+}
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrClockOffset is returned for remote timestamps further ahead of the local wall
+// clock than maxClockOffset
+var ErrClockOffset = errors.New("remote clock is too far ahead")
+
+// maxClockOffset bounds how far a remote timestamp may lead the local wall clock
+// before it is rejected instead of dragging the local clock forward
+const maxClockOffset = 500 * time.Millisecond
+
+// ClockHeader carries the sender's hybrid logical clock on node to node messages
+const ClockHeader = "X-Cluster-Clock"
+
+// Timestamp is a hybrid logical clock reading: a wall time in nanoseconds and a
+// logical counter ordering events within the same wall time. Timestamps compare by
+// wall time, then counter, so they follow causality across nodes even when their
+// wall clocks are skewed. They encode as "wall.logical".
+type Timestamp struct {
+	WallTime int64
+	Logical  uint32
+}
+
+// Less reports whether t orders before other
+func (t Timestamp) Less(other Timestamp) bool {
+	if t.WallTime != other.WallTime {
+		return t.WallTime < other.WallTime
+	}
+	return t.Logical < other.Logical
+}
+
+// IsZero reports whether t was never set
+func (t Timestamp) IsZero() bool {
+	return t.WallTime == 0 && t.Logical == 0
+}
+
+// Time returns the wall time part of t
+func (t Timestamp) Time() time.Time {
+	return time.Unix(0, t.WallTime)
+}
+
+func (t Timestamp) String() string {
+	return strconv.FormatInt(t.WallTime, 10) + "." + strconv.FormatUint(uint64(t.Logical), 10)
+}
+
+// ParseTimestamp parses the "wall.logical" encoding of a timestamp
+func ParseTimestamp(s string) (Timestamp, error) {
+	wall, logical, found := strings.Cut(s, ".")
+	if !found {
+		return Timestamp{}, fmt.Errorf("invalid timestamp %q", s)
+	}
+	w, err := strconv.ParseInt(wall, 10, 64)
+	if err != nil {
+		return Timestamp{}, fmt.Errorf("invalid timestamp %q", s)
+	}
+	l, err := strconv.ParseUint(logical, 10, 32)
+	if err != nil {
+		return Timestamp{}, fmt.Errorf("invalid timestamp %q", s)
+	}
+	return Timestamp{WallTime: w, Logical: uint32(l)}, nil
+}
+
+func (t Timestamp) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *Timestamp) UnmarshalText(text []byte) error {
+	parsed, err := ParseTimestamp(string(text))
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// HLC is a hybrid logical clock. Every reading is later than all readings taken or
+// received before it, and stays close to the wall clock.
+type HLC struct {
+	last     Timestamp
+	physical func() int64
+	mutex    sync.Mutex
+}
+
+// NewHLC creates a clock reading the system wall clock
+func NewHLC() *HLC {
+	return &HLC{physical: func() int64 { return time.Now().UnixNano() }}
+}
+
+// Now returns a timestamp for a local event or an outgoing message
+func (c *HLC) Now() Timestamp {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if wall := c.physical(); wall > c.last.WallTime {
+		c.last = Timestamp{WallTime: wall}
+	} else {
+		c.last.Logical++
+	}
+	return c.last
+}
+
+// Update advances the clock past a timestamp received from another node, so local
+// events after the message order after it. Timestamps too far ahead of the local wall
+// clock are rejected and leave the clock unchanged.
+func (c *HLC) Update(remote Timestamp) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	wall := c.physical()
+	if remote.WallTime-wall > int64(maxClockOffset) {
+		return fmt.Errorf("%w: %s is %s ahead", ErrClockOffset, remote, time.Duration(remote.WallTime-wall))
+	}
+	switch {
+	case wall > c.last.WallTime && wall > remote.WallTime:
+		c.last = Timestamp{WallTime: wall}
+	case remote.WallTime > c.last.WallTime:
+		c.last = Timestamp{WallTime: remote.WallTime, Logical: remote.Logical + 1}
+	case c.last.WallTime > remote.WallTime:
+		c.last.Logical++
+	default:
+		if remote.Logical > c.last.Logical {
+			c.last.Logical = remote.Logical
+		}
+		c.last.Logical++
+	}
+	return nil
+}
+
+// Last returns the latest timestamp issued or received without advancing the clock
+func (c *HLC) Last() Timestamp {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.last
+}
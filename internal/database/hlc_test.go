@@ -0,0 +1,131 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"multimodel-db-engine/internal/config"
+)
+
+// frozenClock returns a clock whose wall time only moves when *wall is changed
+func frozenClock(wall *int64) *HLC {
+	return &HLC{physical: func() int64 { return *wall }}
+}
+
+func TestHLCOrdersEventsDespiteSkew(t *testing.T) {
+	wall := int64(1000)
+	local := frozenClock(&wall)
+
+	first, second := local.Now(), local.Now()
+	if !first.Less(second) || second.WallTime != 1000 || second.Logical != 1 {
+		t.Fatalf("readings within one wall time: %v then %v", first, second)
+	}
+
+	// A message from a node whose clock runs ahead moves the local clock past it
+	remote := Timestamp{WallTime: 1000 + int64(100*time.Millisecond), Logical: 4}
+	if err := local.Update(remote); err != nil {
+		t.Fatal(err)
+	}
+	if after := local.Now(); !remote.Less(after) {
+		t.Fatalf("event after the message ordered before it: %v <= %v", after, remote)
+	}
+
+	// Readings from far in the future are not adopted
+	before := local.Last()
+	err := local.Update(Timestamp{WallTime: wall + int64(time.Hour)})
+	if !errors.Is(err, ErrClockOffset) || local.Last() != before {
+		t.Fatalf("expected the skewed reading to be rejected, got %v and %v", err, local.Last())
+	}
+
+	// Once the wall clock passes the logical part, readings follow it again
+	wall += int64(time.Second)
+	if now := local.Now(); now.WallTime != wall || now.Logical != 0 {
+		t.Fatalf("clock did not return to wall time: %v", now)
+	}
+}
+
+func TestTimestampEncoding(t *testing.T) {
+	stamp := Timestamp{WallTime: 1700000000000000000, Logical: 7}
+	encoded, err := json.Marshal(map[string]Timestamp{"hlc": stamp})
+	if err != nil || string(encoded) != `{"hlc":"1700000000000000000.7"}` {
+		t.Fatalf("unexpected encoding %s, %v", encoded, err)
+	}
+	var decoded map[string]Timestamp
+	if err := json.Unmarshal(encoded, &decoded); err != nil || decoded["hlc"] != stamp {
+		t.Fatalf("round trip: %v, %v", decoded, err)
+	}
+	if _, err := ParseTimestamp("17"); err == nil {
+		t.Fatal("expected a timestamp without logical part to be rejected")
+	}
+}
+
+func TestReplicatedWritesApplyInClockOrder(t *testing.T) {
+	cluster := NewCluster(&config.Config{NodeID: "a", ReplicationFactor: 1})
+	t.Cleanup(cluster.Close)
+
+	stored := make(map[string]interface{})
+	store := func(pairs []KeyValue) error {
+		for _, pair := range pairs {
+			stored[pair.Key] = pair.Value
+		}
+		return nil
+	}
+	older, newer := cluster.clock.Now(), cluster.clock.Now()
+	if n, err := cluster.ApplyReplicated([]KeyValue{{Key: "k", Value: "v2"}}, newer, store); err != nil || n != 1 {
+		t.Fatalf("newer write: %d %v", n, err)
+	}
+	// The older write arrives late and is dropped
+	if n, err := cluster.ApplyReplicated([]KeyValue{{Key: "k", Value: "v1"}, {Key: "j", Value: "v1"}}, older, store); err != nil || n != 1 {
+		t.Fatalf("older write: %d %v", n, err)
+	}
+	if stored["k"] != "v2" || stored["j"] != "v1" {
+		t.Fatalf("unexpected values %v", stored)
+	}
+}
+
+// stampRecorder records the timestamps of the writes it observes
+type stampRecorder struct {
+	BasePlugin
+	stamps []Timestamp
+}
+
+func (r *stampRecorder) Name() string { return "stamps" }
+
+func (r *stampRecorder) AfterWrite(op Operation, event *WriteEvent) {
+	r.stamps = append(r.stamps, event.Timestamp)
+}
+
+func TestWriteEventsCarryTimestamps(t *testing.T) {
+	db := newTestDatabase(t)
+	if err := db.InsertDocument("users", "ann", Document{"name": "Ann"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertDocument("orders", "o1", Document{"owner": map[string]interface{}{"$ref": "users", "$id": "ann"}}); err != nil {
+		t.Fatal(err)
+	}
+	recorder := &stampRecorder{}
+	if err := db.RegisterPlugin(recorder); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.MultiSetBucketValuesIf("stock", []KeyValue{{Key: "a", Value: 1}, {Key: "b", Value: 2}}, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.MoveDocument("users", "ann", "staff", MoveOptions{UpdateRefs: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CopyCollection("staff", "people", false); err != nil {
+		t.Fatal(err)
+	}
+	// Two pairs, the delete and insert of the move with its rewritten reference, the copy
+	if len(recorder.stamps) != 6 {
+		t.Fatalf("observed %d writes", len(recorder.stamps))
+	}
+	for i, stamp := range recorder.stamps {
+		if stamp.IsZero() {
+			t.Fatalf("write %d has no timestamp", i)
+		}
+	}
+}
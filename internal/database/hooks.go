@@ -0,0 +1,181 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Model identifies the data model an operation targets
+type Model string
+
+const (
+	ModelDocument Model = "document"
+	ModelKeyValue Model = "kv"
+	ModelColumn   Model = "column"
+	ModelGraph    Model = "graph"
+)
+
+// Operation identifies a write operation passed to plugins
+type Operation string
+
+const (
+	OpInsert Operation = "insert"
+	OpUpdate Operation = "update"
+	OpDelete Operation = "delete"
+)
+
+// ErrPluginRejected wraps errors returned by plugin hooks that veto an operation
+var ErrPluginRejected = errors.New("rejected by plugin")
+
+// WriteEvent describes a write as seen by plugin hooks.
+//
+// Namespace is the collection, bucket or column family ("nodes" or "edges" for the
+// graph). Key is the document id, KV key, row key or node/edge id, and Field the
+// column name for column writes. Value is the value being written: a Document for
+// inserts and the partial update for document updates, *GraphNode or *GraphEdge for
+// the graph. Before-hooks may modify Value in place to enrich the write. Timestamp
+// is the hybrid logical clock reading taken for the write, which orders writes
+// across nodes consistently with the messages exchanged between them.
+type WriteEvent struct {
+	Model     Model
+	Namespace string
+	Key       string
+	Field     string
+	Value     interface{}
+	Timestamp Timestamp
+}
+
+// QueryEvent describes a read query as seen by plugin hooks. Exactly one of Filter
+// (document queries) or Scan (column scans) is set; hooks may rewrite either.
+type QueryEvent struct {
+	Model     Model
+	Namespace string
+	Filter    map[string]interface{}
+	Scan      *ColumnScan
+}
+
+// Plugin extends the engine without changing handler code. Hooks run before the
+// operation is applied, outside of engine locks, so they may call back into the
+// database. Returning an error from a hook aborts the operation. Embed BasePlugin
+// to implement only the hooks you need.
+type Plugin interface {
+	Name() string
+	OnInsert(event *WriteEvent) error
+	OnUpdate(event *WriteEvent) error
+	OnDelete(event *WriteEvent) error
+	OnQuery(event *QueryEvent) error
+}
+
+// WriteObserver is implemented by plugins that need to see writes after they are
+// applied, e.g. to maintain custom indexes
+type WriteObserver interface {
+	AfterWrite(op Operation, event *WriteEvent)
+}
+
+// BasePlugin provides no-op hooks for embedding
+type BasePlugin struct{}
+
+func (BasePlugin) OnInsert(event *WriteEvent) error { return nil }
+func (BasePlugin) OnUpdate(event *WriteEvent) error { return nil }
+func (BasePlugin) OnDelete(event *WriteEvent) error { return nil }
+func (BasePlugin) OnQuery(event *QueryEvent) error  { return nil }
+
+// RegisterPlugin adds a plugin. Plugins are meant to be registered at startup,
+// before the server accepts requests, and run in registration order.
+func (db *MultiModelDatabase) RegisterPlugin(plugin Plugin) error {
+	db.pluginMutex.Lock()
+	defer db.pluginMutex.Unlock()
+
+	for _, existing := range db.plugins {
+		if existing.Name() == plugin.Name() {
+			return fmt.Errorf("plugin %s is already registered", plugin.Name())
+		}
+	}
+	db.plugins = append(db.plugins, plugin)
+	return nil
+}
+
+// Plugins returns the names of registered plugins
+func (db *MultiModelDatabase) Plugins() []string {
+	db.pluginMutex.RLock()
+	defer db.pluginMutex.RUnlock()
+
+	names := make([]string, 0, len(db.plugins))
+	for _, plugin := range db.plugins {
+		names = append(names, plugin.Name())
+	}
+	return names
+}
+
+func (db *MultiModelDatabase) registeredPlugins() []Plugin {
+	db.pluginMutex.RLock()
+	defer db.pluginMutex.RUnlock()
+	return db.plugins
+}
+
+// beforeWrite runs the hooks for op, stopping at the first rejection. Writes to
+// system collections and projection views are rejected before any hook runs.
+func (db *MultiModelDatabase) beforeWrite(op Operation, event *WriteEvent) error {
+	_, documentView := viewedFamily(event.Namespace)
+	_, columnView := viewedCollection(event.Namespace)
+	if (event.Model == ModelDocument && documentView) || (event.Model == ModelColumn && columnView) {
+		return fmt.Errorf("%w: %s", ErrReadOnlyView, event.Namespace)
+	}
+	if event.Model == ModelDocument && IsSystemCollection(event.Namespace) {
+		return fmt.Errorf("%w: %s", ErrSystemCollection, event.Namespace)
+	}
+	for _, plugin := range db.registeredPlugins() {
+		var err error
+		switch op {
+		case OpInsert:
+			err = plugin.OnInsert(event)
+		case OpUpdate:
+			err = plugin.OnUpdate(event)
+		case OpDelete:
+			err = plugin.OnDelete(event)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrPluginRejected, plugin.Name(), err)
+		}
+	}
+	return nil
+}
+
+// afterWrite notifies observers of an applied write
+func (db *MultiModelDatabase) afterWrite(op Operation, event *WriteEvent) {
+	db.syncLog.record(op, event)
+	if event.Model == ModelDocument {
+		db.syncReferences(event.Namespace, event.Key)
+	}
+	if event.Model == ModelGraph {
+		db.graphWatchers.notify(op, event)
+	}
+	for _, plugin := range db.registeredPlugins() {
+		if observer, ok := plugin.(WriteObserver); ok {
+			observer.AfterWrite(op, event)
+		}
+	}
+}
+
+// beforeQuery runs the query hooks
+func (db *MultiModelDatabase) beforeQuery(event *QueryEvent) error {
+	for _, plugin := range db.registeredPlugins() {
+		if err := plugin.OnQuery(event); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrPluginRejected, plugin.Name(), err)
+		}
+	}
+	return nil
+}
+
+// withWriteHooks runs the before-hooks for op, applies the write and notifies observers
+func (db *MultiModelDatabase) withWriteHooks(op Operation, event *WriteEvent, apply func() error) error {
+	event.Timestamp = db.Clock.Now()
+	if err := db.beforeWrite(op, event); err != nil {
+		return err
+	}
+	if err := apply(); err != nil {
+		return err
+	}
+	db.afterWrite(op, event)
+	return nil
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// testPlugin rejects writes to the key "forbidden", stamps inserted documents,
+// limits queries of "tenants" to tenant a and records the writes it observes
+type testPlugin struct {
+	BasePlugin
+	observed []string
+}
+
+func (p *testPlugin) Name() string { return "test" }
+
+func (p *testPlugin) OnInsert(event *WriteEvent) error {
+	if event.Key == "forbidden" {
+		return errors.New("forbidden key")
+	}
+	if doc, ok := event.Value.(Document); ok {
+		doc["stamped"] = true
+	}
+	return nil
+}
+
+func (p *testPlugin) OnUpdate(event *WriteEvent) error {
+	if event.Key == "forbidden" {
+		return errors.New("forbidden key")
+	}
+	return nil
+}
+
+func (p *testPlugin) OnQuery(event *QueryEvent) error {
+	if event.Namespace == "tenants" {
+		event.Filter = map[string]interface{}{"tenant": "a"}
+	}
+	return nil
+}
+
+func (p *testPlugin) AfterWrite(op Operation, event *WriteEvent) {
+	p.observed = append(p.observed, fmt.Sprintf("%s %s %s.%s", op, event.Model, event.Namespace, event.Key))
+}
+
+func TestPluginHooks(t *testing.T) {
+	db := newTestDatabase(t)
+	plugin := &testPlugin{}
+	if err := db.RegisterPlugin(plugin); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RegisterPlugin(&testPlugin{}); err == nil {
+		t.Fatal("plugin registered twice under one name")
+	}
+
+	// A before-hook error vetoes the write
+	if err := db.InsertDocument("users", "forbidden", Document{"name": "x"}); !errors.Is(err, ErrPluginRejected) {
+		t.Fatalf("vetoed insert: %v", err)
+	}
+	if _, err := db.GetDocument("users", "forbidden"); err == nil {
+		t.Fatal("vetoed insert was stored")
+	}
+	if err := db.SetBucketValue("cache", "forbidden", "x", 0); !errors.Is(err, ErrPluginRejected) {
+		t.Fatalf("vetoed key: %v", err)
+	}
+
+	// Changes a hook makes to the value are stored
+	if err := db.InsertDocument("users", "u1", Document{"name": "ann"}); err != nil {
+		t.Fatal(err)
+	}
+	if doc := mustGet(t, db, "users", "u1"); doc["stamped"] != true {
+		t.Fatalf("hook change not stored: %v", doc)
+	}
+
+	// Failed writes are not observed either
+	if err := db.UpdateDocument("users", "missing", Document{"name": "x"}); err == nil {
+		t.Fatal("update of a missing document succeeded")
+	}
+	if err := db.UpdateDocument("users", "u1", Document{"name": "ann b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteDocument("users", "u1"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"insert document users.u1", "update document users.u1", "delete document users.u1"}
+	if !reflect.DeepEqual(plugin.observed, want) {
+		t.Fatalf("observed %v, want %v", plugin.observed, want)
+	}
+
+	// A rewritten filter is the one the query applies
+	for id, tenant := range map[string]string{"1": "a", "2": "b"} {
+		if err := db.InsertDocument("tenants", id, Document{"tenant": tenant}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	docs, err := db.FindDocuments(context.Background(), "tenants", DocumentQuery{Filter: map[string]interface{}{"tenant": "b"}})
+	if err != nil || len(docs) != 1 || docs[0]["tenant"] != "a" {
+		t.Fatalf("query with a rewritten filter = %v, %v", docs, err)
+	}
+}
@@ -0,0 +1,388 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// IndexSpec defines a secondary index on a document field. String keys are folded
+// by the index collation, so a case insensitive index matches "Oslo" and "oslo".
+// Every index serves equality filters; Type adds prefix or trigram entries serving
+// startsWith and regex filters.
+type IndexSpec struct {
+	Collection string    `json:"collection"`
+	Field      string    `json:"field"` // a key or a dot path; arrays index every element
+	Collation  Collation `json:"collation"`
+	Type       string    `json:"type,omitempty"` // IndexHash when empty, IndexPrefix or IndexTrigram
+}
+
+// histogramBuckets is the number of buckets of index histograms
+const histogramBuckets = 10
+
+// summaryChangeRatio is the share of changed entries past which Min, Max and the
+// histogram of an index are summarized again
+const summaryChangeRatio = 0.1
+
+// IndexStats describes the values of an indexed field. The counts follow every
+// write; Min, Max and Histogram are summarized from the entries again once a tenth
+// of them changed.
+type IndexStats struct {
+	Documents   int               `json:"documents"`   // in the collection
+	Entries     int               `json:"entries"`     // indexed values, several per array
+	Cardinality int               `json:"cardinality"` // distinct keys
+	Min         interface{}       `json:"min,omitempty"`
+	Max         interface{}       `json:"max,omitempty"`
+	Histogram   []HistogramBucket `json:"histogram,omitempty"` // equi-depth, in value order
+}
+
+// HistogramBucket counts the indexed values from Lower to Upper inclusive
+type HistogramBucket struct {
+	Lower    interface{} `json:"lower"`
+	Upper    interface{} `json:"upper"`
+	Count    int         `json:"count"`
+	Distinct int         `json:"distinct"`
+}
+
+// documentIndex maps the keys of an indexed field onto the ids of the documents
+// holding them. Document inserts, updates and deletes bring the entries up to date
+// as they write (see touchDocuments). Other changes of the collection only move
+// its stamp, and the entries are rebuilt on use once the stamp moved since they
+// were last brought up to date.
+type documentIndex struct {
+	spec    IndexSpec
+	version int64 // collection stamp version of the entries, -1 when stale
+	entries map[string][]string
+	stats   IndexStats
+	mutex   sync.Mutex
+
+	docs    map[string][]string    // keys of each document of the collection, by id
+	values  map[string]interface{} // a value of each key, for the statistics
+	changed int                    // entries added or removed since the last summary
+	builds  int                    // times the entries were built from the documents
+
+	sorted   []indexedString     // strings in key order, for prefix indexes
+	trigrams map[string][]string // ids by trigram, for trigram indexes
+}
+
+// indexSet holds the secondary indexes of the document store
+type indexSet struct {
+	indexes map[string]*documentIndex // by collection and field
+	mutex   sync.RWMutex
+}
+
+func newIndexSet() *indexSet {
+	return &indexSet{indexes: make(map[string]*documentIndex)}
+}
+
+func indexName(collection, field string) string {
+	return collection + "." + field
+}
+
+// get returns the index on field of collection, or nil
+func (s *indexSet) get(collection, field string) *documentIndex {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.indexes[indexName(collection, field)]
+}
+
+// invalidate marks the indexes of collection stale, for changes that do not touch
+// the collection stamp such as warming tiered documents
+func (s *indexSet) invalidate(collection string) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, index := range s.indexes {
+		if index.spec.Collection == collection {
+			index.mutex.Lock()
+			index.version = -1
+			index.mutex.Unlock()
+		}
+	}
+}
+
+// CreateIndex adds a secondary index, replacing any index on the same field
+func (db *MultiModelDatabase) CreateIndex(spec IndexSpec) error {
+	if err := ValidateCollectionName(spec.Collection); err != nil {
+		return err
+	}
+	if spec.Field == "" {
+		return fmt.Errorf("index field must not be empty")
+	}
+	if err := validateIndexType(spec.Type); err != nil {
+		return err
+	}
+	for _, field := range db.computed.get(spec.Collection, false) {
+		if field.Name == spec.Field {
+			return fmt.Errorf("computed field %s is virtual, store it to index it", spec.Field)
+		}
+	}
+
+	db.indexes.mutex.Lock()
+	defer db.indexes.mutex.Unlock()
+	db.indexes.indexes[indexName(spec.Collection, spec.Field)] = &documentIndex{spec: spec, version: -1}
+	return nil
+}
+
+// DropIndex removes the index on field of collection
+func (db *MultiModelDatabase) DropIndex(collection, field string) error {
+	db.indexes.mutex.Lock()
+	defer db.indexes.mutex.Unlock()
+
+	name := indexName(collection, field)
+	if _, exists := db.indexes.indexes[name]; !exists {
+		return fmt.Errorf("index on %s not found in collection %s", field, collection)
+	}
+	delete(db.indexes.indexes, name)
+	return nil
+}
+
+// ListIndexes returns the indexes of collection ordered by field
+func (db *MultiModelDatabase) ListIndexes(collection string) []IndexSpec {
+	db.indexes.mutex.RLock()
+	defer db.indexes.mutex.RUnlock()
+
+	specs := make([]IndexSpec, 0)
+	for _, index := range db.indexes.indexes {
+		if index.spec.Collection == collection {
+			specs = append(specs, index.spec)
+		}
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Field < specs[j].Field })
+	return specs
+}
+
+// lookup returns the ids of the documents whose indexed field holds value
+func (index *documentIndex) lookup(db *MultiModelDatabase, value interface{}) []string {
+	key, ok := indexKey(value, index.spec.Collation)
+	if !ok {
+		return nil
+	}
+	ids, _ := index.ids(db, []string{key})
+	return ids
+}
+
+// ids returns the ids of the documents holding any of keys and the index
+// statistics, rebuilding the entries first when the collection changed
+func (index *documentIndex) ids(db *MultiModelDatabase, keys []string) ([]string, IndexStats) {
+	var ids []string
+	index.fresh(db, func() {
+		if len(keys) == 1 {
+			ids = index.entries[keys[0]]
+			return
+		}
+		seen := make(map[string]bool)
+		for _, key := range keys {
+			for _, id := range index.entries[key] {
+				if !seen[id] {
+					seen[id] = true
+					ids = append(ids, id)
+				}
+			}
+		}
+	})
+	return ids, index.stats
+}
+
+// fresh runs fn holding the index, rebuilding its entries first when the collection
+// changed other than through document writes
+func (index *documentIndex) fresh(db *MultiModelDatabase, fn func()) {
+	// Writers hold the docMutex while they update the index, so it is taken first
+	db.docMutex.RLock()
+	defer db.docMutex.RUnlock()
+
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	if version := db.docStamps[index.spec.Collection].Version; index.version != version {
+		index.build(db)
+		index.version = version
+	}
+	if float64(index.changed) > float64(index.stats.Entries)*summaryChangeRatio {
+		index.summarize()
+	}
+	fn()
+}
+
+// touchDocuments records writes of the documents ids of collection like
+// touchCollection, updating the entries of the indexes that were up to date before
+// the writes. Callers must hold the docMutex write lock.
+func (db *MultiModelDatabase) touchDocuments(collection string, ids ...string) {
+	previous := db.docStamps[collection].Version
+	db.touchCollection(collection)
+	version := db.docStamps[collection].Version
+
+	db.indexes.mutex.RLock()
+	defer db.indexes.mutex.RUnlock()
+	for _, index := range db.indexes.indexes {
+		if index.spec.Collection != collection {
+			continue
+		}
+		index.mutex.Lock()
+		if index.version == previous && index.docs != nil {
+			for _, id := range ids {
+				index.remove(id)
+				if doc, exists := db.documents[collection+"."+id]; exists {
+					sorted := len(index.sorted)
+					index.add(id, doc)
+					index.mergeStrings(sorted)
+				}
+			}
+			index.version = version
+		}
+		index.mutex.Unlock()
+	}
+}
+
+// build indexes the documents of the collection and gathers the statistics. Callers
+// must hold the docMutex.
+func (index *documentIndex) build(db *MultiModelDatabase) {
+	index.entries = make(map[string][]string)
+	index.docs = make(map[string][]string)
+	index.values = make(map[string]interface{})
+	index.stats = IndexStats{}
+	index.sorted = nil
+	if index.spec.Type == IndexTrigram {
+		index.trigrams = make(map[string][]string)
+	}
+	index.builds++
+
+	prefix := index.spec.Collection + "."
+	for docKey, doc := range db.documents {
+		if len(docKey) > len(prefix) && docKey[:len(prefix)] == prefix {
+			index.add(docKey[len(prefix):], doc)
+		}
+	}
+	if a := db.archived(index.spec.Collection); a != nil {
+		// A corrupt archive fails the queries themselves; index what could be read
+		_ = a.each(func(id string, doc Document) bool {
+			index.add(id, doc)
+			return true
+		})
+	}
+	sort.Slice(index.sorted, func(i, j int) bool { return index.sorted[i].key < index.sorted[j].key })
+	index.summarize()
+}
+
+// add indexes the document id, which the index holds no entries of
+func (index *documentIndex) add(id string, doc Document) {
+	keys := index.documentKeys(id, doc)
+	index.docs[id] = keys
+	index.stats.Documents = len(index.docs)
+	index.stats.Entries += len(keys)
+	index.stats.Cardinality = len(index.entries)
+	index.changed += len(keys)
+}
+
+// documentKeys adds the entries of the values of the indexed field of doc and
+// returns their keys
+func (index *documentIndex) documentKeys(id string, doc Document) []string {
+	value, exists := lookupPath(doc, index.spec.Field)
+	if !exists {
+		return nil
+	}
+	value = expandValue(value)
+	elements := []interface{}{value}
+	if array, isArray := value.([]interface{}); isArray {
+		elements = array
+	}
+	var keys []string
+	for _, element := range elements {
+		key, ok := indexKey(element, index.spec.Collation)
+		if !ok {
+			continue
+		}
+		if ids := index.entries[key]; len(ids) > 0 && ids[len(ids)-1] == id {
+			continue // repeated in the same array
+		}
+		if s, isString := element.(string); isString {
+			index.indexString(id, index.spec.Collation.fold(s))
+		}
+		if _, seen := index.values[key]; !seen {
+			index.values[key] = element
+		}
+		index.entries[key] = append(index.entries[key], id)
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// remove drops the entries of the document id. The id lists are replaced rather
+// than changed, as lookups hand them out.
+func (index *documentIndex) remove(id string) {
+	keys, exists := index.docs[id]
+	if !exists {
+		return
+	}
+	delete(index.docs, id)
+	for _, key := range keys {
+		if ids := withoutID(index.entries[key], id); len(ids) > 0 {
+			index.entries[key] = ids
+		} else {
+			delete(index.entries, key)
+			delete(index.values, key)
+		}
+		if key[0] == 's' {
+			index.unindexString(id, key[1:])
+		}
+	}
+	index.stats.Documents = len(index.docs)
+	index.stats.Entries -= len(keys)
+	index.stats.Cardinality = len(index.entries)
+	index.changed += len(keys)
+}
+
+// withoutID returns a copy of ids without id
+func withoutID(ids []string, id string) []string {
+	kept := make([]string, 0, len(ids))
+	for _, other := range ids {
+		if other != id {
+			kept = append(kept, other)
+		}
+	}
+	return kept
+}
+
+// summarize computes Min, Max and the equi-depth histogram of the statistics from
+// the keys in value order
+func (index *documentIndex) summarize() {
+	stats := &index.stats
+	keys := sortedKeys(index.values)
+	sort.SliceStable(keys, func(i, j int) bool {
+		return index.spec.Collation.compareSortValues(index.values[keys[i]], index.values[keys[j]]) < 0
+	})
+	stats.Min, stats.Max, stats.Histogram = nil, nil, nil
+	if len(keys) > 0 {
+		stats.Min, stats.Max = index.values[keys[0]], index.values[keys[len(keys)-1]]
+	}
+	depth := (stats.Entries + histogramBuckets - 1) / histogramBuckets
+	var bucket *HistogramBucket
+	for _, key := range keys {
+		if bucket == nil {
+			stats.Histogram = append(stats.Histogram, HistogramBucket{Lower: index.values[key]})
+			bucket = &stats.Histogram[len(stats.Histogram)-1]
+		}
+		bucket.Upper = index.values[key]
+		bucket.Count += len(index.entries[key])
+		bucket.Distinct++
+		if bucket.Count >= depth {
+			bucket = nil
+		}
+	}
+	index.changed = 0
+}
+
+// indexKey returns the key of a scalar value, prefixed by its type so that the
+// string "1" and the number 1 differ. Objects, arrays and nulls have no key.
+func indexKey(value interface{}, collation Collation) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return "s" + collation.fold(v), true
+	case bool:
+		return "b" + strconv.FormatBool(v), true
+	}
+	if f, ok := numberValue(value); ok {
+		return "n" + strconv.FormatFloat(f, 'g', -1, 64), true
+	}
+	return "", false
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestIndexesFollowWritesWithoutRebuilding(t *testing.T) {
+	db := newTestDatabase(t)
+	for i := 0; i < 10; i++ {
+		doc := Document{"city": fmt.Sprintf("city%d", i%3), "name": fmt.Sprintf("n%d", i), "tags": []interface{}{"a", fmt.Sprintf("tag%d", i)}}
+		if err := db.InsertDocument("people", fmt.Sprintf("p%d", i), doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	specs := []IndexSpec{
+		{Collection: "people", Field: "city"},
+		{Collection: "people", Field: "name", Type: IndexPrefix},
+		{Collection: "people", Field: "tags", Type: IndexTrigram},
+	}
+	indexes := make([]*documentIndex, len(specs))
+	for i, spec := range specs {
+		if err := db.CreateIndex(spec); err != nil {
+			t.Fatal(err)
+		}
+		indexes[i] = db.indexes.get(spec.Collection, spec.Field)
+		indexes[i].ids(db, nil)
+	}
+
+	// Inserts, updates and deletes, one by one and in bulk
+	if err := db.InsertDocument("people", "p10", Document{"city": "oslo", "name": "n10", "tags": []interface{}{"oslo"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateDocument("people", "p0", Document{"city": "bergen", "name": "m0", "tags": []interface{}{"b"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteDocument("people", "p1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.InsertMany("people", []Document{{IDField: "p11", "city": "oslo"}, {IDField: "p12"}}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, index := range indexes {
+		index.ids(db, nil)
+		if index.builds != 1 {
+			t.Errorf("%s index was built %d times", index.spec.Type, index.builds)
+		}
+	}
+	city := db.indexes.get("people", "city")
+	if ids := city.lookup(db, "oslo"); !sameIDs(ids, "p10", "p11") {
+		t.Errorf("oslo = %v", ids)
+	}
+	if ids := city.lookup(db, "city1"); !sameIDs(ids, "p4", "p7") {
+		t.Errorf("city1 = %v", ids)
+	}
+	names, _, _ := indexes[1].findPattern(db, map[string]interface{}{OpStartsWith: "n1"})
+	if !sameIDs(names, "p10") {
+		t.Errorf("names starting with n1 = %v", names)
+	}
+	tags, _, _ := indexes[2].findPattern(db, map[string]interface{}{OpRegex: "slo"})
+	if !sameIDs(tags, "p10") {
+		t.Errorf("tags matching slo = %v", tags)
+	}
+
+	// The maintained entries and statistics are the ones a build gives
+	for _, index := range indexes {
+		index.mutex.Lock()
+		maintained := indexState(index)
+		index.mutex.Unlock()
+		db.indexes.invalidate("people")
+		_, stats := index.ids(db, nil)
+		if index.builds != 2 {
+			t.Errorf("%s index was built %d times after invalidation", index.spec.Type, index.builds)
+		}
+		if built := indexState(index); !reflect.DeepEqual(maintained, built) {
+			t.Errorf("%s index maintained %+v, built %+v", index.spec.Type, maintained, built)
+		}
+		if stats.Documents != 12 {
+			t.Errorf("%s index counts %d documents", index.spec.Type, stats.Documents)
+		}
+	}
+
+	// Other changes of the collection rebuild the entries
+	if _, err := db.RenameCollection("people", "staff", false); err != nil {
+		t.Fatal(err)
+	}
+	if ids := city.lookup(db, "oslo"); len(ids) != 0 || city.builds != 3 {
+		t.Errorf("oslo after rename = %v after %d builds", ids, city.builds)
+	}
+}
+
+// indexState returns the entries and counts of an index in a comparable form
+func indexState(index *documentIndex) map[string]interface{} {
+	entries := make(map[string][]string)
+	for key, ids := range index.entries {
+		entries[key] = append([]string(nil), ids...)
+		sort.Strings(entries[key])
+	}
+	trigrams := make(map[string][]string)
+	for gram, ids := range index.trigrams {
+		trigrams[gram] = append([]string(nil), ids...)
+		sort.Strings(trigrams[gram])
+	}
+	sorted := append([]indexedString(nil), index.sorted...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].key < sorted[j].key || sorted[i].key == sorted[j].key && sorted[i].id < sorted[j].id
+	})
+	return map[string]interface{}{
+		"entries":     entries,
+		"trigrams":    trigrams,
+		"sorted":      sorted,
+		"inOrder":     sort.SliceIsSorted(index.sorted, func(i, j int) bool { return index.sorted[i].key < index.sorted[j].key }),
+		"documents":   index.stats.Documents,
+		"entryCount":  index.stats.Entries,
+		"cardinality": index.stats.Cardinality,
+	}
+}
+
+func sameIDs(ids []string, want ...string) bool {
+	got := append([]string(nil), ids...)
+	sort.Strings(got)
+	return reflect.DeepEqual(got, want)
+}
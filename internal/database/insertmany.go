@@ -0,0 +1,142 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// InsertManyResult reports the documents of an InsertMany
+type InsertManyResult struct {
+	IDs       []string      `json:"ids"` // of the documents in input order, empty for those not inserted
+	Inserted  int           `json:"inserted"`
+	Errors    []InsertError `json:"errors,omitempty"`
+	Conflicts []Conflict    `json:"conflicts,omitempty"` // documents whose id is taken, also listed in Errors
+}
+
+// InsertError is a document InsertMany could not insert
+type InsertError struct {
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error"`
+}
+
+func generateDocumentID() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate document id: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// documentIDs takes the ids of docs from their IDField, generating the missing ones,
+// and returns the documents without it
+func documentIDs(docs []Document) ([]string, []Document, error) {
+	ids := make([]string, len(docs))
+	bodies := make([]Document, len(docs))
+	seen := make(map[string]int, len(docs))
+	for i, doc := range docs {
+		bodies[i] = doc
+		if value, given := doc[IDField]; given {
+			id, isString := value.(string)
+			if !isString || id == "" {
+				return nil, nil, fmt.Errorf("document %d: %s must be a non-empty string", i, IDField)
+			}
+			ids[i] = id
+			bodies[i] = make(Document, len(doc)-1)
+			for k, v := range doc {
+				if k != IDField {
+					bodies[i][k] = v
+				}
+			}
+		} else {
+			id, err := generateDocumentID()
+			if err != nil {
+				return nil, nil, err
+			}
+			ids[i] = id
+		}
+		if first, duplicate := seen[ids[i]]; duplicate {
+			return nil, nil, fmt.Errorf("documents %d and %d have the same id %s", first, i, ids[i])
+		}
+		seen[ids[i]] = i
+	}
+	return ids, bodies, nil
+}
+
+// InsertMany inserts docs into collection, each under the id in its IDField, which is
+// not stored, or a generated one. When atomic, either every document is inserted or,
+// if any is rejected or its id is taken, none is: hooks see every document first and
+// the documents are then stored under a single lock, as collections are copied.
+// Otherwise documents are inserted one by one and failures are reported per document.
+// Documents whose id is taken are reported as conflicts, all of them in a
+// *ConflictError when atomic.
+func (db *MultiModelDatabase) InsertMany(collection string, docs []Document, atomic bool) (*InsertManyResult, error) {
+	ids, bodies, err := documentIDs(docs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &InsertManyResult{IDs: ids}
+	if !atomic {
+		for i, id := range ids {
+			if err := db.InsertDocument(collection, id, bodies[i]); err != nil {
+				result.IDs[i] = ""
+				result.Errors = append(result.Errors, InsertError{Index: i, ID: id, Error: err.Error()})
+				if errors.Is(err, ErrDocumentExists) {
+					result.Conflicts = append(result.Conflicts, documentConflict(i, collection, id))
+				}
+				continue
+			}
+			result.Inserted++
+		}
+		return result, nil
+	}
+
+	if db.crdt.enabled(collection) {
+		return nil, fmt.Errorf("atomic inserts are not supported on CRDT collection %s", collection)
+	}
+	events := make([]*WriteEvent, len(ids))
+	for i, id := range ids {
+		events[i] = &WriteEvent{Model: ModelDocument, Namespace: collection, Key: id, Value: bodies[i], Timestamp: db.Clock.Now()}
+		if err := db.beforeWrite(OpInsert, events[i]); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+	}
+	if err := db.insertDocuments(collection, ids, bodies); err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		db.afterWrite(OpInsert, event)
+	}
+	result.Inserted = len(ids)
+	return result, nil
+}
+
+// insertDocuments stores documents under ids, or none of them if an id is taken, in
+// which case the *ConflictError lists the taken ids
+func (db *MultiModelDatabase) insertDocuments(collection string, ids []string, docs []Document) error {
+	db.docMutex.Lock()
+	defer db.docMutex.Unlock()
+
+	if db.archived(collection) != nil {
+		return fmt.Errorf("%w: %s", ErrArchived, collection)
+	}
+	var conflicts []Conflict
+	for i, id := range ids {
+		key := collection + "." + id
+		_, exists := db.documents[key]
+		if _, cold := db.coldDocs[key]; exists || cold {
+			conflicts = append(conflicts, documentConflict(i, collection, id))
+		}
+	}
+	if len(conflicts) > 0 {
+		return &ConflictError{Conflicts: conflicts}
+	}
+	for i, id := range ids {
+		db.documents[collection+"."+id] = db.prepareDocument(collection, docs[i])
+	}
+	db.touchDocuments(collection, ids...)
+	return nil
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestInsertMany(t *testing.T) {
+	db := newTestDatabase(t)
+	if err := db.InsertDocument("users", "taken", Document{"name": "first"}); err != nil {
+		t.Fatal(err)
+	}
+
+	docs := []Document{
+		{IDField: "u1", "name": "a"},
+		{"name": "b"},
+		{IDField: "taken", "name": "c"},
+	}
+	if _, err := db.InsertMany("users", docs, true); err == nil {
+		t.Fatal("atomic insert over a taken id succeeded")
+	}
+	if _, err := db.GetDocument("users", "u1"); err == nil {
+		t.Fatal("failed atomic insert stored a document")
+	}
+
+	result, err := db.InsertMany("users", docs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Inserted != 2 || len(result.Errors) != 1 || result.Errors[0].Index != 2 {
+		t.Fatalf("result = %+v", result)
+	}
+	if result.IDs[0] != "u1" || result.IDs[1] == "" || result.IDs[2] != "" {
+		t.Fatalf("ids = %q", result.IDs)
+	}
+	doc, err := db.GetDocument("users", "u1")
+	if err != nil || doc["name"] != "a" {
+		t.Fatalf("u1 = %v, %v", doc, err)
+	}
+	if _, stored := doc[IDField]; stored {
+		t.Fatalf("%s stored: %v", IDField, doc)
+	}
+	if taken, _ := db.GetDocument("users", "taken"); taken["name"] != "first" {
+		t.Fatalf("taken document overwritten: %v", taken)
+	}
+
+	if result, err := db.InsertMany("users", []Document{{IDField: "u2"}, {IDField: "u3"}}, true); err != nil || result.Inserted != 2 {
+		t.Fatalf("atomic insert: %+v, %v", result, err)
+	}
+	if _, err := db.InsertMany("users", []Document{{IDField: "d"}, {IDField: "d"}}, false); err == nil {
+		t.Fatal("duplicate ids accepted")
+	}
+}
+
+func TestInsertManyReportsTakenIDsAsConflicts(t *testing.T) {
+	db := newTestDatabase(t)
+	for _, id := range []string{"a", "c"} {
+		if err := db.InsertDocument("users", id, Document{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	docs := []Document{{IDField: "a"}, {IDField: "b"}, {IDField: "c"}}
+
+	// Atomic inserts list every taken id, not only the first
+	_, err := db.InsertMany("users", docs, true)
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || len(conflict.Conflicts) != 2 {
+		t.Fatalf("expected two conflicts, got %v", err)
+	}
+	if first := conflict.Conflicts[0]; first.Index != 0 || first.Key != "a" || first.Field != IDField {
+		t.Fatalf("first conflict = %+v", first)
+	}
+
+	result, err := db.InsertMany("users", docs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Inserted != 1 || len(result.Conflicts) != 2 || result.Conflicts[1].Index != 2 {
+		t.Fatalf("result = %+v", result)
+	}
+}
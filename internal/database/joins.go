@@ -0,0 +1,159 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IDField is the foreign field of a Lookup that matches document ids
+const IDField = "_id"
+
+// LookupParam is the query string parameter joining another collection:
+// _lookup=from:localField:foreignField:as, as defaulting to from
+const LookupParam = "_lookup"
+
+// Lookup embeds in every result the documents of another collection whose
+// ForeignField equals the result's LocalField, like Mongo's $lookup. A local array
+// matches each of its elements. Matches are found by document id for IDField, through
+// an index on ForeignField with the query's collation when there is one, and with a
+// single scan of From otherwise.
+type Lookup struct {
+	From         string `json:"from"`
+	LocalField   string `json:"local_field"`
+	ForeignField string `json:"foreign_field"`
+	As           string `json:"as"` // field receiving the matches, From when empty
+}
+
+// ParseLookup parses a lookup written from:localField:foreignField[:as]
+func ParseLookup(s string) (Lookup, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 3 || len(parts) > 4 {
+		return Lookup{}, fmt.Errorf("invalid lookup %q, expected from:localField:foreignField[:as]", s)
+	}
+	lookup := Lookup{From: parts[0], LocalField: parts[1], ForeignField: parts[2]}
+	if len(parts) == 4 {
+		lookup.As = parts[3]
+	}
+	return lookup, lookup.validate()
+}
+
+func (l *Lookup) validate() error {
+	if err := ValidateCollectionName(l.From); err != nil {
+		return fmt.Errorf("invalid lookup collection: %w", err)
+	}
+	if l.LocalField == "" || l.ForeignField == "" {
+		return fmt.Errorf("lookup on %s needs a local and a foreign field", l.From)
+	}
+	if l.As == "" {
+		l.As = l.From
+	}
+	return nil
+}
+
+// joinDocuments returns copies of docs holding the matches of lookup
+func (db *MultiModelDatabase) joinDocuments(ctx context.Context, docs []Document, lookup Lookup, collation Collation) ([]Document, error) {
+	if err := lookup.validate(); err != nil {
+		return nil, err
+	}
+	if err := db.warmCollection(lookup.From); err != nil {
+		return nil, err
+	}
+	match := db.lookupMatcher(lookup, collation)
+
+	joined := make([]Document, len(docs))
+	check := cancelCheck{ctx: ctx}
+	for i, doc := range docs {
+		if err := check.err(); err != nil {
+			return nil, err
+		}
+		value, exists := lookupPath(doc, lookup.LocalField)
+		values := []interface{}{value}
+		if elements, isArray := value.([]interface{}); isArray {
+			values = elements
+		}
+
+		ids := make(map[string]bool)
+		if exists {
+			for _, v := range values {
+				for _, id := range match(v) {
+					ids[id] = true
+				}
+			}
+		}
+
+		copied := make(Document, len(doc)+1)
+		for k, v := range doc {
+			copied[k] = v
+		}
+		copied[lookup.As] = db.documentsByID(lookup.From, ids)
+		joined[i] = copied
+	}
+	return joined, nil
+}
+
+// lookupMatcher returns a function giving the ids of the documents of lookup.From
+// whose foreign field matches a local value
+func (db *MultiModelDatabase) lookupMatcher(lookup Lookup, collation Collation) func(interface{}) []string {
+	if lookup.ForeignField == IDField {
+		return func(value interface{}) []string {
+			switch v := value.(type) {
+			case string:
+				return []string{v}
+			case bool, nil:
+				return nil
+			}
+			if f, ok := numberValue(value); ok {
+				return []string{strconv.FormatFloat(f, 'f', -1, 64)}
+			}
+			return nil
+		}
+	}
+
+	if index := db.indexes.get(lookup.From, lookup.ForeignField); index != nil && index.spec.Collation == collation {
+		return func(value interface{}) []string {
+			return index.lookup(db, value)
+		}
+	}
+
+	// Without an index, hash the foreign collection once for all results
+	scan := &documentIndex{spec: IndexSpec{Collection: lookup.From, Field: lookup.ForeignField, Collation: collation}}
+	db.docMutex.RLock()
+	scan.build(db)
+	db.docMutex.RUnlock()
+	return func(value interface{}) []string {
+		key, ok := indexKey(value, collation)
+		if !ok {
+			return nil
+		}
+		return scan.entries[key]
+	}
+}
+
+// documentsByID returns the existing documents of collection with the given ids,
+// ordered by id
+func (db *MultiModelDatabase) documentsByID(collection string, ids map[string]bool) []Document {
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+
+	db.docMutex.RLock()
+	defer db.docMutex.RUnlock()
+
+	docs := make([]Document, 0, len(sorted))
+	archived := db.archived(collection)
+	for _, id := range sorted {
+		if doc, exists := db.documents[collection+"."+id]; exists {
+			docs = append(docs, db.expandDocument(doc))
+		} else if archived != nil {
+			if doc, exists, _ := archived.get(id); exists {
+				docs = append(docs, doc)
+			}
+		}
+	}
+	return docs
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"net/url"
+	"testing"
+)
+
+func TestLookupsJoinCollections(t *testing.T) {
+	db := newTestDatabase(t)
+	users := map[string]Document{
+		"u1": {"name": "ann", "email": "Ann@example.com"},
+		"u2": {"name": "bob", "email": "bob@example.com"},
+	}
+	for id, doc := range users {
+		if err := db.InsertDocument("users", id, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	orders := map[string]Document{
+		"o1": {"total": float64(10), "user_id": "u1", "email": "ann@example.com", "watchers": []interface{}{"u1", "u2"}},
+		"o2": {"total": float64(20), "user_id": "u3", "email": "bob@example.com"},
+	}
+	for id, doc := range orders {
+		if err := db.InsertDocument("orders", id, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	find := func(raw string) map[float64]Document {
+		t.Helper()
+		query, err := url.ParseQuery(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := ParseDocumentQuery(query)
+		if err != nil {
+			t.Fatalf("%s: %v", raw, err)
+		}
+		docs, err := db.FindDocuments(context.Background(), "orders", q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		byTotal := make(map[float64]Document)
+		for _, doc := range docs {
+			byTotal[doc["total"].(float64)] = doc
+		}
+		return byTotal
+	}
+	names := func(doc Document, as string) []string {
+		var names []string
+		for _, user := range doc[as].([]Document) {
+			names = append(names, user["name"].(string))
+		}
+		return names
+	}
+
+	byID := find("_lookup=users:user_id:_id:user")
+	if got := names(byID[10], "user"); len(got) != 1 || got[0] != "ann" {
+		t.Fatalf("order o1 joined %v", got)
+	}
+	if got := names(byID[20], "user"); len(got) != 0 {
+		t.Fatalf("order o2 of a missing user joined %v", got)
+	}
+	if _, joined := orders["o1"]["user"]; joined {
+		t.Fatal("the join modified the stored document")
+	}
+
+	if got := names(find("_lookup=users:watchers:_id")[10], "users"); len(got) != 2 {
+		t.Fatalf("array join = %v", got)
+	}
+
+	// A scan matches exactly, a case insensitive index or scan ignores case
+	if got := names(find("_lookup=users:email:email")[10], "users"); len(got) != 0 {
+		t.Fatalf("exact join on email = %v", got)
+	}
+	if err := db.CreateIndex(IndexSpec{Collection: "users", Field: "email", Collation: Collation{CaseInsensitive: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(find("_lookup=users:email:email&_collation=ci")[10], "users"); len(got) != 1 || got[0] != "ann" {
+		t.Fatalf("indexed join on email = %v", got)
+	}
+
+	// The index follows writes to the collection
+	if err := db.UpdateDocument("users", "u1", Document{"email": "ann@example.org"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(find("_lookup=users:email:email&_collation=ci")[10], "users"); len(got) != 0 {
+		t.Fatalf("stale index joined %v", got)
+	}
+	if specs := db.ListIndexes("users"); len(specs) != 1 || specs[0].Field != "email" {
+		t.Fatalf("indexes = %+v", specs)
+	}
+
+	if _, err := ParseLookup("users:user_id"); err == nil {
+		t.Fatal("expected an error for a lookup without a foreign field")
+	}
+}
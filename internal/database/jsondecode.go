@@ -0,0 +1,275 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// maxDecodeDepth matches the nesting limit of encoding/json
+const maxDecodeDepth = 10000
+
+// errDecodeFallback hands a document the fast path does not handle to encoding/json
+var errDecodeFallback = errors.New("decode with encoding/json")
+
+// DecodeJSON decodes data into v like json.Unmarshal, except that numbers decoded into
+// untyped values become json.Number, so integers beyond 2^53 round-trip exactly.
+// Documents and other untyped targets are parsed by a dedicated decoder that skips
+// reflection; typed structures go to encoding/json.
+func DecodeJSON(data []byte, v interface{}) error {
+	switch target := v.(type) {
+	case *interface{}:
+		if *target == nil {
+			if value, err := parseJSON(data); err == nil {
+				*target = value
+				return nil
+			}
+		}
+	case *Document:
+		if *target == nil {
+			if object, err := parseJSONObject(data); err == nil {
+				*target = object
+				return nil
+			}
+		}
+	case *map[string]interface{}:
+		if *target == nil {
+			if object, err := parseJSONObject(data); err == nil {
+				*target = object
+				return nil
+			}
+		}
+	}
+	// Typed targets, targets already holding a value, and input the fast path
+	// rejects, whose error encoding/json reports
+	return decodeStandard(data, v)
+}
+
+// decodeStandard decodes data into v with encoding/json, keeping numbers as json.Number
+func decodeStandard(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("invalid data after top-level value")
+	}
+	return nil
+}
+
+func parseJSONObject(data []byte) (map[string]interface{}, error) {
+	value, err := parseJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	object, isObject := value.(map[string]interface{})
+	if !isObject {
+		return nil, errDecodeFallback
+	}
+	return object, nil
+}
+
+// parseJSON decodes a complete JSON text into the values json.Unmarshal produces for
+// an interface{}, with numbers as json.Number
+func parseJSON(data []byte) (interface{}, error) {
+	p := jsonParser{data: data}
+	value, err := p.value(0)
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.data) {
+		return nil, errDecodeFallback
+	}
+	return value, nil
+}
+
+type jsonParser struct {
+	data []byte
+	pos  int
+}
+
+func (p *jsonParser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *jsonParser) value(depth int) (interface{}, error) {
+	if depth > maxDecodeDepth {
+		return nil, errDecodeFallback
+	}
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return nil, errDecodeFallback
+	}
+	switch c := p.data[p.pos]; {
+	case c == '{':
+		return p.object(depth)
+	case c == '[':
+		return p.array(depth)
+	case c == '"':
+		return p.string()
+	case c == 't':
+		return true, p.literal("true")
+	case c == 'f':
+		return false, p.literal("false")
+	case c == 'n':
+		return nil, p.literal("null")
+	case c == '-' || c >= '0' && c <= '9':
+		return p.number()
+	}
+	return nil, errDecodeFallback
+}
+
+func (p *jsonParser) object(depth int) (interface{}, error) {
+	p.pos++ // {
+	object := make(map[string]interface{})
+	p.skipSpace()
+	if p.pos < len(p.data) && p.data[p.pos] == '}' {
+		p.pos++
+		return object, nil
+	}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.data) || p.data[p.pos] != '"' {
+			return nil, errDecodeFallback
+		}
+		key, err := p.string()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.pos >= len(p.data) || p.data[p.pos] != ':' {
+			return nil, errDecodeFallback
+		}
+		p.pos++
+		value, err := p.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		object[key] = value
+		if done, err := p.next('}'); done || err != nil {
+			return object, err
+		}
+	}
+}
+
+func (p *jsonParser) array(depth int) (interface{}, error) {
+	p.pos++ // [
+	array := make([]interface{}, 0)
+	p.skipSpace()
+	if p.pos < len(p.data) && p.data[p.pos] == ']' {
+		p.pos++
+		return array, nil
+	}
+	for {
+		value, err := p.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, value)
+		if done, err := p.next(']'); done || err != nil {
+			return array, err
+		}
+	}
+}
+
+// next consumes the comma before the next member of an object or array, or its
+// closing bracket, reporting whether it was the latter
+func (p *jsonParser) next(closing byte) (bool, error) {
+	p.skipSpace()
+	if p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ',':
+			p.pos++
+			return false, nil
+		case closing:
+			p.pos++
+			return true, nil
+		}
+	}
+	return false, errDecodeFallback
+}
+
+// string decodes a string, leaving escapes and non-ASCII text to encoding/json so
+// that invalid UTF-8 and surrogates are replaced exactly as json.Unmarshal does
+func (p *jsonParser) string() (string, error) {
+	start := p.pos
+	plain := true
+	for i := start + 1; i < len(p.data); i++ {
+		switch c := p.data[i]; {
+		case c == '"':
+			p.pos = i + 1
+			if plain {
+				return string(p.data[start+1 : i]), nil
+			}
+			var s string
+			if err := json.Unmarshal(p.data[start:p.pos], &s); err != nil {
+				return "", errDecodeFallback
+			}
+			return s, nil
+		case c == '\\':
+			plain = false
+			i++ // the escaped character, which may be a quote
+		case c < 0x20:
+			return "", errDecodeFallback
+		case c >= 0x80:
+			plain = false
+		}
+	}
+	return "", errDecodeFallback
+}
+
+func (p *jsonParser) literal(word string) error {
+	if len(p.data)-p.pos < len(word) || string(p.data[p.pos:p.pos+len(word)]) != word {
+		return errDecodeFallback
+	}
+	p.pos += len(word)
+	return nil
+}
+
+// number consumes a number following the JSON grammar and keeps its text
+func (p *jsonParser) number() (interface{}, error) {
+	start := p.pos
+	if p.data[p.pos] == '-' {
+		p.pos++
+	}
+	switch {
+	case p.pos < len(p.data) && p.data[p.pos] == '0':
+		p.pos++
+	case p.digits() == 0:
+		return nil, errDecodeFallback
+	}
+	if p.pos < len(p.data) && p.data[p.pos] == '.' {
+		p.pos++
+		if p.digits() == 0 {
+			return nil, errDecodeFallback
+		}
+	}
+	if p.pos < len(p.data) && (p.data[p.pos] == 'e' || p.data[p.pos] == 'E') {
+		p.pos++
+		if p.pos < len(p.data) && (p.data[p.pos] == '+' || p.data[p.pos] == '-') {
+			p.pos++
+		}
+		if p.digits() == 0 {
+			return nil, errDecodeFallback
+		}
+	}
+	return json.Number(p.data[start:p.pos]), nil
+}
+
+func (p *jsonParser) digits() int {
+	start := p.pos
+	for p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '9' {
+		p.pos++
+	}
+	return p.pos - start
+}
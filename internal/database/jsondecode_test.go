@@ -0,0 +1,106 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeJSONMatchesEncodingJSON(t *testing.T) {
+	inputs := []string{
+		`{}`, `[]`, `null`, `true`, `"plain"`, `-0.5e+10`, ` {"a" : [1, 2.5, -3e2, {"b": null}], "c": false} `,
+		`{"big": 9007199254740993, "neg": -12, "zero": 0, "frac": 0.1}`,
+		`{"esc": "tab\t quote\" slash\\ é 😀", "utf8": "Málaga 東京"}`,
+		`{"bad": "\ud800 lone", "raw": "` + "\xff" + `"}`,
+		`{"dup": 1, "dup": 2}`,
+		// Invalid input falls back to encoding/json and its error
+		``, `{`, `{"a" 1}`, `[1,]`, `01`, `1.`, `-`, `"open`, `{"a":1} x`, `tru`, "\"ctl\x01\"",
+	}
+	for _, input := range inputs {
+		var want interface{}
+		wantErr := json.Unmarshal([]byte(input), new(interface{}))
+		if wantErr == nil {
+			decoder := json.NewDecoder(bytes.NewReader([]byte(input)))
+			decoder.UseNumber()
+			if err := decoder.Decode(&want); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var got interface{}
+		err := DecodeJSON([]byte(input), &got)
+		if (err != nil) != (wantErr != nil) {
+			t.Errorf("%q: error %v, encoding/json %v", input, err, wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got, want) {
+			t.Errorf("%q decoded to %#v, encoding/json to %#v", input, got, want)
+		}
+	}
+
+	// Typed structures keep numbers in untyped fields
+	var typed struct {
+		Doc   Document `json:"doc"`
+		Count int      `json:"count"`
+	}
+	if err := DecodeJSON([]byte(`{"doc": {"n": 12345678901234567}, "count": 3}`), &typed); err != nil {
+		t.Fatal(err)
+	}
+	if typed.Count != 3 || typed.Doc["n"] != json.Number("12345678901234567") {
+		t.Fatalf("typed = %+v", typed)
+	}
+}
+
+func TestIntegerFidelity(t *testing.T) {
+	db := newTestDatabase(t)
+	for id, body := range map[string]string{
+		"a": `{"n": 9007199254740993, "tags": [1, 2]}`,
+		"b": `{"n": 9007199254740992, "tags": [1, 2.5]}`,
+	} {
+		var doc Document
+		if err := DecodeJSON([]byte(body), &doc); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.InsertDocument("ids", id, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	doc, err := db.GetDocument("ids", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoded, _ := json.Marshal(doc["n"]); string(encoded) != "9007199254740993" {
+		t.Fatalf("n encoded as %s", encoded)
+	}
+
+	// Filters compare integers exactly, and arrays by value whatever the number type
+	for filter, want := range map[string]json.Number{
+		`{"n": 9007199254740993}`: "9007199254740993",
+		`{"n": 9007199254740992}`: "9007199254740992",
+		`{"tags": [1, 2]}`:        "9007199254740993",
+	} {
+		var parsed map[string]interface{}
+		if err := json.Unmarshal([]byte(filter), &parsed); err != nil {
+			t.Fatal(err)
+		}
+		if _, isArray := parsed["tags"]; !isArray {
+			parsed = nil
+			if err := DecodeJSON([]byte(filter), &parsed); err != nil {
+				t.Fatal(err)
+			}
+		}
+		docs, err := db.FindDocuments(context.Background(), "ids", DocumentQuery{Filter: parsed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(docs) != 1 || docs[0]["n"] != want {
+			t.Errorf("%s found %v", filter, docs)
+		}
+	}
+	if compareValues(json.Number("9007199254740993"), json.Number("9007199254740992")) != 1 {
+		t.Fatal("large integers sorted as equal")
+	}
+}
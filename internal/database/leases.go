@@ -0,0 +1,246 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// kvSweepInterval is how often expired keys and leases are actively removed, so
+// watchers see expirations without waiting for the next read of the key
+const kvSweepInterval = time.Second
+
+// KVEvent describes a change to a key in the key-value store
+type KVEvent struct {
+	Type     string      `json:"type"` // put, delete, expire
+	Bucket   string      `json:"bucket"`
+	Key      string      `json:"key"`
+	Value    interface{} `json:"value,omitempty"`
+	Revision int64       `json:"revision"`
+	HLC      *Timestamp  `json:"hlc,omitempty"` // clock reading of the change, unset for a missed change
+}
+
+// Lease is a time-bound grant that keys can be attached to. When the lease is not
+// renewed before it expires, every attached key is deleted.
+type Lease struct {
+	ID        string    `json:"id"`
+	TTL       string    `json:"ttl"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Keys      int       `json:"keys"`
+}
+
+type leaseKey struct {
+	bucket string
+	key    string
+}
+
+type kvLease struct {
+	id        string
+	ttl       time.Duration
+	expiresAt time.Time
+	keys      map[leaseKey]struct{}
+}
+
+func (l *kvLease) expired(now time.Time) bool {
+	return !now.Before(l.expiresAt)
+}
+
+func (l *kvLease) view() *Lease {
+	return &Lease{ID: l.id, TTL: l.ttl.String(), ExpiresAt: l.expiresAt, Keys: len(l.keys)}
+}
+
+func generateLeaseID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate lease id: %w", err)
+	}
+	return "lease-" + hex.EncodeToString(buf), nil
+}
+
+// CreateLease grants a new lease that expires after ttl unless kept alive
+func (db *MultiModelDatabase) CreateLease(ttl time.Duration) (*Lease, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("lease ttl must be positive")
+	}
+
+	id, err := generateLeaseID()
+	if err != nil {
+		return nil, err
+	}
+
+	db.kvMutex.Lock()
+	defer db.kvMutex.Unlock()
+
+	lease := &kvLease{
+		id:        id,
+		ttl:       ttl,
+		expiresAt: time.Now().Add(ttl),
+		keys:      make(map[leaseKey]struct{}),
+	}
+	db.kvLeases[id] = lease
+	return lease.view(), nil
+}
+
+// GetLease returns a live lease
+func (db *MultiModelDatabase) GetLease(id string) (*Lease, error) {
+	db.kvMutex.RLock()
+	defer db.kvMutex.RUnlock()
+
+	lease, exists := db.kvLeases[id]
+	if !exists || lease.expired(time.Now()) {
+		return nil, fmt.Errorf("lease %s not found", id)
+	}
+	return lease.view(), nil
+}
+
+// KeepAliveLease renews a live lease for another full ttl
+func (db *MultiModelDatabase) KeepAliveLease(id string) (*Lease, error) {
+	db.kvMutex.Lock()
+	defer db.kvMutex.Unlock()
+
+	now := time.Now()
+	lease, exists := db.kvLeases[id]
+	if !exists || lease.expired(now) {
+		return nil, fmt.Errorf("lease %s not found", id)
+	}
+	lease.expiresAt = now.Add(lease.ttl)
+	return lease.view(), nil
+}
+
+// RevokeLease ends a lease immediately and deletes its keys
+func (db *MultiModelDatabase) RevokeLease(id string) error {
+	db.kvMutex.Lock()
+	defer db.kvMutex.Unlock()
+
+	if _, exists := db.kvLeases[id]; !exists {
+		return fmt.Errorf("lease %s not found", id)
+	}
+	db.expireLease(id, "delete")
+	return nil
+}
+
+// expireLease removes a lease and the keys still attached to it. Callers must hold
+// the KV write lock.
+func (db *MultiModelDatabase) expireLease(id, eventType string) {
+	lease := db.kvLeases[id]
+	delete(db.kvLeases, id)
+
+	for lk := range lease.keys {
+		b, exists := db.kvBuckets[lk.bucket]
+		if !exists {
+			continue
+		}
+		if entry, exists := b.entries[lk.key]; exists && entry.leaseID == id {
+			entry.leaseID = ""
+			db.removeBucketEntry(lk.bucket, b, lk.key, eventType)
+		}
+	}
+}
+
+// detachFromLease forgets that key belongs to a lease. Callers must hold the KV write lock.
+func (db *MultiModelDatabase) detachFromLease(id, bucket, key string) {
+	if lease, exists := db.kvLeases[id]; exists {
+		delete(lease.keys, leaseKey{bucket: bucket, key: key})
+	}
+}
+
+// WatchBucketKey blocks until key in bucket changes after afterRevision, ctx is done,
+// or the database is closed. If the key already holds a newer revision it returns at once.
+// A nil event with a nil error means the watch ended without a change.
+func (db *MultiModelDatabase) WatchBucketKey(ctx context.Context, bucket, key string, afterRevision int64) (*KVEvent, error) {
+	db.kvMutex.Lock()
+	if b, exists := db.kvBuckets[bucket]; exists && afterRevision > 0 {
+		if entry, live := b.lookup(key, time.Now(), false); live && entry.revision > afterRevision {
+			db.kvMutex.Unlock()
+			return &KVEvent{Type: "put", Bucket: bucket, Key: key, Value: entry.value, Revision: entry.revision}, nil
+		}
+	}
+
+	watchKey := bucket + "/" + key
+	ch := make(chan *KVEvent, 1)
+	db.kvWatchers[watchKey] = append(db.kvWatchers[watchKey], ch)
+	db.kvMutex.Unlock()
+
+	select {
+	case event := <-ch:
+		return event, nil
+	case <-ctx.Done():
+	case <-db.ctx.Done():
+	}
+
+	db.kvMutex.Lock()
+	defer db.kvMutex.Unlock()
+	db.removeKVWatcher(watchKey, ch)
+
+	// The event may have been delivered while we were waiting for the lock
+	select {
+	case event := <-ch:
+		return event, nil
+	default:
+	}
+	return nil, ctx.Err()
+}
+
+func (db *MultiModelDatabase) removeKVWatcher(watchKey string, ch chan *KVEvent) {
+	watchers := db.kvWatchers[watchKey]
+	for i, candidate := range watchers {
+		if candidate == ch {
+			watchers = append(watchers[:i], watchers[i+1:]...)
+			break
+		}
+	}
+	if len(watchers) == 0 {
+		delete(db.kvWatchers, watchKey)
+	} else {
+		db.kvWatchers[watchKey] = watchers
+	}
+}
+
+// notifyKVWatchers delivers event to every watcher of its key. Watches are one-shot,
+// so the watcher list is cleared. Callers must hold the KV write lock.
+func (db *MultiModelDatabase) notifyKVWatchers(event *KVEvent) {
+	stamp := db.Clock.Now()
+	event.HLC = &stamp
+	watchKey := event.Bucket + "/" + event.Key
+	for _, ch := range db.kvWatchers[watchKey] {
+		ch <- event
+	}
+	delete(db.kvWatchers, watchKey)
+}
+
+// startKVSweeper periodically removes expired keys and leases until ctx is done
+func (db *MultiModelDatabase) startKVSweeper(ctx context.Context) {
+	ticker := time.NewTicker(kvSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			db.sweepExpiredKV()
+		}
+	}
+}
+
+func (db *MultiModelDatabase) sweepExpiredKV() {
+	db.kvMutex.Lock()
+	defer db.kvMutex.Unlock()
+
+	now := time.Now()
+	for id, lease := range db.kvLeases {
+		if lease.expired(now) {
+			db.expireLease(id, "expire")
+		}
+	}
+
+	for name, b := range db.kvBuckets {
+		for key, entry := range b.entries {
+			if entry.expired(now) {
+				db.removeBucketEntry(name, b, key, "expire")
+			}
+		}
+	}
+}
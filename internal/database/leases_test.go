@@ -0,0 +1,152 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLeaseExpiryAndRenewal(t *testing.T) {
+	db := newTestDatabase(t)
+	lease, err := db.CreateLease(200 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.PutBucketValue(DefaultBucket, "leader", "node-1", PutOptions{LeaseID: lease.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CreateLease(0); err == nil {
+		t.Fatal("lease without ttl granted")
+	}
+
+	// Renewals keep the key past the first ttl
+	for i := 0; i < 3; i++ {
+		time.Sleep(100 * time.Millisecond)
+		renewed, err := db.KeepAliveLease(lease.ID)
+		if err != nil {
+			t.Fatalf("renewal %d: %v", i, err)
+		}
+		if renewed.Keys != 1 || !renewed.ExpiresAt.After(lease.ExpiresAt) {
+			t.Fatalf("renewed lease = %+v", renewed)
+		}
+	}
+	db.sweepExpiredKV()
+	if _, err := db.GetBucketValue(DefaultBucket, "leader"); err != nil {
+		t.Fatalf("key of a renewed lease: %v", err)
+	}
+
+	// Once the lease lapses its keys go, and watchers see them expire
+	events := make(chan *KVEvent, 1)
+	go func() {
+		event, _ := db.WatchBucketKey(context.Background(), DefaultBucket, "leader", 0)
+		events <- event
+	}()
+	waitForKVWatchers(t, db, DefaultBucket+"/leader", 1)
+	time.Sleep(250 * time.Millisecond)
+	db.sweepExpiredKV()
+	if _, err := db.GetBucketValue(DefaultBucket, "leader"); err == nil {
+		t.Fatal("key outlived its lease")
+	}
+	if event := <-events; event == nil || event.Type != "expire" {
+		t.Fatalf("watch event = %+v", event)
+	}
+	if _, err := db.KeepAliveLease(lease.ID); err == nil {
+		t.Fatal("expired lease renewed")
+	}
+	if _, err := db.GetLease(lease.ID); err == nil {
+		t.Fatal("expired lease still listed")
+	}
+}
+
+func TestRevokedLeaseDeletesKeys(t *testing.T) {
+	db := newTestDatabase(t)
+	lease, err := db.CreateLease(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b"} {
+		if _, err := db.PutBucketValue(DefaultBucket, key, 1, PutOptions{LeaseID: lease.ID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A key written again without the lease leaves it
+	if _, err := db.PutBucketValue(DefaultBucket, "b", 2, PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RevokeLease(lease.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetBucketValue(DefaultBucket, "a"); err == nil {
+		t.Fatal("key of a revoked lease remains")
+	}
+	if value, err := db.GetBucketValue(DefaultBucket, "b"); err != nil || value != 2 {
+		t.Fatalf("detached key = %v, %v", value, err)
+	}
+	if err := db.RevokeLease(lease.ID); err == nil {
+		t.Fatal("lease revoked twice")
+	}
+}
+
+func TestKeyWatchDeliveryAndDrop(t *testing.T) {
+	db := newTestDatabase(t)
+	revision, err := db.PutBucketValue(DefaultBucket, "config", "v1", PutOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A watch past the current revision waits for the next change
+	events := make(chan *KVEvent, 1)
+	go func() {
+		event, _ := db.WatchBucketKey(context.Background(), DefaultBucket, "config", revision)
+		events <- event
+	}()
+	waitForKVWatchers(t, db, DefaultBucket+"/config", 1)
+	next, err := db.PutBucketValue(DefaultBucket, "config", "v2", PutOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event := <-events; event == nil || event.Type != "put" || event.Value != "v2" || event.Revision != next || event.HLC == nil {
+		t.Fatalf("watch event = %+v", event)
+	}
+
+	// A watch behind the current revision returns at once
+	event, err := db.WatchBucketKey(context.Background(), DefaultBucket, "config", revision)
+	if err != nil || event == nil || event.Revision != next {
+		t.Fatalf("watch of a newer revision = %+v, %v", event, err)
+	}
+
+	// A dropped watch removes its watcher
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		event, err := db.WatchBucketKey(ctx, DefaultBucket, "config", next)
+		if event != nil {
+			t.Errorf("dropped watch got %+v", event)
+		}
+		done <- err
+	}()
+	waitForKVWatchers(t, db, DefaultBucket+"/config", 1)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("dropped watch ended with %v", err)
+	}
+	waitForKVWatchers(t, db, DefaultBucket+"/config", 0)
+}
+
+// waitForKVWatchers waits until watchKey has count watchers
+func waitForKVWatchers(t *testing.T, db *MultiModelDatabase, watchKey string, count int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		db.kvMutex.RLock()
+		watchers := len(db.kvWatchers[watchKey])
+		db.kvMutex.RUnlock()
+		if watchers == count {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s has %d watchers, want %d", watchKey, watchers, count)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kinds of derivation recorded in lineage
+const (
+	LineageReference  = "reference"  // edges and nodes materialized from a DocumentReference
+	LineageProjection = "projection" // documents and rows of a projection view
+)
+
+// LineageItem identifies a piece of data the way write events do: Namespace is the
+// collection, bucket or column family, "nodes" or "edges" for the graph, and Key the
+// document id, KV key, row key or node or edge id
+type LineageItem struct {
+	Model     Model  `json:"model"`
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+}
+
+// Derivation tells how derived data was produced: by what, for example the
+// reference orders.customer_id, and from which items. Projection views are built
+// on every read, so their derivations carry no time.
+type Derivation struct {
+	Kind     string        `json:"kind"`
+	Producer string        `json:"producer"`
+	Sources  []LineageItem `json:"sources"`
+	At       *time.Time    `json:"at,omitempty"`
+}
+
+// Dependent is an item derived from another
+type Dependent struct {
+	LineageItem
+	Kind     string `json:"kind"`
+	Producer string `json:"producer"`
+}
+
+// Lineage tells what produced an item and what depends on it
+type Lineage struct {
+	Item       LineageItem `json:"item"`
+	ProducedBy *Derivation `json:"produced_by"`
+	Dependents []Dependent `json:"dependents"`
+}
+
+// lineageSet records the derivations of the data the engine derives across models,
+// with the items derived from each source
+type lineageSet struct {
+	derived    map[LineageItem]*Derivation
+	dependents map[LineageItem]map[LineageItem]bool
+	mutex      sync.RWMutex
+}
+
+func newLineageSet() *lineageSet {
+	return &lineageSet{
+		derived:    make(map[LineageItem]*Derivation),
+		dependents: make(map[LineageItem]map[LineageItem]bool),
+	}
+}
+
+// record notes that item was produced as derivation tells, replacing what was noted
+func (s *lineageSet) record(item LineageItem, derivation *Derivation) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.unlink(item)
+	now := time.Now().UTC()
+	derivation.At = &now
+	s.derived[item] = derivation
+	for _, source := range derivation.Sources {
+		if s.dependents[source] == nil {
+			s.dependents[source] = make(map[LineageItem]bool)
+		}
+		s.dependents[source][item] = true
+	}
+}
+
+// forget drops the derivation of an item that was removed
+func (s *lineageSet) forget(item LineageItem) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.unlink(item)
+}
+
+// unlink removes the derivation of item. Callers must hold the mutex.
+func (s *lineageSet) unlink(item LineageItem) {
+	derivation, exists := s.derived[item]
+	if !exists {
+		return
+	}
+	delete(s.derived, item)
+	for _, source := range derivation.Sources {
+		delete(s.dependents[source], item)
+		if len(s.dependents[source]) == 0 {
+			delete(s.dependents, source)
+		}
+	}
+}
+
+// ParseModel parses the name of a data model
+func ParseModel(name string) (Model, error) {
+	switch model := Model(name); model {
+	case ModelDocument, ModelKeyValue, ModelColumn, ModelGraph:
+		return model, nil
+	}
+	return "", fmt.Errorf("unknown model %q, expected %s, %s, %s or %s", name, ModelDocument, ModelKeyValue, ModelColumn, ModelGraph)
+}
+
+// Lineage returns what produced item and what depends on it: the derivations
+// recorded for the edges and nodes materialized from document references, and the
+// rows and documents of the projection views, which every document and row has.
+// Items nothing is known about have neither.
+func (db *MultiModelDatabase) Lineage(item LineageItem) (*Lineage, error) {
+	if _, err := ParseModel(string(item.Model)); err != nil {
+		return nil, err
+	}
+	lineage := &Lineage{Item: item, Dependents: make([]Dependent, 0)}
+
+	db.lineage.mutex.RLock()
+	if derivation, exists := db.lineage.derived[item]; exists {
+		copied := *derivation
+		lineage.ProducedBy = &copied
+	}
+	for dependent := range db.lineage.dependents[item] {
+		derivation := db.lineage.derived[dependent]
+		lineage.Dependents = append(lineage.Dependents, Dependent{LineageItem: dependent, Kind: derivation.Kind, Producer: derivation.Producer})
+	}
+	db.lineage.mutex.RUnlock()
+
+	db.projectionLineage(lineage)
+	sort.Slice(lineage.Dependents, func(i, j int) bool {
+		a, b := lineage.Dependents[i], lineage.Dependents[j]
+		if a.Model != b.Model {
+			return a.Model < b.Model
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Key < b.Key
+	})
+	return lineage, nil
+}
+
+// projectionLineage adds the lineage of the projection views to the lineage of a
+// document or a column row
+func (db *MultiModelDatabase) projectionLineage(lineage *Lineage) {
+	item := lineage.Item
+	switch item.Model {
+	case ModelDocument:
+		if family, isView := viewedFamily(item.Namespace); isView {
+			lineage.ProducedBy = &Derivation{
+				Kind:     LineageProjection,
+				Producer: "view " + item.Namespace,
+				Sources:  []LineageItem{{Model: ModelColumn, Namespace: family, Key: item.Key}},
+			}
+		} else if !IsSystemCollection(item.Namespace) {
+			view := DocumentsViewPrefix + item.Namespace
+			lineage.Dependents = append(lineage.Dependents, Dependent{
+				LineageItem: LineageItem{Model: ModelColumn, Namespace: view, Key: item.Key},
+				Kind:        LineageProjection,
+				Producer:    "view " + view,
+			})
+		}
+	case ModelColumn:
+		if collection, isView := viewedCollection(item.Namespace); isView {
+			lineage.ProducedBy = &Derivation{
+				Kind:     LineageProjection,
+				Producer: "view " + item.Namespace,
+				Sources:  []LineageItem{{Model: ModelDocument, Namespace: collection, Key: item.Key}},
+			}
+		} else {
+			view := ColumnsViewPrefix + item.Namespace
+			lineage.Dependents = append(lineage.Dependents, Dependent{
+				LineageItem: LineageItem{Model: ModelDocument, Namespace: view, Key: item.Key},
+				Kind:        LineageProjection,
+				Producer:    "view " + view,
+			})
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLineage(t *testing.T) {
+	db := newTestDatabase(t)
+	if err := db.InsertDocument("orders", "o1", Document{"customer_id": "c1"}); err != nil {
+		t.Fatal(err)
+	}
+	ref := DocumentReference{Collection: "orders", Field: "customer_id", Target: "customers", EdgeType: "ORDERED_BY"}
+	if err := db.DefineDocumentReference(context.Background(), ref); err != nil {
+		t.Fatal(err)
+	}
+	order := LineageItem{Model: ModelDocument, Namespace: "orders", Key: "o1"}
+	edge := LineageItem{Model: ModelGraph, Namespace: "edges", Key: referenceEdgeID(&ref, "o1", "c1")}
+
+	// Materialized edges and nodes name the document they were produced from
+	lineage, err := db.Lineage(edge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := lineage.ProducedBy; p == nil || p.Kind != LineageReference || p.Producer != "reference orders.customer_id" || len(p.Sources) != 1 || p.Sources[0] != order || p.At == nil {
+		t.Fatalf("edge produced by %+v", p)
+	}
+	lineage, err = db.Lineage(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []LineageItem{
+		{Model: ModelColumn, Namespace: "_docs.orders", Key: "o1"},
+		{Model: ModelGraph, Namespace: "edges", Key: edge.Key},
+		{Model: ModelGraph, Namespace: "nodes", Key: "customers:c1"},
+		{Model: ModelGraph, Namespace: "nodes", Key: "orders:o1"},
+	}
+	if lineage.ProducedBy != nil || len(lineage.Dependents) != len(expected) {
+		t.Fatalf("order lineage = %+v", lineage)
+	}
+	for i, item := range expected {
+		if lineage.Dependents[i].LineageItem != item {
+			t.Fatalf("dependent %d = %+v, expected %+v", i, lineage.Dependents[i], item)
+		}
+	}
+
+	// Removed edges are forgotten
+	if err := db.DeleteDocument("orders", "o1"); err != nil {
+		t.Fatal(err)
+	}
+	if lineage, err := db.Lineage(edge); err != nil || lineage.ProducedBy != nil {
+		t.Fatalf("removed edge lineage = %+v, %v", lineage, err)
+	}
+
+	// Projection views derive from their source
+	view := LineageItem{Model: ModelDocument, Namespace: "_columns.metrics", Key: "host1"}
+	if lineage, err := db.Lineage(view); err != nil || lineage.ProducedBy.Sources[0] != (LineageItem{Model: ModelColumn, Namespace: "metrics", Key: "host1"}) {
+		t.Fatalf("view lineage = %+v, %v", lineage, err)
+	}
+	if _, err := db.Lineage(LineageItem{Model: "table", Namespace: "t", Key: "1"}); err == nil {
+		t.Fatal("unknown model accepted")
+	}
+}
@@ -0,0 +1,238 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrLockHeld is returned when a lock is held by another owner
+var ErrLockHeld = errors.New("lock is held by another owner")
+
+// ErrLockNotHeld is returned when releasing a lock the owner does not hold
+var ErrLockNotHeld = errors.New("lock is not held by this owner")
+
+// Lock describes an acquired lock. The fencing token grows with every acquisition of
+// the lock, so resources guarded by it can reject requests from a previous holder
+// whose lease ran out.
+type Lock struct {
+	Name         string    `json:"name"`
+	Owner        string    `json:"owner"`
+	FencingToken uint64    `json:"fencing_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	Granted      int       `json:"granted"` // nodes that granted the lock
+	Quorum       int       `json:"quorum"`  // grants needed
+}
+
+type heldLock struct {
+	owner     string
+	fencing   uint64
+	expiresAt time.Time
+}
+
+// lockTable holds the locks granted by this node
+type lockTable struct {
+	locks   map[string]*heldLock
+	fencing map[string]uint64 // last fencing token issued per lock name
+	mutex   sync.Mutex
+}
+
+func newLockTable() *lockTable {
+	return &lockTable{locks: make(map[string]*heldLock), fencing: make(map[string]uint64)}
+}
+
+// grant gives name to owner until ttl elapses. A grant to the current holder renews
+// the lease and keeps its fencing token.
+func (t *lockTable) grant(name, owner string, ttl time.Duration) (uint64, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	if held, exists := t.locks[name]; exists && now.Before(held.expiresAt) {
+		if held.owner != owner {
+			return 0, fmt.Errorf("%w: %s", ErrLockHeld, name)
+		}
+		held.expiresAt = now.Add(ttl)
+		return held.fencing, nil
+	}
+
+	t.fencing[name]++
+	t.locks[name] = &heldLock{owner: owner, fencing: t.fencing[name], expiresAt: now.Add(ttl)}
+	return t.fencing[name], nil
+}
+
+// observe raises the fencing counter of name to at least token, so tokens issued
+// by this node keep growing after a quorum acquisition elsewhere
+func (t *lockTable) observe(name string, token uint64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if token > t.fencing[name] {
+		t.fencing[name] = token
+	}
+	if held, exists := t.locks[name]; exists && token > held.fencing {
+		held.fencing = token
+	}
+}
+
+func (t *lockTable) release(name, owner string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	held, exists := t.locks[name]
+	if !exists || held.owner != owner || !time.Now().Before(held.expiresAt) {
+		return fmt.Errorf("%w: %s", ErrLockNotHeld, name)
+	}
+	delete(t.locks, name)
+	return nil
+}
+
+// GrantLock records a lock grant on this node only. Peers call it while another
+// node gathers a quorum.
+func (db *MultiModelDatabase) GrantLock(name, owner string, ttl time.Duration) (uint64, error) {
+	return db.locks.grant(name, owner, ttl)
+}
+
+// RevokeLock removes a grant from this node only
+func (db *MultiModelDatabase) RevokeLock(name, owner string) error {
+	return db.locks.release(name, owner)
+}
+
+// ObserveLockToken raises this node's fencing counter for name after a quorum
+// acquisition that used token
+func (db *MultiModelDatabase) ObserveLockToken(name string, token uint64) {
+	db.locks.observe(name, token)
+}
+
+// AcquireLock acquires name for owner for ttl; acquiring a lock the owner already
+// holds renews it. With clustering enabled a majority of the active nodes must
+// grant the lock. Since any two majorities share a node, two owners cannot hold the
+// lock at once, and the fencing token, the highest one among the grants, grows with
+// every acquisition. Grants are returned when no majority is reached or when
+// gathering them took longer than ttl.
+func (db *MultiModelDatabase) AcquireLock(name, owner string, ttl time.Duration) (*Lock, error) {
+	if name == "" || owner == "" {
+		return nil, fmt.Errorf("lock name and owner are required")
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("lock ttl must be positive")
+	}
+
+	start := time.Now()
+	if db.Cluster == nil {
+		token, err := db.locks.grant(name, owner, ttl)
+		if err != nil {
+			return nil, err
+		}
+		return &Lock{Name: name, Owner: owner, FencingToken: token, ExpiresAt: start.Add(ttl), Granted: 1, Quorum: 1}, nil
+	}
+
+	nodes := db.Cluster.GetActiveNodes()
+	lock := &Lock{Name: name, Owner: owner, Quorum: len(nodes)/2 + 1}
+	tokens := make([]uint64, len(nodes))
+	errs := make([]error, len(nodes))
+	db.eachNode(nodes, func(i int, node *Node, local bool) {
+		if local {
+			tokens[i], errs[i] = db.GrantLock(name, owner, ttl)
+			return
+		}
+		var grant struct {
+			FencingToken uint64 `json:"fencing_token"`
+		}
+		errs[i] = db.Cluster.call(node, lockPath(name, "grant"), lockRequest{Owner: owner, TTL: ttl.String()}, &grant)
+		tokens[i] = grant.FencingToken
+	})
+
+	var granted []*Node
+	var refusal error
+	for i, node := range nodes {
+		if errs[i] != nil {
+			if refusal == nil || errors.Is(errs[i], ErrLockHeld) {
+				refusal = errs[i]
+			}
+			continue
+		}
+		granted = append(granted, node)
+		if tokens[i] > lock.FencingToken {
+			lock.FencingToken = tokens[i]
+		}
+	}
+	lock.Granted = len(granted)
+	lock.ExpiresAt = start.Add(ttl)
+
+	if lock.Granted < lock.Quorum || time.Now().After(lock.ExpiresAt) {
+		db.revokeLockOn(granted, name, owner)
+		if refusal == nil {
+			refusal = fmt.Errorf("lock %s expired while gathering grants", name)
+		}
+		return nil, fmt.Errorf("lock %s granted by %d of %d nodes, %d needed: %w", name, lock.Granted, len(nodes), lock.Quorum, refusal)
+	}
+
+	// Make the chosen token known to the granting nodes so later tokens exceed it
+	db.eachNode(granted, func(i int, node *Node, local bool) {
+		if local {
+			db.ObserveLockToken(name, lock.FencingToken)
+			return
+		}
+		db.Cluster.post(node, lockPath(name, "observe"), map[string]uint64{"fencing_token": lock.FencingToken})
+	})
+	return lock, nil
+}
+
+// ReleaseLock releases name held by owner on every node that granted it
+func (db *MultiModelDatabase) ReleaseLock(name, owner string) error {
+	if db.Cluster == nil {
+		return db.locks.release(name, owner)
+	}
+	if released := db.revokeLockOn(db.Cluster.GetActiveNodes(), name, owner); released == 0 {
+		return fmt.Errorf("%w: %s", ErrLockNotHeld, name)
+	}
+	return nil
+}
+
+// revokeLockOn removes owner's grants of name from nodes and returns how many nodes
+// held one
+func (db *MultiModelDatabase) revokeLockOn(nodes []*Node, name, owner string) int {
+	errs := make([]error, len(nodes))
+	db.eachNode(nodes, func(i int, node *Node, local bool) {
+		if local {
+			errs[i] = db.RevokeLock(name, owner)
+		} else {
+			errs[i] = db.Cluster.post(node, lockPath(name, "revoke"), lockRequest{Owner: owner})
+		}
+	})
+
+	released := 0
+	for _, err := range errs {
+		if err == nil {
+			released++
+		}
+	}
+	return released
+}
+
+// lockRequest is the body of node to node lock requests
+type lockRequest struct {
+	Owner string `json:"owner"`
+	TTL   string `json:"ttl,omitempty"`
+}
+
+func lockPath(name, action string) string {
+	return "/data/locks/" + url.PathEscape(name) + "/" + action
+}
+
+// eachNode runs fn for every node in parallel and waits for all of them
+func (db *MultiModelDatabase) eachNode(nodes []*Node, fn func(i int, node *Node, local bool)) {
+	self := db.Cluster.Self().ID
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node *Node) {
+			defer wg.Done()
+			fn(i, node, node.ID == self)
+		}(i, node)
+	}
+	wg.Wait()
+}
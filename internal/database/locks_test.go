@@ -0,0 +1,39 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLocalLocks(t *testing.T) {
+	db := newTestDatabase(t)
+
+	first, err := db.AcquireLock("leader", "a", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AcquireLock("leader", "b", time.Minute); !errors.Is(err, ErrLockHeld) {
+		t.Fatalf("expected ErrLockHeld, got %v", err)
+	}
+	renewed, err := db.AcquireLock("leader", "a", time.Minute)
+	if err != nil || renewed.FencingToken != first.FencingToken {
+		t.Fatalf("renewal: %+v %v", renewed, err)
+	}
+
+	if err := db.ReleaseLock("leader", "b"); !errors.Is(err, ErrLockNotHeld) {
+		t.Fatalf("expected ErrLockNotHeld, got %v", err)
+	}
+	if err := db.ReleaseLock("leader", "a"); err != nil {
+		t.Fatal(err)
+	}
+	second, err := db.AcquireLock("leader", "b", 10*time.Millisecond)
+	if err != nil || second.FencingToken <= first.FencingToken {
+		t.Fatalf("reacquire: %+v %v", second, err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, err := db.AcquireLock("leader", "a", time.Minute); err != nil {
+		t.Fatalf("expired lock was not released: %v", err)
+	}
+}
@@ -0,0 +1,338 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"multimodel-db-engine/internal/config"
+)
+
+// Stores the memory governor evicts from, named in the eviction order
+const (
+	EvictRawCache = "rawcache" // cached document encodings, rebuilt on the next read
+	EvictKV       = "kv"       // keys of evictable buckets, soonest to expire first
+	EvictArchives = "archives" // resident pages of archived collections, read back from their files
+)
+
+// DefaultEvictionOrder is used when no eviction order is configured
+const DefaultEvictionOrder = EvictRawCache + "," + EvictKV + "," + EvictArchives
+
+// memorySampleInterval is how often memory use is compared with the budget
+const memorySampleInterval = time.Second
+
+// memoryEventHistory is the number of memory events kept for /admin/memory
+const memoryEventHistory = 64
+
+// memoryHeadroom is the share of the budget freed beyond the excess once over it, so
+// eviction does not run again on the next allocation
+const memoryHeadroom = 10
+
+// MemoryEvent records a warning threshold crossed or an eviction
+type MemoryEvent struct {
+	Time       time.Time `json:"time"`
+	Type       string    `json:"type"` // memory_warning or memory_evicted
+	Percent    int       `json:"percent"`
+	UsageBytes uint64    `json:"usage_bytes"`
+	Threshold  int       `json:"threshold,omitempty"` // the warning threshold crossed, upwards
+	Store      string    `json:"store,omitempty"`
+	Evicted    int       `json:"evicted,omitempty"` // items dropped from the store
+	Released   int       `json:"released_bytes,omitempty"`
+}
+
+// MemoryStats reports memory use against the budget
+type MemoryStats struct {
+	LimitBytes    uint64         `json:"limit_bytes"` // 0 when no budget is configured
+	UsageBytes    uint64         `json:"usage_bytes"`
+	Percent       int            `json:"percent,omitempty"`
+	EvictionOrder []string       `json:"eviction_order,omitempty"`
+	WarnPercent   []int          `json:"warn_percent,omitempty"`
+	Evicted       map[string]int `json:"evicted,omitempty"` // items dropped per store since startup
+	Events        []MemoryEvent  `json:"events"`
+}
+
+// memoryGovernor keeps the process within a soft memory budget. It raises warning
+// events as use crosses thresholds of the budget, and once over it evicts data that
+// can be rebuilt or read back, store by store in the configured order, instead of
+// letting the process run out of memory.
+type memoryGovernor struct {
+	limit   uint64
+	order   []string
+	warnAt  []int // ascending percentages
+	level   int   // number of thresholds crossed at the last sample
+	usage   uint64
+	evicted map[string]int
+	events  []MemoryEvent
+	mutex   sync.Mutex
+}
+
+// ParseEvictionOrder parses a comma-separated list of stores to evict from, e.g.
+// "kv,rawcache"
+func ParseEvictionOrder(spec string) ([]string, error) {
+	var order []string
+	seen := make(map[string]bool)
+	for _, store := range strings.Split(spec, ",") {
+		store = strings.TrimSpace(store)
+		if store == "" {
+			continue
+		}
+		switch store {
+		case EvictRawCache, EvictKV, EvictArchives:
+		default:
+			return nil, fmt.Errorf("unknown store %q, must be one of %s", store, DefaultEvictionOrder)
+		}
+		if !seen[store] {
+			seen[store] = true
+			order = append(order, store)
+		}
+	}
+	return order, nil
+}
+
+// parseWarnPercent parses a comma-separated list of percentages of the budget
+func parseWarnPercent(spec string) ([]int, error) {
+	var percents []int
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		percent, err := strconv.Atoi(entry)
+		if err != nil || percent <= 0 || percent > 100 {
+			return nil, fmt.Errorf("warning threshold %q must be a percentage between 1 and 100", entry)
+		}
+		percents = append(percents, percent)
+	}
+	sort.Ints(percents)
+	return percents, nil
+}
+
+// enableMemoryLimit sets the runtime's soft memory limit to the configured budget and
+// starts the governor enforcing it
+func (db *MultiModelDatabase) enableMemoryLimit(cfg *config.Config) {
+	spec := cfg.MemoryEviction
+	if spec == "" {
+		spec = DefaultEvictionOrder
+	}
+	order, err := ParseEvictionOrder(spec)
+	if err != nil {
+		log.Printf("Ignoring memory eviction order: %v", err)
+		order, _ = ParseEvictionOrder(DefaultEvictionOrder)
+	}
+	warnAt, err := parseWarnPercent(cfg.MemoryWarnAt)
+	if err != nil {
+		log.Printf("Ignoring memory warning thresholds: %v", err)
+		warnAt = nil
+	}
+
+	db.memory = &memoryGovernor{
+		limit:   uint64(cfg.MemoryLimitMB) << 20,
+		order:   order,
+		warnAt:  warnAt,
+		evicted: make(map[string]int),
+	}
+	debug.SetMemoryLimit(int64(db.memory.limit))
+	db.routines.run("memory-governor", func() { db.startMemoryGovernor(db.ctx) })
+}
+
+func (db *MultiModelDatabase) startMemoryGovernor(ctx context.Context) {
+	ticker := time.NewTicker(memorySampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			db.checkMemory(memoryUsage())
+		}
+	}
+}
+
+// memoryUsage returns the memory the Go runtime holds from the operating system,
+// the measure its own soft limit applies to
+func memoryUsage() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.Sys - stats.HeapReleased
+}
+
+// checkMemory compares usage with the budget, raising warnings for the thresholds
+// crossed since the last check and evicting once over the budget
+func (db *MultiModelDatabase) checkMemory(usage uint64) {
+	m := db.memory
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	m.usage = usage
+	percent := m.percent(usage)
+	level := sort.SearchInts(m.warnAt, percent+1)
+	crossed := level > m.level
+	m.level = level
+	m.mutex.Unlock()
+
+	if crossed {
+		threshold := m.warnAt[level-1]
+		log.Printf("WARNING: memory use at %d%% of the %d MB budget", percent, m.limit>>20)
+		db.recordMemoryEvent(MemoryEvent{Type: EventMemoryWarning, Percent: percent, UsageBytes: usage, Threshold: threshold})
+	}
+	if usage <= m.limit {
+		return
+	}
+
+	target := int(usage - m.limit + m.limit*memoryHeadroom/100)
+	released := 0
+	for _, store := range m.order {
+		if released >= target {
+			break
+		}
+		evicted, freed := db.evictStore(store, target-released)
+		if evicted == 0 {
+			continue
+		}
+		released += freed
+		log.Printf("Evicted %d items (%d bytes) from %s to stay within the memory budget", evicted, freed, store)
+		m.mutex.Lock()
+		m.evicted[store] += evicted
+		m.mutex.Unlock()
+		db.recordMemoryEvent(MemoryEvent{Type: EventMemoryEvicted, Percent: percent, UsageBytes: usage, Store: store, Evicted: evicted, Released: freed})
+	}
+	if released > 0 {
+		debug.FreeOSMemory()
+	}
+}
+
+func (m *memoryGovernor) percent(usage uint64) int {
+	return int(usage * 100 / m.limit)
+}
+
+// evictStore drops at least n bytes from store where it holds that much, returning
+// the items dropped and the bytes released
+func (db *MultiModelDatabase) evictStore(store string, n int) (int, int) {
+	switch store {
+	case EvictRawCache:
+		return db.rawDocs.evict(n)
+	case EvictKV:
+		return db.evictKV(n)
+	case EvictArchives:
+		return db.releaseArchives(n)
+	}
+	return 0, 0
+}
+
+// evictKV drops keys of evictable buckets, those expiring soonest first and keys
+// without a TTL last, until n bytes of values are released. Watchers observe an
+// "evict" event for every key dropped.
+func (db *MultiModelDatabase) evictKV(n int) (int, int) {
+	db.kvMutex.Lock()
+	defer db.kvMutex.Unlock()
+
+	type candidate struct {
+		bucket    string
+		key       string
+		expiresAt time.Time
+	}
+	var candidates []candidate
+	for name, b := range db.kvBuckets {
+		if !b.options.Evictable {
+			continue
+		}
+		for key, entry := range b.entries {
+			candidates = append(candidates, candidate{name, key, entry.expiresAt})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i].expiresAt, candidates[j].expiresAt
+		if a.IsZero() != b.IsZero() {
+			return b.IsZero()
+		}
+		return a.Before(b)
+	})
+
+	evicted, released := 0, 0
+	for _, c := range candidates {
+		if released >= n {
+			break
+		}
+		b := db.kvBuckets[c.bucket]
+		released += len(c.key) + int(entrySize(b.entries[c.key]))
+		evicted++
+		db.removeBucketEntry(c.bucket, b, c.key, "evict")
+	}
+	return evicted, released
+}
+
+// releaseArchives drops the resident pages of archived collections, largest first,
+// until n bytes are released
+func (db *MultiModelDatabase) releaseArchives(n int) (int, int) {
+	db.docMutex.RLock()
+	defer db.docMutex.RUnlock()
+
+	archives := make([]*archive, 0, len(db.archives))
+	for _, a := range db.archives {
+		archives = append(archives, a)
+	}
+	sort.Slice(archives, func(i, j int) bool { return len(archives[i].data) > len(archives[j].data) })
+
+	evicted, released := 0, 0
+	for _, a := range archives {
+		if released >= n {
+			break
+		}
+		if freed := a.release(); freed > 0 {
+			released += freed
+			evicted++
+		}
+	}
+	return evicted, released
+}
+
+// recordMemoryEvent keeps a memory event for /admin/memory and publishes it on the
+// cluster event stream when clustering is enabled
+func (db *MultiModelDatabase) recordMemoryEvent(event MemoryEvent) {
+	event.Time = time.Now()
+	m := db.memory
+	m.mutex.Lock()
+	m.events = append(m.events, event)
+	if len(m.events) > memoryEventHistory {
+		m.events = m.events[len(m.events)-memoryEventHistory:]
+	}
+	m.mutex.Unlock()
+
+	if db.Cluster != nil {
+		db.Cluster.events.publish(event.Type, db.Cluster.selfNode.ID, event)
+	}
+}
+
+// MemoryStats reports memory use and, when a budget is configured, the eviction
+// settings, the items evicted so far and the latest memory events
+func (db *MultiModelDatabase) MemoryStats() MemoryStats {
+	m := db.memory
+	if m == nil {
+		return MemoryStats{UsageBytes: memoryUsage(), Events: make([]MemoryEvent, 0)}
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stats := MemoryStats{
+		LimitBytes:    m.limit,
+		UsageBytes:    m.usage,
+		Percent:       m.percent(m.usage),
+		EvictionOrder: m.order,
+		WarnPercent:   m.warnAt,
+		Evicted:       make(map[string]int, len(m.evicted)),
+		Events:        append(make([]MemoryEvent, 0, len(m.events)), m.events...),
+	}
+	for store, count := range m.evicted {
+		stats.Evicted[store] = count
+	}
+	return stats
+}
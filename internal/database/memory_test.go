@@ -0,0 +1,94 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryGovernorWarnsAndEvicts(t *testing.T) {
+	db := newTestDatabase(t)
+	// Set up the governor directly, the runtime limit would slow the whole test binary
+	db.memory = &memoryGovernor{
+		limit:   1 << 20,
+		order:   []string{EvictKV, EvictRawCache},
+		warnAt:  []int{50, 90},
+		evicted: make(map[string]int),
+	}
+
+	if err := db.SetBucketOptions("cache", BucketOptions{Evictable: true}); err != nil {
+		t.Fatal(err)
+	}
+	value := strings.Repeat("x", 64<<10)
+	for i := 0; i < 8; i++ {
+		ttl := time.Duration(i+1) * time.Hour
+		if i == 0 {
+			ttl = -1 // never expires, so it goes last
+		}
+		if _, err := db.PutBucketValue("cache", fmt.Sprintf("k%d", i), value, PutOptions{TTL: ttl}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.PutBucketValue("kept", "k", value, PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	db.checkMemory(600 << 10)
+	stats := db.MemoryStats()
+	if len(stats.Events) != 1 || stats.Events[0].Type != EventMemoryWarning || stats.Events[0].Threshold != 50 {
+		t.Fatalf("expected a warning at 50%%, got %+v", stats.Events)
+	}
+	db.checkMemory(700 << 10)
+	if events := db.MemoryStats().Events; len(events) != 1 {
+		t.Fatalf("expected no new warning below the next threshold, got %+v", events)
+	}
+
+	// 256KB over the budget plus headroom evicts the keys expiring soonest
+	db.checkMemory(1<<20 + 256<<10)
+	stats = db.MemoryStats()
+	evicted := stats.Evicted[EvictKV]
+	if evicted == 0 || evicted == 8 {
+		t.Fatalf("expected some of the evictable keys to be evicted, got %d", evicted)
+	}
+	if _, err := db.GetBucketValue("cache", "k1"); err == nil {
+		t.Fatal("expected the key expiring soonest to be evicted")
+	}
+	if _, err := db.GetBucketValue("cache", "k0"); err != nil {
+		t.Fatalf("expected the key without a TTL to be kept: %v", err)
+	}
+	if _, err := db.GetBucketValue("kept", "k"); err != nil {
+		t.Fatalf("expected keys of other buckets to be kept: %v", err)
+	}
+	last := stats.Events[len(stats.Events)-1]
+	if last.Type != EventMemoryEvicted || last.Store != EvictKV || last.Evicted != evicted {
+		t.Fatalf("expected an eviction event for the kv store, got %+v", last)
+	}
+	if stats.Events[len(stats.Events)-2].Threshold != 90 {
+		t.Fatalf("expected a warning at 90%% before evicting, got %+v", stats.Events)
+	}
+
+	// Dropping below a threshold rearms its warning
+	db.checkMemory(100 << 10)
+	db.checkMemory(600 << 10)
+	stats = db.MemoryStats()
+	if last := stats.Events[len(stats.Events)-1]; last.Type != EventMemoryWarning || last.Threshold != 50 {
+		t.Fatalf("expected a new warning at 50%%, got %+v", last)
+	}
+}
+
+func TestParseEvictionOrder(t *testing.T) {
+	order, err := ParseEvictionOrder(" kv, rawcache ,kv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(order, ",") != "kv,rawcache" {
+		t.Fatalf("unexpected order %v", order)
+	}
+	if _, err := ParseEvictionOrder("kv,heap"); err == nil {
+		t.Fatal("expected unknown stores to be rejected")
+	}
+	if _, err := parseWarnPercent("90,120"); err == nil {
+		t.Fatal("expected thresholds over 100% to be rejected")
+	}
+}
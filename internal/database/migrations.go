@@ -0,0 +1,336 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MigrationsCollection is the system collection recording applied migrations
+const MigrationsCollection = "_migrations"
+
+// Migration step operations
+const (
+	MigrationBackfill = "backfill" // set Field to Value on documents that lack it
+	MigrationRename   = "rename"   // rename Field to To
+	MigrationRemove   = "remove"   // delete Field
+)
+
+// MigrationStep is a declarative change applied to every document of a collection
+// that matches Where (field equality, empty matches all)
+type MigrationStep struct {
+	Op         string                 `json:"op"`
+	Collection string                 `json:"collection"`
+	Field      string                 `json:"field"`
+	To         string                 `json:"to,omitempty"`
+	Value      interface{}            `json:"value,omitempty"`
+	Where      map[string]interface{} `json:"where,omitempty"`
+}
+
+// Migration is a versioned change applied at most once. Declarative Steps of one
+// migration are applied atomically; embedding applications may instead provide Up
+// for changes that need code.
+type Migration struct {
+	Version int             `json:"version"`
+	Name    string          `json:"name"`
+	Steps   []MigrationStep `json:"steps,omitempty"`
+
+	Up func(db *MultiModelDatabase) error `json:"-"`
+}
+
+// MigrationRecord is stored in the migrations collection for each applied migration
+type MigrationRecord struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	Checksum  string    `json:"checksum"`
+	AppliedAt time.Time `json:"applied_at"`
+	Documents int       `json:"documents"` // documents changed by declarative steps
+}
+
+// MigrationResult reports what a migration run did
+type MigrationResult struct {
+	Applied []MigrationRecord `json:"applied"`
+	Pending []int             `json:"pending,omitempty"` // versions that would run in a dry run
+	Current int               `json:"current"`
+}
+
+type migrationRegistry struct {
+	migrations map[int]Migration
+	mutex      sync.Mutex // also serializes migration runs
+}
+
+// RegisterMigration adds a migration to run on the next Migrate call. Embedding
+// applications typically register their migrations at startup.
+func (db *MultiModelDatabase) RegisterMigration(m Migration) error {
+	if err := validateMigration(m); err != nil {
+		return err
+	}
+
+	db.migrations.mutex.Lock()
+	defer db.migrations.mutex.Unlock()
+
+	if db.migrations.migrations == nil {
+		db.migrations.migrations = make(map[int]Migration)
+	}
+	if _, exists := db.migrations.migrations[m.Version]; exists {
+		return fmt.Errorf("migration %d is already registered", m.Version)
+	}
+	db.migrations.migrations[m.Version] = m
+	return nil
+}
+
+func validateMigration(m Migration) error {
+	if m.Version <= 0 {
+		return fmt.Errorf("migration version must be positive")
+	}
+	if m.Up == nil && len(m.Steps) == 0 {
+		return fmt.Errorf("migration %d has no steps", m.Version)
+	}
+	for i, step := range m.Steps {
+		if step.Collection == "" || step.Field == "" {
+			return fmt.Errorf("migration %d step %d requires collection and field", m.Version, i)
+		}
+		switch step.Op {
+		case MigrationBackfill, MigrationRemove:
+		case MigrationRename:
+			if step.To == "" {
+				return fmt.Errorf("migration %d step %d: rename requires to", m.Version, i)
+			}
+		default:
+			return fmt.Errorf("migration %d step %d: unsupported op %q", m.Version, i, step.Op)
+		}
+	}
+	return nil
+}
+
+// checksum identifies the content of a declarative migration so that a version
+// changed after being applied in one environment is detected in the next
+func (m Migration) checksum() string {
+	encoded, _ := json.Marshal(struct {
+		Name  string          `json:"name"`
+		Steps []MigrationStep `json:"steps"`
+	}{m.Name, m.Steps})
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:8])
+}
+
+// AppliedMigrations returns the applied migrations ordered by version
+func (db *MultiModelDatabase) AppliedMigrations() []MigrationRecord {
+	db.docMutex.RLock()
+	defer db.docMutex.RUnlock()
+	return db.appliedMigrations()
+}
+
+// appliedMigrations reads the migrations collection. Callers must hold docMutex.
+func (db *MultiModelDatabase) appliedMigrations() []MigrationRecord {
+	prefix := MigrationsCollection + "."
+	var records []MigrationRecord
+	for key, doc := range db.documents {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		encoded, err := json.Marshal(doc)
+		if err != nil {
+			continue
+		}
+		var record MigrationRecord
+		if json.Unmarshal(encoded, &record) == nil {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Version < records[j].Version })
+	return records
+}
+
+// Migrate applies registered and supplied migrations that have not been applied yet,
+// in version order, up to target (0 means all). Already applied versions are skipped
+// unless their content changed, which is reported as an error.
+func (db *MultiModelDatabase) Migrate(supplied []Migration, target int, dryRun bool) (*MigrationResult, error) {
+	db.migrations.mutex.Lock()
+	defer db.migrations.mutex.Unlock()
+
+	all := make(map[int]Migration, len(db.migrations.migrations)+len(supplied))
+	for version, m := range db.migrations.migrations {
+		all[version] = m
+	}
+	for _, m := range supplied {
+		if err := validateMigration(m); err != nil {
+			return nil, err
+		}
+		if _, exists := all[m.Version]; exists {
+			return nil, fmt.Errorf("migration %d is defined more than once", m.Version)
+		}
+		all[m.Version] = m
+	}
+
+	records := db.AppliedMigrations()
+	applied := make(map[int]MigrationRecord, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+
+	versions := make([]int, 0, len(all))
+	for version := range all {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+
+	result := &MigrationResult{Applied: []MigrationRecord{}, Current: currentVersion(records)}
+	for _, version := range versions {
+		m := all[version]
+		if record, done := applied[version]; done {
+			if m.Up == nil && record.Checksum != m.checksum() {
+				return result, fmt.Errorf("migration %d was changed after it was applied", version)
+			}
+			continue
+		}
+		if target > 0 && version > target {
+			break
+		}
+		if dryRun {
+			result.Pending = append(result.Pending, version)
+			continue
+		}
+
+		record, err := db.applyMigration(m)
+		if err != nil {
+			result.Current = currentVersion(db.AppliedMigrations())
+			return result, fmt.Errorf("migration %d (%s) failed: %w", version, m.Name, err)
+		}
+		result.Applied = append(result.Applied, *record)
+	}
+
+	result.Current = currentVersion(db.AppliedMigrations())
+	return result, nil
+}
+
+func currentVersion(records []MigrationRecord) int {
+	if len(records) == 0 {
+		return 0
+	}
+	return records[len(records)-1].Version
+}
+
+// applyMigration runs one migration and records it
+func (db *MultiModelDatabase) applyMigration(m Migration) (*MigrationRecord, error) {
+	record := &MigrationRecord{Version: m.Version, Name: m.Name, Checksum: m.checksum()}
+
+	if m.Up != nil {
+		if err := m.Up(db); err != nil {
+			return nil, err
+		}
+		record.AppliedAt = time.Now().UTC()
+		db.docMutex.Lock()
+		db.putMigrationRecord(record)
+		db.docMutex.Unlock()
+		return record, nil
+	}
+
+	db.docMutex.Lock()
+	defer db.docMutex.Unlock()
+
+	// Stage changed copies first so a failing step leaves the store untouched
+	staged := make(map[string]Document)
+	for _, step := range m.Steps {
+		prefix := step.Collection + "."
+		for key, original := range db.documents {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			doc, isStaged := staged[key]
+			if !isStaged {
+				doc = db.expandDocument(original)
+			}
+			if !documentMatches(doc, step.Where) {
+				continue
+			}
+
+			changed, err := applyMigrationStep(step, doc)
+			if err != nil {
+				return nil, fmt.Errorf("document %s: %w", strings.TrimPrefix(key, prefix), err)
+			}
+			if changed != nil {
+				staged[key] = changed
+			}
+		}
+	}
+
+	for key, doc := range staged {
+		collection := key[:strings.Index(key, ".")]
+		db.documents[key] = db.prepareDocument(collection, doc)
+		db.touchCollection(collection)
+		db.syncLog.note(collection, key[len(collection)+1:], false)
+	}
+	record.Documents = len(staged)
+	record.AppliedAt = time.Now().UTC()
+	db.putMigrationRecord(record)
+	return record, nil
+}
+
+// applyMigrationStep returns a changed copy of doc, or nil if the step does not change it
+func applyMigrationStep(step MigrationStep, doc Document) (Document, error) {
+	value, has := doc[step.Field]
+	switch step.Op {
+	case MigrationBackfill:
+		if has {
+			return nil, nil
+		}
+		changed := copyDocument(doc)
+		changed[step.Field] = step.Value
+		return changed, nil
+	case MigrationRename:
+		if !has {
+			return nil, nil
+		}
+		if _, clash := doc[step.To]; clash {
+			return nil, fmt.Errorf("cannot rename %s: field %s already exists", step.Field, step.To)
+		}
+		changed := copyDocument(doc)
+		delete(changed, step.Field)
+		changed[step.To] = value
+		return changed, nil
+	case MigrationRemove:
+		if !has {
+			return nil, nil
+		}
+		changed := copyDocument(doc)
+		delete(changed, step.Field)
+		return changed, nil
+	}
+	return nil, fmt.Errorf("unsupported op %q", step.Op)
+}
+
+// putMigrationRecord stores record in the migrations collection. Callers must hold docMutex.
+func (db *MultiModelDatabase) putMigrationRecord(record *MigrationRecord) {
+	db.touchCollection(MigrationsCollection)
+	db.documents[MigrationsCollection+"."+strconv.Itoa(record.Version)] = Document{
+		"version":    record.Version,
+		"name":       record.Name,
+		"checksum":   record.Checksum,
+		"applied_at": record.AppliedAt,
+		"documents":  record.Documents,
+	}
+}
+
+func copyDocument(doc Document) Document {
+	copied := make(Document, len(doc))
+	for k, v := range doc {
+		copied[k] = v
+	}
+	return copied
+}
+
+func documentMatches(doc Document, filter map[string]interface{}) bool {
+	for field, expected := range filter {
+		if actual, exists := doc[field]; !exists || compareValues(actual, expected) != 0 {
+			return false
+		}
+	}
+	return true
+}
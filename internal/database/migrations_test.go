@@ -0,0 +1,157 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMigrationsRunInVersionOrder(t *testing.T) {
+	db := newTestDatabase(t)
+	var ran []int
+	up := func(version int) func(*MultiModelDatabase) error {
+		return func(*MultiModelDatabase) error {
+			ran = append(ran, version)
+			return nil
+		}
+	}
+	for _, version := range []int{30, 10} {
+		if err := db.RegisterMigration(Migration{Version: version, Name: "registered", Up: up(version)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.RegisterMigration(Migration{Version: 10, Up: up(10)}); err == nil {
+		t.Fatal("version registered twice")
+	}
+	supplied := []Migration{{Version: 20, Name: "supplied", Up: up(20)}, {Version: 40, Name: "supplied", Up: up(40)}}
+
+	// A dry run lists pending versions up to the target without running them
+	result, err := db.Migrate(supplied, 30, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Pending, []int{10, 20, 30}) || len(ran) != 0 || result.Current != 0 {
+		t.Fatalf("dry run = %+v, ran %v", result, ran)
+	}
+
+	result, err = db.Migrate(supplied, 30, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ran, []int{10, 20, 30}) || result.Current != 30 || len(result.Applied) != 3 {
+		t.Fatalf("ran %v, result %+v", ran, result)
+	}
+
+	// Applied versions are skipped; the rest continue in order
+	result, err = db.Migrate(supplied, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ran, []int{10, 20, 30, 40}) || result.Current != 40 {
+		t.Fatalf("ran %v, result %+v", ran, result)
+	}
+	if _, err := db.Migrate([]Migration{{Version: 10, Up: up(10)}}, 0, false); err == nil {
+		t.Fatal("migration defined more than once")
+	}
+
+	var versions []int
+	for _, record := range db.AppliedMigrations() {
+		versions = append(versions, record.Version)
+	}
+	if !reflect.DeepEqual(versions, []int{10, 20, 30, 40}) {
+		t.Fatalf("applied versions = %v", versions)
+	}
+}
+
+func TestMigrationsAreIdempotent(t *testing.T) {
+	db := newTestDatabase(t)
+	for id, doc := range map[string]Document{
+		"1": {"name": "ann", "city": "oslo"},
+		"2": {"name": "bob", "plan": "pro"},
+		"3": {"name": "cid", "city": "rome"},
+	} {
+		if err := db.InsertDocument("users", id, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	migration := Migration{Version: 1, Name: "plans", Steps: []MigrationStep{
+		{Op: MigrationBackfill, Collection: "users", Field: "plan", Value: "free"},
+		{Op: MigrationRename, Collection: "users", Field: "city", To: "town"},
+		{Op: MigrationRemove, Collection: "users", Field: "name", Where: map[string]interface{}{"plan": "pro"}},
+	}}
+
+	result, err := db.Migrate([]Migration{migration}, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Applied) != 1 || result.Applied[0].Documents != 3 {
+		t.Fatalf("first run = %+v", result)
+	}
+	want := map[string]Document{
+		"1": {"name": "ann", "town": "oslo", "plan": "free"},
+		"2": {"plan": "pro"},
+		"3": {"name": "cid", "town": "rome", "plan": "free"},
+	}
+	for id, doc := range want {
+		if got := mustGet(t, db, "users", id); !reflect.DeepEqual(got, doc) {
+			t.Fatalf("users/%s = %v, want %v", id, got, doc)
+		}
+	}
+
+	// Running the same migration again changes nothing and records nothing new
+	if err := db.InsertDocument("users", "4", Document{"name": "dee"}); err != nil {
+		t.Fatal(err)
+	}
+	result, err = db.Migrate([]Migration{migration}, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Applied) != 0 || result.Current != 1 || len(db.AppliedMigrations()) != 1 {
+		t.Fatalf("second run = %+v", result)
+	}
+	if got := mustGet(t, db, "users", "4"); !reflect.DeepEqual(got, Document{"name": "dee"}) {
+		t.Fatalf("document written after the migration = %v", got)
+	}
+
+	// An applied version whose content changed is refused
+	migration.Steps = migration.Steps[:1]
+	if _, err := db.Migrate([]Migration{migration}, 0, false); err == nil {
+		t.Fatal("changed migration accepted")
+	}
+}
+
+func TestFailedMigrationLeavesDocumentsUntouched(t *testing.T) {
+	db := newTestDatabase(t)
+	for id, doc := range map[string]Document{
+		"1": {"city": "oslo"},
+		"2": {"city": "rome", "town": "rome"},
+	} {
+		if err := db.InsertDocument("users", id, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clash := Migration{Version: 1, Steps: []MigrationStep{
+		{Op: MigrationBackfill, Collection: "users", Field: "plan", Value: "free"},
+		{Op: MigrationRename, Collection: "users", Field: "city", To: "town"},
+	}}
+	if _, err := db.Migrate([]Migration{clash}, 0, false); err == nil {
+		t.Fatal("rename onto an existing field applied")
+	}
+	if got := mustGet(t, db, "users", "1"); !reflect.DeepEqual(got, Document{"city": "oslo"}) {
+		t.Fatalf("users/1 after a failed migration = %v", got)
+	}
+	if len(db.AppliedMigrations()) != 0 {
+		t.Fatal("failed migration recorded")
+	}
+
+	// A failing Up stops the run before later versions
+	failed := errors.New("boom")
+	later := false
+	result, err := db.Migrate([]Migration{
+		{Version: 2, Up: func(*MultiModelDatabase) error { return failed }},
+		{Version: 3, Up: func(*MultiModelDatabase) error { later = true; return nil }},
+	}, 0, false)
+	if !errors.Is(err, failed) || later || result.Current != 0 {
+		t.Fatalf("failing run = %+v, %v, later ran %v", result, err, later)
+	}
+}
@@ -0,0 +1,216 @@
+package database
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrObjectNotFound is returned by object stores for missing keys
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStore is the storage tiered data is moved to
+type ObjectStore interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+// S3Options locates an S3-compatible bucket (AWS S3, MinIO, Ceph, R2, ...)
+type S3Options struct {
+	Endpoint  string // e.g. https://s3.eu-west-1.amazonaws.com or http://minio:9000
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3Store is an ObjectStore backed by an S3-compatible bucket. Requests use
+// path-style addressing and are signed with AWS Signature Version 4.
+type S3Store struct {
+	options S3Options
+	client  *http.Client
+	now     func() time.Time
+}
+
+// NewS3Store creates a store for the bucket described by options
+func NewS3Store(options S3Options) (*S3Store, error) {
+	if options.Endpoint == "" || options.Bucket == "" {
+		return nil, fmt.Errorf("s3 store requires an endpoint and a bucket")
+	}
+	if options.Region == "" {
+		options.Region = "us-east-1"
+	}
+	options.Endpoint = strings.TrimRight(options.Endpoint, "/")
+	return &S3Store{options: options, client: &http.Client{Timeout: 30 * time.Second}, now: time.Now}, nil
+}
+
+// Put stores data under key
+func (s *S3Store) Put(key string, data []byte) error {
+	resp, err := s.do(http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get returns the data stored under key
+func (s *S3Store) Get(key string) ([]byte, error) {
+	resp, err := s.do(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Delete removes key; deleting a missing key succeeds
+func (s *S3Store) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil)
+	if err != nil && !errors.Is(err, ErrObjectNotFound) {
+		return err
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return nil
+}
+
+func (s *S3Store) do(method, key string, body []byte) (*http.Response, error) {
+	path := "/" + s3Escape(s.options.Bucket)
+	for _, segment := range strings.Split(key, "/") {
+		path += "/" + s3Escape(segment)
+	}
+	req, err := http.NewRequest(method, s.options.Endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	// The path is already escaped as signed; keep net/url from re-encoding it
+	req.URL.RawPath = path
+	s.sign(req, body)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	case resp.StatusCode >= 300:
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s failed with %d: %s", method, key, resp.StatusCode, message)
+	}
+	return resp, nil
+}
+
+// sign adds AWS Signature Version 4 headers to req
+func (s *S3Store) sign(req *http.Request, body []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.options.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.options.SecretKey), date)
+	key = hmacSHA256(key, s.options.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.options.AccessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape percent-encodes everything but unreserved characters, as SigV4 requires
+func s3Escape(segment string) string {
+	var escaped strings.Builder
+	for _, c := range []byte(segment) {
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			escaped.WriteByte(c)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+	return escaped.String()
+}
+
+// MemoryObjectStore is an in-process ObjectStore for tests and simulations
+type MemoryObjectStore struct {
+	objects map[string][]byte
+	mutex   sync.Mutex
+}
+
+// NewMemoryObjectStore creates an empty store
+func NewMemoryObjectStore() *MemoryObjectStore {
+	return &MemoryObjectStore{objects: make(map[string][]byte)}
+}
+
+func (m *MemoryObjectStore) Put(key string, data []byte) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.objects[key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *MemoryObjectStore) Get(key string) ([]byte, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	data, exists := m.objects[key]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	return data, nil
+}
+
+func (m *MemoryObjectStore) Delete(key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+// Len returns the number of stored objects
+func (m *MemoryObjectStore) Len() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.objects)
+}
@@ -0,0 +1,219 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidUpdate is returned for update operators that cannot be applied, such as
+// an increment of a string
+var ErrInvalidUpdate = errors.New("invalid update")
+
+// Update operators. Keys of an update starting with $ are operators taking an object
+// of field paths, so counters and arrays are changed in place of sending the whole
+// field: {"$inc": {"views": 1}, "$push": {"tags": "new"}}. Other keys set fields.
+const (
+	// UpdateInc adds a number to a field, a missing field counting as 0
+	UpdateInc = "$inc"
+	// UpdatePush appends a value to an array, a missing field becoming one;
+	// {"$each": [...]} appends several values
+	UpdatePush = "$push"
+	// UpdatePull removes the elements equal to a value from an array
+	UpdatePull = "$pull"
+	// UpdateUnset removes a field, whatever value it is given
+	UpdateUnset = "$unset"
+)
+
+// eachModifier appends every element of an array with UpdatePush
+const eachModifier = "$each"
+
+// hasUpdateOperators reports whether an update holds operators
+func hasUpdateOperators(updates Document) bool {
+	for key := range updates {
+		if strings.HasPrefix(key, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+// applyUpdate sets the fields of updates in doc, then applies its operators in a
+// fixed order: $unset, $inc, $push, $pull. doc is a copy the caller owns; values
+// nested in it are copied before they are changed.
+func applyUpdate(doc Document, updates Document) error {
+	var operators []string
+	for key, value := range updates {
+		if strings.HasPrefix(key, "$") {
+			operators = append(operators, key)
+			continue
+		}
+		if err := setPath(doc, key, value); err != nil {
+			return err
+		}
+	}
+	sort.Slice(operators, func(i, j int) bool { return operatorRank(operators[i]) < operatorRank(operators[j]) })
+
+	for _, operator := range operators {
+		if operatorRank(operator) < 0 {
+			return fmt.Errorf("%w: unknown operator %s", ErrInvalidUpdate, operator)
+		}
+		fields, ok := updates[operator].(map[string]interface{})
+		if document, isDocument := updates[operator].(Document); isDocument {
+			fields, ok = document, true
+		}
+		if !ok {
+			return fmt.Errorf("%w: %s takes an object of fields", ErrInvalidUpdate, operator)
+		}
+		for _, path := range sortedKeys(fields) {
+			if err := applyOperator(doc, operator, path, fields[path]); err != nil {
+				return fmt.Errorf("%w: %s of %s: %v", ErrInvalidUpdate, operator, path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// operatorRank orders operators as they are applied, -1 for unknown ones
+func operatorRank(operator string) int {
+	switch operator {
+	case UpdateUnset:
+		return 0
+	case UpdateInc:
+		return 1
+	case UpdatePush:
+		return 2
+	case UpdatePull:
+		return 3
+	}
+	return -1
+}
+
+func applyOperator(doc Document, operator, path string, argument interface{}) error {
+	current, exists := lookupPath(doc, path)
+	switch operator {
+	case UpdateUnset:
+		if exists {
+			unsetPath(doc, path)
+		}
+		return nil
+
+	case UpdateInc:
+		if !exists || current == nil {
+			current = json.Number("0")
+		}
+		sum, err := addNumbers(current, argument)
+		if err != nil {
+			return err
+		}
+		return setPath(doc, path, sum)
+
+	case UpdatePush:
+		var array []interface{}
+		if exists && current != nil {
+			var isArray bool
+			if array, isArray = current.([]interface{}); !isArray {
+				return fmt.Errorf("%s is a %s, not an array", path, schemaType(current))
+			}
+		}
+		values := []interface{}{argument}
+		if modifier, ok := argument.(map[string]interface{}); ok && len(modifier) == 1 && modifier[eachModifier] != nil {
+			if values, ok = modifier[eachModifier].([]interface{}); !ok {
+				return fmt.Errorf("%s takes an array", eachModifier)
+			}
+		}
+		pushed := append(make([]interface{}, 0, len(array)+len(values)), array...)
+		return setPath(doc, path, append(pushed, values...))
+
+	case UpdatePull:
+		if !exists || current == nil {
+			return nil
+		}
+		array, isArray := current.([]interface{})
+		if !isArray {
+			return fmt.Errorf("%s is a %s, not an array", path, schemaType(current))
+		}
+		pulled := make([]interface{}, 0, len(array))
+		for _, element := range array {
+			if !valuesEqual(element, argument) {
+				pulled = append(pulled, element)
+			}
+		}
+		return setPath(doc, path, pulled)
+	}
+	return nil
+}
+
+// addNumbers adds two numbers, exactly when both are integers
+func addNumbers(a, b interface{}) (json.Number, error) {
+	if _, ok := numberValue(b); !ok {
+		return "", fmt.Errorf("increment %v is not a number", b)
+	}
+	if _, ok := numberValue(a); !ok {
+		return "", fmt.Errorf("cannot increment a %s", schemaType(a))
+	}
+	if ai, ok := integerValue(a); ok {
+		if bi, ok := integerValue(b); ok {
+			if sum := ai + bi; (sum > ai) == (bi > 0) {
+				return json.Number(strconv.FormatInt(sum, 10)), nil
+			}
+			return "", fmt.Errorf("integer overflow")
+		}
+	}
+	af, _ := numberValue(a)
+	bf, _ := numberValue(b)
+	sum := af + bf
+	if math.IsInf(sum, 0) || math.IsNaN(sum) {
+		return "", fmt.Errorf("result out of range")
+	}
+	return json.Number(strconv.FormatFloat(sum, 'g', -1, 64)), nil
+}
+
+// unsetPath removes the field at a dot path, copying the objects along the path as
+// setPath does. Array elements are set to null rather than removed, so that the
+// indexes of the others stay the same.
+func unsetPath(doc Document, path string) {
+	if _, exists := doc[path]; exists || !strings.Contains(path, ".") {
+		delete(doc, path)
+		return
+	}
+	segments := strings.Split(path, ".")
+	doc[segments[0]] = withoutPath(doc[segments[0]], segments[1:])
+}
+
+// withoutPath returns a copy of container without the value at the path of segments
+func withoutPath(container interface{}, segments []string) interface{} {
+	segment := segments[0]
+	switch v := container.(type) {
+	case Document:
+		return withoutPath(map[string]interface{}(v), segments)
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for k, element := range v {
+			copied[k] = element
+		}
+		if len(segments) == 1 {
+			delete(copied, segment)
+		} else {
+			copied[segment] = withoutPath(v[segment], segments[1:])
+		}
+		return copied
+	case []interface{}:
+		i, err := strconv.Atoi(segment)
+		if err != nil || i < 0 || i >= len(v) {
+			return v
+		}
+		copied := append([]interface{}(nil), v...)
+		if len(segments) == 1 {
+			copied[i] = nil
+		} else {
+			copied[i] = withoutPath(v[i], segments[1:])
+		}
+		return copied
+	}
+	return container
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestUpdateOperators(t *testing.T) {
+	db := newTestDatabase(t)
+	var original Document
+	if err := DecodeJSON([]byte(`{"views": 9007199254740992, "score": 1.5, "tags": ["a", "b", "a"], "stats": {"clicks": 1, "tmp": true}, "old": 1}`), &original); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertDocument("posts", "p1", original); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := db.GetDocument("posts", "p1")
+
+	var updates Document
+	if err := DecodeJSON([]byte(`{
+		"title": "set alongside operators",
+		"$inc": {"views": 1, "score": 0.25, "stats.clicks": 2, "likes": 3},
+		"$push": {"tags": "c", "comments": {"$each": [1, 2]}},
+		"$pull": {"tags": "a"},
+		"$unset": {"old": "", "stats.tmp": ""}
+	}`), &updates); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateDocument("posts", "p1", updates); err != nil {
+		t.Fatal(err)
+	}
+
+	doc, _ := db.GetDocument("posts", "p1")
+	encoded, _ := json.Marshal(doc)
+	want := `{"comments":[1,2],"likes":3,"score":1.75,"stats":{"clicks":3},"tags":["b","c"],"title":"set alongside operators","views":9007199254740993}`
+	if string(encoded) != want {
+		t.Fatalf("updated to %s\nwant %s", encoded, want)
+	}
+	// Values read earlier are not changed
+	if encoded, _ := json.Marshal(before["stats"]); string(encoded) != `{"clicks":1,"tmp":true}` {
+		t.Fatalf("earlier read changed to %s", encoded)
+	}
+
+	for _, invalid := range []Document{
+		{"$inc": map[string]interface{}{"title": 1}},
+		{"$inc": map[string]interface{}{"views": "1"}},
+		{"$push": map[string]interface{}{"likes": 1}},
+		{"$rename": map[string]interface{}{"title": "name"}},
+		{"$unset": "title"},
+	} {
+		if err := db.UpdateDocument("posts", "p1", invalid); !errors.Is(err, ErrInvalidUpdate) {
+			t.Errorf("%v: %v", invalid, err)
+		}
+	}
+	if after, _ := db.GetDocument("posts", "p1"); after["title"] != "set alongside operators" {
+		t.Fatalf("failed update applied: %v", after)
+	}
+}
+
+func TestIncrementIsAtomic(t *testing.T) {
+	db := newTestDatabase(t)
+	if err := db.InsertDocument("counters", "c1", Document{"n": json.Number("0")}); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := db.UpdateDocument("counters", "c1", Document{UpdateInc: map[string]interface{}{"n": 1}}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if doc, _ := db.GetDocument("counters", "c1"); doc["n"] != json.Number("50") {
+		t.Fatalf("n = %v", doc["n"])
+	}
+}
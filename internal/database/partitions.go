@@ -0,0 +1,456 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultPartitionCount is the number of partitions the key space is divided into
+// when none is configured
+const defaultPartitionCount = 16
+
+// loadWindow is the period request rates are measured over
+const loadWindow = 10 * time.Second
+
+// loadImbalance is how far above the cluster mean a node's request rate may rise
+// before the rebalancer proposes moving a partition away from it
+const loadImbalance = 1.25
+
+// Partition is a contiguous range of the key hash space. Partitions are the unit
+// keys are owned, measured and rebalanced in.
+type Partition struct {
+	ID    string `json:"id"`
+	Start uint32 `json:"start"`          // first key hash in the partition
+	End   uint32 `json:"end"`            // last key hash in the partition, inclusive
+	Home  string `json:"home,omitempty"` // partition split from, whose placement this one keeps
+}
+
+// placement returns the id partition is placed by
+func (p Partition) placement() string {
+	if p.Home != "" {
+		return p.Home
+	}
+	return p.ID
+}
+
+// keyHash places key in the partition hash space
+func keyHash(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// newPartitions divides the hash space into count equal partitions
+func newPartitions(count int) []Partition {
+	if count <= 0 {
+		count = defaultPartitionCount
+	}
+	span := (uint64(math.MaxUint32) + 1) / uint64(count)
+	partitions := make([]Partition, count)
+	for i := range partitions {
+		end := uint64(i+1)*span - 1
+		if i == count-1 {
+			end = math.MaxUint32
+		}
+		partitions[i] = Partition{ID: fmt.Sprintf("p%d", i), Start: uint32(uint64(i) * span), End: uint32(end)}
+	}
+	return partitions
+}
+
+// partitionIndex returns the index of the partition holding hash in partitions,
+// which are sorted and cover the hash space
+func partitionIndex(partitions []Partition, hash uint32) int {
+	return sort.Search(len(partitions), func(i int) bool { return partitions[i].End >= hash })
+}
+
+// partitionOwner picks the owner of partition among nodes by rendezvous hashing,
+// so membership changes only move the partitions of nodes that joined or left
+func partitionOwner(partition Partition, nodes []*Node) *Node {
+	var owner *Node
+	var best uint64
+	for _, node := range nodes {
+		h := fnv.New64a()
+		h.Write([]byte(node.ID + "/" + partition.placement()))
+		score := mix64(h.Sum64())
+		if owner == nil || score > best || (score == best && node.ID < owner.ID) {
+			owner, best = node, score
+		}
+	}
+	return owner
+}
+
+// mix64 spreads the bits of an FNV hash, whose high bits barely change between
+// inputs differing in a single character such as node-1 and node-2
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// Partitions returns the partition map, sorted by hash range
+func (c *Cluster) Partitions() []Partition {
+	c.partitionMutex.RLock()
+	defer c.partitionMutex.RUnlock()
+	return append([]Partition(nil), c.partitions...)
+}
+
+// PartitionForKey returns the partition holding key
+func (c *Cluster) PartitionForKey(key string) Partition {
+	c.partitionMutex.RLock()
+	defer c.partitionMutex.RUnlock()
+	return c.partitions[partitionIndex(c.partitions, keyHash(key))]
+}
+
+// loadCounter counts the requests to one partition. Rates are estimated over a
+// sliding window from the counts of the current and the previous window.
+type loadCounter struct {
+	reads, writes uint64 // since startup
+	windowStart   time.Time
+	current       [2]uint64 // reads and writes in the current window
+	previous      [2]uint64 // reads and writes in the previous window
+}
+
+// roll starts a new window once the current one is over
+func (c *loadCounter) roll(now time.Time) {
+	elapsed := now.Sub(c.windowStart)
+	if elapsed < loadWindow {
+		return
+	}
+	c.previous = c.current
+	if elapsed >= 2*loadWindow {
+		c.previous = [2]uint64{}
+	}
+	c.current = [2]uint64{}
+	c.windowStart = c.windowStart.Add(elapsed.Truncate(loadWindow))
+}
+
+// rate returns the requests per second of kind 0 (reads) or 1 (writes)
+func (c *loadCounter) rate(kind int, now time.Time) float64 {
+	c.roll(now)
+	weight := 1 - float64(now.Sub(c.windowStart))/float64(loadWindow)
+	return (float64(c.previous[kind])*weight + float64(c.current[kind])) / loadWindow.Seconds()
+}
+
+// loadTracker counts the default bucket requests this node serves per partition
+type loadTracker struct {
+	counters map[string]*loadCounter
+	mutex    sync.Mutex
+}
+
+func newLoadTracker() *loadTracker {
+	return &loadTracker{counters: make(map[string]*loadCounter)}
+}
+
+func (t *loadTracker) record(partition string, write bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	counter, exists := t.counters[partition]
+	if !exists {
+		counter = &loadCounter{windowStart: now}
+		t.counters[partition] = counter
+	}
+	counter.roll(now)
+	kind := 0
+	if write {
+		kind = 1
+		counter.writes++
+	} else {
+		counter.reads++
+	}
+	counter.current[kind]++
+}
+
+// fill sets the request counts and rates of load
+func (t *loadTracker) fill(load *PartitionLoad) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	counter, exists := t.counters[load.ID]
+	if !exists {
+		return
+	}
+	now := time.Now()
+	load.Reads, load.Writes = counter.reads, counter.writes
+	load.ReadRate, load.WriteRate = counter.rate(0, now), counter.rate(1, now)
+}
+
+// forget drops the counts of a partition that was split
+func (t *loadTracker) forget(partition string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.counters, partition)
+}
+
+// recordLoad counts a read or write of a default bucket key against its partition
+func (db *MultiModelDatabase) recordLoad(bucket, key string, write bool) {
+	if db.Cluster == nil || bucket != DefaultBucket {
+		return
+	}
+	db.load.record(db.Cluster.PartitionForKey(key).ID, write)
+}
+
+// PartitionLoad reports the load of one partition
+type PartitionLoad struct {
+	Partition
+	Owner     string  `json:"owner"`
+	ReadRate  float64 `json:"read_rate"`  // reads per second
+	WriteRate float64 `json:"write_rate"` // writes per second
+	Reads     uint64  `json:"reads"`      // since startup
+	Writes    uint64  `json:"writes"`
+	Items     int     `json:"items"`
+	Bytes     int64   `json:"bytes"` // keys and JSON-encoded values
+}
+
+// requestRate returns the reads and writes per second of the partition
+func (l PartitionLoad) requestRate() float64 {
+	return l.ReadRate + l.WriteRate
+}
+
+// NodeLoad reports the load of one node: the partitions it owns and the requests
+// and data of all partitions it holds
+type NodeLoad struct {
+	NodeID     string  `json:"node_id"`
+	Partitions int     `json:"partitions"` // partitions owned
+	ReadRate   float64 `json:"read_rate"`
+	WriteRate  float64 `json:"write_rate"`
+	Items      int     `json:"items"`
+	Bytes      int64   `json:"bytes"`
+	Error      string  `json:"error,omitempty"` // the node's load could not be collected
+}
+
+// RebalanceAction is a change the rebalancer proposes for a partition
+type RebalanceAction struct {
+	Action    string `json:"action"` // split or move
+	Partition string `json:"partition"`
+	From      string `json:"from,omitempty"` // the current owner of a moved partition
+	To        string `json:"to,omitempty"`   // the proposed owner of a moved partition
+	Reason    string `json:"reason"`
+}
+
+// LoadReport is the load of the cluster per node and per partition, and the
+// rebalancing it calls for
+type LoadReport struct {
+	Version    uint64            `json:"version"` // of the partition map
+	Nodes      []NodeLoad        `json:"nodes"`
+	Partitions []PartitionLoad   `json:"partitions"`
+	Actions    []RebalanceAction `json:"actions"`
+}
+
+// LocalLoad returns the load of every partition as measured on this node: the
+// requests it served and the default bucket keys it holds
+func (db *MultiModelDatabase) LocalLoad() ([]PartitionLoad, error) {
+	if db.Cluster == nil {
+		return nil, fmt.Errorf("clustering is not enabled")
+	}
+
+	partitions := db.Cluster.Partitions()
+	nodes := db.Cluster.GetActiveNodes()
+	loads := make([]PartitionLoad, len(partitions))
+	for i, partition := range partitions {
+		loads[i].Partition = partition
+		if owner := partitionOwner(partition, nodes); owner != nil {
+			loads[i].Owner = owner.ID
+		}
+		db.load.fill(&loads[i])
+	}
+
+	db.kvMutex.RLock()
+	defer db.kvMutex.RUnlock()
+
+	b, exists := db.kvBuckets[DefaultBucket]
+	if !exists {
+		return loads, nil
+	}
+	now := time.Now()
+	for key, entry := range b.entries {
+		if entry.expired(now) {
+			continue
+		}
+		load := &loads[partitionIndex(partitions, keyHash(key))]
+		load.Items++
+		load.Bytes += int64(len(key)) + entrySize(entry)
+	}
+	return loads, nil
+}
+
+// entrySize returns the size of an entry's value as stored or replicated
+func entrySize(entry *kvEntry) int64 {
+	if raw, ok := entry.value.([]byte); ok {
+		return int64(len(raw))
+	}
+	data, err := json.Marshal(entry.value)
+	if err != nil {
+		return 0
+	}
+	return int64(len(data))
+}
+
+// ClusterLoad collects the partition load of every active node and plans the
+// rebalancing it calls for. Reads are summed over the nodes serving them; writes,
+// items and bytes are those of the fullest copy, since every replica of a
+// partition applies its writes.
+func (db *MultiModelDatabase) ClusterLoad() (*LoadReport, error) {
+	local, err := db.LocalLoad()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := db.Cluster.GetActiveNodes()
+	reports := make([][]PartitionLoad, len(nodes))
+	report := &LoadReport{Version: db.Cluster.PartitionMap().Version, Nodes: make([]NodeLoad, len(nodes))}
+	db.eachNode(nodes, func(i int, node *Node, isLocal bool) {
+		report.Nodes[i].NodeID = node.ID
+		if isLocal {
+			reports[i] = local
+			return
+		}
+		if err := db.Cluster.call(node, "/data/load", nil, &reports[i]); err != nil {
+			report.Nodes[i].Error = err.Error()
+		}
+	})
+
+	aggregated := make([]PartitionLoad, len(local))
+	for i, partition := range local {
+		aggregated[i] = PartitionLoad{Partition: partition.Partition, Owner: partition.Owner}
+	}
+	for i, loads := range reports {
+		node := &report.Nodes[i]
+		if node.Error == "" && !samePartitions(loads, aggregated) {
+			node.Error = "node reported a different partition map"
+		}
+		if node.Error != "" {
+			continue
+		}
+		for j, load := range loads {
+			node.ReadRate += load.ReadRate
+			node.WriteRate += load.WriteRate
+			node.Items += load.Items
+			node.Bytes += load.Bytes
+
+			total := &aggregated[j]
+			total.ReadRate += load.ReadRate
+			total.Reads += load.Reads
+			total.WriteRate = math.Max(total.WriteRate, load.WriteRate)
+			if load.Writes > total.Writes {
+				total.Writes = load.Writes
+			}
+			if load.Items > total.Items {
+				total.Items, total.Bytes = load.Items, load.Bytes
+			}
+		}
+	}
+	for _, partition := range aggregated {
+		for i := range report.Nodes {
+			if report.Nodes[i].NodeID == partition.Owner {
+				report.Nodes[i].Partitions++
+			}
+		}
+	}
+	report.Partitions = aggregated
+
+	maxBytes := int64(db.config.PartitionMaxMB) << 20
+	report.Actions = planRebalance(report, maxBytes, float64(db.config.PartitionMaxQPS))
+	return report, nil
+}
+
+// samePartitions reports whether two load reports cover the same partitions
+func samePartitions(a, b []PartitionLoad) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Partition != b[i].Partition {
+			return false
+		}
+	}
+	return true
+}
+
+// planRebalance proposes splitting partitions above maxBytes or maxQPS (zero
+// disabling either limit) and moving one partition from the busiest owner to the
+// idlest node when the busiest owner serves well above the cluster mean
+func planRebalance(report *LoadReport, maxBytes int64, maxQPS float64) []RebalanceAction {
+	actions := make([]RebalanceAction, 0)
+	splitting := make(map[string]bool)
+	for _, partition := range report.Partitions {
+		var reason string
+		switch {
+		case maxBytes > 0 && partition.Bytes > maxBytes:
+			reason = fmt.Sprintf("holds %d bytes, over the limit of %d", partition.Bytes, maxBytes)
+		case maxQPS > 0 && partition.requestRate() > maxQPS:
+			reason = fmt.Sprintf("serves %.1f requests/s, over the limit of %.0f", partition.requestRate(), maxQPS)
+		default:
+			continue
+		}
+		splitting[partition.ID] = true
+		actions = append(actions, RebalanceAction{Action: "split", Partition: partition.ID, Reason: reason})
+	}
+
+	// Request rate of the partitions each reachable node owns
+	owned := make(map[string]float64)
+	for _, node := range report.Nodes {
+		if node.Error == "" {
+			owned[node.NodeID] = 0
+		}
+	}
+	if len(owned) < 2 {
+		return actions
+	}
+	var total float64
+	for _, partition := range report.Partitions {
+		if _, exists := owned[partition.Owner]; exists {
+			owned[partition.Owner] += partition.requestRate()
+			total += partition.requestRate()
+		}
+	}
+	busiest, idlest := "", ""
+	for _, node := range report.Nodes {
+		if _, exists := owned[node.NodeID]; !exists {
+			continue
+		}
+		if busiest == "" || owned[node.NodeID] > owned[busiest] {
+			busiest = node.NodeID
+		}
+		if idlest == "" || owned[node.NodeID] < owned[idlest] {
+			idlest = node.NodeID
+		}
+	}
+	mean := total / float64(len(owned))
+	if mean == 0 || owned[busiest] <= mean*loadImbalance {
+		return actions
+	}
+
+	// The hottest partition whose move lowers the busiest node's rate without
+	// making the idlest node busier than it was
+	gap := owned[busiest] - owned[idlest]
+	var candidate *PartitionLoad
+	for i, partition := range report.Partitions {
+		rate := partition.requestRate()
+		if partition.Owner != busiest || splitting[partition.ID] || rate == 0 || rate >= gap {
+			continue
+		}
+		if candidate == nil || rate > candidate.requestRate() {
+			candidate = &report.Partitions[i]
+		}
+	}
+	if candidate != nil {
+		actions = append(actions, RebalanceAction{
+			Action:    "move",
+			Partition: candidate.ID,
+			From:      busiest,
+			To:        idlest,
+			Reason:    fmt.Sprintf("%s serves %.1f requests/s against a cluster mean of %.1f", busiest, owned[busiest], mean),
+		})
+	}
+	return actions
+}
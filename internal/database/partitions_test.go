@@ -0,0 +1,87 @@
+package database
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestPartitionsCoverHashSpace(t *testing.T) {
+	partitions := newPartitions(5)
+	if partitions[0].Start != 0 || partitions[4].End != math.MaxUint32 {
+		t.Fatalf("partitions do not cover the hash space: %+v", partitions)
+	}
+	for i := 1; i < len(partitions); i++ {
+		if partitions[i].Start != partitions[i-1].End+1 {
+			t.Fatalf("partitions %d and %d are not adjacent: %+v", i-1, i, partitions)
+		}
+	}
+	for _, hash := range []uint32{0, partitions[2].Start, partitions[2].End, math.MaxUint32} {
+		if p := partitions[partitionIndex(partitions, hash)]; hash < p.Start || hash > p.End {
+			t.Fatalf("hash %d placed in %+v", hash, p)
+		}
+	}
+}
+
+func TestSplitHalvesKeepPlacement(t *testing.T) {
+	nodes := []*Node{{ID: "node-0"}, {ID: "node-1"}, {ID: "node-2"}}
+	partitions := newPartitions(4)
+	owner := partitionOwner(partitions[1], nodes)
+
+	split, err := splitPartition(partitions, "p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(split) != 5 || !validPartitions(split) {
+		t.Fatalf("split does not cover the hash space: %+v", split)
+	}
+	for _, half := range split[1:3] {
+		if half.Home != "p1" || partitionOwner(half, nodes).ID != owner.ID {
+			t.Fatalf("half %+v moved away from %s", half, owner.ID)
+		}
+	}
+	if again, err := splitPartition(split, "p1.1"); err != nil || again[3].Home != "p1" {
+		t.Fatalf("second split: %+v %v", again, err)
+	}
+	if _, err := splitPartition(split, "p1"); !errors.Is(err, ErrUnknownPartition) {
+		t.Fatalf("expected the split partition to be gone, got %v", err)
+	}
+	single := []Partition{{ID: "p0", Start: 7, End: 7}}
+	if _, err := splitPartition(single, "p0"); !errors.Is(err, ErrPartitionTooSmall) {
+		t.Fatalf("expected a single hash to be unsplittable, got %v", err)
+	}
+}
+
+func TestRebalancerSplitsAndMovesHotPartitions(t *testing.T) {
+	partition := func(id, owner string, rate float64, bytes int64) PartitionLoad {
+		return PartitionLoad{Partition: Partition{ID: id}, Owner: owner, ReadRate: rate, Bytes: bytes}
+	}
+	report := &LoadReport{
+		Nodes: []NodeLoad{{NodeID: "node-0"}, {NodeID: "node-1"}, {NodeID: "node-2", Error: "unreachable"}},
+		Partitions: []PartitionLoad{
+			partition("p0", "node-0", 50, 2048), // too large
+			partition("p1", "node-0", 30, 0),
+			partition("p2", "node-0", 500, 0), // too busy
+			partition("p3", "node-1", 10, 0),
+		},
+	}
+
+	actions := planRebalance(report, 1024, 200)
+	if len(actions) != 3 {
+		t.Fatalf("expected two splits and a move, got %+v", actions)
+	}
+	if actions[0].Action != "split" || actions[0].Partition != "p0" || actions[1].Action != "split" || actions[1].Partition != "p2" {
+		t.Fatalf("unexpected splits %+v", actions[:2])
+	}
+	// p0 and p2 are split, leaving p1 to move off the busier node; the
+	// unreachable node is not a target
+	if move := actions[2]; move.Action != "move" || move.Partition != "p1" || move.From != "node-0" || move.To != "node-1" {
+		t.Fatalf("unexpected move %+v", move)
+	}
+
+	// A balanced cluster needs no moves
+	report.Partitions[3].ReadRate = 580
+	if actions := planRebalance(report, 0, 0); len(actions) != 0 {
+		t.Fatalf("balanced cluster got %+v", actions)
+	}
+}
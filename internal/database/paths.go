@@ -0,0 +1,211 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidPath is returned for updates whose dot path cannot be set, such as a
+// path through a string or past the end of an array
+var ErrInvalidPath = errors.New("invalid field path")
+
+// lookupPath returns the value at a dot path such as address.city or items.0.sku,
+// where numeric segments index arrays. A key holding the whole path, dots included,
+// takes precedence.
+func lookupPath(object map[string]interface{}, path string) (interface{}, bool) {
+	if value, exists := object[path]; exists || !strings.Contains(path, ".") {
+		return value, exists
+	}
+
+	// Segments are sliced out of path rather than split, as filters look paths up
+	// in every document they examine
+	var current interface{} = object
+	for rest, last := path, false; !last; {
+		segment := rest
+		if dot := strings.IndexByte(rest, '.'); dot >= 0 {
+			segment, rest = rest[:dot], rest[dot+1:]
+		} else {
+			last = true
+		}
+		switch v := current.(type) {
+		case map[string]interface{}:
+			value, exists := v[segment]
+			if !exists {
+				return nil, false
+			}
+			current = value
+		case Document:
+			value, exists := v[segment]
+			if !exists {
+				return nil, false
+			}
+			current = value
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			current = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// setPath sets the value at a dot path, creating missing objects on the way; an
+// index one past the end of an array appends to it. Objects and arrays along the
+// path are copied rather than modified, as earlier readers may still hold them.
+func setPath(object map[string]interface{}, path string, value interface{}) error {
+	if _, exists := object[path]; exists || !strings.Contains(path, ".") {
+		object[path] = value
+		return nil
+	}
+
+	segments := strings.Split(path, ".")
+	child, err := withPath(object[segments[0]], segments[1:], value)
+	if err != nil {
+		return fmt.Errorf("%w %s: %v", ErrInvalidPath, path, err)
+	}
+	object[segments[0]] = child
+	return nil
+}
+
+// withPath returns a copy of container with value set at the path of segments
+func withPath(container interface{}, segments []string, value interface{}) (interface{}, error) {
+	if len(segments) == 0 {
+		return value, nil
+	}
+	segment := segments[0]
+
+	switch v := container.(type) {
+	case nil:
+		child, err := withPath(nil, segments[1:], value)
+		return map[string]interface{}{segment: child}, err
+	case Document:
+		return withPath(map[string]interface{}(v), segments, value)
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v)+1)
+		for k, element := range v {
+			copied[k] = element
+		}
+		child, err := withPath(v[segment], segments[1:], value)
+		copied[segment] = child
+		return copied, err
+	case []interface{}:
+		i, err := strconv.Atoi(segment)
+		if err != nil || i < 0 || i > len(v) {
+			return nil, fmt.Errorf("index %s out of range for an array of %d", segment, len(v))
+		}
+		copied := append(make([]interface{}, 0, len(v)+1), v...)
+		if i == len(v) {
+			copied = append(copied, nil)
+		}
+		child, err := withPath(copied[i], segments[1:], value)
+		copied[i] = child
+		return copied, err
+	default:
+		return nil, fmt.Errorf("cannot set %s inside a value of type %s", segment, schemaType(v))
+	}
+}
+
+// ProjectDocument returns a document holding only the given fields of doc, nested
+// as in doc for dot paths; all of doc when no fields are given. Missing fields are
+// left out, and a field also given through its parent comes with the whole parent.
+// Arrays along a path stay arrays, holding the projected elements in order. The
+// projection is built from fresh objects, so doc is never modified.
+func ProjectDocument(doc Document, fields []string) Document {
+	if len(fields) == 0 {
+		return doc
+	}
+	projected := make(map[string]interface{})
+	for _, field := range fields {
+		value, exists := lookupPath(doc, field)
+		if !exists || projectedParent(doc, fields, field) {
+			continue
+		}
+		if _, literal := doc[field]; literal {
+			projected[field] = value
+			continue
+		}
+		projectPath(projected, doc, strings.Split(field, "."))
+	}
+	return finishProjection(projected).(map[string]interface{})
+}
+
+// projectedParent reports whether another of fields is a parent of field present in
+// doc, which projects field along with it
+func projectedParent(doc Document, fields []string, field string) bool {
+	for _, other := range fields {
+		if strings.HasPrefix(field, other+".") {
+			if _, exists := lookupPath(doc, other); exists {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// projectedArray collects the projected elements of an array by index until
+// finishProjection turns it into an array
+type projectedArray map[int]interface{}
+
+// projectPath copies the value at segments of src into dst, an object or array of
+// the projection, creating the containers on the way. src is only read.
+func projectPath(dst interface{}, src interface{}, segments []string) interface{} {
+	if len(segments) == 0 {
+		return src
+	}
+	segment, rest := segments[0], segments[1:]
+	switch source := src.(type) {
+	case Document:
+		return projectPath(dst, map[string]interface{}(source), segments)
+	case map[string]interface{}:
+		object, isObject := dst.(map[string]interface{})
+		if !isObject {
+			object = make(map[string]interface{})
+		}
+		object[segment] = projectPath(object[segment], source[segment], rest)
+		return object
+	case []interface{}:
+		array, isArray := dst.(projectedArray)
+		if !isArray {
+			array = make(projectedArray)
+		}
+		i, _ := strconv.Atoi(segment)
+		array[i] = projectPath(array[i], source[i], rest)
+		return array
+	}
+	return dst
+}
+
+// finishProjection turns the projected arrays of a projection into arrays. Values
+// copied from the document hold no projected arrays, so they are left untouched.
+func finishProjection(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if array, isArray := child.(projectedArray); isArray {
+				v[key] = finishProjection(array)
+			} else {
+				finishProjection(child)
+			}
+		}
+		return v
+	case projectedArray:
+		indexes := make([]int, 0, len(v))
+		for i := range v {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+		array := make([]interface{}, len(indexes))
+		for j, i := range indexes {
+			array[j] = finishProjection(v[i])
+		}
+		return array
+	}
+	return value
+}
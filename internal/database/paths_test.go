@@ -0,0 +1,150 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestDotPathsInFiltersUpdatesAndProjections(t *testing.T) {
+	db := newTestDatabase(t)
+	doc := Document{
+		"name":    "ann",
+		"address": map[string]interface{}{"city": "Oslo", "zip": "0150"},
+		"items":   []interface{}{map[string]interface{}{"sku": "a1", "qty": float64(2)}},
+		"a.b":     "literal",
+	}
+	if err := db.InsertDocument("orders", "1", doc); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := db.GetDocument("orders", "1")
+
+	for _, tc := range []struct {
+		path  string
+		value interface{}
+		want  int
+	}{
+		{"address.city", "Oslo", 1},
+		{"items.0.sku", "a1", 1},
+		{"items.1.sku", "a1", 0},
+		{"a.b", "literal", 1},
+	} {
+		results, err := db.QueryDocuments("orders", map[string]interface{}{tc.path: tc.value})
+		if err != nil || len(results) != tc.want {
+			t.Errorf("filter %s matched %d documents (%v), want %d", tc.path, len(results), err, tc.want)
+		}
+	}
+
+	if err := db.UpdateDocument("orders", "1", Document{"address.city": "Bergen", "items.0.qty": float64(3), "items.1": "new", "meta.source": "web"}); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := db.GetDocument("orders", "1")
+	if city, _ := lookupPath(after, "address.city"); city != "Bergen" {
+		t.Fatalf("address = %v", after["address"])
+	}
+	if zip, _ := lookupPath(after, "address.zip"); zip != "0150" {
+		t.Fatalf("sibling field lost: %v", after["address"])
+	}
+	if qty, _ := lookupPath(after, "items.0.qty"); qty != float64(3) {
+		t.Fatalf("items = %v", after["items"])
+	}
+	if item, _ := lookupPath(after, "items.1"); item != "new" {
+		t.Fatalf("items = %v", after["items"])
+	}
+	if source, _ := lookupPath(after, "meta.source"); source != "web" {
+		t.Fatalf("meta = %v", after["meta"])
+	}
+	// Documents read before the update are not modified
+	if city, _ := lookupPath(before, "address.city"); city != "Oslo" {
+		t.Fatalf("earlier read changed to %v", city)
+	}
+
+	err := db.UpdateDocument("orders", "1", Document{"name.first": "x", "address.city": "Trondheim"})
+	if !errors.Is(err, ErrInvalidPath) {
+		t.Fatalf("setting a path through a string: %v", err)
+	}
+	if city, _ := lookupPath(mustGet(t, db, "orders", "1"), "address.city"); city != "Bergen" {
+		t.Fatalf("failed update was partly applied: %v", city)
+	}
+
+	projected := ProjectDocument(after, []string{"name", "address.city", "missing.field"})
+	want := Document{"name": "ann", "address": map[string]interface{}{"city": "Bergen"}}
+	if !reflect.DeepEqual(projected, want) {
+		t.Fatalf("projection = %v", projected)
+	}
+}
+
+func TestProjectionKeepsParentsWhole(t *testing.T) {
+	db := newTestDatabase(t)
+	doc := Document{
+		"address": map[string]interface{}{"city": "Oslo", "zip": "0150"},
+		"items": []interface{}{
+			map[string]interface{}{"sku": "a", "qty": float64(1)},
+			map[string]interface{}{"sku": "b", "qty": float64(2)},
+		},
+	}
+	if err := db.InsertDocument("orders", "1", doc); err != nil {
+		t.Fatal(err)
+	}
+	stored := mustGet(t, db, "orders", "1")
+
+	for _, tc := range []struct {
+		fields []string
+		want   Document
+	}{
+		{[]string{"address", "address.city"}, Document{"address": map[string]interface{}{"city": "Oslo", "zip": "0150"}}},
+		{[]string{"address.city", "address"}, Document{"address": map[string]interface{}{"city": "Oslo", "zip": "0150"}}},
+		{[]string{"items", "items.0.sku"}, Document{"items": doc["items"]}},
+		{[]string{"items.1.sku", "items.0.qty"}, Document{"items": []interface{}{
+			map[string]interface{}{"qty": float64(1)},
+			map[string]interface{}{"sku": "b"},
+		}}},
+	} {
+		projected := ProjectDocument(stored, tc.fields)
+		if !reflect.DeepEqual(projected, tc.want) {
+			t.Errorf("projection of %v = %v, want %v", tc.fields, projected, tc.want)
+		}
+	}
+	if got := mustGet(t, db, "orders", "1"); !reflect.DeepEqual(got, stored) || !reflect.DeepEqual(got["address"], doc["address"]) {
+		t.Fatalf("projections modified the stored document: %v", got)
+	}
+}
+
+func TestConcurrentProjections(t *testing.T) {
+	db := newTestDatabase(t)
+	doc := Document{"address": map[string]interface{}{"city": "Oslo", "zip": "0150"}}
+	if err := db.InsertDocument("orders", "1", doc); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				got, err := db.GetDocument("orders", "1")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				ProjectDocument(got, []string{"address", "address.city"})
+				ProjectDocument(got, []string{"address.zip"})
+			}
+		}()
+	}
+	wg.Wait()
+	if got := mustGet(t, db, "orders", "1"); !reflect.DeepEqual(got["address"], doc["address"]) {
+		t.Fatalf("projections modified the stored document: %v", got)
+	}
+}
+
+func mustGet(t *testing.T, db *MultiModelDatabase, collection, id string) Document {
+	t.Helper()
+	doc, err := db.GetDocument(collection, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
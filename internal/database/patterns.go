@@ -0,0 +1,339 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// String operators of document filters, written {"name": {"$regex": "^al"}} or in
+// query strings as name:regex=^al
+const (
+	OpRegex      = "$regex"      // the string matches a Go regular expression
+	OpStartsWith = "$startsWith" // the string starts with the value
+)
+
+// stringQueryOps maps the query string operators onto the string operators
+var stringQueryOps = map[string]string{
+	"regex":      OpRegex,
+	"startsWith": OpStartsWith,
+}
+
+// Index types, choosing the string filters an index serves besides equality
+const (
+	IndexHash    = "hash"    // equality, the default
+	IndexPrefix  = "prefix"  // also startsWith and regexes anchored by a literal prefix
+	IndexTrigram = "trigram" // also regexes holding a literal of three characters or more
+)
+
+// parseStringFilter parses the query string value of a string operator
+func parseStringFilter(op, raw string) (map[string]interface{}, error) {
+	if op == OpRegex {
+		if _, err := regexp.Compile(raw); err != nil {
+			return nil, err
+		}
+	}
+	return map[string]interface{}{op: raw}, nil
+}
+
+// stringOperators returns the operators of a filter value made only of string
+// operators
+func stringOperators(filter interface{}) (map[string]interface{}, bool) {
+	ops, isMap := filter.(map[string]interface{})
+	if !isMap || len(ops) == 0 {
+		return nil, false
+	}
+	for op := range ops {
+		if op != OpRegex && op != OpStartsWith {
+			return nil, false
+		}
+	}
+	return ops, true
+}
+
+// stringMatches reports whether actual is a string satisfying every operator.
+// Strings compare under the collation: case insensitive collations make regexes
+// case insensitive, and accent insensitive ones match them against the string
+// without accents.
+func (c Collation) stringMatches(actual interface{}, ops map[string]interface{}) bool {
+	s, isString := actual.(string)
+	if !isString {
+		return false
+	}
+	s = c.fold(s)
+	for op, value := range ops {
+		v, ok := operatorString(value)
+		if !ok {
+			return false
+		}
+		switch op {
+		case OpStartsWith:
+			if !strings.HasPrefix(s, c.fold(v)) {
+				return false
+			}
+		case OpRegex:
+			re, err := c.regex(v)
+			if err != nil || !re.MatchString(s) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func operatorString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case QueryParam:
+		return string(v), true
+	}
+	return "", false
+}
+
+// regexCache holds compiled filter regexes by collation flags and pattern
+var regexCache sync.Map
+
+// regex compiles pattern, case insensitive under case insensitive collations
+func (c Collation) regex(pattern string) (*regexp.Regexp, error) {
+	if c.CaseInsensitive {
+		pattern = "(?i)" + pattern
+	}
+	if re, cached := regexCache.Load(pattern); cached {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(pattern, re)
+	return re, nil
+}
+
+// findPattern returns the ids of the documents whose indexed strings may satisfy
+// the string operators, a superset the filter checks again, or why the index
+// cannot narrow them down
+func (index *documentIndex) findPattern(db *MultiModelDatabase, ops map[string]interface{}) ([]string, IndexStats, string) {
+	var prefixes, literals []string
+	for op, value := range ops {
+		v, ok := operatorString(value)
+		if !ok {
+			continue
+		}
+		switch op {
+		case OpStartsWith:
+			prefixes = append(prefixes, index.spec.Collation.fold(v))
+		case OpRegex:
+			prefix, required := index.regexLiterals(v)
+			if prefix != "" {
+				prefixes = append(prefixes, prefix)
+			}
+			literals = append(literals, required...)
+		}
+	}
+	literals = append(literals, prefixes...)
+
+	var ids []string
+	var stats IndexStats
+	reason := ""
+	index.fresh(db, func() {
+		stats = index.stats
+		switch index.spec.Type {
+		case IndexPrefix:
+			if len(prefixes) == 0 {
+				reason = "filter has no literal prefix"
+				return
+			}
+			// The longest prefix selects the fewest strings
+			sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+			ids = index.prefixIDs(prefixes[0])
+		case IndexTrigram:
+			grams := make(map[string]bool)
+			for _, literal := range literals {
+				for _, gram := range trigrams(literal) {
+					grams[gram] = true
+				}
+			}
+			if len(grams) == 0 {
+				reason = "filter has no literal of three characters"
+				return
+			}
+			ids = index.trigramIDs(sortedKeys(grams))
+		default:
+			reason = "hash index serves equality filters only"
+		}
+	})
+	return ids, stats, reason
+}
+
+// regexLiterals returns the folded literal prefix of a regex and the literals every
+// match contains. Literals of case insensitive parts only count under a case
+// insensitive index collation.
+func (index *documentIndex) regexLiterals(pattern string) (string, []string) {
+	collation := index.spec.Collation
+	if collation.CaseInsensitive {
+		pattern = "(?i)" + pattern
+	}
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", nil
+	}
+	re = re.Simplify()
+
+	literal := func(re *syntax.Regexp) (string, bool) {
+		if re.Op != syntax.OpLiteral || re.Flags&syntax.FoldCase != 0 && !collation.CaseInsensitive {
+			return "", false
+		}
+		return collation.fold(string(re.Rune)), true
+	}
+
+	prefix := ""
+	if re.Op == syntax.OpConcat && len(re.Sub) > 1 && re.Sub[0].Op == syntax.OpBeginText {
+		prefix, _ = literal(re.Sub[1])
+	}
+	return prefix, requiredLiterals(re, literal)
+}
+
+// requiredLiterals returns the literal strings every match of re contains
+func requiredLiterals(re *syntax.Regexp, literal func(*syntax.Regexp) (string, bool)) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if s, ok := literal(re); ok {
+			return []string{s}
+		}
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiterals(re.Sub[0], literal)
+	case syntax.OpRepeat:
+		if re.Min > 0 {
+			return requiredLiterals(re.Sub[0], literal)
+		}
+	case syntax.OpConcat:
+		var literals []string
+		for _, sub := range re.Sub {
+			literals = append(literals, requiredLiterals(sub, literal)...)
+		}
+		return literals
+	}
+	return nil
+}
+
+// trigrams returns the three character substrings of s
+func trigrams(s string) []string {
+	runes := []rune(s)
+	grams := make([]string, 0, len(runes))
+	for i := 0; i+3 <= len(runes); i++ {
+		grams = append(grams, string(runes[i:i+3]))
+	}
+	return grams
+}
+
+// indexedString is an entry of a prefix index
+type indexedString struct {
+	key string // folded by the index collation
+	id  string
+}
+
+// prefixIDs returns the ids of the documents holding a string starting with prefix.
+// Callers must run it through fresh.
+func (index *documentIndex) prefixIDs(prefix string) []string {
+	start := sort.Search(len(index.sorted), func(i int) bool { return index.sorted[i].key >= prefix })
+	var ids []string
+	seen := make(map[string]bool)
+	for _, entry := range index.sorted[start:] {
+		if !strings.HasPrefix(entry.key, prefix) {
+			break
+		}
+		if !seen[entry.id] {
+			seen[entry.id] = true
+			ids = append(ids, entry.id)
+		}
+	}
+	return ids
+}
+
+// trigramIDs returns the ids of the documents holding a string containing every
+// trigram. Callers must run it through fresh.
+func (index *documentIndex) trigramIDs(grams []string) []string {
+	// Intersect starting from the rarest trigram
+	sort.Slice(grams, func(i, j int) bool { return len(index.trigrams[grams[i]]) < len(index.trigrams[grams[j]]) })
+	ids := index.trigrams[grams[0]]
+	for _, gram := range grams[1:] {
+		if len(ids) == 0 {
+			break
+		}
+		holding := make(map[string]bool, len(index.trigrams[gram]))
+		for _, id := range index.trigrams[gram] {
+			holding[id] = true
+		}
+		var kept []string
+		for _, id := range ids {
+			if holding[id] {
+				kept = append(kept, id)
+			}
+		}
+		ids = kept
+	}
+	return ids
+}
+
+// indexString adds a folded string of document id to the prefix or trigram
+// entries of the index. Callers must hold the index mutex.
+func (index *documentIndex) indexString(id, key string) {
+	switch index.spec.Type {
+	case IndexPrefix:
+		index.sorted = append(index.sorted, indexedString{key: key, id: id})
+	case IndexTrigram:
+		for _, gram := range trigrams(key) {
+			if ids := index.trigrams[gram]; len(ids) == 0 || ids[len(ids)-1] != id {
+				index.trigrams[gram] = append(ids, id)
+			}
+		}
+	}
+}
+
+// unindexString removes a folded string of document id from the prefix or trigram
+// entries of the index. Callers must hold the index mutex.
+func (index *documentIndex) unindexString(id, key string) {
+	switch index.spec.Type {
+	case IndexPrefix:
+		i := sort.Search(len(index.sorted), func(i int) bool { return index.sorted[i].key >= key })
+		for ; i < len(index.sorted) && index.sorted[i].key == key; i++ {
+			if index.sorted[i].id == id {
+				index.sorted = append(index.sorted[:i], index.sorted[i+1:]...)
+				return
+			}
+		}
+	case IndexTrigram:
+		for _, gram := range trigrams(key) {
+			if ids := withoutID(index.trigrams[gram], id); len(ids) > 0 {
+				index.trigrams[gram] = ids
+			} else {
+				delete(index.trigrams, gram)
+			}
+		}
+	}
+}
+
+// mergeStrings moves the strings added to the prefix entries since they held n
+// strings into key order
+func (index *documentIndex) mergeStrings(n int) {
+	added := append([]indexedString(nil), index.sorted[n:]...)
+	index.sorted = index.sorted[:n]
+	for _, entry := range added {
+		i := sort.Search(len(index.sorted), func(i int) bool { return index.sorted[i].key > entry.key })
+		index.sorted = append(index.sorted, indexedString{})
+		copy(index.sorted[i+1:], index.sorted[i:])
+		index.sorted[i] = entry
+	}
+}
+
+func validateIndexType(t string) error {
+	switch t {
+	case "", IndexHash, IndexPrefix, IndexTrigram:
+		return nil
+	}
+	return fmt.Errorf("unknown index type %q, expected %s, %s or %s", t, IndexHash, IndexPrefix, IndexTrigram)
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"testing"
+)
+
+func TestStringOperatorsMatch(t *testing.T) {
+	ci := Collation{CaseInsensitive: true, AccentInsensitive: true}
+	tests := []struct {
+		actual    interface{}
+		filter    map[string]interface{}
+		collation Collation
+		want      bool
+	}{
+		{"alice", map[string]interface{}{OpStartsWith: "al"}, Collation{}, true},
+		{"Alice", map[string]interface{}{OpStartsWith: "al"}, Collation{}, false},
+		{"Alice", map[string]interface{}{OpStartsWith: "al"}, ci, true},
+		{"Álvaro", map[string]interface{}{OpStartsWith: "alv"}, ci, true},
+		{"alice", map[string]interface{}{OpRegex: "^a.*e$"}, Collation{}, true},
+		{"ALICE", map[string]interface{}{OpRegex: "lic"}, ci, true},
+		{"alice", map[string]interface{}{OpRegex: "^b"}, Collation{}, false},
+		{"alice", map[string]interface{}{OpRegex: "^a", OpStartsWith: "ali"}, Collation{}, true},
+		{"alice", map[string]interface{}{OpRegex: "^a", OpStartsWith: "bo"}, Collation{}, false},
+		{float64(1), map[string]interface{}{OpRegex: "1"}, Collation{}, false},
+		{"alice", map[string]interface{}{OpRegex: "("}, Collation{}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.collation.filterMatches(tt.actual, tt.filter); got != tt.want {
+			t.Errorf("filterMatches(%v, %v) = %v, want %v", tt.actual, tt.filter, got, tt.want)
+		}
+	}
+
+	if _, _, err := ParseQueryFilter("name:regex", "("); err == nil {
+		t.Fatal("invalid regex parsed")
+	}
+	filters, err := ParseQueryFilters(url.Values{"name:regex": {"e$"}, "name:startsWith": {"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ops, _ := stringOperators(filters["name"]); len(ops) != 2 {
+		t.Fatalf("string operators did not combine: %v", filters)
+	}
+}
+
+func TestPatternIndexesServeStringFilters(t *testing.T) {
+	db := newTestDatabase(t)
+	names := []string{"alice", "alina", "bob", "carol", "caroline", "dave", "eve", "mallory", "oscar", "peggy", "trent", "victor"}
+	for i, name := range names {
+		if err := db.InsertDocument("people", fmt.Sprintf("p%02d", i), Document{"name": name, "aliases": []interface{}{name + "_x"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	find := func(raw string) ([]string, *QueryPlan) {
+		t.Helper()
+		query, err := url.ParseQuery(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := ParseDocumentQuery(query)
+		if err != nil {
+			t.Fatalf("%s: %v", raw, err)
+		}
+		plan, err := db.ExplainQuery("people", q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs, err := db.FindDocuments(context.Background(), "people", q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var found []string
+		for _, doc := range docs {
+			found = append(found, doc["name"].(string))
+		}
+		sort.Strings(found)
+		return found, plan
+	}
+
+	queries := []string{"name:startsWith=car", "name:regex=^ali", "name:regex=line", "name:regex=^.l", "name:regex=o(b|s)"}
+	scanned := make(map[string][]string)
+	for _, raw := range queries {
+		scanned[raw], _ = find(raw)
+	}
+
+	tests := []struct {
+		index string
+		query string
+		used  bool
+	}{
+		{IndexPrefix, "name:startsWith=car", true},
+		{IndexPrefix, "name:regex=^ali", true},
+		{IndexPrefix, "name:regex=line", false},
+		{IndexPrefix, "name:regex=^.l", false},
+		{IndexTrigram, "name:startsWith=car", true},
+		{IndexTrigram, "name:regex=^ali", true},
+		{IndexTrigram, "name:regex=line", true},
+		{IndexTrigram, "name:regex=o(b|s)", false},
+		{IndexHash, "name:startsWith=car", false},
+	}
+	for _, tt := range tests {
+		if err := db.CreateIndex(IndexSpec{Collection: "people", Field: "name", Type: tt.index}); err != nil {
+			t.Fatal(err)
+		}
+		found, plan := find(tt.query)
+		if used := plan.Strategy == PlanIndex; used != tt.used {
+			t.Errorf("%s index for %s: plan %+v", tt.index, tt.query, plan)
+		}
+		if fmt.Sprint(found) != fmt.Sprint(scanned[tt.query]) {
+			t.Errorf("%s index for %s found %v, a scan %v", tt.index, tt.query, found, scanned[tt.query])
+		}
+	}
+
+	// Array elements are indexed one by one
+	if err := db.CreateIndex(IndexSpec{Collection: "people", Field: "aliases", Type: IndexTrigram}); err != nil {
+		t.Fatal(err)
+	}
+	if found, plan := find("aliases:contains=bob_x"); len(found) != 1 || plan.Strategy != PlanIndex {
+		t.Fatalf("aliases found %v with plan %+v", found, plan)
+	}
+
+	if err := db.CreateIndex(IndexSpec{Collection: "people", Field: "name", Type: "btree"}); err == nil {
+		t.Fatal("unknown index type accepted")
+	}
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Replica spreading strategies
+const (
+	SpreadZone = "zone" // prefer replicas in distinct zones
+	SpreadRack = "rack" // prefer replicas in distinct racks, across zones
+	SpreadNone = "none" // next nodes in the ring
+)
+
+// PlacementRule decides how many copies of a collection's keys are kept and how they
+// are spread over the cluster
+type PlacementRule struct {
+	Spread   string `json:"spread"`
+	Replicas int    `json:"replicas"`
+}
+
+// defaultPlacementCollection names the rule used for collections without their own
+const defaultPlacementCollection = "*"
+
+// ParsePlacementRules parses a comma-separated list of collection=spread[:replicas]
+// rules, e.g. "orders=zone:3,logs=none:1,*=rack". Replicas default to the
+// replication factor.
+func ParsePlacementRules(spec string) (map[string]PlacementRule, error) {
+	rules := make(map[string]PlacementRule)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		collection, value, found := strings.Cut(entry, "=")
+		if !found || collection == "" {
+			return nil, fmt.Errorf("placement rule %q must look like collection=spread[:replicas]", entry)
+		}
+
+		var rule PlacementRule
+		spread, replicas, hasReplicas := strings.Cut(value, ":")
+		switch spread {
+		case SpreadZone, SpreadRack, SpreadNone:
+			rule.Spread = spread
+		default:
+			return nil, fmt.Errorf("placement rule for %s has unknown spread %q, expected zone, rack or none", collection, spread)
+		}
+		if hasReplicas {
+			n, err := strconv.Atoi(replicas)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("placement rule for %s needs a positive replica count", collection)
+			}
+			rule.Replicas = n
+		}
+		rules[collection] = rule
+	}
+	return rules, nil
+}
+
+// PlacementFor returns the rule applied to keys of collection
+func (c *Cluster) PlacementFor(collection string) PlacementRule {
+	rule, exists := c.placement[collection]
+	if !exists {
+		rule, exists = c.placement[defaultPlacementCollection]
+	}
+	if !exists {
+		rule = PlacementRule{Spread: SpreadZone}
+	}
+	if rule.Replicas < 1 {
+		rule.Replicas = c.config.ReplicationFactor
+	}
+	if rule.Replicas < 1 {
+		rule.Replicas = 1
+	}
+	return rule
+}
+
+// PlacementRules returns the configured rules by collection
+func (c *Cluster) PlacementRules() map[string]PlacementRule {
+	rules := make(map[string]PlacementRule, len(c.placement))
+	for collection := range c.placement {
+		rules[collection] = c.PlacementFor(collection)
+	}
+	return rules
+}
+
+// keyCollection returns the collection a key belongs to: the part before the first
+// dot, as in the engine's collection.id document keys
+func keyCollection(key string) string {
+	collection, _, _ := strings.Cut(key, ".")
+	return collection
+}
+
+// placeReplicas picks count nodes starting at the primary, walking the ring. Nodes
+// whose failure domain is not yet used are taken first, so copies land in as many
+// zones (or racks) as possible; remaining slots are filled in ring order.
+func placeReplicas(ring []*Node, primaryIdx, count int, spread string) []*Node {
+	if count > len(ring) {
+		count = len(ring)
+	}
+	domain := func(node *Node) string {
+		switch spread {
+		case SpreadZone:
+			return node.Zone
+		case SpreadRack:
+			return node.Zone + "/" + node.Rack
+		}
+		return node.ID
+	}
+
+	nodes := make([]*Node, 0, count)
+	taken := make(map[string]bool)
+	used := make(map[string]bool)
+	for pass := 0; pass < 2 && len(nodes) < count; pass++ {
+		for i := 0; i < len(ring) && len(nodes) < count; i++ {
+			node := ring[(primaryIdx+i)%len(ring)]
+			if taken[node.ID] || (pass == 0 && used[domain(node)]) {
+				continue
+			}
+			nodes = append(nodes, node)
+			taken[node.ID] = true
+			used[domain(node)] = true
+		}
+	}
+	return nodes
+}
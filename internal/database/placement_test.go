@@ -0,0 +1,60 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePlacementRules(t *testing.T) {
+	rules, err := ParsePlacementRules("orders=zone:3, logs=none:1,*=rack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]PlacementRule{
+		"orders": {Spread: SpreadZone, Replicas: 3},
+		"logs":   {Spread: SpreadNone, Replicas: 1},
+		"*":      {Spread: SpreadRack},
+	}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Fatalf("got %+v", rules)
+	}
+
+	for _, spec := range []string{"orders", "orders=region", "orders=zone:0", "=zone"} {
+		if _, err := ParsePlacementRules(spec); err == nil {
+			t.Errorf("%q was accepted", spec)
+		}
+	}
+}
+
+func TestPlaceReplicasSpreadsDomains(t *testing.T) {
+	ring := []*Node{
+		{ID: "n0", Zone: "a", Rack: "r1"},
+		{ID: "n1", Zone: "a", Rack: "r2"},
+		{ID: "n2", Zone: "b", Rack: "r1"},
+		{ID: "n3", Zone: "b", Rack: "r1"},
+	}
+	ids := func(nodes []*Node) []string {
+		result := make([]string, len(nodes))
+		for i, node := range nodes {
+			result[i] = node.ID
+		}
+		return result
+	}
+
+	cases := []struct {
+		spread   string
+		count    int
+		expected []string
+	}{
+		{SpreadNone, 2, []string{"n0", "n1"}},
+		{SpreadZone, 2, []string{"n0", "n2"}},
+		{SpreadZone, 3, []string{"n0", "n2", "n1"}}, // more copies than zones
+		{SpreadRack, 3, []string{"n0", "n1", "n2"}},
+		{SpreadZone, 9, []string{"n0", "n2", "n1", "n3"}},
+	}
+	for _, c := range cases {
+		if got := ids(placeReplicas(ring, 0, c.count, c.spread)); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("%s x%d: got %v, expected %v", c.spread, c.count, got, c.expected)
+		}
+	}
+}
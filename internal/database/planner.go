@@ -0,0 +1,143 @@
+package database
+
+import (
+	"strconv"
+)
+
+// Strategies of query plans
+const (
+	PlanScan  = "scan"  // examine every document of the collection
+	PlanIndex = "index" // examine the documents an index gives for a filter
+)
+
+// indexScanRatio is the share of the collection above which scanning beats going
+// through an index, as fetching by id costs more per document than iterating
+const indexScanRatio = 0.5
+
+// QueryPlan describes how a document query finds its documents
+type QueryPlan struct {
+	Collection string           `json:"collection"`
+	Strategy   string           `json:"strategy"`
+	Index      string           `json:"index,omitempty"` // field of the index used
+	Documents  int              `json:"documents"`       // in the collection
+	Estimated  int              `json:"estimated"`       // documents the plan examines
+	Candidates []IndexCandidate `json:"candidates"`
+
+	ids []string // given by the chosen index
+}
+
+// IndexCandidate is an index on a filtered field considered by a query plan
+type IndexCandidate struct {
+	Field     string     `json:"field"`
+	Usable    bool       `json:"usable"`
+	Reason    string     `json:"reason,omitempty"` // why the index cannot serve the filter
+	Estimated int        `json:"estimated"`        // documents holding the filtered values
+	Stats     IndexStats `json:"stats"`
+
+	ids []string
+}
+
+// planQuery chooses between the indexes on the fields of filter and a scan of the
+// collection. Candidates are estimated from the index entries of the filtered
+// values, the cheapest wins unless it selects too much of the collection.
+func (db *MultiModelDatabase) planQuery(collection string, filter map[string]interface{}, collation Collation) *QueryPlan {
+	plan := &QueryPlan{Collection: collection, Strategy: PlanScan, Candidates: make([]IndexCandidate, 0)}
+	best := -1
+	for _, field := range sortedKeys(filter) {
+		index := db.indexes.get(collection, field)
+		if index == nil {
+			continue
+		}
+		candidate := IndexCandidate{Field: field}
+		if index.spec.Collation != collation {
+			// Still report the statistics of the index
+			_, candidate.Stats = index.ids(db, nil)
+			candidate.Reason = "index collation differs from the query collation"
+		} else {
+			candidate.ids, candidate.Stats, candidate.Reason = index.find(db, filter[field])
+			candidate.Usable = candidate.Reason == ""
+			candidate.Estimated = len(candidate.ids)
+		}
+		plan.Documents = candidate.Stats.Documents
+		plan.Candidates = append(plan.Candidates, candidate)
+		if candidate.Usable && (best < 0 || candidate.Estimated < plan.Candidates[best].Estimated) {
+			best = len(plan.Candidates) - 1
+		}
+	}
+
+	plan.Estimated = plan.Documents
+	if best >= 0 && float64(plan.Candidates[best].Estimated) <= float64(plan.Documents)*indexScanRatio {
+		plan.Strategy = PlanIndex
+		plan.Index = plan.Candidates[best].Field
+		plan.Estimated = plan.Candidates[best].Estimated
+		plan.ids = plan.Candidates[best].ids
+	}
+	return plan
+}
+
+// find returns the ids of the documents that may match a field filter, or why the
+// index cannot find them all
+func (index *documentIndex) find(db *MultiModelDatabase, expected interface{}) ([]string, IndexStats, string) {
+	if ops, isStringOp := stringOperators(expected); isStringOp {
+		return index.findPattern(db, ops)
+	}
+	keys, reason := indexFilterKeys(expected, index.spec.Collation)
+	ids, stats := index.ids(db, keys)
+	return ids, stats, reason
+}
+
+// indexFilterKeys returns the index keys of the values a field filter matches, or
+// why an index cannot find them all
+func indexFilterKeys(expected interface{}, collation Collation) ([]string, string) {
+	if ops, isArrayOp := arrayOperators(expected); isArrayOp {
+		// Elements are indexed one by one, so any value of $contains or $all will do
+		if value, exists := ops[OpContains]; exists {
+			return indexFilterKeys(value, collation)
+		}
+		if values, ok := ops[OpAll].([]interface{}); ok && len(values) > 0 {
+			return indexFilterKeys(values[0], collation)
+		}
+		return nil, "operator is not served by indexes"
+	}
+
+	switch e := expected.(type) {
+	case QueryParam:
+		return queryParamKeys(string(e), collation)
+	case string:
+		if collation.Numeric {
+			return nil, "numeric collation matches strings with differing keys"
+		}
+		return []string{"s" + collation.fold(e)}, ""
+	}
+	if key, ok := indexKey(expected, collation); ok {
+		return []string{key}, ""
+	}
+	return nil, "value is not indexed"
+}
+
+// queryParamKeys returns the index keys of the values an untyped query string value
+// matches: the string itself and the number or boolean it converts to
+func queryParamKeys(raw string, collation Collation) ([]string, string) {
+	if _, isTime := parseTime(raw); isTime {
+		return nil, "timestamps match in notations with differing keys"
+	}
+	var decoded interface{}
+	if DecodeJSON([]byte(raw), &decoded) == nil {
+		switch decoded.(type) {
+		case nil, map[string]interface{}, []interface{}:
+			return nil, "value is not indexed"
+		}
+	}
+	if collation.Numeric {
+		return nil, "numeric collation matches strings with differing keys"
+	}
+
+	keys := []string{"s" + collation.fold(raw)}
+	if b, err := strconv.ParseBool(raw); err == nil {
+		keys = append(keys, "b"+strconv.FormatBool(b))
+	}
+	if f, err := strconv.ParseFloat(raw, 64); err == nil {
+		keys = append(keys, "n"+strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	return keys, ""
+}
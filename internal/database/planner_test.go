@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+func TestQueryPlansUseSelectiveIndexes(t *testing.T) {
+	db := newTestDatabase(t)
+	for i := 0; i < 20; i++ {
+		doc := Document{"n": float64(i), "status": "closed", "tags": []interface{}{"a", "a"}}
+		if i < 2 {
+			doc["status"] = "Open"
+			doc["tags"] = []interface{}{"a", "urgent"}
+		}
+		if err := db.InsertDocument("tickets", fmt.Sprintf("t%02d", i), doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, field := range []string{"status", "n", "tags"} {
+		if err := db.CreateIndex(IndexSpec{Collection: "tickets", Field: field}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	parse := func(raw string) DocumentQuery {
+		t.Helper()
+		query, err := url.ParseQuery(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := ParseDocumentQuery(query)
+		if err != nil {
+			t.Fatalf("%s: %v", raw, err)
+		}
+		return q
+	}
+
+	tests := []struct {
+		query    string
+		strategy string
+		index    string
+		found    int
+	}{
+		{"status=Open", PlanIndex, "status", 2},
+		{"status=closed", PlanScan, "", 18},
+		{"status=open&_collation=ci", PlanScan, "", 2}, // the index is case sensitive
+		{"n=7", PlanIndex, "n", 1},
+		{"n=7&status=closed", PlanIndex, "n", 1},
+		{"tags:contains=urgent", PlanIndex, "tags", 2},
+		{"tags:size=2", PlanScan, "", 20},
+		{"missing=1", PlanScan, "", 0},
+	}
+	for _, tt := range tests {
+		q := parse(tt.query)
+		plan, err := db.ExplainQuery("tickets", q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plan.Strategy != tt.strategy || plan.Index != tt.index || plan.Documents != 20 {
+			t.Errorf("%s: plan %s on %q of %d documents, want %s on %q", tt.query, plan.Strategy, plan.Index, plan.Documents, tt.strategy, tt.index)
+		}
+		docs, err := db.FindDocuments(context.Background(), "tickets", q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(docs) != tt.found {
+			t.Errorf("%s: found %d documents, want %d", tt.query, len(docs), tt.found)
+		}
+	}
+
+	// Only the documents given by the index are examined
+	if _, err := db.FindDocuments(context.Background(), "tickets", parse("status=Open&_maxExamined=2")); err != nil {
+		t.Fatalf("indexed query examined more than its matches: %v", err)
+	}
+
+	plan, err := db.ExplainQuery("tickets", parse("status=Open"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := plan.Candidates[0].Stats
+	if stats.Cardinality != 2 || stats.Entries != 20 || stats.Min != "Open" || stats.Max != "closed" {
+		t.Fatalf("status statistics = %+v", stats)
+	}
+
+	plan, err = db.ExplainQuery("tickets", parse("n=0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats = plan.Candidates[0].Stats
+	if stats.Min != float64(0) || stats.Max != float64(19) || len(stats.Histogram) != 10 {
+		t.Fatalf("n statistics = %+v", stats)
+	}
+	total := 0
+	for i, bucket := range stats.Histogram {
+		total += bucket.Count
+		if bucket.Count != 2 || bucket.Distinct != 2 || bucket.Lower != float64(2*i) || bucket.Upper != float64(2*i+1) {
+			t.Errorf("bucket %d = %+v", i, bucket)
+		}
+	}
+	if total != 20 {
+		t.Fatalf("histogram counts %d values, want 20", total)
+	}
+
+	// Statistics follow writes
+	if err := db.DeleteDocument("tickets", "t00"); err != nil {
+		t.Fatal(err)
+	}
+	if plan, err = db.ExplainQuery("tickets", parse("status=Open")); err != nil {
+		t.Fatal(err)
+	}
+	if plan.Documents != 19 || plan.Estimated != 1 {
+		t.Fatalf("plan after delete = %+v", plan)
+	}
+}
+
+func TestIndexFilterKeys(t *testing.T) {
+	tests := []struct {
+		filter    interface{}
+		collation Collation
+		keys      int
+	}{
+		{QueryParam("30"), Collation{}, 2},   // "30" or 30
+		{QueryParam("true"), Collation{}, 2}, // "true" or true
+		{QueryParam("Oslo"), Collation{}, 1},
+		{QueryParam("2024-05-01"), Collation{}, 0},
+		{QueryParam("null"), Collation{}, 0},
+		{QueryParam(`{"a":1}`), Collation{}, 0},
+		{QueryParam("item2"), Collation{Numeric: true}, 0},
+		{float64(3), Collation{Numeric: true}, 1},
+		{nil, Collation{}, 0},
+		{map[string]interface{}{OpSize: 2}, Collation{}, 0},
+		{map[string]interface{}{OpAll: []interface{}{QueryParam("go")}}, Collation{}, 1},
+	}
+	for _, tt := range tests {
+		keys, reason := indexFilterKeys(tt.filter, tt.collation)
+		if len(keys) != tt.keys || (len(keys) == 0) != (reason != "") {
+			t.Errorf("indexFilterKeys(%v) = %v, %q", tt.filter, keys, reason)
+		}
+	}
+}
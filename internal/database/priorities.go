@@ -0,0 +1,94 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Priority classes of collections. The admission layer serves the requests of
+// interactive collections ahead of the others and throttles bulk collections, so
+// background loads cannot take the latency headroom of interactive traffic.
+const (
+	PriorityInteractive = "interactive"
+	PriorityNormal      = "normal" // collections without a class
+	PriorityBulk        = "bulk"
+)
+
+// priorityClasses holds the class of every collection that is not normal
+type priorityClasses struct {
+	classes map[string]string
+	mutex   sync.RWMutex
+}
+
+func validatePriority(class string) error {
+	switch class {
+	case PriorityInteractive, PriorityNormal, PriorityBulk:
+		return nil
+	}
+	return fmt.Errorf("unknown priority class %q, expected interactive, normal or bulk", class)
+}
+
+// ParsePriorityClasses parses a comma-separated list of collection=class entries,
+// e.g. "orders=interactive,imports=bulk"
+func ParsePriorityClasses(spec string) (map[string]string, error) {
+	classes := make(map[string]string)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		collection, class, found := strings.Cut(entry, "=")
+		if !found || collection == "" {
+			return nil, fmt.Errorf("priority class %q must look like collection=class", entry)
+		}
+		if err := validatePriority(class); err != nil {
+			return nil, fmt.Errorf("priority class of %s: %w", collection, err)
+		}
+		if class != PriorityNormal {
+			classes[collection] = class
+		}
+	}
+	return classes, nil
+}
+
+// CollectionPriority returns the priority class of collection
+func (db *MultiModelDatabase) CollectionPriority(collection string) string {
+	db.priorities.mutex.RLock()
+	defer db.priorities.mutex.RUnlock()
+	if class, exists := db.priorities.classes[collection]; exists {
+		return class
+	}
+	return PriorityNormal
+}
+
+// SetCollectionPriority assigns collection to a priority class, taking effect for
+// the requests admitted from then on
+func (db *MultiModelDatabase) SetCollectionPriority(collection, class string) error {
+	if err := ValidateCollectionName(collection); err != nil {
+		return err
+	}
+	if err := validatePriority(class); err != nil {
+		return err
+	}
+
+	db.priorities.mutex.Lock()
+	defer db.priorities.mutex.Unlock()
+	if class == PriorityNormal {
+		delete(db.priorities.classes, collection)
+	} else {
+		db.priorities.classes[collection] = class
+	}
+	return nil
+}
+
+// CollectionPriorities returns the collections assigned to a class other than normal
+func (db *MultiModelDatabase) CollectionPriorities() map[string]string {
+	db.priorities.mutex.RLock()
+	defer db.priorities.mutex.RUnlock()
+	classes := make(map[string]string, len(db.priorities.classes))
+	for collection, class := range db.priorities.classes {
+		classes[collection] = class
+	}
+	return classes
+}
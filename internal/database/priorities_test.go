@@ -0,0 +1,29 @@
+package database
+
+import "testing"
+
+func TestCollectionPriorities(t *testing.T) {
+	classes, err := ParsePriorityClasses("orders=interactive, imports=bulk,users=normal")
+	if err != nil || len(classes) != 2 || classes["orders"] != PriorityInteractive || classes["imports"] != PriorityBulk {
+		t.Fatalf("classes = %v, %v", classes, err)
+	}
+	for _, spec := range []string{"orders", "=bulk", "orders=urgent"} {
+		if _, err := ParsePriorityClasses(spec); err == nil {
+			t.Errorf("%q accepted", spec)
+		}
+	}
+
+	db := newTestDatabase(t)
+	if err := db.SetCollectionPriority("imports", PriorityBulk); err != nil {
+		t.Fatal(err)
+	}
+	if class := db.CollectionPriority("imports"); class != PriorityBulk {
+		t.Fatalf("class = %s", class)
+	}
+	if err := db.SetCollectionPriority("imports", PriorityNormal); err != nil || len(db.CollectionPriorities()) != 0 {
+		t.Fatalf("reset to normal: %v, %v", db.CollectionPriorities(), err)
+	}
+	if err := db.SetCollectionPriority("imports", "later"); err == nil {
+		t.Fatal("unknown class accepted")
+	}
+}
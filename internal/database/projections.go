@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrReadOnlyView is returned for writes through a projection view
+var ErrReadOnlyView = errors.New("projection views are read-only")
+
+// Projection views expose the data of one model through the API of another, so it
+// can be read the way the access pattern suits. They are built from the source on
+// every read and cannot be written:
+//
+//   - GET /docs/_columns.metrics queries the column family metrics as a collection,
+//     each row a document whose id is the row key and whose fields are the columns
+//   - GET /columns/_docs.orders scans the collection orders as a column family, each
+//     document a row whose key is the id and whose columns are the top-level fields
+const (
+	ColumnsViewPrefix   = "_columns."
+	DocumentsViewPrefix = "_docs."
+)
+
+// viewedFamily returns the column family a collection name views, if it is a view
+func viewedFamily(collection string) (string, bool) {
+	if !strings.HasPrefix(collection, ColumnsViewPrefix) || len(collection) == len(ColumnsViewPrefix) {
+		return "", false
+	}
+	return collection[len(ColumnsViewPrefix):], true
+}
+
+// viewedCollection returns the collection a column family name views, if it is a view
+func viewedCollection(family string) (string, bool) {
+	if !strings.HasPrefix(family, DocumentsViewPrefix) || len(family) == len(DocumentsViewPrefix) {
+		return "", false
+	}
+	return family[len(DocumentsViewPrefix):], true
+}
+
+// familyDocuments returns the rows of family matching scan as documents by row key,
+// none when the family does not exist, as for collections without documents
+func (db *MultiModelDatabase) familyDocuments(family string, scan ColumnScan) (map[string]interface{}, error) {
+	db.colMutex.RLock()
+	_, exists := db.columnFamilies[family]
+	db.colMutex.RUnlock()
+	docs := make(map[string]interface{})
+	if !exists {
+		return docs, nil
+	}
+
+	rows, err := db.ScanColumns(family, scan)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		docs[row.Key] = row.Columns
+	}
+	return docs, nil
+}
+
+// getFamilyDocument returns the row of family with key as a document
+func (db *MultiModelDatabase) getFamilyDocument(collection, family, key string) (Document, error) {
+	docs, err := db.familyDocuments(family, ColumnScan{StartRow: key, EndRow: key + "\x00"})
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("document with id %s not found in collection %s", key, collection)
+	}
+	decoded, err := asDocuments(docs)
+	if err != nil {
+		return nil, err
+	}
+	return decoded[key], nil
+}
+
+// collectionFamily returns the documents of collection as a column family, filtered
+// by the query hooks of the collection
+func (db *MultiModelDatabase) collectionFamily(ctx context.Context, collection string) (*ColumnFamily, error) {
+	event := &QueryEvent{Model: ModelDocument, Namespace: collection}
+	if err := db.beforeQuery(event); err != nil {
+		return nil, err
+	}
+	ids, docs, err := db.collectionDocuments(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	cf := newColumnFamily()
+	var collation Collation
+	for _, id := range ids {
+		if len(event.Filter) > 0 && !collation.objectMatches(docs[id], event.Filter) {
+			continue
+		}
+		row := cf.rows.GetOrCreate(id)
+		for field, value := range docs[id] {
+			row[field] = value
+		}
+	}
+	return cf, nil
+}
+
+// scanCollectionView runs a column scan over the documents of collection
+func (db *MultiModelDatabase) scanCollectionView(ctx context.Context, family, collection string, scan ColumnScan) ([]ColumnRow, error) {
+	cf, err := db.collectionFamily(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	if cf.rows.Len() == 0 {
+		return nil, fmt.Errorf("column family %s not found", family)
+	}
+	return cf.scan(ctx, scan)
+}
+
+// getCollectionViewColumn returns the field column of the document with id
+func (db *MultiModelDatabase) getCollectionViewColumn(family, collection, id, column string) (interface{}, error) {
+	doc, err := db.GetDocument(collection, id)
+	if err != nil {
+		return nil, fmt.Errorf("row %s not found in column family %s: %w", id, family, err)
+	}
+	value, exists := doc[column]
+	if !exists {
+		return nil, fmt.Errorf("column %s not found in row %s of column family %s", column, id, family)
+	}
+	return value, nil
+}
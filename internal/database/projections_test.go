@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestProjectionViews(t *testing.T) {
+	db := newTestDatabase(t)
+	for row, cpu := range map[string]float64{"host1": 0.5, "host2": 0.9} {
+		if err := db.InsertColumn("metrics", row, "cpu", cpu); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for id, status := range map[string]string{"o1": "open", "o2": "closed"} {
+		if err := db.InsertDocument("orders", id, Document{"status": status, "total": 10}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Column families are queried as collections, rows as documents
+	hosts, err := db.QueryDocuments("_columns.metrics", map[string]interface{}{"cpu": json.Number("0.9")})
+	if err != nil || len(hosts) != 1 {
+		t.Fatalf("hosts = %v, %v", hosts, err)
+	}
+	if doc, err := db.GetDocument("_columns.metrics", "host1"); err != nil || doc["cpu"] != json.Number("0.5") {
+		t.Fatalf("host1 = %v, %v", doc, err)
+	}
+	if _, err := db.GetDocument("_columns.metrics", "host3"); err == nil {
+		t.Fatal("missing row found")
+	}
+	if docs, err := db.QueryDocuments("_columns.missing", nil); err != nil || len(docs) != 0 {
+		t.Fatalf("missing family = %v, %v", docs, err)
+	}
+
+	// Collections are scanned as column families, documents as rows
+	rows, err := db.ScanColumnsContext(context.Background(), "_docs.orders", ColumnScan{Columns: []string{"status"}})
+	if err != nil || len(rows) != 2 || rows[0].Key != "o1" || rows[0].Columns["status"] != "open" || len(rows[0].Columns) != 1 {
+		t.Fatalf("rows = %v, %v", rows, err)
+	}
+	if value, err := db.GetColumn("_docs.orders", "o2", "status"); err != nil || value != "closed" {
+		t.Fatalf("o2 status = %v, %v", value, err)
+	}
+	if _, err := db.ScanColumns("_docs.missing", ColumnScan{}); err == nil {
+		t.Fatal("missing collection scanned")
+	}
+
+	// Views follow their source and cannot be written
+	if err := db.InsertColumn("metrics", "host3", "cpu", 0.1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetDocument("_columns.metrics", "host3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertDocument("_columns.metrics", "host4", Document{"cpu": 1}); !errors.Is(err, ErrReadOnlyView) {
+		t.Fatalf("document insert err = %v", err)
+	}
+	if err := db.InsertColumn("_docs.orders", "o3", "status", "open"); !errors.Is(err, ErrReadOnlyView) {
+		t.Fatalf("column insert err = %v", err)
+	}
+	if err := db.SetColumnFamilyOptions("_docs.orders", ColumnFamilyOptions{}); !errors.Is(err, ErrReadOnlyView) {
+		t.Fatalf("options err = %v", err)
+	}
+}
@@ -0,0 +1,263 @@
+package database
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"multimodel-db-engine/internal/config"
+)
+
+func newTestDatabase(tb testing.TB) *MultiModelDatabase {
+	tb.Helper()
+	db := NewMultiModelDatabase(&config.Config{DataDir: tb.TempDir(), ReplicationFactor: 1})
+	tb.Cleanup(db.Close)
+	return db
+}
+
+// normalizeJSON returns v as it would look after a JSON round trip
+func normalizeJSON(tb testing.TB, v interface{}) interface{} {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(encoded, &normalized); err != nil {
+		tb.Fatal(err)
+	}
+	return normalized
+}
+
+func TestDocumentInsertGetRoundTrip(t *testing.T) {
+	db := newTestDatabase(t)
+	n := 0
+	property := func(fields map[string]string, count int64) bool {
+		n++
+		id := strconv.Itoa(n)
+		doc := Document{"count": count}
+		for k, v := range fields {
+			doc[k] = v
+		}
+		if err := db.InsertDocument("props", id, doc); err != nil {
+			t.Log(err)
+			return false
+		}
+		got, err := db.GetDocument("props", id)
+		return err == nil && reflect.DeepEqual(got, doc)
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDocumentUpdateMergesFields(t *testing.T) {
+	db := newTestDatabase(t)
+	n := 0
+	property := func(original, updates map[string]string) bool {
+		n++
+		id := strconv.Itoa(n)
+		doc := Document{}
+		for k, v := range original {
+			doc[k] = v
+		}
+		if err := db.InsertDocument("props", id, doc); err != nil {
+			return false
+		}
+		// Dotted keys address nested fields and $ keys are operators, so the
+		// property covers plain field names only
+		patch := Document{}
+		for k, v := range updates {
+			if strings.Contains(k, ".") || strings.HasPrefix(k, "$") {
+				delete(updates, k)
+				continue
+			}
+			patch[k] = v
+		}
+		if err := db.UpdateDocument("props", id, patch); err != nil {
+			return false
+		}
+
+		got, err := db.GetDocument("props", id)
+		if err != nil {
+			return false
+		}
+		for k, v := range original {
+			if _, updated := updates[k]; !updated && got[k] != v {
+				return false
+			}
+		}
+		for k, v := range updates {
+			if got[k] != v {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKVPutGetRoundTrip(t *testing.T) {
+	db := newTestDatabase(t)
+	for _, dedup := range []bool{false, true} {
+		bucket := "props-" + strconv.FormatBool(dedup)
+		if err := db.SetBucketOptions(bucket, BucketOptions{Dedup: dedup}); err != nil {
+			t.Fatal(err)
+		}
+		property := func(key string, value map[string]int) bool {
+			if _, err := db.PutBucketValue(bucket, key, value, PutOptions{}); err != nil {
+				t.Log(err)
+				return false
+			}
+			got, err := db.GetBucketValue(bucket, key)
+			return err == nil && reflect.DeepEqual(got, value)
+		}
+		if err := quick.Check(property, nil); err != nil {
+			t.Fatalf("dedup=%v: %v", dedup, err)
+		}
+	}
+
+	if stats := db.KVDedupStats(); stats.SavedBytes < 0 || stats.StoredBytes > stats.LogicalBytes {
+		t.Fatalf("inconsistent dedup stats %+v", stats)
+	}
+}
+
+func TestColumnInsertGetRoundTrip(t *testing.T) {
+	db := newTestDatabase(t)
+	if err := db.SetColumnFamilyOptions("compressed", ColumnFamilyOptions{Compression: "gzip"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range []string{"plain", "compressed"} {
+		property := func(row, column string, value []string) bool {
+			if err := db.InsertColumn(family, row, column, value); err != nil {
+				t.Log(err)
+				return false
+			}
+			got, err := db.GetColumn(family, row, column)
+			if err != nil {
+				return false
+			}
+			// Compressed cells come back in their JSON form
+			return reflect.DeepEqual(normalizeJSON(t, got), normalizeJSON(t, value))
+		}
+		if err := quick.Check(property, nil); err != nil {
+			t.Fatalf("%s: %v", family, err)
+		}
+	}
+}
+
+func TestColumnScanPagesCoverScan(t *testing.T) {
+	db := newTestDatabase(t)
+	runs := 0
+	property := func(rows []string, limit uint8) bool {
+		runs++
+		family := "pages" + strconv.Itoa(runs)
+		for _, row := range rows {
+			if err := db.InsertColumn(family, "r"+row, "c", 1); err != nil {
+				t.Log(err)
+				return false
+			}
+		}
+		whole, err := db.ScanColumns(family, ColumnScan{})
+		if err != nil {
+			return len(rows) == 0
+		}
+
+		// Continuing after the last row of each page visits every row once
+		scan := ColumnScan{Limit: int(limit%5) + 1}
+		var paged []string
+		for {
+			page, err := db.ScanColumns(family, scan)
+			if err != nil || len(page) == 0 {
+				break
+			}
+			for _, row := range page {
+				paged = append(paged, row.Key)
+			}
+			scan.After = page[len(page)-1].Key
+		}
+		if len(paged) != len(whole) {
+			return false
+		}
+		for i, row := range whole {
+			if paged[i] != row.Key {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSkipListMatchesSortedMap(t *testing.T) {
+	property := func(inserts []string, deletes []uint8) bool {
+		list := newSkipList()
+		expected := make(map[string]struct{})
+		for _, key := range inserts {
+			list.GetOrCreate(key)
+			expected[key] = struct{}{}
+		}
+		for _, i := range deletes {
+			if len(inserts) == 0 {
+				break
+			}
+			key := inserts[int(i)%len(inserts)]
+			_, existed := expected[key]
+			if list.Delete(key) != existed {
+				return false
+			}
+			delete(expected, key)
+		}
+
+		keys := make([]string, 0, len(expected))
+		for key := range expected {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var visited []string
+		list.Ascend("", "", func(key string, row map[string]interface{}) bool {
+			visited = append(visited, key)
+			return true
+		})
+		return list.Len() == len(keys) && (len(keys) == 0 && len(visited) == 0 || reflect.DeepEqual(visited, keys))
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeepCopyIsIndependent(t *testing.T) {
+	property := func(values map[string][]string) bool {
+		original := Document{"nested": map[string]interface{}{}}
+		for k, list := range values {
+			items := make([]interface{}, len(list))
+			for i, v := range list {
+				items[i] = v
+			}
+			original["nested"].(map[string]interface{})[k] = items
+		}
+		snapshot := normalizeJSON(t, original)
+
+		copied := deepCopyValue(original).(Document)
+		nested := copied["nested"].(map[string]interface{})
+		for _, items := range nested {
+			list := items.([]interface{})
+			for i := range list {
+				list[i] = "changed"
+			}
+		}
+		nested["added"] = true
+		return reflect.DeepEqual(normalizeJSON(t, original), snapshot)
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Fatal(err)
+	}
+}
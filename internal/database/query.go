@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrQueryLimit is returned for document queries stopped by their limit on examined
+// documents or on time
+var ErrQueryLimit = errors.New("query limit exceeded")
+
+// Query string parameters setting the options of a document query rather than
+// filtering on a field
+const (
+	// SortParam orders the results: _sort=field ascending, _sort=-field descending
+	SortParam = "_sort"
+	// ProjectionParam selects the fields of returned documents: _fields=name,address.city
+	ProjectionParam = "_fields"
+	// MaxExaminedParam stops the query after examining this many documents
+	MaxExaminedParam = "_maxExamined"
+	// TimeoutParam stops the query after this long: _timeout=500ms
+	TimeoutParam = "_timeout"
+	// PartialParam returns the results found so far when a limit stops the query,
+	// rather than an error: _partial=true
+	PartialParam = "_partial"
+)
+
+// queryOptionParams are the query string parameters that are not filters
+var queryOptionParams = map[string]bool{
+	SortParam:        true,
+	ProjectionParam:  true,
+	CollationParam:   true,
+	LookupParam:      true,
+	MaxExaminedParam: true,
+	TimeoutParam:     true,
+	PartialParam:     true,
+}
+
+// DocumentQuery selects, orders and shapes the documents of a collection
+type DocumentQuery struct {
+	Filter    map[string]interface{} `json:"filter,omitempty"`
+	Sort      string                 `json:"sort,omitempty"`   // field, or -field for descending order
+	Fields    []string               `json:"fields,omitempty"` // projection, every field when empty
+	Collation Collation              `json:"collation"`
+	Lookups   []Lookup               `json:"lookups,omitempty"` // joins, applied after sorting
+
+	// Limits of the scan, lowering the configured ones; 0 keeps them
+	MaxExamined int           `json:"max_examined,omitempty"`
+	Timeout     time.Duration `json:"timeout,omitempty"`
+	Partial     bool          `json:"partial,omitempty"` // return the results so far when a limit is hit
+}
+
+// ParseDocumentQuery reads a document query from query string parameters: filters
+// as parsed by ParseQueryFilters and the options SortParam, ProjectionParam,
+// CollationParam, LookupParam, which may be repeated, and the limits
+// MaxExaminedParam, TimeoutParam and PartialParam
+func ParseDocumentQuery(query url.Values) (DocumentQuery, error) {
+	filter, err := ParseQueryFilters(query)
+	if err != nil {
+		return DocumentQuery{}, err
+	}
+	q := DocumentQuery{Filter: filter, Sort: query.Get(SortParam)}
+	if fields := query.Get(ProjectionParam); fields != "" {
+		q.Fields = strings.Split(fields, ",")
+	}
+	if q.Collation, err = ParseCollation(query.Get(CollationParam)); err != nil {
+		return DocumentQuery{}, err
+	}
+	for _, raw := range query[LookupParam] {
+		lookup, err := ParseLookup(raw)
+		if err != nil {
+			return DocumentQuery{}, err
+		}
+		q.Lookups = append(q.Lookups, lookup)
+	}
+
+	if value := query.Get(MaxExaminedParam); value != "" {
+		if q.MaxExamined, err = strconv.Atoi(value); err != nil || q.MaxExamined < 0 {
+			return DocumentQuery{}, fmt.Errorf("invalid %s %q", MaxExaminedParam, value)
+		}
+	}
+	if value := query.Get(TimeoutParam); value != "" {
+		if q.Timeout, err = time.ParseDuration(value); err != nil || q.Timeout < 0 {
+			return DocumentQuery{}, fmt.Errorf("invalid %s %q", TimeoutParam, value)
+		}
+	}
+	if value := query.Get(PartialParam); value != "" {
+		if q.Partial, err = strconv.ParseBool(value); err != nil {
+			return DocumentQuery{}, fmt.Errorf("invalid %s %q", PartialParam, value)
+		}
+	}
+	return q, nil
+}
+
+// queryGuard stops a scan that examined too many documents or ran too long
+type queryGuard struct {
+	ctx         context.Context // the caller's context
+	scan        cancelCheck     // the caller's context bounded by the query timeout
+	timeout     time.Duration
+	examined    int
+	maxExamined int
+}
+
+// newQueryGuard returns a guard applying the stricter of the query's and the
+// configured limits, and a function releasing it
+func (db *MultiModelDatabase) newQueryGuard(ctx context.Context, q DocumentQuery) (*queryGuard, context.CancelFunc) {
+	g := &queryGuard{ctx: ctx, maxExamined: stricterLimit(q.MaxExamined, db.config.QueryMaxExamined)}
+	g.timeout = time.Duration(stricterLimit(int(q.Timeout), int(time.Duration(db.config.QueryTimeout)*time.Millisecond)))
+	if g.timeout <= 0 {
+		g.scan = cancelCheck{ctx: ctx}
+		return g, func() {}
+	}
+	scanCtx, cancel := context.WithTimeout(ctx, g.timeout)
+	g.scan = cancelCheck{ctx: scanCtx}
+	return g, cancel
+}
+
+// stricterLimit returns the lower of two limits, where 0 means no limit
+func stricterLimit(a, b int) int {
+	if a <= 0 || b > 0 && b < a {
+		return b
+	}
+	return a
+}
+
+// examine counts a document of the queried collection and returns ErrQueryLimit
+// once a limit is exceeded
+func (g *queryGuard) examine() error {
+	g.examined++
+	if g.maxExamined > 0 && g.examined > g.maxExamined {
+		return fmt.Errorf("%w: examined more than %d documents", ErrQueryLimit, g.maxExamined)
+	}
+	return g.err()
+}
+
+// err returns ErrQueryLimit once the query timeout passed, or the caller's context
+// error once it is done
+func (g *queryGuard) err() error {
+	if err := g.scan.err(); err != nil {
+		if g.ctx.Err() != nil {
+			return g.ctx.Err()
+		}
+		return fmt.Errorf("%w: ran longer than %s", ErrQueryLimit, g.timeout)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"multimodel-db-engine/internal/config"
+)
+
+func TestQueryLimitsStopScans(t *testing.T) {
+	db := NewMultiModelDatabase(&config.Config{DataDir: t.TempDir(), ReplicationFactor: 1, QueryMaxExamined: 50})
+	defer db.Close()
+	for i := 0; i < 100; i++ {
+		if err := db.InsertDocument("events", fmt.Sprint(i), Document{"n": float64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.InsertDocument("other", "x", Document{"n": float64(1)}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// The configured limit applies to every query
+	if _, err := db.FindDocuments(ctx, "events", DocumentQuery{}); !errors.Is(err, ErrQueryLimit) {
+		t.Fatalf("scan past the configured limit: %v", err)
+	}
+	// Queries can only lower it
+	if _, err := db.FindDocuments(ctx, "events", DocumentQuery{MaxExamined: 1000}); !errors.Is(err, ErrQueryLimit) {
+		t.Fatalf("scan past a raised limit: %v", err)
+	}
+	docs, err := db.FindDocuments(ctx, "events", DocumentQuery{MaxExamined: 10, Partial: true})
+	if !errors.Is(err, ErrQueryLimit) || len(docs) != 10 {
+		t.Fatalf("partial results = %d documents, %v", len(docs), err)
+	}
+	if docs, err := db.FindDocuments(ctx, "other", DocumentQuery{}); err != nil || len(docs) != 1 {
+		t.Fatalf("documents of other collections count against the limit: %v, %v", docs, err)
+	}
+
+	// A query timeout is a limit, while the caller's own deadline stays a context error
+	expired, cancel := context.WithTimeout(ctx, -time.Second)
+	defer cancel()
+	for _, tc := range []struct {
+		ctx     context.Context
+		timeout time.Duration
+		want    error
+	}{
+		{ctx, time.Nanosecond, ErrQueryLimit},
+		{expired, time.Hour, context.DeadlineExceeded},
+	} {
+		guard, release := db.newQueryGuard(tc.ctx, DocumentQuery{Timeout: tc.timeout})
+		time.Sleep(time.Millisecond)
+		var err error
+		for i := 0; i < cancelCheckInterval && err == nil; i++ {
+			err = guard.err()
+		}
+		release()
+		if !errors.Is(err, tc.want) {
+			t.Fatalf("timeout %s: %v, want %v", tc.timeout, err, tc.want)
+		}
+	}
+}
+
+func BenchmarkFindDocumentsDotPath(b *testing.B) {
+	db := newTestDatabase(b)
+	for i := 0; i < 1000; i++ {
+		doc := Document{"address": map[string]interface{}{"city": fmt.Sprintf("city%d", i%10)}, "n": float64(i)}
+		if err := db.InsertDocument("people", fmt.Sprintf("p%d", i), doc); err != nil {
+			b.Fatal(err)
+		}
+	}
+	q := DocumentQuery{Filter: map[string]interface{}{"address.city": "city3"}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := db.FindDocuments(context.Background(), "people", q); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,581 @@
+package database
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultVisibilityTimeout hides a dequeued message from other consumers until it is
+	// acknowledged or the timeout passes
+	DefaultVisibilityTimeout = 30 * time.Second
+
+	queueJournalSuffix = ".journal"
+
+	// queueCompactThreshold is the number of acknowledged journal records after which
+	// the journal is rewritten with only the live messages
+	queueCompactThreshold = 1024
+)
+
+// QueueMessage is a message handed to a consumer
+type QueueMessage struct {
+	ID         string      `json:"id"`
+	Payload    interface{} `json:"payload"`
+	EnqueuedAt time.Time   `json:"enqueued_at"`
+	Attempts   int         `json:"attempts"`
+	Receipt    string      `json:"receipt,omitempty"` // required to acknowledge this delivery
+}
+
+// QueueStats summarizes a queue
+type QueueStats struct {
+	Name     string `json:"name"`
+	Ready    int    `json:"ready"`
+	InFlight int    `json:"in_flight"`
+}
+
+// QueueRecord is a line in a queue journal, also sent to the replicas of the queue
+type QueueRecord struct {
+	Op         string      `json:"op"` // enqueue, ack
+	ID         string      `json:"id"`
+	Seq        int64       `json:"seq,omitempty"`
+	Payload    interface{} `json:"payload,omitempty"`
+	EnqueuedAt time.Time   `json:"enqueued_at,omitempty"`
+}
+
+type queueMessage struct {
+	id         string
+	seq        int64
+	payload    interface{}
+	enqueuedAt time.Time
+	attempts   int
+	visibleAt  time.Time
+	receipt    string
+}
+
+type taskQueue struct {
+	name     string
+	messages map[string]*queueMessage
+	order    []*queueMessage // FIFO by seq; acknowledged messages are removed lazily
+	nextSeq  int64
+	acked    int // acknowledged records in the journal since the last compaction
+	journal  *os.File
+	faults   *FaultInjector
+	torn     bool // an injected crash tore the last append; reload before further use
+}
+
+// QueueStore manages FIFO work queues with visibility timeouts. Every enqueue and
+// acknowledgement is appended to a per-queue journal under <DataDir>/queues and
+// fsynced, so messages survive restarts; in-flight deliveries become visible again
+// after a restart, giving at-least-once delivery. In a cluster, enqueues and
+// acknowledgements are replicated to the replica nodes of the queue once durable.
+type QueueStore struct {
+	root      string
+	queues    map[string]*taskQueue
+	faults    *FaultInjector
+	replicate func(queue string, record QueueRecord) error // set when clustering is enabled
+	mutex     sync.Mutex
+}
+
+// NewQueueStore creates a queue store rooted at dir
+func NewQueueStore(dir string) *QueueStore {
+	return &QueueStore{
+		root:   dir,
+		queues: make(map[string]*taskQueue),
+	}
+}
+
+func validateQueueName(name string) error {
+	if name == "" {
+		return fmt.Errorf("queue name must not be empty")
+	}
+	if strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+		return fmt.Errorf("invalid queue name %q", name)
+	}
+	return nil
+}
+
+func newReceipt() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate receipt: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func (s *QueueStore) journalPath(name string) string {
+	return filepath.Join(s.root, name+queueJournalSuffix)
+}
+
+// getQueue returns the named queue, loading its journal on first use. Callers must
+// hold the store mutex.
+func (s *QueueStore) getQueue(name string, create bool) (*taskQueue, error) {
+	if q, exists := s.queues[name]; exists {
+		if !q.torn {
+			return q, nil
+		}
+		// Recover the way a restarted process would
+		q.journal.Close()
+		delete(s.queues, name)
+	}
+	if err := validateQueueName(name); err != nil {
+		return nil, err
+	}
+
+	path := s.journalPath(name)
+	if _, err := os.Stat(path); os.IsNotExist(err) && !create {
+		return nil, fmt.Errorf("queue %s not found", name)
+	}
+	if err := os.MkdirAll(s.root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory: %w", err)
+	}
+
+	q := &taskQueue{name: name, messages: make(map[string]*queueMessage), faults: s.faults}
+	if err := q.replay(path); err != nil {
+		return nil, err
+	}
+	journal, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal for queue %s: %w", name, err)
+	}
+	q.journal = journal
+	s.queues[name] = q
+	return q, nil
+}
+
+// replay rebuilds the queue from its journal. A torn final record left by a crash is
+// truncated so that later appends start on a fresh line.
+func (q *taskQueue) replay(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read journal for queue %s: %w", q.name, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var complete int64 // length of the journal up to the last full line
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read journal for queue %s: %w", q.name, err)
+		}
+		complete += int64(len(line))
+
+		var record QueueRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			// Skip corrupt records; earlier and later records stay valid
+			continue
+		}
+		switch record.Op {
+		case "enqueue":
+			msg := &queueMessage{id: record.ID, seq: record.Seq, payload: record.Payload, enqueuedAt: record.EnqueuedAt}
+			q.messages[msg.id] = msg
+			if record.Seq >= q.nextSeq {
+				q.nextSeq = record.Seq + 1
+			}
+		case "ack":
+			delete(q.messages, record.ID)
+			q.acked++
+		}
+	}
+	if info, err := file.Stat(); err == nil && info.Size() > complete {
+		if err := os.Truncate(path, complete); err != nil {
+			return fmt.Errorf("failed to repair journal for queue %s: %w", q.name, err)
+		}
+	}
+
+	q.order = make([]*queueMessage, 0, len(q.messages))
+	for _, msg := range q.messages {
+		q.order = append(q.order, msg)
+	}
+	sort.Slice(q.order, func(i, j int) bool { return q.order[i].seq < q.order[j].seq })
+	return nil
+}
+
+func (q *taskQueue) append(record QueueRecord) error {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode queue record: %w", err)
+	}
+	encoded = append(encoded, '\n')
+	if _, crash := q.faults.trigger(FaultJournalWrite); crash {
+		q.journal.Write(encoded[:len(encoded)/2])
+		q.journal.Sync()
+		q.torn = true
+		return fmt.Errorf("journal write for queue %s torn: %w", q.name, ErrInjectedFault)
+	}
+	if _, err := q.journal.Write(encoded); err != nil {
+		return fmt.Errorf("failed to write journal for queue %s: %w", q.name, err)
+	}
+	return q.journal.Sync()
+}
+
+// compact rewrites the journal with only live messages once enough acknowledgements
+// have accumulated
+func (s *QueueStore) compact(q *taskQueue) error {
+	if q.acked < queueCompactThreshold || q.acked < len(q.messages) {
+		return nil
+	}
+
+	path := s.journalPath(q.name)
+	tmp, err := os.CreateTemp(s.root, "."+q.name+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	for _, msg := range q.order {
+		if _, live := q.messages[msg.id]; !live {
+			continue
+		}
+		encoded, err := json.Marshal(QueueRecord{Op: "enqueue", ID: msg.id, Seq: msg.seq, Payload: msg.payload, EnqueuedAt: msg.enqueuedAt})
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		writer.Write(append(encoded, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+
+	// The current journal stays in use until the new one replaced it
+	journal, err := os.OpenFile(tmp.Name(), os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		journal.Close()
+		return err
+	}
+	q.journal.Close()
+	q.journal = journal
+	q.acked = 0
+	return nil
+}
+
+// Enqueue appends payload to the named queue, creating the queue if needed
+func (s *QueueStore) Enqueue(name string, payload interface{}) (*QueueMessage, error) {
+	s.mutex.Lock()
+	record, err := s.enqueue(name, payload)
+	s.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	s.replicateRecord(name, record)
+	return &QueueMessage{ID: record.ID, Payload: payload, EnqueuedAt: record.EnqueuedAt}, nil
+}
+
+// enqueue journals and adds a message, returning its record. Callers must hold the
+// store mutex.
+func (s *QueueStore) enqueue(name string, payload interface{}) (QueueRecord, error) {
+	q, err := s.getQueue(name, true)
+	if err != nil {
+		return QueueRecord{}, err
+	}
+
+	id, err := newReceipt()
+	if err != nil {
+		return QueueRecord{}, err
+	}
+	record := QueueRecord{Op: "enqueue", ID: id, Seq: q.nextSeq, Payload: payload, EnqueuedAt: time.Now().UTC()}
+	if err := q.append(record); err != nil {
+		return QueueRecord{}, err
+	}
+	q.add(record)
+	return record, nil
+}
+
+// add adds the message of an enqueue record, keeping the order by sequence
+func (q *taskQueue) add(record QueueRecord) {
+	msg := &queueMessage{id: record.ID, seq: record.Seq, payload: record.Payload, enqueuedAt: record.EnqueuedAt}
+	if record.Seq >= q.nextSeq {
+		q.nextSeq = record.Seq + 1
+	}
+	q.messages[msg.id] = msg
+	q.order = append(q.order, msg)
+	if n := len(q.order); n > 1 && q.order[n-2].seq > msg.seq {
+		sort.SliceStable(q.order, func(i, j int) bool { return q.order[i].seq < q.order[j].seq })
+	}
+}
+
+// Dequeue hands out up to max visible messages in FIFO order. Each is hidden for
+// visibilityTimeout and must be acknowledged with its receipt before then.
+func (s *QueueStore) Dequeue(name string, max int, visibilityTimeout time.Duration) ([]*QueueMessage, error) {
+	if max <= 0 {
+		max = 1
+	}
+	if visibilityTimeout <= 0 {
+		visibilityTimeout = DefaultVisibilityTimeout
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	q, err := s.getQueue(name, false)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	delivered := make([]*QueueMessage, 0, max)
+	live := q.order[:0]
+	for _, msg := range q.order {
+		if _, exists := q.messages[msg.id]; !exists {
+			continue // acknowledged, drop from the order
+		}
+		live = append(live, msg)
+
+		if len(delivered) >= max || now.Before(msg.visibleAt) {
+			continue
+		}
+		receipt, err := newReceipt()
+		if err != nil {
+			return nil, err
+		}
+		msg.receipt = receipt
+		msg.attempts++
+		msg.visibleAt = now.Add(visibilityTimeout)
+		delivered = append(delivered, &QueueMessage{
+			ID:         msg.id,
+			Payload:    msg.payload,
+			EnqueuedAt: msg.enqueuedAt,
+			Attempts:   msg.attempts,
+			Receipt:    receipt,
+		})
+	}
+	for i := len(live); i < len(q.order); i++ {
+		q.order[i] = nil
+	}
+	q.order = live
+
+	return delivered, nil
+}
+
+// Ack removes a delivered message. The receipt must match the latest delivery so a
+// consumer whose visibility timeout lapsed cannot acknowledge a redelivered message.
+func (s *QueueStore) Ack(name, id, receipt string) error {
+	s.mutex.Lock()
+	record, err := s.ack(name, id, receipt)
+	s.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s.replicateRecord(name, record)
+	return nil
+}
+
+// ack journals the acknowledgement of a delivery and removes the message, returning
+// the record. Callers must hold the store mutex.
+func (s *QueueStore) ack(name, id, receipt string) (QueueRecord, error) {
+	q, err := s.getQueue(name, false)
+	if err != nil {
+		return QueueRecord{}, err
+	}
+
+	msg, exists := q.messages[id]
+	if !exists {
+		return QueueRecord{}, fmt.Errorf("message %s not found in queue %s", id, name)
+	}
+	if msg.receipt == "" || msg.receipt != receipt || !time.Now().Before(msg.visibleAt) {
+		return QueueRecord{}, fmt.Errorf("receipt for message %s is invalid or expired", id)
+	}
+
+	record := QueueRecord{Op: "ack", ID: id}
+	if err := q.append(record); err != nil {
+		return QueueRecord{}, err
+	}
+	s.acknowledge(q, id)
+	return record, nil
+}
+
+// acknowledge removes a message whose ack record is durable. The acknowledgement
+// stands whether or not the journal could be compacted.
+func (s *QueueStore) acknowledge(q *taskQueue, id string) {
+	delete(q.messages, id)
+	q.acked++
+	if err := s.compact(q); err != nil {
+		log.Printf("Failed to compact journal of queue %s: %v", q.name, err)
+	}
+}
+
+// ApplyReplicated applies a journal record replicated by the node that took the
+// enqueue or acknowledgement. Records already applied are skipped.
+func (s *QueueStore) ApplyReplicated(name string, record QueueRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	q, err := s.getQueue(name, true)
+	if err != nil {
+		return err
+	}
+	_, exists := q.messages[record.ID]
+	switch record.Op {
+	case "enqueue":
+		if record.ID == "" || exists {
+			return nil
+		}
+		if err := q.append(record); err != nil {
+			return err
+		}
+		q.add(record)
+	case "ack":
+		if !exists {
+			return nil
+		}
+		if err := q.append(record); err != nil {
+			return err
+		}
+		s.acknowledge(q, record.ID)
+	default:
+		return fmt.Errorf("unknown queue record %q", record.Op)
+	}
+	return nil
+}
+
+// replicateRecord sends a durable journal record to the replicas of the queue. A
+// replica that misses it is logged, as for replicated KV writes.
+func (s *QueueStore) replicateRecord(name string, record QueueRecord) {
+	if s.replicate == nil {
+		return
+	}
+	if err := s.replicate(name, record); err != nil {
+		log.Printf("Replication of queue %s skipped: %v", name, err)
+	}
+}
+
+// Stats returns message counts for the named queue
+func (s *QueueStore) Stats(name string) (*QueueStats, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	q, err := s.getQueue(name, false)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	stats := &QueueStats{Name: name}
+	for _, msg := range q.messages {
+		if now.Before(msg.visibleAt) {
+			stats.InFlight++
+		} else {
+			stats.Ready++
+		}
+	}
+	return stats, nil
+}
+
+// ListQueues returns the names of all queues, including ones not loaded yet
+func (s *QueueStore) ListQueues() ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	names := make(map[string]struct{})
+	for name := range s.queues {
+		names[name] = struct{}{}
+	}
+	entries, err := os.ReadDir(s.root)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), queueJournalSuffix) && !strings.HasPrefix(entry.Name(), ".") {
+			names[strings.TrimSuffix(entry.Name(), queueJournalSuffix)] = struct{}{}
+		}
+	}
+
+	result := make([]string, 0, len(names))
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// Close closes all queue journals
+func (s *QueueStore) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, q := range s.queues {
+		q.journal.Close()
+	}
+}
+
+// queueReplicaKey is the key placing the replicas of a queue
+func queueReplicaKey(queue string) string {
+	return "_queues." + queue
+}
+
+// ReplicateQueueRecord sends a queue journal record to the other replica nodes of
+// the queue, placed like the keys of a _queues collection. It fails when a replica
+// did not acknowledge it.
+func (c *Cluster) ReplicateQueueRecord(queue string, record QueueRecord) error {
+	key := queueReplicaKey(queue)
+	if c.PlacementFor(keyCollection(key)).Replicas <= 1 {
+		return nil
+	}
+
+	var failed []string
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, node := range c.ReplicaNodes(key) {
+		if node.ID == c.selfNode.ID {
+			continue
+		}
+		wg.Add(1)
+		go func(node *Node) {
+			defer wg.Done()
+			err := c.replicateQueueRecordToNode(node, queue, record)
+			c.recordReplication(key, node.ID, err == nil)
+			if err != nil {
+				mutex.Lock()
+				failed = append(failed, node.ID)
+				mutex.Unlock()
+			}
+		}(node)
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("%s of message %s not acknowledged by %s", record.Op, record.ID, strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (c *Cluster) replicateQueueRecordToNode(node *Node, queue string, record QueueRecord) error {
+	if _, fired := c.faults.trigger(FaultReplicationDrop); fired {
+		return fmt.Errorf("failed to replicate to node %s: %w", node.ID, ErrInjectedFault)
+	}
+	if err := c.post(node, "/data/queues/"+queue, record); err != nil {
+		return fmt.Errorf("failed to replicate to node %s: %w", node.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package database
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"multimodel-db-engine/internal/config"
+)
+
+func TestQueueDeliversAndAcknowledges(t *testing.T) {
+	store := NewQueueStore(t.TempDir())
+	defer store.Close()
+
+	for _, payload := range []string{"a", "b", "c"} {
+		if _, err := store.Enqueue("jobs", payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first, err := store.Dequeue("jobs", 2, time.Minute)
+	if err != nil || len(first) != 2 || first[0].Payload != "a" || first[1].Payload != "b" {
+		t.Fatalf("first delivery = %+v, %v", first, err)
+	}
+	// In-flight messages are hidden from other consumers
+	second, err := store.Dequeue("jobs", 10, time.Minute)
+	if err != nil || len(second) != 1 || second[0].Payload != "c" {
+		t.Fatalf("second delivery = %+v, %v", second, err)
+	}
+
+	if err := store.Ack("jobs", first[0].ID, "wrong"); err == nil {
+		t.Fatal("ack with a wrong receipt succeeded")
+	}
+	for _, msg := range append(first, second...) {
+		if err := store.Ack("jobs", msg.ID, msg.Receipt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Ack("jobs", first[0].ID, first[0].Receipt); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("second ack of a message = %v", err)
+	}
+	if stats, err := store.Stats("jobs"); err != nil || stats.Ready != 0 || stats.InFlight != 0 {
+		t.Fatalf("stats after acks = %+v, %v", stats, err)
+	}
+	if _, err := store.Dequeue("missing", 1, time.Minute); err == nil {
+		t.Fatal("dequeue created a queue")
+	}
+}
+
+func TestQueueRedeliversAfterVisibilityTimeout(t *testing.T) {
+	store := NewQueueStore(t.TempDir())
+	defer store.Close()
+
+	if _, err := store.Enqueue("jobs", "a"); err != nil {
+		t.Fatal(err)
+	}
+	first, err := store.Dequeue("jobs", 1, 20*time.Millisecond)
+	if err != nil || len(first) != 1 {
+		t.Fatalf("delivery = %+v, %v", first, err)
+	}
+	time.Sleep(40 * time.Millisecond)
+
+	second, err := store.Dequeue("jobs", 1, time.Minute)
+	if err != nil || len(second) != 1 || second[0].ID != first[0].ID || second[0].Attempts != 2 {
+		t.Fatalf("redelivery = %+v, %v", second, err)
+	}
+	// The lapsed delivery can no longer acknowledge the message
+	if err := store.Ack("jobs", first[0].ID, first[0].Receipt); err == nil {
+		t.Fatal("ack of a lapsed delivery succeeded")
+	}
+	if err := store.Ack("jobs", second[0].ID, second[0].Receipt); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueueJournalReplaysOnReopen(t *testing.T) {
+	dir := t.TempDir()
+	store := NewQueueStore(dir)
+	for _, payload := range []string{"a", "b", "c"} {
+		if _, err := store.Enqueue("jobs", payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	delivered, err := store.Dequeue("jobs", 2, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Ack("jobs", delivered[0].ID, delivered[0].Receipt); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// The unacknowledged delivery is visible again after the restart
+	reopened := NewQueueStore(dir)
+	defer reopened.Close()
+	if names, err := reopened.ListQueues(); err != nil || len(names) != 1 || names[0] != "jobs" {
+		t.Fatalf("queues = %v, %v", names, err)
+	}
+	messages, err := reopened.Dequeue("jobs", 10, time.Minute)
+	if err != nil || len(messages) != 2 || messages[0].Payload != "b" || messages[1].Payload != "c" {
+		t.Fatalf("messages after reopen = %+v, %v", messages, err)
+	}
+	if _, err := reopened.Enqueue("jobs", "d"); err != nil {
+		t.Fatal(err)
+	}
+	if q := reopened.queues["jobs"]; q.nextSeq != 4 {
+		t.Fatalf("sequence after reopen and enqueue = %d, want 4", q.nextSeq)
+	}
+}
+
+func TestQueueCompactsJournal(t *testing.T) {
+	dir := t.TempDir()
+	store := NewQueueStore(dir)
+	defer store.Close()
+
+	for i := 0; i < queueCompactThreshold+1; i++ {
+		if _, err := store.Enqueue("jobs", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	messages, err := store.Dequeue("jobs", queueCompactThreshold, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range messages {
+		if err := store.Ack("jobs", msg.ID, msg.Receipt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	journal, err := os.ReadFile(store.journalPath("jobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(journal), "\n"); lines != 1 {
+		t.Fatalf("compacted journal holds %d records, want 1", lines)
+	}
+	// The swapped journal takes further appends
+	if _, err := store.Enqueue("jobs", "after"); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	reopened := NewQueueStore(dir)
+	defer reopened.Close()
+	if stats, err := reopened.Stats("jobs"); err != nil || stats.Ready != 2 {
+		t.Fatalf("stats after compaction and reopen = %+v, %v", stats, err)
+	}
+}
+
+func TestQueueAckSurvivesFailedCompaction(t *testing.T) {
+	dir := t.TempDir()
+	store := NewQueueStore(dir)
+	defer store.Close()
+
+	for i := 0; i < queueCompactThreshold; i++ {
+		if _, err := store.Enqueue("jobs", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	messages, err := store.Dequeue("jobs", queueCompactThreshold, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range messages[:len(messages)-1] {
+		if err := store.Ack("jobs", msg.ID, msg.Receipt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The journal stays open, but no replacement can be written next to it
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	last := messages[len(messages)-1]
+	if err := store.Ack("jobs", last.ID, last.Receipt); err != nil {
+		t.Fatalf("ack failed with its compaction: %v", err)
+	}
+	if _, err := store.Enqueue("jobs", "after"); err != nil {
+		t.Fatalf("journal unusable after failed compaction: %v", err)
+	}
+}
+
+func TestQueueRecordsReplicate(t *testing.T) {
+	replica := NewQueueStore(t.TempDir())
+	defer replica.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/data/queues/") {
+			return
+		}
+		var record QueueRecord
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := replica.ApplyReplicated(strings.TrimPrefix(r.URL.Path, "/data/queues/"), record); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	cluster := newCluster(&config.Config{ReplicationFactor: 2}, NewFaultInjector(), NewHLC())
+	defer cluster.Close()
+	cluster.AddNode(&Node{ID: "peer", Address: host, Port: port, Status: "active"})
+
+	store := NewQueueStore(t.TempDir())
+	defer store.Close()
+	store.replicate = cluster.ReplicateQueueRecord
+
+	for _, payload := range []string{"a", "b"} {
+		if _, err := store.Enqueue("jobs", payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	delivered, err := store.Dequeue("jobs", 1, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Ack("jobs", delivered[0].ID, delivered[0].Receipt); err != nil {
+		t.Fatal(err)
+	}
+
+	// The replica holds the remaining message under the same id
+	messages, err := replica.Dequeue("jobs", 10, time.Minute)
+	if err != nil || len(messages) != 1 || messages[0].Payload != "b" {
+		t.Fatalf("replica messages = %+v, %v", messages, err)
+	}
+	// Records applied twice change nothing
+	record := QueueRecord{Op: "enqueue", ID: messages[0].ID, Seq: 1, Payload: "b"}
+	if err := replica.ApplyReplicated("jobs", record); err != nil {
+		t.Fatal(err)
+	}
+	if err := replica.ApplyReplicated("jobs", QueueRecord{Op: "ack", ID: delivered[0].ID}); err != nil {
+		t.Fatal(err)
+	}
+	if stats, err := replica.Stats("jobs"); err != nil || stats.Ready+stats.InFlight != 1 {
+		t.Fatalf("replica stats = %+v, %v", stats, err)
+	}
+}
@@ -0,0 +1,172 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// rawDocuments caches the JSON encoding of documents read through GetDocumentJSON, so
+// repeated reads of an unchanged document are written out without encoding it again.
+// Writes store a new map rather than change the stored one, so an entry is current
+// as long as the map it was encoded from is still the one stored under its key.
+type rawDocuments struct {
+	entries map[string]rawDocument
+	size    int // bytes of encoded documents held
+	limit   int // 0 disables the cache
+
+	hits   uint64
+	misses uint64
+	mutex  sync.Mutex
+}
+
+type rawDocument struct {
+	doc     Document // keeps the map alive, so that its address identifies it
+	encoded []byte
+}
+
+// RawCacheStats reports the use of the encoded document cache
+type RawCacheStats struct {
+	Documents int    `json:"documents"`
+	Bytes     int    `json:"bytes"`
+	Limit     int    `json:"limit"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+}
+
+func newRawDocuments(limit int) *rawDocuments {
+	return &rawDocuments{entries: make(map[string]rawDocument), limit: limit}
+}
+
+func sameDocument(a, b Document) bool {
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
+
+// get returns the encoding of doc, stored under key, when it is cached
+func (c *rawDocuments) get(key string, doc Document) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, cached := c.entries[key]
+	if cached && sameDocument(entry.doc, doc) {
+		c.hits++
+		return entry.encoded, true
+	}
+	c.misses++
+	return nil, false
+}
+
+// put caches the encoding of doc, evicting other entries to stay within the limit
+func (c *rawDocuments) put(key string, doc Document, encoded []byte) {
+	if len(encoded) > c.limit {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.remove(key)
+	for other := range c.entries {
+		if c.size+len(encoded) <= c.limit {
+			break
+		}
+		c.remove(other)
+	}
+	c.entries[key] = rawDocument{doc: doc, encoded: encoded}
+	c.size += len(encoded)
+}
+
+// forget drops the entry of a document no longer stored under key, releasing the map
+func (c *rawDocuments) forget(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.remove(key)
+}
+
+func (c *rawDocuments) clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = make(map[string]rawDocument)
+	c.size = 0
+}
+
+// evict drops entries until at least n bytes are released, returning the entries
+// dropped and the bytes released
+func (c *rawDocuments) evict(n int) (int, int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	dropped, released := 0, 0
+	for key, entry := range c.entries {
+		if released >= n {
+			break
+		}
+		released += len(entry.encoded)
+		dropped++
+		c.remove(key)
+	}
+	return dropped, released
+}
+
+func (c *rawDocuments) remove(key string) {
+	if entry, cached := c.entries[key]; cached {
+		c.size -= len(entry.encoded)
+		delete(c.entries, key)
+	}
+}
+
+// GetDocumentJSON returns a document encoded as JSON, as GetDocument would return it.
+// Encodings are cached up to the configured size, and archived documents are served
+// as archived, so reads of unchanged documents are not encoded again. The returned
+// bytes are shared and must not be modified.
+func (db *MultiModelDatabase) GetDocumentJSON(collection, id string) (json.RawMessage, error) {
+	if len(db.computed.get(collection, false)) > 0 || IsSystemCollection(collection) {
+		// Virtual fields and system documents are computed on every read
+		doc, err := db.GetDocument(collection, id)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(doc)
+	}
+	if err := db.warmDocument(collection, id); err != nil {
+		return nil, err
+	}
+
+	db.docMutex.RLock()
+	defer db.docMutex.RUnlock()
+
+	if a := db.archived(collection); a != nil {
+		if i, exists := a.find(id); exists {
+			// Copied, as the archive may be unmapped once the lock is released
+			_, encoded := a.entry(i)
+			return append(json.RawMessage(nil), encoded...), nil
+		}
+		return nil, fmt.Errorf("document with id %s not found in collection %s", id, collection)
+	}
+	key := collection + "." + id
+	doc, exists := db.documents[key]
+	if !exists {
+		return nil, fmt.Errorf("document with id %s not found in collection %s", id, collection)
+	}
+	if db.rawDocs.limit == 0 {
+		return json.Marshal(doc)
+	}
+	if encoded, cached := db.rawDocs.get(key, doc); cached {
+		return encoded, nil
+	}
+	// Compressed strings encode as the plain text
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	db.rawDocs.put(key, doc, encoded)
+	return encoded, nil
+}
+
+// RawCacheStats returns the size and hit rate of the encoded document cache
+func (db *MultiModelDatabase) RawCacheStats() RawCacheStats {
+	c := db.rawDocs
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return RawCacheStats{Documents: len(c.entries), Bytes: c.size, Limit: c.limit, Hits: c.hits, Misses: c.misses}
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGetDocumentJSON(t *testing.T) {
+	db := newTestDatabase(t)
+	db.rawDocs = newRawDocuments(1 << 20)
+	db.enableDocumentCompression("gzip", 64)
+
+	body := strings.Repeat("text that compresses well ", 10)
+	if err := db.InsertDocument("pages", "p1", Document{"title": "<Home>", "body": body, "views": json.Number("9007199254740993")}); err != nil {
+		t.Fatal(err)
+	}
+	matches := func(id string) []byte {
+		t.Helper()
+		encoded, err := db.GetDocumentJSON("pages", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err := db.GetDocument("pages", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, _ := json.Marshal(doc); string(encoded) != string(want) {
+			t.Fatalf("encoded %s, want %s", encoded, want)
+		}
+		return encoded
+	}
+
+	first := matches("p1")
+	if again := matches("p1"); &again[0] != &first[0] {
+		t.Fatal("unchanged document encoded again")
+	}
+	if stats := db.RawCacheStats(); stats.Documents != 1 || stats.Hits != 1 || stats.Bytes != len(first) {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	// Writes replace the stored map, which invalidates its encoding
+	if err := db.UpdateDocument("pages", "p1", Document{"title": "Home"}); err != nil {
+		t.Fatal(err)
+	}
+	if updated := matches("p1"); !strings.Contains(string(updated), `"title":"Home"`) {
+		t.Fatalf("stale encoding %s", updated)
+	}
+	if err := db.DeleteDocument("pages", "p1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetDocumentJSON("pages", "p1"); err == nil {
+		t.Fatal("deleted document served from the cache")
+	}
+	if stats := db.RawCacheStats(); stats.Documents != 0 || stats.Bytes != 0 {
+		t.Fatalf("stats after delete = %+v", stats)
+	}
+
+	// Archived documents are served as archived, virtual fields are computed
+	for _, id := range []string{"p2", "p3"} {
+		if err := db.InsertDocument("pages", id, Document{"title": id, "views": json.Number("3")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.ArchiveCollection("pages"); err != nil {
+		t.Fatal(err)
+	}
+	matches("p3")
+	if err := db.DefineComputedField(ComputedField{Collection: "pages", Name: "label", Expression: "upper(title)"}); err != nil {
+		t.Fatal(err)
+	}
+	if encoded := matches("p2"); !strings.Contains(string(encoded), `"label":"P2"`) {
+		t.Fatalf("virtual field missing from %s", encoded)
+	}
+}
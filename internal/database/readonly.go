@@ -0,0 +1,48 @@
+package database
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrReadOnly is returned for writes rejected because the database is read-only
+var ErrReadOnly = errors.New("database is in read-only mode")
+
+// ReadOnlyStatus describes whether mutations are currently rejected
+type ReadOnlyStatus struct {
+	Enabled bool       `json:"enabled"`
+	Reason  string     `json:"reason,omitempty"` // e.g. "backup in progress"
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+type readOnlyState struct {
+	status ReadOnlyStatus
+	mutex  sync.RWMutex
+}
+
+// SetReadOnly switches read-only mode on or off. While enabled the HTTP API rejects
+// mutations and scheduled jobs that write are skipped; reads keep being served.
+func (db *MultiModelDatabase) SetReadOnly(enabled bool, reason string) ReadOnlyStatus {
+	db.readOnly.mutex.Lock()
+	defer db.readOnly.mutex.Unlock()
+
+	if !enabled {
+		db.readOnly.status = ReadOnlyStatus{}
+		return db.readOnly.status
+	}
+	if !db.readOnly.status.Enabled {
+		now := time.Now().UTC()
+		db.readOnly.status.Since = &now
+	}
+	db.readOnly.status.Enabled = true
+	db.readOnly.status.Reason = reason
+	return db.readOnly.status
+}
+
+// ReadOnly returns the current read-only status
+func (db *MultiModelDatabase) ReadOnly() ReadOnlyStatus {
+	db.readOnly.mutex.RLock()
+	defer db.readOnly.mutex.RUnlock()
+	return db.readOnly.status
+}
@@ -0,0 +1,314 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DocumentReference declares a field of the documents of Collection holding ids of
+// documents of Target, as customer_id of orders holds the id of a customer. The
+// graph then holds an edge of type EdgeType from the node of every referencing
+// document to the node of each document it references (see DocumentNodeID), so
+// the relationships already in the documents can be traversed and watched as a
+// graph. Missing nodes are created with their collection as label.
+//
+// The field may hold an id, a {"$ref": Target, "$id": id} reference or an array of
+// either. Edges follow the writes of the collection: they are added and removed as
+// the field changes, and removed with the document.
+type DocumentReference struct {
+	Collection string `json:"collection"`
+	Field      string `json:"field"` // a key or a dot path
+	Target     string `json:"target"`
+	EdgeType   string `json:"edge_type"`
+}
+
+// referenceSet holds the declared references of the document store with the edges
+// materialized for them, by the node of the referencing document
+type referenceSet struct {
+	refs  map[string][]*DocumentReference          // by collection
+	edges map[string]map[string]*DocumentReference // edge ids by source node
+	mutex sync.Mutex
+}
+
+func newReferenceSet() *referenceSet {
+	return &referenceSet{
+		refs:  make(map[string][]*DocumentReference),
+		edges: make(map[string]map[string]*DocumentReference),
+	}
+}
+
+// referenceEdgeID is the id of the edge materialized for ref from document id to
+// the document target
+func referenceEdgeID(ref *DocumentReference, id, target string) string {
+	return "ref:" + ref.Collection + ":" + ref.Field + ":" + id + "->" + target
+}
+
+// referencedIDs returns the ids of the documents of ref.Target that doc references
+func (ref *DocumentReference) referencedIDs(doc Document) []string {
+	value, exists := lookupPath(doc, ref.Field)
+	if !exists {
+		return nil
+	}
+	values, isArray := value.([]interface{})
+	if !isArray {
+		values = []interface{}{value}
+	}
+	var ids []string
+	for _, v := range values {
+		switch id := v.(type) {
+		case string:
+			if id != "" {
+				ids = append(ids, id)
+			}
+		case json.Number, float64, int, int64:
+			ids = append(ids, fmt.Sprint(id))
+		case map[string]interface{}:
+			if target, ok := id["$ref"].(string); ok && target == ref.Target && id["$id"] != nil {
+				ids = append(ids, fmt.Sprint(id["$id"]))
+			}
+		}
+	}
+	return ids
+}
+
+// DefineDocumentReference declares a reference, replacing any on the same field of
+// the collection, and materializes the edges of the documents already stored
+func (db *MultiModelDatabase) DefineDocumentReference(ctx context.Context, ref DocumentReference) error {
+	for _, collection := range []string{ref.Collection, ref.Target} {
+		if err := ValidateCollectionName(collection); err != nil {
+			return err
+		}
+	}
+	if ref.Field == "" || ref.Field == IDField {
+		return fmt.Errorf("reference field %q is not allowed", ref.Field)
+	}
+	if strings.TrimSpace(ref.EdgeType) == "" {
+		return fmt.Errorf("reference on %s needs an edge type", ref.Field)
+	}
+	ids, _, err := db.collectionDocuments(ctx, ref.Collection)
+	if err != nil {
+		return err
+	}
+
+	db.references.mutex.Lock()
+	var changes []pendingWrite
+	refs := db.references.refs[ref.Collection]
+	replaced := false
+	for i, existing := range refs {
+		if existing.Field == ref.Field {
+			changes = append(changes, db.dropReferenceEdges(existing)...)
+			refs[i] = &ref
+			replaced = true
+		}
+	}
+	if !replaced {
+		db.references.refs[ref.Collection] = append(refs, &ref)
+	}
+	// Documents deleted since the adopted edges were made are followed too, to drop them
+	for _, id := range append(ids, db.adoptReferenceEdges(&ref)...) {
+		changes = append(changes, db.followReferences(ref.Collection, id)...)
+	}
+	db.references.mutex.Unlock()
+
+	db.notifyReferenceEdges(changes)
+	return nil
+}
+
+// DropDocumentReference removes a reference along with the edges materialized for it
+func (db *MultiModelDatabase) DropDocumentReference(collection, field string) error {
+	db.references.mutex.Lock()
+	refs := db.references.refs[collection]
+	for i, ref := range refs {
+		if ref.Field == field {
+			db.references.refs[collection] = append(refs[:i:i], refs[i+1:]...)
+			changes := db.dropReferenceEdges(ref)
+			db.references.mutex.Unlock()
+			db.notifyReferenceEdges(changes)
+			return nil
+		}
+	}
+	db.references.mutex.Unlock()
+	return fmt.Errorf("reference on %s not found in collection %s", field, collection)
+}
+
+// DocumentReferences returns the references of collection in definition order
+func (db *MultiModelDatabase) DocumentReferences(collection string) []DocumentReference {
+	db.references.mutex.Lock()
+	defer db.references.mutex.Unlock()
+
+	refs := make([]DocumentReference, 0, len(db.references.refs[collection]))
+	for _, ref := range db.references.refs[collection] {
+		refs = append(refs, *ref)
+	}
+	return refs
+}
+
+// syncReferences brings the edges of a written document in line with its references,
+// for collections that declare any
+func (db *MultiModelDatabase) syncReferences(collection, id string) {
+	db.references.mutex.Lock()
+	if len(db.references.refs[collection]) == 0 {
+		db.references.mutex.Unlock()
+		return
+	}
+	changes := db.followReferences(collection, id)
+	db.references.mutex.Unlock()
+	db.notifyReferenceEdges(changes)
+}
+
+// referenceEdge is an edge wanted by a reference for the document id
+type referenceEdge struct {
+	edge *GraphEdge
+	ref  *DocumentReference
+	id   string
+}
+
+// derivation returns the lineage of the edges and nodes materialized for ref from
+// the document id
+func (ref *DocumentReference) derivation(id string) *Derivation {
+	return &Derivation{
+		Kind:     LineageReference,
+		Producer: "reference " + ref.Collection + "." + ref.Field,
+		Sources:  []LineageItem{{Model: ModelDocument, Namespace: ref.Collection, Key: id}},
+	}
+}
+
+// followReferences adds the edges the document id of collection references and
+// removes the ones it no longer does, all of them once it is deleted, returning
+// the changes to report. The caller holds the reference mutex, which orders the
+// updates of a document.
+func (db *MultiModelDatabase) followReferences(collection, id string) []pendingWrite {
+	source := DocumentNodeID(collection, id)
+	wanted := make(map[string]referenceEdge)
+	if doc, err := db.GetDocument(collection, id); err == nil {
+		for _, ref := range db.references.refs[collection] {
+			for _, target := range ref.referencedIDs(doc) {
+				edgeID := referenceEdgeID(ref, id, target)
+				edge := &GraphEdge{ID: edgeID, From: source, To: DocumentNodeID(ref.Target, target), Type: ref.EdgeType}
+				wanted[edgeID] = referenceEdge{edge: edge, ref: ref, id: id}
+			}
+		}
+	}
+
+	tracked := db.references.edges[source]
+	var stale []string
+	for edgeID := range tracked {
+		if _, keep := wanted[edgeID]; !keep {
+			stale = append(stale, edgeID)
+			delete(tracked, edgeID)
+		}
+	}
+	var added []referenceEdge
+	for edgeID, wantedEdge := range wanted {
+		if _, exists := tracked[edgeID]; exists {
+			continue
+		}
+		if tracked == nil {
+			tracked = make(map[string]*DocumentReference)
+			db.references.edges[source] = tracked
+		}
+		tracked[edgeID] = wantedEdge.ref
+		added = append(added, wantedEdge)
+	}
+	if len(tracked) == 0 {
+		delete(db.references.edges, source)
+	}
+	sort.Strings(stale)
+	sort.Slice(added, func(i, j int) bool { return added[i].edge.ID < added[j].edge.ID })
+	return db.applyReferenceEdges(stale, added)
+}
+
+// adoptReferenceEdges tracks the edges of ref found in the graph, such as the ones
+// restored from a snapshot, so that the documents no longer referencing them drop
+// them. It returns the ids of the documents the edges start from. The caller holds
+// the reference mutex.
+func (db *MultiModelDatabase) adoptReferenceEdges(ref *DocumentReference) []string {
+	prefix := "ref:" + ref.Collection + ":" + ref.Field + ":"
+	db.graphMutex.RLock()
+	defer db.graphMutex.RUnlock()
+
+	var ids []string
+	for edgeID, edge := range db.graphEdges {
+		if !strings.HasPrefix(edgeID, prefix) {
+			continue
+		}
+		tracked := db.references.edges[edge.From]
+		if tracked == nil {
+			tracked = make(map[string]*DocumentReference)
+			db.references.edges[edge.From] = tracked
+		}
+		tracked[edgeID] = ref
+		id := strings.TrimPrefix(edge.From, DocumentNodeID(ref.Collection, ""))
+		db.lineage.record(LineageItem{Model: ModelGraph, Namespace: "edges", Key: edgeID}, ref.derivation(id))
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// dropReferenceEdges removes the edges materialized for ref, returning the changes
+// to report. The caller holds the reference mutex.
+func (db *MultiModelDatabase) dropReferenceEdges(ref *DocumentReference) []pendingWrite {
+	var stale []string
+	for source, tracked := range db.references.edges {
+		for edgeID, owner := range tracked {
+			if owner == ref {
+				stale = append(stale, edgeID)
+				delete(tracked, edgeID)
+			}
+		}
+		if len(tracked) == 0 {
+			delete(db.references.edges, source)
+		}
+	}
+	sort.Strings(stale)
+	return db.applyReferenceEdges(stale, nil)
+}
+
+// applyReferenceEdges removes the stale edges and adds the new ones with their
+// missing nodes, recording their lineage, and returns the changes to report
+func (db *MultiModelDatabase) applyReferenceEdges(stale []string, added []referenceEdge) []pendingWrite {
+	if len(stale) == 0 && len(added) == 0 {
+		return nil
+	}
+	var changes []pendingWrite
+	db.graphMutex.Lock()
+	defer db.graphMutex.Unlock()
+
+	for _, edgeID := range stale {
+		if edge, exists := db.graphEdges[edgeID]; exists {
+			delete(db.graphEdges, edgeID)
+			db.lineage.forget(LineageItem{Model: ModelGraph, Namespace: "edges", Key: edgeID})
+			changes = append(changes, pendingWrite{OpDelete, &WriteEvent{Model: ModelGraph, Namespace: "edges", Key: edgeID, Value: edge, Timestamp: db.Clock.Now()}})
+		}
+	}
+	for _, wanted := range added {
+		edge := wanted.edge
+		nodes := map[string]string{edge.From: wanted.ref.Collection, edge.To: wanted.ref.Target}
+		for _, nodeID := range []string{edge.From, edge.To} {
+			if _, exists := db.graphNodes[nodeID]; exists {
+				continue
+			}
+			node := &GraphNode{ID: nodeID, Labels: []string{nodes[nodeID]}}
+			db.graphNodes[nodeID] = node
+			db.lineage.record(LineageItem{Model: ModelGraph, Namespace: "nodes", Key: nodeID}, wanted.ref.derivation(wanted.id))
+			changes = append(changes, pendingWrite{OpInsert, &WriteEvent{Model: ModelGraph, Namespace: "nodes", Key: nodeID, Value: node, Timestamp: db.Clock.Now()}})
+		}
+		db.graphEdges[edge.ID] = edge
+		db.lineage.record(LineageItem{Model: ModelGraph, Namespace: "edges", Key: edge.ID}, wanted.ref.derivation(wanted.id))
+		changes = append(changes, pendingWrite{OpInsert, &WriteEvent{Model: ModelGraph, Namespace: "edges", Key: edge.ID, Value: edge, Timestamp: db.Clock.Now()}})
+	}
+	return changes
+}
+
+// notifyReferenceEdges reports materialized edges to observers. Edges are derived
+// from documents, so plugins see them once applied but cannot veto them.
+func (db *MultiModelDatabase) notifyReferenceEdges(changes []pendingWrite) {
+	for _, change := range changes {
+		change.event.Timestamp = db.Clock.Now()
+		db.afterWrite(change.op, change.event)
+	}
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDocumentReferences(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+	if err := db.InsertDocument("orders", "o1", Document{"customer_id": "c1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Declaring a reference materializes the edges of the stored documents
+	ref := DocumentReference{Collection: "orders", Field: "customer_id", Target: "customers", EdgeType: "ORDERED_BY"}
+	if err := db.DefineDocumentReference(ctx, ref); err != nil {
+		t.Fatal(err)
+	}
+	edgeID := referenceEdgeID(&ref, "o1", "c1")
+	edge, err := db.GetEdge(edgeID)
+	if err != nil || edge.From != "orders:o1" || edge.To != "customers:c1" || edge.Type != "ORDERED_BY" {
+		t.Fatalf("edge = %+v, %v", edge, err)
+	}
+	if node, err := db.GetNode("customers:c1"); err != nil || len(node.Labels) != 1 || node.Labels[0] != "customers" {
+		t.Fatalf("node = %+v, %v", node, err)
+	}
+
+	// Edges follow inserts, updates and deletes
+	if err := db.InsertDocument("orders", "o2", Document{"customer_id": []interface{}{"c1", map[string]interface{}{"$ref": "customers", "$id": "c2"}}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []string{"c1", "c2"} {
+		if _, err := db.GetEdge(referenceEdgeID(&ref, "o2", target)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.UpdateDocument("orders", "o1", Document{"customer_id": "c2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetEdge(edgeID); err == nil {
+		t.Fatal("edge of the previous customer kept")
+	}
+	if _, err := db.GetEdge(referenceEdgeID(&ref, "o1", "c2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteDocument("orders", "o2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetEdge(referenceEdgeID(&ref, "o2", "c1")); err == nil {
+		t.Fatal("edge of a deleted document kept")
+	}
+
+	// Dropping the reference removes its edges
+	if err := db.DropDocumentReference("orders", "customer_id"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetEdge(referenceEdgeID(&ref, "o1", "c2")); err == nil {
+		t.Fatal("edge of a dropped reference kept")
+	}
+	if refs := db.DocumentReferences("orders"); len(refs) != 0 {
+		t.Fatalf("references = %v", refs)
+	}
+	if err := db.DefineDocumentReference(ctx, DocumentReference{Collection: "orders", Field: "customer_id", Target: "customers"}); err == nil {
+		t.Fatal("reference without an edge type defined")
+	}
+}
@@ -0,0 +1,199 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SavedQueriesCollection is the system collection holding saved queries
+const SavedQueriesCollection = "_queries"
+
+// ErrSavedQueryNotFound is returned for names without a saved query
+var ErrSavedQueryNotFound = errors.New("saved query not found")
+
+// queryPlaceholder matches the parameters of saved queries, written {{name}}
+var queryPlaceholder = regexp.MustCompile(`\{\{(\w+)\}\}`)
+
+// SavedQuery is a named document query. Query holds query string parameters as for
+// GET /docs/{collection}, whose values may contain placeholders such as {{user}}
+// filled in with the arguments of each run, or with Defaults.
+type SavedQuery struct {
+	Name        string            `json:"name"`
+	Collection  string            `json:"collection"`
+	Query       string            `json:"query"` // user_id={{user}}&_sort=-total
+	Defaults    map[string]string `json:"defaults,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Params      []string          `json:"params"` // placeholders found in Query
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// SaveQuery stores q under its name, replacing any saved query of that name
+func (db *MultiModelDatabase) SaveQuery(q SavedQuery) (*SavedQuery, error) {
+	if q.Name == "" || strings.ContainsAny(q.Name, "./") {
+		return nil, fmt.Errorf("saved query name %q must not be empty or contain . or /", q.Name)
+	}
+	if err := ValidateCollectionName(q.Collection); err != nil {
+		return nil, err
+	}
+	values, err := url.ParseQuery(q.Query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
+
+	params := make(map[string]bool)
+	for _, vs := range values {
+		for _, v := range vs {
+			for _, match := range queryPlaceholder.FindAllStringSubmatch(v, -1) {
+				params[match[1]] = true
+			}
+		}
+	}
+	for name := range q.Defaults {
+		if !params[name] {
+			return nil, fmt.Errorf("default given for %s, which the query does not use", name)
+		}
+	}
+	q.Params = sortedKeys(params)
+	q.UpdatedAt = time.Now().UTC()
+
+	// Check the query parses when it runs without arguments
+	if len(q.Defaults) == len(q.Params) {
+		if _, err := q.bind(nil); err != nil {
+			return nil, err
+		}
+	}
+
+	doc := make(Document)
+	encoded, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(encoded, &doc); err != nil {
+		return nil, err
+	}
+
+	db.docMutex.Lock()
+	db.touchCollection(SavedQueriesCollection)
+	db.documents[SavedQueriesCollection+"."+q.Name] = doc
+	db.docMutex.Unlock()
+	return &q, nil
+}
+
+// SavedQuery returns the saved query called name
+func (db *MultiModelDatabase) SavedQuery(name string) (*SavedQuery, error) {
+	db.docMutex.RLock()
+	doc, exists := db.documents[SavedQueriesCollection+"."+name]
+	db.docMutex.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrSavedQueryNotFound, name)
+	}
+	return decodeSavedQuery(doc)
+}
+
+// SavedQueries returns the saved queries ordered by name
+func (db *MultiModelDatabase) SavedQueries() []SavedQuery {
+	db.docMutex.RLock()
+	defer db.docMutex.RUnlock()
+
+	prefix := SavedQueriesCollection + "."
+	queries := make([]SavedQuery, 0)
+	for key, doc := range db.documents {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if q, err := decodeSavedQuery(doc); err == nil {
+			queries = append(queries, *q)
+		}
+	}
+	sort.Slice(queries, func(i, j int) bool { return queries[i].Name < queries[j].Name })
+	return queries
+}
+
+// DeleteSavedQuery removes the saved query called name
+func (db *MultiModelDatabase) DeleteSavedQuery(name string) error {
+	db.docMutex.Lock()
+	defer db.docMutex.Unlock()
+
+	key := SavedQueriesCollection + "." + name
+	if _, exists := db.documents[key]; !exists {
+		return fmt.Errorf("%w: %s", ErrSavedQueryNotFound, name)
+	}
+	delete(db.documents, key)
+	db.touchCollection(SavedQueriesCollection)
+	return nil
+}
+
+// RunSavedQuery runs the saved query called name with args filling its placeholders
+func (db *MultiModelDatabase) RunSavedQuery(ctx context.Context, name string, args map[string]string) ([]Document, error) {
+	q, err := db.SavedQuery(name)
+	if err != nil {
+		return nil, err
+	}
+	query, err := q.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	return db.FindDocuments(ctx, q.Collection, query)
+}
+
+// bind fills the placeholders of the query with args or the defaults and parses it
+func (q *SavedQuery) bind(args map[string]string) (DocumentQuery, error) {
+	for name := range args {
+		if !containsString(q.Params, name) {
+			return DocumentQuery{}, fmt.Errorf("saved query %s has no parameter %s", q.Name, name)
+		}
+	}
+	values, err := url.ParseQuery(q.Query)
+	if err != nil {
+		return DocumentQuery{}, err
+	}
+
+	missing := make(map[string]bool)
+	for _, vs := range values {
+		for i, v := range vs {
+			vs[i] = queryPlaceholder.ReplaceAllStringFunc(v, func(placeholder string) string {
+				name := queryPlaceholder.FindStringSubmatch(placeholder)[1]
+				if value, given := args[name]; given {
+					return value
+				}
+				if value, given := q.Defaults[name]; given {
+					return value
+				}
+				missing[name] = true
+				return placeholder
+			})
+		}
+	}
+	if len(missing) > 0 {
+		return DocumentQuery{}, fmt.Errorf("saved query %s is missing parameters: %s", q.Name, strings.Join(sortedKeys(missing), ", "))
+	}
+	return ParseDocumentQuery(values)
+}
+
+func decodeSavedQuery(doc Document) (*SavedQuery, error) {
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var q SavedQuery
+	if err := json.Unmarshal(encoded, &q); err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
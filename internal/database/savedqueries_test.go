@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSavedQueriesRunWithParameters(t *testing.T) {
+	db := newTestDatabase(t)
+	for id, doc := range map[string]Document{
+		"o1": {"user_id": "u1", "total": float64(10), "status": "paid"},
+		"o2": {"user_id": "u1", "total": float64(30), "status": "open"},
+		"o3": {"user_id": "u2", "total": float64(20), "status": "paid"},
+	} {
+		if err := db.InsertDocument("orders", id, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saved, err := db.SaveQuery(SavedQuery{
+		Name:       "orders_by_user",
+		Collection: "orders",
+		Query:      "user_id={{user}}&status={{status}}&_sort=-total&_fields=total",
+		Defaults:   map[string]string{"status": "paid"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(saved.Params, []string{"status", "user"}) {
+		t.Fatalf("params = %v", saved.Params)
+	}
+
+	docs, err := db.RunSavedQuery(context.Background(), "orders_by_user", map[string]string{"user": "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(docs, []Document{{"total": float64(10)}}) {
+		t.Fatalf("default status run = %v", docs)
+	}
+	docs, err = db.RunSavedQuery(context.Background(), "orders_by_user", map[string]string{"user": "u1", "status": "open"})
+	if err != nil || len(docs) != 1 || docs[0]["total"] != float64(30) {
+		t.Fatalf("open orders = %v, %v", docs, err)
+	}
+
+	if _, err := db.RunSavedQuery(context.Background(), "orders_by_user", nil); err == nil {
+		t.Fatal("expected an error for a missing parameter")
+	}
+	if _, err := db.RunSavedQuery(context.Background(), "orders_by_user", map[string]string{"user": "u1", "usr": "u2"}); err == nil {
+		t.Fatal("expected an error for an unknown parameter")
+	}
+	if _, err := db.SaveQuery(SavedQuery{Name: "bad", Collection: "orders", Query: "total:int=ten"}); err == nil {
+		t.Fatal("expected an error for a query that does not parse")
+	}
+
+	if queries := db.SavedQueries(); len(queries) != 1 || queries[0].Name != "orders_by_user" {
+		t.Fatalf("saved queries = %+v", queries)
+	}
+	if err := db.DeleteSavedQuery("orders_by_user"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.RunSavedQuery(context.Background(), "orders_by_user", nil); !errors.Is(err, ErrSavedQueryNotFound) {
+		t.Fatalf("run after delete: %v", err)
+	}
+}
@@ -0,0 +1,341 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// JobActionWebhook POSTs a JSON notification to Action.URL
+	JobActionWebhook = "webhook"
+	// JobActionEnqueue pushes Action.Payload onto the work queue Action.Queue, so a
+	// worker can run the job
+	JobActionEnqueue = "enqueue"
+
+	schedulerTick = time.Second
+)
+
+// JobAction is what a scheduled job does when it fires
+type JobAction struct {
+	Type    string      `json:"type"`
+	URL     string      `json:"url,omitempty"`
+	Queue   string      `json:"queue,omitempty"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+// Job is a cron-triggered action
+type Job struct {
+	ID        string     `json:"id"`
+	Schedule  string     `json:"schedule"`
+	Action    JobAction  `json:"action"`
+	Enabled   bool       `json:"enabled"`
+	CreatedAt time.Time  `json:"created_at"`
+	NextRun   *time.Time `json:"next_run,omitempty"`
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	Runs      int        `json:"runs"`
+
+	schedule *cronSchedule
+}
+
+// Scheduler runs cron-style jobs. Job definitions and their last results are
+// saved to a JSON file under DataDir so they survive restarts.
+type Scheduler struct {
+	db         *MultiModelDatabase
+	path       string
+	jobs       map[string]*Job
+	httpClient *http.Client
+	mutex      sync.Mutex
+}
+
+// newScheduler creates a scheduler persisting to path and loads saved jobs
+func newScheduler(db *MultiModelDatabase, path string) *Scheduler {
+	s := &Scheduler{
+		db:         db,
+		path:       path,
+		jobs:       make(map[string]*Job),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+	if err := s.load(); err != nil {
+		log.Printf("Failed to load scheduled jobs: %v", err)
+	}
+	return s
+}
+
+func (s *Scheduler) load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var jobs []*Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, job := range jobs {
+		schedule, err := parseCron(job.Schedule)
+		if err != nil {
+			log.Printf("Skipping job %s: %v", job.ID, err)
+			continue
+		}
+		job.schedule = schedule
+		job.NextRun = nextRun(schedule, now)
+		s.jobs[job.ID] = job
+	}
+	return nil
+}
+
+// save writes all jobs to disk. Callers must hold the scheduler mutex.
+func (s *Scheduler) save() error {
+	data, err := json.MarshalIndent(s.sortedJobs(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *Scheduler) sortedJobs() []*Job {
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs
+}
+
+func nextRun(schedule *cronSchedule, after time.Time) *time.Time {
+	next := schedule.Next(after)
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+func validateJobAction(action JobAction) error {
+	switch action.Type {
+	case JobActionWebhook:
+		if action.URL == "" {
+			return fmt.Errorf("webhook action requires a url")
+		}
+	case JobActionEnqueue:
+		if err := validateQueueName(action.Queue); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported job action %q (supported: %s, %s)", action.Type, JobActionWebhook, JobActionEnqueue)
+	}
+	return nil
+}
+
+// PutJob creates or replaces a job
+func (s *Scheduler) PutJob(id, schedule string, action JobAction, enabled bool) (*Job, error) {
+	if id == "" {
+		return nil, fmt.Errorf("job id must not be empty")
+	}
+	parsed, err := parseCron(schedule)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateJobAction(action); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job := &Job{
+		ID:        id,
+		Schedule:  schedule,
+		Action:    action,
+		Enabled:   enabled,
+		CreatedAt: time.Now().UTC(),
+		NextRun:   nextRun(parsed, time.Now()),
+		schedule:  parsed,
+	}
+	if existing, exists := s.jobs[id]; exists {
+		job.CreatedAt = existing.CreatedAt
+	}
+	s.jobs[id] = job
+
+	if err := s.save(); err != nil {
+		return nil, fmt.Errorf("failed to save jobs: %w", err)
+	}
+	copied := *job
+	return &copied, nil
+}
+
+// GetJob returns a job by id
+func (s *Scheduler) GetJob(id string) (*Job, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, exists := s.jobs[id]
+	if !exists {
+		return nil, fmt.Errorf("job %s not found", id)
+	}
+	copied := *job
+	return &copied, nil
+}
+
+// ListJobs returns all jobs ordered by id
+func (s *Scheduler) ListJobs() []Job {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.sortedJobs() {
+		jobs = append(jobs, *job)
+	}
+	return jobs
+}
+
+// DeleteJob removes a job
+func (s *Scheduler) DeleteJob(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.jobs[id]; !exists {
+		return fmt.Errorf("job %s not found", id)
+	}
+	delete(s.jobs, id)
+	return s.save()
+}
+
+// RunJob fires a job immediately, regardless of its schedule
+func (s *Scheduler) RunJob(id string) (*Job, error) {
+	s.mutex.Lock()
+	job, exists := s.jobs[id]
+	if !exists {
+		s.mutex.Unlock()
+		return nil, fmt.Errorf("job %s not found", id)
+	}
+	action := job.Action
+	s.mutex.Unlock()
+
+	s.finish(id, s.execute(id, action, time.Now().UTC()))
+	return s.GetJob(id)
+}
+
+// start fires due jobs until ctx is cancelled
+func (s *Scheduler) start(ctx context.Context) {
+	ticker := time.NewTicker(schedulerTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.runDue(now)
+		}
+	}
+}
+
+func (s *Scheduler) runDue(now time.Time) {
+	type dueJob struct {
+		id          string
+		action      JobAction
+		scheduledAt time.Time
+	}
+
+	s.mutex.Lock()
+	var due []dueJob
+	for _, job := range s.jobs {
+		if !job.Enabled || job.NextRun == nil || now.Before(*job.NextRun) {
+			continue
+		}
+		due = append(due, dueJob{job.ID, job.Action, *job.NextRun})
+		// Missed activations are not replayed; the job resumes from now
+		job.NextRun = nextRun(job.schedule, now)
+	}
+	s.mutex.Unlock()
+
+	for _, job := range due {
+		job := job
+		s.db.routines.spawn("job "+job.id, func() {
+			s.finish(job.id, s.execute(job.id, job.action, job.scheduledAt))
+		})
+	}
+}
+
+func (s *Scheduler) execute(id string, action JobAction, scheduledAt time.Time) error {
+	switch action.Type {
+	case JobActionEnqueue:
+		if s.db.ReadOnly().Enabled {
+			return ErrReadOnly
+		}
+		_, err := s.db.Queues.Enqueue(action.Queue, map[string]interface{}{
+			"job":          id,
+			"scheduled_at": scheduledAt,
+			"payload":      action.Payload,
+		})
+		return err
+	case JobActionWebhook:
+		body, err := json.Marshal(map[string]interface{}{
+			"job":          id,
+			"scheduled_at": scheduledAt,
+			"payload":      action.Payload,
+		})
+		if err != nil {
+			return err
+		}
+		// Bound by the database's lifetime, so Close does not wait out the timeout
+		req, err := http.NewRequestWithContext(s.db.ctx, "POST", action.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := s.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported job action %q", action.Type)
+}
+
+// finish records the result of a run
+func (s *Scheduler) finish(id string, runErr error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, exists := s.jobs[id]
+	if !exists {
+		return // deleted while running
+	}
+	now := time.Now().UTC()
+	job.LastRun = &now
+	job.Runs++
+	job.LastError = ""
+	if runErr != nil {
+		job.LastError = runErr.Error()
+		log.Printf("Scheduled job %s failed: %v", id, runErr)
+	}
+	if err := s.save(); err != nil {
+		log.Printf("Failed to save jobs: %v", err)
+	}
+}
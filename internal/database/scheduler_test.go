@@ -0,0 +1,122 @@
+package database
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fireDue runs the jobs due at their next run and waits until job id has recorded
+// its result
+func fireDue(t *testing.T, db *MultiModelDatabase, id string) *Job {
+	t.Helper()
+	job, err := db.Scheduler.GetJob(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := job.Runs
+	db.Scheduler.runDue(*job.NextRun)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, err = db.Scheduler.GetJob(id); err == nil && job.Runs > runs {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not record a run", id)
+	return nil
+}
+
+func TestDueJobsFire(t *testing.T) {
+	db := newTestDatabase(t)
+
+	if _, err := db.Scheduler.PutJob("report", "* * * * *", JobAction{Type: JobActionEnqueue, Queue: "reports", Payload: "weekly"}, true); err != nil {
+		t.Fatal(err)
+	}
+	// Disabled jobs are not due
+	if _, err := db.Scheduler.PutJob("paused", "* * * * *", JobAction{Type: JobActionEnqueue, Queue: "paused"}, false); err != nil {
+		t.Fatal(err)
+	}
+	job := fireDue(t, db, "report")
+	if job.Runs != 1 || job.LastRun == nil || job.LastError != "" || job.NextRun == nil {
+		t.Fatalf("recorded run = %+v", job)
+	}
+	messages, err := db.Queues.Dequeue("reports", 10, time.Minute)
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("enqueued = %+v, %v", messages, err)
+	}
+	if payload, ok := messages[0].Payload.(map[string]interface{}); !ok || payload["job"] != "report" || payload["payload"] != "weekly" {
+		t.Fatalf("enqueued payload = %#v", messages[0].Payload)
+	}
+	if messages, _ := db.Queues.Dequeue("paused", 10, time.Minute); len(messages) != 0 {
+		t.Fatalf("disabled job enqueued %+v", messages)
+	}
+
+	// Results are saved with the jobs
+	reloaded := newScheduler(db, db.Scheduler.path)
+	if saved, err := reloaded.GetJob("report"); err != nil || saved.Runs != 1 || saved.LastRun == nil {
+		t.Fatalf("saved job = %+v, %v", saved, err)
+	}
+}
+
+func TestDueWebhookJobsFire(t *testing.T) {
+	db := newTestDatabase(t)
+	received := make(chan map[string]interface{}, 1)
+	statuses := make(chan int, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&body) != nil {
+			t.Errorf("webhook received %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		received <- body
+		w.WriteHeader(<-statuses)
+	}))
+	defer hook.Close()
+
+	if _, err := db.Scheduler.PutJob("ping", "*/5 * * * *", JobAction{Type: JobActionWebhook, URL: hook.URL, Payload: map[string]interface{}{"n": 1}}, true); err != nil {
+		t.Fatal(err)
+	}
+	statuses <- http.StatusNoContent
+	job := fireDue(t, db, "ping")
+	body := <-received
+	if body["job"] != "ping" || body["scheduled_at"] == nil || job.LastError != "" {
+		t.Fatalf("webhook body %v, job %+v", body, job)
+	}
+
+	// Failed deliveries are recorded as the job's last error
+	statuses <- http.StatusBadGateway
+	job = fireDue(t, db, "ping")
+	<-received
+	if job.Runs != 2 || !strings.Contains(job.LastError, "502") {
+		t.Fatalf("failed run = %+v", job)
+	}
+}
+
+func TestCloseStopsRunningJobs(t *testing.T) {
+	db := newTestDatabase(t)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hook.Close()
+	if _, err := db.Scheduler.PutJob("slow", "* * * * *", JobAction{Type: JobActionWebhook, URL: hook.URL}, true); err != nil {
+		t.Fatal(err)
+	}
+	job, err := db.Scheduler.GetJob("slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Scheduler.runDue(*job.NextRun)
+
+	// The webhook is cancelled, and its result recorded, before Close returns
+	start := time.Now()
+	db.Close()
+	if elapsed := time.Since(start); elapsed > stopTimeout {
+		t.Fatalf("Close took %s", elapsed)
+	}
+	if job, err := db.Scheduler.GetJob("slow"); err != nil || job.Runs != 1 || !strings.Contains(job.LastError, "context canceled") {
+		t.Fatalf("job after Close = %+v, %v", job, err)
+	}
+}
@@ -0,0 +1,235 @@
+package database
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Inferred field types, named as in JSON Schema
+const (
+	SchemaString  = "string"
+	SchemaInteger = "integer"
+	SchemaNumber  = "number"
+	SchemaBoolean = "boolean"
+	SchemaObject  = "object"
+	SchemaArray   = "array"
+	SchemaNull    = "null"
+)
+
+// DefaultSchemaSample is the number of documents sampled to infer a schema when no
+// sample size is given
+const DefaultSchemaSample = 1000
+
+// FieldSchema describes a field as found in the sampled documents
+type FieldSchema struct {
+	Types    map[string]int          `json:"types"`              // values of each type
+	Count    int                     `json:"count"`              // values found
+	Presence float64                 `json:"presence,omitempty"` // share of the enclosing objects holding the field
+	Fields   map[string]*FieldSchema `json:"fields,omitempty"`   // fields of object values
+	Items    *FieldSchema            `json:"items,omitempty"`    // elements of array values
+}
+
+// CollectionSchema is the schema inferred from a sample of a collection's documents
+type CollectionSchema struct {
+	Collection string                  `json:"collection"`
+	Documents  int                     `json:"documents"` // in the collection
+	Sampled    int                     `json:"sampled"`
+	Fields     map[string]*FieldSchema `json:"fields"`
+}
+
+// InferSchema samples up to sample documents of collection, all of them when sample
+// is not positive, and returns the fields found with their types and how often
+// they are present
+func (db *MultiModelDatabase) InferSchema(ctx context.Context, collection string, sample int) (*CollectionSchema, error) {
+	if err := db.warmCollection(collection); err != nil {
+		return nil, err
+	}
+
+	db.docMutex.RLock()
+	defer db.docMutex.RUnlock()
+
+	prefix := collection + "."
+	var keys []string
+	check := cancelCheck{ctx: ctx}
+	for key := range db.documents {
+		if err := check.err(); err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	if a := db.archived(collection); a != nil {
+		return inferArchiveSchema(check, a, sample)
+	}
+
+	schema := &CollectionSchema{Collection: collection, Documents: len(keys), Fields: make(map[string]*FieldSchema)}
+	if sample > 0 && len(keys) > sample {
+		rand.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+		keys = keys[:sample]
+	}
+	schema.Sampled = len(keys)
+	for _, key := range keys {
+		if err := check.err(); err != nil {
+			return nil, err
+		}
+		inferFields(schema.Fields, db.expandDocument(db.documents[key]))
+	}
+	setPresence(schema.Fields, schema.Sampled)
+	return schema, nil
+}
+
+// inferArchiveSchema samples the documents of an archived collection as InferSchema
+// does, decoding only the sampled ones
+func inferArchiveSchema(check cancelCheck, a *archive, sample int) (*CollectionSchema, error) {
+	schema := &CollectionSchema{Collection: a.info.Collection, Documents: a.len(), Fields: make(map[string]*FieldSchema)}
+	positions := rand.Perm(a.len())
+	if sample > 0 && len(positions) > sample {
+		positions = positions[:sample]
+	}
+	schema.Sampled = len(positions)
+	for _, i := range positions {
+		if err := check.err(); err != nil {
+			return nil, err
+		}
+		_, doc, err := a.document(i)
+		if err != nil {
+			return nil, err
+		}
+		inferFields(schema.Fields, doc)
+	}
+	setPresence(schema.Fields, schema.Sampled)
+	return schema, nil
+}
+
+// inferFields adds the fields of an object value to fields
+func inferFields(fields map[string]*FieldSchema, object map[string]interface{}) {
+	for name, value := range object {
+		field, exists := fields[name]
+		if !exists {
+			field = &FieldSchema{Types: make(map[string]int)}
+			fields[name] = field
+		}
+		field.add(value)
+	}
+}
+
+// add records one value of the field
+func (f *FieldSchema) add(value interface{}) {
+	f.Count++
+	kind := schemaType(value)
+	f.Types[kind]++
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if f.Fields == nil {
+			f.Fields = make(map[string]*FieldSchema)
+		}
+		inferFields(f.Fields, v)
+	case Document:
+		if f.Fields == nil {
+			f.Fields = make(map[string]*FieldSchema)
+		}
+		inferFields(f.Fields, v)
+	case []interface{}:
+		if f.Items == nil {
+			f.Items = &FieldSchema{Types: make(map[string]int)}
+		}
+		for _, element := range v {
+			f.Items.add(element)
+		}
+	}
+}
+
+// setPresence sets the presence of fields found in total enclosing objects, and of
+// their nested fields
+func setPresence(fields map[string]*FieldSchema, total int) {
+	for _, field := range fields {
+		if total > 0 {
+			field.Presence = float64(field.Count) / float64(total)
+		}
+		field.nested()
+	}
+}
+
+func (f *FieldSchema) nested() {
+	if f.Fields != nil {
+		setPresence(f.Fields, f.Types[SchemaObject])
+	}
+	if f.Items != nil {
+		f.Items.nested()
+	}
+}
+
+// schemaType returns the JSON Schema type of a decoded JSON value
+func schemaType(value interface{}) string {
+	switch exportType(value) {
+	case "":
+		return SchemaNull
+	case ExportBoolean:
+		return SchemaBoolean
+	case ExportInt64:
+		return SchemaInteger
+	case ExportDouble:
+		return SchemaNumber
+	case ExportString:
+		return SchemaString
+	}
+	switch value.(type) {
+	case []interface{}:
+		return SchemaArray
+	default:
+		return SchemaObject
+	}
+}
+
+// JSONSchema returns the inferred schema as a JSON Schema document that can seed a
+// validator. Fields present in every sampled document are required.
+func (s *CollectionSchema) JSONSchema() map[string]interface{} {
+	schema := objectJSONSchema(s.Fields)
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = s.Collection
+	return schema
+}
+
+func objectJSONSchema(fields map[string]*FieldSchema) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := make([]string, 0)
+	for _, name := range sortedKeys(fields) {
+		properties[name] = fields[name].jsonSchema()
+		if fields[name].Presence == 1 {
+			required = append(required, name)
+		}
+	}
+	return map[string]interface{}{"type": SchemaObject, "properties": properties, "required": required}
+}
+
+func (f *FieldSchema) jsonSchema() map[string]interface{} {
+	schema := make(map[string]interface{})
+	if f.Fields != nil {
+		schema = objectJSONSchema(f.Fields)
+	}
+	if f.Items != nil {
+		schema["items"] = f.Items.jsonSchema()
+	}
+
+	types := make([]string, 0, len(f.Types))
+	for kind := range f.Types {
+		// Integers are numbers, so a field holding both is a number
+		if kind == SchemaInteger && f.Types[SchemaNumber] > 0 {
+			continue
+		}
+		types = append(types, kind)
+	}
+	sort.Strings(types)
+	switch len(types) {
+	case 0:
+	case 1:
+		schema["type"] = types[0]
+	default:
+		schema["type"] = types
+	}
+	return schema
+}
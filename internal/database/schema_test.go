@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestInferSchemaReportsTypesAndPresence(t *testing.T) {
+	db := newTestDatabase(t)
+	docs := map[string]Document{
+		"a": {"name": "ann", "age": float64(30), "address": map[string]interface{}{"city": "Oslo", "zip": "0150"}, "tags": []interface{}{"x", float64(1)}},
+		"b": {"name": "bob", "age": 41.5, "address": map[string]interface{}{"city": "Bergen"}},
+		"c": {"name": "cy", "age": nil},
+		"d": {"name": "dee", "age": float64(7)},
+	}
+	for id, doc := range docs {
+		if err := db.InsertDocument("people", id, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.InsertDocument("people2", "e", Document{"other": true}); err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := db.InferSchema(context.Background(), "people", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Documents != 4 || schema.Sampled != 4 || len(schema.Fields) != 4 {
+		t.Fatalf("schema = %+v", schema)
+	}
+	age := schema.Fields["age"]
+	if !reflect.DeepEqual(age.Types, map[string]int{SchemaInteger: 2, SchemaNumber: 1, SchemaNull: 1}) || age.Presence != 1 {
+		t.Fatalf("age = %+v", age)
+	}
+	address := schema.Fields["address"]
+	if address.Presence != 0.5 || address.Fields["city"].Presence != 1 || address.Fields["zip"].Presence != 0.5 {
+		t.Fatalf("address = %+v", address)
+	}
+	if items := schema.Fields["tags"].Items; !reflect.DeepEqual(items.Types, map[string]int{SchemaString: 1, SchemaInteger: 1}) {
+		t.Fatalf("tags items = %+v", items)
+	}
+
+	sampled, err := db.InferSchema(context.Background(), "people", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sampled.Documents != 4 || sampled.Sampled != 2 || sampled.Fields["name"].Presence != 1 {
+		t.Fatalf("sampled = %+v", sampled)
+	}
+
+	jsonSchema := schema.JSONSchema()
+	if !reflect.DeepEqual(jsonSchema["required"], []string{"age", "name"}) {
+		t.Fatalf("required = %v", jsonSchema["required"])
+	}
+	properties := jsonSchema["properties"].(map[string]interface{})
+	if got := properties["age"].(map[string]interface{})["type"]; !reflect.DeepEqual(got, []string{SchemaNull, SchemaNumber}) {
+		t.Fatalf("age type = %v", got)
+	}
+	city := properties["address"].(map[string]interface{})["properties"].(map[string]interface{})["city"]
+	if !reflect.DeepEqual(city, map[string]interface{}{"type": SchemaString}) {
+		t.Fatalf("city = %v", city)
+	}
+}
@@ -0,0 +1,274 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Search limits, the default and the largest number of hits returned
+const (
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 1000
+)
+
+// searchSnippetLength is the number of characters of a matching value a hit quotes
+const searchSnippetLength = 120
+
+// SearchHit is a match of a global search. Namespace is the collection, bucket or
+// column family, "nodes" for the graph, and Key the document id, KV key, row key or
+// node id. Field names the document field or node property holding the match,
+// quoted in Snippet; it is empty for matching keys.
+type SearchHit struct {
+	Model     Model  `json:"model"`
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+	Field     string `json:"field,omitempty"`
+	Snippet   string `json:"snippet"`
+}
+
+// SearchResult holds the hits of a search in model order: documents, KV keys,
+// column rows and graph nodes. Truncated is set when the limit cut the hits short.
+type SearchResult struct {
+	Query     string      `json:"query"`
+	Hits      []SearchHit `json:"hits"`
+	Truncated bool        `json:"truncated"`
+}
+
+// Search looks for text across the models at once, for a search bar that does not
+// know where the data lives:
+//
+//   - documents whose fields under a trigram index contain text, compared with the
+//     index collation; text needs three characters or more to use the indexes
+//   - KV keys, except in buckets protected by an access token
+//   - column row keys
+//   - graph nodes whose id or string properties contain text
+//
+// Keys and node properties are compared case-insensitively. Collections and column
+// families whose query hooks reject the query are left out, and the filters the
+// hooks add to document queries apply to the hits.
+func (db *MultiModelDatabase) Search(ctx context.Context, text string, limit int) (*SearchResult, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("search text must not be empty")
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	s := &search{text: text, folded: strings.ToLower(text), limit: limit, check: cancelCheck{ctx: ctx}}
+	s.result = &SearchResult{Query: text, Hits: make([]SearchHit, 0)}
+	for _, searchModel := range []func(*search) error{db.searchDocuments, db.searchKeys, db.searchRows, db.searchNodes} {
+		if err := searchModel(s); err != nil {
+			return nil, err
+		}
+		if s.result.Truncated {
+			break
+		}
+	}
+	return s.result, nil
+}
+
+// search is the state of a running search
+type search struct {
+	text   string
+	folded string // lower cased text, for case-insensitive matches
+	limit  int
+	check  cancelCheck
+	result *SearchResult
+}
+
+// add records a hit, reporting false once the limit is reached
+func (s *search) add(hit SearchHit) bool {
+	if len(s.result.Hits) == s.limit {
+		s.result.Truncated = true
+		return false
+	}
+	if utf8.RuneCountInString(hit.Snippet) > searchSnippetLength {
+		hit.Snippet = string([]rune(hit.Snippet)[:searchSnippetLength]) + "…"
+	}
+	s.result.Hits = append(s.result.Hits, hit)
+	return true
+}
+
+// matches reports whether value contains the text, ignoring case
+func (s *search) matches(value string) bool {
+	return strings.Contains(strings.ToLower(value), s.folded)
+}
+
+// searchDocuments looks the text up in the trigram indexes
+func (db *MultiModelDatabase) searchDocuments(s *search) error {
+	if utf8.RuneCountInString(s.text) < 3 {
+		return nil
+	}
+	db.indexes.mutex.RLock()
+	var indexes []*documentIndex
+	for _, index := range db.indexes.indexes {
+		if index.spec.Type == IndexTrigram {
+			indexes = append(indexes, index)
+		}
+	}
+	db.indexes.mutex.RUnlock()
+	sort.Slice(indexes, func(i, j int) bool {
+		a, b := indexes[i].spec, indexes[j].spec
+		return a.Collection < b.Collection || a.Collection == b.Collection && a.Field < b.Field
+	})
+
+	pattern := regexp.QuoteMeta(s.text)
+	for _, index := range indexes {
+		spec := index.spec
+		event := &QueryEvent{Model: ModelDocument, Namespace: spec.Collection, Filter: map[string]interface{}{}}
+		if err := db.beforeQuery(event); err != nil {
+			continue
+		}
+		folded := spec.Collation.fold(s.text)
+		ids, _, _ := index.findPattern(db, map[string]interface{}{OpRegex: pattern})
+		ids = append([]string(nil), ids...)
+		sort.Strings(ids)
+		for _, id := range ids {
+			if err := s.check.err(); err != nil {
+				return err
+			}
+			doc, err := db.GetDocument(spec.Collection, id)
+			if err != nil {
+				continue
+			}
+			if len(event.Filter) > 0 && !spec.Collation.objectMatches(doc, event.Filter) {
+				continue
+			}
+			value, _ := lookupPath(doc, spec.Field)
+			values, isArray := value.([]interface{})
+			if !isArray {
+				values = []interface{}{value}
+			}
+			for _, v := range values {
+				str, isString := v.(string)
+				if !isString || !strings.Contains(spec.Collation.fold(str), folded) {
+					continue
+				}
+				if !s.add(SearchHit{Model: ModelDocument, Namespace: spec.Collection, Key: id, Field: spec.Field, Snippet: str}) {
+					return nil
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// searchKeys looks the text up in the keys of the buckets anyone may read
+func (db *MultiModelDatabase) searchKeys(s *search) error {
+	db.kvMutex.RLock()
+	defer db.kvMutex.RUnlock()
+
+	now := time.Now()
+	for _, bucket := range sortedKeys(db.kvBuckets) {
+		b := db.kvBuckets[bucket]
+		if b.options.AccessToken != "" {
+			continue
+		}
+		var keys []string
+		for key, entry := range b.entries {
+			if err := s.check.err(); err != nil {
+				return err
+			}
+			if !entry.expired(now) && s.matches(key) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !s.add(SearchHit{Model: ModelKeyValue, Namespace: bucket, Key: key, Snippet: key}) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// searchRows looks the text up in the row keys of the column families, tiered rows
+// included
+func (db *MultiModelDatabase) searchRows(s *search) error {
+	db.colMutex.RLock()
+	families := sortedKeys(db.columnFamilies)
+	db.colMutex.RUnlock()
+
+	for _, family := range families {
+		if err := db.beforeQuery(&QueryEvent{Model: ModelColumn, Namespace: family, Scan: &ColumnScan{}}); err != nil {
+			continue
+		}
+		keys, err := db.matchingRows(s, family)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if !s.add(SearchHit{Model: ModelColumn, Namespace: family, Key: key, Snippet: key}) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// matchingRows returns the row keys of family containing the text, in order
+func (db *MultiModelDatabase) matchingRows(s *search, family string) ([]string, error) {
+	db.colMutex.RLock()
+	defer db.colMutex.RUnlock()
+
+	cf, exists := db.columnFamilies[family]
+	if !exists {
+		return nil, nil
+	}
+	var keys []string
+	var err error
+	cf.rows.Ascend("", "", func(key string, row map[string]interface{}) bool {
+		if err = s.check.err(); err != nil {
+			return false
+		}
+		if s.matches(key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	for key := range cf.cold {
+		if s.matches(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, err
+}
+
+// searchNodes looks the text up in the ids and string properties of graph nodes
+func (db *MultiModelDatabase) searchNodes(s *search) error {
+	db.graphMutex.RLock()
+	defer db.graphMutex.RUnlock()
+
+	for _, id := range sortedKeys(db.graphNodes) {
+		if err := s.check.err(); err != nil {
+			return err
+		}
+		node := db.graphNodes[id]
+		hit := SearchHit{Model: ModelGraph, Namespace: "nodes", Key: id}
+		if s.matches(id) {
+			hit.Snippet = id
+		} else {
+			for _, prop := range sortedKeys(node.Props) {
+				if value, isString := node.Props[prop].(string); isString && s.matches(value) {
+					hit.Field, hit.Snippet = prop, value
+					break
+				}
+			}
+		}
+		if hit.Snippet != "" && !s.add(hit) {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+	if err := db.InsertDocument("customers", "c1", Document{"name": "Ada Lovelace"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertDocument("customers", "c2", Document{"name": "Grace Hopper"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateIndex(IndexSpec{Collection: "customers", Field: "name", Type: IndexTrigram, Collation: Collation{CaseInsensitive: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetKeyValue("session:lovelace", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertColumn("metrics", "host-lovelace", "cpu", 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateNode("n1", []string{"Person"}, map[string]interface{}{"name": "Ada LOVELACE"}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := db.Search(ctx, "lovelace", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []SearchHit{
+		{Model: ModelDocument, Namespace: "customers", Key: "c1", Field: "name", Snippet: "Ada Lovelace"},
+		{Model: ModelKeyValue, Namespace: DefaultBucket, Key: "session:lovelace", Snippet: "session:lovelace"},
+		{Model: ModelColumn, Namespace: "metrics", Key: "host-lovelace", Snippet: "host-lovelace"},
+		{Model: ModelGraph, Namespace: "nodes", Key: "n1", Field: "name", Snippet: "Ada LOVELACE"},
+	}
+	if len(result.Hits) != len(expected) || result.Truncated {
+		t.Fatalf("hits = %+v", result)
+	}
+	for i, hit := range expected {
+		if result.Hits[i] != hit {
+			t.Fatalf("hit %d = %+v, expected %+v", i, result.Hits[i], hit)
+		}
+	}
+
+	// The limit cuts the hits short
+	if result, err := db.Search(ctx, "lovelace", 2); err != nil || len(result.Hits) != 2 || !result.Truncated {
+		t.Fatalf("limited = %+v, %v", result, err)
+	}
+	if _, err := db.Search(ctx, " ", 0); err == nil {
+		t.Fatal("empty search accepted")
+	}
+}
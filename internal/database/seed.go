@@ -0,0 +1,256 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxSeedErrors is the number of errors reported per fixture file; further errors
+// are only counted
+const maxSeedErrors = 20
+
+// SeedResult reports the fixtures loaded from a directory
+type SeedResult struct {
+	Dir     string     `json:"dir"`
+	Loaded  int        `json:"loaded"`
+	Skipped int        `json:"skipped"` // items already stored, which fixtures never overwrite
+	Failed  int        `json:"failed"`
+	Files   []SeedFile `json:"files"`
+}
+
+// SeedFile reports the items of one fixture file
+type SeedFile struct {
+	File      string   `json:"file"` // relative to the seed directory
+	Model     Model    `json:"model"`
+	Namespace string   `json:"namespace,omitempty"` // collection or bucket
+	Loaded    int      `json:"loaded"`
+	Skipped   int      `json:"skipped"`
+	Failed    int      `json:"failed"`
+	Errors    []string `json:"errors,omitempty"` // the first failures, by line or item
+}
+
+// graphDump is the content of a graph fixture file
+type graphDump struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// Seed loads the fixture files under dir, laid out as
+//
+//	docs/<collection>.ndjson   one document per line, stored under its _id or a generated id
+//	kv/<bucket>.ndjson         one {"key": ..., "value": ...} pair per line
+//	graph/<name>.json          {"nodes": [...], "edges": [...]}
+//
+// Files are loaded in that order and by name within each directory, and the nodes of
+// every graph file before their edges, so edges may reference nodes of other files.
+// Items go through the regular write path, hooks included. Items that already exist
+// are skipped rather than overwritten, so seeding the same directory again is a no-op.
+// A malformed line or item fails on its own and is reported with its file.
+func (db *MultiModelDatabase) Seed(dir string) (*SeedResult, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("seed path %s is not a directory", dir)
+	}
+
+	result := &SeedResult{Dir: dir, Files: make([]SeedFile, 0)}
+	docFiles, err := seedFiles(dir, "docs", ".ndjson")
+	if err != nil {
+		return nil, err
+	}
+	kvFiles, err := seedFiles(dir, "kv", ".ndjson")
+	if err != nil {
+		return nil, err
+	}
+	graphFiles, err := seedFiles(dir, "graph", ".json")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range docFiles {
+		file := SeedFile{File: filepath.Join("docs", name), Model: ModelDocument, Namespace: strings.TrimSuffix(name, ".ndjson")}
+		if err := ValidateCollectionName(file.Namespace); err != nil {
+			file.fail(err)
+		} else {
+			file.readLines(dir, func(line []byte) (bool, error) {
+				return db.seedDocument(file.Namespace, line)
+			})
+		}
+		result.add(file)
+	}
+	for _, name := range kvFiles {
+		file := SeedFile{File: filepath.Join("kv", name), Model: ModelKeyValue, Namespace: strings.TrimSuffix(name, ".ndjson")}
+		if err := ValidateBucketName(file.Namespace); err != nil {
+			file.fail(err)
+		} else {
+			file.readLines(dir, func(line []byte) (bool, error) {
+				return db.seedPair(file.Namespace, line)
+			})
+		}
+		result.add(file)
+	}
+
+	files := make([]SeedFile, len(graphFiles))
+	dumps := make([]graphDump, len(graphFiles))
+	for i, name := range graphFiles {
+		files[i] = SeedFile{File: filepath.Join("graph", name), Model: ModelGraph}
+		data, err := os.ReadFile(filepath.Join(dir, files[i].File))
+		if err == nil {
+			err = DecodeJSON(data, &dumps[i])
+		}
+		if err != nil {
+			files[i].fail(err)
+			continue
+		}
+		for _, node := range dumps[i].Nodes {
+			loaded, err := db.seedNode(node)
+			files[i].record(fmt.Sprintf("node %s", node.ID), loaded, err)
+		}
+	}
+	for i := range files {
+		for _, edge := range dumps[i].Edges {
+			loaded, err := db.seedEdge(edge)
+			files[i].record(fmt.Sprintf("edge %s", edge.ID), loaded, err)
+		}
+		result.add(files[i])
+	}
+	return result, nil
+}
+
+// seedFiles returns the names of the files with extension in dir/sub, sorted, or none
+// if the directory does not exist
+func seedFiles(dir, sub, extension string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, sub))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), extension) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// seedDocument inserts the document of an NDJSON line, reporting whether it was stored
+func (db *MultiModelDatabase) seedDocument(collection string, line []byte) (bool, error) {
+	var doc Document
+	if err := DecodeJSON(line, &doc); err != nil {
+		return false, err
+	}
+	ids, bodies, err := documentIDs([]Document{doc})
+	if err != nil {
+		return false, err
+	}
+	err = db.InsertDocument(collection, ids[0], bodies[0])
+	if errors.Is(err, ErrDocumentExists) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// seedPair stores the pair of an NDJSON line unless its key exists
+func (db *MultiModelDatabase) seedPair(bucket string, line []byte) (bool, error) {
+	var pair KeyValue
+	if err := DecodeJSON(line, &pair); err != nil {
+		return false, err
+	}
+	if pair.Key == "" {
+		return false, fmt.Errorf("pair has an empty key")
+	}
+	_, err := db.PutBucketValue(bucket, pair.Key, pair.Value, PutOptions{IfAbsent: true})
+	if errors.Is(err, ErrKeyExists) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (db *MultiModelDatabase) seedNode(node GraphNode) (bool, error) {
+	if node.ID == "" {
+		return false, fmt.Errorf("node has an empty id")
+	}
+	if _, err := db.GetNode(node.ID); err == nil {
+		return false, nil
+	}
+	err := db.CreateNode(node.ID, node.Labels, node.Props)
+	return err == nil, err
+}
+
+func (db *MultiModelDatabase) seedEdge(edge GraphEdge) (bool, error) {
+	if edge.ID == "" {
+		return false, fmt.Errorf("edge has an empty id")
+	}
+	if _, err := db.GetEdge(edge.ID); err == nil {
+		return false, nil
+	}
+	err := db.CreateEdge(edge.ID, edge.From, edge.To, edge.Type, edge.Props)
+	return err == nil, err
+}
+
+// readLines calls load with every non-blank line of the file, recording its outcome
+func (f *SeedFile) readLines(dir string, load func(line []byte) (bool, error)) {
+	file, err := os.Open(filepath.Join(dir, f.File))
+	if err != nil {
+		f.fail(err)
+		return
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for number := 1; ; number++ {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			loaded, loadErr := load(line)
+			f.record(fmt.Sprintf("line %d", number), loaded, loadErr)
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			f.fail(err)
+			return
+		}
+	}
+}
+
+// record counts the outcome of loading the item at position
+func (f *SeedFile) record(position string, loaded bool, err error) {
+	switch {
+	case err != nil:
+		f.Failed++
+		if len(f.Errors) < maxSeedErrors {
+			f.Errors = append(f.Errors, fmt.Sprintf("%s: %v", position, err))
+		}
+	case loaded:
+		f.Loaded++
+	default:
+		f.Skipped++
+	}
+}
+
+// fail records an error that stopped the whole file
+func (f *SeedFile) fail(err error) {
+	f.Failed++
+	f.Errors = append(f.Errors, err.Error())
+}
+
+func (r *SeedResult) add(file SeedFile) {
+	r.Loaded += file.Loaded
+	r.Skipped += file.Skipped
+	r.Failed += file.Failed
+	r.Files = append(r.Files, file)
+}
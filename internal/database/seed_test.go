@@ -0,0 +1,71 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFixture(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSeedLoadsFixturesOnce(t *testing.T) {
+	dir := t.TempDir()
+	writeFixture(t, dir, "docs/users.ndjson", `{"_id": "ada", "name": "Ada"}
+
+{"name": "generated"}
+{not json}
+`)
+	writeFixture(t, dir, "kv/settings.ndjson", `{"key": "theme", "value": "dark"}`)
+	// Edges may reference nodes of files loaded after them
+	writeFixture(t, dir, "graph/a.json", `{"edges": [{"id": "e1", "from": "ada", "to": "bob", "type": "knows"}]}`)
+	writeFixture(t, dir, "graph/b.json", `{"nodes": [{"id": "ada", "labels": ["person"]}, {"id": "bob"}]}`)
+
+	db := newTestDatabase(t)
+	result, err := db.Seed(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Loaded != 6 || result.Failed != 1 || result.Skipped != 0 {
+		t.Fatalf("result = %+v", result)
+	}
+	if users := result.Files[0]; users.Namespace != "users" || len(users.Errors) != 1 || users.Errors[0][:7] != "line 4:" {
+		t.Fatalf("users file = %+v", users)
+	}
+	if doc, err := db.GetDocument("users", "ada"); err != nil || doc["name"] != "Ada" || doc[IDField] != nil {
+		t.Fatalf("ada = %v, %v", doc, err)
+	}
+	if value, err := db.GetBucketValue("settings", "theme"); err != nil || value != "dark" {
+		t.Fatalf("theme = %v, %v", value, err)
+	}
+	if edge, err := db.GetEdge("e1"); err != nil || edge.To != "bob" {
+		t.Fatalf("e1 = %+v, %v", edge, err)
+	}
+
+	// Seeding again keeps what is stored, only the generated document is new
+	if err := db.UpdateDocument("users", "ada", Document{"name": "Ada Lovelace"}); err != nil {
+		t.Fatal(err)
+	}
+	result, err = db.Seed(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Loaded != 1 || result.Skipped != 5 {
+		t.Fatalf("reseed result = %+v", result)
+	}
+	if doc, _ := db.GetDocument("users", "ada"); doc["name"] != "Ada Lovelace" {
+		t.Fatalf("seeding overwrote ada: %v", doc)
+	}
+
+	if _, err := db.Seed(filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("missing seed directory accepted")
+	}
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+const (
+	// sessionBucket is the reserved KV bucket holding web sessions
+	sessionBucket = "_sessions"
+
+	// DefaultSessionTTL applies to sessions created without an explicit TTL
+	DefaultSessionTTL = 30 * time.Minute
+)
+
+// Session is a web session stored in the key-value store with a sliding expiry
+type Session struct {
+	ID         string                 `json:"id"`
+	Data       map[string]interface{} `json:"data"`
+	TTLSeconds int                    `json:"ttl_seconds"`
+	CreatedAt  time.Time              `json:"created_at"`
+	ExpiresAt  time.Time              `json:"expires_at"`
+}
+
+func generateSessionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate session id: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// CreateSession stores a new session that expires after ttl without activity
+func (db *MultiModelDatabase) CreateSession(data map[string]interface{}, ttl time.Duration) (*Session, error) {
+	if ttl == 0 {
+		ttl = DefaultSessionTTL
+	}
+	if ttl < time.Second {
+		return nil, fmt.Errorf("session ttl must be at least one second")
+	}
+
+	id, err := generateSessionID()
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+
+	now := time.Now().UTC()
+	session := &Session{
+		ID:         id,
+		Data:       data,
+		TTLSeconds: int(ttl / time.Second),
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	if _, err := db.putBucketValue(sessionBucket, id, session, PutOptions{TTL: ttl, IfAbsent: true}); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetSession returns a live session without extending it
+func (db *MultiModelDatabase) GetSession(id string) (*Session, error) {
+	item, err := db.GetBucketItem(sessionBucket, id)
+	if err != nil {
+		return nil, fmt.Errorf("session %s not found", id)
+	}
+	return sessionFromItem(item), nil
+}
+
+// TouchSession extends a live session by its TTL from now
+func (db *MultiModelDatabase) TouchSession(id string) (*Session, error) {
+	session, err := db.GetSession(id)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := db.TouchBucketKey(sessionBucket, id, time.Duration(session.TTLSeconds)*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("session %s not found", id)
+	}
+	return sessionFromItem(item), nil
+}
+
+// DestroySession deletes a session
+func (db *MultiModelDatabase) DestroySession(id string) error {
+	if err := db.DeleteBucketKey(sessionBucket, id); err != nil {
+		return fmt.Errorf("session %s not found", id)
+	}
+	return nil
+}
+
+// sessionFromItem copies a stored session, taking the expiry from the KV entry since
+// touches update the entry rather than the stored value
+func sessionFromItem(item *KVItem) *Session {
+	stored := item.Value.(*Session)
+	session := *stored
+	if item.ExpiresAt != nil {
+		session.ExpiresAt = item.ExpiresAt.UTC()
+	}
+	return &session
+}
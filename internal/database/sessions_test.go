@@ -0,0 +1,67 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionSlidingExpiry(t *testing.T) {
+	db := newTestDatabase(t)
+	if _, err := db.CreateSession(nil, 500*time.Millisecond); err == nil {
+		t.Fatal("session shorter than a second created")
+	}
+	session, err := db.CreateSession(map[string]interface{}{"user": "ann"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.TTLSeconds != 60 || session.Data["user"] != "ann" {
+		t.Fatalf("created session = %+v", session)
+	}
+	defaulted, err := db.CreateSession(nil, 0)
+	if err != nil || defaulted.TTLSeconds != int(DefaultSessionTTL/time.Second) || defaulted.ID == session.ID {
+		t.Fatalf("session with the default ttl = %+v, %v", defaulted, err)
+	}
+
+	// Reading a session leaves its expiry alone; touching it slides it forward
+	expireSessionIn(db, session.ID, 10*time.Second)
+	read, err := db.GetSession(session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Until(read.ExpiresAt) > 10*time.Second {
+		t.Fatalf("read extended the session to %v", read.ExpiresAt)
+	}
+	touched, err := db.TouchSession(session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left := time.Until(touched.ExpiresAt); left < 50*time.Second || touched.CreatedAt != session.CreatedAt {
+		t.Fatalf("touched session = %+v, %v left", touched, left)
+	}
+
+	// A lapsed session can be neither read nor touched back to life
+	expireSessionIn(db, session.ID, -time.Millisecond)
+	if _, err := db.GetSession(session.ID); err == nil {
+		t.Fatal("expired session read")
+	}
+	if _, err := db.TouchSession(session.ID); err == nil {
+		t.Fatal("expired session touched")
+	}
+
+	if err := db.DestroySession(defaulted.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetSession(defaulted.ID); err == nil {
+		t.Fatal("destroyed session read")
+	}
+	if err := db.DestroySession(defaulted.ID); err == nil {
+		t.Fatal("session destroyed twice")
+	}
+}
+
+// expireSessionIn moves the expiry of a stored session to d from now
+func expireSessionIn(db *MultiModelDatabase, id string, d time.Duration) {
+	db.kvMutex.Lock()
+	defer db.kvMutex.Unlock()
+	db.kvBuckets[sessionBucket].entries[id].expiresAt = time.Now().Add(d)
+}
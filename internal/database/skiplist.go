@@ -0,0 +1,146 @@
+package database
+
+import (
+	"math/rand"
+)
+
+const (
+	skipListMaxLevel    = 24
+	skipListProbability = 0.25
+)
+
+// skipListNode is a single row in a skip list, linked at one or more levels
+type skipListNode struct {
+	key   string
+	value map[string]interface{}
+	next  []*skipListNode
+}
+
+// skipList keeps column family rows ordered by row key so range and prefix scans
+// can seek to their start key and walk forward instead of sorting the whole family.
+// It is not safe for concurrent use; callers hold the column store mutex.
+type skipList struct {
+	head   *skipListNode
+	level  int
+	length int
+	rng    *rand.Rand
+}
+
+func newSkipList() *skipList {
+	return &skipList{
+		head:  &skipListNode{next: make([]*skipListNode, skipListMaxLevel)},
+		level: 1,
+		// A fixed seed keeps the tower layout, and therefore scan cost, reproducible
+		rng: rand.New(rand.NewSource(1)),
+	}
+}
+
+func (s *skipList) randomLevel() int {
+	level := 1
+	for level < skipListMaxLevel && s.rng.Float64() < skipListProbability {
+		level++
+	}
+	return level
+}
+
+// findPredecessors returns, for every level, the last node whose key is before key
+func (s *skipList) findPredecessors(key string) []*skipListNode {
+	update := make([]*skipListNode, skipListMaxLevel)
+	node := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && node.next[i].key < key {
+			node = node.next[i]
+		}
+		update[i] = node
+	}
+	return update
+}
+
+// Get returns the row stored under key
+func (s *skipList) Get(key string) (map[string]interface{}, bool) {
+	node := s.seek(key)
+	if node != nil && node.key == key {
+		return node.value, true
+	}
+	return nil, false
+}
+
+// GetOrCreate returns the row stored under key, inserting an empty row if it is missing
+func (s *skipList) GetOrCreate(key string) map[string]interface{} {
+	update := s.findPredecessors(key)
+	if next := update[0].next[0]; next != nil && next.key == key {
+		return next.value
+	}
+
+	level := s.randomLevel()
+	if level > s.level {
+		for i := s.level; i < level; i++ {
+			update[i] = s.head
+		}
+		s.level = level
+	}
+
+	node := &skipListNode{
+		key:   key,
+		value: make(map[string]interface{}),
+		next:  make([]*skipListNode, level),
+	}
+	for i := 0; i < level; i++ {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+	s.length++
+
+	return node.value
+}
+
+// Delete removes the row stored under key and reports whether it existed
+func (s *skipList) Delete(key string) bool {
+	update := s.findPredecessors(key)
+	node := update[0].next[0]
+	if node == nil || node.key != key {
+		return false
+	}
+
+	for i := 0; i < s.level; i++ {
+		if update[i].next[i] != node {
+			break
+		}
+		update[i].next[i] = node.next[i]
+	}
+	for s.level > 1 && s.head.next[s.level-1] == nil {
+		s.level--
+	}
+	s.length--
+
+	return true
+}
+
+// Len returns the number of rows in the list
+func (s *skipList) Len() int {
+	return s.length
+}
+
+// seek returns the first node whose key is greater than or equal to key
+func (s *skipList) seek(key string) *skipListNode {
+	node := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && node.next[i].key < key {
+			node = node.next[i]
+		}
+	}
+	return node.next[0]
+}
+
+// Ascend calls fn for each row with start <= key < end in key order until fn returns
+// false. An empty end means no upper bound.
+func (s *skipList) Ascend(start, end string, fn func(key string, row map[string]interface{}) bool) {
+	for node := s.seek(start); node != nil; node = node.next[0] {
+		if end != "" && node.key >= end {
+			return
+		}
+		if !fn(node.key, node.value) {
+			return
+		}
+	}
+}
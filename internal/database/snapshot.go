@@ -0,0 +1,645 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SnapshotMagic is the first line of every snapshot
+const SnapshotMagic = "JETTRADB-SNAPSHOT"
+
+// SnapshotVersion is the format version written by this build. Snapshots of this or
+// an older version can be restored; see snapshotUpgrades.
+const SnapshotVersion = 1
+
+// snapshotUpgrades convert records written in an older format version to the next
+// version, keyed by the version they upgrade from. A format change that is not
+// purely additive bumps SnapshotVersion and registers an upgrade here, so backups
+// taken by older releases keep restoring.
+var snapshotUpgrades = map[int]func(record *snapshotRecord) error{}
+
+// Snapshot kinds. Full snapshots hold every record; incremental ones hold the records
+// changed since the backup named by Base, with tombstones for deleted records.
+const (
+	SnapshotFull        = "full"
+	SnapshotIncremental = "incremental"
+)
+
+// SnapshotHeader follows the magic line and describes the snapshot contents
+type SnapshotHeader struct {
+	Version   int                `json:"version"`
+	Kind      string             `json:"kind,omitempty"` // empty for full snapshots
+	Base      string             `json:"base,omitempty"` // backup an incremental snapshot applies to
+	CreatedAt time.Time          `json:"created_at"`
+	Models    []SnapshotManifest `json:"models"`
+}
+
+// SnapshotManifest describes the records of one data model. Namespaces maps bucket
+// and column family names to their options.
+type SnapshotManifest struct {
+	Model      Model                      `json:"model"`
+	Records    int                        `json:"records"`
+	Checksum   string                     `json:"checksum"` // sha256 of the model's record lines
+	Namespaces map[string]json.RawMessage `json:"namespaces,omitempty"`
+}
+
+// SnapshotResult reports what a restore loaded
+type SnapshotResult struct {
+	Version  int           `json:"version"`
+	Models   map[Model]int `json:"models"`            // records restored per model
+	Skipped  []Model       `json:"skipped,omitempty"` // models this build does not know
+	Restored time.Time     `json:"restored_at"`
+}
+
+// snapshotRecord is one line of a snapshot after the header. Records are grouped by
+// model in header order and sorted by namespace and key, so equal contents always
+// produce identical record lines.
+type snapshotRecord struct {
+	Model       Model       `json:"model"`
+	Namespace   string      `json:"namespace"`
+	Key         string      `json:"key"`
+	Value       interface{} `json:"value"`
+	ContentType string      `json:"content_type,omitempty"` // KV values stored as raw bytes
+	ExpiresAt   *time.Time  `json:"expires_at,omitempty"`
+	Deleted     bool        `json:"deleted,omitempty"` // tombstone in incremental snapshots
+}
+
+// Graph namespaces in snapshots
+const (
+	snapshotGraphNodes = "nodes"
+	snapshotGraphEdges = "edges"
+)
+
+// snapshotSection accumulates the encoded records of one model
+type snapshotSection struct {
+	manifest SnapshotManifest
+	lines    bytes.Buffer
+}
+
+func newSnapshotSection(model Model) *snapshotSection {
+	return &snapshotSection{manifest: SnapshotManifest{Model: model}}
+}
+
+func (s *snapshotSection) add(record snapshotRecord) error {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s record %s/%s: %w", record.Model, record.Namespace, record.Key, err)
+	}
+	s.lines.Write(encoded)
+	s.lines.WriteByte('\n')
+	s.manifest.Records++
+	return nil
+}
+
+func (s *snapshotSection) setOptions(namespace string, options interface{}) error {
+	encoded, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	if s.manifest.Namespaces == nil {
+		s.manifest.Namespaces = make(map[string]json.RawMessage)
+	}
+	s.manifest.Namespaces[namespace] = encoded
+	return nil
+}
+
+func (s *snapshotSection) seal() {
+	sum := sha256.Sum256(s.lines.Bytes())
+	s.manifest.Checksum = hex.EncodeToString(sum[:])
+}
+
+// WriteSnapshot writes a consistent snapshot of the document, key-value, column and
+// graph stores to w, tiered documents and rows included. Blobs and queues live on
+// disk and are not included.
+func (db *MultiModelDatabase) WriteSnapshot(w io.Writer) (*SnapshotHeader, error) {
+	sections, err := db.takeSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	header := &SnapshotHeader{Version: SnapshotVersion, CreatedAt: time.Now().UTC()}
+	if err := writeSnapshotSections(w, header, sections); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// takeSnapshot encodes every model, tiered data included
+func (db *MultiModelDatabase) takeSnapshot() ([]*snapshotSection, error) {
+	if db.Tiering != nil {
+		// No new stubs may appear between fetching cold data and collecting
+		db.Tiering.sweep.Lock()
+		defer db.Tiering.sweep.Unlock()
+	}
+	coldDocs, coldRows, err := db.coldSnapshotData()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tiered data: %w", err)
+	}
+	return db.collectSnapshot(coldDocs, coldRows)
+}
+
+// writeSnapshotSections completes header with the section manifests and writes the
+// snapshot
+func writeSnapshotSections(w io.Writer, header *SnapshotHeader, sections []*snapshotSection) error {
+	for _, section := range sections {
+		section.seal()
+		header.Models = append(header.Models, section.manifest)
+	}
+	encodedHeader, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(SnapshotMagic + "\n")
+	bw.Write(encodedHeader)
+	bw.WriteByte('\n')
+	for _, section := range sections {
+		bw.Write(section.lines.Bytes())
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// collectSnapshot encodes every model while holding all read locks, in the engine's
+// lock order, so the snapshot reflects a single point in time. Fetched cold entries
+// are included while their stub is still in place.
+func (db *MultiModelDatabase) collectSnapshot(coldDocs map[string]coldEntry, coldRows map[string]map[string]coldEntry) ([]*snapshotSection, error) {
+	db.docMutex.RLock()
+	defer db.docMutex.RUnlock()
+	db.kvMutex.RLock()
+	defer db.kvMutex.RUnlock()
+	db.colMutex.RLock()
+	defer db.colMutex.RUnlock()
+	db.graphMutex.RLock()
+	defer db.graphMutex.RUnlock()
+
+	documents := make(map[string]interface{}, len(db.documents)+len(db.coldDocs))
+	for key, doc := range db.documents {
+		documents[key] = doc
+	}
+	for name, a := range db.archives {
+		if err := a.each(func(id string, doc Document) bool {
+			documents[name+"."+id] = doc
+			return true
+		}); err != nil {
+			return nil, err
+		}
+	}
+	for key, stub := range db.coldDocs {
+		entry, fetched := coldDocs[key]
+		if !fetched || entry.stub != stub {
+			return nil, fmt.Errorf("tiered document %s changed during the snapshot", key)
+		}
+		documents[key] = entry.value
+	}
+	docs := newSnapshotSection(ModelDocument)
+	for _, key := range sortedKeys(documents) {
+		idx := strings.Index(key, ".")
+		if err := docs.add(snapshotRecord{Model: ModelDocument, Namespace: key[:idx], Key: key[idx+1:], Value: documents[key]}); err != nil {
+			return nil, err
+		}
+	}
+
+	kv := newSnapshotSection(ModelKeyValue)
+	now := time.Now()
+	for _, name := range sortedKeys(db.kvBuckets) {
+		bucket := db.kvBuckets[name]
+		if err := kv.setOptions(name, bucket.options); err != nil {
+			return nil, err
+		}
+		for _, key := range sortedKeys(bucket.entries) {
+			entry, live := bucket.lookup(key, now, false)
+			if !live {
+				continue
+			}
+			record := snapshotRecord{Model: ModelKeyValue, Namespace: name, Key: key, Value: entry.value, ContentType: entry.contentType}
+			if !entry.expiresAt.IsZero() {
+				expiresAt := entry.expiresAt.UTC()
+				record.ExpiresAt = &expiresAt
+			}
+			if err := kv.add(record); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	columns := newSnapshotSection(ModelColumn)
+	for _, name := range sortedKeys(db.columnFamilies) {
+		cf := db.columnFamilies[name]
+		if err := columns.setOptions(name, cf.options); err != nil {
+			return nil, err
+		}
+		rows := make(map[string]map[string]interface{}, cf.rows.Len()+len(cf.cold))
+		var rowErr error
+		cf.rows.Ascend("", "", func(rowKey string, row map[string]interface{}) bool {
+			// Cells are written decompressed and recompressed on restore per family options
+			rows[rowKey], rowErr = cf.decodeRow(row)
+			return rowErr == nil
+		})
+		if rowErr != nil {
+			return nil, fmt.Errorf("column family %s: %w", name, rowErr)
+		}
+		for rowKey, stub := range cf.cold {
+			entry, fetched := coldRows[name][rowKey]
+			if !fetched || entry.stub != stub {
+				return nil, fmt.Errorf("tiered row %s/%s changed during the snapshot", name, rowKey)
+			}
+			rows[rowKey] = entry.value
+		}
+		for _, rowKey := range sortedKeys(rows) {
+			if err := columns.add(snapshotRecord{Model: ModelColumn, Namespace: name, Key: rowKey, Value: rows[rowKey]}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	graph := newSnapshotSection(ModelGraph)
+	for _, id := range sortedKeys(db.graphNodes) {
+		if err := graph.add(snapshotRecord{Model: ModelGraph, Namespace: snapshotGraphNodes, Key: id, Value: db.graphNodes[id]}); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range sortedKeys(db.graphEdges) {
+		if err := graph.add(snapshotRecord{Model: ModelGraph, Namespace: snapshotGraphEdges, Key: id, Value: db.graphEdges[id]}); err != nil {
+			return nil, err
+		}
+	}
+
+	return []*snapshotSection{docs, kv, columns, graph}, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ReadSnapshotHeader reads and validates the magic line and header of a snapshot
+func ReadSnapshotHeader(r *bufio.Reader) (*SnapshotHeader, error) {
+	magic, err := r.ReadString('\n')
+	if err != nil || strings.TrimSuffix(magic, "\n") != SnapshotMagic {
+		return nil, fmt.Errorf("not a snapshot: missing %s header", SnapshotMagic)
+	}
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("truncated snapshot header: %w", err)
+	}
+
+	var header SnapshotHeader
+	if err := json.Unmarshal(line, &header); err != nil {
+		return nil, fmt.Errorf("invalid snapshot header: %w", err)
+	}
+	if header.Version <= 0 {
+		return nil, fmt.Errorf("invalid snapshot version %d", header.Version)
+	}
+	if header.Version > SnapshotVersion {
+		return nil, fmt.Errorf("snapshot version %d is newer than the supported version %d", header.Version, SnapshotVersion)
+	}
+	return &header, nil
+}
+
+// parsedSnapshot is a snapshot read and verified against its manifests
+type parsedSnapshot struct {
+	header    *SnapshotHeader
+	manifests map[Model]SnapshotManifest
+	records   map[Model][]snapshotRecord // known models only, upgraded to SnapshotVersion
+	lines     map[Model][][]byte         // encoded records as read, when requested
+	skipped   []Model                    // models unknown to this build
+}
+
+// readSnapshot reads a snapshot from r and verifies every section against its
+// manifest. With keepLines set, the encoded records are kept alongside the decoded
+// ones for callers that compare snapshots.
+func readSnapshot(r io.Reader, keepLines bool) (*parsedSnapshot, error) {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	header, err := ReadSnapshotHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := &parsedSnapshot{
+		header:    header,
+		manifests: make(map[Model]SnapshotManifest, len(header.Models)),
+		records:   make(map[Model][]snapshotRecord),
+		lines:     make(map[Model][][]byte),
+	}
+	for _, manifest := range header.Models {
+		parsed.manifests[manifest.Model] = manifest
+	}
+
+	hashes := make(map[Model]hash.Hash)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("truncated snapshot: %w", err)
+		}
+
+		var record snapshotRecord
+		if err := DecodeJSON(line, &record); err != nil {
+			return nil, fmt.Errorf("invalid snapshot record: %w", err)
+		}
+		if _, listed := parsed.manifests[record.Model]; !listed {
+			return nil, fmt.Errorf("snapshot record for model %s missing from the header", record.Model)
+		}
+		if hashes[record.Model] == nil {
+			hashes[record.Model] = sha256.New()
+		}
+		hashes[record.Model].Write(line)
+		parsed.records[record.Model] = append(parsed.records[record.Model], record)
+		if keepLines {
+			parsed.lines[record.Model] = append(parsed.lines[record.Model], line)
+		}
+	}
+
+	for _, manifest := range header.Models {
+		sum := sha256.New()
+		if hashes[manifest.Model] != nil {
+			sum = hashes[manifest.Model]
+		}
+		if got := len(parsed.records[manifest.Model]); got != manifest.Records {
+			return nil, fmt.Errorf("snapshot section %s is truncated: %d of %d records", manifest.Model, got, manifest.Records)
+		}
+		if hex.EncodeToString(sum.Sum(nil)) != manifest.Checksum {
+			return nil, fmt.Errorf("snapshot section %s is corrupt: checksum mismatch", manifest.Model)
+		}
+		switch manifest.Model {
+		case ModelDocument, ModelKeyValue, ModelColumn, ModelGraph:
+		default:
+			parsed.skipped = append(parsed.skipped, manifest.Model)
+			delete(parsed.records, manifest.Model)
+			delete(parsed.lines, manifest.Model)
+			delete(parsed.manifests, manifest.Model)
+		}
+	}
+
+	for version := header.Version; version < SnapshotVersion; version++ {
+		upgrade, exists := snapshotUpgrades[version]
+		if !exists {
+			continue
+		}
+		for model := range parsed.records {
+			for i := range parsed.records[model] {
+				if err := upgrade(&parsed.records[model][i]); err != nil {
+					return nil, fmt.Errorf("failed to upgrade snapshot from version %d: %w", version, err)
+				}
+			}
+		}
+	}
+	return parsed, nil
+}
+
+// RestoreSnapshot replaces the contents of every model present in the snapshot read
+// from r. The whole snapshot is read and verified against its manifests before
+// anything is replaced, so a corrupt or truncated snapshot leaves the database as
+// it was. Models unknown to this build are skipped and reported.
+func (db *MultiModelDatabase) RestoreSnapshot(r io.Reader) (*SnapshotResult, error) {
+	parsed, err := readSnapshot(r, false)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.header.Kind == SnapshotIncremental {
+		return nil, fmt.Errorf("incremental backups are restored through the backup catalog")
+	}
+	return db.restoreParsed(parsed.header.Version, parsed.manifests, parsed.records, parsed.skipped)
+}
+
+// restoreParsed builds the restored state and swaps it in
+func (db *MultiModelDatabase) restoreParsed(version int, manifests map[Model]SnapshotManifest, records map[Model][]snapshotRecord, skipped []Model) (*SnapshotResult, error) {
+	result := &SnapshotResult{Version: version, Models: make(map[Model]int), Skipped: skipped}
+	for model := range manifests {
+		result.Models[model] = len(records[model])
+	}
+
+	state, err := buildSnapshotState(manifests, records)
+	if err != nil {
+		return nil, err
+	}
+	if released := db.applySnapshotState(state); len(released) > 0 && db.Tiering != nil {
+		db.Tiering.discard(released)
+	}
+	result.Restored = time.Now().UTC()
+	return result, nil
+}
+
+// snapshotState holds restored models; nil fields are left untouched
+type snapshotState struct {
+	documents      map[string]Document
+	kvBuckets      map[string]*kvBucket
+	kvContent      *contentStore
+	columnFamilies map[string]*ColumnFamily
+	graphNodes     map[string]*GraphNode
+	graphEdges     map[string]*GraphEdge
+}
+
+func buildSnapshotState(manifests map[Model]SnapshotManifest, records map[Model][]snapshotRecord) (*snapshotState, error) {
+	state := &snapshotState{}
+
+	if _, present := manifests[ModelDocument]; present {
+		state.documents = make(map[string]Document)
+		for _, record := range records[ModelDocument] {
+			doc, ok := record.Value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("document %s/%s is not an object", record.Namespace, record.Key)
+			}
+			state.documents[record.Namespace+"."+record.Key] = Document(doc)
+		}
+	}
+
+	if manifest, present := manifests[ModelKeyValue]; present {
+		state.kvBuckets = map[string]*kvBucket{DefaultBucket: newKVBucket()}
+		state.kvContent = newContentStore()
+		for name, raw := range manifest.Namespaces {
+			bucket := newKVBucket()
+			if err := json.Unmarshal(raw, &bucket.options); err != nil {
+				return nil, fmt.Errorf("invalid options for bucket %s: %w", name, err)
+			}
+			state.kvBuckets[name] = bucket
+		}
+		now := time.Now()
+		for _, record := range records[ModelKeyValue] {
+			if record.ExpiresAt != nil && !now.Before(*record.ExpiresAt) {
+				continue
+			}
+			bucket, exists := state.kvBuckets[record.Namespace]
+			if !exists {
+				bucket = newKVBucket()
+				state.kvBuckets[record.Namespace] = bucket
+			}
+
+			entry := &kvEntry{value: record.Value, contentType: record.ContentType}
+			if record.ContentType != "" {
+				// Raw bytes are encoded as base64 strings
+				var raw []byte
+				encoded, _ := json.Marshal(record.Value)
+				if err := json.Unmarshal(encoded, &raw); err != nil {
+					return nil, fmt.Errorf("invalid raw value for key %s/%s: %w", record.Namespace, record.Key, err)
+				}
+				entry.value = raw
+			}
+			if record.ExpiresAt != nil {
+				entry.expiresAt = *record.ExpiresAt
+			}
+			if bucket.options.Dedup {
+				shared, err := state.kvContent.intern(entry.value, entry.contentType)
+				if err != nil {
+					return nil, err
+				}
+				entry.value, entry.shared = shared.value, shared
+			}
+			bucket.entries[record.Key] = entry
+		}
+	}
+
+	if manifest, present := manifests[ModelColumn]; present {
+		state.columnFamilies = make(map[string]*ColumnFamily)
+		for name, raw := range manifest.Namespaces {
+			cf := newColumnFamily()
+			if err := json.Unmarshal(raw, &cf.options); err != nil {
+				return nil, fmt.Errorf("invalid options for column family %s: %w", name, err)
+			}
+			if !IsSupportedCompression(cf.options.Compression) {
+				return nil, fmt.Errorf("column family %s uses unsupported compression %s", name, cf.options.Compression)
+			}
+			state.columnFamilies[name] = cf
+		}
+		for _, record := range records[ModelColumn] {
+			columns, ok := record.Value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("row %s/%s is not an object", record.Namespace, record.Key)
+			}
+			cf, exists := state.columnFamilies[record.Namespace]
+			if !exists {
+				cf = newColumnFamily()
+				state.columnFamilies[record.Namespace] = cf
+			}
+			row := cf.rows.GetOrCreate(record.Key)
+			for column, value := range columns {
+				stored, err := compressValue(cf.options.Compression, cf.options.CompressionThreshold, value)
+				if err != nil {
+					return nil, err
+				}
+				row[column] = stored
+			}
+		}
+	}
+
+	if _, present := manifests[ModelGraph]; present {
+		state.graphNodes = make(map[string]*GraphNode)
+		state.graphEdges = make(map[string]*GraphEdge)
+		for _, record := range records[ModelGraph] {
+			encoded, err := json.Marshal(record.Value)
+			if err != nil {
+				return nil, err
+			}
+			switch record.Namespace {
+			case snapshotGraphNodes:
+				var node GraphNode
+				if err := json.Unmarshal(encoded, &node); err != nil {
+					return nil, fmt.Errorf("invalid node %s: %w", record.Key, err)
+				}
+				state.graphNodes[record.Key] = &node
+			case snapshotGraphEdges:
+				var edge GraphEdge
+				if err := json.Unmarshal(encoded, &edge); err != nil {
+					return nil, fmt.Errorf("invalid edge %s: %w", record.Key, err)
+				}
+				state.graphEdges[record.Key] = &edge
+			default:
+				return nil, fmt.Errorf("unknown graph namespace %q", record.Namespace)
+			}
+		}
+	}
+
+	return state, nil
+}
+
+// applySnapshotState swaps restored models in while holding all write locks. It
+// returns the objects of tiered entries that were replaced.
+func (db *MultiModelDatabase) applySnapshotState(state *snapshotState) (released []string) {
+	db.docMutex.Lock()
+	defer db.docMutex.Unlock()
+	db.kvMutex.Lock()
+	defer db.kvMutex.Unlock()
+	db.colMutex.Lock()
+	defer db.colMutex.Unlock()
+	db.graphMutex.Lock()
+	defer db.graphMutex.Unlock()
+
+	if state.documents != nil {
+		// Invalidate cached reads of collections that changed or disappeared
+		collections := make(map[string]struct{})
+		for _, docs := range []map[string]Document{db.documents, state.documents} {
+			for key := range docs {
+				collections[key[:strings.Index(key, ".")]] = struct{}{}
+			}
+		}
+		for key, stub := range db.coldDocs {
+			collections[key[:strings.Index(key, ".")]] = struct{}{}
+			released = append(released, stub.object)
+		}
+		for key, doc := range state.documents {
+			state.documents[key] = db.compressDocument(doc)
+		}
+		db.documents = state.documents
+		db.coldDocs = make(map[string]coldStub)
+		db.rawDocs.clear()
+		// Snapshots hold archived documents like any other, restored into memory
+		for name, a := range db.archives {
+			collections[name] = struct{}{}
+			a.discard()
+			delete(db.archives, name)
+		}
+		for collection := range collections {
+			db.touchCollection(collection)
+			db.syncLog.reset(collection)
+		}
+	}
+
+	if state.kvBuckets != nil {
+		// Restored keys are not attached to leases, so expiring leases must not delete them
+		for _, lease := range db.kvLeases {
+			lease.keys = make(map[leaseKey]struct{})
+		}
+		for _, bucket := range state.kvBuckets {
+			for _, entry := range bucket.entries {
+				db.kvRevision++
+				entry.revision = db.kvRevision
+			}
+		}
+		db.kvBuckets = state.kvBuckets
+		db.kvContent = state.kvContent
+	}
+
+	if state.columnFamilies != nil {
+		for _, cf := range db.columnFamilies {
+			for _, stub := range cf.cold {
+				released = append(released, stub.object)
+			}
+		}
+		db.columnFamilies = state.columnFamilies
+	}
+
+	if state.graphNodes != nil {
+		db.graphNodes = state.graphNodes
+		db.graphEdges = state.graphEdges
+	}
+	return released
+}
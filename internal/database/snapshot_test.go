@@ -0,0 +1,141 @@
+package database
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func seedSnapshotDatabase(t *testing.T) *MultiModelDatabase {
+	t.Helper()
+	db := newTestDatabase(t)
+	if err := db.InsertDocument("users", "alice", Document{"name": "Alice", "tags": []interface{}{"admin"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetBucketOptions("cache", BucketOptions{Dedup: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b"} {
+		if err := db.SetBucketValue("cache", key, map[string]interface{}{"shared": true}, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.PutBucketValue("cache", "raw", []byte("bytes"), PutOptions{ContentType: "application/octet-stream"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetColumnFamilyOptions("metrics", ColumnFamilyOptions{Compression: "gzip"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertColumn("metrics", "row1", "cpu", strings.Repeat("x", 512)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateNode("n1", []string{"Person"}, map[string]interface{}{"age": 30}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateNode("n2", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateEdge("e1", "n1", "n2", "KNOWS", nil); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	source := seedSnapshotDatabase(t)
+	var snapshot bytes.Buffer
+	header, err := source.WriteSnapshot(&snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Version != SnapshotVersion || len(header.Models) != 4 {
+		t.Fatalf("unexpected header %+v", header)
+	}
+
+	target := newTestDatabase(t)
+	if err := target.InsertDocument("stale", "x", Document{"gone": true}); err != nil {
+		t.Fatal(err)
+	}
+	result, err := target.RestoreSnapshot(bytes.NewReader(snapshot.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Models[ModelKeyValue] != 3 || result.Models[ModelGraph] != 3 {
+		t.Fatalf("unexpected restore counts %+v", result.Models)
+	}
+
+	if _, err := target.GetDocument("stale", "x"); err == nil {
+		t.Fatal("restore kept a document missing from the snapshot")
+	}
+	doc, err := target.GetDocument("users", "alice")
+	if err != nil || doc["name"] != "Alice" {
+		t.Fatalf("document not restored: %v, %v", doc, err)
+	}
+	if value, err := target.GetBucketValue("cache", "b"); err != nil || !reflect.DeepEqual(value, map[string]interface{}{"shared": true}) {
+		t.Fatalf("bucket value not restored: %v, %v", value, err)
+	}
+	if item, err := target.GetBucketItem("cache", "raw"); err != nil || string(item.Value.([]byte)) != "bytes" {
+		t.Fatalf("raw value not restored: %+v, %v", item, err)
+	}
+	if stats := target.KVDedupStats(); stats.UniqueValues != 2 {
+		t.Fatalf("dedup not rebuilt: %+v", stats)
+	}
+	if options, err := target.GetColumnFamilyOptions("metrics"); err != nil || options.Compression != "gzip" {
+		t.Fatalf("column family options not restored: %+v, %v", options, err)
+	}
+	if value, err := target.GetColumn("metrics", "row1", "cpu"); err != nil || value != strings.Repeat("x", 512) {
+		t.Fatalf("column not restored: %v", err)
+	}
+	if edge, err := target.GetEdge("e1"); err != nil || edge.From != "n1" {
+		t.Fatalf("edge not restored: %+v, %v", edge, err)
+	}
+
+	// Equal contents produce identical record lines
+	var again bytes.Buffer
+	if _, err := target.WriteSnapshot(&again); err != nil {
+		t.Fatal(err)
+	}
+	records := func(b []byte) string { return string(bytes.SplitN(b, []byte("\n"), 3)[2]) }
+	if records(snapshot.Bytes()) != records(again.Bytes()) {
+		t.Fatal("snapshot records differ after a round trip")
+	}
+}
+
+func TestSnapshotRejectsCorruptAndNewer(t *testing.T) {
+	source := seedSnapshotDatabase(t)
+	var snapshot bytes.Buffer
+	if _, err := source.WriteSnapshot(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	target := newTestDatabase(t)
+
+	corrupt := bytes.Replace(snapshot.Bytes(), []byte("Alice"), []byte("Alicf"), 1)
+	if _, err := target.RestoreSnapshot(bytes.NewReader(corrupt)); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+	truncated := snapshot.Bytes()[:snapshot.Len()-1]
+	if _, err := target.RestoreSnapshot(bytes.NewReader(truncated)); err == nil {
+		t.Fatal("expected truncated snapshot to be rejected")
+	}
+	newer := bytes.Replace(snapshot.Bytes(), []byte(`"version":1`), []byte(`"version":99`), 1)
+	if _, err := target.RestoreSnapshot(bytes.NewReader(newer)); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Fatalf("expected version error, got %v", err)
+	}
+	if _, err := target.GetDocument("users", "alice"); err == nil {
+		t.Fatal("failed restore modified the database")
+	}
+}
+
+func TestSnapshotSkipsUnknownModels(t *testing.T) {
+	snapshot := SnapshotMagic + "\n" +
+		`{"version":1,"future_field":true,"models":[{"model":"timeseries","records":0,"checksum":"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"}]}` + "\n"
+	result, err := newTestDatabase(t).RestoreSnapshot(strings.NewReader(snapshot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0] != "timeseries" {
+		t.Fatalf("expected timeseries to be skipped, got %+v", result)
+	}
+}
@@ -0,0 +1,255 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrUnknownPartition is returned for partition ids missing from the partition map
+var ErrUnknownPartition = errors.New("unknown partition")
+
+// ErrPartitionTooSmall is returned when splitting a partition of a single hash
+var ErrPartitionTooSmall = errors.New("partition is too small to split")
+
+// splitCheckInterval is how often the leader checks partition load for splits
+const splitCheckInterval = 30 * time.Second
+
+// PartitionMap is the versioned set of partitions. The leader raises the version
+// with every split and pushes the map to the members, which adopt newer versions.
+type PartitionMap struct {
+	Version    uint64      `json:"version"`
+	Partitions []Partition `json:"partitions"`
+}
+
+// splitPartition halves partition id of partitions. The halves keep the placement
+// of the partition, so their keys stay on the nodes that already hold them.
+func splitPartition(partitions []Partition, id string) ([]Partition, error) {
+	for i, partition := range partitions {
+		if partition.ID != id {
+			continue
+		}
+		if partition.Start == partition.End {
+			return nil, fmt.Errorf("%w: %s", ErrPartitionTooSmall, id)
+		}
+		mid := partition.Start + (partition.End-partition.Start)/2
+		home := partition.placement()
+		halves := []Partition{
+			{ID: id + ".0", Start: partition.Start, End: mid, Home: home},
+			{ID: id + ".1", Start: mid + 1, End: partition.End, Home: home},
+		}
+		split := make([]Partition, 0, len(partitions)+1)
+		split = append(split, partitions[:i]...)
+		split = append(split, halves...)
+		return append(split, partitions[i+1:]...), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownPartition, id)
+}
+
+// validPartitions reports whether partitions are sorted and cover the hash space
+func validPartitions(partitions []Partition) bool {
+	if len(partitions) == 0 || partitions[0].Start != 0 || partitions[len(partitions)-1].End != ^uint32(0) {
+		return false
+	}
+	for i := 1; i < len(partitions); i++ {
+		if partitions[i].Start != partitions[i-1].End+1 {
+			return false
+		}
+	}
+	return true
+}
+
+// PartitionMap returns the partition map and its version
+func (c *Cluster) PartitionMap() PartitionMap {
+	c.partitionMutex.RLock()
+	defer c.partitionMutex.RUnlock()
+	return PartitionMap{Version: c.partitionVersion, Partitions: append([]Partition(nil), c.partitions...)}
+}
+
+// AdoptPartitionMap replaces the partition map with m when m is newer, and reports
+// whether it did
+func (c *Cluster) AdoptPartitionMap(m PartitionMap) (bool, error) {
+	if !validPartitions(m.Partitions) {
+		return false, fmt.Errorf("partition map %d does not cover the hash space", m.Version)
+	}
+
+	c.partitionMutex.Lock()
+	defer c.partitionMutex.Unlock()
+
+	if m.Version <= c.partitionVersion {
+		return false, nil
+	}
+	c.partitions = append([]Partition(nil), m.Partitions...)
+	c.partitionVersion = m.Version
+	if err := c.savePartitionMap(); err != nil {
+		log.Printf("Failed to persist partition map %d: %v", m.Version, err)
+	}
+	c.events.publish(EventPartitionMap, "", map[string]interface{}{"version": m.Version, "partitions": len(m.Partitions)})
+	return true, nil
+}
+
+// partitionMapPath is where the partition map is kept, empty without a data directory
+func (c *Cluster) partitionMapPath() string {
+	if c.config.DataDir == "" {
+		return ""
+	}
+	return filepath.Join(c.config.DataDir, "partitions.json")
+}
+
+// savePartitionMap persists the partition map. Callers must hold partitionMutex.
+func (c *Cluster) savePartitionMap() error {
+	path := c.partitionMapPath()
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(PartitionMap{Version: c.partitionVersion, Partitions: c.partitions})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadPartitionMap restores the partition map persisted before a restart
+func (c *Cluster) loadPartitionMap() {
+	path := c.partitionMapPath()
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return
+	}
+	var m PartitionMap
+	if err == nil {
+		err = json.Unmarshal(data, &m)
+	}
+	if err == nil {
+		_, err = c.AdoptPartitionMap(m)
+	}
+	if err != nil {
+		log.Printf("Ignoring persisted partition map: %v", err)
+	}
+}
+
+// Leader returns the node coordinating partition splits: the active node with the
+// lowest id
+func (c *Cluster) Leader() *Node {
+	nodes := c.GetActiveNodes()
+	if len(nodes) == 0 {
+		return nil
+	}
+	return nodes[0]
+}
+
+// IsLeader reports whether this node coordinates partition splits
+func (c *Cluster) IsLeader() bool {
+	leader := c.Leader()
+	return leader != nil && leader.ID == c.Self().ID
+}
+
+// SplitPartition splits partition id in two. Splits are coordinated by the leader:
+// other nodes forward the request to it. The leader raises the partition map
+// version and pushes the new map to every member. Clients are not affected, since
+// the halves stay on the nodes holding the partition.
+func (db *MultiModelDatabase) SplitPartition(id string) (*PartitionMap, error) {
+	if db.Cluster == nil {
+		return nil, fmt.Errorf("clustering is not enabled")
+	}
+	if !db.Cluster.IsLeader() {
+		var m PartitionMap
+		if err := db.Cluster.call(db.Cluster.Leader(), "/data/partitions/split", map[string]string{"partition": id}, &m); err != nil {
+			return nil, err
+		}
+		// Adopt the map before answering, in case the leader's push did not reach us
+		db.Cluster.AdoptPartitionMap(m)
+		return &m, nil
+	}
+
+	db.splitMutex.Lock()
+	defer db.splitMutex.Unlock()
+
+	current := db.Cluster.PartitionMap()
+	partitions, err := splitPartition(current.Partitions, id)
+	if err != nil {
+		return nil, err
+	}
+	next := PartitionMap{Version: current.Version + 1, Partitions: partitions}
+	if _, err := db.Cluster.AdoptPartitionMap(next); err != nil {
+		return nil, err
+	}
+	log.Printf("Split partition %s, partition map version %d", id, next.Version)
+	db.Cluster.events.publish(EventPartitionSplit, "", map[string]interface{}{"partition": id, "version": next.Version})
+	db.PushPartitionMap()
+	return &next, nil
+}
+
+// PushPartitionMap sends the partition map to every active peer. Peers that miss it
+// catch up on the leader's next split check.
+func (db *MultiModelDatabase) PushPartitionMap() {
+	m := db.Cluster.PartitionMap()
+	db.eachNode(db.Cluster.GetActiveNodes(), func(i int, node *Node, local bool) {
+		if local {
+			return
+		}
+		if err := db.Cluster.post(node, "/data/partitions", m); err != nil {
+			log.Printf("Failed to push partition map %d to node %s: %v", m.Version, node.ID, err)
+		}
+	})
+}
+
+// CheckSplits splits the partitions whose size or request rate exceeds the
+// configured limits and returns their ids. It does nothing on nodes other than
+// the leader.
+func (db *MultiModelDatabase) CheckSplits() ([]string, error) {
+	if db.Cluster == nil || !db.Cluster.IsLeader() {
+		return nil, nil
+	}
+
+	report, err := db.ClusterLoad()
+	if err != nil {
+		return nil, err
+	}
+	split := make([]string, 0)
+	for _, action := range report.Actions {
+		if action.Action != "split" {
+			continue
+		}
+		if _, err := db.SplitPartition(action.Partition); err != nil {
+			return split, err
+		}
+		db.load.forget(action.Partition)
+		split = append(split, action.Partition)
+	}
+	if len(split) == 0 && db.Cluster.PartitionMap().Version > 0 {
+		db.PushPartitionMap()
+	}
+	return split, nil
+}
+
+// startPartitionSplitter periodically lets the leader split hot partitions
+func (db *MultiModelDatabase) startPartitionSplitter() {
+	ticker := time.NewTicker(splitCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-db.ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := db.CheckSplits(); err != nil {
+				log.Printf("Partition split check failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package database
+
+import "time"
+
+// EngineStats summarizes the data held by the engine
+type EngineStats struct {
+	Ephemeral      bool           `json:"ephemeral"`
+	ReadOnly       ReadOnlyStatus `json:"read_only"`
+	DataDir        string         `json:"data_dir"`
+	StartedAt      time.Time      `json:"started_at"`
+	UptimeSeconds  float64        `json:"uptime_seconds"`
+	Collections    int            `json:"collections"`
+	Documents      int            `json:"documents"`
+	Buckets        int            `json:"buckets"`
+	Keys           int            `json:"keys"`
+	ColumnFamilies int            `json:"column_families"`
+	Rows           int            `json:"rows"`
+	GraphNodes     int            `json:"graph_nodes"`
+	GraphEdges     int            `json:"graph_edges"`
+}
+
+// Stats returns the size of each store along with the engine's mode
+func (db *MultiModelDatabase) Stats() EngineStats {
+	stats := EngineStats{
+		Ephemeral:     db.Ephemeral(),
+		ReadOnly:      db.ReadOnly(),
+		DataDir:       db.config.DataDir,
+		StartedAt:     db.startedAt.UTC(),
+		UptimeSeconds: time.Since(db.startedAt).Seconds(),
+	}
+	for _, info := range db.collectionInfos() {
+		stats.Collections++
+		stats.Documents += info.Documents
+	}
+
+	db.kvMutex.RLock()
+	stats.Buckets = len(db.kvBuckets)
+	now := time.Now()
+	for _, b := range db.kvBuckets {
+		for _, entry := range b.entries {
+			if !entry.expired(now) {
+				stats.Keys++
+			}
+		}
+	}
+	db.kvMutex.RUnlock()
+
+	db.colMutex.RLock()
+	stats.ColumnFamilies = len(db.columnFamilies)
+	for _, cf := range db.columnFamilies {
+		stats.Rows += cf.rows.Len() + len(cf.cold)
+	}
+	db.colMutex.RUnlock()
+
+	db.graphMutex.RLock()
+	stats.GraphNodes = len(db.graphNodes)
+	stats.GraphEdges = len(db.graphEdges)
+	db.graphMutex.RUnlock()
+	return stats
+}
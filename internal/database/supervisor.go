@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Routine states reported by RoutineStatus
+const (
+	RoutineRunning    = "running"
+	RoutineRestarting = "restarting" // panicked, waiting to be restarted
+	RoutineStopped    = "stopped"
+)
+
+const (
+	restartDelay    = time.Second
+	maxRestartDelay = time.Minute
+	// stopTimeout bounds how long Close waits for routines to return
+	stopTimeout = 5 * time.Second
+)
+
+// RoutineStatus reports a supervised background routine
+type RoutineStatus struct {
+	Name        string     `json:"name"`
+	State       string     `json:"state"`
+	StartedAt   time.Time  `json:"started_at"`
+	Restarts    int        `json:"restarts"`
+	LastPanic   string     `json:"last_panic,omitempty"`
+	LastPanicAt *time.Time `json:"last_panic_at,omitempty"`
+}
+
+// supervisor runs long-lived background routines until its context is cancelled.
+// A routine that panics is restarted after a delay doubling with every consecutive
+// panic, instead of taking the process down or silently disappearing.
+type supervisor struct {
+	ctx      context.Context
+	delay    time.Duration // before the first restart
+	routines map[string]*RoutineStatus
+	mutex    sync.Mutex
+	wg       sync.WaitGroup
+}
+
+func newSupervisor(ctx context.Context) *supervisor {
+	return &supervisor{ctx: ctx, delay: restartDelay, routines: make(map[string]*RoutineStatus)}
+}
+
+// run starts fn as the routine name. fn is expected to return once the supervisor's
+// context is done; returning earlier stops the routine for good.
+func (s *supervisor) run(name string, fn func()) {
+	s.mutex.Lock()
+	status := &RoutineStatus{Name: name, State: RoutineRunning, StartedAt: time.Now().UTC()}
+	s.routines[name] = status
+	s.mutex.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		delay := s.delay
+		for {
+			recovered := s.call(fn)
+			if recovered == nil || s.ctx.Err() != nil {
+				s.setState(status, RoutineStopped)
+				return
+			}
+
+			log.Printf("Routine %s panicked, restarting in %v: %v", name, delay, recovered)
+			now := time.Now().UTC()
+			s.mutex.Lock()
+			status.State = RoutineRestarting
+			status.LastPanic = fmt.Sprint(recovered)
+			status.LastPanicAt = &now
+			s.mutex.Unlock()
+
+			select {
+			case <-s.ctx.Done():
+				s.setState(status, RoutineStopped)
+				return
+			case <-time.After(delay):
+			}
+			if delay *= 2; delay > maxRestartDelay {
+				delay = maxRestartDelay
+			}
+
+			s.mutex.Lock()
+			status.State = RoutineRunning
+			status.Restarts++
+			status.StartedAt = time.Now().UTC()
+			s.mutex.Unlock()
+		}
+	}()
+}
+
+// spawn runs fn once in the background as the task name. Unlike routines, tasks are
+// not restarted or reported, but wait waits for them too, so they cannot outlive
+// Close. It must be called from a supervised routine, or before the context is done.
+func (s *supervisor) spawn(name string, fn func()) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if recovered := s.call(fn); recovered != nil {
+			log.Printf("Task %s panicked: %v", name, recovered)
+		}
+	}()
+}
+
+// call runs fn and returns what it panicked with, if it did
+func (s *supervisor) call(fn func()) (recovered interface{}) {
+	defer func() {
+		if recovered = recover(); recovered != nil {
+			log.Printf("%s", debug.Stack())
+		}
+	}()
+	fn()
+	return nil
+}
+
+func (s *supervisor) setState(status *RoutineStatus, state string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	status.State = state
+}
+
+// wait waits up to timeout for the routines to return after the context is
+// cancelled, reporting whether they all did
+func (s *supervisor) wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// statuses returns the status of every routine ordered by name, prefixed with prefix
+func (s *supervisor) statuses(prefix string) []RoutineStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	statuses := make([]RoutineStatus, 0, len(s.routines))
+	for _, name := range sortedKeys(s.routines) {
+		status := *s.routines[name]
+		status.Name = prefix + status.Name
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// RoutineStatus returns the background routines of the engine and its cluster
+func (db *MultiModelDatabase) RoutineStatus() []RoutineStatus {
+	statuses := db.routines.statuses("")
+	if db.Cluster != nil {
+		statuses = append(statuses, db.Cluster.routines.statuses("cluster/")...)
+	}
+	sort.SliceStable(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSupervisorRestartsPanickedRoutines(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newSupervisor(ctx)
+	s.delay = time.Millisecond
+
+	var calls int32
+	s.run("flaky", func() {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			panic("lost connection")
+		}
+		<-ctx.Done()
+	})
+	s.run("oneshot", func() {})
+
+	status := func(name string) RoutineStatus {
+		for _, status := range s.statuses("") {
+			if status.Name == name {
+				return status
+			}
+		}
+		t.Fatalf("routine %s not reported", name)
+		return RoutineStatus{}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for status("flaky").Restarts < 2 || status("oneshot").State != RoutineStopped {
+		if time.Now().After(deadline) {
+			t.Fatalf("statuses = %+v", s.statuses(""))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if flaky := status("flaky"); flaky.State != RoutineRunning || flaky.LastPanic != "lost connection" || flaky.LastPanicAt == nil {
+		t.Fatalf("flaky = %+v", flaky)
+	}
+
+	cancel()
+	if !s.wait(time.Second) {
+		t.Fatal("routines still running after cancellation")
+	}
+	if flaky := status("flaky"); flaky.State != RoutineStopped || flaky.Restarts != 2 {
+		t.Fatalf("flaky after cancellation = %+v", flaky)
+	}
+}
+
+func TestRoutineStatus(t *testing.T) {
+	db := newTestDatabase(t)
+	names := make(map[string]string)
+	for _, status := range db.RoutineStatus() {
+		names[status.Name] = status.State
+	}
+	for _, name := range []string{"kv-sweeper", "scheduler"} {
+		if names[name] != RoutineRunning {
+			t.Fatalf("%s not running: %v", name, names)
+		}
+	}
+
+	db.Close()
+	for _, status := range db.RoutineStatus() {
+		if status.State != RoutineStopped {
+			t.Fatalf("%s still %s after Close", status.Name, status.State)
+		}
+	}
+}
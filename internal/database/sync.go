@@ -0,0 +1,353 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Conflict policies of document sync
+const (
+	SyncServerWins = "server_wins" // changes to documents changed on the server since the token are rejected
+	SyncClientWins = "client_wins" // client changes always apply
+	SyncMerge      = "merge"       // changes merge into the server's fields; deletes never discard the other side's edits
+)
+
+// syncTombstoneLimit is the number of deleted ids kept per collection. Older
+// deletions are forgotten, and tokens issued before them answered with a reset.
+const syncTombstoneLimit = 10000
+
+// ErrSyncToken is returned for sync tokens that were not issued by this engine
+var ErrSyncToken = errors.New("invalid sync token")
+
+// SyncRequest is what an intermittently connected client sends to sync a collection
+type SyncRequest struct {
+	Token   string       `json:"token"` // from the previous sync, empty for the first one
+	Changes []SyncChange `json:"changes"`
+	Policy  string       `json:"policy"` // SyncServerWins when empty
+}
+
+// SyncChange is a change a client made locally since its last sync
+type SyncChange struct {
+	ID  string    `json:"id"`
+	Op  Operation `json:"op"`            // insert, update or delete
+	Doc Document  `json:"doc,omitempty"` // the document for inserts, the fields to change for updates
+}
+
+// SyncResult is the answer to a sync
+type SyncResult struct {
+	Token string `json:"token"` // to present on the next sync
+	// Reset is set when the token was empty, issued before a restart or too old to
+	// answer from the journal. Changes then hold every document of the collection and
+	// the client replaces its copy.
+	Reset     bool           `json:"reset"`
+	Changes   []SyncDocument `json:"changes"`
+	Applied   int            `json:"applied"`             // client changes applied
+	Conflicts []Conflict     `json:"conflicts,omitempty"` // client changes rejected by the policy
+	Errors    []string       `json:"errors,omitempty"`    // client changes that failed otherwise
+}
+
+// SyncDocument is the current state of a document changed since the client's token
+type SyncDocument struct {
+	ID      string   `json:"id"`
+	Deleted bool     `json:"deleted,omitempty"`
+	Doc     Document `json:"doc,omitempty"`
+}
+
+// syncJournal records which documents changed, and when, so that a client presenting
+// a token gets the documents changed since without the server keeping their history.
+// Only the latest change of each document is kept; deleted documents are kept as
+// tombstones up to syncTombstoneLimit per collection.
+type syncJournal struct {
+	epoch       int64 // start of this run, tokens of earlier runs answer with a reset
+	seq         int64
+	collections map[string]*syncCollection
+	mutex       sync.Mutex
+}
+
+type syncCollection struct {
+	changes    map[string]syncEntry // latest change per document id
+	tombstones int
+	floor      int64 // tokens before it cannot be answered from the journal
+}
+
+type syncEntry struct {
+	seq     int64
+	deleted bool
+}
+
+func newSyncJournal() *syncJournal {
+	return &syncJournal{epoch: time.Now().UnixNano(), collections: make(map[string]*syncCollection)}
+}
+
+// record notes a document write applied by the engine
+func (j *syncJournal) record(op Operation, event *WriteEvent) {
+	if event.Model != ModelDocument {
+		return
+	}
+	j.note(event.Namespace, event.Key, op == OpDelete)
+}
+
+// note records a change of the document id of collection made outside the write
+// hooks, as by migrations and CRDT merges
+func (j *syncJournal) note(collection, id string, deleted bool) {
+	if IsSystemCollection(collection) {
+		return
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	c := j.collection(collection)
+	j.seq++
+	if previous, exists := c.changes[id]; exists && previous.deleted {
+		c.tombstones--
+	}
+	if deleted {
+		c.tombstones++
+	}
+	c.changes[id] = syncEntry{seq: j.seq, deleted: deleted}
+	if c.tombstones > syncTombstoneLimit {
+		c.prune()
+	}
+}
+
+// reset forgets the changes of collection and raises its floor past them, so every
+// token issued before is answered with a reset. Restores use it, as they replace
+// the documents without telling which changed.
+func (j *syncJournal) reset(collection string) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	c := j.collection(collection)
+	j.seq++
+	c.changes = make(map[string]syncEntry)
+	c.tombstones = 0
+	c.floor = j.seq
+}
+
+// collection returns the journal of collection, creating it. Callers must hold the mutex.
+func (j *syncJournal) collection(name string) *syncCollection {
+	c := j.collections[name]
+	if c == nil {
+		c = &syncCollection{changes: make(map[string]syncEntry)}
+		j.collections[name] = c
+	}
+	return c
+}
+
+// prune forgets the older half of the tombstones, raising the floor past them
+func (c *syncCollection) prune() {
+	var deleted []string
+	for id, entry := range c.changes {
+		if entry.deleted {
+			deleted = append(deleted, id)
+		}
+	}
+	sort.Slice(deleted, func(i, k int) bool { return c.changes[deleted[i]].seq < c.changes[deleted[k]].seq })
+	for _, id := range deleted[:len(deleted)/2] {
+		if seq := c.changes[id].seq; seq > c.floor {
+			c.floor = seq
+		}
+		delete(c.changes, id)
+		c.tombstones--
+	}
+}
+
+func (j *syncJournal) token(seq int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%d", j.epoch, seq)))
+}
+
+// since returns the sequence number a token was issued at, and false when the
+// journal cannot tell what changed in collection after it
+func (j *syncJournal) since(collection, token string) (int64, bool, error) {
+	if token == "" {
+		return 0, false, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, false, ErrSyncToken
+	}
+	epochPart, seqPart, found := strings.Cut(string(decoded), ".")
+	epoch, epochErr := strconv.ParseInt(epochPart, 10, 64)
+	seq, seqErr := strconv.ParseInt(seqPart, 10, 64)
+	if !found || epochErr != nil || seqErr != nil {
+		return 0, false, ErrSyncToken
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if epoch != j.epoch || seq > j.seq {
+		return 0, false, nil
+	}
+	if c := j.collections[collection]; c != nil && seq < c.floor {
+		return 0, false, nil
+	}
+	return seq, true, nil
+}
+
+// changedAfter returns the sequence numbers of the latest changes after seq of the
+// documents with ids, leaving out those not changed since
+func (j *syncJournal) changedAfter(collection string, ids []string, seq int64) map[string]int64 {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	changed := make(map[string]int64)
+	if c := j.collections[collection]; c != nil {
+		for _, id := range ids {
+			if entry, exists := c.changes[id]; exists && entry.seq > seq {
+				changed[id] = entry.seq
+			}
+		}
+	}
+	return changed
+}
+
+// changes returns the ids of collection changed after seq in the order of their
+// latest change, with the current sequence number
+func (j *syncJournal) changes(collection string, seq int64) ([]string, int64) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	c := j.collections[collection]
+	if c == nil {
+		return nil, j.seq
+	}
+	var ids []string
+	for id, entry := range c.changes {
+		if entry.seq > seq {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, k int) bool { return c.changes[ids[i]].seq < c.changes[ids[k]].seq })
+	return ids, j.seq
+}
+
+// SyncCollection exchanges changes with a client that works offline. The client's
+// changes are applied first, in order, then the documents changed since its token
+// are returned in their current state, including those the client just wrote, so
+// the client also learns how its changes were merged. A client change conflicts
+// when the server changed the document after the token was issued, or when it
+// cannot apply as sent; request.Policy decides what happens then. Changes made on
+// the server while the sync runs may be returned again by the next sync.
+func (db *MultiModelDatabase) SyncCollection(ctx context.Context, collection string, request SyncRequest) (*SyncResult, error) {
+	if err := ValidateCollectionName(collection); err != nil {
+		return nil, err
+	}
+	if IsSystemCollection(collection) {
+		return nil, fmt.Errorf("%w: %s", ErrSystemCollection, collection)
+	}
+	policy := request.Policy
+	switch policy {
+	case "":
+		policy = SyncServerWins
+	case SyncServerWins, SyncClientWins, SyncMerge:
+	default:
+		return nil, fmt.Errorf("unknown conflict policy %q, expected %s, %s or %s", policy, SyncServerWins, SyncClientWins, SyncMerge)
+	}
+	since, incremental, err := db.syncLog.since(collection, request.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	// Taken before applying, so that a client change never conflicts with another
+	// change of the same sync
+	var changed map[string]int64
+	if incremental {
+		ids := make([]string, len(request.Changes))
+		for i, change := range request.Changes {
+			ids[i] = change.ID
+		}
+		changed = db.syncLog.changedAfter(collection, ids, since)
+	}
+
+	result := &SyncResult{Reset: !incremental, Changes: make([]SyncDocument, 0)}
+	for i, change := range request.Changes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		conflict, err := db.applySyncChange(collection, change, policy, changed[change.ID])
+		switch {
+		case err != nil:
+			result.Errors = append(result.Errors, fmt.Sprintf("change %d of %s: %v", i, change.ID, err))
+		case conflict != "":
+			result.Conflicts = append(result.Conflicts, Conflict{Index: i, Key: change.ID, Revision: changed[change.ID], Reason: conflict})
+		default:
+			result.Applied++
+		}
+	}
+
+	var ids []string
+	var seq int64
+	if incremental {
+		ids, seq = db.syncLog.changes(collection, since)
+	} else {
+		_, seq = db.syncLog.changes(collection, 0)
+		if err := db.warmCollection(collection); err != nil {
+			return nil, err
+		}
+		ids = db.collectionIDs(collection)
+	}
+	for _, id := range ids {
+		doc, err := db.GetDocument(collection, id)
+		if err != nil {
+			result.Changes = append(result.Changes, SyncDocument{ID: id, Deleted: true})
+			continue
+		}
+		result.Changes = append(result.Changes, SyncDocument{ID: id, Doc: doc})
+	}
+	result.Token = db.syncLog.token(seq)
+	return result, nil
+}
+
+// applySyncChange applies a client change under policy, changed being the sequence
+// number of a server change the client has not seen, or 0. It returns the reason a
+// conflicting change was not applied.
+func (db *MultiModelDatabase) applySyncChange(collection string, change SyncChange, policy string, changed int64) (string, error) {
+	if change.ID == "" {
+		return "", fmt.Errorf("change has an empty id")
+	}
+	if changed > 0 && policy == SyncServerWins {
+		return fmt.Sprintf("document %s changed on the server since the last sync", change.ID), nil
+	}
+
+	switch change.Op {
+	case OpInsert:
+		err := db.InsertDocument(collection, change.ID, change.Doc)
+		if !errors.Is(err, ErrDocumentExists) {
+			return "", err
+		}
+		if policy == SyncServerWins {
+			return fmt.Sprintf("document %s already exists on the server", change.ID), nil
+		}
+		return "", db.UpdateDocument(collection, change.ID, change.Doc)
+	case OpUpdate:
+		err := db.UpdateDocument(collection, change.ID, change.Doc)
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			return "", err
+		}
+		if policy != SyncClientWins {
+			return fmt.Sprintf("document %s was deleted on the server", change.ID), nil
+		}
+		return "", db.InsertDocument(collection, change.ID, change.Doc)
+	case OpDelete:
+		if _, err := db.GetDocument(collection, change.ID); err != nil {
+			// Already deleted, the outcome the client wanted
+			return "", nil
+		}
+		if changed > 0 && policy == SyncMerge {
+			return fmt.Sprintf("document %s changed on the server since the last sync", change.ID), nil
+		}
+		err := db.DeleteDocument(collection, change.ID)
+		if err != nil && strings.Contains(err.Error(), "not found") {
+			return "", nil
+		}
+		return "", err
+	}
+	return "", fmt.Errorf("unknown operation %q, expected insert, update or delete", change.Op)
+}
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func syncChanges(result *SyncResult) map[string]SyncDocument {
+	changes := make(map[string]SyncDocument)
+	for _, change := range result.Changes {
+		changes[change.ID] = change
+	}
+	return changes
+}
+
+func TestSyncCollection(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+	for _, id := range []string{"a", "b", "c"} {
+		if err := db.InsertDocument("notes", id, Document{"text": id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first, err := db.SyncCollection(ctx, "notes", SyncRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.Reset || len(first.Changes) != 3 {
+		t.Fatalf("expected the first sync to send the whole collection, got %+v", first)
+	}
+
+	// While the client is offline, the server changes b and deletes c
+	if err := db.UpdateDocument("notes", "b", Document{"text": "server"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteDocument("notes", "c"); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := db.SyncCollection(ctx, "notes", SyncRequest{
+		Token: first.Token,
+		Changes: []SyncChange{
+			{ID: "a", Op: OpUpdate, Doc: Document{"text": "client"}},
+			{ID: "b", Op: OpUpdate, Doc: Document{"text": "client"}},
+			{ID: "d", Op: OpInsert, Doc: Document{"text": "new"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Reset || second.Applied != 2 || len(second.Conflicts) != 1 || second.Conflicts[0].Key != "b" || second.Conflicts[0].Index != 1 {
+		t.Fatalf("expected b to conflict under server_wins, got %+v", second)
+	}
+	changes := syncChanges(second)
+	if len(changes) != 4 || changes["b"].Doc["text"] != "server" || !changes["c"].Deleted || changes["a"].Doc["text"] != "client" || changes["d"].Doc == nil {
+		t.Fatalf("unexpected changes %+v", second.Changes)
+	}
+
+	// Nothing changed since, so the next sync sends nothing
+	third, err := db.SyncCollection(ctx, "notes", SyncRequest{Token: second.Token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.Reset || len(third.Changes) != 0 {
+		t.Fatalf("expected no changes, got %+v", third)
+	}
+
+	// Under merge, a concurrent update merges and a delete does not discard it
+	if err := db.UpdateDocument("notes", "a", Document{"pinned": true}); err != nil {
+		t.Fatal(err)
+	}
+	merged, err := db.SyncCollection(ctx, "notes", SyncRequest{
+		Token:  third.Token,
+		Policy: SyncMerge,
+		Changes: []SyncChange{
+			{ID: "a", Op: OpUpdate, Doc: Document{"text": "merged"}},
+			{ID: "a", Op: OpDelete},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.Applied != 1 || len(merged.Conflicts) != 1 || merged.Conflicts[0].Index != 1 {
+		t.Fatalf("expected the delete to conflict, got %+v", merged)
+	}
+	if doc := syncChanges(merged)["a"].Doc; doc["text"] != "merged" || doc["pinned"] != true {
+		t.Fatalf("expected both updates to be kept, got %v", doc)
+	}
+}
+
+func TestSyncCollectionTokens(t *testing.T) {
+	db := newTestDatabase(t)
+	if _, err := db.SyncCollection(context.Background(), "notes", SyncRequest{Token: "not a token"}); !errors.Is(err, ErrSyncToken) {
+		t.Fatalf("expected an invalid token to be rejected, got %v", err)
+	}
+	// Tokens of another run answer with a reset
+	other := newSyncJournal()
+	other.epoch++
+	result, err := db.SyncCollection(context.Background(), "notes", SyncRequest{Token: other.token(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Reset {
+		t.Fatal("expected a token of another run to reset the client")
+	}
+	if _, err := db.SyncCollection(context.Background(), "notes", SyncRequest{Policy: "newest"}); err == nil {
+		t.Fatal("expected an unknown policy to be rejected")
+	}
+}
+
+// syncSince syncs collection from token, failing the test on errors
+func syncSince(t *testing.T, db *MultiModelDatabase, collection, token string) *SyncResult {
+	t.Helper()
+	result, err := db.SyncCollection(context.Background(), collection, SyncRequest{Token: token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestSyncSeesMigratedDocuments(t *testing.T) {
+	db := newTestDatabase(t)
+	for _, id := range []string{"a", "b"} {
+		if err := db.InsertDocument("notes", id, Document{"text": id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.InsertDocument("notes", "c", Document{"text": "c", "tag": "kept"}); err != nil {
+		t.Fatal(err)
+	}
+	first := syncSince(t, db, "notes", "")
+
+	migration := Migration{Version: 1, Steps: []MigrationStep{{Op: MigrationBackfill, Collection: "notes", Field: "tag", Value: "none"}}}
+	if _, err := db.Migrate([]Migration{migration}, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	second := syncSince(t, db, "notes", first.Token)
+	changes := syncChanges(second)
+	if second.Reset || len(changes) != 2 || changes["a"].Doc["tag"] != "none" || changes["b"].Doc["tag"] != "none" {
+		t.Fatalf("sync after a migration = %+v", second)
+	}
+}
+
+func TestSyncResetsAfterRestores(t *testing.T) {
+	db := newTestDatabase(t)
+	if err := db.InsertDocument("notes", "a", Document{"text": "before"}); err != nil {
+		t.Fatal(err)
+	}
+	var snapshot bytes.Buffer
+	if _, err := db.WriteSnapshot(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	backup, err := db.Backups.Create(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restores := map[string]func() error{
+		"snapshot": func() error {
+			_, err := db.RestoreSnapshot(bytes.NewReader(snapshot.Bytes()))
+			return err
+		},
+		"backup": func() error {
+			_, err := db.Backups.Restore(backup.ID)
+			return err
+		},
+	}
+	for name, restore := range restores {
+		if err := db.UpdateDocument("notes", "a", Document{"text": "after"}); err != nil {
+			t.Fatal(err)
+		}
+		token := syncSince(t, db, "notes", "").Token
+		if err := restore(); err != nil {
+			t.Fatal(err)
+		}
+		result := syncSince(t, db, "notes", token)
+		if !result.Reset || len(result.Changes) != 1 || result.Changes[0].Doc["text"] != "before" {
+			t.Fatalf("sync after a %s restore = %+v", name, result)
+		}
+		// The token of that sync is answered from the journal again
+		if next := syncSince(t, db, "notes", result.Token); next.Reset || len(next.Changes) != 0 {
+			t.Fatalf("sync after the reset of a %s restore = %+v", name, next)
+		}
+	}
+}
+
+func TestSyncSeesMergedCRDTStates(t *testing.T) {
+	a, b := crdtReplica(t), crdtReplica(t)
+	if err := a.InsertDocument("carts", "c1", Document{"owner": "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.InsertDocument("carts", "c2", Document{"owner": "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	token := syncSince(t, b, "carts", "").Token
+
+	// States pushed by a peer reach b without its write hooks
+	for _, id := range []string{"c1", "c2"} {
+		a.docMutex.RLock()
+		encoded, err := json.Marshal(a.crdt.states["carts."+id])
+		a.docMutex.RUnlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.MergeCRDTState("carts", id, encoded); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.DeleteDocument("carts", "c2"); err != nil {
+		t.Fatal(err)
+	}
+	exchange(t, a, b, "c2")
+
+	result := syncSince(t, b, "carts", token)
+	changes := syncChanges(result)
+	if result.Reset || len(changes) != 2 || changes["c1"].Doc["owner"] != "alice" || !changes["c2"].Deleted {
+		t.Fatalf("sync after merges = %+v", result)
+	}
+}
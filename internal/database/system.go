@@ -0,0 +1,220 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrSystemCollection is returned for writes to system collections
+var ErrSystemCollection = errors.New("system collections are read-only")
+
+// System collections expose the state of the engine as documents, so tooling can
+// query it through the document API: GET /docs/_system.indexes?collection=orders.
+// Their documents are built on every read and cannot be written.
+const (
+	// SystemCollections lists the collections with their sizes and settings
+	SystemCollections = "_system.collections"
+	// SystemIndexes lists the secondary indexes with their statistics
+	SystemIndexes = "_system.indexes"
+	// SystemNodes lists the cluster members, or this node alone without a cluster
+	SystemNodes = "_system.nodes"
+	// SystemJobs lists the scheduled jobs with their last results
+	SystemJobs = "_system.jobs"
+	// SystemLabels lists the node labels and edge types of the graph store
+	SystemLabels = "_system.labels"
+)
+
+// IsSystemCollection reports whether collection is one of the system collections or
+// a projection view of a column family, whose documents are built in the same way
+func IsSystemCollection(collection string) bool {
+	switch collection {
+	case SystemCollections, SystemIndexes, SystemNodes, SystemJobs, SystemLabels:
+		return true
+	}
+	_, isView := viewedFamily(collection)
+	return isView
+}
+
+// systemDocuments returns the documents of a system collection by id
+func (db *MultiModelDatabase) systemDocuments(collection string) (map[string]Document, error) {
+	docs := make(map[string]interface{})
+	switch collection {
+	case SystemCollections:
+		for _, info := range db.collectionInfos() {
+			docs[info.Name] = info
+		}
+	case SystemIndexes:
+		for _, name := range db.ListCollections() {
+			for _, spec := range db.ListIndexes(name) {
+				index := db.indexes.get(name, spec.Field)
+				if index == nil {
+					continue
+				}
+				_, stats := index.ids(db, nil)
+				stats.Histogram = nil
+				docs[name+"."+spec.Field] = struct {
+					IndexSpec
+					IndexStats
+				}{spec, stats}
+			}
+		}
+	case SystemNodes:
+		if db.Cluster == nil {
+			host, _ := os.Hostname()
+			docs[host] = map[string]interface{}{"id": host, "status": "active", "self": true}
+			break
+		}
+		self := db.Cluster.Self().ID
+		for _, node := range db.Cluster.Nodes() {
+			docs[node.ID] = struct {
+				*Node
+				Self bool `json:"self"`
+			}{node, node.ID == self}
+		}
+	case SystemJobs:
+		for _, job := range db.Scheduler.ListJobs() {
+			docs[job.ID] = job
+		}
+	case SystemLabels:
+		for _, label := range db.graphLabels() {
+			docs[label.Kind+":"+label.Name] = label
+		}
+	default:
+		family, isView := viewedFamily(collection)
+		if !isView {
+			return nil, fmt.Errorf("collection %s is not a system collection", collection)
+		}
+		var err error
+		if docs, err = db.familyDocuments(family, ColumnScan{}); err != nil {
+			return nil, err
+		}
+	}
+	return asDocuments(docs)
+}
+
+// asDocuments converts values to documents by id. They go through JSON like stored
+// documents, so filters see the same types.
+func asDocuments(docs map[string]interface{}) (map[string]Document, error) {
+	encoded, err := json.Marshal(docs)
+	if err != nil {
+		return nil, err
+	}
+	var decoded map[string]Document
+	if err := DecodeJSON(encoded, &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// collectionInfo is a document of SystemCollections
+type collectionInfo struct {
+	Name         string    `json:"name"`
+	Documents    int       `json:"documents"`
+	Tiered       int       `json:"tiered"` // documents held in the object store
+	Archived     bool      `json:"archived"`
+	Consistency  string    `json:"consistency"`
+	Priority     string    `json:"priority"`
+	Indexes      int       `json:"indexes"`
+	Computed     int       `json:"computed"`
+	Version      int64     `json:"version"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+func (db *MultiModelDatabase) collectionInfos() []collectionInfo {
+	names := db.ListCollections()
+	infos := make([]collectionInfo, len(names))
+	byName := make(map[string]*collectionInfo, len(names))
+	for i, name := range names {
+		stamp := db.CollectionStamp(name)
+		infos[i] = collectionInfo{
+			Name:         name,
+			Consistency:  db.CollectionConsistency(name),
+			Priority:     db.CollectionPriority(name),
+			Indexes:      len(db.ListIndexes(name)),
+			Computed:     len(db.computed.get(name, false)) + len(db.computed.get(name, true)),
+			Version:      stamp.Version,
+			LastModified: stamp.Modified.UTC(),
+		}
+		byName[name] = &infos[i]
+	}
+
+	db.docMutex.RLock()
+	defer db.docMutex.RUnlock()
+	count := func(key string, tiered bool) {
+		name, _, _ := strings.Cut(key, ".")
+		if info := byName[name]; info != nil {
+			info.Documents++
+			if tiered {
+				info.Tiered++
+			}
+		}
+	}
+	for key := range db.documents {
+		count(key, false)
+	}
+	for key := range db.coldDocs {
+		count(key, true)
+	}
+	for name, a := range db.archives {
+		if info := byName[name]; info != nil {
+			info.Archived = true
+			info.Documents += a.len()
+		}
+	}
+	return infos
+}
+
+// findSystemDocuments returns the documents of a system collection matching filter
+func (db *MultiModelDatabase) findSystemDocuments(guard *queryGuard, collection string, filter map[string]interface{}, collation Collation) ([]Document, error) {
+	docs, err := db.systemDocuments(collection)
+	if err != nil {
+		return nil, err
+	}
+	var results []Document
+	for _, id := range sortedKeys(docs) {
+		if err := guard.examine(); err != nil {
+			return results, err
+		}
+		if collation.objectMatches(docs[id], filter) {
+			results = append(results, docs[id])
+		}
+	}
+	return results, nil
+}
+
+// graphLabel is a document of SystemLabels
+type graphLabel struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`  // node for node labels, edge for edge types
+	Count int    `json:"count"` // nodes with the label, or edges of the type
+}
+
+func (db *MultiModelDatabase) graphLabels() []graphLabel {
+	db.graphMutex.RLock()
+	defer db.graphMutex.RUnlock()
+
+	nodes := make(map[string]int)
+	for _, node := range db.graphNodes {
+		for _, label := range node.Labels {
+			nodes[label]++
+		}
+	}
+	edges := make(map[string]int)
+	for _, edge := range db.graphEdges {
+		if edge.Type != "" {
+			edges[edge.Type]++
+		}
+	}
+	labels := make([]graphLabel, 0, len(nodes)+len(edges))
+	for name, count := range nodes {
+		labels = append(labels, graphLabel{Name: name, Kind: "node", Count: count})
+	}
+	for name, count := range edges {
+		labels = append(labels, graphLabel{Name: name, Kind: "edge", Count: count})
+	}
+	return labels
+}
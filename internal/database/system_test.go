@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestSystemCollections(t *testing.T) {
+	db := newTestDatabase(t)
+	for _, id := range []string{"o1", "o2", "o3"} {
+		if err := db.InsertDocument("orders", id, Document{"status": "open"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.InsertDocument("users", "u1", Document{"name": "ann"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateIndex(IndexSpec{Collection: "orders", Field: "status"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// System collections answer queries written as for any other collection
+	filter, err := ParseQueryFilters(url.Values{"documents:int": {"3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	collections, err := db.QueryDocuments(SystemCollections, filter)
+	if err != nil || len(collections) != 1 || collections[0]["name"] != "orders" || collections[0]["indexes"] != json.Number("1") {
+		t.Fatalf("collections = %v, %v", collections, err)
+	}
+	indexes, err := db.QueryDocuments(SystemIndexes, map[string]interface{}{"collection": "orders"})
+	if err != nil || len(indexes) != 1 || indexes[0]["field"] != "status" || indexes[0]["cardinality"] != json.Number("1") {
+		t.Fatalf("indexes = %v, %v", indexes, err)
+	}
+	if nodes, err := db.FindDocuments(context.Background(), SystemNodes, DocumentQuery{}); err != nil || len(nodes) != 1 || nodes[0]["self"] != true {
+		t.Fatalf("nodes = %v, %v", nodes, err)
+	}
+	if _, err := db.Scheduler.PutJob("nightly", "0 3 * * *", JobAction{Type: JobActionEnqueue, Queue: "maintenance"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := db.QueryDocuments(SystemJobs, map[string]interface{}{"id": "nightly"}); err != nil || len(jobs) != 1 || jobs[0]["enabled"] != false {
+		t.Fatalf("jobs = %v, %v", jobs, err)
+	}
+	for _, id := range []string{"n1", "n2"} {
+		if err := db.CreateNode(id, []string{"Person"}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.CreateEdge("e1", "n1", "n2", "KNOWS", nil); err != nil {
+		t.Fatal(err)
+	}
+	if labels, err := db.QueryDocuments(SystemLabels, map[string]interface{}{"kind": "node"}); err != nil || len(labels) != 1 || labels[0]["name"] != "Person" || labels[0]["count"] != json.Number("2") {
+		t.Fatalf("labels = %v, %v", labels, err)
+	}
+	if doc, err := db.GetDocument(SystemLabels, "edge:KNOWS"); err != nil || doc["count"] != json.Number("1") {
+		t.Fatalf("edge type = %v, %v", doc, err)
+	}
+	if doc, err := db.GetDocument(SystemCollections, "users"); err != nil || doc["documents"] != json.Number("1") {
+		t.Fatalf("users = %v, %v", doc, err)
+	}
+
+	for _, write := range []error{
+		db.InsertDocument(SystemCollections, "x", Document{}),
+		db.UpdateDocument(SystemCollections, "orders", Document{"documents": 0}),
+		db.DeleteDocument(SystemJobs, "nightly"),
+	} {
+		if !errors.Is(write, ErrSystemCollection) {
+			t.Errorf("write to a system collection: %v", write)
+		}
+	}
+}
@@ -0,0 +1,585 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"multimodel-db-engine/internal/config"
+)
+
+// TieringOptions configures moving cold data to an object store
+type TieringOptions struct {
+	ColdAfter time.Duration // idle time after which documents and column rows are moved
+	Interval  time.Duration // time between sweeps
+	Prefix    string        // object key prefix
+}
+
+// TieringStats reports the state of tiering
+type TieringStats struct {
+	ColdDocuments int       `json:"cold_documents"`
+	ColdRows      int       `json:"cold_rows"`
+	Moved         uint64    `json:"moved"`   // documents and rows moved to the object store
+	Fetched       uint64    `json:"fetched"` // brought back into memory on access
+	LastSweep     time.Time `json:"last_sweep,omitempty"`
+	LastError     string    `json:"last_error,omitempty"`
+}
+
+// Tiering moves documents and column rows that have not been read or written for
+// ColdAfter to an object store, leaving a stub in memory. Cold data is fetched back
+// transparently: point reads and writes bring back the one document or row, while
+// queries, scans and collection operations first bring back what they cover.
+type Tiering struct {
+	db      *MultiModelDatabase
+	store   ObjectStore
+	options TieringOptions
+
+	// Last access per document and row, in memory only: after a restart everything
+	// counts as accessed at startup
+	access      map[string]time.Time
+	accessMutex sync.Mutex
+
+	moved     uint64
+	fetched   uint64
+	lastSweep time.Time
+	lastError string
+	sweep     sync.Mutex // serializes sweeps and guards lastSweep and lastError
+}
+
+// coldStub stands in for a tiered document or row
+type coldStub struct {
+	object   string
+	tieredAt time.Time
+}
+
+// EnableTiering starts moving cold data to store. It is meant to be called at
+// startup, before the server accepts requests.
+func (db *MultiModelDatabase) EnableTiering(store ObjectStore, options TieringOptions) (*Tiering, error) {
+	if options.ColdAfter <= 0 {
+		return nil, fmt.Errorf("tiering requires a positive cold-after duration")
+	}
+	if options.Interval <= 0 {
+		options.Interval = time.Hour
+	}
+	options.Prefix = strings.Trim(options.Prefix, "/")
+
+	db.Tiering = &Tiering{db: db, store: store, options: options, access: make(map[string]time.Time)}
+	db.routines.run("tiering", func() { db.Tiering.start(db.ctx) })
+	return db.Tiering, nil
+}
+
+// enableS3Tiering enables tiering to the S3 bucket named in the configuration
+func (db *MultiModelDatabase) enableS3Tiering(cfg *config.Config) {
+	store, err := NewS3Store(S3Options{
+		Endpoint:  cfg.TierEndpoint,
+		Bucket:    cfg.TierBucket,
+		Region:    cfg.TierRegion,
+		AccessKey: cfg.TierAccessKey,
+		SecretKey: cfg.TierSecretKey,
+	})
+	if err == nil {
+		_, err = db.EnableTiering(store, TieringOptions{
+			ColdAfter: time.Duration(cfg.TierColdDays) * 24 * time.Hour,
+			Prefix:    cfg.TierPrefix,
+		})
+	}
+	if err != nil {
+		log.Printf("Tiering disabled: %v", err)
+	}
+}
+
+func (t *Tiering) start(ctx context.Context) {
+	ticker := time.NewTicker(t.options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := t.Sweep(); err != nil {
+				log.Printf("Tiering sweep failed: %v", err)
+			}
+		}
+	}
+}
+
+func documentAccessKey(key string) string {
+	return "d\x00" + key
+}
+
+func rowAccessKey(family, row string) string {
+	return "c\x00" + family + "\x00" + row
+}
+
+// touch records an access. It is a no-op when tiering is disabled.
+func (t *Tiering) touch(key string) {
+	if t == nil {
+		return
+	}
+	t.accessMutex.Lock()
+	t.access[key] = time.Now()
+	t.accessMutex.Unlock()
+}
+
+// idle reports whether key has not been accessed since cutoff. Keys seen for the
+// first time count as accessed now.
+func (t *Tiering) idle(key string, now, cutoff time.Time) bool {
+	t.accessMutex.Lock()
+	defer t.accessMutex.Unlock()
+	last, seen := t.access[key]
+	if !seen {
+		t.access[key] = now
+		return false
+	}
+	return last.Before(cutoff)
+}
+
+func (t *Tiering) forget(key string) {
+	t.accessMutex.Lock()
+	delete(t.access, key)
+	t.accessMutex.Unlock()
+}
+
+func (t *Tiering) documentObject(collection, id string) string {
+	return t.objectKey("documents", collection, id)
+}
+
+func (t *Tiering) rowObject(family, row string) string {
+	return t.objectKey("rows", family, row)
+}
+
+func (t *Tiering) objectKey(kind, namespace, key string) string {
+	object := kind + "/" + url.PathEscape(namespace) + "/" + url.PathEscape(key) + ".json"
+	if t.options.Prefix != "" {
+		object = t.options.Prefix + "/" + object
+	}
+	return object
+}
+
+// Stats returns the tiering counters
+func (t *Tiering) Stats() TieringStats {
+	db := t.db
+	stats := TieringStats{Moved: atomic.LoadUint64(&t.moved), Fetched: atomic.LoadUint64(&t.fetched)}
+
+	db.docMutex.RLock()
+	stats.ColdDocuments = len(db.coldDocs)
+	db.docMutex.RUnlock()
+	db.colMutex.RLock()
+	for _, cf := range db.columnFamilies {
+		stats.ColdRows += len(cf.cold)
+	}
+	db.colMutex.RUnlock()
+
+	t.sweep.Lock()
+	stats.LastSweep, stats.LastError = t.lastSweep, t.lastError
+	t.sweep.Unlock()
+	return stats
+}
+
+// tierCandidate is a document or row selected for tiering
+type tierCandidate struct {
+	namespace string
+	key       string
+	object    string
+	data      []byte
+	version   int64 // collection stamp when selected, documents only
+}
+
+// Sweep moves documents and rows idle for longer than ColdAfter to the object store
+// and returns how many were moved. Objects are uploaded without holding engine
+// locks; entries changed meanwhile stay in memory until the next sweep.
+func (t *Tiering) Sweep() (int, error) {
+	t.sweep.Lock()
+	defer t.sweep.Unlock()
+
+	moved, err := t.sweepDocuments()
+	if err == nil {
+		var rows int
+		rows, err = t.sweepRows()
+		moved += rows
+	}
+	atomic.AddUint64(&t.moved, uint64(moved))
+	t.lastSweep = time.Now().UTC()
+	t.lastError = ""
+	if err != nil {
+		t.lastError = err.Error()
+	}
+	return moved, err
+}
+
+func (t *Tiering) sweepDocuments() (int, error) {
+	db := t.db
+	now := time.Now()
+	cutoff := now.Add(-t.options.ColdAfter)
+
+	var candidates []tierCandidate
+	db.docMutex.RLock()
+	for key, doc := range db.documents {
+		// System collections such as _migrations are read under the engine lock
+		if strings.HasPrefix(key, "_") || !t.idle(documentAccessKey(key), now, cutoff) {
+			continue
+		}
+		idx := strings.Index(key, ".")
+		collection, id := key[:idx], key[idx+1:]
+		data, err := json.Marshal(doc)
+		if err != nil {
+			db.docMutex.RUnlock()
+			return 0, fmt.Errorf("failed to encode document %s/%s: %w", collection, id, err)
+		}
+		candidates = append(candidates, tierCandidate{
+			namespace: collection,
+			key:       id,
+			object:    t.documentObject(collection, id),
+			data:      data,
+			version:   db.docStamps[collection].Version,
+		})
+	}
+	db.docMutex.RUnlock()
+
+	uploaded, err := t.upload(candidates)
+
+	db.docMutex.Lock()
+	var stale []string
+	moved := 0
+	for _, c := range uploaded {
+		key := c.namespace + "." + c.key
+		if _, exists := db.documents[key]; !exists || db.docStamps[c.namespace].Version != c.version {
+			stale = append(stale, c.object)
+			continue
+		}
+		delete(db.documents, key)
+		db.rawDocs.forget(key)
+		db.coldDocs[key] = coldStub{object: c.object, tieredAt: now}
+		t.forget(documentAccessKey(key))
+		moved++
+	}
+	db.docMutex.Unlock()
+
+	t.discard(stale)
+	return moved, err
+}
+
+func (t *Tiering) sweepRows() (int, error) {
+	db := t.db
+	now := time.Now()
+	cutoff := now.Add(-t.options.ColdAfter)
+
+	var candidates []tierCandidate
+	db.colMutex.RLock()
+	for family, cf := range db.columnFamilies {
+		var rowErr error
+		cf.rows.Ascend("", "", func(rowKey string, row map[string]interface{}) bool {
+			if !t.idle(rowAccessKey(family, rowKey), now, cutoff) {
+				return true
+			}
+			// Cells are stored decoded and recompressed when fetched back, like snapshots
+			decoded, err := cf.decodeRow(row)
+			if err == nil {
+				var data []byte
+				if data, err = json.Marshal(decoded); err == nil {
+					candidates = append(candidates, tierCandidate{
+						namespace: family,
+						key:       rowKey,
+						object:    t.rowObject(family, rowKey),
+						data:      data,
+					})
+				}
+			}
+			rowErr = err
+			return err == nil
+		})
+		if rowErr != nil {
+			db.colMutex.RUnlock()
+			return 0, fmt.Errorf("failed to encode row in column family %s: %w", family, rowErr)
+		}
+	}
+	db.colMutex.RUnlock()
+
+	uploaded, err := t.upload(candidates)
+
+	db.colMutex.Lock()
+	var stale []string
+	moved := 0
+	for _, c := range uploaded {
+		cf, exists := db.columnFamilies[c.namespace]
+		var row map[string]interface{}
+		if exists {
+			row, exists = cf.rows.Get(c.key)
+		}
+		// Rows are updated in place, so compare contents rather than identity
+		if !exists || !rowUnchanged(cf, row, c.data) {
+			stale = append(stale, c.object)
+			continue
+		}
+		cf.rows.Delete(c.key)
+		if cf.cold == nil {
+			cf.cold = make(map[string]coldStub)
+		}
+		cf.cold[c.key] = coldStub{object: c.object, tieredAt: now}
+		t.forget(rowAccessKey(c.namespace, c.key))
+		moved++
+	}
+	db.colMutex.Unlock()
+
+	t.discard(stale)
+	return moved, err
+}
+
+// rowUnchanged reports whether row still encodes to data
+func rowUnchanged(cf *ColumnFamily, row map[string]interface{}, data []byte) bool {
+	decoded, err := cf.decodeRow(row)
+	if err != nil {
+		return false
+	}
+	current, err := json.Marshal(decoded)
+	return err == nil && string(current) == string(data)
+}
+
+// upload stores candidates, returning those stored before the first failure
+func (t *Tiering) upload(candidates []tierCandidate) ([]tierCandidate, error) {
+	for i, c := range candidates {
+		if err := t.store.Put(c.object, c.data); err != nil {
+			return candidates[:i], fmt.Errorf("failed to upload %s: %w", c.object, err)
+		}
+	}
+	return candidates, nil
+}
+
+// discard deletes objects that are no longer referenced, logging failures
+func (t *Tiering) discard(objects []string) {
+	for _, object := range objects {
+		if err := t.store.Delete(object); err != nil {
+			log.Printf("Tiering: failed to delete %s: %v", object, err)
+		}
+	}
+}
+
+// warmDocument brings a tiered document back into memory and records the access.
+// It is a no-op when tiering is disabled.
+func (db *MultiModelDatabase) warmDocument(collection, id string) error {
+	if db.Tiering == nil {
+		return nil
+	}
+	t := db.Tiering
+	key := collection + "." + id
+	t.touch(documentAccessKey(key))
+
+	db.docMutex.RLock()
+	stub, cold := db.coldDocs[key]
+	db.docMutex.RUnlock()
+	if !cold {
+		return nil
+	}
+
+	data, err := t.store.Get(stub.object)
+	if err != nil {
+		return fmt.Errorf("failed to fetch tiered document %s/%s: %w", collection, id, err)
+	}
+	var doc Document
+	if err := DecodeJSON(data, &doc); err != nil {
+		return fmt.Errorf("invalid tiered document %s/%s: %w", collection, id, err)
+	}
+
+	db.docMutex.Lock()
+	current, still := db.coldDocs[key]
+	if still && current == stub {
+		delete(db.coldDocs, key)
+		db.documents[key] = db.compressDocument(doc)
+	}
+	db.docMutex.Unlock()
+
+	if still && current == stub {
+		// The document is back without a change of the collection stamp
+		db.indexes.invalidate(collection)
+		atomic.AddUint64(&t.fetched, 1)
+		t.discard([]string{stub.object})
+	}
+	return nil
+}
+
+// warmCollection brings back every tiered document of collection, or of all
+// collections when collection is empty
+func (db *MultiModelDatabase) warmCollection(collection string) error {
+	if db.Tiering == nil {
+		return nil
+	}
+
+	db.docMutex.RLock()
+	var keys []string
+	for key := range db.coldDocs {
+		if collection == "" || strings.HasPrefix(key, collection+".") {
+			keys = append(keys, key)
+		}
+	}
+	db.docMutex.RUnlock()
+
+	for _, key := range keys {
+		idx := strings.Index(key, ".")
+		if err := db.warmDocument(key[:idx], key[idx+1:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropColdDocument forgets a tiered document that is being deleted. Callers must
+// hold the docMutex write lock; it reports whether the document was cold.
+func (db *MultiModelDatabase) dropColdDocument(key string) bool {
+	stub, cold := db.coldDocs[key]
+	if !cold {
+		return false
+	}
+	delete(db.coldDocs, key)
+	go db.Tiering.discard([]string{stub.object})
+	return true
+}
+
+// warmRow brings a tiered row back into memory and records the access. It is a
+// no-op when tiering is disabled.
+func (db *MultiModelDatabase) warmRow(family, rowKey string) error {
+	if db.Tiering == nil {
+		return nil
+	}
+	t := db.Tiering
+	t.touch(rowAccessKey(family, rowKey))
+
+	db.colMutex.RLock()
+	var stub coldStub
+	var cold bool
+	if cf, exists := db.columnFamilies[family]; exists {
+		stub, cold = cf.cold[rowKey]
+	}
+	db.colMutex.RUnlock()
+	if !cold {
+		return nil
+	}
+
+	data, err := t.store.Get(stub.object)
+	if err != nil {
+		return fmt.Errorf("failed to fetch tiered row %s/%s: %w", family, rowKey, err)
+	}
+	var columns map[string]interface{}
+	if err := json.Unmarshal(data, &columns); err != nil {
+		return fmt.Errorf("invalid tiered row %s/%s: %w", family, rowKey, err)
+	}
+
+	db.colMutex.Lock()
+	cf, exists := db.columnFamilies[family]
+	var current coldStub
+	var still bool
+	if exists {
+		current, still = cf.cold[rowKey]
+	}
+	if still && current == stub {
+		row := cf.rows.GetOrCreate(rowKey)
+		for column, value := range columns {
+			stored, err := compressValue(cf.options.Compression, cf.options.CompressionThreshold, value)
+			if err != nil {
+				db.colMutex.Unlock()
+				return err
+			}
+			row[column] = stored
+		}
+		delete(cf.cold, rowKey)
+	}
+	db.colMutex.Unlock()
+
+	if still && current == stub {
+		atomic.AddUint64(&t.fetched, 1)
+		t.discard([]string{stub.object})
+	}
+	return nil
+}
+
+// warmRows brings back the tiered rows of family that a scan covers
+func (db *MultiModelDatabase) warmRows(family string, scan ColumnScan) error {
+	if db.Tiering == nil {
+		return nil
+	}
+
+	db.colMutex.RLock()
+	var keys []string
+	if cf, exists := db.columnFamilies[family]; exists {
+		for rowKey := range cf.cold {
+			if rowKey >= scan.StartRow && (scan.EndRow == "" || rowKey < scan.EndRow) && strings.HasPrefix(rowKey, scan.Prefix) {
+				keys = append(keys, rowKey)
+			}
+		}
+	}
+	db.colMutex.RUnlock()
+
+	for _, rowKey := range keys {
+		if err := db.warmRow(family, rowKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// coldSnapshotData fetches tiered documents and rows for a snapshot without
+// bringing them back into memory. Entries warmed or deleted while fetching are
+// skipped by the caller, which checks the stubs again under the engine locks.
+func (db *MultiModelDatabase) coldSnapshotData() (docs map[string]coldEntry, rows map[string]map[string]coldEntry, err error) {
+	if db.Tiering == nil {
+		return nil, nil, nil
+	}
+
+	docStubs := make(map[string]coldStub)
+	db.docMutex.RLock()
+	for key, stub := range db.coldDocs {
+		docStubs[key] = stub
+	}
+	db.docMutex.RUnlock()
+	rowStubs := make(map[string]map[string]coldStub)
+	db.colMutex.RLock()
+	for family, cf := range db.columnFamilies {
+		for rowKey, stub := range cf.cold {
+			if rowStubs[family] == nil {
+				rowStubs[family] = make(map[string]coldStub)
+			}
+			rowStubs[family][rowKey] = stub
+		}
+	}
+	db.colMutex.RUnlock()
+
+	fetch := func(stub coldStub) (coldEntry, error) {
+		data, err := db.Tiering.store.Get(stub.object)
+		if err != nil {
+			return coldEntry{}, err
+		}
+		var value map[string]interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return coldEntry{}, fmt.Errorf("invalid tiered object %s: %w", stub.object, err)
+		}
+		return coldEntry{stub: stub, value: value}, nil
+	}
+
+	docs = make(map[string]coldEntry, len(docStubs))
+	for key, stub := range docStubs {
+		if docs[key], err = fetch(stub); err != nil {
+			return nil, nil, err
+		}
+	}
+	rows = make(map[string]map[string]coldEntry, len(rowStubs))
+	for family, stubs := range rowStubs {
+		rows[family] = make(map[string]coldEntry, len(stubs))
+		for rowKey, stub := range stubs {
+			if rows[family][rowKey], err = fetch(stub); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return docs, rows, nil
+}
+
+// coldEntry is a tiered document or row fetched for a snapshot
+type coldEntry struct {
+	stub  coldStub
+	value map[string]interface{}
+}
@@ -0,0 +1,164 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testColdAfter = 20 * time.Millisecond
+
+// newTieredDatabase returns a database whose entries turn cold after testColdAfter
+func newTieredDatabase(t *testing.T) (*MultiModelDatabase, *MemoryObjectStore) {
+	t.Helper()
+	db := newTestDatabase(t)
+	store := NewMemoryObjectStore()
+	if _, err := db.EnableTiering(store, TieringOptions{ColdAfter: testColdAfter, Interval: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	return db, store
+}
+
+// ageOut runs a sweep that records first sightings, waits past the cold threshold
+// while touch keeps some entries hot, and sweeps again
+func ageOut(t *testing.T, db *MultiModelDatabase, touch func()) int {
+	t.Helper()
+	if _, err := db.Tiering.Sweep(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * testColdAfter)
+	touch()
+	moved, err := db.Tiering.Sweep()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return moved
+}
+
+func TestTieringDocuments(t *testing.T) {
+	db, store := newTieredDatabase(t)
+	for _, id := range []string{"hot", "cold1", "cold2"} {
+		if err := db.InsertDocument("events", id, Document{"id": id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	moved := ageOut(t, db, func() {
+		if _, err := db.GetDocument("events", "hot"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if moved != 2 || store.Len() != 2 {
+		t.Fatalf("moved %d documents, %d objects stored", moved, store.Len())
+	}
+	if stats := db.Tiering.Stats(); stats.ColdDocuments != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if err := db.InsertDocument("events", "cold1", Document{}); err == nil {
+		t.Fatal("insert over a tiered document succeeded")
+	}
+	if got := db.ListCollections(); len(got) != 1 || got[0] != "events" {
+		t.Fatalf("unexpected collections %v", got)
+	}
+
+	// Snapshots include tiered documents without bringing them back
+	var snapshot bytes.Buffer
+	if _, err := db.WriteSnapshot(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(snapshot.String(), `"key":"cold2"`) || db.Tiering.Stats().ColdDocuments != 2 {
+		t.Fatal("snapshot missed a tiered document")
+	}
+
+	doc, err := db.GetDocument("events", "cold1")
+	if err != nil || doc["id"] != "cold1" {
+		t.Fatalf("tiered document not fetched: %v, %v", doc, err)
+	}
+	if store.Len() != 1 {
+		t.Fatalf("fetched object not deleted, %d stored", store.Len())
+	}
+	if err := db.DeleteDocument("events", "cold2"); err != nil {
+		t.Fatal(err)
+	}
+	docs, err := db.QueryDocuments("events", nil)
+	if err != nil || len(docs) != 2 {
+		t.Fatalf("query returned %d documents: %v", len(docs), err)
+	}
+	if stats := db.Tiering.Stats(); stats.ColdDocuments != 0 || stats.Fetched != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestTieringColumnRows(t *testing.T) {
+	db, store := newTieredDatabase(t)
+	if err := db.SetColumnFamilyOptions("metrics", ColumnFamilyOptions{Compression: "gzip", CompressionThreshold: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []string{"r1", "r2", "r3"} {
+		if err := db.InsertColumn("metrics", row, "cpu", strings.Repeat(row, 10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if moved := ageOut(t, db, func() {}); moved != 3 || store.Len() != 3 {
+		t.Fatalf("moved %d rows, %d objects stored", moved, store.Len())
+	}
+	if value, err := db.GetColumn("metrics", "r1", "cpu"); err != nil || value != strings.Repeat("r1", 10) {
+		t.Fatalf("tiered row not fetched: %v, %v", value, err)
+	}
+	rows, err := db.ScanColumns("metrics", ColumnScan{StartRow: "r2"})
+	if err != nil || len(rows) != 2 || rows[1].Columns["cpu"] != strings.Repeat("r3", 10) {
+		t.Fatalf("scan over tiered rows returned %+v, %v", rows, err)
+	}
+	if stats := db.Tiering.Stats(); stats.ColdRows != 0 || store.Len() != 0 {
+		t.Fatalf("unexpected stats %+v with %d objects", stats, store.Len())
+	}
+}
+
+func TestS3StoreSignsRequests(t *testing.T) {
+	objects := make(map[string][]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20240102/eu-west-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=") {
+			http.Error(w, "bad signature "+auth, http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			body := new(bytes.Buffer)
+			body.ReadFrom(r.Body)
+			objects[r.URL.EscapedPath()] = body.Bytes()
+		case http.MethodGet:
+			data, exists := objects[r.URL.EscapedPath()]
+			if !exists {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(data)
+		}
+	}))
+	defer server.Close()
+
+	store, err := NewS3Store(S3Options{Endpoint: server.URL, Bucket: "cold", Region: "eu-west-1", AccessKey: "AKID", SecretKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	if err := store.Put("documents/a b/1.json", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := objects["/cold/documents/a%20b/1.json"]; !exists {
+		t.Fatalf("object stored under unexpected paths %v", objects)
+	}
+	if data, err := store.Get("documents/a b/1.json"); err != nil || string(data) != "{}" {
+		t.Fatalf("get returned %q, %v", data, err)
+	}
+	if _, err := store.Get("missing"); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("expected ErrObjectNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,348 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrTransferRunning is returned when a state transfer is started while one runs
+var ErrTransferRunning = errors.New("state transfer is already running")
+
+// defaultTransferChunkSize is the number of keys per chunk when none is configured
+const defaultTransferChunkSize = 500
+
+// transferAttempts is how often a chunk is requested before its source is given up
+const transferAttempts = 3
+
+// TransferSource reports the state streamed from one peer
+type TransferSource struct {
+	NodeID string `json:"node_id"`
+	Cursor string `json:"cursor"` // last key the peer scanned; the transfer resumes after it
+	Keys   int    `json:"keys"`
+	Chunks int    `json:"chunks"`
+	Done   bool   `json:"done"`
+	Error  string `json:"error,omitempty"`
+}
+
+// TransferStatus reports the progress of the state transfer that bootstraps this
+// node's partitions
+type TransferStatus struct {
+	State      string           `json:"state"` // idle, running, done or failed
+	StartedAt  *time.Time       `json:"started_at,omitempty"`
+	FinishedAt *time.Time       `json:"finished_at,omitempty"`
+	Keys       int              `json:"keys"` // keys received from all sources
+	Sources    []TransferSource `json:"sources"`
+}
+
+// TransferChunk is a peer's answer to a state transfer request: the pairs after the
+// requested cursor that the requester replicates
+type TransferChunk struct {
+	Pairs  []KeyValue `json:"pairs"`
+	Cursor string     `json:"cursor"`
+	Done   bool       `json:"done"`
+}
+
+// transferRequest is the body of node to node state transfer requests
+type transferRequest struct {
+	Node   *Node  `json:"node"`
+	Cursor string `json:"cursor"`
+	Limit  int    `json:"limit"`
+}
+
+// stateTransfer tracks the state transfer of this node. Source cursors are
+// persisted after every chunk, so a transfer interrupted by a restart resumes where
+// it stopped instead of starting over.
+type stateTransfer struct {
+	path   string
+	status TransferStatus
+	mutex  sync.Mutex
+}
+
+func newStateTransfer(path string) *stateTransfer {
+	return &stateTransfer{path: path, status: TransferStatus{State: "idle", Sources: []TransferSource{}}}
+}
+
+// begin marks the transfer as running with a source per peer, continuing from the
+// persisted cursors of an interrupted transfer
+func (t *stateTransfer) begin(peers []*Node) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.status.State == "running" {
+		return ErrTransferRunning
+	}
+
+	persisted := make(map[string]TransferSource)
+	var saved []TransferSource
+	data, err := os.ReadFile(t.path)
+	if err == nil {
+		err = json.Unmarshal(data, &saved)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Ignoring state transfer cursors: %v", err)
+	}
+	for _, source := range saved {
+		persisted[source.NodeID] = source
+	}
+
+	now := time.Now()
+	t.status = TransferStatus{State: "running", StartedAt: &now, Sources: make([]TransferSource, len(peers))}
+	for i, peer := range peers {
+		source := TransferSource{NodeID: peer.ID}
+		if previous, exists := persisted[peer.ID]; exists {
+			source.Cursor, source.Done = previous.Cursor, previous.Done
+		}
+		t.status.Sources[i] = source
+	}
+	return t.save()
+}
+
+// update applies fn to source i and persists the cursors
+func (t *stateTransfer) update(i int, fn func(source *TransferSource)) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	before := t.status.Sources[i].Keys
+	fn(&t.status.Sources[i])
+	t.status.Keys += t.status.Sources[i].Keys - before
+	if err := t.save(); err != nil {
+		log.Printf("Failed to persist state transfer cursors: %v", err)
+	}
+}
+
+// finish ends the transfer. Completed transfers drop their cursors so the next
+// transfer starts from the beginning.
+func (t *stateTransfer) finish() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	t.status.FinishedAt = &now
+	t.status.State = "done"
+	var failed []string
+	for _, source := range t.status.Sources {
+		if !source.Done {
+			failed = append(failed, source.NodeID)
+		}
+	}
+	if len(failed) > 0 {
+		t.status.State = "failed"
+		return fmt.Errorf("state transfer from %v did not complete", failed)
+	}
+	if err := os.Remove(t.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// save writes the source cursors. Callers must hold the mutex.
+func (t *stateTransfer) save() error {
+	data, err := json.Marshal(t.status.Sources)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0o755); err != nil {
+		return err
+	}
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.path)
+}
+
+func (t *stateTransfer) snapshot() TransferStatus {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	status := t.status
+	status.Sources = append([]TransferSource(nil), t.status.Sources...)
+	return status
+}
+
+// StateTransfer returns the progress of this node's state transfer
+func (db *MultiModelDatabase) StateTransfer() TransferStatus {
+	return db.transfer.snapshot()
+}
+
+// JoinCluster joins the cluster through seed ("host:port" of a member's cluster
+// port) and bootstraps the partitions this node replicates by streaming them from
+// the current members in the background
+func (db *MultiModelDatabase) JoinCluster(seed string) error {
+	if db.Cluster == nil {
+		return fmt.Errorf("clustering is not enabled")
+	}
+	if err := db.Cluster.Join(seed); err != nil {
+		return err
+	}
+	go func() {
+		if err := db.TransferState(); err != nil {
+			log.Printf("State transfer failed: %v", err)
+		}
+	}()
+	return nil
+}
+
+// TransferState streams the default bucket keys this node replicates from every
+// active peer, one peer and one chunk at a time. Chunks are paced to the configured
+// TransferRate and retried before a peer is given up. Keys already present locally
+// are kept, since they were written by live replication after the transfer began.
+func (db *MultiModelDatabase) TransferState() error {
+	if db.Cluster == nil {
+		return fmt.Errorf("clustering is not enabled")
+	}
+
+	self := db.Cluster.Self()
+	var peers []*Node
+	for _, node := range db.Cluster.GetActiveNodes() {
+		if node.ID != self.ID {
+			peers = append(peers, node)
+		}
+	}
+	if err := db.transfer.begin(peers); err != nil {
+		return err
+	}
+	db.Cluster.events.publish(EventRepairStarted, self.ID, map[string]interface{}{"sources": len(peers)})
+
+	limit := db.config.TransferChunkSize
+	if limit <= 0 {
+		limit = defaultTransferChunkSize
+	}
+	pace := newTransferPacer(db.config.TransferRate)
+	for i, peer := range peers {
+		resumed := db.transfer.snapshot().Sources[i]
+		cursor, done := resumed.Cursor, resumed.Done
+		for !done {
+			var chunk TransferChunk
+			var err error
+			for attempt := 1; attempt <= transferAttempts; attempt++ {
+				request := transferRequest{Node: self, Cursor: cursor, Limit: limit}
+				if err = db.Cluster.call(peer, "/data/transfer", request, &chunk); err == nil {
+					break
+				}
+				if !db.sleep(time.Duration(attempt) * 100 * time.Millisecond) {
+					break
+				}
+			}
+			if err != nil {
+				db.transfer.update(i, func(source *TransferSource) { source.Error = err.Error() })
+				break
+			}
+
+			for _, pair := range chunk.Pairs {
+				_, err := db.PutBucketValue(DefaultBucket, pair.Key, pair.Value, PutOptions{IfAbsent: true})
+				if err != nil && !errors.Is(err, ErrKeyExists) {
+					log.Printf("State transfer failed to store %s: %v", pair.Key, err)
+				}
+			}
+			cursor, done = chunk.Cursor, chunk.Done
+			db.transfer.update(i, func(source *TransferSource) {
+				source.Cursor, source.Done, source.Error = cursor, done, ""
+				source.Keys += len(chunk.Pairs)
+				source.Chunks++
+			})
+			db.Cluster.events.publish(EventRepairProgress, self.ID, db.transfer.snapshot().Sources[i])
+			if !pace.wait(db, len(chunk.Pairs)) {
+				break
+			}
+		}
+	}
+	err := db.transfer.finish()
+	status := db.transfer.snapshot()
+	db.Cluster.events.publish(EventRepairFinished, self.ID, map[string]interface{}{"state": status.State, "keys": status.Keys})
+	return err
+}
+
+// TransferChunk returns up to limit default bucket pairs after cursor whose replicas
+// include requester, which is added to the membership when it is not known yet
+func (db *MultiModelDatabase) TransferChunk(requester *Node, cursor string, limit int) (*TransferChunk, error) {
+	if db.Cluster == nil {
+		return nil, fmt.Errorf("clustering is not enabled")
+	}
+	if requester == nil || requester.ID == "" {
+		return nil, fmt.Errorf("state transfer requester is required")
+	}
+	if limit <= 0 {
+		limit = defaultTransferChunkSize
+	}
+	db.Cluster.MergeMembership([]*Node{requester})
+
+	keys, err := db.ListBucketKeys(DefaultBucket, "")
+	if err != nil {
+		return nil, err
+	}
+	start := sort.SearchStrings(keys, cursor)
+	if start < len(keys) && keys[start] == cursor && cursor != "" {
+		start++
+	}
+
+	chunk := &TransferChunk{Pairs: make([]KeyValue, 0), Cursor: cursor, Done: true}
+	for _, key := range keys[start:] {
+		if len(chunk.Pairs) == limit {
+			chunk.Done = false
+			break
+		}
+		chunk.Cursor = key
+		if !containsNode(db.Cluster.ReplicaNodes(key), requester.ID) {
+			continue
+		}
+		item, err := db.getBucketItem(DefaultBucket, key)
+		if err != nil || item.ContentType != "" {
+			continue // expired since listing, or a raw value that is not replicated
+		}
+		chunk.Pairs = append(chunk.Pairs, KeyValue{Key: key, Value: item.Value})
+	}
+	return chunk, nil
+}
+
+func containsNode(nodes []*Node, id string) bool {
+	for _, node := range nodes {
+		if node.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// transferPacer limits a state transfer to rate keys per second, zero meaning
+// unlimited
+type transferPacer struct {
+	rate int
+	next time.Time
+}
+
+func newTransferPacer(rate int) *transferPacer {
+	return &transferPacer{rate: rate, next: time.Now()}
+}
+
+// wait blocks until keys more keys may be received and reports false when the
+// database is closed meanwhile
+func (p *transferPacer) wait(db *MultiModelDatabase, keys int) bool {
+	if p.rate <= 0 {
+		return true
+	}
+	p.next = p.next.Add(time.Duration(keys) * time.Second / time.Duration(p.rate))
+	return db.sleep(time.Until(p.next))
+}
+
+// sleep waits for d and reports false when the database is closed meanwhile
+func (db *MultiModelDatabase) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return db.ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-db.ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStateTransferResumesFromCursors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transfer.json")
+	peers := []*Node{{ID: "node-1"}, {ID: "node-2"}}
+
+	interrupted := newStateTransfer(path)
+	if err := interrupted.begin(peers); err != nil {
+		t.Fatal(err)
+	}
+	interrupted.update(0, func(source *TransferSource) { source.Cursor, source.Done, source.Keys = "key-9", true, 10 })
+	interrupted.update(1, func(source *TransferSource) { source.Cursor, source.Keys = "key-4", 5 })
+	if err := interrupted.begin(peers); err != ErrTransferRunning {
+		t.Fatalf("expected a second transfer to be refused, got %v", err)
+	}
+
+	// A restarted node picks up the persisted cursors
+	resumed := newStateTransfer(path)
+	if err := resumed.begin(append(peers, &Node{ID: "node-3"})); err != nil {
+		t.Fatal(err)
+	}
+	sources := resumed.snapshot().Sources
+	if !sources[0].Done || sources[1].Cursor != "key-4" || sources[1].Done || sources[2].Cursor != "" {
+		t.Fatalf("unexpected resumed sources %+v", sources)
+	}
+	if err := resumed.finish(); err == nil || resumed.snapshot().State != "failed" {
+		t.Fatalf("unfinished sources should fail the transfer, got %v", err)
+	}
+
+	for i := range sources {
+		resumed.update(i, func(source *TransferSource) { source.Done = true })
+	}
+	if err := resumed.finish(); err != nil || resumed.snapshot().State != "done" {
+		t.Fatalf("finish: %v %+v", err, resumed.snapshot())
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("completed transfer kept its cursors: %v", err)
+	}
+}
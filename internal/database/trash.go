@@ -0,0 +1,264 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trashSweepInterval is how often dropped collections and families past their
+// retention are purged
+const trashSweepInterval = time.Minute
+
+// TrashEntry describes a dropped collection or column family that can still be
+// restored
+type TrashEntry struct {
+	ID        string    `json:"id"`
+	Model     Model     `json:"model"` // ModelDocument for collections, ModelColumn for column families
+	Name      string    `json:"name"`
+	Items     int       `json:"items"` // documents or rows
+	DroppedAt time.Time `json:"dropped_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// trashed holds the data of a dropped collection or column family until it is
+// restored or purged
+type trashed struct {
+	TrashEntry
+	documents map[string]Document   // by id
+	states    map[string]*crdtState // CRDT states by id
+	family    *ColumnFamily
+}
+
+// trashRetention is how long dropped data stays restorable, 0 when drops are final
+func (db *MultiModelDatabase) trashRetention() time.Duration {
+	return time.Duration(db.config.TrashRetention) * time.Minute
+}
+
+// DropCollection removes every document of collection. While the trash retention
+// lasts the documents are kept aside and the collection can be restored from the
+// returned entry; without retention the drop is final and the entry is nil.
+// Indexes and computed fields of the collection are definitions and stay in place.
+func (db *MultiModelDatabase) DropCollection(collection string) (*TrashEntry, error) {
+	if err := ValidateCollectionName(collection); err != nil {
+		return nil, err
+	}
+	if err := db.warmCollection(collection); err != nil {
+		return nil, err
+	}
+
+	item, events, err := db.dropDocuments(collection)
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		db.afterWrite(event.op, event.event)
+	}
+	return db.keepTrash(item), nil
+}
+
+// dropDocuments takes the documents and CRDT states of collection out of the
+// document store, returning them with the deletes to report to observers
+func (db *MultiModelDatabase) dropDocuments(collection string) (*trashed, []pendingWrite, error) {
+	db.docMutex.Lock()
+	defer db.docMutex.Unlock()
+
+	if db.archived(collection) != nil {
+		return nil, nil, fmt.Errorf("%w: %s, unarchive it to drop it", ErrArchived, collection)
+	}
+	prefix := collection + "."
+	item := &trashed{
+		TrashEntry: TrashEntry{Model: ModelDocument, Name: collection},
+		documents:  make(map[string]Document),
+		states:     make(map[string]*crdtState),
+	}
+	var events []pendingWrite
+	for key, doc := range db.documents {
+		if strings.HasPrefix(key, prefix) {
+			id := key[len(prefix):]
+			item.documents[id] = doc
+			delete(db.documents, key)
+			db.rawDocs.forget(key)
+			events = append(events, pendingWrite{OpDelete, &WriteEvent{Model: ModelDocument, Namespace: collection, Key: id, Timestamp: db.Clock.Now()}})
+		}
+	}
+	for key, state := range db.crdt.states {
+		if strings.HasPrefix(key, prefix) {
+			item.states[key[len(prefix):]] = state
+			delete(db.crdt.states, key)
+		}
+	}
+	if len(item.documents) == 0 && len(item.states) == 0 {
+		return nil, nil, fmt.Errorf("collection %s not found", collection)
+	}
+	item.Items = len(item.documents)
+	db.touchCollection(collection)
+	sort.Slice(events, func(i, j int) bool { return events[i].event.Key < events[j].event.Key })
+	return item, events, nil
+}
+
+// DropColumnFamily removes a column family with its rows and options, keeping it
+// restorable like DropCollection
+func (db *MultiModelDatabase) DropColumnFamily(family string) (*TrashEntry, error) {
+	if err := db.warmRows(family, ColumnScan{}); err != nil {
+		return nil, err
+	}
+
+	db.colMutex.Lock()
+	cf, exists := db.columnFamilies[family]
+	delete(db.columnFamilies, family)
+	db.colMutex.Unlock()
+	if !exists {
+		return nil, fmt.Errorf("column family %s not found", family)
+	}
+
+	item := &trashed{TrashEntry: TrashEntry{Model: ModelColumn, Name: family, Items: cf.rows.Len()}, family: cf}
+	return db.keepTrash(item), nil
+}
+
+// keepTrash files a dropped item in the trash, unless drops are final
+func (db *MultiModelDatabase) keepTrash(item *trashed) *TrashEntry {
+	retention := db.trashRetention()
+	if retention <= 0 {
+		return nil
+	}
+	item.DroppedAt = time.Now().UTC()
+	item.ExpiresAt = item.DroppedAt.Add(retention)
+
+	db.trashMutex.Lock()
+	defer db.trashMutex.Unlock()
+	for stamp := item.DroppedAt.UnixNano(); item.ID == "" || db.trash[item.ID] != nil; stamp++ {
+		item.ID = strconv.FormatInt(stamp, 36)
+	}
+	db.trash[item.ID] = item
+	entry := item.TrashEntry
+	return &entry
+}
+
+// Trash returns the dropped collections and column families that can be restored,
+// most recently dropped first
+func (db *MultiModelDatabase) Trash() []TrashEntry {
+	db.trashMutex.Lock()
+	defer db.trashMutex.Unlock()
+
+	entries := make([]TrashEntry, 0, len(db.trash))
+	for _, item := range db.trash {
+		entries = append(entries, item.TrashEntry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].DroppedAt.After(entries[j].DroppedAt) })
+	return entries
+}
+
+// RestoreTrash puts a dropped collection or column family back under its name,
+// which must not have been reused since
+func (db *MultiModelDatabase) RestoreTrash(id string) (*TrashEntry, error) {
+	db.trashMutex.Lock()
+	defer db.trashMutex.Unlock()
+
+	item, exists := db.trash[id]
+	if !exists {
+		return nil, fmt.Errorf("trash entry %s not found", id)
+	}
+	if item.Model == ModelColumn {
+		if err := db.restoreFamily(item); err != nil {
+			return nil, err
+		}
+	} else {
+		events, err := db.restoreDocuments(item)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range events {
+			db.afterWrite(event.op, event.event)
+		}
+	}
+	delete(db.trash, id)
+	entry := item.TrashEntry
+	return &entry, nil
+}
+
+func (db *MultiModelDatabase) restoreDocuments(item *trashed) ([]pendingWrite, error) {
+	db.docMutex.Lock()
+	defer db.docMutex.Unlock()
+
+	prefix := item.Name + "."
+	if db.archived(item.Name) != nil {
+		return nil, fmt.Errorf("collection %s already exists", item.Name)
+	}
+	for key := range db.documents {
+		if strings.HasPrefix(key, prefix) {
+			return nil, fmt.Errorf("collection %s already exists", item.Name)
+		}
+	}
+	for key := range db.coldDocs {
+		if strings.HasPrefix(key, prefix) {
+			return nil, fmt.Errorf("collection %s already exists", item.Name)
+		}
+	}
+
+	events := make([]pendingWrite, 0, len(item.documents))
+	for _, id := range sortedKeys(item.documents) {
+		db.documents[prefix+id] = item.documents[id]
+		events = append(events, pendingWrite{OpInsert, &WriteEvent{Model: ModelDocument, Namespace: item.Name, Key: id, Value: item.documents[id], Timestamp: db.Clock.Now()}})
+	}
+	for id, state := range item.states {
+		db.crdt.states[prefix+id] = state
+	}
+	db.touchCollection(item.Name)
+	return events, nil
+}
+
+func (db *MultiModelDatabase) restoreFamily(item *trashed) error {
+	db.colMutex.Lock()
+	defer db.colMutex.Unlock()
+
+	if _, exists := db.columnFamilies[item.Name]; exists {
+		return fmt.Errorf("column family %s already exists", item.Name)
+	}
+	db.columnFamilies[item.Name] = item.family
+	return nil
+}
+
+// PurgeTrash deletes a dropped collection or column family for good
+func (db *MultiModelDatabase) PurgeTrash(id string) error {
+	db.trashMutex.Lock()
+	defer db.trashMutex.Unlock()
+
+	if _, exists := db.trash[id]; !exists {
+		return fmt.Errorf("trash entry %s not found", id)
+	}
+	delete(db.trash, id)
+	return nil
+}
+
+// purgeExpiredTrash deletes the dropped items whose retention ended before now
+func (db *MultiModelDatabase) purgeExpiredTrash(now time.Time) int {
+	db.trashMutex.Lock()
+	defer db.trashMutex.Unlock()
+
+	purged := 0
+	for id, item := range db.trash {
+		if !now.Before(item.ExpiresAt) {
+			delete(db.trash, id)
+			purged++
+		}
+	}
+	return purged
+}
+
+func (db *MultiModelDatabase) startTrashSweeper(ctx context.Context) {
+	ticker := time.NewTicker(trashSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			db.purgeExpiredTrash(now)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrashRestoresDroppedData(t *testing.T) {
+	db := newTestDatabase(t)
+	db.config.TrashRetention = 60
+	for _, id := range []string{"a", "b"} {
+		if err := db.InsertDocument("orders", id, Document{"total": 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.InsertColumn("metrics", "r1", "cpu", 0.5); err != nil {
+		t.Fatal(err)
+	}
+
+	orders, err := db.DropCollection("orders")
+	if err != nil || orders == nil || orders.Items != 2 {
+		t.Fatalf("drop orders: %+v, %v", orders, err)
+	}
+	if _, err := db.GetDocument("orders", "a"); err == nil {
+		t.Fatal("dropped document still readable")
+	}
+	metrics, err := db.DropColumnFamily("metrics")
+	if err != nil || metrics == nil || metrics.Items != 1 {
+		t.Fatalf("drop metrics: %+v, %v", metrics, err)
+	}
+	if entries := db.Trash(); len(entries) != 2 || entries[0].ID != metrics.ID {
+		t.Fatalf("trash = %+v", entries)
+	}
+
+	// A reused name blocks the restore until it is free again
+	if err := db.InsertDocument("orders", "c", Document{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.RestoreTrash(orders.ID); err == nil {
+		t.Fatal("restored over a reused collection name")
+	}
+	if err := db.DeleteDocument("orders", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.RestoreTrash(orders.ID); err != nil {
+		t.Fatal(err)
+	}
+	if doc, err := db.GetDocument("orders", "b"); err != nil || doc["total"] != 1 {
+		t.Fatalf("restored document: %v, %v", doc, err)
+	}
+	if _, err := db.RestoreTrash(metrics.ID); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := db.GetColumn("metrics", "r1", "cpu"); err != nil || value != 0.5 {
+		t.Fatalf("restored cell: %v, %v", value, err)
+	}
+
+	// Entries are purged once their retention ends
+	if _, err := db.DropCollection("orders"); err != nil {
+		t.Fatal(err)
+	}
+	if purged := db.purgeExpiredTrash(time.Now().Add(time.Hour)); purged != 1 || len(db.Trash()) != 0 {
+		t.Fatalf("purged %d, trash = %+v", purged, db.Trash())
+	}
+
+	// Without retention drops are final
+	db.config.TrashRetention = 0
+	if err := db.InsertDocument("logs", "l1", Document{}); err != nil {
+		t.Fatal(err)
+	}
+	if entry, err := db.DropCollection("logs"); err != nil || entry != nil || len(db.Trash()) != 0 {
+		t.Fatalf("final drop: %+v, %v", entry, err)
+	}
+}
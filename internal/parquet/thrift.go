@@ -0,0 +1,105 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Thrift compact protocol field types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// compactWriter encodes the subset of the Thrift compact protocol needed for Parquet
+// page headers and file metadata. Fields must be written in increasing id order.
+type compactWriter struct {
+	buf       bytes.Buffer
+	lastField []int16
+}
+
+func newCompactWriter() *compactWriter {
+	return &compactWriter{lastField: []int16{0}}
+}
+
+func (c *compactWriter) fieldHeader(id int16, fieldType byte) {
+	last := &c.lastField[len(c.lastField)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		c.buf.WriteByte(byte(delta)<<4 | fieldType)
+	} else {
+		c.buf.WriteByte(fieldType)
+		c.varint(int64(id))
+	}
+	*last = id
+}
+
+func (c *compactWriter) uvarint(v uint64) {
+	var scratch [binary.MaxVarintLen64]byte
+	c.buf.Write(scratch[:binary.PutUvarint(scratch[:], v)])
+}
+
+// varint writes a zigzag encoded signed integer
+func (c *compactWriter) varint(v int64) {
+	c.uvarint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (c *compactWriter) i32(id int16, v int32) {
+	c.fieldHeader(id, thriftI32)
+	c.varint(int64(v))
+}
+
+func (c *compactWriter) i64(id int16, v int64) {
+	c.fieldHeader(id, thriftI64)
+	c.varint(v)
+}
+
+func (c *compactWriter) binary(id int16, v string) {
+	c.fieldHeader(id, thriftBinary)
+	c.uvarint(uint64(len(v)))
+	c.buf.WriteString(v)
+}
+
+// beginStruct starts a nested struct field; close it with endStruct
+func (c *compactWriter) beginStruct(id int16) {
+	c.fieldHeader(id, thriftStruct)
+	c.lastField = append(c.lastField, 0)
+}
+
+func (c *compactWriter) endStruct() {
+	c.buf.WriteByte(0)
+	c.lastField = c.lastField[:len(c.lastField)-1]
+}
+
+// beginList starts a list field of size elements of elemType. Struct elements are
+// written with beginElement and endStruct.
+func (c *compactWriter) beginList(id int16, elemType byte, size int) {
+	c.fieldHeader(id, thriftList)
+	if size < 15 {
+		c.buf.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		c.buf.WriteByte(0xf0 | elemType)
+		c.uvarint(uint64(size))
+	}
+}
+
+func (c *compactWriter) beginElement() {
+	c.lastField = append(c.lastField, 0)
+}
+
+func (c *compactWriter) listI32(v int32) {
+	c.varint(int64(v))
+}
+
+func (c *compactWriter) listBinary(v string) {
+	c.uvarint(uint64(len(v)))
+	c.buf.WriteString(v)
+}
+
+// end terminates the top-level struct and returns the encoding
+func (c *compactWriter) end() []byte {
+	c.buf.WriteByte(0)
+	return c.buf.Bytes()
+}
@@ -0,0 +1,291 @@
+// Package parquet writes flat tables as Apache Parquet files. It implements the part
+// of the format needed for exports with the standard library only: a single row group
+// of optional or required columns, PLAIN encoded and uncompressed, which every
+// Parquet reader (Spark, pandas/pyarrow, DuckDB) accepts.
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Magic opens and closes every Parquet file
+const Magic = "PAR1"
+
+// Type is the logical type of a column
+type Type int
+
+const (
+	Boolean Type = iota
+	Int64
+	Double
+	String // UTF-8 text
+	JSON   // JSON-encoded text
+)
+
+// Column describes one column of a table. Values of optional columns may be nil.
+type Column struct {
+	Name     string
+	Type     Type
+	Required bool
+}
+
+// Physical types, encodings and converted types from parquet.thrift
+const (
+	physicalBoolean   = 0
+	physicalInt64     = 2
+	physicalDouble    = 5
+	physicalByteArray = 6
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	convertedUTF8 = 0
+	convertedJSON = 19
+
+	repetitionRequired = 0
+	repetitionOptional = 1
+
+	pageTypeData      = 0
+	codecUncompressed = 0
+)
+
+// pageRows bounds the rows per data page so readers can stream large columns
+const pageRows = 64 * 1024
+
+func (t Type) physical() int32 {
+	switch t {
+	case Boolean:
+		return physicalBoolean
+	case Int64:
+		return physicalInt64
+	case Double:
+		return physicalDouble
+	default:
+		return physicalByteArray
+	}
+}
+
+// Write encodes rows as a Parquet file. Each row holds one value per column: bool,
+// int64, float64 or string as given by the column type, or nil.
+func Write(w io.Writer, columns []Column, rows [][]interface{}) error {
+	var file bytes.Buffer
+	file.WriteString(Magic)
+
+	chunks := make([]columnChunk, len(columns))
+	for i, column := range columns {
+		chunk := columnChunk{offset: int64(file.Len()), values: int64(len(rows))}
+		for start := 0; ; start += pageRows {
+			end := start + pageRows
+			if end > len(rows) {
+				end = len(rows)
+			}
+			page, err := encodePage(column, i, rows[start:end])
+			if err != nil {
+				return err
+			}
+			file.Write(page)
+			chunk.size += int64(len(page))
+			if end == len(rows) {
+				break
+			}
+		}
+		chunks[i] = chunk
+	}
+
+	footer := encodeFileMetadata(columns, chunks, int64(len(rows)))
+	file.Write(footer)
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(footer)))
+	file.Write(length[:])
+	file.WriteString(Magic)
+
+	_, err := w.Write(file.Bytes())
+	return err
+}
+
+type columnChunk struct {
+	offset int64
+	size   int64
+	values int64
+}
+
+// encodePage returns a data page holding column index of rows
+func encodePage(column Column, index int, rows [][]interface{}) ([]byte, error) {
+	var data bytes.Buffer
+	if !column.Required {
+		levels := make([]bool, len(rows))
+		for i, row := range rows {
+			levels[i] = row[index] != nil
+		}
+		encoded := encodeLevels(levels)
+		var length [4]byte
+		binary.LittleEndian.PutUint32(length[:], uint32(len(encoded)))
+		data.Write(length[:])
+		data.Write(encoded)
+	}
+
+	var bits []bool
+	for i, row := range rows {
+		value := row[index]
+		if value == nil {
+			if column.Required {
+				return nil, fmt.Errorf("row %d: required column %s is null", i, column.Name)
+			}
+			continue
+		}
+		if err := encodeValue(&data, &bits, column.Type, value); err != nil {
+			return nil, fmt.Errorf("row %d column %s: %w", i, column.Name, err)
+		}
+	}
+	if column.Type == Boolean {
+		data.Write(packBits(bits))
+	}
+
+	header := newCompactWriter()
+	header.i32(1, pageTypeData)
+	header.i32(2, int32(data.Len()))
+	header.i32(3, int32(data.Len()))
+	header.beginStruct(5)
+	header.i32(1, int32(len(rows)))
+	header.i32(2, encodingPlain)
+	header.i32(3, encodingRLE)
+	header.i32(4, encodingRLE)
+	header.endStruct()
+
+	return append(header.end(), data.Bytes()...), nil
+}
+
+// encodeValue appends the PLAIN encoding of value; booleans are collected in bits and
+// bit-packed once the page is complete
+func encodeValue(data *bytes.Buffer, bits *[]bool, columnType Type, value interface{}) error {
+	var scratch [8]byte
+	switch columnType {
+	case Boolean:
+		v, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("expected bool, got %T", value)
+		}
+		*bits = append(*bits, v)
+	case Int64:
+		v, ok := value.(int64)
+		if !ok {
+			return fmt.Errorf("expected int64, got %T", value)
+		}
+		binary.LittleEndian.PutUint64(scratch[:], uint64(v))
+		data.Write(scratch[:])
+	case Double:
+		v, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("expected float64, got %T", value)
+		}
+		binary.LittleEndian.PutUint64(scratch[:], math.Float64bits(v))
+		data.Write(scratch[:])
+	default:
+		v, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected string, got %T", value)
+		}
+		binary.LittleEndian.PutUint32(scratch[:4], uint32(len(v)))
+		data.Write(scratch[:4])
+		data.WriteString(v)
+	}
+	return nil
+}
+
+// encodeLevels encodes definition levels of bit width 1 as RLE runs
+func encodeLevels(levels []bool) []byte {
+	var out bytes.Buffer
+	var scratch [binary.MaxVarintLen64]byte
+	for start := 0; start < len(levels); {
+		end := start + 1
+		for end < len(levels) && levels[end] == levels[start] {
+			end++
+		}
+		out.Write(scratch[:binary.PutUvarint(scratch[:], uint64(end-start)<<1)])
+		if levels[start] {
+			out.WriteByte(1)
+		} else {
+			out.WriteByte(0)
+		}
+		start = end
+	}
+	return out.Bytes()
+}
+
+// packBits packs booleans least significant bit first
+func packBits(bits []bool) []byte {
+	packed := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
+
+func encodeFileMetadata(columns []Column, chunks []columnChunk, rows int64) []byte {
+	meta := newCompactWriter()
+	meta.i32(1, 1)
+
+	meta.beginList(2, thriftStruct, len(columns)+1)
+	meta.beginElement()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(columns)))
+	meta.endStruct()
+	for _, column := range columns {
+		meta.beginElement()
+		meta.i32(1, column.Type.physical())
+		if column.Required {
+			meta.i32(3, repetitionRequired)
+		} else {
+			meta.i32(3, repetitionOptional)
+		}
+		meta.binary(4, column.Name)
+		switch column.Type {
+		case String:
+			meta.i32(6, convertedUTF8)
+		case JSON:
+			meta.i32(6, convertedJSON)
+		}
+		meta.endStruct()
+	}
+
+	meta.i64(3, rows)
+
+	var total int64
+	for _, chunk := range chunks {
+		total += chunk.size
+	}
+	meta.beginList(4, thriftStruct, 1)
+	meta.beginElement()
+	meta.beginList(1, thriftStruct, len(columns))
+	for i, column := range columns {
+		chunk := chunks[i]
+		meta.beginElement()
+		meta.i64(2, chunk.offset)
+		meta.beginStruct(3)
+		meta.i32(1, column.Type.physical())
+		meta.beginList(2, thriftI32, 2)
+		meta.listI32(encodingPlain)
+		meta.listI32(encodingRLE)
+		meta.beginList(3, thriftBinary, 1)
+		meta.listBinary(column.Name)
+		meta.i32(4, codecUncompressed)
+		meta.i64(5, chunk.values)
+		meta.i64(6, chunk.size)
+		meta.i64(7, chunk.size)
+		meta.i64(9, chunk.offset)
+		meta.endStruct()
+		meta.endStruct()
+	}
+	meta.i64(2, total)
+	meta.i64(3, rows)
+	meta.endStruct()
+
+	meta.binary(6, "jettradb")
+	return meta.end()
+}
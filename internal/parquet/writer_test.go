@@ -0,0 +1,150 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// compactReader decodes Thrift compact structs into maps of field id to value, which
+// is enough to check the metadata the writer produces
+type compactReader struct {
+	t    *testing.T
+	data []byte
+	pos  int
+}
+
+func (c *compactReader) uvarint() uint64 {
+	v, n := binary.Uvarint(c.data[c.pos:])
+	if n <= 0 {
+		c.t.Fatalf("bad varint at %d", c.pos)
+	}
+	c.pos += n
+	return v
+}
+
+func (c *compactReader) varint() int64 {
+	v := c.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (c *compactReader) value(fieldType byte) interface{} {
+	switch fieldType {
+	case thriftI32, thriftI64:
+		return c.varint()
+	case thriftBinary:
+		n := int(c.uvarint())
+		v := string(c.data[c.pos : c.pos+n])
+		c.pos += n
+		return v
+	case thriftList:
+		header := c.data[c.pos]
+		c.pos++
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(c.uvarint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = c.value(header & 0x0f)
+		}
+		return list
+	case thriftStruct:
+		return c.readStruct()
+	}
+	c.t.Fatalf("unsupported thrift type %d at %d", fieldType, c.pos)
+	return nil
+}
+
+func (c *compactReader) readStruct() map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	var last int16
+	for {
+		header := c.data[c.pos]
+		c.pos++
+		if header == 0 {
+			return fields
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(c.varint())
+		}
+		fields[id] = c.value(header & 0x0f)
+		last = id
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	columns := []Column{
+		{Name: "_id", Type: String, Required: true},
+		{Name: "active", Type: Boolean},
+		{Name: "age", Type: Int64},
+		{Name: "score", Type: Double},
+		{Name: "tags", Type: JSON},
+	}
+	rows := [][]interface{}{
+		{"a", true, int64(30), 1.5, `["x"]`},
+		{"b", nil, nil, nil, nil},
+		{"c", false, int64(-7), math.Pi, `{}`},
+	}
+	var file bytes.Buffer
+	if err := Write(&file, columns, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	data := file.Bytes()
+	if string(data[:4]) != Magic || string(data[len(data)-4:]) != Magic {
+		t.Fatal("missing magic")
+	}
+	footerLength := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := &compactReader{t: t, data: data[len(data)-8-footerLength : len(data)-8]}
+	meta := footer.readStruct()
+
+	if meta[3] != int64(3) {
+		t.Fatalf("num_rows = %v", meta[3])
+	}
+	schema := meta[2].([]interface{})
+	if len(schema) != len(columns)+1 || schema[0].(map[int16]interface{})[5] != int64(len(columns)) {
+		t.Fatalf("unexpected schema %v", schema)
+	}
+	chunks := meta[4].([]interface{})[0].(map[int16]interface{})[1].([]interface{})
+
+	read := func(index int) (levels []byte, values []byte) {
+		chunk := chunks[index].(map[int16]interface{})[3].(map[int16]interface{})
+		page := &compactReader{t: t, data: data, pos: int(chunk[9].(int64))}
+		header := page.readStruct()
+		body := data[page.pos : page.pos+int(header[3].(int64))]
+		if header[5].(map[int16]interface{})[1] != int64(len(rows)) {
+			t.Fatalf("column %d page holds %v values", index, header[5])
+		}
+		if columns[index].Required {
+			return nil, body
+		}
+		n := binary.LittleEndian.Uint32(body)
+		return body[4 : 4+n], body[4+n:]
+	}
+
+	if _, values := read(0); !bytes.Equal(values, []byte("\x01\x00\x00\x00a\x01\x00\x00\x00b\x01\x00\x00\x00c")) {
+		t.Fatalf("unexpected _id values %q", values)
+	}
+	levels, values := read(1)
+	// Runs of defined, null, defined
+	if !reflect.DeepEqual(levels, []byte{2, 1, 2, 0, 2, 1}) || !bytes.Equal(values, []byte{0x01}) {
+		t.Fatalf("unexpected boolean page %v %v", levels, values)
+	}
+	if _, values := read(2); int64(binary.LittleEndian.Uint64(values[8:])) != -7 {
+		t.Fatalf("unexpected int64 values %v", values)
+	}
+	if _, values := read(3); math.Float64frombits(binary.LittleEndian.Uint64(values[8:])) != math.Pi {
+		t.Fatalf("unexpected double values %v", values)
+	}
+}
+
+func TestWriteRejectsNullInRequiredColumn(t *testing.T) {
+	err := Write(&bytes.Buffer{}, []Column{{Name: "_id", Type: String, Required: true}}, [][]interface{}{{nil}})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// admissionQueueWait bounds how long a queued request waits for a slot before it is shed
+const admissionQueueWait = 5 * time.Second
+
+// admissionRetryAfter is the Retry-After hint, in seconds, sent with shed requests
+const admissionRetryAfter = "1"
+
+// admissionYieldPoll is how often a bulk request giving way to interactive ones checks
+// whether they were all admitted
+const admissionYieldPoll = 5 * time.Millisecond
+
+// AdmissionStats reports the load of one data model
+type AdmissionStats struct {
+	InFlight     int   `json:"in_flight"`
+	BulkInFlight int   `json:"bulk_in_flight"`
+	Queued       int64 `json:"queued"`
+	Admitted     int64 `json:"admitted"`
+	Shed         int64 `json:"shed"`
+	Yielded      int64 `json:"yielded"` // bulk requests that gave way to interactive ones
+}
+
+// modelLimiter caps the requests concurrently served by one data model. Each store
+// is guarded by a single mutex, so piling up goroutines behind it only adds latency;
+// excess requests wait in a bounded queue and are shed once it is full.
+//
+// Requests to collections of the bulk priority class also hold one of the few bulk
+// slots, and give way to requests of interactive collections: while one of those
+// waits for a slot, bulk requests are not admitted.
+type modelLimiter struct {
+	slots    chan struct{}
+	bulk     chan struct{}
+	maxQueue int64
+	queued   int64
+	urgent   int64 // interactive requests waiting for a slot
+	admitted int64
+	shed     int64
+	yielded  int64
+}
+
+func newModelLimiter(maxInFlight, maxQueued, maxBulk int) *modelLimiter {
+	if maxBulk <= 0 || maxBulk > maxInFlight {
+		maxBulk = maxInFlight
+	}
+	return &modelLimiter{
+		slots:    make(chan struct{}, maxInFlight),
+		bulk:     make(chan struct{}, maxBulk),
+		maxQueue: int64(maxQueued),
+	}
+}
+
+// acquire takes a slot for a request of the given priority class, reporting false
+// when the request is shed
+func (l *modelLimiter) acquire(r *http.Request, class string) bool {
+	timer := time.NewTimer(admissionQueueWait)
+	defer timer.Stop()
+
+	if class == database.PriorityBulk {
+		if !l.wait(r, l.bulk, timer.C, "") {
+			return false
+		}
+		if !l.yield(r, timer.C) || !l.wait(r, l.slots, timer.C, class) {
+			<-l.bulk
+			return false
+		}
+		return true
+	}
+	return l.wait(r, l.slots, timer.C, class)
+}
+
+// wait takes a slot of slots, queueing until expired when none is free
+func (l *modelLimiter) wait(r *http.Request, slots chan struct{}, expired <-chan time.Time, class string) bool {
+	select {
+	case slots <- struct{}{}:
+		if slots == l.slots {
+			atomic.AddInt64(&l.admitted, 1)
+		}
+		return true
+	default:
+	}
+
+	if atomic.AddInt64(&l.queued, 1) > l.maxQueue {
+		atomic.AddInt64(&l.queued, -1)
+		atomic.AddInt64(&l.shed, 1)
+		return false
+	}
+	defer atomic.AddInt64(&l.queued, -1)
+	if class == database.PriorityInteractive {
+		atomic.AddInt64(&l.urgent, 1)
+		defer atomic.AddInt64(&l.urgent, -1)
+	}
+
+	select {
+	case slots <- struct{}{}:
+		if slots == l.slots {
+			atomic.AddInt64(&l.admitted, 1)
+		}
+		return true
+	case <-expired:
+	case <-r.Context().Done():
+	}
+	atomic.AddInt64(&l.shed, 1)
+	return false
+}
+
+// yield holds a bulk request back while interactive requests wait for a slot
+func (l *modelLimiter) yield(r *http.Request, expired <-chan time.Time) bool {
+	if atomic.LoadInt64(&l.urgent) == 0 {
+		return true
+	}
+	atomic.AddInt64(&l.yielded, 1)
+	ticker := time.NewTicker(admissionYieldPoll)
+	defer ticker.Stop()
+	for atomic.LoadInt64(&l.urgent) > 0 {
+		select {
+		case <-ticker.C:
+		case <-expired:
+			atomic.AddInt64(&l.shed, 1)
+			return false
+		case <-r.Context().Done():
+			atomic.AddInt64(&l.shed, 1)
+			return false
+		}
+	}
+	return true
+}
+
+func (l *modelLimiter) release(class string) {
+	<-l.slots
+	if class == database.PriorityBulk {
+		<-l.bulk
+	}
+}
+
+func (l *modelLimiter) stats() AdmissionStats {
+	return AdmissionStats{
+		InFlight:     len(l.slots),
+		BulkInFlight: len(l.bulk),
+		Queued:       atomic.LoadInt64(&l.queued),
+		Admitted:     atomic.LoadInt64(&l.admitted),
+		Shed:         atomic.LoadInt64(&l.shed),
+		Yielded:      atomic.LoadInt64(&l.yielded),
+	}
+}
+
+// admissionController holds one limiter per data model
+type admissionController struct {
+	maxInFlight int
+	maxQueued   int
+	maxBulk     int
+	priority    func(collection string) string // priority class of a collection
+	limiters    map[string]*modelLimiter
+	mutex       sync.RWMutex
+}
+
+func newAdmissionController(maxInFlight, maxQueued, maxBulk int, priority func(string) string) *admissionController {
+	return &admissionController{
+		maxInFlight: maxInFlight,
+		maxQueued:   maxQueued,
+		maxBulk:     maxBulk,
+		priority:    priority,
+		limiters:    make(map[string]*modelLimiter),
+	}
+}
+
+// requestModel returns the data model a request is served by, or "" for requests
+// that are not subject to admission control
+func requestModel(path string) string {
+	segment := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]
+	switch segment {
+	case "docs", "collections":
+		return string(database.ModelDocument)
+	case "kv", "buckets", "sessions", "leases":
+		return string(database.ModelKeyValue)
+	case "columns":
+		return string(database.ModelColumn)
+	case "graph":
+		return string(database.ModelGraph)
+	}
+	return ""
+}
+
+// requestCollection returns the collection a document request addresses, or ""
+func requestCollection(path string) string {
+	segments := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 3)
+	if len(segments) < 2 || (segments[0] != "docs" && segments[0] != "collections") {
+		return ""
+	}
+	return segments[1]
+}
+
+// requestPriority returns the priority class of the collection a request addresses
+func (a *admissionController) requestPriority(path string) string {
+	if collection := requestCollection(path); collection != "" && a.priority != nil {
+		return a.priority(collection)
+	}
+	return database.PriorityNormal
+}
+
+// middleware limits in-flight requests per data model and sheds load with 503 and
+// Retry-After when the wait queue is full
+func (a *admissionController) middleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if a.maxInFlight <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Long polls park until a change and would hold a slot for their whole timeout
+			model := requestModel(r.URL.Path)
+			if model == "" || isLongPoll(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			limiter, class := a.limiter(model), a.requestPriority(r.URL.Path)
+			if !limiter.acquire(r, class) {
+				w.Header().Set("Retry-After", admissionRetryAfter)
+				sendJSONResponse(w, http.StatusServiceUnavailable, Response{
+					Success: false,
+					Error:   "server overloaded, retry later",
+				})
+				return
+			}
+			defer limiter.release(class)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (a *admissionController) limiter(model string) *modelLimiter {
+	a.mutex.RLock()
+	limiter, exists := a.limiters[model]
+	a.mutex.RUnlock()
+	if exists {
+		return limiter
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if limiter, exists = a.limiters[model]; !exists {
+		limiter = newModelLimiter(a.maxInFlight, a.maxQueued, a.maxBulk)
+		a.limiters[model] = limiter
+	}
+	return limiter
+}
+
+func (a *admissionController) stats() map[string]AdmissionStats {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	stats := make(map[string]AdmissionStats, len(a.limiters))
+	for model, limiter := range a.limiters {
+		stats[model] = limiter.stats()
+	}
+	return stats
+}
+
+func admissionStatsHandler(a *admissionController) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data: map[string]interface{}{
+				"max_in_flight": a.maxInFlight,
+				"max_queued":    a.maxQueued,
+				"max_bulk":      a.maxBulk,
+				"models":        a.stats(),
+			},
+		})
+	}
+}
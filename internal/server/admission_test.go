@@ -0,0 +1,118 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"multimodel-db-engine/internal/database"
+)
+
+func TestBulkRequestsYieldToInteractive(t *testing.T) {
+	limiter := newModelLimiter(1, 10, 1)
+	r := httptest.NewRequest("GET", "/docs/imports", nil)
+	if !limiter.acquire(r, database.PriorityNormal) {
+		t.Fatal("free slot not granted")
+	}
+
+	admitted := make(chan string, 2)
+	go func() {
+		if limiter.acquire(r, database.PriorityInteractive) {
+			admitted <- database.PriorityInteractive
+		}
+	}()
+	for atomic.LoadInt64(&limiter.urgent) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	go func() {
+		if limiter.acquire(r, database.PriorityBulk) {
+			admitted <- database.PriorityBulk
+		}
+	}()
+	for atomic.LoadInt64(&limiter.yielded) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	limiter.release(database.PriorityNormal)
+	if first := <-admitted; first != database.PriorityInteractive {
+		t.Fatalf("%s request admitted first", first)
+	}
+	limiter.release(database.PriorityInteractive)
+	if second := <-admitted; second != database.PriorityBulk {
+		t.Fatalf("%s request admitted second", second)
+	}
+	if stats := limiter.stats(); stats.InFlight != 1 || stats.BulkInFlight != 1 || stats.Shed != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	// Bulk requests beyond their share are shed while other requests are not
+	limiter = newModelLimiter(2, 0, 1)
+	if !limiter.acquire(r, database.PriorityBulk) {
+		t.Fatal("bulk slot not granted")
+	}
+	if limiter.acquire(r, database.PriorityBulk) {
+		t.Fatal("second bulk request admitted past the bulk share")
+	}
+	if !limiter.acquire(r, database.PriorityNormal) {
+		t.Fatal("normal request shed")
+	}
+}
+
+func TestFullQueueShedsWithRetryAfter(t *testing.T) {
+	admission := newAdmissionController(1, 1, 0, nil)
+	entered, unblock := make(chan struct{}, 2), make(chan struct{})
+	handler := admission.middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-unblock
+	}))
+
+	codes := make(chan int, 2)
+	serve := func() {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/docs/orders", nil))
+		codes <- w.Code
+	}
+	go serve()
+	<-entered
+	go serve()
+	for admission.stats()[string(database.ModelDocument)].Queued == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The slot and the queue are both taken, so the next request is shed at once
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/docs/orders", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503", w.Code)
+	}
+	if retry := w.Header().Get("Retry-After"); retry != admissionRetryAfter {
+		t.Fatalf("Retry-After %q, want %q", retry, admissionRetryAfter)
+	}
+
+	close(unblock)
+	for i := 0; i < 2; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Fatalf("admitted request answered %d", code)
+		}
+	}
+	if stats := admission.stats()[string(database.ModelDocument)]; stats.Admitted != 2 || stats.Shed != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestRequestCollection(t *testing.T) {
+	for path, want := range map[string]string{
+		"/docs/orders":               "orders",
+		"/docs/orders/o1":            "orders",
+		"/collections/orders/_copy":  "orders",
+		"/collections":               "",
+		"/kv/orders":                 "",
+		"/docs/orders/_insertMany/x": "orders",
+	} {
+		if got := requestCollection(path); got != want {
+			t.Errorf("%s: %q, want %q", path, got, want)
+		}
+	}
+}
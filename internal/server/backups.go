@@ -0,0 +1,114 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// backupStatus maps backup errors to HTTP status codes
+func backupStatus(err error) int {
+	if errors.Is(err, database.ErrBackupNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// ephemeralWarning is the Warning header of backups and restores on an ephemeral
+// instance, which loses them on shutdown
+const ephemeralWarning = `199 - "ephemeral instance, data is lost on shutdown"`
+
+// warnIfEphemeral sets the ephemeral warning when the database keeps nothing
+func warnIfEphemeral(w http.ResponseWriter, db *database.MultiModelDatabase) {
+	if db.Ephemeral() {
+		w.Header().Set("Warning", ephemeralWarning)
+	}
+}
+
+// listBackupsHandler returns the backup catalog grouped into chains
+func listBackupsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    db.Backups.List(),
+		})
+	}
+}
+
+// createBackupHandler takes a full backup, or an incremental one on top of the most
+// recent backup when the body sets "incremental"
+func createBackupHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Incremental bool `json:"incremental"`
+		}
+		if r.ContentLength != 0 {
+			if err := readJSONBody(r, &request); err != nil {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   "Invalid JSON body",
+				})
+				return
+			}
+		}
+
+		warnIfEphemeral(w, db)
+		backup, err := db.Backups.Create(request.Incremental)
+		if err != nil {
+			sendJSONResponse(w, http.StatusInternalServerError, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusCreated, Response{
+			Success: true,
+			Message: "Backup created",
+			Data:    backup,
+		})
+	}
+}
+
+// backupPlanHandler returns the backups a restore to the given backup applies, in order
+func backupPlanHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		plan, err := db.Backups.Plan(mux.Vars(r)["id"])
+		if err != nil {
+			sendJSONResponse(w, backupStatus(err), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    plan,
+		})
+	}
+}
+
+// restoreBackupHandler restores the database to the state of the given backup
+func restoreBackupHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		warnIfEphemeral(w, db)
+		result, err := db.Backups.Restore(mux.Vars(r)["id"])
+		if err != nil {
+			sendJSONResponse(w, backupStatus(err), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Backup restored",
+			Data:    result,
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// blobMetaHeaderPrefix marks request headers that are stored as custom blob metadata,
+// e.g. "X-Blob-Meta-Owner: alice"
+const blobMetaHeaderPrefix = "X-Blob-Meta-"
+
+// blobMetadataFromHeaders collects the X-Blob-Meta-* headers of a request
+func blobMetadataFromHeaders(header http.Header) map[string]string {
+	var metadata map[string]string
+	for name, values := range header {
+		canonical := http.CanonicalHeaderKey(name)
+		if !strings.HasPrefix(canonical, blobMetaHeaderPrefix) || len(values) == 0 {
+			continue
+		}
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[strings.ToLower(strings.TrimPrefix(canonical, blobMetaHeaderPrefix))] = values[0]
+	}
+	return metadata
+}
+
+// putBlobHandler stores the request body as a blob in a single request
+func putBlobHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		defer r.Body.Close()
+
+		info, err := db.Blobs.PutBlob(vars["bucket"], vars["name"], r.Header.Get("Content-Type"), blobMetadataFromHeaders(r.Header), r.Body)
+		if err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusCreated, Response{
+			Success: true,
+			Message: "Blob stored successfully",
+			Data:    info,
+		})
+	}
+}
+
+// getBlobHandler streams a blob, honoring Range and conditional request headers
+func getBlobHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		file, info, err := db.Blobs.OpenBlob(vars["bucket"], vars["name"])
+		if err != nil {
+			sendJSONResponse(w, http.StatusNotFound, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		defer file.Close()
+
+		w.Header().Set("Content-Type", info.ContentType)
+		w.Header().Set("ETag", `"`+info.SHA256+`"`)
+		for key, value := range info.Metadata {
+			w.Header().Set(blobMetaHeaderPrefix+key, value)
+		}
+		http.ServeContent(w, r, info.Name, info.CreatedAt, file)
+	}
+}
+
+func getBlobMetadataHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		info, err := db.Blobs.StatBlob(vars["bucket"], vars["name"])
+		if err != nil {
+			sendJSONResponse(w, http.StatusNotFound, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    info,
+		})
+	}
+}
+
+func deleteBlobHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		if err := db.Blobs.DeleteBlob(vars["bucket"], vars["name"]); err != nil {
+			sendJSONResponse(w, http.StatusNotFound, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Blob deleted successfully",
+		})
+	}
+}
+
+func listBlobsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		blobs, err := db.Blobs.ListBlobs(mux.Vars(r)["bucket"])
+		if err != nil {
+			sendJSONResponse(w, http.StatusNotFound, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    blobs,
+		})
+	}
+}
+
+// createBlobUploadHandler starts a chunked upload. The Content-Type and X-Blob-Meta-*
+// headers of this request apply to the final blob.
+func createBlobUploadHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		upload, err := db.Blobs.CreateUpload(vars["bucket"], vars["name"], r.Header.Get("Content-Type"), blobMetadataFromHeaders(r.Header))
+		if err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusCreated, Response{
+			Success: true,
+			Message: "Upload started",
+			Data:    upload,
+		})
+	}
+}
+
+func getBlobUploadHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		upload, err := db.Blobs.GetUpload(vars["bucket"], vars["name"], vars["upload"])
+		if err != nil {
+			sendJSONResponse(w, http.StatusNotFound, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    upload,
+		})
+	}
+}
+
+func putBlobUploadPartHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		defer r.Body.Close()
+
+		part, err := strconv.Atoi(vars["part"])
+		if err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Part number must be an integer",
+			})
+			return
+		}
+
+		size, err := db.Blobs.PutUploadPart(vars["bucket"], vars["name"], vars["upload"], part, r.Body)
+		if err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Part stored",
+			Data:    map[string]interface{}{"part": part, "size": size},
+		})
+	}
+}
+
+func completeBlobUploadHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		info, err := db.Blobs.CompleteUpload(vars["bucket"], vars["name"], vars["upload"])
+		if err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusCreated, Response{
+			Success: true,
+			Message: "Blob stored successfully",
+			Data:    info,
+		})
+	}
+}
+
+func abortBlobUploadHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		if err := db.Blobs.AbortUpload(vars["bucket"], vars["name"], vars["upload"]); err != nil {
+			sendJSONResponse(w, http.StatusNotFound, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Upload aborted",
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/config"
+	"multimodel-db-engine/internal/database"
+)
+
+func TestBlobRangeReads(t *testing.T) {
+	db := database.NewMultiModelDatabase(&config.Config{DataDir: t.TempDir(), ReplicationFactor: 1})
+	defer db.Close()
+	router := mux.NewRouter()
+	SetupRoutes(router, db)
+	if _, err := db.Blobs.PutBlob("media", "digits.txt", "text/plain", nil, strings.NewReader("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		rangeHeader  string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{"", http.StatusOK, "0123456789", ""},
+		{"bytes=2-5", http.StatusPartialContent, "2345", "bytes 2-5/10"},
+		{"bytes=7-", http.StatusPartialContent, "789", "bytes 7-9/10"},
+		{"bytes=-3", http.StatusPartialContent, "789", "bytes 7-9/10"},
+		{"bytes=8-20", http.StatusPartialContent, "89", "bytes 8-9/10"},
+		{"bytes=10-12", http.StatusRequestedRangeNotSatisfiable, "", "bytes */10"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/blobs/media/digits.txt", nil)
+		if tt.rangeHeader != "" {
+			r.Header.Set("Range", tt.rangeHeader)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tt.status || w.Header().Get("Content-Range") != tt.contentRange {
+			t.Errorf("%q answered %d with range %q", tt.rangeHeader, w.Code, w.Header().Get("Content-Range"))
+			continue
+		}
+		if tt.status != http.StatusRequestedRangeNotSatisfiable && w.Body.String() != tt.body {
+			t.Errorf("%q read %q, want %q", tt.rangeHeader, w.Body, tt.body)
+		}
+	}
+
+	// A range of a changed blob is not served from a stale validator
+	r := httptest.NewRequest("GET", "/blobs/media/digits.txt", nil)
+	r.Header.Set("Range", "bytes=0-1")
+	r.Header.Set("If-Range", `"stale"`)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.String() != "0123456789" {
+		t.Fatalf("If-Range with a stale ETag answered %d %q", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/blobs/media/missing.txt", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("missing blob answered %d", w.Code)
+	}
+}
@@ -0,0 +1,298 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// bucketTokenHeader carries the access token for protected buckets
+const bucketTokenHeader = "X-Bucket-Token"
+
+// bucketFromVars returns the bucket addressed by a route, or the default bucket for
+// the legacy /kv/{key} routes
+func bucketFromVars(vars map[string]string) string {
+	if bucket := vars["bucket"]; bucket != "" {
+		return bucket
+	}
+	return database.DefaultBucket
+}
+
+// authorizeBucket checks the request's bucket token and writes a 403 response when
+// access is denied
+func authorizeBucket(w http.ResponseWriter, r *http.Request, db *database.MultiModelDatabase, bucket string, write bool) bool {
+	err := db.CheckBucketAccess(bucket, r.Header.Get(bucketTokenHeader), write)
+	if err == nil {
+		return true
+	}
+
+	status := http.StatusInternalServerError
+	if errors.Is(err, database.ErrBucketAccessDenied) {
+		status = http.StatusForbidden
+	}
+	sendJSONResponse(w, status, Response{
+		Success: false,
+		Error:   err.Error(),
+	})
+	return false
+}
+
+// binaryContentType returns the request's media type when the body should be stored as
+// raw bytes, or "" for JSON bodies (including requests without a Content-Type)
+func binaryContentType(r *http.Request) string {
+	header := r.Header.Get("Content-Type")
+	if header == "" {
+		return ""
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		return ""
+	}
+	return header
+}
+
+// parseTTL parses a ttl query parameter such as "30s" or "15m"; empty means the bucket default
+func parseTTL(raw string) (time.Duration, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(raw)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid ttl %q", raw)
+	}
+	return ttl, nil
+}
+
+func listBucketsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    db.ListBuckets(),
+		})
+	}
+}
+
+func listBucketKeysHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bucket := mux.Vars(r)["bucket"]
+		if !authorizeBucket(w, r, db, bucket, false) {
+			return
+		}
+
+		keys, err := db.ListBucketKeysContext(r.Context(), bucket, r.URL.Query().Get("prefix"))
+		if err != nil {
+			sendJSONResponse(w, errorStatus(err, http.StatusNotFound), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    keys,
+		})
+	}
+}
+
+func bucketStatsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bucket := mux.Vars(r)["bucket"]
+		if !authorizeBucket(w, r, db, bucket, false) {
+			return
+		}
+
+		stats, err := db.GetBucketStats(bucket)
+		if err != nil {
+			sendJSONResponse(w, http.StatusNotFound, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    stats,
+		})
+	}
+}
+
+// setBucketOptionsHandler replaces a bucket's configuration. Changing the options of a
+// protected bucket requires its current token.
+func setBucketOptionsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bucket := mux.Vars(r)["bucket"]
+		if !authorizeBucket(w, r, db, bucket, false) {
+			return
+		}
+
+		var options database.BucketOptions
+		if err := readJSONBody(r, &options); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid JSON in request body",
+			})
+			return
+		}
+
+		if err := db.SetBucketOptions(bucket, options); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Bucket options updated successfully",
+		})
+	}
+}
+
+// multiGetHandler reads a set of keys in one round trip: {"keys": ["a", "b"]}. Raw
+// values are encoded as base64 strings and listed with their media type in
+// content_types, so they can be told apart from JSON strings.
+func multiGetHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bucket := bucketFromVars(mux.Vars(r))
+		if !authorizeBucket(w, r, db, bucket, false) {
+			return
+		}
+
+		var request struct {
+			Keys []string `json:"keys"`
+		}
+		if err := readJSONBody(r, &request); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid JSON in request body",
+			})
+			return
+		}
+
+		items, missing, err := db.MultiGetBucketItems(bucket, request.Keys)
+		if err != nil {
+			sendJSONResponse(w, http.StatusNotFound, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		values := make(map[string]interface{}, len(items))
+		contentTypes := make(map[string]string)
+		for key, item := range items {
+			values[key] = item.Value
+			if item.ContentType != "" {
+				contentTypes[key] = item.ContentType
+			}
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    map[string]interface{}{"values": values, "missing": missing, "content_types": contentTypes},
+		})
+	}
+}
+
+// multiSetHandler writes a set of pairs in one round trip:
+// {"pairs": [{"key": "a", "value": 1, "revision": 7}], "ttl": "30s"}. Pairs with a
+// revision are only written while their key is at it; the others are written
+// regardless, and a 409 lists the conflicting pairs.
+func multiSetHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bucket := bucketFromVars(mux.Vars(r))
+		if !authorizeBucket(w, r, db, bucket, true) {
+			return
+		}
+
+		var request struct {
+			Pairs []struct {
+				Key      string      `json:"key"`
+				Value    interface{} `json:"value"`
+				Revision *int64      `json:"revision"` // expected revision, 0 when the key must not exist
+			} `json:"pairs"`
+			TTL string `json:"ttl"`
+		}
+		if err := readJSONBody(r, &request); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid JSON in request body",
+			})
+			return
+		}
+
+		ttl, err := parseTTL(request.TTL)
+		if err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		pairs := make([]database.KeyValue, len(request.Pairs))
+		var revisions []*int64
+		for i, pair := range request.Pairs {
+			pairs[i] = database.KeyValue{Key: pair.Key, Value: pair.Value}
+			if pair.Revision != nil {
+				if revisions == nil {
+					revisions = make([]*int64, len(request.Pairs))
+				}
+				revisions[i] = pair.Revision
+			}
+		}
+
+		conflicts, err := db.MultiSetBucketValuesIf(bucket, pairs, revisions, ttl)
+		if err != nil {
+			sendJSONResponse(w, errorStatus(err, http.StatusBadRequest), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		if len(conflicts) > 0 {
+			sendConflicts(w, fmt.Sprintf("%d of %d key-value pairs set", len(pairs)-len(conflicts), len(pairs)), conflicts)
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: fmt.Sprintf("%d key-value pairs set successfully", len(request.Pairs)),
+		})
+	}
+}
+
+// dedupStatsHandler reports space saved by deduplicating KV buckets and blobs
+func dedupStatsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		blobStats, err := db.Blobs.DedupStats()
+		if err != nil {
+			sendJSONResponse(w, http.StatusInternalServerError, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data: map[string]interface{}{
+				"kv":            db.KVDedupStats(),
+				"blobs":         blobStats,
+				"blobs_enabled": db.Blobs.Dedup,
+			},
+		})
+	}
+}
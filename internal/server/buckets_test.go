@@ -0,0 +1,124 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/config"
+	"multimodel-db-engine/internal/database"
+)
+
+func newKVTestRouter(t *testing.T) *mux.Router {
+	db := database.NewMultiModelDatabase(&config.Config{DataDir: t.TempDir(), ReplicationFactor: 1})
+	t.Cleanup(db.Close)
+	router := mux.NewRouter()
+	SetupRoutes(router, db)
+	return router
+}
+
+// putKey stores body at path, as JSON when contentType is ""
+func putKey(t *testing.T, router http.Handler, path, contentType string, body []byte) {
+	t.Helper()
+	r := httptest.NewRequest("PUT", path, bytes.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT %s answered %d: %s", path, w.Code, w.Body)
+	}
+}
+
+func TestRawValuesRoundTrip(t *testing.T) {
+	router := newKVTestRouter(t)
+	binary := make([]byte, 256)
+	for i := range binary {
+		binary[i] = byte(i)
+	}
+
+	tests := []struct {
+		path        string
+		contentType string
+		body        []byte
+	}{
+		{"/kv/blob", "application/octet-stream", binary},
+		{"/kv/media/logo", "image/png", []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0x00}},
+		{"/kv/notes", "text/plain; charset=utf-8", []byte("  not {json}\n")},
+		{"/kv/media/empty", "application/octet-stream", []byte{}},
+	}
+	for _, tt := range tests {
+		putKey(t, router, tt.path, tt.contentType, tt.body)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s answered %d: %s", tt.path, w.Code, w.Body)
+			continue
+		}
+		if got := w.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("GET %s: Content-Type %q, want %q", tt.path, got, tt.contentType)
+		}
+		if !bytes.Equal(w.Body.Bytes(), tt.body) {
+			t.Errorf("GET %s read %q, want %q", tt.path, w.Body.Bytes(), tt.body)
+		}
+	}
+
+	// JSON bodies are still decoded and answered in the response envelope
+	putKey(t, router, "/kv/count", "application/json", []byte(`42`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/kv/count", nil))
+	var response Response
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Data != float64(42) {
+		t.Fatalf("JSON value read back as %s (%v)", w.Body, err)
+	}
+}
+
+func TestMultiGetMarksRawValues(t *testing.T) {
+	router := newKVTestRouter(t)
+	raw := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff}
+	encoded := base64.StdEncoding.EncodeToString(raw)
+
+	// A JSON string holding the same text as the encoded raw value
+	putKey(t, router, "/kv/logo", "image/png", raw)
+	putKey(t, router, "/kv/greeting", "", []byte(`"`+encoded+`"`))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/kv/_mget", strings.NewReader(`{"keys": ["logo", "greeting", "absent"]}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("_mget answered %d: %s", w.Code, w.Body)
+	}
+	var response struct {
+		Data struct {
+			Values       map[string]interface{} `json:"values"`
+			Missing      []string               `json:"missing"`
+			ContentTypes map[string]string      `json:"content_types"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	data := response.Data
+
+	if !reflect.DeepEqual(data.Missing, []string{"absent"}) {
+		t.Fatalf("missing = %v", data.Missing)
+	}
+	if !reflect.DeepEqual(data.ContentTypes, map[string]string{"logo": "image/png"}) {
+		t.Fatalf("content_types = %v", data.ContentTypes)
+	}
+	if data.Values["greeting"] != encoded {
+		t.Fatalf("string value = %v", data.Values["greeting"])
+	}
+	logo, _ := data.Values["logo"].(string)
+	if decoded, err := base64.StdEncoding.DecodeString(logo); err != nil || !bytes.Equal(decoded, raw) {
+		t.Fatalf("raw value = %q (%v)", logo, err)
+	}
+}
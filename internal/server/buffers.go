@@ -0,0 +1,38 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+)
+
+// maxPooledBuffer keeps buffers grown by large responses out of the pool, so one
+// export does not pin its size for the life of the process
+const maxPooledBuffer = 1 << 20
+
+// responseBuffer is a buffer with an encoder writing into it, reused across requests
+// so responses are encoded into memory that has already grown and written in one call
+type responseBuffer struct {
+	bytes.Buffer
+	encoder *json.Encoder
+}
+
+var responseBuffers = sync.Pool{
+	New: func() interface{} {
+		b := &responseBuffer{}
+		b.encoder = json.NewEncoder(&b.Buffer)
+		return b
+	},
+}
+
+func getResponseBuffer() *responseBuffer {
+	return responseBuffers.Get().(*responseBuffer)
+}
+
+func putResponseBuffer(b *responseBuffer) {
+	if b.Cap() > maxPooledBuffer {
+		return
+	}
+	b.Reset()
+	responseBuffers.Put(b)
+}
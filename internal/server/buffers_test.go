@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+)
+
+// discardResponse is a ResponseWriter dropping the body, so benchmarks measure the
+// encoding alone
+type discardResponse struct {
+	header http.Header
+}
+
+func (d *discardResponse) Header() http.Header         { return d.header }
+func (d *discardResponse) Write(p []byte) (int, error) { return len(p), nil }
+func (d *discardResponse) WriteHeader(int)             {}
+
+func BenchmarkSendJSONResponse(b *testing.B) {
+	w := &discardResponse{header: make(http.Header)}
+	data := map[string]interface{}{"name": "Ada", "tags": []interface{}{"a", "b"}, "age": float64(36)}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sendJSONResponse(w, http.StatusOK, Response{Success: true, Data: data})
+	}
+}
+
+func BenchmarkSendRawDataResponse(b *testing.B) {
+	w := &discardResponse{header: make(http.Header)}
+	data := []byte(`{"age":36,"name":"Ada","tags":["a","b"]}`)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sendRawDataResponse(w, data)
+	}
+}
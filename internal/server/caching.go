@@ -0,0 +1,73 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// cacheControl returns the Cache-Control value for cacheable reads. Without a
+// configured max age, caches may store responses but must revalidate them, which
+// conditional requests make cheap.
+func cacheControl(db *database.MultiModelDatabase) string {
+	if maxAge := db.Config().CacheMaxAge; maxAge > 0 {
+		return fmt.Sprintf("public, max-age=%d", maxAge)
+	}
+	return "no-cache"
+}
+
+// collectionETag identifies a collection state; the start time distinguishes
+// versions across restarts of the in-memory store
+func collectionETag(collection string, stamp database.CollectionStamp, startedAt time.Time) string {
+	return fmt.Sprintf(`W/"%s-%x-%d"`, collection, startedAt.UnixNano(), stamp.Version)
+}
+
+// writeCacheHeaders sets caching headers for a response derived from collection and
+// reports whether the client's cached copy is still fresh, in which case a 304 has
+// been written and the handler must not write a body. It must be called before the
+// data is read, so a concurrent write can only make the stamp older than the body
+// (causing a harmless refetch), never newer.
+func writeCacheHeaders(w http.ResponseWriter, r *http.Request, db *database.MultiModelDatabase, collection string) bool {
+	if database.IsSystemCollection(collection) {
+		// System documents change without a collection stamp
+		w.Header().Set("Cache-Control", "no-cache")
+		return false
+	}
+	stamp := db.CollectionStamp(collection)
+	etag := collectionETag(collection, stamp, db.StartedAt())
+
+	header := w.Header()
+	header.Set("Cache-Control", cacheControl(db))
+	header.Set("ETag", etag)
+	header.Set("Last-Modified", stamp.Modified.UTC().Format(http.TimeFormat))
+
+	// If-None-Match takes precedence over If-Modified-Since (RFC 7232 section 6)
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		if etagMatches(match, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+		return false
+	}
+	if since := r.Header.Get("If-Modified-Since"); since != "" {
+		if t, err := http.ParseTime(since); err == nil && !stamp.Modified.Truncate(time.Second).After(t) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// etagMatches applies weak comparison to an If-None-Match header value
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
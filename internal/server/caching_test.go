@@ -0,0 +1,129 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/config"
+	"multimodel-db-engine/internal/database"
+)
+
+func TestDocumentCacheInvalidatedByWrites(t *testing.T) {
+	db := database.NewMultiModelDatabase(&config.Config{DataDir: t.TempDir(), ReplicationFactor: 1})
+	defer db.Close()
+	router := mux.NewRouter()
+	SetupRoutes(router, db)
+	serve := func(method, path, body string, header ...string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code >= 400 {
+			t.Fatalf("%s %s answered %d: %s", method, path, w.Code, w.Body)
+		}
+		return w
+	}
+	serve("POST", "/docs/users/1", `{"name": "ann"}`)
+	serve("POST", "/docs/staff/2", `{"name": "bob"}`)
+
+	first := serve("GET", "/docs/users/1", "")
+	etag := first.Header().Get("ETag")
+	if etag == "" || first.Header().Get("Cache-Control") != "no-cache" || first.Header().Get("Last-Modified") == "" {
+		t.Fatalf("caching headers = %v", first.Header())
+	}
+	// Documents and queries of an unchanged collection share its validator
+	for _, path := range []string{"/docs/users/1", "/docs/users"} {
+		if w := serve("GET", path, "", "If-None-Match", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Fatalf("revalidating %s answered %d", path, w.Code)
+		}
+	}
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if w := serve("GET", "/docs/users/1", "", "If-Modified-Since", future); w.Code != http.StatusNotModified {
+		t.Fatalf("If-Modified-Since answered %d", w.Code)
+	}
+	if w := serve("GET", "/docs/users/1", "", "If-None-Match", `"other"`, "If-Modified-Since", future); w.Code != http.StatusOK {
+		t.Fatalf("a mismatched ETag answered %d despite If-Modified-Since", w.Code)
+	}
+
+	// Writes to another collection leave the validator alone
+	serve("PUT", "/docs/staff/2", `{"name": "bo"}`)
+	if w := serve("GET", "/docs/users/1", "", "If-None-Match", etag); w.Code != http.StatusNotModified {
+		t.Fatalf("write to another collection invalidated users: %d", w.Code)
+	}
+
+	writes := []struct {
+		name         string
+		method, path string
+		body         string
+	}{
+		{"insert", "POST", "/docs/users/3", `{"name": "cid"}`},
+		{"update", "PUT", "/docs/users/1", `{"name": "ann lee"}`},
+		{"insert many", "POST", "/docs/users/_insertMany", `{"documents": [{"_id": "4", "name": "dee"}]}`},
+		{"move in", "POST", "/docs/staff/2/_move", `{"to": "users"}`},
+		{"delete", "DELETE", "/docs/users/4", ""},
+		{"migration", "POST", "/admin/migrate", `{"migrations": [{"version": 1, "steps": [{"op": "backfill", "collection": "users", "field": "plan", "value": "free"}]}]}`},
+		{"copy over", "POST", "/collections/staff/_copy", `{"to": "users", "overwrite": true}`},
+	}
+	for _, write := range writes {
+		if write.name == "copy over" {
+			serve("POST", "/docs/staff/5", `{"name": "eve"}`)
+		}
+		serve(write.method, write.path, write.body)
+		w := serve("GET", "/docs/users", "", "If-None-Match", etag)
+		if w.Code != http.StatusOK {
+			t.Fatalf("cached users served after %s: %d", write.name, w.Code)
+		}
+		next := w.Header().Get("ETag")
+		if next == etag {
+			t.Fatalf("ETag unchanged after %s", write.name)
+		}
+		etag = next
+	}
+	if w := serve("GET", "/docs/users/5", "", "If-None-Match", etag); w.Code != http.StatusNotModified {
+		t.Fatalf("revalidating after the last write answered %d", w.Code)
+	}
+}
+
+func TestDocumentWaitRevalidatesETag(t *testing.T) {
+	db := database.NewMultiModelDatabase(&config.Config{DataDir: t.TempDir(), ReplicationFactor: 1})
+	defer db.Close()
+	router := mux.NewRouter()
+	SetupRoutes(router, db)
+	if err := db.InsertDocument("users", "1", database.Document{"name": "ann"}); err != nil {
+		t.Fatal(err)
+	}
+	wait := func(etag string) (*httptest.ResponseRecorder, time.Duration) {
+		r := httptest.NewRequest("GET", "/docs/users/1?wait=true&timeout=200ms", nil)
+		r.Header.Set("If-None-Match", etag)
+		w := httptest.NewRecorder()
+		start := time.Now()
+		router.ServeHTTP(w, r)
+		return w, time.Since(start)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/docs/users/1", nil))
+	stale := w.Header().Get("ETag")
+	if err := db.UpdateDocument("users", "1", database.Document{"name": "ann b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The update landed after the client's last read, so the wait returns it at once
+	w, took := wait(stale)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "ann b") || took >= 200*time.Millisecond {
+		t.Fatalf("wait with a stale ETag answered %d after %s: %s", w.Code, took, w.Body)
+	}
+
+	// With the current ETag the wait blocks until the timeout
+	if w, took := wait(w.Header().Get("ETag")); w.Code != http.StatusNotModified || took < 200*time.Millisecond {
+		t.Fatalf("wait with the current ETag answered %d after %s", w.Code, took)
+	}
+}
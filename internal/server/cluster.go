@@ -0,0 +1,666 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// clusterOrReject returns the database's cluster, or responds with 503 when
+// clustering is disabled
+func clusterOrReject(w http.ResponseWriter, db *database.MultiModelDatabase) *database.Cluster {
+	if db.Cluster == nil {
+		sendJSONResponse(w, http.StatusServiceUnavailable, Response{
+			Success: false,
+			Error:   "Clustering is not enabled",
+		})
+	}
+	return db.Cluster
+}
+
+// requestEpoch returns the partition map epoch a peer sent, zero when missing
+func requestEpoch(r *http.Request) uint64 {
+	epoch, _ := strconv.ParseUint(r.Header.Get(database.EpochHeader), 10, 64)
+	return epoch
+}
+
+// fenceStaleEpoch rejects replication and forwarded writes sent under an older
+// partition map with 409 Conflict. The local epoch is returned either way.
+func fenceStaleEpoch(w http.ResponseWriter, r *http.Request, cluster *database.Cluster) bool {
+	err := cluster.CheckEpoch(requestEpoch(r))
+	w.Header().Set(database.EpochHeader, strconv.FormatUint(cluster.Epoch(), 10))
+	if err != nil {
+		sendJSONResponse(w, http.StatusConflict, Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return true
+	}
+	return false
+}
+
+// sendMembershipResponse answers a join or gossip request with a response carrying
+// the local epoch and, when a cluster secret is configured, signed
+func sendMembershipResponse(w http.ResponseWriter, cluster *database.Cluster, response Response) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		sendJSONResponse(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	body = append(body, '\n')
+	cluster.SignResponse(w.Header(), body)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// clockMiddleware advances the local clock past the clock of every node to node
+// request and stamps the response with the local clock
+func clockMiddleware(db *database.MultiModelDatabase) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if db.Cluster != nil {
+				db.Cluster.ObserveClock(r.Header.Get(database.ClockHeader))
+				w.Header().Set(database.ClockHeader, db.Clock.Now().String())
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isClusterMessage reports whether path is a node to node endpoint
+func isClusterMessage(path string) bool {
+	return path == "/cluster/join" || path == "/cluster/gossip" || strings.HasPrefix(path, "/data/")
+}
+
+// clusterAuthMiddleware rejects node to node requests without a valid signature
+// with 401 when a cluster secret is configured
+func clusterAuthMiddleware(db *database.MultiModelDatabase) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if db.Cluster == nil || !db.Cluster.Authenticated() || !isClusterMessage(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxJSONBody))
+			r.Body.Close()
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				sendJSONResponse(w, http.StatusRequestEntityTooLarge, Response{
+					Success: false,
+					Error:   fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit),
+				})
+				return
+			}
+			if err == nil {
+				err = db.Cluster.VerifyRequest(r, body)
+			}
+			if err != nil {
+				sendJSONResponse(w, http.StatusUnauthorized, Response{
+					Success: false,
+					Error:   err.Error(),
+				})
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// joinClusterHandler adds the node sent by a joining peer and answers with the
+// current membership
+func joinClusterHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cluster := clusterOrReject(w, db)
+		if cluster == nil {
+			return
+		}
+
+		var node database.Node
+		if err := readJSONBody(r, &node); err != nil || node.ID == "" {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Request body must be a node with an id",
+			})
+			return
+		}
+
+		cluster.MergeMembership([]*database.Node{&node})
+		cluster.ObserveEpoch(requestEpoch(r))
+		sendMembershipResponse(w, cluster, Response{
+			Success: true,
+			Data:    cluster.GetActiveNodes(),
+		})
+	}
+}
+
+// gossipHandler merges a peer's membership list and answers with the local one
+func gossipHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cluster := clusterOrReject(w, db)
+		if cluster == nil {
+			return
+		}
+
+		var nodes []*database.Node
+		if err := readJSONBody(r, &nodes); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid JSON in request body",
+			})
+			return
+		}
+
+		cluster.MergeMembership(nodes)
+		cluster.ObserveEpoch(requestEpoch(r))
+		sendMembershipResponse(w, cluster, Response{
+			Success: true,
+			Data:    cluster.GetActiveNodes(),
+		})
+	}
+}
+
+// replicateHandler stores a key, or a batch of pairs, replicated by a peer in the
+// default KV bucket
+func replicateHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cluster := clusterOrReject(w, db)
+		if cluster == nil || fenceStaleEpoch(w, r, cluster) {
+			return
+		}
+
+		var data struct {
+			Key   string              `json:"key"`
+			Value interface{}         `json:"value"`
+			Pairs []database.KeyValue `json:"pairs"`
+			Stamp database.Timestamp  `json:"stamp"` // clock reading of the write, ordering replicas
+		}
+		if err := readJSONBody(r, &data); err != nil || (data.Key == "" && len(data.Pairs) == 0) {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Request body must contain a key or pairs",
+			})
+			return
+		}
+
+		pairs := data.Pairs
+		if data.Key != "" {
+			pairs = []database.KeyValue{{Key: data.Key, Value: data.Value}}
+		}
+		_, err := cluster.ApplyReplicated(pairs, data.Stamp, func(newer []database.KeyValue) error {
+			return db.MultiSetBucketValues(database.DefaultBucket, newer, 0)
+		})
+		if err != nil {
+			sendJSONResponse(w, errorStatus(err, http.StatusInternalServerError), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Replica stored",
+		})
+	}
+}
+
+// bulkChunkHandler stores a bulk load chunk sent by the coordinating peer to this
+// node as the owner of its keys
+func bulkChunkHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cluster := clusterOrReject(w, db)
+		if cluster == nil || fenceStaleEpoch(w, r, cluster) {
+			return
+		}
+
+		var data struct {
+			Pairs []database.KeyValue `json:"pairs"`
+		}
+		if err := readJSONBody(r, &data); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid JSON in request body",
+			})
+			return
+		}
+
+		if err := db.StoreOwnedChunk(data.Pairs); err != nil {
+			sendJSONResponse(w, errorStatus(err, http.StatusBadRequest), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Chunk stored",
+		})
+	}
+}
+
+// bulkLoadHandler loads pairs into the default bucket, sending each chunk straight
+// to the partition owner of its keys when clustering is enabled
+func bulkLoadHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorizeBucket(w, r, db, database.DefaultBucket, true) {
+			return
+		}
+
+		var request struct {
+			Pairs []database.KeyValue `json:"pairs"`
+		}
+		if err := readJSONBody(r, &request); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid JSON in request body",
+			})
+			return
+		}
+
+		result, err := db.BulkLoad(request.Pairs)
+		if err != nil {
+			sendJSONResponse(w, errorStatus(err, http.StatusBadRequest), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		// Chunks succeed independently; report partial loads as 207 Multi-Status
+		status := http.StatusOK
+		if result.Stored < result.Keys {
+			status = http.StatusMultiStatus
+		}
+		sendJSONResponse(w, status, Response{
+			Success: result.Stored == result.Keys,
+			Message: fmt.Sprintf("%d of %d key-value pairs stored", result.Stored, result.Keys),
+			Data:    result,
+		})
+	}
+}
+
+// placementHandler returns the placement rules, and the replicas of ?key= when given
+func placementHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cluster := clusterOrReject(w, db)
+		if cluster == nil {
+			return
+		}
+
+		data := map[string]interface{}{"rules": cluster.PlacementRules()}
+		if key := r.URL.Query().Get("key"); key != "" {
+			data["key"] = key
+			data["replicas"] = cluster.ReplicaNodes(key)
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    data,
+		})
+	}
+}
+
+// partitionsHandler returns the load of every node and partition in the cluster
+// and the rebalancing it calls for
+func partitionsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if clusterOrReject(w, db) == nil {
+			return
+		}
+
+		report, err := db.ClusterLoad()
+		if err != nil {
+			sendJSONResponse(w, http.StatusInternalServerError, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    report,
+		})
+	}
+}
+
+// partitionLoadHandler answers a peer collecting the cluster load with the load
+// measured on this node
+func partitionLoadHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if clusterOrReject(w, db) == nil {
+			return
+		}
+
+		loads, err := db.LocalLoad()
+		if err != nil {
+			sendJSONResponse(w, http.StatusInternalServerError, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    loads,
+		})
+	}
+}
+
+// eventKeepAlive is how often an idle event stream sends a comment, so proxies do
+// not close it
+const eventKeepAlive = 15 * time.Second
+
+// clusterEventsHandler streams topology changes as server-sent events. Clients
+// resuming with a Last-Event-ID header, or ?after=, first receive the kept events
+// they missed. A client that falls too far behind is disconnected and resumes the
+// same way.
+func clusterEventsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cluster := clusterOrReject(w, db)
+		if cluster == nil {
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			sendJSONResponse(w, http.StatusInternalServerError, Response{
+				Success: false,
+				Error:   "Streaming is not supported",
+			})
+			return
+		}
+
+		after := uint64(math.MaxUint64) // only events from now on
+		lastID := r.Header.Get("Last-Event-ID")
+		if lastID == "" {
+			lastID = r.URL.Query().Get("after")
+		}
+		if lastID != "" {
+			var err error
+			if after, err = strconv.ParseUint(lastID, 10, 64); err != nil {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   fmt.Sprintf("invalid event id %q", lastID),
+				})
+				return
+			}
+		}
+
+		backlog, events, cancel := cluster.SubscribeEvents(after)
+		defer cancel()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+
+		write := func(event database.ClusterEvent) {
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		}
+		for _, event := range backlog {
+			write(event)
+		}
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(eventKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event, open := <-events:
+				if !open {
+					return
+				}
+				write(event)
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// splitPartitionHandler splits a partition through the leader and returns the new
+// partition map. The forwarded request of a peer is handled alike.
+func splitPartitionHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if clusterOrReject(w, db) == nil {
+			return
+		}
+
+		id := mux.Vars(r)["id"]
+		if id == "" {
+			var request struct {
+				Partition string `json:"partition"`
+			}
+			if err := readJSONBody(r, &request); err != nil || request.Partition == "" {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   "A partition is required",
+				})
+				return
+			}
+			id = request.Partition
+		}
+
+		m, err := db.SplitPartition(id)
+		if err != nil {
+			status := http.StatusBadGateway
+			switch {
+			case errors.Is(err, database.ErrUnknownPartition):
+				status = http.StatusNotFound
+			case errors.Is(err, database.ErrPartitionTooSmall):
+				status = http.StatusConflict
+			}
+			sendJSONResponse(w, status, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Partition split",
+			Data:    m,
+		})
+	}
+}
+
+// partitionMapHandler adopts the partition map pushed by the leader when it is newer
+// than the local one
+func partitionMapHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cluster := clusterOrReject(w, db)
+		if cluster == nil {
+			return
+		}
+
+		var m database.PartitionMap
+		if err := readJSONBody(r, &m); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid request body",
+			})
+			return
+		}
+		adopted, err := cluster.AdoptPartitionMap(m)
+		if err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    map[string]interface{}{"adopted": adopted, "version": cluster.PartitionMap().Version},
+		})
+	}
+}
+
+// transferChunkHandler answers a joining peer's state transfer request with the
+// next chunk of the keys it replicates
+func transferChunkHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cluster := clusterOrReject(w, db)
+		if cluster == nil {
+			return
+		}
+
+		var request struct {
+			Node   *database.Node `json:"node"`
+			Cursor string         `json:"cursor"`
+			Limit  int            `json:"limit"`
+		}
+		if err := readJSONBody(r, &request); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid request body",
+			})
+			return
+		}
+		chunk, err := db.TransferChunk(request.Node, request.Cursor, request.Limit)
+		if err != nil {
+			sendJSONResponse(w, errorStatus(err, http.StatusBadRequest), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    chunk,
+		})
+	}
+}
+
+// mergeCRDTHandler merges the state of a CRDT document pushed by a peer
+func mergeCRDTHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if clusterOrReject(w, db) == nil {
+			return
+		}
+
+		var message struct {
+			Collection string          `json:"collection"`
+			ID         string          `json:"id"`
+			State      json.RawMessage `json:"state"`
+		}
+		if err := readJSONBody(r, &message); err != nil || message.Collection == "" || message.ID == "" {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Request body must contain a collection, id and state",
+			})
+			return
+		}
+		if err := db.MergeCRDTState(message.Collection, message.ID, message.State); err != nil {
+			sendJSONResponse(w, errorStatus(err, http.StatusBadRequest), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "State merged",
+		})
+	}
+}
+
+// startTransferHandler starts streaming this node's partitions from the other
+// members, resuming an interrupted transfer. Progress is reported by /cluster/status.
+func startTransferHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if clusterOrReject(w, db) == nil {
+			return
+		}
+		if db.StateTransfer().State == "running" {
+			sendJSONResponse(w, http.StatusConflict, Response{
+				Success: false,
+				Error:   database.ErrTransferRunning.Error(),
+			})
+			return
+		}
+
+		go func() {
+			if err := db.TransferState(); err != nil {
+				log.Printf("State transfer failed: %v", err)
+			}
+		}()
+		sendJSONResponse(w, http.StatusAccepted, Response{
+			Success: true,
+			Message: "State transfer started",
+		})
+	}
+}
+
+// servedByHeader names the node that served a replica read
+const servedByHeader = "X-Served-By"
+
+// serveFromReplica handles a default bucket read carrying ?maxStaleness=<duration>.
+// The closest replica whose copy is within the bound serves it; when that is a peer
+// its response is relayed. Validation failures are answered too; handled is false
+// when the read should be served locally.
+func serveFromReplica(w http.ResponseWriter, r *http.Request, db *database.MultiModelDatabase, key string) (handled bool) {
+	bound := r.URL.Query().Get("maxStaleness")
+	if bound == "" || db.Cluster == nil {
+		return false
+	}
+	maxStaleness, err := time.ParseDuration(bound)
+	if err != nil || maxStaleness < 0 {
+		sendJSONResponse(w, http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "maxStaleness must be a non-negative duration such as 5s",
+		})
+		return true
+	}
+
+	node, err := db.Cluster.SelectReplica(key, maxStaleness)
+	if err != nil {
+		sendJSONResponse(w, http.StatusServiceUnavailable, Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return true
+	}
+	w.Header().Set(servedByHeader, node.ID)
+	if node.ID == db.Cluster.Self().ID {
+		return false
+	}
+
+	resp, err := db.Cluster.ReadFromReplica(node, key)
+	if err != nil {
+		sendJSONResponse(w, http.StatusBadGateway, Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return true
+	}
+	defer resp.Body.Close()
+
+	for _, header := range []string{"Content-Type", revisionHeader} {
+		if value := resp.Header.Get(header); value != "" {
+			w.Header().Set(header, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+	return true
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/config"
+	"multimodel-db-engine/internal/database"
+)
+
+func TestClusterRoutesBoundBodies(t *testing.T) {
+	db := database.NewMultiModelDatabase(&config.Config{DataDir: t.TempDir(), ReplicationFactor: 1, ClusterEnabled: true, ClusterSecret: "s3cret"})
+	defer db.Close()
+	router := mux.NewRouter()
+	SetupClusterRoutes(router, db)
+
+	tests := []struct {
+		name   string
+		path   string
+		size   int
+		status int
+	}{
+		{"unsigned", "/data/replicate", 16, http.StatusUnauthorized},
+		{"oversized", "/data/replicate", maxJSONBody + 1, http.StatusRequestEntityTooLarge},
+		{"heartbeat", "/health", 0, http.StatusOK},
+	}
+	for _, tt := range tests {
+		method := "POST"
+		if tt.size == 0 {
+			method = "GET"
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, tt.path, bytes.NewReader(make([]byte, tt.size))))
+		if w.Code != tt.status {
+			t.Errorf("%s answered %d, want %d: %s", tt.name, w.Code, tt.status, w.Body)
+		}
+	}
+}
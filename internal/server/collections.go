@@ -0,0 +1,573 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/database"
+)
+
+func listCollectionsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collections := db.ListCollections()
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    collections,
+			Meta:    listMeta(len(collections), true),
+		})
+	}
+}
+
+// transferCollectionHandler renames or copies a collection: {"to": "name", "overwrite": false}
+func transferCollectionHandler(db *database.MultiModelDatabase, move bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			To        string `json:"to"`
+			Overwrite bool   `json:"overwrite"`
+		}
+		if err := readJSONBody(r, &request); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid JSON in request body",
+			})
+			return
+		}
+
+		from := mux.Vars(r)["name"]
+		transfer, message := db.CopyCollection, "Collection copied"
+		if move {
+			transfer, message = db.RenameCollection, "Collection renamed"
+		}
+
+		count, err := transfer(from, request.To, request.Overwrite)
+		if err != nil {
+			status := http.StatusBadRequest
+			switch {
+			case strings.Contains(err.Error(), "not found"):
+				status = http.StatusNotFound
+			case strings.Contains(err.Error(), "already exists"):
+				status = http.StatusConflict
+			}
+			sendJSONResponse(w, status, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: message,
+			Data: map[string]interface{}{
+				"from":      from,
+				"to":        request.To,
+				"documents": count,
+			},
+		})
+	}
+}
+
+// cloneCollectionHandler copies a collection with its indexes and computed fields to
+// another instance: {"url": "https://staging:8080/v1", "token": "...", "collection": ""}
+func cloneCollectionHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var target database.CloneTarget
+		if err := readJSONBody(r, &target); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid JSON in request body",
+			})
+			return
+		}
+
+		result, err := db.CloneCollection(r.Context(), mux.Vars(r)["name"], target)
+		if err != nil {
+			status := http.StatusBadRequest
+			switch {
+			case result != nil:
+				// The target failed once the clone had started
+				status = http.StatusBadGateway
+			case strings.Contains(err.Error(), "not found"):
+				status = http.StatusNotFound
+			}
+			sendJSONResponse(w, errorStatus(err, status), Response{
+				Success: false,
+				Error:   err.Error(),
+				Data:    result,
+			})
+			return
+		}
+
+		message := "Collection cloned"
+		if len(result.Errors) > 0 {
+			message = fmt.Sprintf("Collection cloned, %d documents rejected by the target", len(result.Errors))
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: len(result.Errors) == 0,
+			Message: message,
+			Data:    result,
+		})
+	}
+}
+
+// compactCollectionHandler compacts a collection, rewriting its archive file with
+// ?defragment=true, and reports the space reclaimed
+func compactCollectionHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var opts database.CompactOptions
+		if defragment := r.URL.Query().Get("defragment"); defragment != "" {
+			var err error
+			if opts.Defragment, err = strconv.ParseBool(defragment); err != nil {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   "defragment must be true or false",
+				})
+				return
+			}
+		}
+
+		result, err := db.CompactCollection(mux.Vars(r)["name"], opts)
+		if err != nil {
+			status := http.StatusBadRequest
+			if strings.Contains(err.Error(), "not found") {
+				status = http.StatusNotFound
+			}
+			sendJSONResponse(w, errorStatus(err, status), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: fmt.Sprintf("Collection compacted, %d bytes reclaimed", result.Reclaimed),
+			Data:    result,
+		})
+	}
+}
+
+// moveDocumentHandler moves a document to another collection:
+// {"to": "archive", "new_id": "", "update_refs": true, "update_edges": true}
+func moveDocumentHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			To string `json:"to"`
+			database.MoveOptions
+		}
+		if err := readJSONBody(r, &request); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid JSON in request body",
+			})
+			return
+		}
+
+		vars := mux.Vars(r)
+		result, err := db.MoveDocument(vars["collection"], vars["id"], request.To, request.MoveOptions)
+		if err != nil {
+			status := errorStatus(err, http.StatusBadRequest)
+			var conflict *database.ConflictError
+			switch {
+			case strings.Contains(err.Error(), "not found"):
+				status = http.StatusNotFound
+			case strings.Contains(err.Error(), "already exists"), errors.As(err, &conflict):
+				status = http.StatusConflict
+			}
+			sendJSONResponse(w, status, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Document moved",
+			Data:    result,
+		})
+	}
+}
+
+// collectionConsistencyHandler returns the consistency mode of a collection, or sets
+// it with PUT {"mode": "strong" | "crdt"}
+func collectionConsistencyHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+		if r.Method == http.MethodPut {
+			var request struct {
+				Mode string `json:"mode"`
+			}
+			if err := readJSONBody(r, &request); err != nil {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   "Invalid JSON in request body",
+				})
+				return
+			}
+			if err := db.SetCollectionConsistency(name, request.Mode); err != nil {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   err.Error(),
+				})
+				return
+			}
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data: map[string]string{
+				"collection": name,
+				"mode":       db.CollectionConsistency(name),
+			},
+		})
+	}
+}
+
+// collectionPriorityHandler reads or assigns the priority class of a collection:
+// PUT {"class": "bulk"}
+func collectionPriorityHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+		if r.Method == http.MethodPut {
+			var request struct {
+				Class string `json:"class"`
+			}
+			if err := readJSONBody(r, &request); err != nil {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   "Invalid JSON in request body",
+				})
+				return
+			}
+			if err := db.SetCollectionPriority(name, request.Class); err != nil {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   err.Error(),
+				})
+				return
+			}
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data: map[string]string{
+				"collection": name,
+				"class":      db.CollectionPriority(name),
+			},
+		})
+	}
+}
+
+// collectionSchemaHandler infers the schema of a collection from a sample of its
+// documents: GET /docs/{collection}/_schema?sample=1000&format=jsonschema
+func collectionSchemaHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sample := database.DefaultSchemaSample
+		if value := r.URL.Query().Get("sample"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   "Invalid sample size",
+				})
+				return
+			}
+			sample = n
+		}
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "jsonschema" {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   fmt.Sprintf("Unsupported schema format %q, expected jsonschema", format),
+			})
+			return
+		}
+
+		schema, err := db.InferSchema(r.Context(), mux.Vars(r)["collection"], sample)
+		if err != nil {
+			sendJSONResponse(w, errorStatus(err, http.StatusInternalServerError), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		if format == "jsonschema" {
+			sendJSONResponse(w, http.StatusOK, Response{
+				Success: true,
+				Data:    schema.JSONSchema(),
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    schema,
+		})
+	}
+}
+
+// indexesHandler lists the indexes of a collection, or adds one with
+// POST {"field": "user_id", "collation": {"case_insensitive": true}}
+func indexesHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collection := mux.Vars(r)["collection"]
+		if r.Method == http.MethodPost {
+			var spec database.IndexSpec
+			if err := readJSONBody(r, &spec); err != nil {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   "Invalid JSON in request body",
+				})
+				return
+			}
+			spec.Collection = collection
+			if err := db.CreateIndex(spec); err != nil {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   err.Error(),
+				})
+				return
+			}
+			sendJSONResponse(w, http.StatusCreated, Response{
+				Success: true,
+				Message: "Index created",
+				Data:    spec,
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    db.ListIndexes(collection),
+		})
+	}
+}
+
+// computedFieldsHandler lists the computed fields of a collection, or defines one with
+// POST {"name": "total", "expression": "price * qty", "stored": true}
+func computedFieldsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collection := mux.Vars(r)["collection"]
+		if r.Method == http.MethodPost {
+			var field database.ComputedField
+			if err := readJSONBody(r, &field); err != nil {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   "Invalid JSON in request body",
+				})
+				return
+			}
+			field.Collection = collection
+			if err := db.DefineComputedField(field); err != nil {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   err.Error(),
+				})
+				return
+			}
+			sendJSONResponse(w, http.StatusCreated, Response{
+				Success: true,
+				Message: "Computed field defined",
+				Data:    field,
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    db.ComputedFields(collection),
+		})
+	}
+}
+
+// dropComputedFieldHandler removes a computed field of a collection
+func dropComputedFieldHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if err := db.DropComputedField(vars["collection"], vars["name"]); err != nil {
+			sendJSONResponse(w, http.StatusNotFound, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Computed field dropped",
+		})
+	}
+}
+
+// referencesHandler lists the declared references of a collection or declares one,
+// materializing its graph edges
+func referencesHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collection := mux.Vars(r)["collection"]
+		if r.Method == http.MethodPost {
+			var ref database.DocumentReference
+			if err := readJSONBody(r, &ref); err != nil {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   "Invalid JSON in request body",
+				})
+				return
+			}
+			ref.Collection = collection
+			if err := db.DefineDocumentReference(r.Context(), ref); err != nil {
+				sendJSONResponse(w, errorStatus(err, http.StatusBadRequest), Response{
+					Success: false,
+					Error:   err.Error(),
+				})
+				return
+			}
+			sendJSONResponse(w, http.StatusCreated, Response{
+				Success: true,
+				Message: "Reference defined",
+				Data:    ref,
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    db.DocumentReferences(collection),
+		})
+	}
+}
+
+// dropReferenceHandler removes a declared reference of a collection with its edges
+func dropReferenceHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if err := db.DropDocumentReference(vars["collection"], vars["field"]); err != nil {
+			sendJSONResponse(w, http.StatusNotFound, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Reference dropped",
+		})
+	}
+}
+
+// documentCompressionHandler reports the codec and savings of document compression
+func documentCompressionHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    db.DocumentCompressionStats(),
+		})
+	}
+}
+
+// rawCacheHandler reports the size and hit rate of the encoded document cache
+func rawCacheHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    db.RawCacheStats(),
+		})
+	}
+}
+
+// archiveHandler archives a collection into a read-only memory-mapped file on POST
+// and loads it back into memory on DELETE
+func archiveHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collection := mux.Vars(r)["collection"]
+		if r.Method == http.MethodDelete {
+			restored, err := db.UnarchiveCollection(collection)
+			if err != nil {
+				sendJSONResponse(w, http.StatusNotFound, Response{
+					Success: false,
+					Error:   err.Error(),
+				})
+				return
+			}
+			sendJSONResponse(w, http.StatusOK, Response{
+				Success: true,
+				Message: "Collection unarchived",
+				Data:    map[string]int{"documents": restored},
+			})
+			return
+		}
+
+		info, err := db.ArchiveCollection(collection)
+		if err != nil {
+			sendJSONResponse(w, errorStatus(err, http.StatusBadRequest), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Collection archived",
+			Data:    info,
+		})
+	}
+}
+
+// archivesHandler lists the archived collections
+func archivesHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    db.Archives(),
+		})
+	}
+}
+
+// explainHandler returns the plan of a document query, taking the same parameters
+// as GET /docs/{collection}: GET /docs/{collection}/_explain?status=open
+func explainHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := database.ParseDocumentQuery(r.URL.Query())
+		if err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		plan, err := db.ExplainQuery(mux.Vars(r)["collection"], q)
+		if err != nil {
+			sendJSONResponse(w, errorStatus(err, http.StatusInternalServerError), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    plan,
+		})
+	}
+}
+
+// dropIndexHandler removes the index on a field of a collection
+func dropIndexHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if err := db.DropIndex(vars["collection"], vars["field"]); err != nil {
+			sendJSONResponse(w, http.StatusNotFound, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Index dropped",
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// contentionSites is how many of the most contended call sites the runtime report lists
+const contentionSites = 10
+
+// RuntimeStats is the report of /admin/debug/runtime
+type RuntimeStats struct {
+	GoVersion  string           `json:"go_version"`
+	Uptime     string           `json:"uptime"`
+	CPUs       int              `json:"cpus"`
+	MaxProcs   int              `json:"gomaxprocs"`
+	Goroutines int              `json:"goroutines"`
+	Memory     MemoryStats      `json:"memory"`
+	GC         GCStats          `json:"gc"`
+	Contention []ContentionSite `json:"contention"` // most contended mutexes, when sampled
+}
+
+// MemoryStats reports the heap in bytes
+type MemoryStats struct {
+	HeapAlloc   uint64 `json:"heap_alloc"`
+	HeapInuse   uint64 `json:"heap_inuse"`
+	HeapObjects uint64 `json:"heap_objects"`
+	StackInuse  uint64 `json:"stack_inuse"`
+	Sys         uint64 `json:"sys"`
+}
+
+// GCStats reports garbage collections and their pauses
+type GCStats struct {
+	Cycles        uint32     `json:"cycles"`
+	Forced        uint32     `json:"forced"`
+	LastAt        *time.Time `json:"last_at,omitempty"`
+	PauseTotal    string     `json:"pause_total"`
+	RecentPauses  []string   `json:"recent_pauses"` // newest first
+	CPUFraction   float64    `json:"cpu_fraction"`
+	NextHeapAlloc uint64     `json:"next_heap_alloc"`
+}
+
+// ContentionSite is a call site where goroutines waited for a mutex
+type ContentionSite struct {
+	Function string `json:"function"`
+	Location string `json:"location"`
+	Events   int64  `json:"events"`
+	Cycles   int64  `json:"cycles"` // CPU cycles spent waiting, comparable between sites
+}
+
+// SetupDebugRoutes configures the profiling and runtime diagnostics endpoints. They
+// are served on their own listener, never with the API, and require the admin
+// token when one is configured.
+func SetupDebugRoutes(router *mux.Router, db *database.MultiModelDatabase) {
+	router.Use(recoveryMiddleware())
+	router.Use(adminTokenMiddleware(db.Config().AdminToken))
+
+	router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	router.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	router.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	// The index, and named profiles such as heap, goroutine and mutex
+	router.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+	router.HandleFunc("/admin/debug/runtime", runtimeStatsHandler(db)).Methods("GET")
+}
+
+// adminTokenMiddleware rejects requests without the bearer token, unless it is empty
+func adminTokenMiddleware(token string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !hasBearerToken(r, token) {
+				sendJSONResponse(w, http.StatusUnauthorized, Response{
+					Success: false,
+					Error:   "a valid admin token is required",
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// hasBearerToken reports whether a request presents token, which is always the case
+// when token is empty
+func hasBearerToken(r *http.Request, token string) bool {
+	presented := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token == "" || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1
+}
+
+// runtimeStatsHandler reports goroutines, memory, garbage collection and mutex
+// contention of the process
+func runtimeStatsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+
+		stats := RuntimeStats{
+			GoVersion:  runtime.Version(),
+			Uptime:     time.Since(db.StartedAt()).Round(time.Second).String(),
+			CPUs:       runtime.NumCPU(),
+			MaxProcs:   runtime.GOMAXPROCS(0),
+			Goroutines: runtime.NumGoroutine(),
+			Memory: MemoryStats{
+				HeapAlloc:   mem.HeapAlloc,
+				HeapInuse:   mem.HeapInuse,
+				HeapObjects: mem.HeapObjects,
+				StackInuse:  mem.StackInuse,
+				Sys:         mem.Sys,
+			},
+			GC: GCStats{
+				Cycles:        mem.NumGC,
+				Forced:        mem.NumForcedGC,
+				PauseTotal:    time.Duration(mem.PauseTotalNs).String(),
+				RecentPauses:  recentPauses(&mem, 10),
+				CPUFraction:   mem.GCCPUFraction,
+				NextHeapAlloc: mem.NextGC,
+			},
+			Contention: mutexContention(contentionSites),
+		}
+		if mem.LastGC > 0 {
+			last := time.Unix(0, int64(mem.LastGC)).UTC()
+			stats.GC.LastAt = &last
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    stats,
+		})
+	}
+}
+
+// recentPauses returns up to n of the latest GC pauses, newest first
+func recentPauses(mem *runtime.MemStats, n int) []string {
+	pauses := make([]string, 0, n)
+	for i := 0; i < n && i < int(mem.NumGC) && i < len(mem.PauseNs); i++ {
+		// PauseNs is a circular buffer whose latest entry is at (NumGC+255)%256
+		index := (int(mem.NumGC) - 1 - i + len(mem.PauseNs)) % len(mem.PauseNs)
+		pauses = append(pauses, time.Duration(mem.PauseNs[index]).String())
+	}
+	return pauses
+}
+
+// mutexContention returns the n call sites that waited longest for mutexes, as
+// sampled at the rate set with runtime.SetMutexProfileFraction
+func mutexContention(n int) []ContentionSite {
+	records := make([]runtime.BlockProfileRecord, 64)
+	for {
+		count, complete := runtime.MutexProfile(records)
+		if complete {
+			records = records[:count]
+			break
+		}
+		records = make([]runtime.BlockProfileRecord, count+count/4)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Cycles > records[j].Cycles })
+	if len(records) > n {
+		records = records[:n]
+	}
+
+	sites := make([]ContentionSite, 0, len(records))
+	for _, record := range records {
+		site := ContentionSite{Events: record.Count, Cycles: record.Cycles}
+		frames := runtime.CallersFrames(record.Stack())
+		for {
+			frame, more := frames.Next()
+			// The first frame outside sync and runtime is the one holding the lock
+			if !strings.HasPrefix(frame.Function, "sync.") && !strings.HasPrefix(frame.Function, "runtime.") || !more {
+				site.Function = frame.Function
+				site.Location = frame.File + ":" + strconv.Itoa(frame.Line)
+				break
+			}
+		}
+		sites = append(sites, site)
+	}
+	return sites
+}
+
+// routinesHandler reports the supervised background routines, including restarts
+// after panics
+func routinesHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    db.RoutineStatus(),
+		})
+	}
+}
+
+// memoryHandler reports memory use against the configured budget, with the items
+// evicted and the latest warning and eviction events
+func memoryHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    db.MemoryStats(),
+		})
+	}
+}
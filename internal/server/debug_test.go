@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/config"
+	"multimodel-db-engine/internal/database"
+)
+
+func TestDebugRoutesRequireAdminToken(t *testing.T) {
+	for _, token := range []string{"s3cret", ""} {
+		db := database.NewMultiModelDatabase(&config.Config{DataDir: t.TempDir(), ReplicationFactor: 1, AdminToken: token})
+		defer db.Close()
+		router := mux.NewRouter()
+		SetupDebugRoutes(router, db)
+
+		tests := []struct {
+			authorization string
+			status        int
+		}{
+			{"", http.StatusUnauthorized},
+			{"Bearer wrong", http.StatusUnauthorized},
+			{"Bearer s3cret", http.StatusOK},
+		}
+		for _, path := range []string{"/admin/debug/runtime", "/debug/pprof/cmdline", "/debug/pprof/"} {
+			for _, tt := range tests {
+				want := tt.status
+				if token == "" {
+					want = http.StatusOK // without a configured token the routes are open
+				}
+				r := httptest.NewRequest("GET", path, nil)
+				if tt.authorization != "" {
+					r.Header.Set("Authorization", tt.authorization)
+				}
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, r)
+				if w.Code != want {
+					t.Errorf("token %q: %s with %q answered %d, want %d", token, path, tt.authorization, w.Code, want)
+				}
+			}
+		}
+	}
+}
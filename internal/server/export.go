@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/database"
+	"multimodel-db-engine/internal/parquet"
+)
+
+// exportParquetTypes maps export column types onto Parquet column types
+var exportParquetTypes = map[string]parquet.Type{
+	database.ExportBoolean: parquet.Boolean,
+	database.ExportInt64:   parquet.Int64,
+	database.ExportDouble:  parquet.Double,
+	database.ExportString:  parquet.String,
+	database.ExportJSON:    parquet.JSON,
+}
+
+// exportCollectionHandler downloads a collection as a table for analytics tools:
+// GET /docs/{collection}/_export?format=parquet|csv
+func exportCollectionHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collection := mux.Vars(r)["collection"]
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "csv"
+		}
+		if format != "csv" && format != "parquet" {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   fmt.Sprintf("Unsupported export format %q, expected csv or parquet", format),
+			})
+			return
+		}
+
+		table, err := db.ExportCollection(r.Context(), collection)
+		if err != nil {
+			sendJSONResponse(w, errorStatus(err, http.StatusInternalServerError), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		if format == "parquet" {
+			columns := make([]parquet.Column, len(table.Columns))
+			for i, column := range table.Columns {
+				// The id column is never null
+				columns[i] = parquet.Column{Name: column.Name, Type: exportParquetTypes[column.Type], Required: i == 0}
+			}
+			var file bytes.Buffer
+			if err := parquet.Write(&file, columns, table.Rows); err != nil {
+				sendJSONResponse(w, http.StatusInternalServerError, Response{
+					Success: false,
+					Error:   err.Error(),
+				})
+				return
+			}
+			w.Header().Set("Content-Type", "application/vnd.apache.parquet")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", collection+".parquet"))
+			w.Write(file.Bytes())
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", collection+".csv"))
+		writeCSV(w, table)
+	}
+}
+
+// writeCSV writes table with a header row; nulls are empty cells
+func writeCSV(w http.ResponseWriter, table *database.ExportTable) {
+	out := csv.NewWriter(w)
+	record := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		record[i] = column.Name
+	}
+	out.Write(record)
+
+	for _, row := range table.Rows {
+		for i, value := range row {
+			switch v := value.(type) {
+			case nil:
+				record[i] = ""
+			case bool:
+				record[i] = strconv.FormatBool(v)
+			case int64:
+				record[i] = strconv.FormatInt(v, 10)
+			case float64:
+				record[i] = strconv.FormatFloat(v, 'g', -1, 64)
+			case string:
+				record[i] = v
+			default:
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		out.Write(record)
+	}
+	out.Flush()
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// faultInjectorOrReject returns the database's fault injector, or responds with 404
+// when fault injection is not enabled
+func faultInjectorOrReject(w http.ResponseWriter, db *database.MultiModelDatabase) *database.FaultInjector {
+	if db.Faults == nil {
+		sendJSONResponse(w, http.StatusNotFound, Response{
+			Success: false,
+			Error:   "fault injection is disabled, set FAULT_INJECTION=true to enable it",
+		})
+	}
+	return db.Faults
+}
+
+func listFaultsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		faults := faultInjectorOrReject(w, db)
+		if faults == nil {
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    faults.List(),
+		})
+	}
+}
+
+// setFaultHandler arms a fault: {"point": "journal_write", "probability": 0.5, "remaining": 1}
+func setFaultHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		faults := faultInjectorOrReject(w, db)
+		if faults == nil {
+			return
+		}
+
+		var fault database.Fault
+		if err := readJSONBody(r, &fault); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid JSON in request body",
+			})
+			return
+		}
+		if err := faults.Set(fault); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Fault armed",
+			Data:    faults.List(),
+		})
+	}
+}
+
+func clearFaultHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		faults := faultInjectorOrReject(w, db)
+		if faults == nil {
+			return
+		}
+
+		faults.Clear(database.FaultPoint(mux.Vars(r)["point"]))
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Fault cleared",
+		})
+	}
+}
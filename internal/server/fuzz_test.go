@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func FuzzParsePredicate(f *testing.F) {
+	f.Add("status==active")
+	f.Add("score>=10")
+	f.Add("a<b<c")
+	f.Add("==")
+	f.Add("")
+
+	f.Fuzz(func(t *testing.T, clause string) {
+		predicate, err := parsePredicate(clause)
+		if err != nil {
+			if clause != "" {
+				t.Fatalf("parsePredicate(%q) failed: %v", clause, err)
+			}
+			return
+		}
+		if predicate.Column == "" {
+			t.Fatalf("parsePredicate(%q) returned an empty column", clause)
+		}
+		if predicate.Op == "exists" {
+			if predicate.Column != clause {
+				t.Fatalf("parsePredicate(%q) = exists on %q", clause, predicate.Column)
+			}
+			return
+		}
+
+		// The clause must be recoverable from the predicate
+		for _, candidate := range predicateOperators {
+			if candidate.op == predicate.Op {
+				value, _ := predicate.Value.(string)
+				if predicate.Column+candidate.token+value != clause {
+					t.Fatalf("parsePredicate(%q) = %+v does not reassemble", clause, predicate)
+				}
+				return
+			}
+		}
+		t.Fatalf("parsePredicate(%q) returned unknown op %q", clause, predicate.Op)
+	})
+}
+
+func FuzzParseColumnScanQuery(f *testing.F) {
+	f.Add("start=a&end=m&limit=10&columns=x,y&where=x>1")
+	f.Add("prefix=user:&where=active")
+	f.Add("limit=-1")
+	f.Add("where=&where===")
+
+	f.Fuzz(func(t *testing.T, rawQuery string) {
+		query, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return
+		}
+		scan, err := parseColumnScanQuery(query)
+		if err != nil {
+			return
+		}
+		if scan.Limit < 0 {
+			t.Fatalf("negative limit accepted from %q", rawQuery)
+		}
+		if len(scan.Predicates) != len(query["where"]) {
+			t.Fatalf("%d where clauses parsed into %d predicates", len(query["where"]), len(scan.Predicates))
+		}
+		if columns := query.Get("columns"); columns != "" && strings.Join(scan.Columns, ",") != columns {
+			t.Fatalf("columns %q parsed as %v", columns, scan.Columns)
+		}
+	})
+}
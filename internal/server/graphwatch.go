@@ -0,0 +1,58 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// graphWatchHandler streams the graph mutations matching ?label= (nodes) and ?type=
+// (edges) as server-sent events, named after the kind and operation of the change,
+// e.g. node_insert, until the client disconnects
+func graphWatchHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			sendJSONResponse(w, http.StatusInternalServerError, Response{
+				Success: false,
+				Error:   "Streaming is not supported",
+			})
+			return
+		}
+
+		filter := database.GraphFilter{Label: r.URL.Query().Get("label"), Type: r.URL.Query().Get("type")}
+		changes, cancel := db.WatchGraph(filter)
+		defer cancel()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(eventKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case change, open := <-changes:
+				if !open {
+					return
+				}
+				kind := "edge"
+				if change.Node != nil {
+					kind = "node"
+				}
+				data, _ := json.Marshal(change)
+				fmt.Fprintf(w, "event: %s_%s\ndata: %s\n\n", kind, change.Op, data)
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			}
+			flusher.Flush()
+		}
+	}
+}
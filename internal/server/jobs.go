@@ -0,0 +1,119 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// jobRequest is the body for creating or replacing a scheduled job
+type jobRequest struct {
+	ID       string             `json:"id"`
+	Schedule string             `json:"schedule"`
+	Action   database.JobAction `json:"action"`
+	Enabled  *bool              `json:"enabled"`
+}
+
+func listJobsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    db.Scheduler.ListJobs(),
+		})
+	}
+}
+
+// putJobHandler creates a job (POST /admin/jobs with an id in the body) or replaces
+// one (PUT /admin/jobs/{id})
+func putJobHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request jobRequest
+		if err := readJSONBody(r, &request); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid JSON in request body",
+			})
+			return
+		}
+		if id, exists := mux.Vars(r)["id"]; exists {
+			request.ID = id
+		}
+
+		enabled := true
+		if request.Enabled != nil {
+			enabled = *request.Enabled
+		}
+
+		job, err := db.Scheduler.PutJob(request.ID, request.Schedule, request.Action, enabled)
+		if err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Job saved",
+			Data:    job,
+		})
+	}
+}
+
+func getJobHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, err := db.Scheduler.GetJob(mux.Vars(r)["id"])
+		if err != nil {
+			sendJSONResponse(w, http.StatusNotFound, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    job,
+		})
+	}
+}
+
+func deleteJobHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := db.Scheduler.DeleteJob(mux.Vars(r)["id"]); err != nil {
+			sendJSONResponse(w, http.StatusNotFound, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Job deleted",
+		})
+	}
+}
+
+// runJobHandler fires a job immediately and returns its updated state
+func runJobHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, err := db.Scheduler.RunJob(mux.Vars(r)["id"])
+		if err != nil {
+			sendJSONResponse(w, http.StatusNotFound, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Job executed",
+			Data:    job,
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// revisionHeader reports the revision of a key on KV reads and writes
+const revisionHeader = "X-Revision"
+
+const (
+	defaultWatchTimeout = 30 * time.Second
+	maxWatchTimeout     = 5 * time.Minute
+)
+
+// watchKeyHandler long-polls for a change to a key. With ?revision=N it returns at once
+// if the key is already past N; otherwise it waits up to ?timeout (default 30s).
+func watchKeyHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		bucket := vars["bucket"]
+		key := vars["key"]
+
+		if !authorizeBucket(w, r, db, bucket, false) {
+			return
+		}
+
+		query := r.URL.Query()
+		afterRevision, err := parseRevision(query.Get("revision"))
+		if err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		timeout, err := parseWaitTimeout(query.Get("timeout"))
+		if err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		event, _ := db.WatchBucketKey(ctx, bucket, key, afterRevision)
+		if event == nil {
+			sendJSONResponse(w, http.StatusOK, Response{
+				Success: true,
+				Message: "Watch timed out without changes",
+				Data:    map[string]interface{}{"timeout": true},
+			})
+			return
+		}
+
+		w.Header().Set(revisionHeader, strconv.FormatInt(event.Revision, 10))
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    event,
+		})
+	}
+}
+
+// parseRevision parses the revision a watch waits to be passed, 0 when raw is empty
+func parseRevision(raw string) (int64, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	revision, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || revision < 0 {
+		return 0, fmt.Errorf("invalid revision %q", raw)
+	}
+	return revision, nil
+}
+
+// parseWaitTimeout parses a long-poll timeout, applying the default and upper bound
+func parseWaitTimeout(raw string) (time.Duration, error) {
+	if raw == "" {
+		return defaultWatchTimeout, nil
+	}
+	timeout, err := time.ParseDuration(raw)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q", raw)
+	}
+	if timeout > maxWatchTimeout {
+		timeout = maxWatchTimeout
+	}
+	return timeout, nil
+}
+
+// waitRequested reports whether a read asked to long-poll with ?wait=true
+func waitRequested(r *http.Request) bool {
+	wait, _ := strconv.ParseBool(r.URL.Query().Get("wait"))
+	return wait
+}
+
+// isLongPoll reports whether a request parks until a change, either as a watch or as
+// a read with ?wait=true
+func isLongPoll(r *http.Request) bool {
+	return strings.HasSuffix(r.URL.Path, "/_watch") || waitRequested(r)
+}
+
+// waitForChange serves the long-poll of a read with ?wait=true, calling watch with
+// a context bounded by ?timeout (default 30s). It reports whether the handler should
+// go on to serve the read; otherwise a 304 (no change before the timeout) or an error
+// has been written.
+func waitForChange(w http.ResponseWriter, r *http.Request, watch func(ctx context.Context) (bool, error)) bool {
+	if !waitRequested(r) {
+		return true
+	}
+	timeout, err := parseWaitTimeout(r.URL.Query().Get("timeout"))
+	if err != nil {
+		sendJSONResponse(w, http.StatusBadRequest, Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	changed, err := watch(ctx)
+	if err != nil {
+		sendJSONResponse(w, http.StatusBadRequest, Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return false
+	}
+	if !changed {
+		w.WriteHeader(http.StatusNotModified)
+		return false
+	}
+	return true
+}
+
+// createLeaseHandler grants a lease: {"ttl": "10s"}
+func createLeaseHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			TTL string `json:"ttl"`
+		}
+		if err := readJSONBody(r, &request); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid JSON in request body",
+			})
+			return
+		}
+
+		ttl, err := parseTTL(request.TTL)
+		if err != nil || ttl == 0 {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   fmt.Sprintf("invalid lease ttl %q", request.TTL),
+			})
+			return
+		}
+
+		lease, err := db.CreateLease(ttl)
+		if err != nil {
+			sendJSONResponse(w, http.StatusInternalServerError, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusCreated, Response{
+			Success: true,
+			Message: "Lease granted",
+			Data:    lease,
+		})
+	}
+}
+
+func getLeaseHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lease, err := db.GetLease(mux.Vars(r)["id"])
+		if err != nil {
+			sendJSONResponse(w, http.StatusNotFound, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    lease,
+		})
+	}
+}
+
+func keepAliveLeaseHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lease, err := db.KeepAliveLease(mux.Vars(r)["id"])
+		if err != nil {
+			sendJSONResponse(w, http.StatusNotFound, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Lease renewed",
+			Data:    lease,
+		})
+	}
+}
+
+func revokeLeaseHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := db.RevokeLease(mux.Vars(r)["id"]); err != nil {
+			sendJSONResponse(w, http.StatusNotFound, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Lease revoked",
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// lineageHandler reports what produced an item and what depends on it:
+// GET /lineage/{model}/{namespace}/{key}, e.g. /lineage/document/orders/o1
+func lineageHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		lineage, err := db.Lineage(database.LineageItem{
+			Model:     database.Model(vars["model"]),
+			Namespace: vars["namespace"],
+			Key:       vars["key"],
+		})
+		if err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    lineage,
+		})
+	}
+}
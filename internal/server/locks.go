@@ -0,0 +1,178 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// defaultLockTTL is the lease of locks acquired without a ttl
+const defaultLockTTL = 30 * time.Second
+
+// lockStatus maps lock errors to HTTP status codes
+func lockStatus(err error) int {
+	if errors.Is(err, database.ErrLockHeld) || errors.Is(err, database.ErrLockNotHeld) {
+		return http.StatusConflict
+	}
+	// Too few nodes reachable to form a quorum
+	return http.StatusServiceUnavailable
+}
+
+// readLockRequest reads {"owner": "...", "ttl": "10s"}, answering 400 when invalid
+func readLockRequest(w http.ResponseWriter, r *http.Request) (owner string, ttl time.Duration, ok bool) {
+	var request struct {
+		Owner string `json:"owner"`
+		TTL   string `json:"ttl"`
+	}
+	if err := readJSONBody(r, &request); err != nil || request.Owner == "" {
+		sendJSONResponse(w, http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Request body must contain an owner",
+		})
+		return "", 0, false
+	}
+
+	ttl, err := parseTTL(request.TTL)
+	if err != nil {
+		sendJSONResponse(w, http.StatusBadRequest, Response{
+			Success: false,
+			Error:   fmt.Sprintf("invalid lock ttl %q", request.TTL),
+		})
+		return "", 0, false
+	}
+	if ttl == 0 {
+		ttl = defaultLockTTL
+	}
+	return request.Owner, ttl, true
+}
+
+// acquireLockHandler acquires or renews a lock for the owner in the request body
+func acquireLockHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		owner, ttl, ok := readLockRequest(w, r)
+		if !ok {
+			return
+		}
+
+		lock, err := db.AcquireLock(mux.Vars(r)["name"], owner, ttl)
+		if err != nil {
+			sendJSONResponse(w, lockStatus(err), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Lock acquired",
+			Data:    lock,
+		})
+	}
+}
+
+// releaseLockHandler releases a lock held by the owner in the request body
+func releaseLockHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		owner, _, ok := readLockRequest(w, r)
+		if !ok {
+			return
+		}
+
+		if err := db.ReleaseLock(mux.Vars(r)["name"], owner); err != nil {
+			sendJSONResponse(w, lockStatus(err), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Lock released",
+		})
+	}
+}
+
+// grantLockHandler records a lock grant requested by the peer gathering a quorum
+func grantLockHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cluster := clusterOrReject(w, db)
+		if cluster == nil || fenceStaleEpoch(w, r, cluster) {
+			return
+		}
+		owner, ttl, ok := readLockRequest(w, r)
+		if !ok {
+			return
+		}
+
+		token, err := db.GrantLock(mux.Vars(r)["name"], owner, ttl)
+		if err != nil {
+			sendJSONResponse(w, lockStatus(err), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    map[string]uint64{"fencing_token": token},
+		})
+	}
+}
+
+// revokeLockHandler removes a lock grant on behalf of a peer
+func revokeLockHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if clusterOrReject(w, db) == nil {
+			return
+		}
+		owner, _, ok := readLockRequest(w, r)
+		if !ok {
+			return
+		}
+
+		if err := db.RevokeLock(mux.Vars(r)["name"], owner); err != nil {
+			sendJSONResponse(w, lockStatus(err), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+		})
+	}
+}
+
+// observeLockHandler raises the local fencing counter to a token chosen by a peer
+func observeLockHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if clusterOrReject(w, db) == nil {
+			return
+		}
+
+		var request struct {
+			FencingToken uint64 `json:"fencing_token"`
+		}
+		if err := readJSONBody(r, &request); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid JSON in request body",
+			})
+			return
+		}
+
+		db.ObserveLockToken(mux.Vars(r)["name"], request.FencingToken)
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+		})
+	}
+}
@@ -0,0 +1,396 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// rateLimitSweepInterval is how often buckets of clients that went quiet are dropped
+const rateLimitSweepInterval = time.Minute
+
+// apiMiddleware returns the middleware of the API router, outermost first: response
+// metadata is timed from the start, access logging and metrics observe every
+// response, including the 500 a recovered panic turns into, and authentication and
+// rate limiting run before a request takes an admission slot.
+func apiMiddleware(db *database.MultiModelDatabase, admission *admissionController, metrics *requestMetrics) []mux.MiddlewareFunc {
+	cfg := db.Config()
+	return []mux.MiddlewareFunc{
+		responseMetaMiddleware(nodeName(db)),
+		accessLogMiddleware(cfg.AccessLog),
+		metrics.middleware(),
+		recoveryMiddleware(),
+		apiTokenMiddleware(cfg.APIToken),
+		newRateLimiter(cfg.RateLimit, cfg.RateBurst).middleware(),
+		admission.middleware(),
+		readOnlyMiddleware(db),
+		timeoutMiddleware(db),
+	}
+}
+
+// statusRecorder captures the status and size of a response for the middleware,
+// passing flushes through to streamed responses
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+
+	// Set on API requests, whose responses carry a ResponseMeta
+	started time.Time
+	node    string
+}
+
+// recordResponse wraps w, unless an outer middleware already did
+func recordResponse(w http.ResponseWriter) *statusRecorder {
+	if recorder, ok := w.(*statusRecorder); ok {
+		return recorder
+	}
+	return &statusRecorder{ResponseWriter: w}
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += n
+	return n, err
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// meta completes the metadata of a response with its timing and node, or returns it
+// unchanged outside the API
+func (r *statusRecorder) meta(meta *ResponseMeta) *ResponseMeta {
+	if r.started.IsZero() {
+		return meta
+	}
+	completed := ResponseMeta{}
+	if meta != nil {
+		completed = *meta
+	}
+	completed.ElapsedMs = milliseconds(time.Since(r.started))
+	completed.Node = r.node
+	return &completed
+}
+
+// statusCode returns the status sent, 200 for handlers that wrote nothing
+func (r *statusRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// recoveryMiddleware turns a panicking handler into a 500 JSON response and logs its
+// stack. When the handler had already started its response, the connection is
+// aborted instead, as a structured error can no longer be sent.
+func recoveryMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recorder := recordResponse(w)
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+				log.Printf("Panic serving %s %s: %v\n%s", r.Method, r.URL.Path, recovered, debug.Stack())
+				if recorder.status != 0 {
+					panic(http.ErrAbortHandler)
+				}
+				sendJSONResponse(recorder, http.StatusInternalServerError, Response{
+					Success: false,
+					Error:   "internal server error",
+				})
+			}()
+			next.ServeHTTP(recorder, r)
+		})
+	}
+}
+
+// responseMetaMiddleware starts timing a request for the metadata of its response
+func responseMetaMiddleware(node string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recorder := recordResponse(w)
+			recorder.started = time.Now()
+			recorder.node = node
+			next.ServeHTTP(recorder, r)
+		})
+	}
+}
+
+// nodeName identifies the server in response metadata: its cluster node id, or the
+// host name of a standalone server
+func nodeName(db *database.MultiModelDatabase) string {
+	if db.Cluster != nil {
+		return db.Cluster.Self().ID
+	}
+	host, _ := os.Hostname()
+	return host
+}
+
+// onBehalfOfHeader names the user a trusted proxy, such as the web admin, makes a
+// request for. It only attributes the request in the access log.
+const onBehalfOfHeader = "X-On-Behalf-Of"
+
+// accessLogMiddleware logs each request with its status, size and duration
+func accessLogMiddleware(enabled bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if !enabled {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recorder := recordResponse(w)
+			started := time.Now()
+			defer func() {
+				client := clientAddress(r)
+				if user := r.Header.Get(onBehalfOfHeader); user != "" {
+					client += fmt.Sprintf(" for %q", user)
+				}
+				log.Printf("%s %s %s %d %dB %v", client, r.Method, r.URL.RequestURI(),
+					recorder.statusCode(), recorder.bytes, time.Since(started).Round(time.Microsecond))
+			}()
+			next.ServeHTTP(recorder, r)
+		})
+	}
+}
+
+// clientAddress returns the IP address a request came from
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// apiTokenMiddleware rejects API requests without the bearer token, unless it is
+// empty. Health checks stay open to load balancers and orchestrators.
+func apiTokenMiddleware(token string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if token == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/health" && !hasBearerToken(r, token) {
+				sendJSONResponse(w, http.StatusUnauthorized, Response{
+					Success: false,
+					Error:   "a valid API token is required",
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RouteMetrics reports the requests served by one route
+type RouteMetrics struct {
+	Route    string           `json:"route"` // method and path template
+	Requests int64            `json:"requests"`
+	Statuses map[string]int64 `json:"statuses"` // by class: 2xx, 4xx, 5xx, ...
+	MeanMs   float64          `json:"mean_ms"`
+	MaxMs    float64          `json:"max_ms"`
+}
+
+type routeStats struct {
+	requests int64
+	statuses map[string]int64
+	total    time.Duration
+	max      time.Duration
+}
+
+// requestMetrics counts requests, their statuses and latencies per route
+type requestMetrics struct {
+	routes map[string]*routeStats
+	mutex  sync.Mutex
+}
+
+func newRequestMetrics() *requestMetrics {
+	return &requestMetrics{routes: make(map[string]*routeStats)}
+}
+
+func (m *requestMetrics) middleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recorder := recordResponse(w)
+			started := time.Now()
+			defer func() {
+				m.observe(routeName(r), recorder.statusCode(), time.Since(started))
+			}()
+			next.ServeHTTP(recorder, r)
+		})
+	}
+}
+
+// routeName identifies the route of a request by its template, so that requests
+// for different documents are counted together
+func routeName(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return r.Method + " " + template
+		}
+	}
+	return r.Method + " " + r.URL.Path
+}
+
+func (m *requestMetrics) observe(route string, status int, elapsed time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stats, exists := m.routes[route]
+	if !exists {
+		stats = &routeStats{statuses: make(map[string]int64)}
+		m.routes[route] = stats
+	}
+	stats.requests++
+	stats.statuses[strconv.Itoa(status/100)+"xx"]++
+	stats.total += elapsed
+	if elapsed > stats.max {
+		stats.max = elapsed
+	}
+}
+
+// snapshot returns the metrics of every route, busiest first
+func (m *requestMetrics) snapshot() []RouteMetrics {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	routes := make([]RouteMetrics, 0, len(m.routes))
+	for route, stats := range m.routes {
+		statuses := make(map[string]int64, len(stats.statuses))
+		for class, count := range stats.statuses {
+			statuses[class] = count
+		}
+		routes = append(routes, RouteMetrics{
+			Route:    route,
+			Requests: stats.requests,
+			Statuses: statuses,
+			MeanMs:   milliseconds(stats.total / time.Duration(stats.requests)),
+			MaxMs:    milliseconds(stats.max),
+		})
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Requests != routes[j].Requests {
+			return routes[i].Requests > routes[j].Requests
+		}
+		return routes[i].Route < routes[j].Route
+	})
+	return routes
+}
+
+func milliseconds(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Millisecond)*1000) / 1000
+}
+
+// metricsHandler reports request counts, statuses and latencies per route
+func metricsHandler(metrics *requestMetrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    metrics.snapshot(),
+		})
+	}
+}
+
+// rateLimiter gives each client a token bucket refilled at rate tokens per second,
+// holding at most burst tokens
+type rateLimiter struct {
+	rate    float64
+	burst   float64
+	clients map[string]*tokenBucket
+	swept   time.Time
+	mutex   sync.Mutex
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newRateLimiter(rate, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: float64(rate), burst: float64(burst), clients: make(map[string]*tokenBucket), swept: time.Now()}
+}
+
+// allow takes a token from the client's bucket, or returns how long until one is available
+func (l *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if now.Sub(l.swept) >= rateLimitSweepInterval {
+		// A bucket left alone long enough to refill is the same as a new one
+		full := time.Duration(l.burst / l.rate * float64(time.Second))
+		for key, bucket := range l.clients {
+			if now.Sub(bucket.updated) >= full {
+				delete(l.clients, key)
+			}
+		}
+		l.swept = now
+	}
+
+	bucket, exists := l.clients[client]
+	if !exists {
+		bucket = &tokenBucket{tokens: l.burst, updated: now}
+		l.clients[client] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate)
+	bucket.updated = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+}
+
+// middleware rejects requests of clients over their rate with 429 and Retry-After.
+// Health checks are not limited.
+func (l *rateLimiter) middleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if l.rate <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/health" {
+				if allowed, wait := l.allow(clientAddress(r), time.Now()); !allowed {
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+					sendJSONResponse(w, http.StatusTooManyRequests, Response{
+						Success: false,
+						Error:   "rate limit exceeded, retry later",
+					})
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
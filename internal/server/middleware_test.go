@@ -0,0 +1,118 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRecoveryMiddleware(t *testing.T) {
+	metrics := newRequestMetrics()
+	router := mux.NewRouter()
+	router.Use(metrics.middleware(), recoveryMiddleware())
+	router.HandleFunc("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var items map[string]string
+		items[mux.Vars(r)["id"]] = "lost"
+	})
+
+	for _, id := range []string{"a", "b"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/items/"+id, nil))
+		if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), `"error":"internal server error"`) {
+			t.Fatalf("panic answered %d %s", w.Code, w.Body)
+		}
+	}
+	routes := metrics.snapshot()
+	if len(routes) != 1 || routes[0].Route != "GET /items/{id}" || routes[0].Statuses["5xx"] != 2 {
+		t.Fatalf("metrics = %+v", routes)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(2, 3)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if allowed, _ := limiter.allow("10.0.0.1", now); !allowed {
+			t.Fatalf("request %d of the burst rejected", i)
+		}
+	}
+	allowed, wait := limiter.allow("10.0.0.1", now)
+	if allowed || wait != 500*time.Millisecond {
+		t.Fatalf("over the burst: allowed %v, wait %v", allowed, wait)
+	}
+	if allowed, _ := limiter.allow("10.0.0.2", now); !allowed {
+		t.Fatal("clients share a bucket")
+	}
+	if allowed, _ := limiter.allow("10.0.0.1", now.Add(wait)); !allowed {
+		t.Fatal("bucket not refilled")
+	}
+
+	// Buckets of quiet clients are dropped once they would be full again
+	limiter.allow("10.0.0.3", now.Add(rateLimitSweepInterval))
+	if len(limiter.clients) != 1 {
+		t.Fatalf("%d buckets kept", len(limiter.clients))
+	}
+}
+
+func TestResponseMeta(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(responseMetaMiddleware("node-1"))
+	router.HandleFunc("/list", func(w http.ResponseWriter, r *http.Request) {
+		sendJSONResponse(w, http.StatusOK, Response{Success: true, Data: []string{"a", "b"}, Meta: listMeta(2, true)})
+	})
+	router.HandleFunc("/raw", func(w http.ResponseWriter, r *http.Request) {
+		sendRawDataResponse(w, []byte(`{"a":1}`))
+	})
+
+	for path, want := range map[string]string{
+		"/list": `"node":"node-1","count":2,"total":2}}`,
+		"/raw":  `"node":"node-1"}}`,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		var response struct {
+			Meta *ResponseMeta `json:"meta"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Meta == nil {
+			t.Fatalf("%s answered %s", path, w.Body)
+		}
+		if !strings.HasSuffix(strings.TrimSpace(w.Body.String()), want) {
+			t.Errorf("%s answered %s", path, w.Body)
+		}
+	}
+
+	// Outside the API, responses carry no metadata
+	w := httptest.NewRecorder()
+	sendJSONResponse(recordResponse(w), http.StatusOK, Response{Success: true})
+	if strings.Contains(w.Body.String(), "meta") {
+		t.Fatalf("metadata outside the API: %s", w.Body)
+	}
+}
+
+func TestAccessLogNamesProxiedUser(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	router := mux.NewRouter()
+	router.Use(accessLogMiddleware(true))
+	router.HandleFunc("/docs/{collection}", func(w http.ResponseWriter, r *http.Request) {})
+
+	r := httptest.NewRequest("DELETE", "/docs/orders", nil)
+	r.Header.Set(onBehalfOfHeader, "alice")
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/docs/orders", nil))
+
+	lines := strings.Split(strings.TrimSpace(logged.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `192.0.2.1 for "alice" DELETE /docs/orders 200`) || strings.Contains(lines[1], " for ") {
+		t.Fatalf("access log:\n%s", logged.String())
+	}
+}
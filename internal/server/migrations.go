@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// migrateHandler applies pending migrations:
+// {"migrations": [{"version": 1, "name": "...", "steps": [...]}], "target": 0, "dry_run": false}
+func migrateHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Migrations []database.Migration `json:"migrations"`
+			Target     int                  `json:"target"`
+			DryRun     bool                 `json:"dry_run"`
+		}
+		if r.ContentLength != 0 {
+			if err := readJSONBody(r, &request); err != nil {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   "Invalid JSON in request body",
+				})
+				return
+			}
+		}
+
+		result, err := db.Migrate(request.Migrations, request.Target, request.DryRun)
+		if err != nil {
+			sendJSONResponse(w, http.StatusConflict, Response{
+				Success: false,
+				Error:   err.Error(),
+				Data:    result,
+			})
+			return
+		}
+
+		message := "Migrations applied"
+		if request.DryRun {
+			message = "Dry run, no migrations applied"
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: message,
+			Data:    result,
+		})
+	}
+}
+
+func listMigrationsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    db.AppliedMigrations(),
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/config"
+	"multimodel-db-engine/internal/database"
+)
+
+// vetoPlugin rejects every document insert
+type vetoPlugin struct {
+	database.BasePlugin
+}
+
+func (vetoPlugin) Name() string { return "veto" }
+
+func (vetoPlugin) OnInsert(event *database.WriteEvent) error {
+	return errors.New("inserts are closed")
+}
+
+func TestPluginRejectionAnswers422(t *testing.T) {
+	db := database.NewMultiModelDatabase(&config.Config{DataDir: t.TempDir(), ReplicationFactor: 1})
+	defer db.Close()
+	if err := db.RegisterPlugin(vetoPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	SetupRoutes(router, db)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/docs/users/1", strings.NewReader(`{"name": "ann"}`)))
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "inserts are closed") {
+		t.Fatalf("vetoed insert answered %d: %s", w.Code, w.Body)
+	}
+}
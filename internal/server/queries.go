@@ -0,0 +1,101 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// savedQueriesHandler lists the saved queries, or saves one with POST
+// {"name": "orders_by_user", "collection": "orders", "query": "user_id={{user}}&_sort=-total",
+// "defaults": {}, "description": ""}
+func savedQueriesHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			sendJSONResponse(w, http.StatusOK, Response{
+				Success: true,
+				Data:    db.SavedQueries(),
+			})
+			return
+		}
+
+		var request database.SavedQuery
+		if err := readJSONBody(r, &request); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid JSON in request body",
+			})
+			return
+		}
+		saved, err := db.SaveQuery(request)
+		if err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusCreated, Response{
+			Success: true,
+			Message: "Query saved",
+			Data:    saved,
+		})
+	}
+}
+
+// savedQueryHandler returns or deletes a saved query
+func savedQueryHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+		if r.Method == http.MethodDelete {
+			if err := db.DeleteSavedQuery(name); err != nil {
+				sendJSONResponse(w, http.StatusNotFound, Response{
+					Success: false,
+					Error:   err.Error(),
+				})
+				return
+			}
+			sendJSONResponse(w, http.StatusOK, Response{
+				Success: true,
+				Message: "Query deleted",
+			})
+			return
+		}
+
+		saved, err := db.SavedQuery(name)
+		if err != nil {
+			sendJSONResponse(w, http.StatusNotFound, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    saved,
+		})
+	}
+}
+
+// runSavedQueryHandler runs a saved query with its parameters taken from the query
+// string: GET /queries/{name}/run?user=u1
+func runSavedQueryHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		args := make(map[string]string)
+		for name, values := range r.URL.Query() {
+			if len(values) > 0 {
+				args[name] = values[0]
+			}
+		}
+
+		docs, err := db.RunSavedQuery(r.Context(), mux.Vars(r)["name"], args)
+		fallback := http.StatusBadRequest
+		if errors.Is(err, database.ErrSavedQueryNotFound) {
+			fallback = http.StatusNotFound
+		}
+		sendQueryResults(w, docs, err, fallback)
+	}
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/database"
+)
+
+func listQueuesHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		queues, err := db.Queues.ListQueues()
+		if err != nil {
+			sendJSONResponse(w, http.StatusInternalServerError, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    queues,
+		})
+	}
+}
+
+func queueStatsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats, err := db.Queues.Stats(mux.Vars(r)["name"])
+		if err != nil {
+			sendJSONResponse(w, http.StatusNotFound, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    stats,
+		})
+	}
+}
+
+// enqueueHandler appends a message: {"payload": ...}
+func enqueueHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Payload interface{} `json:"payload"`
+		}
+		if err := readJSONBody(r, &request); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid JSON in request body",
+			})
+			return
+		}
+
+		message, err := db.Queues.Enqueue(mux.Vars(r)["name"], request.Payload)
+		if err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusCreated, Response{
+			Success: true,
+			Message: "Message enqueued",
+			Data:    message,
+		})
+	}
+}
+
+// dequeueHandler receives messages: {"max": 10, "visibility_timeout": "30s"}
+func dequeueHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Max               int    `json:"max"`
+			VisibilityTimeout string `json:"visibility_timeout"`
+		}
+		if r.ContentLength != 0 {
+			if err := readJSONBody(r, &request); err != nil {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   "Invalid JSON in request body",
+				})
+				return
+			}
+		}
+
+		var timeout time.Duration
+		if request.VisibilityTimeout != "" {
+			var err error
+			timeout, err = time.ParseDuration(request.VisibilityTimeout)
+			if err != nil || timeout <= 0 {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   "Invalid visibility_timeout",
+				})
+				return
+			}
+		}
+
+		messages, err := db.Queues.Dequeue(mux.Vars(r)["name"], request.Max, timeout)
+		if err != nil {
+			status := http.StatusBadRequest
+			if strings.Contains(err.Error(), "not found") {
+				status = http.StatusNotFound
+			}
+			sendJSONResponse(w, status, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    messages,
+		})
+	}
+}
+
+// ackHandler acknowledges a delivery: {"id": "...", "receipt": "..."}
+func ackHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID      string `json:"id"`
+			Receipt string `json:"receipt"`
+		}
+		if err := readJSONBody(r, &request); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid JSON in request body",
+			})
+			return
+		}
+
+		if err := db.Queues.Ack(mux.Vars(r)["name"], request.ID, request.Receipt); err != nil {
+			status := http.StatusConflict
+			if strings.Contains(err.Error(), "not found") {
+				status = http.StatusNotFound
+			}
+			sendJSONResponse(w, status, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Message acknowledged",
+		})
+	}
+}
+
+// replicateQueueHandler applies an enqueue or acknowledgement replicated by the peer
+// that took it
+func replicateQueueHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cluster := clusterOrReject(w, db)
+		if cluster == nil || fenceStaleEpoch(w, r, cluster) {
+			return
+		}
+
+		var record database.QueueRecord
+		if err := readJSONBody(r, &record); err != nil || record.ID == "" {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Request body must be a queue record",
+			})
+			return
+		}
+
+		if err := db.Queues.ApplyReplicated(mux.Vars(r)["name"], record); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Queue record applied",
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// readOnlyMiddleware rejects mutations with 503 while the database is read-only.
+// Reads stay available, and so does the toggle, to leave read-only mode again.
+func readOnlyMiddleware(db *database.MultiModelDatabase) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isMutation(r) {
+				if status := db.ReadOnly(); status.Enabled {
+					message := database.ErrReadOnly.Error()
+					if status.Reason != "" {
+						message += ": " + status.Reason
+					}
+					w.Header().Set("Retry-After", "30")
+					sendJSONResponse(w, http.StatusServiceUnavailable, Response{
+						Success: false,
+						Error:   message,
+					})
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// readOnlyExempt lists the routes taking other methods than GET and HEAD that are
+// served in read-only mode: the toggle, and multi-gets and column scans, which are
+// reads sent as POST
+var readOnlyExempt = map[string]bool{
+	"POST /admin/readonly":         true,
+	"POST /kv/_mget":               true,
+	"POST /kv/{bucket}/_mget":      true,
+	"POST /columns/{family}/_scan": true,
+}
+
+// isMutation reports whether a request may change data: any request other than a
+// GET or HEAD, unless its route is exempt
+func isMutation(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return false
+	}
+	return !readOnlyExempt[routeName(r)]
+}
+
+func getReadOnlyHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    db.ReadOnly(),
+		})
+	}
+}
+
+// setReadOnlyHandler toggles read-only mode: {"enabled": true, "reason": "nightly backup"}
+func setReadOnlyHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Enabled *bool  `json:"enabled"`
+			Reason  string `json:"reason"`
+		}
+		if err := readJSONBody(r, &request); err != nil || request.Enabled == nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Request body must be JSON with an enabled flag",
+			})
+			return
+		}
+
+		status := db.SetReadOnly(*request.Enabled, request.Reason)
+		message := "Read-only mode disabled"
+		if status.Enabled {
+			message = "Read-only mode enabled"
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: message,
+			Data:    status,
+		})
+	}
+}
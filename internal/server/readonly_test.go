@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/config"
+	"multimodel-db-engine/internal/database"
+)
+
+func TestReadOnlyModeRejectsMutations(t *testing.T) {
+	db := database.NewMultiModelDatabase(&config.Config{DataDir: t.TempDir(), ReplicationFactor: 1})
+	defer db.Close()
+	router := mux.NewRouter()
+	SetupRoutes(router, db)
+	db.SetReadOnly(true, "test")
+
+	tests := []struct {
+		method   string
+		path     string
+		body     string
+		rejected bool
+	}{
+		{"GET", "/health", "", false},
+		{"GET", "/docs/users", "", false},
+		{"HEAD", "/docs/users", "", false},
+		{"GET", "/admin/readonly", "", false},
+		{"POST", "/kv/_mget", `{"keys": ["a"]}`, false},
+		{"POST", "/kv/cache/_mget", `{"keys": ["a"]}`, false},
+		{"POST", "/columns/metrics/_scan", `{}`, false},
+		{"POST", "/docs/users", `{"name": "ann"}`, true},
+		{"PUT", "/kv/a", `1`, true},
+		{"DELETE", "/docs/users/1", "", true},
+		{"POST", "/admin/jobs", `{}`, true},
+		{"POST", "/admin/migrate", `{}`, true},
+		{"POST", "/cluster/nodes", `{}`, true},
+		{"POST", "/locks/leader/acquire", `{"owner": "a"}`, true},
+		{"POST", "/queues/jobs/enqueue", `{"payload": 1}`, true},
+		{"DELETE", "/kv/_mget", "", true},
+		{"POST", "/admin/readonly", `{"enabled": false}`, false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if rejected := w.Code == http.StatusServiceUnavailable; rejected != tt.rejected {
+			t.Errorf("%s %s answered %d, want rejected %v: %s", tt.method, tt.path, w.Code, tt.rejected, w.Body)
+		}
+	}
+	if db.ReadOnly().Enabled {
+		t.Fatal("read-only mode could not be left")
+	}
+}
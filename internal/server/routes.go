@@ -1,10 +1,17 @@
 package server
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 
@@ -13,34 +20,180 @@ import (
 
 // Response represents a standard API response
 type Response struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message,omitempty"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	Success bool          `json:"success"`
+	Message string        `json:"message,omitempty"`
+	Data    interface{}   `json:"data,omitempty"`
+	Error   string        `json:"error,omitempty"`
+	Meta    *ResponseMeta `json:"meta,omitempty"`
+}
+
+// ResponseMeta describes how a response was served. The elapsed time and node are
+// filled in for every API response; handlers returning lists add their counts and,
+// when there are more results, the cursor of the next page.
+type ResponseMeta struct {
+	ElapsedMs  float64 `json:"elapsed_ms"`
+	Node       string  `json:"node,omitempty"`
+	Count      *int    `json:"count,omitempty"`       // items in data
+	Total      *int    `json:"total,omitempty"`       // items matching the request, when known
+	NextCursor string  `json:"next_cursor,omitempty"` // passed as cursor to fetch the next page
+}
+
+// listMeta returns the metadata of a list of count items, all of the matching ones
+// when complete
+func listMeta(count int, complete bool) *ResponseMeta {
+	meta := &ResponseMeta{Count: &count}
+	if complete {
+		meta.Total = &count
+	}
+	return meta
 }
 
 // SetupRoutes configures all API routes
 func SetupRoutes(router *mux.Router, db *database.MultiModelDatabase) {
+	admission := newAdmissionController(db.Config().MaxInFlight, db.Config().MaxQueued, db.Config().MaxBulkInFlight, db.CollectionPriority)
+	metrics := newRequestMetrics()
+	router.Use(apiMiddleware(db, admission, metrics)...)
+	
 	// Health check endpoint
-	router.HandleFunc("/health", healthHandler).Methods("GET")
+	router.HandleFunc("/health", healthHandler(db)).Methods("GET")
+	router.HandleFunc("/stats", statsHandler(db)).Methods("GET")
+	router.HandleFunc("/search", searchHandler(db)).Methods("GET")
+	router.HandleFunc("/lineage/{model}/{namespace}/{key:.+}", lineageHandler(db)).Methods("GET")
 	
 	// Document store endpoints
+	router.HandleFunc("/docs/{collection}/_export", exportCollectionHandler(db)).Methods("GET")
+	router.HandleFunc("/docs/{collection}/_schema", collectionSchemaHandler(db)).Methods("GET")
+	router.HandleFunc("/docs/{collection}/_indexes", indexesHandler(db)).Methods("GET", "POST")
+	router.HandleFunc("/docs/{collection}/_indexes/{field}", dropIndexHandler(db)).Methods("DELETE")
+	router.HandleFunc("/docs/{collection}/_explain", explainHandler(db)).Methods("GET")
+	router.HandleFunc("/docs/{collection}/_computed", computedFieldsHandler(db)).Methods("GET", "POST")
+	router.HandleFunc("/docs/{collection}/_computed/{name}", dropComputedFieldHandler(db)).Methods("DELETE")
+	router.HandleFunc("/docs/{collection}/_references", referencesHandler(db)).Methods("GET", "POST")
+	router.HandleFunc("/docs/{collection}/_references/{field}", dropReferenceHandler(db)).Methods("DELETE")
+	router.HandleFunc("/docs/{collection}/_archive", archiveHandler(db)).Methods("POST", "DELETE")
+	router.HandleFunc("/docs/{collection}/_insertMany", insertManyHandler(db)).Methods("POST")
+	router.HandleFunc("/docs/{collection}/_sync", syncHandler(db)).Methods("POST")
 	router.HandleFunc("/docs/{collection}/{id}", createDocumentHandler(db)).Methods("POST")
 	router.HandleFunc("/docs/{collection}/{id}", getDocumentHandler(db)).Methods("GET")
 	router.HandleFunc("/docs/{collection}/{id}", updateDocumentHandler(db)).Methods("PUT")
 	router.HandleFunc("/docs/{collection}/{id}", deleteDocumentHandler(db)).Methods("DELETE")
+	router.HandleFunc("/docs/{collection}/{id}/_move", moveDocumentHandler(db)).Methods("POST")
+	router.HandleFunc("/docs/{collection}/{id}/_findAndModify", findAndModifyHandler(db)).Methods("POST")
 	router.HandleFunc("/docs/{collection}", queryDocumentsHandler(db)).Methods("GET")
+	router.HandleFunc("/collections", listCollectionsHandler(db)).Methods("GET")
+	router.HandleFunc("/collections/{name}/_rename", transferCollectionHandler(db, true)).Methods("POST")
+	router.HandleFunc("/collections/{name}/_copy", transferCollectionHandler(db, false)).Methods("POST")
+	router.HandleFunc("/collections/{name}/_cloneTo", cloneCollectionHandler(db)).Methods("POST")
+	router.HandleFunc("/collections/{name}/_compact", compactCollectionHandler(db)).Methods("POST")
+	router.HandleFunc("/collections/{name}", dropCollectionHandler(db)).Methods("DELETE")
+	router.HandleFunc("/collections/{name}/_consistency", collectionConsistencyHandler(db)).Methods("GET", "PUT")
+	router.HandleFunc("/collections/{name}/_priority", collectionPriorityHandler(db)).Methods("GET", "PUT")
+	
+	// Saved queries
+	router.HandleFunc("/queries", savedQueriesHandler(db)).Methods("GET", "POST")
+	router.HandleFunc("/queries/{name}", savedQueryHandler(db)).Methods("GET", "DELETE")
+	router.HandleFunc("/queries/{name}/run", runSavedQueryHandler(db)).Methods("GET")
 	
-	// Key-value store endpoints
+	// Key-value store endpoints; /kv/{key} addresses the default bucket
+	router.HandleFunc("/buckets", listBucketsHandler(db)).Methods("GET")
+	router.HandleFunc("/kv/_mget", multiGetHandler(db)).Methods("POST")
+	router.HandleFunc("/kv/_mset", multiSetHandler(db)).Methods("POST")
+	router.HandleFunc("/kv/_bulk", bulkLoadHandler(db)).Methods("POST")
+	router.HandleFunc("/kv/{bucket}/_mget", multiGetHandler(db)).Methods("POST")
+	router.HandleFunc("/kv/{bucket}/_mset", multiSetHandler(db)).Methods("POST")
+	router.HandleFunc("/kv/{bucket}/_keys", listBucketKeysHandler(db)).Methods("GET")
+	router.HandleFunc("/kv/{bucket}/_stats", bucketStatsHandler(db)).Methods("GET")
+	router.HandleFunc("/kv/{bucket}/_config", setBucketOptionsHandler(db)).Methods("PUT")
+	router.HandleFunc("/kv/{bucket}/{key}/_watch", watchKeyHandler(db)).Methods("GET")
+	router.HandleFunc("/kv/{bucket}/{key}", setKeyValueHandler(db)).Methods("POST", "PUT")
+	router.HandleFunc("/kv/{bucket}/{key}", getKeyValueHandler(db)).Methods("GET")
+	router.HandleFunc("/kv/{bucket}/{key}", deleteKeyHandler(db)).Methods("DELETE")
 	router.HandleFunc("/kv/{key}", setKeyValueHandler(db)).Methods("POST", "PUT")
 	router.HandleFunc("/kv/{key}", getKeyValueHandler(db)).Methods("GET")
 	router.HandleFunc("/kv/{key}", deleteKeyHandler(db)).Methods("DELETE")
 	
+	// Session endpoints, backed by the KV store
+	router.HandleFunc("/sessions", createSessionHandler(db)).Methods("POST")
+	router.HandleFunc("/sessions/{id}", getSessionHandler(db)).Methods("GET")
+	router.HandleFunc("/sessions/{id}/touch", touchSessionHandler(db)).Methods("POST")
+	router.HandleFunc("/sessions/{id}", destroySessionHandler(db)).Methods("DELETE")
+
+	// Blob store endpoints
+	router.HandleFunc("/blobs/{bucket}", listBlobsHandler(db)).Methods("GET")
+	router.HandleFunc("/blobs/{bucket}/{name}", putBlobHandler(db)).Methods("PUT")
+	router.HandleFunc("/blobs/{bucket}/{name}", getBlobHandler(db)).Methods("GET", "HEAD")
+	router.HandleFunc("/blobs/{bucket}/{name}", deleteBlobHandler(db)).Methods("DELETE")
+	router.HandleFunc("/blobs/{bucket}/{name}/_meta", getBlobMetadataHandler(db)).Methods("GET")
+	router.HandleFunc("/blobs/{bucket}/{name}/_uploads", createBlobUploadHandler(db)).Methods("POST")
+	router.HandleFunc("/blobs/{bucket}/{name}/_uploads/{upload}", getBlobUploadHandler(db)).Methods("GET")
+	router.HandleFunc("/blobs/{bucket}/{name}/_uploads/{upload}", abortBlobUploadHandler(db)).Methods("DELETE")
+	router.HandleFunc("/blobs/{bucket}/{name}/_uploads/{upload}/_complete", completeBlobUploadHandler(db)).Methods("POST")
+	router.HandleFunc("/blobs/{bucket}/{name}/_uploads/{upload}/{part}", putBlobUploadPartHandler(db)).Methods("PUT")
+
+	// Lease endpoints
+	router.HandleFunc("/leases", createLeaseHandler(db)).Methods("POST")
+	router.HandleFunc("/leases/{id}", getLeaseHandler(db)).Methods("GET")
+	router.HandleFunc("/leases/{id}/keepalive", keepAliveLeaseHandler(db)).Methods("POST")
+	router.HandleFunc("/leases/{id}", revokeLeaseHandler(db)).Methods("DELETE")
+	router.HandleFunc("/locks/{name}/acquire", acquireLockHandler(db)).Methods("POST")
+	router.HandleFunc("/locks/{name}/release", releaseLockHandler(db)).Methods("POST")
+
+	// Work queue endpoints
+	router.HandleFunc("/queues", listQueuesHandler(db)).Methods("GET")
+	router.HandleFunc("/queues/{name}", queueStatsHandler(db)).Methods("GET")
+	router.HandleFunc("/queues/{name}/enqueue", enqueueHandler(db)).Methods("POST")
+	router.HandleFunc("/queues/{name}/dequeue", dequeueHandler(db)).Methods("POST")
+	router.HandleFunc("/queues/{name}/ack", ackHandler(db)).Methods("POST")
+
+	// Scheduled job administration
+	router.HandleFunc("/admin/jobs", listJobsHandler(db)).Methods("GET")
+	router.HandleFunc("/admin/jobs", putJobHandler(db)).Methods("POST")
+	router.HandleFunc("/admin/jobs/{id}", getJobHandler(db)).Methods("GET")
+	router.HandleFunc("/admin/jobs/{id}", putJobHandler(db)).Methods("PUT")
+	router.HandleFunc("/admin/jobs/{id}", deleteJobHandler(db)).Methods("DELETE")
+	router.HandleFunc("/admin/jobs/{id}/run", runJobHandler(db)).Methods("POST")
+
+	router.HandleFunc("/admin/dedup", dedupStatsHandler(db)).Methods("GET")
+	router.HandleFunc("/admin/compression", documentCompressionHandler(db)).Methods("GET")
+	router.HandleFunc("/admin/rawcache", rawCacheHandler(db)).Methods("GET")
+	router.HandleFunc("/admin/archives", archivesHandler(db)).Methods("GET")
+	router.HandleFunc("/admin/trash", trashHandler(db)).Methods("GET")
+	router.HandleFunc("/admin/trash/{id}/restore", restoreTrashHandler(db)).Methods("POST")
+	router.HandleFunc("/admin/trash/{id}", purgeTrashHandler(db)).Methods("DELETE")
+	router.HandleFunc("/admin/routines", routinesHandler(db)).Methods("GET")
+	router.HandleFunc("/admin/memory", memoryHandler(db)).Methods("GET")
+	router.HandleFunc("/admin/readonly", getReadOnlyHandler(db)).Methods("GET")
+	router.HandleFunc("/admin/readonly", setReadOnlyHandler(db)).Methods("POST")
+	router.HandleFunc("/admin/admission", admissionStatsHandler(admission)).Methods("GET")
+	router.HandleFunc("/admin/metrics", metricsHandler(metrics)).Methods("GET")
+	router.HandleFunc("/admin/faults", listFaultsHandler(db)).Methods("GET")
+	router.HandleFunc("/admin/faults", setFaultHandler(db)).Methods("POST")
+	router.HandleFunc("/admin/faults/{point}", clearFaultHandler(db)).Methods("DELETE")
+	router.HandleFunc("/admin/snapshot", snapshotHandler(db)).Methods("GET")
+	router.HandleFunc("/admin/restore", restoreHandler(db)).Methods("POST")
+	router.HandleFunc("/admin/backups", listBackupsHandler(db)).Methods("GET")
+	router.HandleFunc("/admin/backups", createBackupHandler(db)).Methods("POST")
+	router.HandleFunc("/admin/backups/{id}/plan", backupPlanHandler(db)).Methods("GET")
+	router.HandleFunc("/admin/backups/{id}/restore", restoreBackupHandler(db)).Methods("POST")
+	router.HandleFunc("/admin/tiering", tieringStatsHandler(db)).Methods("GET")
+	router.HandleFunc("/admin/tiering/sweep", sweepTieringHandler(db)).Methods("POST")
+
+	// Data migrations and fixtures
+	router.HandleFunc("/admin/migrate", migrateHandler(db)).Methods("POST")
+	router.HandleFunc("/admin/migrations", listMigrationsHandler(db)).Methods("GET")
+	router.HandleFunc("/admin/seed", seedHandler(db)).Methods("POST")
+	
 	// Column store endpoints
 	router.HandleFunc("/columns/{family}/{row}/{column}", insertColumnHandler(db)).Methods("POST", "PUT")
 	router.HandleFunc("/columns/{family}/{row}/{column}", getColumnHandler(db)).Methods("GET")
+	router.HandleFunc("/columns/{family}", scanColumnsHandler(db)).Methods("GET")
+	router.HandleFunc("/columns/{family}", dropColumnFamilyHandler(db)).Methods("DELETE")
+	router.HandleFunc("/columns/{family}/_scan", scanColumnsHandler(db)).Methods("POST")
+	router.HandleFunc("/columns/{family}/_config", setColumnFamilyOptionsHandler(db)).Methods("PUT")
+	router.HandleFunc("/columns/{family}/_config", getColumnFamilyOptionsHandler(db)).Methods("GET")
 	
 	// Graph store endpoints
+	router.HandleFunc("/graph/_watch", graphWatchHandler(db)).Methods("GET")
 	router.HandleFunc("/graph/nodes", createNodeHandler(db)).Methods("POST")
 	router.HandleFunc("/graph/nodes/{id}", getNodeHandler(db)).Methods("GET")
 	router.HandleFunc("/graph/edges", createEdgeHandler(db)).Methods("POST")
@@ -48,36 +201,153 @@ func SetupRoutes(router *mux.Router, db *database.MultiModelDatabase) {
 	
 	// Cluster endpoints
 	router.HandleFunc("/cluster/status", clusterStatusHandler(db)).Methods("GET")
+	router.HandleFunc("/cluster/events", clusterEventsHandler(db)).Methods("GET")
 	router.HandleFunc("/cluster/nodes", addNodeHandler(db)).Methods("POST")
+	router.HandleFunc("/cluster/placement", placementHandler(db)).Methods("GET")
+	router.HandleFunc("/cluster/partitions", partitionsHandler(db)).Methods("GET")
+	router.HandleFunc("/cluster/partitions/{id}/split", splitPartitionHandler(db)).Methods("POST")
+	router.HandleFunc("/cluster/transfer", startTransferHandler(db)).Methods("POST")
 	
 	// Catch-all for undefined routes
 	router.PathPrefix("/").HandlerFunc(notFoundHandler)
 }
 
+// SetupClusterRoutes configures the node to node routes served on the cluster port,
+// apart from client traffic
+func SetupClusterRoutes(router *mux.Router, db *database.MultiModelDatabase) {
+	router.Use(accessLogMiddleware(db.Config().AccessLog))
+	router.Use(recoveryMiddleware())
+	router.Use(clusterAuthMiddleware(db))
+	router.Use(clockMiddleware(db))
+	
+	// Heartbeats
+	router.HandleFunc("/health", healthHandler(db)).Methods("GET")
+	
+	// Membership
+	router.HandleFunc("/cluster/join", joinClusterHandler(db)).Methods("POST")
+	router.HandleFunc("/cluster/gossip", gossipHandler(db)).Methods("POST")
+	
+	// Replication and replica reads
+	router.HandleFunc("/data/replicate", replicateHandler(db)).Methods("POST")
+	router.HandleFunc("/data/bulk", bulkChunkHandler(db)).Methods("POST")
+	router.HandleFunc("/data/kv/{key}", getKeyValueHandler(db)).Methods("GET")
+	router.HandleFunc("/data/transfer", transferChunkHandler(db)).Methods("POST")
+	router.HandleFunc("/data/crdt", mergeCRDTHandler(db)).Methods("POST")
+	router.HandleFunc("/data/queues/{name}", replicateQueueHandler(db)).Methods("POST")
+	router.HandleFunc("/data/load", partitionLoadHandler(db)).Methods("POST")
+	router.HandleFunc("/data/partitions", partitionMapHandler(db)).Methods("POST")
+	router.HandleFunc("/data/partitions/split", splitPartitionHandler(db)).Methods("POST")
+	
+	// Lock grants
+	router.HandleFunc("/data/locks/{name}/grant", grantLockHandler(db)).Methods("POST")
+	router.HandleFunc("/data/locks/{name}/revoke", revokeLockHandler(db)).Methods("POST")
+	router.HandleFunc("/data/locks/{name}/observe", observeLockHandler(db)).Methods("POST")
+	
+	router.PathPrefix("/").HandlerFunc(notFoundHandler)
+}
+
 // Helper function to send JSON responses
 func sendJSONResponse(w http.ResponseWriter, statusCode int, response Response) {
+	buf := getResponseBuffer()
+	defer putResponseBuffer(buf)
+	
+	if recorder, ok := w.(*statusRecorder); ok {
+		response.Meta = recorder.meta(response.Meta)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(response)
+	if err := buf.encoder.Encode(response); err == nil {
+		w.Write(buf.Bytes())
+	}
+}
+
+// sendRawDataResponse writes a successful response around data that is already
+// encoded, byte for byte as sendJSONResponse would write it
+func sendRawDataResponse(w http.ResponseWriter, data json.RawMessage) {
+	buf := getResponseBuffer()
+	defer putResponseBuffer(buf)
+	
+	buf.WriteString(`{"success":true,"data":`)
+	buf.Write(data)
+	if recorder, ok := w.(*statusRecorder); ok {
+		if meta := recorder.meta(nil); meta != nil {
+			buf.WriteString(`,"meta":`)
+			buf.encoder.Encode(meta)
+			buf.Truncate(buf.Len() - 1) // the encoder's newline
+		}
+	}
+	buf.WriteString("}\n")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// errorStatus maps engine errors with a specific meaning to their HTTP status and
+// falls back to the given status otherwise
+func errorStatus(err error, fallback int) int {
+	if errors.Is(err, database.ErrPluginRejected) {
+		return http.StatusUnprocessableEntity
+	}
+	if errors.Is(err, database.ErrReadOnly) {
+		return http.StatusServiceUnavailable
+	}
+	if errors.Is(err, database.ErrQueryLimit) {
+		return http.StatusUnprocessableEntity
+	}
+	if errors.Is(err, database.ErrInvalidPath) || errors.Is(err, database.ErrInvalidUpdate) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, database.ErrArchived) || errors.Is(err, database.ErrDocumentExists) {
+		return http.StatusConflict
+	}
+	if errors.Is(err, database.ErrSystemCollection) || errors.Is(err, database.ErrReadOnlyView) {
+		return http.StatusForbidden
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return http.StatusGatewayTimeout
+	}
+	return fallback
 }
 
+// maxJSONBody bounds JSON request bodies, on the API and on node to node routes
+const maxJSONBody = 32 << 20
+
 // Helper function to read JSON body
 func readJSONBody(r *http.Request, dst interface{}) error {
-	body, err := io.ReadAll(r.Body)
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxJSONBody))
 	if err != nil {
 		return err
 	}
 	defer r.Body.Close()
 	
-	return json.Unmarshal(body, dst)
+	// Keeps the exact numbers of documents, which json.Unmarshal rounds to float64
+	return database.DecodeJSON(body, dst)
 }
 
-// Health check handler
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	sendJSONResponse(w, http.StatusOK, Response{
-		Success: true,
-		Message: "Multi-Model Database Engine is running",
-	})
+// Health check handler. Ephemeral instances say so, so tooling can refuse to restore
+// data it cares about into them.
+func healthHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Multi-Model Database Engine is running",
+			Data: map[string]interface{}{
+				"api_version":        requestAPIVersion(r),
+				"supported_versions": supportedAPIVersions,
+				"ephemeral":          db.Ephemeral(),
+			},
+		})
+	}
+}
+
+// statsHandler reports the size of each store and the mode of the engine
+func statsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    db.Stats(),
+		})
+	}
 }
 
 // Document Store Handlers
@@ -97,7 +367,7 @@ func createDocumentHandler(db *database.MultiModelDatabase) http.HandlerFunc {
 		}
 		
 		if err := db.InsertDocument(collection, id, doc); err != nil {
-			sendJSONResponse(w, http.StatusInternalServerError, Response{
+			sendJSONResponse(w, errorStatus(err, http.StatusInternalServerError), Response{
 				Success: false,
 				Error:   err.Error(),
 			})
@@ -112,12 +382,90 @@ func createDocumentHandler(db *database.MultiModelDatabase) http.HandlerFunc {
 	}
 }
 
+// insertManyHandler inserts several documents, taking their ids from _id or
+// generating them: {"documents": [{"_id": "a", ...}, {...}], "atomic": true}.
+// Atomic inserts store every document or none, answering 409 with every taken id
+// as a conflict; otherwise failures are listed per document.
+func insertManyHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Documents []database.Document `json:"documents"`
+			Atomic    bool                `json:"atomic"`
+		}
+		if err := readJSONBody(r, &request); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid JSON in request body",
+			})
+			return
+		}
+		if atomic := r.URL.Query().Get("atomic"); atomic != "" {
+			request.Atomic = atomic == "true" || atomic == "1"
+		}
+		
+		result, err := db.InsertMany(mux.Vars(r)["collection"], request.Documents, request.Atomic)
+		var conflict *database.ConflictError
+		if errors.As(err, &conflict) {
+			sendConflicts(w, "No documents created", conflict.Conflicts)
+			return
+		}
+		if err != nil {
+			sendJSONResponse(w, errorStatus(err, http.StatusBadRequest), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		
+		status, message := http.StatusCreated, "Documents created successfully"
+		if len(result.Errors) > 0 {
+			status, message = http.StatusOK, fmt.Sprintf("%d of %d documents created", result.Inserted, len(request.Documents))
+		}
+		sendJSONResponse(w, status, Response{
+			Success: len(result.Errors) == 0,
+			Message: message,
+			Data:    result,
+		})
+	}
+}
+
 func getDocumentHandler(db *database.MultiModelDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		collection := vars["collection"]
 		id := vars["id"]
 		
+		// With ?wait=true the document is read once it changes, or at once if it may
+		// have changed since the version of the If-None-Match ETag
+		proceed := waitForChange(w, r, func(ctx context.Context) (bool, error) {
+			if match := r.Header.Get("If-None-Match"); match != "" && !database.IsSystemCollection(collection) {
+				stamp := db.CollectionStamp(collection)
+				if !etagMatches(match, collectionETag(collection, stamp, db.StartedAt())) {
+					return true, nil
+				}
+				return db.WatchDocumentSince(ctx, collection, id, stamp.Version)
+			}
+			return db.WatchDocument(ctx, collection, id)
+		})
+		if !proceed || writeCacheHeaders(w, r, db, collection) {
+			return
+		}
+		
+		fields := projection(r)
+		if len(fields) == 0 {
+			// Whole documents are written as encoded, usually from the cache
+			encoded, err := db.GetDocumentJSON(collection, id)
+			if err != nil {
+				sendJSONResponse(w, http.StatusNotFound, Response{
+					Success: false,
+					Error:   err.Error(),
+				})
+				return
+			}
+			sendRawDataResponse(w, encoded)
+			return
+		}
+		
 		doc, err := db.GetDocument(collection, id)
 		if err != nil {
 			sendJSONResponse(w, http.StatusNotFound, Response{
@@ -129,7 +477,7 @@ func getDocumentHandler(db *database.MultiModelDatabase) http.HandlerFunc {
 		
 		sendJSONResponse(w, http.StatusOK, Response{
 			Success: true,
-			Data:    doc,
+			Data:    database.ProjectDocument(doc, fields),
 		})
 	}
 }
@@ -149,17 +497,37 @@ func updateDocumentHandler(db *database.MultiModelDatabase) http.HandlerFunc {
 			return
 		}
 		
-		if err := db.UpdateDocument(collection, id, updates); err != nil {
-			sendJSONResponse(w, http.StatusInternalServerError, Response{
+		condition, err := writeCondition(r)
+		if err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
 				Success: false,
 				Error:   err.Error(),
 			})
 			return
 		}
 		
+		matched := true
+		if condition != nil {
+			matched, err = db.UpdateDocumentIf(collection, id, condition, updates)
+		} else {
+			err = db.UpdateDocument(collection, id, updates)
+		}
+		if err != nil {
+			sendJSONResponse(w, errorStatus(err, http.StatusInternalServerError), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		if !matched {
+			sendConditionNotMet(w)
+			return
+		}
+		
 		sendJSONResponse(w, http.StatusOK, Response{
 			Success: true,
 			Message: "Document updated successfully",
+			Data:    conditionMatched(condition),
 		})
 	}
 }
@@ -170,77 +538,275 @@ func deleteDocumentHandler(db *database.MultiModelDatabase) http.HandlerFunc {
 		collection := vars["collection"]
 		id := vars["id"]
 		
-		if err := db.DeleteDocument(collection, id); err != nil {
-			sendJSONResponse(w, http.StatusInternalServerError, Response{
+		condition, err := writeCondition(r)
+		if err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
 				Success: false,
 				Error:   err.Error(),
 			})
 			return
 		}
 		
+		matched := true
+		if condition != nil {
+			matched, err = db.DeleteDocumentIf(collection, id, condition)
+		} else {
+			err = db.DeleteDocument(collection, id)
+		}
+		if err != nil {
+			sendJSONResponse(w, errorStatus(err, http.StatusInternalServerError), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		if !matched {
+			sendConditionNotMet(w)
+			return
+		}
+		
 		sendJSONResponse(w, http.StatusOK, Response{
 			Success: true,
 			Message: "Document deleted successfully",
+			Data:    conditionMatched(condition),
 		})
 	}
 }
 
-func queryDocumentsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+// writeCondition returns the condition of a conditional update or delete, given as
+// query parameters in the filter syntax of document queries, e.g.
+// PUT /docs/orders/o1?status=pending. It is nil for unconditional writes.
+func writeCondition(r *http.Request) (map[string]interface{}, error) {
+	condition, err := database.ParseQueryFilters(r.URL.Query())
+	if err != nil || len(condition) == 0 {
+		return nil, err
+	}
+	return condition, nil
+}
+
+// conditionMatched is the data of a successful write, reporting the match of its condition
+func conditionMatched(condition map[string]interface{}) interface{} {
+	if condition == nil {
+		return nil
+	}
+	return map[string]bool{"matched": true}
+}
+
+// sendConditionNotMet answers a conditional write whose document did not match
+// sendConflicts answers a batch with conflicting operations, listing them so the
+// client can retry just those
+func sendConflicts(w http.ResponseWriter, message string, conflicts []database.Conflict) {
+	sendJSONResponse(w, http.StatusConflict, Response{
+		Success: false,
+		Message: message,
+		Error:   fmt.Sprintf("%d operations conflict", len(conflicts)),
+		Data:    map[string]interface{}{"conflicts": conflicts},
+	})
+}
+
+func sendConditionNotMet(w http.ResponseWriter) {
+	sendJSONResponse(w, http.StatusPreconditionFailed, Response{
+		Success: false,
+		Error:   "condition not met, document unchanged",
+		Data:    map[string]bool{"matched": false},
+	})
+}
+
+// findAndModifyHandler updates a document and returns it as it was before the update,
+// or after it with "new": true, atomically:
+// {"update": {"stock": 4}, "if": {"stock": 5}, "new": false}
+func findAndModifyHandler(db *database.MultiModelDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
-		collection := vars["collection"]
+		var request struct {
+			Update    database.Document      `json:"update"`
+			Condition map[string]interface{} `json:"if"`
+			New       bool                   `json:"new"`
+		}
+		if err := readJSONBody(r, &request); err != nil || request.Update == nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   `expected a JSON body with an "update" object`,
+			})
+			return
+		}
 		
-		// Parse query parameters as filters
-		filters := make(map[string]interface{})
-		for key, values := range r.URL.Query() {
-			if len(values) > 0 {
-				// For simplicity, take the first value
-				filters[key] = values[0]
-			}
+		doc, matched, err := db.FindAndModify(vars["collection"], vars["id"], request.Condition, request.Update, request.New)
+		if err != nil {
+			sendJSONResponse(w, errorStatus(err, http.StatusInternalServerError), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
 		}
+		if !matched {
+			sendConditionNotMet(w)
+			return
+		}
+		
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Document updated successfully",
+			Data:    doc,
+		})
+	}
+}
+
+func queryDocumentsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		collection := vars["collection"]
 		
-		docs, err := db.QueryDocuments(collection, filters)
+		// Parse query parameters as filters, typed by hints such as age:int=30, and
+		// options such as _sort
+		query := r.URL.Query()
+		q, err := database.ParseDocumentQuery(query)
 		if err != nil {
-			sendJSONResponse(w, http.StatusInternalServerError, Response{
+			sendJSONResponse(w, http.StatusBadRequest, Response{
 				Success: false,
 				Error:   err.Error(),
 			})
 			return
 		}
 		
+		// Results relative to now() change without the collection changing
+		if !usesNow(query) && writeCacheHeaders(w, r, db, collection) {
+			return
+		}
+		
+		docs, err := db.FindDocuments(r.Context(), collection, q)
+		sendQueryResults(w, docs, err, http.StatusInternalServerError)
+	}
+}
+
+// sendQueryResults responds with the documents of a query, flagging results cut
+// short by a query limit with an X-Partial-Results header and a message
+func sendQueryResults(w http.ResponseWriter, docs []database.Document, err error, fallback int) {
+	if errors.Is(err, database.ErrQueryLimit) && docs != nil {
+		w.Header().Set("X-Partial-Results", "true")
 		sendJSONResponse(w, http.StatusOK, Response{
 			Success: true,
+			Message: "Partial results, " + err.Error(),
 			Data:    docs,
+			Meta:    listMeta(len(docs), false),
+		})
+		return
+	}
+	if err != nil {
+		sendJSONResponse(w, errorStatus(err, fallback), Response{
+			Success: false,
+			Error:   err.Error(),
 		})
+		return
+	}
+	
+	sendJSONResponse(w, http.StatusOK, Response{
+		Success: true,
+		Data:    docs,
+		Meta:    listMeta(len(docs), true),
+	})
+}
+
+// projection returns the fields selected by the _fields parameter
+func projection(r *http.Request) []string {
+	value := r.URL.Query().Get(database.ProjectionParam)
+	if value == "" {
+		return nil
 	}
+	return strings.Split(value, ",")
+}
+
+// usesNow reports whether a query filters relative to the current time
+func usesNow(query url.Values) bool {
+	for _, values := range query {
+		for _, value := range values {
+			if strings.Contains(value, "now()") {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // Key-Value Store Handlers
 func setKeyValueHandler(db *database.MultiModelDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
+		bucket := bucketFromVars(vars)
 		key := vars["key"]
 		
+		if !authorizeBucket(w, r, db, bucket, true) {
+			return
+		}
+		
+		ttl, err := parseTTL(r.URL.Query().Get("ttl"))
+		if err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		
+		// Non-JSON bodies are stored verbatim as binary values
 		var value interface{}
-		if err := readJSONBody(r, &value); err != nil {
+		contentType := binaryContentType(r)
+		if contentType != "" {
+			raw, err := io.ReadAll(r.Body)
+			if err != nil {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   "Failed to read request body",
+				})
+				return
+			}
+			value = raw
+		} else if err := readJSONBody(r, &value); err != nil {
 			sendJSONResponse(w, http.StatusBadRequest, Response{
 				Success: false,
 				Error:   "Invalid JSON in request body",
 			})
 			return
 		}
-		
-		if err := db.SetKeyValue(key, value); err != nil {
-			sendJSONResponse(w, http.StatusInternalServerError, Response{
+
+		query := r.URL.Query()
+		revision, err := db.PutBucketValue(bucket, key, value, database.PutOptions{
+			TTL:         ttl,
+			LeaseID:     query.Get("lease"),
+			IfAbsent:    query.Get("if_absent") == "true",
+			ContentType: contentType,
+		})
+		if err != nil {
+			status := errorStatus(err, http.StatusBadRequest)
+			if errors.Is(err, database.ErrKeyExists) {
+				status = http.StatusConflict
+			}
+			sendJSONResponse(w, status, Response{
 				Success: false,
 				Error:   err.Error(),
 			})
 			return
 		}
 		
+		data := map[string]interface{}{"revision": revision}
+		
+		// Replicas of the default bucket receive JSON values; the response lists which
+		// of them acknowledged the write
+		if db.Cluster != nil && bucket == database.DefaultBucket && contentType == "" {
+			replication, err := db.Cluster.ReplicateData(key, value)
+			if err != nil {
+				log.Printf("Replication of key %s skipped: %v", key, err)
+				data["replication_error"] = err.Error()
+			} else if replication != nil {
+				data["replication"] = replication
+			}
+		}
+		
+		w.Header().Set(revisionHeader, strconv.FormatInt(revision, 10))
 		sendJSONResponse(w, http.StatusOK, Response{
 			Success: true,
 			Message: "Key-value pair set successfully",
+			Data:    data,
 		})
 	}
 }
@@ -248,9 +814,33 @@ func setKeyValueHandler(db *database.MultiModelDatabase) http.HandlerFunc {
 func getKeyValueHandler(db *database.MultiModelDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
+		bucket := bucketFromVars(vars)
 		key := vars["key"]
 		
-		value, err := db.GetKeyValue(key)
+		if !authorizeBucket(w, r, db, bucket, false) {
+			return
+		}
+		
+		// With ?wait=true the key is read once it changes past ?revision, or at once
+		// if it already has
+		proceed := waitForChange(w, r, func(ctx context.Context) (bool, error) {
+			afterRevision, err := parseRevision(r.URL.Query().Get("revision"))
+			if err != nil {
+				return false, err
+			}
+			event, _ := db.WatchBucketKey(ctx, bucket, key, afterRevision)
+			return event != nil, nil
+		})
+		if !proceed {
+			return
+		}
+		
+		// Replication covers the default bucket only
+		if bucket == database.DefaultBucket && serveFromReplica(w, r, db, key) {
+			return
+		}
+		
+		item, err := db.GetBucketItem(bucket, key)
 		if err != nil {
 			sendJSONResponse(w, http.StatusNotFound, Response{
 				Success: false,
@@ -259,9 +849,16 @@ func getKeyValueHandler(db *database.MultiModelDatabase) http.HandlerFunc {
 			return
 		}
 		
+		w.Header().Set(revisionHeader, strconv.FormatInt(item.Revision, 10))
+		if raw, ok := item.Value.([]byte); ok && item.ContentType != "" {
+			w.Header().Set("Content-Type", item.ContentType)
+			w.WriteHeader(http.StatusOK)
+			w.Write(raw)
+			return
+		}
 		sendJSONResponse(w, http.StatusOK, Response{
 			Success: true,
-			Data:    value,
+			Data:    item.Value,
 		})
 	}
 }
@@ -269,10 +866,15 @@ func getKeyValueHandler(db *database.MultiModelDatabase) http.HandlerFunc {
 func deleteKeyHandler(db *database.MultiModelDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
+		bucket := bucketFromVars(vars)
 		key := vars["key"]
 		
-		if err := db.DeleteKey(key); err != nil {
-			sendJSONResponse(w, http.StatusNotFound, Response{
+		if !authorizeBucket(w, r, db, bucket, true) {
+			return
+		}
+		
+		if err := db.DeleteBucketKey(bucket, key); err != nil {
+			sendJSONResponse(w, errorStatus(err, http.StatusNotFound), Response{
 				Success: false,
 				Error:   err.Error(),
 			})
@@ -304,7 +906,7 @@ func insertColumnHandler(db *database.MultiModelDatabase) http.HandlerFunc {
 		}
 		
 		if err := db.InsertColumn(family, row, column, value); err != nil {
-			sendJSONResponse(w, http.StatusInternalServerError, Response{
+			sendJSONResponse(w, errorStatus(err, http.StatusInternalServerError), Response{
 				Success: false,
 				Error:   err.Error(),
 			})
@@ -341,6 +943,192 @@ func getColumnHandler(db *database.MultiModelDatabase) http.HandlerFunc {
 	}
 }
 
+func setColumnFamilyOptionsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		family := vars["family"]
+
+		var options database.ColumnFamilyOptions
+		if err := readJSONBody(r, &options); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid JSON in request body",
+			})
+			return
+		}
+
+		if err := db.SetColumnFamilyOptions(family, options); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Column family options updated successfully",
+		})
+	}
+}
+
+func getColumnFamilyOptionsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		family := vars["family"]
+
+		options, err := db.GetColumnFamilyOptions(family)
+		if err != nil {
+			sendJSONResponse(w, http.StatusNotFound, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    options,
+		})
+	}
+}
+
+// scanColumnsHandler runs a range scan over a column family. GET takes the scan as query
+// parameters (start, end, prefix, columns=a,b, where=status==active, limit); POST /_scan takes a
+// JSON ColumnScan body so predicate values keep their JSON types. A limited scan answers
+// with a next_cursor, passed back as the cursor parameter to continue it.
+func scanColumnsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		family := vars["family"]
+
+		var scan database.ColumnScan
+		if r.Method == http.MethodPost {
+			if err := readJSONBody(r, &scan); err != nil {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   "Invalid JSON in request body",
+				})
+				return
+			}
+		} else {
+			var err error
+			scan, err = parseColumnScanQuery(r.URL.Query())
+			if err != nil {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   err.Error(),
+				})
+				return
+			}
+		}
+		if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+			after, err := decodeCursor(cursor)
+			if err != nil {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   err.Error(),
+				})
+				return
+			}
+			scan.After = after
+		}
+
+		rows, err := db.ScanColumnsContext(r.Context(), family, scan)
+		if err != nil {
+			sendJSONResponse(w, errorStatus(err, http.StatusNotFound), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		meta := listMeta(len(rows), scan.Limit <= 0 || len(rows) < scan.Limit)
+		if meta.Total == nil && len(rows) > 0 {
+			meta.NextCursor = encodeCursor(rows[len(rows)-1].Key)
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    rows,
+			Meta:    meta,
+		})
+	}
+}
+
+// encodeCursor returns the opaque cursor continuing a scan after key
+func encodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", fmt.Errorf("invalid cursor %q", cursor)
+	}
+	return string(key), nil
+}
+
+// predicateOperators maps the textual operators accepted in where= parameters, longest first
+var predicateOperators = []struct {
+	token string
+	op    string
+}{
+	{"==", "eq"},
+	{"!=", "ne"},
+	{">=", "gte"},
+	{"<=", "lte"},
+	{">", "gt"},
+	{"<", "lt"},
+}
+
+func parseColumnScanQuery(query url.Values) (database.ColumnScan, error) {
+	scan := database.ColumnScan{
+		StartRow: query.Get("start"),
+		EndRow:   query.Get("end"),
+		Prefix:   query.Get("prefix"),
+	}
+
+	if columns := query.Get("columns"); columns != "" {
+		scan.Columns = strings.Split(columns, ",")
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return scan, fmt.Errorf("invalid limit %q", limit)
+		}
+		scan.Limit = n
+	}
+
+	for _, clause := range query["where"] {
+		predicate, err := parsePredicate(clause)
+		if err != nil {
+			return scan, err
+		}
+		scan.Predicates = append(scan.Predicates, predicate)
+	}
+
+	return scan, nil
+}
+
+// parsePredicate turns "status==active" into a predicate; a bare column name means "exists"
+func parsePredicate(clause string) (database.ColumnPredicate, error) {
+	for _, candidate := range predicateOperators {
+		if idx := strings.Index(clause, candidate.token); idx > 0 {
+			return database.ColumnPredicate{
+				Column: clause[:idx],
+				Op:     candidate.op,
+				Value:  clause[idx+len(candidate.token):],
+			}, nil
+		}
+	}
+
+	if clause == "" {
+		return database.ColumnPredicate{}, fmt.Errorf("empty where clause")
+	}
+	return database.ColumnPredicate{Column: clause, Op: "exists", Value: true}, nil
+}
+
 // Graph Store Handlers
 func createNodeHandler(db *database.MultiModelDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -359,7 +1147,7 @@ func createNodeHandler(db *database.MultiModelDatabase) http.HandlerFunc {
 		}
 		
 		if err := db.CreateNode(nodeData.ID, nodeData.Labels, nodeData.Props); err != nil {
-			sendJSONResponse(w, http.StatusInternalServerError, Response{
+			sendJSONResponse(w, errorStatus(err, http.StatusInternalServerError), Response{
 				Success: false,
 				Error:   err.Error(),
 			})
@@ -413,7 +1201,7 @@ func createEdgeHandler(db *database.MultiModelDatabase) http.HandlerFunc {
 		}
 		
 		if err := db.CreateEdge(edgeData.ID, edgeData.From, edgeData.To, edgeData.Type, edgeData.Props); err != nil {
-			sendJSONResponse(w, http.StatusInternalServerError, Response{
+			sendJSONResponse(w, errorStatus(err, http.StatusInternalServerError), Response{
 				Success: false,
 				Error:   err.Error(),
 			})
@@ -469,12 +1257,20 @@ func clusterStatusHandler(db *database.MultiModelDatabase) http.HandlerFunc {
 				"port":     node.Port,
 				"status":   node.Status,
 				"lastSeen": node.LastSeen,
+				"zone":     node.Zone,
+				"rack":     node.Rack,
 			}
 		}
 		
 		sendJSONResponse(w, http.StatusOK, Response{
 			Success: true,
-			Data:    map[string]interface{}{"nodes": nodeInfo, "enabled": true},
+			Data: map[string]interface{}{
+				"nodes":    nodeInfo,
+				"enabled":  true,
+				"epoch":    db.Cluster.Epoch(),
+				"clock":    db.Clock.Last(),
+				"transfer": db.StateTransfer(),
+			},
 		})
 	}
 }
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// searchHandler searches documents, KV keys, column row keys and graph nodes at once:
+// GET /search?q=text&limit=50
+func searchHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		limit := 0
+		if raw := query.Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   fmt.Sprintf("Invalid limit %q", raw),
+				})
+				return
+			}
+			limit = n
+		}
+
+		result, err := db.Search(r.Context(), query.Get("q"), limit)
+		if err != nil {
+			sendJSONResponse(w, errorStatus(err, http.StatusBadRequest), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    result,
+			Meta:    listMeta(len(result.Hits), !result.Truncated),
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// seedHandler loads fixture files from a directory on the server: {"dir": "./fixtures"}.
+// Without a directory the configured SEED_DIR is loaded.
+func seedHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Dir string `json:"dir"`
+		}
+		if r.ContentLength != 0 {
+			if err := readJSONBody(r, &request); err != nil {
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   "Invalid JSON in request body",
+				})
+				return
+			}
+		}
+		if request.Dir == "" {
+			request.Dir = db.Config().SeedDir
+		}
+		if request.Dir == "" {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "no seed directory given or configured",
+			})
+			return
+		}
+
+		result, err := db.Seed(request.Dir)
+		if err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: result.Failed == 0,
+			Message: fmt.Sprintf("%d items loaded, %d already present, %d failed", result.Loaded, result.Skipped, result.Failed),
+			Data:    result,
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// snapshotHandler streams a versioned snapshot of the in-memory models
+func snapshotHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := fmt.Sprintf("jettradb-%s.snapshot", time.Now().UTC().Format("20060102T150405Z"))
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		if _, err := db.WriteSnapshot(w); err != nil {
+			// Headers are already sent once streaming starts, so the truncated snapshot
+			// fails its manifest checks on restore
+			log.Printf("Snapshot failed: %v", err)
+		}
+	}
+}
+
+// restoreHandler replaces the snapshotted models with the snapshot in the request body
+func restoreHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		warnIfEphemeral(w, db)
+		result, err := db.RestoreSnapshot(r.Body)
+		if err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Snapshot restored",
+			Data:    result,
+		})
+	}
+}
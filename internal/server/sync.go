@@ -0,0 +1,44 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// syncHandler exchanges changes with an offline-first client:
+// {"token": "...", "changes": [{"id": "a", "op": "update", "doc": {...}}], "policy": "merge"}
+func syncHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request database.SyncRequest
+		if err := readJSONBody(r, &request); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid JSON in request body",
+			})
+			return
+		}
+
+		result, err := db.SyncCollection(r.Context(), mux.Vars(r)["collection"], request)
+		if err != nil {
+			sendJSONResponse(w, errorStatus(err, http.StatusBadRequest), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		message := fmt.Sprintf("%d changes applied, %d sent", result.Applied, len(result.Changes))
+		if len(result.Conflicts) > 0 {
+			message += fmt.Sprintf(", %d conflicts", len(result.Conflicts))
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: len(result.Errors) == 0,
+			Message: message,
+			Data:    result,
+		})
+	}
+}
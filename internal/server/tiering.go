@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// tieringOrReject returns the database's tiering, or responds with 404 when tiering
+// is not enabled
+func tieringOrReject(w http.ResponseWriter, db *database.MultiModelDatabase) *database.Tiering {
+	if db.Tiering == nil {
+		sendJSONResponse(w, http.StatusNotFound, Response{
+			Success: false,
+			Error:   "tiering is disabled, set TIER_S3_BUCKET and TIER_COLD_DAYS to enable it",
+		})
+	}
+	return db.Tiering
+}
+
+func tieringStatsHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tiering := tieringOrReject(w, db)
+		if tiering == nil {
+			return
+		}
+
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    tiering.Stats(),
+		})
+	}
+}
+
+// sweepTieringHandler moves cold data now instead of waiting for the next sweep
+func sweepTieringHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tiering := tieringOrReject(w, db)
+		if tiering == nil {
+			return
+		}
+
+		moved, err := tiering.Sweep()
+		if err != nil {
+			sendJSONResponse(w, http.StatusBadGateway, Response{
+				Success: false,
+				Error:   err.Error(),
+				Data:    map[string]int{"moved": moved},
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    map[string]int{"moved": moved},
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// timeoutMiddleware bounds each request's context by the configured request timeout.
+// Engine scans observe the context and stop once it is done, whether the timeout
+// fired or the client disconnected. Watches and reads with ?wait=true are exempt as
+// they carry their own timeout, and so is the cluster event stream, which lasts until
+// the client disconnects.
+func timeoutMiddleware(db *database.MultiModelDatabase) mux.MiddlewareFunc {
+	timeout := time.Duration(db.Config().RequestTimeout) * time.Second
+	return func(next http.Handler) http.Handler {
+		if timeout <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isLongPoll(r) || r.URL.Path == "/cluster/events" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
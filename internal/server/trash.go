@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/database"
+)
+
+// trashStatus maps errors of drops and of the trash to HTTP statuses
+func trashStatus(err error) int {
+	switch {
+	case strings.Contains(err.Error(), "not found"):
+		return http.StatusNotFound
+	case strings.Contains(err.Error(), "already exists"):
+		return http.StatusConflict
+	}
+	return errorStatus(err, http.StatusBadRequest)
+}
+
+// sendDropped answers a drop with the trash entry it can be restored from
+func sendDropped(w http.ResponseWriter, kind, name string, entry *database.TrashEntry, err error) {
+	if err != nil {
+		sendJSONResponse(w, trashStatus(err), Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	if entry == nil {
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: fmt.Sprintf("%s %s dropped", kind, name),
+		})
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("%s %s moved to the trash until %s", kind, name, entry.ExpiresAt.Format(time.RFC3339)),
+		Data:    entry,
+	})
+}
+
+// dropCollectionHandler drops a collection, keeping it restorable for the trash retention
+func dropCollectionHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+		entry, err := db.DropCollection(name)
+		sendDropped(w, "Collection", name, entry, err)
+	}
+}
+
+// dropColumnFamilyHandler drops a column family, keeping it restorable like collections
+func dropColumnFamilyHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		family := mux.Vars(r)["family"]
+		entry, err := db.DropColumnFamily(family)
+		sendDropped(w, "Column family", family, entry, err)
+	}
+}
+
+// trashHandler lists the dropped collections and column families that can be restored
+func trashHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entries := db.Trash()
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Data:    entries,
+			Meta:    listMeta(len(entries), true),
+		})
+	}
+}
+
+// restoreTrashHandler puts a dropped collection or column family back
+func restoreTrashHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entry, err := db.RestoreTrash(mux.Vars(r)["id"])
+		if err != nil {
+			sendJSONResponse(w, trashStatus(err), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: fmt.Sprintf("%s restored", entry.Name),
+			Data:    entry,
+		})
+	}
+}
+
+// purgeTrashHandler deletes a dropped collection or column family for good
+func purgeTrashHandler(db *database.MultiModelDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		if err := db.PurgeTrash(id); err != nil {
+			sendJSONResponse(w, trashStatus(err), Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, Response{
+			Success: true,
+			Message: fmt.Sprintf("Trash entry %s purged", id),
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// APIVersionHeader carries the API version a client asks for, and the version a
+// response was served in
+const APIVersionHeader = "X-API-Version"
+
+// currentAPIVersion is the version served to clients that do not ask for one
+const currentAPIVersion = 1
+
+// supportedAPIVersions lists every version the server can still answer in. When a
+// response format changes incompatibly, the new version is added here and handlers
+// branch on requestAPIVersion, so clients move over when they are ready.
+var supportedAPIVersions = []int{1}
+
+type apiVersionKey struct{}
+
+// APIVersioning serves the API under /v<N>/ prefixes as well as at the unversioned
+// paths, which remain aliases of the current version. A client may also ask for a
+// version with the X-API-Version header. The prefix is removed before routing, so
+// routes and middleware only ever see unversioned paths, and every response names
+// the version it was served in.
+func APIVersioning(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version, path, versioned := splitAPIVersion(r.URL.Path)
+		if versioned && !apiVersionSupported(version) {
+			sendJSONResponse(w, http.StatusNotFound, Response{
+				Success: false,
+				Error:   unsupportedAPIVersion(version),
+			})
+			return
+		}
+
+		if header := r.Header.Get(APIVersionHeader); header != "" {
+			requested, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(header), "v"))
+			switch {
+			case err != nil:
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   fmt.Sprintf("invalid %s header %q", APIVersionHeader, header),
+				})
+				return
+			case !apiVersionSupported(requested):
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   unsupportedAPIVersion(requested),
+				})
+				return
+			case versioned && requested != version:
+				sendJSONResponse(w, http.StatusBadRequest, Response{
+					Success: false,
+					Error:   fmt.Sprintf("path asks for API version %d but %s asks for %d", version, APIVersionHeader, requested),
+				})
+				return
+			}
+			version = requested
+		} else if !versioned {
+			version = currentAPIVersion
+		}
+
+		if versioned {
+			r = r.Clone(r.Context())
+			r.URL.Path = path
+			if r.URL.RawPath != "" {
+				_, r.URL.RawPath, _ = splitAPIVersion(r.URL.RawPath)
+			}
+		}
+		w.Header().Set(APIVersionHeader, strconv.Itoa(version))
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, version)))
+	})
+}
+
+// splitAPIVersion splits a /v<N> prefix off path, returning the version and the rest
+// of the path
+func splitAPIVersion(path string) (version int, rest string, versioned bool) {
+	if !strings.HasPrefix(path, "/v") {
+		return 0, path, false
+	}
+	end := strings.IndexByte(path[1:], '/') + 1
+	if end == 0 {
+		end = len(path)
+	}
+	version, err := strconv.Atoi(path[2:end])
+	if err != nil || version <= 0 || path[2] == '+' || path[2] == '0' {
+		return 0, path, false
+	}
+	if rest = path[end:]; rest == "" {
+		rest = "/"
+	}
+	return version, rest, true
+}
+
+func apiVersionSupported(version int) bool {
+	for _, supported := range supportedAPIVersions {
+		if version == supported {
+			return true
+		}
+	}
+	return false
+}
+
+func unsupportedAPIVersion(version int) string {
+	supported := make([]string, len(supportedAPIVersions))
+	for i, v := range supportedAPIVersions {
+		supported[i] = strconv.Itoa(v)
+	}
+	return fmt.Sprintf("unsupported API version %d, supported: %s", version, strings.Join(supported, ", "))
+}
+
+// requestAPIVersion returns the API version a request is served in
+func requestAPIVersion(r *http.Request) int {
+	if version, ok := r.Context().Value(apiVersionKey{}).(int); ok {
+		return version
+	}
+	return currentAPIVersion
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestAPIVersioning(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/docs/{collection}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(mux.Vars(r)["collection"]))
+	})
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("root"))
+	})
+	handler := APIVersioning(router)
+
+	for _, tc := range []struct {
+		path, header string
+		status       int
+		body         string
+	}{
+		{"/docs/users", "", http.StatusOK, "users"},
+		{"/v1/docs/users", "", http.StatusOK, "users"},
+		{"/v1", "", http.StatusOK, "root"},
+		{"/docs/users", "1", http.StatusOK, "users"},
+		{"/v1/docs/users", "v1", http.StatusOK, "users"},
+		{"/v2/docs/users", "", http.StatusNotFound, ""},
+		{"/docs/users", "2", http.StatusBadRequest, ""},
+		{"/docs/users", "latest", http.StatusBadRequest, ""},
+		// Only /v followed by a version is a prefix
+		{"/views/docs", "", http.StatusNotFound, ""},
+		{"/v01/docs/users", "", http.StatusNotFound, ""},
+	} {
+		r := httptest.NewRequest("GET", tc.path, nil)
+		if tc.header != "" {
+			r.Header.Set(APIVersionHeader, tc.header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tc.status || tc.status == http.StatusOK && w.Body.String() != tc.body {
+			t.Errorf("%s (%q) answered %d %s", tc.path, tc.header, w.Code, w.Body)
+		}
+		if tc.status == http.StatusOK && w.Header().Get(APIVersionHeader) != "1" {
+			t.Errorf("%s answered in version %q", tc.path, w.Header().Get(APIVersionHeader))
+		}
+	}
+}
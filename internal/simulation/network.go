@@ -0,0 +1,107 @@
+package simulation
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// ErrUnreachable is returned for requests the simulated network does not deliver
+var ErrUnreachable = errors.New("simulated network: host unreachable")
+
+// clientAddress is the source address of requests sent by test code rather than a node
+const clientAddress = "client"
+
+// Network is an in-memory transport between simulated nodes. Requests are served
+// by the target node's handler in the calling goroutine; stopped nodes and network
+// partitions make requests fail as a real network would.
+type Network struct {
+	handlers map[string]http.Handler
+	down     map[string]bool
+	cut      map[[2]string]bool // unordered address pairs that cannot reach each other
+	mutex    sync.RWMutex
+}
+
+// NewNetwork creates an empty network
+func NewNetwork() *Network {
+	return &Network{
+		handlers: make(map[string]http.Handler),
+		down:     make(map[string]bool),
+		cut:      make(map[[2]string]bool),
+	}
+}
+
+// Register attaches handler at address ("host:port")
+func (n *Network) Register(address string, handler http.Handler) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.handlers[address] = handler
+}
+
+// SetDown stops or restarts delivery to and from address
+func (n *Network) SetDown(address string, down bool) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.down[address] = down
+}
+
+// Cut prevents a and b from reaching each other
+func (n *Network) Cut(a, b string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.cut[pair(a, b)] = true
+}
+
+// Heal removes all cuts
+func (n *Network) Heal() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.cut = make(map[[2]string]bool)
+}
+
+func pair(a, b string) [2]string {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
+
+// Transport returns a RoundTripper sending requests from address
+func (n *Network) Transport(address string) http.RoundTripper {
+	return &transport{network: n, from: address}
+}
+
+// route returns the handler serving a request from one address to another
+func (n *Network) route(from, to string) (http.Handler, error) {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	handler, exists := n.handlers[to]
+	if !exists || n.down[to] || n.down[from] || n.cut[pair(from, to)] {
+		return nil, fmt.Errorf("%s -> %s: %w", from, to, ErrUnreachable)
+	}
+	return handler, nil
+}
+
+type transport struct {
+	network *Network
+	from    string
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	handler, err := t.network.route(t.from, req.URL.Host)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	resp := recorder.Result()
+	resp.Request = req
+	return resp, nil
+}
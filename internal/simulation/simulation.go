@@ -0,0 +1,264 @@
+// Package simulation runs several database nodes with clustering enabled in one
+// process, connected by an in-memory network, so partitioning, replication and
+// failover can be integration-tested without containers.
+package simulation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"multimodel-db-engine/internal/config"
+	"multimodel-db-engine/internal/database"
+	"multimodel-db-engine/internal/server"
+)
+
+// basePort is the cluster port of the first simulated node
+const basePort = 7000
+
+// baseAPIPort is the client API port of the first simulated node
+const baseAPIPort = 8000
+
+// Options configures a simulation
+type Options struct {
+	Nodes             int
+	DataDir           string // each node uses a subdirectory
+	ReplicationFactor int
+	FaultInjection    bool
+	Zones             []string // zone labels assigned to nodes round-robin
+	PlacementRules    string
+	ClusterSecret     string
+	TransferChunkSize int
+	PartitionMaxQPS   int // request rate above which the leader splits a partition
+}
+
+// Node is one simulated database node
+type Node struct {
+	ID             string
+	Address        string // "host:port" of the cluster port on the simulated network
+	APIAddress     string // "host:port" of the client API port
+	DB             *database.MultiModelDatabase
+	Handler        http.Handler // client API routes
+	ClusterHandler http.Handler // node to node routes
+}
+
+// Simulation is a cluster of in-process nodes
+type Simulation struct {
+	Network *Network
+	Nodes   []*Node
+	opts    Options
+}
+
+// New starts opts.Nodes nodes and joins each of them to the first one
+func New(opts Options) (*Simulation, error) {
+	if opts.Nodes <= 0 {
+		return nil, fmt.Errorf("a simulation needs at least one node")
+	}
+
+	sim := &Simulation{Network: NewNetwork(), opts: opts}
+	for i := 0; i < opts.Nodes; i++ {
+		sim.startNode(i)
+	}
+
+	seed := sim.Nodes[0].Address
+	for _, node := range sim.Nodes[1:] {
+		if err := node.DB.Cluster.Join(seed); err != nil {
+			sim.Close()
+			return nil, fmt.Errorf("%s failed to join: %w", node.ID, err)
+		}
+	}
+	return sim, nil
+}
+
+// AddNode starts another node and joins it to the first one. Like a node joining
+// a production cluster, it bootstraps its partitions from the members in the
+// background; StateTransfer reports when it is done.
+func (s *Simulation) AddNode() (*Node, error) {
+	node := s.startNode(len(s.Nodes))
+	if err := node.DB.JoinCluster(s.Nodes[0].Address); err != nil {
+		return nil, fmt.Errorf("%s failed to join: %w", node.ID, err)
+	}
+	return node, nil
+}
+
+// startNode creates node i and attaches it to the network
+func (s *Simulation) startNode(i int) *Node {
+	opts := s.opts
+	port := strconv.Itoa(basePort + i)
+	cfg := &config.Config{
+		DataDir:           filepath.Join(opts.DataDir, fmt.Sprintf("node-%d", i)),
+		Port:              strconv.Itoa(baseAPIPort + i),
+		ClusterEnabled:    true,
+		ClusterPort:       port,
+		NodeID:            fmt.Sprintf("node-%d", i),
+		ReplicationFactor: opts.ReplicationFactor,
+		FaultInjection:    opts.FaultInjection,
+		PlacementRules:    opts.PlacementRules,
+		ClusterSecret:     opts.ClusterSecret,
+		TransferChunkSize: opts.TransferChunkSize,
+		PartitionMaxQPS:   opts.PartitionMaxQPS,
+	}
+	if len(opts.Zones) > 0 {
+		cfg.NodeZone = opts.Zones[i%len(opts.Zones)]
+	}
+	db := database.NewMultiModelDatabase(cfg)
+	host := db.Cluster.Self().Address
+	node := &Node{ID: cfg.NodeID, Address: host + ":" + port, APIAddress: host + ":" + cfg.Port, DB: db}
+
+	router := mux.NewRouter()
+	server.SetupRoutes(router, db)
+	node.Handler = router
+	clusterRouter := mux.NewRouter()
+	server.SetupClusterRoutes(clusterRouter, db)
+	node.ClusterHandler = clusterRouter
+
+	db.Cluster.SetTransport(s.Network.Transport(node.Address))
+	s.Network.Register(node.Address, clusterRouter)
+	s.Network.Register(node.APIAddress, router)
+	s.Nodes = append(s.Nodes, node)
+	return node
+}
+
+// Tick runs one heartbeat and gossip round on every running node
+func (s *Simulation) Tick() {
+	for _, node := range s.Nodes {
+		if s.isDown(node) {
+			continue
+		}
+		node.DB.Cluster.Tick()
+	}
+}
+
+// Converge ticks until all running nodes report the same active membership and
+// epoch, up to maxTicks rounds, and returns the number of rounds taken. At least one
+// round runs so that failures since the last round are detected.
+func (s *Simulation) Converge(maxTicks int) (int, error) {
+	for tick := 1; tick <= maxTicks; tick++ {
+		s.Tick()
+		if s.converged() {
+			return tick, nil
+		}
+	}
+	return maxTicks, fmt.Errorf("membership did not converge within %d ticks", maxTicks)
+}
+
+func (s *Simulation) converged() bool {
+	var reference []string
+	var epoch uint64
+	for _, node := range s.Nodes {
+		if s.isDown(node) {
+			continue
+		}
+		members := s.Membership(node)
+		if reference == nil {
+			reference, epoch = members, node.DB.Cluster.Epoch()
+		} else if !reflect.DeepEqual(reference, members) || node.DB.Cluster.Epoch() != epoch {
+			return false
+		}
+	}
+	return true
+}
+
+// Membership returns the IDs of the nodes node considers active, in order
+func (s *Simulation) Membership(node *Node) []string {
+	active := node.DB.Cluster.GetActiveNodes()
+	ids := make([]string, len(active))
+	for i, member := range active {
+		ids[i] = member.ID
+	}
+	return ids
+}
+
+func (s *Simulation) isDown(node *Node) bool {
+	s.Network.mutex.RLock()
+	defer s.Network.mutex.RUnlock()
+	return s.Network.down[node.Address]
+}
+
+// Stop makes node unreachable, as if its process was killed
+func (s *Simulation) Stop(node *Node) {
+	s.Network.SetDown(node.Address, true)
+	s.Network.SetDown(node.APIAddress, true)
+}
+
+// Start makes a stopped node reachable again
+func (s *Simulation) Start(node *Node) {
+	s.Network.SetDown(node.Address, false)
+	s.Network.SetDown(node.APIAddress, false)
+}
+
+// Partition splits the network so nodes only reach nodes in their own group
+func (s *Simulation) Partition(groups ...[]*Node) {
+	for i, group := range groups {
+		for _, other := range groups[i+1:] {
+			for _, a := range group {
+				for _, b := range other {
+					s.Network.Cut(a.Address, b.Address)
+				}
+			}
+		}
+	}
+}
+
+// Heal removes all network partitions
+func (s *Simulation) Heal() {
+	s.Network.Heal()
+}
+
+// Do sends an API request to node through the simulated network and decodes the
+// response data into out when it is not nil
+func (s *Simulation) Do(node *Node, method, path string, body, out interface{}) (int, error) {
+	return s.do(node.APIAddress, method, path, body, out)
+}
+
+// DoCluster is Do for the node's cluster port
+func (s *Simulation) DoCluster(node *Node, method, path string, body, out interface{}) (int, error) {
+	return s.do(node.Address, method, path, body, out)
+}
+
+func (s *Simulation) do(address, method, path string, body, out interface{}) (int, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return 0, err
+		}
+	}
+	req, err := http.NewRequest(method, "http://"+address+path, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Transport: s.Network.Transport(clientAddress)}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var response server.Response
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return resp.StatusCode, err
+	}
+	if out != nil && response.Data != nil {
+		encoded, _ := json.Marshal(response.Data)
+		if err := json.Unmarshal(encoded, out); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// Close stops all nodes
+func (s *Simulation) Close() {
+	for _, node := range s.Nodes {
+		node.DB.Close()
+	}
+}
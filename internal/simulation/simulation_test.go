@@ -0,0 +1,669 @@
+package simulation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"multimodel-db-engine/internal/database"
+)
+
+func newSimulation(t *testing.T, nodes, replicationFactor int) *Simulation {
+	t.Helper()
+	sim, err := New(Options{Nodes: nodes, DataDir: t.TempDir(), ReplicationFactor: replicationFactor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sim.Close)
+	if _, err := sim.Converge(10); err != nil {
+		t.Fatal(err)
+	}
+	return sim
+}
+
+// owners returns the partition owner of each key as seen by node
+func owners(node *Node, keys int) []string {
+	result := make([]string, keys)
+	for i := range result {
+		result[i] = node.DB.Cluster.GetPartitionForKey("key-" + strconv.Itoa(i)).ID
+	}
+	return result
+}
+
+func TestMembershipConverges(t *testing.T) {
+	sim := newSimulation(t, 4, 1)
+
+	expected := []string{"node-0", "node-1", "node-2", "node-3"}
+	for _, node := range sim.Nodes {
+		if got := sim.Membership(node); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("%s sees %v, expected %v", node.ID, got, expected)
+		}
+	}
+}
+
+func TestNodesAgreeOnPartitionOwners(t *testing.T) {
+	sim := newSimulation(t, 3, 1)
+
+	reference := owners(sim.Nodes[0], 50)
+	for _, node := range sim.Nodes[1:] {
+		if got := owners(node, 50); !reflect.DeepEqual(got, reference) {
+			t.Fatalf("%s disagrees on partition owners", node.ID)
+		}
+	}
+}
+
+func TestReplicationReachesReplicas(t *testing.T) {
+	sim := newSimulation(t, 3, 3)
+
+	result, err := sim.Nodes[0].DB.Cluster.ReplicateData("greeting", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Required != 3 || result.Acknowledged != 3 || len(result.Replicas) != 3 {
+		t.Fatalf("unexpected replication result %+v", result)
+	}
+	for _, node := range sim.Nodes[1:] {
+		if value, err := node.DB.GetKeyValue("greeting"); err != nil || value != "hello" {
+			t.Fatalf("%s has %v, %v", node.ID, value, err)
+		}
+	}
+}
+
+func TestFailoverAfterNodeStops(t *testing.T) {
+	sim := newSimulation(t, 3, 1)
+	stopped := sim.Nodes[2]
+
+	sim.Stop(stopped)
+	if _, err := sim.Converge(5); err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range sim.Nodes[:2] {
+		if got := sim.Membership(node); !reflect.DeepEqual(got, []string{"node-0", "node-1"}) {
+			t.Fatalf("%s still sees %v after node-2 stopped", node.ID, got)
+		}
+		for _, owner := range owners(node, 50) {
+			if owner == stopped.ID {
+				t.Fatalf("%s still routes keys to the stopped node", node.ID)
+			}
+		}
+	}
+
+	sim.Start(stopped)
+	if _, err := sim.Converge(5); err != nil {
+		t.Fatal(err)
+	}
+	if got := sim.Membership(sim.Nodes[0]); len(got) != 3 {
+		t.Fatalf("restarted node was not readmitted: %v", got)
+	}
+}
+
+func TestPartitionAndHeal(t *testing.T) {
+	sim := newSimulation(t, 3, 1)
+	majority, minority := sim.Nodes[:2], sim.Nodes[2:]
+
+	sim.Partition(majority, minority)
+	sim.Tick()
+	if got := sim.Membership(sim.Nodes[0]); !reflect.DeepEqual(got, []string{"node-0", "node-1"}) {
+		t.Fatalf("majority side sees %v", got)
+	}
+	if got := sim.Membership(sim.Nodes[2]); !reflect.DeepEqual(got, []string{"node-2"}) {
+		t.Fatalf("minority side sees %v", got)
+	}
+
+	sim.Heal()
+	if _, err := sim.Converge(5); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAPIThroughSimulatedNetwork(t *testing.T) {
+	sim := newSimulation(t, 2, 1)
+
+	var status struct {
+		Enabled bool                     `json:"enabled"`
+		Nodes   []map[string]interface{} `json:"nodes"`
+	}
+	code, err := sim.Do(sim.Nodes[1], http.MethodGet, "/cluster/status", nil, &status)
+	if err != nil || code != http.StatusOK || !status.Enabled || len(status.Nodes) != 2 {
+		t.Fatalf("status: %d %+v %v", code, status, err)
+	}
+
+	sim.Stop(sim.Nodes[1])
+	if _, err := sim.Do(sim.Nodes[1], http.MethodGet, "/health", nil, nil); err == nil {
+		t.Fatal("request to a stopped node succeeded")
+	}
+}
+
+func TestClusterTrafficUsesClusterPort(t *testing.T) {
+	sim := newSimulation(t, 3, 3)
+	node := sim.Nodes[1]
+
+	for _, path := range []string{"/cluster/join", "/cluster/gossip", "/data/replicate"} {
+		if code, _ := sim.Do(node, http.MethodPost, path, map[string]string{}, nil); code != http.StatusNotFound {
+			t.Fatalf("API port answered %s with %d", path, code)
+		}
+	}
+	if code, _ := sim.DoCluster(node, http.MethodPut, "/kv/greeting", "hello", nil); code != http.StatusNotFound {
+		t.Fatalf("cluster port answered a client write with %d", code)
+	}
+
+	// Writes through the API port replicate over the cluster ports
+	if code, err := sim.Do(node, http.MethodPut, "/kv/greeting", "hello", nil); err != nil || code != http.StatusOK {
+		t.Fatalf("write: %d %v", code, err)
+	}
+	for _, replica := range sim.Nodes {
+		if value, err := replica.DB.GetKeyValue("greeting"); err != nil || value != "hello" {
+			t.Fatalf("%s: %v %v", replica.ID, value, err)
+		}
+	}
+}
+
+func TestJoiningNodeStreamsItsPartitions(t *testing.T) {
+	sim, err := New(Options{Nodes: 3, DataDir: t.TempDir(), ReplicationFactor: 2, TransferChunkSize: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sim.Close)
+	if _, err := sim.Converge(10); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 40; i++ {
+		if code, err := sim.Do(sim.Nodes[0], http.MethodPut, "/kv/key-"+strconv.Itoa(i), i, nil); err != nil || code != http.StatusOK {
+			t.Fatalf("write %d: %d %v", i, code, err)
+		}
+	}
+
+	joined, err := sim.AddNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for joined.DB.StateTransfer().State != "done" {
+		if time.Now().After(deadline) {
+			t.Fatalf("transfer did not finish: %+v", joined.DB.StateTransfer())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	status := joined.DB.StateTransfer()
+	chunks := 0
+	for _, source := range status.Sources {
+		if !source.Done || source.Error != "" {
+			t.Fatalf("source did not complete: %+v", source)
+		}
+		chunks += source.Chunks
+	}
+	if status.Keys == 0 || chunks <= len(status.Sources) {
+		t.Fatalf("expected the partitions to arrive in several chunks: %+v", status)
+	}
+
+	// Every key the new node replicates was streamed to it
+	replicated := 0
+	for i := 0; i < 40; i++ {
+		key := "key-" + strconv.Itoa(i)
+		if !replicaOf(joined, key) {
+			continue
+		}
+		replicated++
+		if value, err := joined.DB.GetKeyValue(key); err != nil || value != float64(i) {
+			t.Fatalf("%s: %v %v", key, value, err)
+		}
+	}
+	if replicated == 0 {
+		t.Fatal("the new node replicates no key")
+	}
+}
+
+func TestCRDTCollectionsMergeAfterPartition(t *testing.T) {
+	sim := newSimulation(t, 3, 3)
+	for _, node := range sim.Nodes {
+		if code, err := sim.Do(node, http.MethodPut, "/collections/carts/_consistency", map[string]string{"mode": "crdt"}, nil); err != nil || code != http.StatusOK {
+			t.Fatalf("%s: %d %v", node.ID, code, err)
+		}
+	}
+	cart := map[string]interface{}{"owner": "alice", "items": []string{"apple"}}
+	if code, err := sim.Do(sim.Nodes[0], http.MethodPost, "/docs/carts/c1", cart, nil); err != nil || code != http.StatusCreated {
+		t.Fatalf("insert: %d %v", code, err)
+	}
+
+	// Both sides of a partition keep accepting writes
+	sim.Partition([]*Node{sim.Nodes[0]}, []*Node{sim.Nodes[1], sim.Nodes[2]})
+	writes := map[*Node][]string{sim.Nodes[0]: {"apple", "pear"}, sim.Nodes[1]: {"apple", "plum"}}
+	for node, items := range writes {
+		if code, err := sim.Do(node, http.MethodPut, "/docs/carts/c1", map[string]interface{}{"items": items}, nil); err != nil || code != http.StatusOK {
+			t.Fatalf("%s: %d %v", node.ID, code, err)
+		}
+	}
+	if pending := sim.Nodes[0].DB.SyncCRDT(); pending != 1 {
+		t.Fatalf("expected the partitioned write to stay pending, got %d", pending)
+	}
+
+	sim.Heal()
+	for _, node := range sim.Nodes {
+		if pending := node.DB.SyncCRDT(); pending != 0 {
+			t.Fatalf("%s: %d documents still pending", node.ID, pending)
+		}
+	}
+	var reference database.Document
+	for _, node := range sim.Nodes {
+		doc, err := node.DB.GetDocument("carts", "c1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reference == nil {
+			reference = doc
+		} else if !reflect.DeepEqual(doc, reference) {
+			t.Fatalf("%s diverged: %v, expected %v", node.ID, doc, reference)
+		}
+	}
+	if items := reference["items"].([]interface{}); len(items) != 3 {
+		t.Fatalf("expected the concurrent additions to be merged, got %v", items)
+	}
+}
+
+// replicaOf reports whether node is among the replicas of key in its own view
+func replicaOf(node *Node, key string) bool {
+	for _, replica := range node.DB.Cluster.ReplicaNodes(key) {
+		if replica.ID == node.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// keyOutside returns a key whose replicas do not include node
+func keyOutside(t *testing.T, node *Node) string {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		key := "key-" + strconv.Itoa(i)
+		owned := false
+		for _, replica := range node.DB.Cluster.ReplicaNodes(key) {
+			owned = owned || replica.ID == node.ID
+		}
+		if !owned {
+			return key
+		}
+	}
+	t.Fatalf("every key is replicated to %s", node.ID)
+	return ""
+}
+
+func serve(node *Node, method, path, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	node.Handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestReplicaReadsHonourStaleness(t *testing.T) {
+	sim := newSimulation(t, 3, 2)
+	coordinator := sim.Nodes[0]
+	key := keyOutside(t, coordinator)
+	replicas := coordinator.DB.Cluster.ReplicaNodes(key)
+
+	if rec := serve(coordinator, http.MethodPut, "/kv/"+key, `"v1"`); rec.Code != http.StatusOK {
+		t.Fatalf("write: %d %s", rec.Code, rec.Body)
+	}
+	rec := serve(coordinator, http.MethodGet, "/kv/"+key+"?maxStaleness=5s", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "v1") {
+		t.Fatalf("replica read: %d %s", rec.Code, rec.Body)
+	}
+	if servedBy := rec.Header().Get("X-Served-By"); servedBy == coordinator.ID || servedBy == "" {
+		t.Fatalf("read served by %q, expected a replica", servedBy)
+	}
+
+	// The first replica misses the next write, so only the second one is fresh
+	var lagging, fresh *Node
+	for _, node := range sim.Nodes {
+		switch node.ID {
+		case replicas[0].ID:
+			lagging = node
+		case replicas[1].ID:
+			fresh = node
+		}
+	}
+	sim.Network.Cut(coordinator.Address, lagging.Address)
+	serve(coordinator, http.MethodPut, "/kv/"+key, `"v2"`)
+	sim.Heal()
+
+	rec = serve(coordinator, http.MethodGet, "/kv/"+key+"?maxStaleness=1h", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("bounded read: %d %s", rec.Code, rec.Body)
+	}
+	rec = serve(coordinator, http.MethodGet, "/kv/"+key+"?maxStaleness=0s", "")
+	if servedBy := rec.Header().Get("X-Served-By"); servedBy != fresh.ID || !strings.Contains(rec.Body.String(), "v2") {
+		t.Fatalf("fresh read served by %q: %s", servedBy, rec.Body)
+	}
+
+	sim.Partition([]*Node{coordinator}, []*Node{lagging, fresh})
+	serve(coordinator, http.MethodPut, "/kv/"+key, `"v3"`)
+	sim.Heal()
+	if rec := serve(coordinator, http.MethodGet, "/kv/"+key+"?maxStaleness=0s", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("read with no fresh replica: %d %s", rec.Code, rec.Body)
+	}
+	if rec := serve(coordinator, http.MethodGet, "/kv/"+key+"?maxStaleness=soon", ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid bound: %d", rec.Code)
+	}
+}
+
+func TestWriteResponseListsReplicaAcks(t *testing.T) {
+	sim := newSimulation(t, 3, 3)
+	coordinator, unreachable := sim.Nodes[0], sim.Nodes[2]
+
+	sim.Network.Cut(coordinator.Address, unreachable.Address)
+	var data struct {
+		Replication database.ReplicationResult `json:"replication"`
+	}
+	code, err := sim.Do(coordinator, http.MethodPut, "/kv/greeting", "hello", &data)
+	if err != nil || code != http.StatusOK {
+		t.Fatalf("write: %d %v", code, err)
+	}
+
+	replication := data.Replication
+	if replication.Required != 3 || replication.Acknowledged != 2 || len(replication.Replicas) != 3 {
+		t.Fatalf("unexpected replication %+v", replication)
+	}
+	for _, ack := range replication.Replicas {
+		switch {
+		case ack.NodeID == unreachable.ID && (ack.Acknowledged || ack.Error == ""):
+			t.Fatalf("unreachable replica reported %+v", ack)
+		case ack.NodeID == coordinator.ID && !ack.Local:
+			t.Fatalf("coordinator not reported as local: %+v", ack)
+		case ack.NodeID != unreachable.ID && !ack.Acknowledged:
+			t.Fatalf("replica %s did not acknowledge: %+v", ack.NodeID, ack)
+		}
+	}
+}
+
+func TestBulkLoadWritesToOwners(t *testing.T) {
+	sim := newSimulation(t, 3, 2)
+	coordinator := sim.Nodes[0]
+
+	pairs := make([]database.KeyValue, 30)
+	for i := range pairs {
+		pairs[i] = database.KeyValue{Key: "key-" + strconv.Itoa(i), Value: float64(i)}
+	}
+	var result database.BulkLoadResult
+	code, err := sim.Do(coordinator, http.MethodPost, "/kv/_bulk", map[string]interface{}{"pairs": pairs}, &result)
+	if err != nil || code != http.StatusOK || result.Stored != 30 || len(result.Chunks) != 3 {
+		t.Fatalf("bulk load: %d %+v %v", code, result, err)
+	}
+
+	for i, pair := range pairs {
+		replicas := make(map[string]bool)
+		for _, replica := range coordinator.DB.Cluster.ReplicaNodes(pair.Key) {
+			replicas[replica.ID] = true
+		}
+		for _, node := range sim.Nodes {
+			value, err := node.DB.GetKeyValue(pair.Key)
+			// Values keep the JSON number they were sent as
+			if held := err == nil && value == json.Number(strconv.Itoa(i)); held != replicas[node.ID] {
+				t.Fatalf("%s holds %s: %v, replica: %v", node.ID, pair.Key, held, replicas[node.ID])
+			}
+		}
+	}
+
+	sim.Network.Cut(coordinator.Address, sim.Nodes[1].Address)
+	code, err = sim.Do(coordinator, http.MethodPost, "/kv/_bulk", map[string]interface{}{"pairs": pairs}, &result)
+	if err != nil || code != http.StatusMultiStatus || result.Stored == 0 || result.Stored == 30 {
+		t.Fatalf("partial bulk load: %d %+v %v", code, result, err)
+	}
+}
+
+func TestStaleEpochWritesAreFenced(t *testing.T) {
+	sim := newSimulation(t, 3, 3)
+	paused := sim.Nodes[2]
+
+	// The majority observes the pause and moves to a new epoch; the paused node
+	// runs no rounds and keeps its old partition map
+	sim.Stop(paused)
+	if _, err := sim.Converge(5); err != nil {
+		t.Fatal(err)
+	}
+	sim.Start(paused)
+	if paused.DB.Cluster.Epoch() >= sim.Nodes[0].DB.Cluster.Epoch() {
+		t.Fatalf("paused node epoch %d is not behind %d", paused.DB.Cluster.Epoch(), sim.Nodes[0].DB.Cluster.Epoch())
+	}
+
+	result, err := paused.DB.Cluster.ReplicateData("fenced", "stale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ack := range result.Replicas {
+		if !ack.Local && (ack.Acknowledged || !strings.Contains(ack.Error, "stale cluster epoch")) {
+			t.Fatalf("stale write to %s was not fenced: %+v", ack.NodeID, ack)
+		}
+	}
+	if _, err := sim.Nodes[0].DB.GetKeyValue("fenced"); err == nil {
+		t.Fatal("stale write was applied")
+	}
+
+	if _, err := sim.Converge(10); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := paused.DB.Cluster.ReplicateData("fenced", "fresh"); err != nil || result.Acknowledged != 3 {
+		t.Fatalf("write after catching up: %+v %v", result, err)
+	}
+}
+
+func TestReplicasSpreadAcrossZones(t *testing.T) {
+	sim, err := New(Options{
+		Nodes:             6,
+		DataDir:           t.TempDir(),
+		ReplicationFactor: 3,
+		Zones:             []string{"a", "a", "b", "b", "c", "c"},
+		PlacementRules:    "logs=none:2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sim.Close)
+	if _, err := sim.Converge(20); err != nil {
+		t.Fatal(err)
+	}
+
+	cluster := sim.Nodes[0].DB.Cluster
+	for i := 0; i < 50; i++ {
+		zones := make(map[string]bool)
+		for _, replica := range cluster.ReplicaNodes("users." + strconv.Itoa(i)) {
+			zones[replica.Zone] = true
+		}
+		if len(zones) != 3 {
+			t.Fatalf("users.%d replicas cover zones %v", i, zones)
+		}
+		if replicas := cluster.ReplicaNodes("logs." + strconv.Itoa(i)); len(replicas) != 2 {
+			t.Fatalf("logs.%d has %d replicas, expected 2", i, len(replicas))
+		}
+	}
+}
+
+func TestDistributedLocksNeedAQuorum(t *testing.T) {
+	sim := newSimulation(t, 3, 1)
+
+	var first database.Lock
+	code, err := sim.Do(sim.Nodes[0], http.MethodPost, "/locks/leader/acquire", map[string]string{"owner": "a", "ttl": "1m"}, &first)
+	if err != nil || code != http.StatusOK || first.Granted != 3 || first.Quorum != 2 {
+		t.Fatalf("acquire: %d %+v %v", code, first, err)
+	}
+	if code, _ := sim.Do(sim.Nodes[1], http.MethodPost, "/locks/leader/acquire", map[string]string{"owner": "b"}, nil); code != http.StatusConflict {
+		t.Fatalf("second owner acquired a held lock: %d", code)
+	}
+	if code, _ := sim.Do(sim.Nodes[1], http.MethodPost, "/locks/leader/release", map[string]string{"owner": "a"}, nil); code != http.StatusOK {
+		t.Fatalf("release through another node: %d", code)
+	}
+
+	var second database.Lock
+	code, err = sim.Do(sim.Nodes[2], http.MethodPost, "/locks/leader/acquire", map[string]string{"owner": "b"}, &second)
+	if err != nil || code != http.StatusOK || second.FencingToken <= first.FencingToken {
+		t.Fatalf("reacquire: %d %+v %v", code, second, err)
+	}
+
+	// An isolated node cannot gather a majority
+	sim.Partition(sim.Nodes[:2], sim.Nodes[2:])
+	if code, _ := sim.Do(sim.Nodes[2], http.MethodPost, "/locks/other/acquire", map[string]string{"owner": "c"}, nil); code != http.StatusServiceUnavailable {
+		t.Fatalf("minority acquired a lock: %d", code)
+	}
+	if code, _ := sim.Do(sim.Nodes[0], http.MethodPost, "/locks/other/acquire", map[string]string{"owner": "d"}, nil); code != http.StatusOK {
+		t.Fatalf("majority failed to acquire: %d", code)
+	}
+}
+
+func TestClusterSecretAuthenticatesMessages(t *testing.T) {
+	sim, err := New(Options{Nodes: 3, DataDir: t.TempDir(), ReplicationFactor: 3, ClusterSecret: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sim.Close)
+	if _, err := sim.Converge(10); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := sim.Nodes[0].DB.Cluster.ReplicateData("greeting", "hello")
+	if err != nil || result.Acknowledged != 3 {
+		t.Fatalf("signed replication: %+v %v", result, err)
+	}
+
+	// Requests that are not signed with the secret are rejected
+	code, _ := sim.DoCluster(sim.Nodes[1], http.MethodPost, "/data/replicate", map[string]string{"key": "forged", "value": "x"}, nil)
+	if code != http.StatusUnauthorized {
+		t.Fatalf("unsigned replication answered %d", code)
+	}
+	if code, _ := sim.DoCluster(sim.Nodes[1], http.MethodPost, "/cluster/join", map[string]string{"id": "intruder"}, nil); code != http.StatusUnauthorized {
+		t.Fatalf("unsigned join answered %d", code)
+	}
+	if len(sim.Membership(sim.Nodes[1])) != 3 {
+		t.Fatalf("membership changed: %v", sim.Membership(sim.Nodes[1]))
+	}
+}
+
+func TestPartitionLoadCoversTheCluster(t *testing.T) {
+	sim := newSimulation(t, 3, 2)
+
+	for i := 0; i < 40; i++ {
+		if code, err := sim.Do(sim.Nodes[0], http.MethodPut, "/kv/key-"+strconv.Itoa(i), i, nil); err != nil || code != http.StatusOK {
+			t.Fatalf("write key-%d: %d %v", i, code, err)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if code, err := sim.Do(sim.Nodes[1], http.MethodGet, "/kv/key-7", nil, nil); err != nil || code != http.StatusOK {
+			t.Fatalf("read: %d %v", code, err)
+		}
+	}
+
+	var report database.LoadReport
+	if code, err := sim.Do(sim.Nodes[2], http.MethodGet, "/cluster/partitions", nil, &report); err != nil || code != http.StatusOK {
+		t.Fatalf("partitions: %d %v", code, err)
+	}
+	if len(report.Nodes) != 3 || len(report.Partitions) != 16 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	owned := 0
+	for _, node := range report.Nodes {
+		if node.Error != "" || node.Items == 0 {
+			t.Fatalf("no load collected from %+v", node)
+		}
+		owned += node.Partitions
+	}
+	items, hot := 0, sim.Nodes[0].DB.Cluster.PartitionForKey("key-7").ID
+	for _, partition := range report.Partitions {
+		items += partition.Items
+		if partition.ID == hot && (partition.Reads < 5 || partition.ReadRate == 0) {
+			t.Fatalf("reads of key-7 not counted against %+v", partition)
+		}
+	}
+	if owned != 16 || items != 40 {
+		t.Fatalf("expected 16 owned partitions holding 40 keys, got %d and %d", owned, items)
+	}
+}
+
+func TestLeaderSplitsHotPartitions(t *testing.T) {
+	sim, err := New(Options{Nodes: 3, DataDir: t.TempDir(), ReplicationFactor: 2, PartitionMaxQPS: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sim.Close)
+	if _, err := sim.Converge(10); err != nil {
+		t.Fatal(err)
+	}
+
+	if code, err := sim.Do(sim.Nodes[1], http.MethodPut, "/kv/hot", "value", nil); err != nil || code != http.StatusOK {
+		t.Fatalf("write: %d %v", code, err)
+	}
+	for i := 0; i < 30; i++ {
+		sim.Do(sim.Nodes[i%3], http.MethodGet, "/kv/hot", nil, nil)
+	}
+	hot := sim.Nodes[0].DB.Cluster.PartitionForKey("hot")
+	owner := sim.Nodes[0].DB.Cluster.GetPartitionForKey("hot").ID
+
+	// Only the leader acts on the load
+	if split, err := sim.Nodes[2].DB.CheckSplits(); err != nil || len(split) != 0 {
+		t.Fatalf("follower split %v: %v", split, err)
+	}
+	split, err := sim.Nodes[0].DB.CheckSplits()
+	if err != nil || len(split) != 1 || split[0] != hot.ID {
+		t.Fatalf("expected %s to be split, got %v: %v", hot.ID, split, err)
+	}
+
+	for _, node := range sim.Nodes {
+		m := node.DB.Cluster.PartitionMap()
+		if m.Version != 1 || len(m.Partitions) != 17 {
+			t.Fatalf("%s has partition map %d with %d partitions", node.ID, m.Version, len(m.Partitions))
+		}
+		if got := node.DB.Cluster.GetPartitionForKey("hot").ID; got != owner {
+			t.Fatalf("%s moved the key from %s to %s", node.ID, owner, got)
+		}
+		if !replicaOf(node, "hot") {
+			continue
+		}
+		var value string
+		if code, err := sim.Do(node, http.MethodGet, "/kv/hot", nil, &value); err != nil || code != http.StatusOK || value != "value" {
+			t.Fatalf("read after split through %s: %d %q %v", node.ID, code, value, err)
+		}
+	}
+
+	// A manual split through a follower is forwarded to the leader
+	var m database.PartitionMap
+	code, err := sim.Do(sim.Nodes[2], http.MethodPost, "/cluster/partitions/p0/split", nil, &m)
+	if err != nil || code != http.StatusOK || m.Version != 2 || sim.Nodes[1].DB.Cluster.PartitionMap().Version != 2 {
+		t.Fatalf("manual split: %d %+v %v", code, m, err)
+	}
+	if code, _ := sim.Do(sim.Nodes[2], http.MethodPost, "/cluster/partitions/p0/split", nil, nil); code != http.StatusNotFound {
+		t.Fatalf("splitting a split partition answered %d", code)
+	}
+}
+
+func TestClusterEventsStreamTopologyChanges(t *testing.T) {
+	sim := newSimulation(t, 3, 1)
+	observer := sim.Nodes[0]
+
+	sim.Stop(sim.Nodes[2])
+	if _, err := sim.Converge(5); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, stop := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer stop()
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/cluster/events?after=0", nil).WithContext(ctx)
+	observer.Handler.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("events: %d %s", recorder.Code, recorder.Header())
+	}
+	stream := recorder.Body.String()
+	for _, expected := range []string{"event: node_joined", "event: node_down", "event: failover", `"node":"node-2"`} {
+		if !strings.Contains(stream, expected) {
+			t.Fatalf("stream lacks %q:\n%s", expected, stream)
+		}
+	}
+	if !strings.HasPrefix(stream, "id: 1\n") {
+		t.Fatalf("stream does not start with the first event:\n%s", stream)
+	}
+}
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 
 	"multimodel-db-engine/internal/config"
+	"multimodel-db-engine/internal/connectors/kafka"
 	"multimodel-db-engine/internal/server"
 	"multimodel-db-engine/internal/database"
 )
@@ -19,6 +27,36 @@ func main() {
 	// Initialize the database engine
 	dbEngine := database.NewMultiModelDatabase(cfg)
 
+	// Publish the change stream to Kafka when configured
+	if cfg.KafkaRestURL != "" {
+		sink, err := kafka.NewSink(kafka.Options{
+			ProxyURL:    cfg.KafkaRestURL,
+			TopicPrefix: cfg.KafkaTopicPrefix,
+			Format:      cfg.KafkaFormat,
+		})
+		if err != nil {
+			log.Fatal("Kafka sink failed to start:", err)
+		}
+		if err := dbEngine.RegisterPlugin(sink); err != nil {
+			log.Fatal("Kafka sink failed to register:", err)
+		}
+		defer sink.Close()
+	}
+
+	// Load fixtures once plugins are registered, so they see the seeded data too
+	if cfg.SeedDir != "" {
+		result, err := dbEngine.Seed(cfg.SeedDir)
+		if err != nil {
+			log.Fatal("Seeding failed:", err)
+		}
+		log.Printf("Seeded %d items from %s (%d already present, %d failed)", result.Loaded, cfg.SeedDir, result.Skipped, result.Failed)
+		for _, file := range result.Files {
+			for _, message := range file.Errors {
+				log.Printf("Seed file %s: %s", file.File, message)
+			}
+		}
+	}
+
 	// Create HTTP router
 	router := mux.NewRouter()
 
@@ -30,14 +68,70 @@ func main() {
 		AllowedOrigins: []string{"*"},
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders: []string{"*"},
+		ExposedHeaders: []string{server.APIVersionHeader},
 	})
 
-	handler := c.Handler(router)
+	// Serve the API under /v1 as well as at the unversioned paths
+	handler := c.Handler(server.APIVersioning(router))
+	
+	// Every listener is shut down on SIGINT or SIGTERM before the engine is closed
+	var servers []*http.Server
+	serve := func(name string, srv *http.Server) {
+		servers = append(servers, srv)
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("%s server failed to start: %v", name, err)
+			}
+		}()
+	}
+	
+	// Serve node to node traffic on its own port
+	if cfg.ClusterEnabled {
+		if cfg.ClusterPort == cfg.Port {
+			log.Fatal("CLUSTER_PORT must differ from DB_PORT")
+		}
+		clusterRouter := mux.NewRouter()
+		server.SetupClusterRoutes(clusterRouter, dbEngine)
+		
+		log.Printf("Serving cluster traffic on port %s", cfg.ClusterPort)
+		serve("Cluster", &http.Server{Addr: ":" + cfg.ClusterPort, Handler: clusterRouter})
+	}
+	
+	// Serve profiles and runtime diagnostics on their own listener, so they are never
+	// reachable through the API port
+	if cfg.DebugAddr != "" {
+		runtime.SetMutexProfileFraction(cfg.MutexProfileRate)
+		debugRouter := mux.NewRouter()
+		server.SetupDebugRoutes(debugRouter, dbEngine)
+		
+		log.Printf("Serving diagnostics on %s", cfg.DebugAddr)
+		serve("Diagnostics", &http.Server{Addr: cfg.DebugAddr, Handler: debugRouter})
+	}
+	
+	// Join the cluster and stream this node's partitions from their owners
+	if cfg.ClusterEnabled && cfg.ClusterSeed != "" {
+		if err := dbEngine.JoinCluster(cfg.ClusterSeed); err != nil {
+			log.Printf("Failed to join cluster through %s: %v", cfg.ClusterSeed, err)
+		}
+	}
 
 	log.Printf("Starting Multi-Model Database Engine on port %s", cfg.Port)
 	
 	// Start the server
-	if err := http.ListenAndServe(":"+cfg.Port, handler); err != nil {
-		log.Fatal("Server failed to start:", err)
+	serve("API", &http.Server{Addr: ":" + cfg.Port, Handler: handler})
+	
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	
+	log.Printf("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Server on %s did not shut down cleanly: %v", srv.Addr, err)
+		}
 	}
+	// Stops background and cluster routines, closes queue journals and unmaps archives
+	dbEngine.Close()
 }
\ No newline at end of file
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
@@ -14,7 +17,22 @@ import (
 
 // DBClient represents a client to communicate with the database engine
 type DBClient struct {
-	BaseURL string
+	BaseURL string // primary node, receiving writes and reads that need the latest value
+
+	// All engine nodes, primary included. Under ReadNearest, key-value reads go to
+	// the nearest healthy one.
+	Nodes           []string
+	ReadConsistency string
+	MaxStaleness    time.Duration // how stale a read served by another node may be
+
+	// Token is sent as a bearer token to engines requiring the API_TOKEN
+	Token string
+
+	// Round trip time and health per node, from probes and requests, shared with
+	// the clients acting for signed-in users
+	health *nodeHealth
+
+	user string // the signed-in user requests are made for, sent as X-On-Behalf-Of
 }
 
 // Response represents a standard API response
@@ -36,43 +54,80 @@ type DatabaseInfo struct {
 // Document represents a document in the document store
 type Document map[string]interface{}
 
-// NewDBClient creates a new client for the database engine
+// NewDBClient creates a new client for the database engine, reading from the
+// primary only
 func NewDBClient(baseURL string) *DBClient {
-	return &DBClient{BaseURL: baseURL}
+	return &DBClient{
+		BaseURL:         baseURL,
+		Nodes:           []string{baseURL},
+		ReadConsistency: ReadPrimary,
+		MaxStaleness:    5 * time.Second,
+		health:          &nodeHealth{states: make(map[string]*NodeState)},
+	}
+}
+
+// actingFor returns a client making its requests for user, sharing the measured
+// nodes of c
+func (c *DBClient) actingFor(user string) *DBClient {
+	client := *c
+	client.user = user
+	return &client
 }
 
-// makeRequest makes HTTP requests to the database engine
+// makeRequest makes HTTP requests to the primary database engine node
 func (c *DBClient) makeRequest(method, endpoint string, payload interface{}) (*Response, error) {
+	resp, _, err := c.requestNode(c.BaseURL, method, endpoint, payload)
+	return resp, err
+}
+
+// requestNode makes an HTTP request to node and records its round trip time. Nodes
+// that cannot be reached are marked unhealthy.
+func (c *DBClient) requestNode(node, method, endpoint string, payload interface{}) (*Response, int, error) {
 	var req *http.Request
 	var err error
 
 	if payload != nil {
 		payloadBytes, _ := json.Marshal(payload)
-		req, err = http.NewRequest(method, c.BaseURL+endpoint, strings.NewReader(string(payloadBytes)))
+		req, err = http.NewRequest(method, node+endpoint, strings.NewReader(string(payloadBytes)))
 	} else {
-		req, err = http.NewRequest(method, c.BaseURL+endpoint, nil)
+		req, err = http.NewRequest(method, node+endpoint, nil)
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	c.setHeaders(req)
 
-	client := &http.Client{}
+	client := &http.Client{Timeout: 10 * time.Second}
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		c.observe(node, 0, false)
+		return nil, 0, err
 	}
 	defer resp.Body.Close()
+	// A node shedding load with 503 is not healthy for routing either
+	c.observe(node, time.Since(start), resp.StatusCode < http.StatusInternalServerError)
 
 	var apiResp Response
 	err = json.NewDecoder(resp.Body).Decode(&apiResp)
 	if err != nil {
-		return nil, err
+		return nil, resp.StatusCode, err
 	}
 
-	return &apiResp, nil
+	return &apiResp, resp.StatusCode, nil
+}
+
+// setHeaders adds the API token and the user a request is made for
+func (c *DBClient) setHeaders(req *http.Request) {
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if c.user != "" {
+		req.Header.Set(onBehalfOfHeader, c.user)
+	}
 }
 
 // GetHealth checks the health of the database engine
@@ -85,6 +140,31 @@ func (c *DBClient) GetClusterStatus() (*Response, error) {
 	return c.makeRequest("GET", "/cluster/status", nil)
 }
 
+// StreamClusterEvents opens the cluster event stream, resuming after lastEventID
+// when it is not empty. The caller reads the server-sent events from the response
+// body and closes it.
+func (c *DBClient) StreamClusterEvents(lastEventID string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", c.BaseURL+"/cluster/events", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	c.setHeaders(req)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("event stream failed with status: %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
 // GetCollections gets all collections in the document store
 func (c *DBClient) GetCollections() ([]string, error) {
 	// Since we don't have a direct API endpoint for this, we'll simulate by listing known collections
@@ -112,9 +192,18 @@ func (c *DBClient) DeleteDocument(collection string, id string) (*Response, erro
 	return c.makeRequest("DELETE", fmt.Sprintf("/docs/%s/%s", collection, id), nil)
 }
 
-// GetKeyValue gets a key-value pair
+// Search searches documents, keys, column rows and graph nodes at once
+func (c *DBClient) Search(query, limit string) (*Response, error) {
+	params := url.Values{"q": {query}}
+	if limit != "" {
+		params.Set("limit", limit)
+	}
+	return c.makeRequest("GET", "/search?"+params.Encode(), nil)
+}
+
+// GetKeyValue gets a key-value pair from the node the read consistency allows
 func (c *DBClient) GetKeyValue(key string) (*Response, error) {
-	return c.makeRequest("GET", fmt.Sprintf("/kv/%s", key), nil)
+	return c.read(fmt.Sprintf("/kv/%s", key))
 }
 
 // SetKeyValue sets a key-value pair
@@ -173,40 +262,60 @@ func (c *DBClient) CreateEdge(id, from, to, edgeType string, props interface{})
 var dbClient *DBClient
 
 func setupRoutes(router *mux.Router) {
+	// Sessions. With ADMIN_USERS set, every other API route needs a signed-in user
+	// with the role it is registered with.
+	router.HandleFunc("/api/login", loginHandler).Methods("POST")
+	router.HandleFunc("/api/logout", logoutHandler).Methods("POST")
+	router.HandleFunc("/api/session", sessionHandler).Methods("GET")
+	
 	// Health check
-	router.HandleFunc("/api/health", healthHandler).Methods("GET")
+	router.HandleFunc("/api/health", authorize(roleViewer, healthHandler)).Methods("GET")
 	
 	// Cluster management
-	router.HandleFunc("/api/cluster/status", clusterStatusHandler).Methods("GET")
+	router.HandleFunc("/api/cluster/status", authorize(roleViewer, clusterStatusHandler)).Methods("GET")
+	router.HandleFunc("/api/cluster/events", authorize(roleViewer, clusterEventsHandler)).Methods("GET")
+	router.HandleFunc("/api/cluster/routing", authorize(roleViewer, clusterRoutingHandler)).Methods("GET")
+	
+	// Global search bar
+	router.HandleFunc("/api/search", authorize(roleViewer, searchHandler)).Methods("GET")
 	
 	// Document store management
-	router.HandleFunc("/api/documents/collections", getCollectionsHandler).Methods("GET")
-	router.HandleFunc("/api/documents/{collection}", getDocumentsHandler).Methods("GET")
-	router.HandleFunc("/api/documents/{collection}/{id}", createDocumentHandler).Methods("POST")
-	router.HandleFunc("/api/documents/{collection}/{id}", updateDocumentHandler).Methods("PUT")
-	router.HandleFunc("/api/documents/{collection}/{id}", deleteDocumentHandler).Methods("DELETE")
+	router.HandleFunc("/api/documents/collections", authorize(roleViewer, getCollectionsHandler)).Methods("GET")
+	router.HandleFunc("/api/documents/{collection}", authorize(roleViewer, getDocumentsHandler)).Methods("GET")
+	router.HandleFunc("/api/documents/{collection}/{id}", authorize(roleEditor, createDocumentHandler)).Methods("POST")
+	router.HandleFunc("/api/documents/{collection}/{id}", authorize(roleEditor, updateDocumentHandler)).Methods("PUT")
+	router.HandleFunc("/api/documents/{collection}/{id}", authorize(roleAdmin, deleteDocumentHandler)).Methods("DELETE")
+	router.HandleFunc("/api/import/{collection}", authorize(roleAdmin, importHandler)).Methods("POST")
+	router.HandleFunc("/api/imports/{id}/events", authorize(roleViewer, importEventsHandler)).Methods("GET")
+	
+	// Saved dashboards
+	router.HandleFunc("/api/dashboards", authorize(roleViewer, listDashboardsHandler)).Methods("GET")
+	router.HandleFunc("/api/dashboards", authorize(roleEditor, createDashboardHandler)).Methods("POST")
+	router.HandleFunc("/api/dashboards/{id}", authorize(roleViewer, getDashboardHandler)).Methods("GET")
+	router.HandleFunc("/api/dashboards/{id}", authorize(roleEditor, updateDashboardHandler)).Methods("PUT")
+	router.HandleFunc("/api/dashboards/{id}", authorize(roleAdmin, deleteDashboardHandler)).Methods("DELETE")
 	
 	// Key-value store management
-	router.HandleFunc("/api/kv/{key}", getKeyHandler).Methods("GET")
-	router.HandleFunc("/api/kv/{key}", setKeyHandler).Methods("POST", "PUT")
-	router.HandleFunc("/api/kv/{key}", deleteKeyHandler).Methods("DELETE")
+	router.HandleFunc("/api/kv/{key}", authorize(roleViewer, getKeyHandler)).Methods("GET")
+	router.HandleFunc("/api/kv/{key}", authorize(roleEditor, setKeyHandler)).Methods("POST", "PUT")
+	router.HandleFunc("/api/kv/{key}", authorize(roleAdmin, deleteKeyHandler)).Methods("DELETE")
 	
 	// Column store management
-	router.HandleFunc("/api/columns/{family}/{row}/{column}", getColumnHandler).Methods("GET")
-	router.HandleFunc("/api/columns/{family}/{row}/{column}", insertColumnHandler).Methods("POST", "PUT")
+	router.HandleFunc("/api/columns/{family}/{row}/{column}", authorize(roleViewer, getColumnHandler)).Methods("GET")
+	router.HandleFunc("/api/columns/{family}/{row}/{column}", authorize(roleEditor, insertColumnHandler)).Methods("POST", "PUT")
 	
 	// Graph store management
-	router.HandleFunc("/api/graph/nodes/{id}", getNodeHandler).Methods("GET")
-	router.HandleFunc("/api/graph/nodes", createNodeHandler).Methods("POST")
-	router.HandleFunc("/api/graph/edges/{id}", getEdgeHandler).Methods("GET")
-	router.HandleFunc("/api/graph/edges", createEdgeHandler).Methods("POST")
+	router.HandleFunc("/api/graph/nodes/{id}", authorize(roleViewer, getNodeHandler)).Methods("GET")
+	router.HandleFunc("/api/graph/nodes", authorize(roleEditor, createNodeHandler)).Methods("POST")
+	router.HandleFunc("/api/graph/edges/{id}", authorize(roleViewer, getEdgeHandler)).Methods("GET")
+	router.HandleFunc("/api/graph/edges", authorize(roleEditor, createEdgeHandler)).Methods("POST")
 	
 	// Serve static files
 	router.PathPrefix("/").Handler(http.FileServer(http.Dir("./webapp/frontend/dist/")))
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
-	resp, err := dbClient.GetHealth()
+	resp, err := engine(r).GetHealth()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -215,7 +324,7 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func clusterStatusHandler(w http.ResponseWriter, r *http.Request) {
-	resp, err := dbClient.GetClusterStatus()
+	resp, err := engine(r).GetClusterStatus()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -223,8 +332,59 @@ func clusterStatusHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
+// clusterRoutingHandler reports the read consistency and the measured nodes,
+// nearest first
+func clusterRoutingHandler(w http.ResponseWriter, r *http.Request) {
+	response := Response{
+		Success: true,
+		Data: map[string]interface{}{
+			"read_consistency": dbClient.ReadConsistency,
+			"max_staleness":    dbClient.MaxStaleness.String(),
+			"nodes":            dbClient.NodeStates(),
+		},
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// clusterEventsHandler relays the engine's cluster event stream to the browser
+func clusterEventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	
+	resp, err := engine(r).StreamClusterEvents(r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	go func() {
+		<-r.Context().Done()
+		resp.Body.Close()
+	}()
+	
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	
+	buf := make([]byte, 4096)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			w.Write(buf[:n])
+			flusher.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
 func getCollectionsHandler(w http.ResponseWriter, r *http.Request) {
-	collections, err := dbClient.GetCollections()
+	collections, err := engine(r).GetCollections()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -241,7 +401,18 @@ func getDocumentsHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	collection := vars["collection"]
 	
-	resp, err := dbClient.GetDocuments(collection)
+	resp, err := engine(r).GetDocuments(collection)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// searchHandler relays a global search to the engine
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	resp, err := engine(r).Search(query.Get("q"), query.Get("limit"))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -260,7 +431,7 @@ func createDocumentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	resp, err := dbClient.CreateDocument(collection, id, doc)
+	resp, err := engine(r).CreateDocument(collection, id, doc)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -279,7 +450,7 @@ func updateDocumentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	resp, err := dbClient.UpdateDocument(collection, id, updates)
+	resp, err := engine(r).UpdateDocument(collection, id, updates)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -292,7 +463,7 @@ func deleteDocumentHandler(w http.ResponseWriter, r *http.Request) {
 	collection := vars["collection"]
 	id := vars["id"]
 	
-	resp, err := dbClient.DeleteDocument(collection, id)
+	resp, err := engine(r).DeleteDocument(collection, id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -304,7 +475,7 @@ func getKeyHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	key := vars["key"]
 	
-	resp, err := dbClient.GetKeyValue(key)
+	resp, err := engine(r).GetKeyValue(key)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -322,7 +493,7 @@ func setKeyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	resp, err := dbClient.SetKeyValue(key, value)
+	resp, err := engine(r).SetKeyValue(key, value)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -334,7 +505,7 @@ func deleteKeyHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	key := vars["key"]
 	
-	resp, err := dbClient.DeleteKey(key)
+	resp, err := engine(r).DeleteKey(key)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -348,7 +519,7 @@ func getColumnHandler(w http.ResponseWriter, r *http.Request) {
 	row := vars["row"]
 	column := vars["column"]
 	
-	resp, err := dbClient.GetColumn(family, row, column)
+	resp, err := engine(r).GetColumn(family, row, column)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -368,7 +539,7 @@ func insertColumnHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	resp, err := dbClient.InsertColumn(family, row, column, value)
+	resp, err := engine(r).InsertColumn(family, row, column, value)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -380,7 +551,7 @@ func getNodeHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 	
-	resp, err := dbClient.GetNode(id)
+	resp, err := engine(r).GetNode(id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -400,7 +571,7 @@ func createNodeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	resp, err := dbClient.CreateNode(nodeData.ID, nodeData.Labels, nodeData.Props)
+	resp, err := engine(r).CreateNode(nodeData.ID, nodeData.Labels, nodeData.Props)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -412,7 +583,7 @@ func getEdgeHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 	
-	resp, err := dbClient.GetEdge(id)
+	resp, err := engine(r).GetEdge(id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -434,7 +605,7 @@ func createEdgeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	resp, err := dbClient.CreateEdge(edgeData.ID, edgeData.From, edgeData.To, edgeData.Type, edgeData.Props)
+	resp, err := engine(r).CreateEdge(edgeData.ID, edgeData.From, edgeData.To, edgeData.Type, edgeData.Props)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -449,6 +620,43 @@ func main() {
 	}
 	
 	dbClient = NewDBClient(dbURL)
+	dbClient.Token = os.Getenv("DB_API_TOKEN")
+	
+	// Further nodes serving key-value reads nearest first under DB_READ_CONSISTENCY=nearest
+	for _, node := range strings.Split(os.Getenv("DB_URLS"), ",") {
+		if node = strings.TrimSpace(node); node != "" && node != dbURL {
+			dbClient.Nodes = append(dbClient.Nodes, node)
+		}
+	}
+	if consistency := os.Getenv("DB_READ_CONSISTENCY"); consistency != "" {
+		if consistency != ReadPrimary && consistency != ReadNearest {
+			log.Fatalf("DB_READ_CONSISTENCY must be %s or %s", ReadPrimary, ReadNearest)
+		}
+		dbClient.ReadConsistency = consistency
+	}
+	if staleness := os.Getenv("DB_MAX_STALENESS"); staleness != "" {
+		bound, err := time.ParseDuration(staleness)
+		if err != nil || bound < 0 {
+			log.Fatalf("DB_MAX_STALENESS must be a duration such as 5s")
+		}
+		dbClient.MaxStaleness = bound
+	}
+	dbClient.StartProbing(context.Background(), 10*time.Second)
+	
+	users, err := parseAdminUsers(os.Getenv("ADMIN_USERS"))
+	if err != nil {
+		log.Fatalf("ADMIN_USERS: %v", err)
+	}
+	ttl := 12 * time.Hour
+	if value := os.Getenv("ADMIN_SESSION_TTL"); value != "" {
+		if ttl, err = time.ParseDuration(value); err != nil || ttl <= 0 {
+			log.Fatalf("ADMIN_SESSION_TTL must be a duration such as 12h")
+		}
+	}
+	auth = newAuthenticator(users, ttl)
+	if !auth.enabled() {
+		log.Printf("ADMIN_USERS is not set, the web admin serves everyone without sign-in")
+	}
 	
 	router := mux.NewRouter()
 	setupRoutes(router)
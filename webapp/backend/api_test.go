@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestsCarryTheAPIToken(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// As the engine's API_TOKEN check
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(Response{Error: "missing or invalid API token"})
+			return
+		}
+		if r.URL.Path == "/cluster/events" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			return
+		}
+		json.NewEncoder(w).Encode(Response{Success: true})
+	}))
+	defer node.Close()
+
+	client := NewDBClient(node.URL)
+	if _, status, err := client.requestNode(node.URL, "GET", "/docs/users", nil); err != nil || status != http.StatusUnauthorized {
+		t.Fatalf("request without a token answered %d, %v", status, err)
+	}
+
+	client.Token = "secret"
+	for _, c := range []*DBClient{client, client.actingFor("ada")} {
+		resp, status, err := c.requestNode(node.URL, "GET", "/docs/users", nil)
+		if err != nil || status != http.StatusOK || !resp.Success {
+			t.Fatalf("request with the token answered %d, %+v, %v", status, resp, err)
+		}
+		stream, err := c.StreamClusterEvents("")
+		if err != nil {
+			t.Fatalf("event stream with the token: %v", err)
+		}
+		stream.Body.Close()
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Roles of admin users, each allowed what the roles before it are
+const (
+	roleViewer = "viewer" // reads
+	roleEditor = "editor" // creates and updates
+	roleAdmin  = "admin"  // deletes and bulk imports
+)
+
+var roleRanks = map[string]int{roleViewer: 1, roleEditor: 2, roleAdmin: 3}
+
+const (
+	// sessionCookie holds the session id of a signed-in user
+	sessionCookie = "webadmin_session"
+	// onBehalfOfHeader names the signed-in user to the engine, which writes it to
+	// its access log
+	onBehalfOfHeader = "X-On-Behalf-Of"
+)
+
+// adminUser is a user allowed to sign in to the web admin
+type adminUser struct {
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	password string
+}
+
+type session struct {
+	user    *adminUser
+	expires time.Time
+}
+
+// authenticator signs users in and checks the role their requests need. Without
+// users sign-in is disabled and every request is allowed.
+type authenticator struct {
+	users    map[string]*adminUser
+	ttl      time.Duration
+	sessions map[string]*session
+	mutex    sync.Mutex
+	now      func() time.Time
+}
+
+// auth holds the users of ADMIN_USERS, set by main
+var auth = newAuthenticator(nil, 12*time.Hour)
+
+func newAuthenticator(users map[string]*adminUser, ttl time.Duration) *authenticator {
+	return &authenticator{users: users, ttl: ttl, sessions: make(map[string]*session), now: time.Now}
+}
+
+// parseAdminUsers parses users written as name:role:password, separated by commas
+func parseAdminUsers(spec string) (map[string]*adminUser, error) {
+	users := make(map[string]*adminUser)
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		fields := strings.SplitN(entry, ":", 3)
+		if len(fields) != 3 || fields[0] == "" || fields[2] == "" {
+			return nil, fmt.Errorf("user %q must be written as name:role:password", strings.SplitN(entry, ":", 2)[0])
+		}
+		if roleRanks[fields[1]] == 0 {
+			return nil, fmt.Errorf("user %s has unknown role %q, expected %s, %s or %s", fields[0], fields[1], roleViewer, roleEditor, roleAdmin)
+		}
+		users[fields[0]] = &adminUser{Name: fields[0], Role: fields[1], password: fields[2]}
+	}
+	return users, nil
+}
+
+func (a *authenticator) enabled() bool {
+	return len(a.users) > 0
+}
+
+// login checks the password of the user name and opens a session for it
+func (a *authenticator) login(name, password string) (string, *adminUser, error) {
+	user, exists := a.users[name]
+	expected := "\x00"
+	if exists {
+		expected = user.password
+	}
+	// Unknown users are compared too, so the time taken does not tell them apart
+	if subtle.ConstantTimeCompare([]byte(password), []byte(expected)) != 1 || !exists {
+		return "", nil, fmt.Errorf("invalid user name or password")
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+	id := hex.EncodeToString(raw)
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	now := a.now()
+	for other, s := range a.sessions {
+		if now.After(s.expires) {
+			delete(a.sessions, other)
+		}
+	}
+	a.sessions[id] = &session{user: user, expires: now.Add(a.ttl)}
+	return id, user, nil
+}
+
+// user returns the signed-in user of a request, or nil
+func (a *authenticator) user(r *http.Request) *adminUser {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	s, exists := a.sessions[cookie.Value]
+	if !exists {
+		return nil
+	}
+	if a.now().After(s.expires) {
+		delete(a.sessions, cookie.Value)
+		return nil
+	}
+	return s.user
+}
+
+// logout ends the session of a request
+func (a *authenticator) logout(r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		a.mutex.Lock()
+		delete(a.sessions, cookie.Value)
+		a.mutex.Unlock()
+	}
+}
+
+type userKey struct{}
+
+// authorize wraps the handler of a route that needs role, passing the signed-in
+// user on to engine
+func authorize(role string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.enabled() {
+			handler(w, r)
+			return
+		}
+		user := auth.user(r)
+		if user == nil {
+			http.Error(w, "Sign-in required", http.StatusUnauthorized)
+			return
+		}
+		if roleRanks[user.Role] < roleRanks[role] {
+			http.Error(w, fmt.Sprintf("The %s role is required", role), http.StatusForbidden)
+			return
+		}
+		handler(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+	}
+}
+
+// engine returns the database client making requests for the signed-in user of r
+func engine(r *http.Request) *DBClient {
+	if user, ok := r.Context().Value(userKey{}).(*adminUser); ok {
+		return dbClient.actingFor(user.Name)
+	}
+	return dbClient
+}
+
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	var credentials struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if !auth.enabled() {
+		http.Error(w, "Sign-in is disabled, set ADMIN_USERS to enable it", http.StatusNotFound)
+		return
+	}
+
+	id, user, err := auth.login(credentials.Username, credentials.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(auth.ttl / time.Second),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteStrictMode,
+	})
+	json.NewEncoder(w).Encode(Response{Success: true, Message: "Signed in", Data: user})
+}
+
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	auth.logout(r)
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1})
+	json.NewEncoder(w).Encode(Response{Success: true, Message: "Signed out"})
+}
+
+// sessionHandler reports whether sign-in is enabled and who is signed in
+func sessionHandler(w http.ResponseWriter, r *http.Request) {
+	data := map[string]interface{}{"auth_enabled": auth.enabled()}
+	if user := auth.user(r); user != nil {
+		data["user"] = user
+	}
+	json.NewEncoder(w).Encode(Response{Success: true, Data: data})
+}
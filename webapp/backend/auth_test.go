@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// newTestAdmin serves the web admin routes with users, against a stub engine that
+// records the user each request was made for
+func newTestAdmin(t *testing.T, users map[string]*adminUser) (*mux.Router, *[]string) {
+	t.Helper()
+	var onBehalfOf []string
+	engineStub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		onBehalfOf = append(onBehalfOf, r.Header.Get(onBehalfOfHeader))
+		json.NewEncoder(w).Encode(Response{Success: true})
+	}))
+	t.Cleanup(engineStub.Close)
+
+	previousAuth, previousClient := auth, dbClient
+	t.Cleanup(func() { auth, dbClient = previousAuth, previousClient })
+	auth = newAuthenticator(users, time.Hour)
+	dbClient = NewDBClient(engineStub.URL)
+
+	router := mux.NewRouter()
+	setupRoutes(router)
+	return router, &onBehalfOf
+}
+
+// signIn returns the session cookie of name
+func signIn(t *testing.T, router *mux.Router, name, password string) *http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	body := `{"username": "` + name + `", "password": "` + password + `"}`
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/api/login", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("sign-in of %s answered %d: %s", name, w.Code, w.Body)
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == sessionCookie {
+			return cookie
+		}
+	}
+	t.Fatalf("sign-in of %s set no session cookie", name)
+	return nil
+}
+
+func TestRolesGuardRoutes(t *testing.T) {
+	users, err := parseAdminUsers("vic:viewer:pw1, eve:editor:pw2, ada:admin:pw3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, onBehalfOf := newTestAdmin(t, users)
+	cookies := map[string]*http.Cookie{
+		"vic": signIn(t, router, "vic", "pw1"),
+		"eve": signIn(t, router, "eve", "pw2"),
+		"ada": signIn(t, router, "ada", "pw3"),
+	}
+
+	tests := []struct {
+		user         string
+		method, path string
+		status       int
+	}{
+		{"vic", "GET", "/api/documents/users", http.StatusOK},
+		{"vic", "POST", "/api/documents/users/1", http.StatusForbidden},
+		{"vic", "DELETE", "/api/documents/users/1", http.StatusForbidden},
+		{"eve", "GET", "/api/documents/users", http.StatusOK},
+		{"eve", "POST", "/api/documents/users/1", http.StatusOK},
+		{"eve", "DELETE", "/api/documents/users/1", http.StatusForbidden},
+		{"ada", "GET", "/api/documents/users", http.StatusOK},
+		{"ada", "POST", "/api/documents/users/1", http.StatusOK},
+		{"ada", "DELETE", "/api/documents/users/1", http.StatusOK},
+		{"", "GET", "/api/documents/users", http.StatusUnauthorized},
+		{"", "POST", "/api/documents/users/1", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		*onBehalfOf = nil
+		r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"name": "ann"}`))
+		if tt.user != "" {
+			r.AddCookie(cookies[tt.user])
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s %s by %q answered %d, want %d", tt.method, tt.path, tt.user, w.Code, tt.status)
+			continue
+		}
+		// Allowed requests reach the engine on behalf of their user, denied ones never do
+		want := []string{tt.user}
+		if tt.status != http.StatusOK {
+			want = nil
+		}
+		if strings.Join(*onBehalfOf, ",") != strings.Join(want, ",") {
+			t.Errorf("%s %s by %q reached the engine for %v", tt.method, tt.path, tt.user, *onBehalfOf)
+		}
+	}
+}
+
+func TestSessionsExpireAndEnd(t *testing.T) {
+	users, err := parseAdminUsers("ada:admin:pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, _ := newTestAdmin(t, users)
+	now := time.Now()
+	auth.now = func() time.Time { return now }
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/api/login", strings.NewReader(`{"username": "ada", "password": "wrong"}`)))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("sign-in with a wrong password answered %d", w.Code)
+	}
+
+	read := func(cookie *http.Cookie) int {
+		r := httptest.NewRequest("GET", "/api/documents/users", nil)
+		r.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+	cookie := signIn(t, router, "ada", "pw")
+	if status := read(cookie); status != http.StatusOK {
+		t.Fatalf("read in a live session answered %d", status)
+	}
+	if status := read(&http.Cookie{Name: sessionCookie, Value: "forged"}); status != http.StatusUnauthorized {
+		t.Fatalf("read with an unknown session answered %d", status)
+	}
+	now = now.Add(time.Hour + time.Second)
+	if status := read(cookie); status != http.StatusUnauthorized {
+		t.Fatalf("read in an expired session answered %d", status)
+	}
+
+	cookie = signIn(t, router, "ada", "pw")
+	r := httptest.NewRequest("POST", "/api/logout", nil)
+	r.AddCookie(cookie)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if status := read(cookie); status != http.StatusUnauthorized {
+		t.Fatalf("read after signing out answered %d", status)
+	}
+}
+
+func TestWithoutAdminUsersEveryoneIsAllowed(t *testing.T) {
+	users, err := parseAdminUsers("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, onBehalfOf := newTestAdmin(t, users)
+
+	for _, r := range []*http.Request{
+		httptest.NewRequest("GET", "/api/documents/users", nil),
+		httptest.NewRequest("DELETE", "/api/documents/users/1", nil),
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s without sign-in answered %d", r.Method, r.URL.Path, w.Code)
+		}
+	}
+	if strings.Join(*onBehalfOf, ",") != "," {
+		t.Fatalf("anonymous requests were made for %v", *onBehalfOf)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/api/login", strings.NewReader(`{"username": "ada", "password": "pw"}`)))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("sign-in without users answered %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/session", nil))
+	if !strings.Contains(w.Body.String(), `"auth_enabled":false`) {
+		t.Fatalf("session = %s", w.Body)
+	}
+}
+
+func TestParseAdminUsers(t *testing.T) {
+	for spec, valid := range map[string]bool{
+		"ada:admin:pw":                true,
+		"ada:admin:p:w, bob:viewer:x": true,
+		"ada:root:pw":                 false,
+		"ada:admin":                   false,
+		":admin:pw":                   false,
+		"ada:admin:":                  false,
+	} {
+		if _, err := parseAdminUsers(spec); (err == nil) != valid {
+			t.Errorf("parsing %q: %v", spec, err)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// dashboardCollection is the engine collection holding the saved dashboards. The
+// leading _ marks it as not belonging to an application: the engine refuses such
+// names where collections are named, as in renames, but its document routes accept
+// them, so the name keeps dashboards apart by convention only.
+const dashboardCollection = "_webadmin.dashboards"
+
+// errDashboardNotFound is returned for dashboards that were never saved or deleted
+var errDashboardNotFound = errors.New("dashboard not found")
+
+// Dashboard is a saved set of panels, each charting the result of a document query
+type Dashboard struct {
+	ID          string           `json:"id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Panels      []DashboardPanel `json:"panels"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+// DashboardPanel charts the documents of Collection matching Query, written as the
+// query string of the engine's GET /docs/{collection}, e.g. status=open&_sort=-total.
+// Chart holds the chart configuration of the frontend, stored as given.
+type DashboardPanel struct {
+	Title      string                 `json:"title"`
+	Collection string                 `json:"collection"`
+	Query      string                 `json:"query"`
+	Chart      map[string]interface{} `json:"chart"`
+}
+
+// validate rejects dashboards the frontend could not render
+func (d *Dashboard) validate() error {
+	if strings.TrimSpace(d.Name) == "" {
+		return errors.New("dashboard name must not be empty")
+	}
+	for i, panel := range d.Panels {
+		if panel.Collection == "" {
+			return fmt.Errorf("panel %d has no collection", i+1)
+		}
+		if _, err := url.ParseQuery(panel.Query); err != nil {
+			return fmt.Errorf("panel %d has an invalid query: %v", i+1, err)
+		}
+	}
+	if d.Panels == nil {
+		d.Panels = []DashboardPanel{}
+	}
+	return nil
+}
+
+// newDashboardID returns a random id for a new dashboard
+func newDashboardID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// dashboardRequest makes a request to the primary node about dashboards, decoding
+// the data of the response into out. A 404 is errDashboardNotFound.
+func (c *DBClient) dashboardRequest(method, endpoint string, payload, out interface{}) error {
+	resp, status, err := c.requestNode(c.BaseURL, method, endpoint, payload)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotFound {
+		return errDashboardNotFound
+	}
+	if !resp.Success {
+		return fmt.Errorf("database engine answered %d: %s", status, resp.Error)
+	}
+	if out == nil || resp.Data == nil {
+		return nil
+	}
+	encoded, err := json.Marshal(resp.Data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, out)
+}
+
+func dashboardPath(id string) string {
+	return fmt.Sprintf("/docs/%s/%s", dashboardCollection, url.PathEscape(id))
+}
+
+// ListDashboards returns the saved dashboards by name
+func (c *DBClient) ListDashboards() ([]Dashboard, error) {
+	dashboards := []Dashboard{}
+	if err := c.dashboardRequest("GET", "/docs/"+dashboardCollection, nil, &dashboards); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(dashboards, func(i, j int) bool {
+		return strings.ToLower(dashboards[i].Name) < strings.ToLower(dashboards[j].Name)
+	})
+	return dashboards, nil
+}
+
+// GetDashboard returns the dashboard with id
+func (c *DBClient) GetDashboard(id string) (*Dashboard, error) {
+	var dashboard Dashboard
+	if err := c.dashboardRequest("GET", dashboardPath(id), nil, &dashboard); err != nil {
+		return nil, err
+	}
+	return &dashboard, nil
+}
+
+// CreateDashboard saves a new dashboard under a generated id
+func (c *DBClient) CreateDashboard(dashboard *Dashboard) error {
+	id, err := newDashboardID()
+	if err != nil {
+		return err
+	}
+	dashboard.ID = id
+	dashboard.CreatedAt = time.Now().UTC()
+	dashboard.UpdatedAt = dashboard.CreatedAt
+	return c.dashboardRequest("POST", dashboardPath(id), dashboard, nil)
+}
+
+// UpdateDashboard replaces the saved dashboard with the same id, keeping its
+// creation time
+func (c *DBClient) UpdateDashboard(dashboard *Dashboard) error {
+	saved, err := c.GetDashboard(dashboard.ID)
+	if err != nil {
+		return err
+	}
+	dashboard.CreatedAt = saved.CreatedAt
+	dashboard.UpdatedAt = time.Now().UTC()
+	// The engine sets the given fields, and every field of a dashboard is given
+	return c.dashboardRequest("PUT", dashboardPath(dashboard.ID), dashboard, nil)
+}
+
+// DeleteDashboard deletes the dashboard with id
+func (c *DBClient) DeleteDashboard(id string) error {
+	return c.dashboardRequest("DELETE", dashboardPath(id), nil, nil)
+}
+
+// dashboardError answers a failed dashboard request
+func dashboardError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, errDashboardNotFound) {
+		status = http.StatusNotFound
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func listDashboardsHandler(w http.ResponseWriter, r *http.Request) {
+	dashboards, err := engine(r).ListDashboards()
+	if err != nil {
+		dashboardError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(Response{Success: true, Data: dashboards})
+}
+
+func getDashboardHandler(w http.ResponseWriter, r *http.Request) {
+	dashboard, err := engine(r).GetDashboard(mux.Vars(r)["id"])
+	if err != nil {
+		dashboardError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(Response{Success: true, Data: dashboard})
+}
+
+func createDashboardHandler(w http.ResponseWriter, r *http.Request) {
+	var dashboard Dashboard
+	if err := json.NewDecoder(r.Body).Decode(&dashboard); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := dashboard.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := engine(r).CreateDashboard(&dashboard); err != nil {
+		dashboardError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(Response{Success: true, Message: "Dashboard created", Data: dashboard})
+}
+
+func updateDashboardHandler(w http.ResponseWriter, r *http.Request) {
+	var dashboard Dashboard
+	if err := json.NewDecoder(r.Body).Decode(&dashboard); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := dashboard.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dashboard.ID = mux.Vars(r)["id"]
+	if err := engine(r).UpdateDashboard(&dashboard); err != nil {
+		dashboardError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(Response{Success: true, Message: "Dashboard updated", Data: dashboard})
+}
+
+func deleteDashboardHandler(w http.ResponseWriter, r *http.Request) {
+	if err := engine(r).DeleteDashboard(mux.Vars(r)["id"]); err != nil {
+		dashboardError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(Response{Success: true, Message: "Dashboard deleted"})
+}
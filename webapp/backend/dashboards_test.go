@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestDashboardValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		dashboard Dashboard
+		valid     bool
+	}{
+		{"empty panels", Dashboard{Name: "Orders"}, true},
+		{"panel", Dashboard{Name: "Orders", Panels: []DashboardPanel{{Collection: "orders", Query: "status=open&_sort=-total"}}}, true},
+		{"no name", Dashboard{Name: "  "}, false},
+		{"panel without collection", Dashboard{Name: "Orders", Panels: []DashboardPanel{{Query: "status=open"}}}, false},
+		{"invalid query", Dashboard{Name: "Orders", Panels: []DashboardPanel{{Collection: "orders", Query: "status=%zz"}}}, false},
+	}
+	for _, tt := range tests {
+		err := tt.dashboard.validate()
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: validate = %v, want valid %v", tt.name, err, tt.valid)
+		}
+		if err == nil && tt.dashboard.Panels == nil {
+			t.Errorf("%s: panels left nil, which encodes as null", tt.name)
+		}
+	}
+}
+
+// documentEngine stubs the engine's document routes with the documents of one
+// collection: POST creates, PUT sets the given fields and both answer 404 or 409
+// as the engine does
+type documentEngine struct {
+	docs  map[string]map[string]interface{}
+	mutex sync.Mutex
+}
+
+func (e *documentEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	answer := func(status int, response Response) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(response)
+	}
+	prefix := "/docs/" + dashboardCollection
+	if r.URL.Path == prefix && r.Method == "GET" {
+		docs := []map[string]interface{}{}
+		for _, doc := range e.docs {
+			docs = append(docs, doc)
+		}
+		answer(http.StatusOK, Response{Success: true, Data: docs})
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, prefix+"/")
+	if id == r.URL.Path {
+		answer(http.StatusNotFound, Response{Error: "not found"})
+		return
+	}
+	doc, exists := e.docs[id]
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	switch {
+	case r.Method == "POST" && exists:
+		answer(http.StatusConflict, Response{Error: "document exists"})
+	case r.Method == "POST":
+		e.docs[id] = body
+		answer(http.StatusCreated, Response{Success: true})
+	case !exists:
+		answer(http.StatusNotFound, Response{Error: "document not found"})
+	case r.Method == "GET":
+		answer(http.StatusOK, Response{Success: true, Data: doc})
+	case r.Method == "PUT":
+		for field, value := range body {
+			doc[field] = value
+		}
+		answer(http.StatusOK, Response{Success: true})
+	case r.Method == "DELETE":
+		delete(e.docs, id)
+		answer(http.StatusOK, Response{Success: true})
+	}
+}
+
+func TestDashboardRoundTrip(t *testing.T) {
+	engineServer := httptest.NewServer(&documentEngine{docs: make(map[string]map[string]interface{})})
+	defer engineServer.Close()
+	previousAuth, previousClient := auth, dbClient
+	defer func() { auth, dbClient = previousAuth, previousClient }()
+	auth = newAuthenticator(nil, time.Hour)
+	dbClient = NewDBClient(engineServer.URL)
+	router := mux.NewRouter()
+	setupRoutes(router)
+
+	serve := func(method, path, body string, status int) Dashboard {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		if w.Code != status {
+			t.Fatalf("%s %s answered %d, want %d: %s", method, path, w.Code, status, w.Body)
+		}
+		var response struct {
+			Data Dashboard `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response.Data
+	}
+
+	serve("POST", "/api/dashboards", `{"name": ""}`, http.StatusBadRequest)
+	created := serve("POST", "/api/dashboards", `{"name": "Orders", "id": "chosen", "panels": [{"title": "Open", "collection": "orders", "query": "status=open", "chart": {"type": "bar"}}]}`, http.StatusCreated)
+	if created.ID == "" || created.ID == "chosen" || created.CreatedAt.IsZero() || !created.UpdatedAt.Equal(created.CreatedAt) {
+		t.Fatalf("created dashboard = %+v", created)
+	}
+	serve("POST", "/api/dashboards", `{"name": "alerts"}`, http.StatusCreated)
+
+	got := serve("GET", "/api/dashboards/"+created.ID, "", http.StatusOK)
+	if got.Name != "Orders" || len(got.Panels) != 1 || got.Panels[0].Chart["type"] != "bar" || !got.CreatedAt.Equal(created.CreatedAt) {
+		t.Fatalf("read dashboard = %+v", got)
+	}
+
+	// An update replaces everything but the id and the creation time
+	updated := serve("PUT", "/api/dashboards/"+created.ID, `{"name": "Open orders", "created_at": "2001-01-01T00:00:00Z"}`, http.StatusOK)
+	got = serve("GET", "/api/dashboards/"+created.ID, "", http.StatusOK)
+	if got.Name != "Open orders" || len(got.Panels) != 0 || !got.CreatedAt.Equal(created.CreatedAt) || !got.UpdatedAt.Equal(updated.UpdatedAt) || got.UpdatedAt.Before(created.UpdatedAt) {
+		t.Fatalf("updated dashboard = %+v", got)
+	}
+	serve("PUT", "/api/dashboards/missing", `{"name": "x"}`, http.StatusNotFound)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/dashboards", nil))
+	var list struct {
+		Data []Dashboard `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list.Data) != 2 || list.Data[0].Name != "alerts" || list.Data[1].Name != "Open orders" {
+		t.Fatalf("dashboards = %s", w.Body)
+	}
+
+	serve("DELETE", "/api/dashboards/"+created.ID, "", http.StatusOK)
+	serve("GET", "/api/dashboards/"+created.ID, "", http.StatusNotFound)
+	serve("DELETE", "/api/dashboards/"+created.ID, "", http.StatusNotFound)
+}
@@ -0,0 +1,514 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// importBatchSize is the number of documents sent per _insertMany request
+	importBatchSize = 500
+	// maxImportErrors bounds the failed records listed in an import report
+	maxImportErrors = 100
+	// importRetention is how long the progress of a finished import stays available
+	importRetention = time.Minute
+)
+
+// ImportProgress reports how far an import has gone. Bytes counts the file read so
+// far, which the browser divides by the size of the file it uploads.
+type ImportProgress struct {
+	ID         string        `json:"id,omitempty"`
+	Collection string        `json:"collection"`
+	Format     string        `json:"format"`
+	Bytes      int64         `json:"bytes"`
+	Records    int           `json:"records"` // read from the file
+	Inserted   int           `json:"inserted"`
+	Failed     int           `json:"failed"`
+	Errors     []ImportError `json:"errors,omitempty"` // the first maxImportErrors failures
+	Done       bool          `json:"done"`
+	Error      string        `json:"error,omitempty"` // why the import stopped before the end of the file
+}
+
+// ImportError is a record of the file that was not inserted
+type ImportError struct {
+	Record int    `json:"record"` // 1-based, counting the data rows of a CSV file
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error"`
+}
+
+// importJob is the progress of one import, which event streams wait on
+type importJob struct {
+	progress ImportProgress
+	started  bool
+	changed  chan struct{} // closed and replaced on every update
+	mutex    sync.Mutex
+}
+
+// update changes the progress with change and wakes the event streams
+func (j *importJob) update(change func(p *ImportProgress)) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	change(&j.progress)
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// watch returns the progress and a channel closed on its next update
+func (j *importJob) watch() (ImportProgress, <-chan struct{}) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	progress := j.progress
+	progress.Errors = append([]ImportError(nil), j.progress.Errors...)
+	return progress, j.changed
+}
+
+// importRegistry holds the imports by the id the browser gave them. A stream may
+// ask for an import before its upload arrives, so jobs are created by either.
+type importRegistry struct {
+	jobs  map[string]*importJob
+	mutex sync.Mutex
+}
+
+var imports = &importRegistry{jobs: make(map[string]*importJob)}
+
+// job returns the import with id, creating it
+func (r *importRegistry) job(id string) *importJob {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	job, exists := r.jobs[id]
+	if !exists {
+		job = &importJob{progress: ImportProgress{ID: id}, changed: make(chan struct{})}
+		r.jobs[id] = job
+	}
+	return job
+}
+
+// start marks the import with id as started, reporting false when it already was
+func (r *importRegistry) start(id string) (*importJob, bool) {
+	job := r.job(id)
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	if job.started {
+		return job, false
+	}
+	job.started = true
+	return job, true
+}
+
+// forget removes the import with id unless a stream waits for an upload yet to start
+func (r *importRegistry) forget(id string, job *importJob) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.jobs[id] == job {
+		delete(r.jobs, id)
+	}
+}
+
+// recordReader reads the documents of an uploaded file one record at a time,
+// returning io.EOF after the last. Errors of a single record are returned as
+// *recordError and reading goes on with the next record.
+type recordReader interface {
+	next() (Document, error)
+}
+
+type recordError struct {
+	err error
+}
+
+func (e *recordError) Error() string {
+	return e.err.Error()
+}
+
+// ndjsonReader reads one JSON object per line, skipping blank lines
+type ndjsonReader struct {
+	reader *bufio.Reader
+}
+
+func (r *ndjsonReader) next() (Document, error) {
+	for {
+		line, err := r.reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) == 0 {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		// Numbers are kept as written, rather than rounded to float64
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.UseNumber()
+		var record interface{}
+		if decodeErr := decoder.Decode(&record); decodeErr != nil {
+			return nil, &recordError{fmt.Errorf("invalid JSON: %v", decodeErr)}
+		}
+		doc, isObject := record.(map[string]interface{})
+		if !isObject {
+			return nil, &recordError{errors.New("a record must be a JSON object")}
+		}
+		return doc, nil
+	}
+}
+
+// csvReader reads one document per row, its fields named by the header row. Cells
+// are typed as the engine's CSV export writes them: true and false are booleans,
+// numbers are numbers, cells holding a JSON object or array are decoded, other cells
+// are strings and empty cells leave the field out. The _id column gives the ids.
+type csvReader struct {
+	reader *csv.Reader
+	header []string
+}
+
+func newCSVReader(r io.Reader) *csvReader {
+	reader := csv.NewReader(r)
+	reader.LazyQuotes = true
+	return &csvReader{reader: reader}
+}
+
+func (r *csvReader) next() (Document, error) {
+	if r.header == nil {
+		header, err := r.reader.Read()
+		if err == io.EOF {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV header: %v", err)
+		}
+		// Excel writes a byte order mark ahead of the first name
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+		r.header = header
+	}
+	row, err := r.reader.Read()
+	if errors.Is(err, csv.ErrFieldCount) {
+		return nil, &recordError{fmt.Errorf("expected %d fields, got %d", len(r.header), len(row))}
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc := make(Document, len(row))
+	for i, cell := range row {
+		if cell != "" {
+			doc[r.header[i]] = csvValue(cell)
+		}
+	}
+	return doc, nil
+}
+
+// csvValue types a CSV cell
+func csvValue(cell string) interface{} {
+	switch cell {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if strings.HasPrefix(cell, "{") || strings.HasPrefix(cell, "[") || strings.ContainsAny(cell[:1], "-0123456789") {
+		decoder := json.NewDecoder(strings.NewReader(cell))
+		decoder.UseNumber()
+		var value interface{}
+		if decoder.Decode(&value) == nil && !decoder.More() {
+			if _, isString := value.(string); !isString {
+				return value
+			}
+		}
+	}
+	return cell
+}
+
+// importFormat returns the format of an uploaded file: the format query parameter,
+// else the extension or content type of the file
+func importFormat(r *http.Request, part *multipartFile) (string, error) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		switch strings.ToLower(path.Ext(part.name)) {
+		case ".csv":
+			format = "csv"
+		case ".ndjson", ".jsonl":
+			format = "ndjson"
+		}
+	}
+	if format == "" {
+		switch {
+		case strings.HasPrefix(part.contentType, "text/csv"):
+			format = "csv"
+		case strings.HasPrefix(part.contentType, "application/x-ndjson"), strings.HasPrefix(part.contentType, "application/jsonl"):
+			format = "ndjson"
+		}
+	}
+	if format != "csv" && format != "ndjson" {
+		return "", fmt.Errorf("unknown import format %q, expected csv or ndjson", format)
+	}
+	return format, nil
+}
+
+// multipartFile is the file part of an upload, counting the bytes read from it
+type multipartFile struct {
+	reader      io.Reader
+	name        string
+	contentType string
+	bytes       int64
+}
+
+func (f *multipartFile) Read(p []byte) (int, error) {
+	n, err := f.reader.Read(p)
+	f.bytes += int64(n)
+	return n, err
+}
+
+// uploadedFile returns the part of the multipart request body named file, which
+// is read as it arrives rather than spooled to disk
+func uploadedFile(r *http.Request) (*multipartFile, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, errors.New("the upload has no file field")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return &multipartFile{reader: part, name: part.FileName(), contentType: part.Header.Get("Content-Type")}, nil
+		}
+	}
+}
+
+// importer sends the records of a file to the engine in batches
+type importer struct {
+	client     *DBClient
+	collection string
+	job        *importJob
+	file       *multipartFile
+	read       int // records read from the file
+	docs       []Document
+	records    []int           // the record number of each document of docs
+	ids        map[string]bool // the _id values given in docs
+}
+
+// run imports every record, returning the error that stopped it before the end
+func (im *importer) run(records recordReader) error {
+	for {
+		doc, err := records.next()
+		if err == io.EOF {
+			return im.flush()
+		}
+		var invalid *recordError
+		if err != nil && !errors.As(err, &invalid) {
+			return err
+		}
+		im.read++
+		record := im.read
+		if invalid != nil {
+			im.job.update(func(p *ImportProgress) {
+				p.Records = record
+				p.Bytes = im.file.bytes
+				p.fail(ImportError{Record: record, Error: invalid.Error()})
+			})
+			continue
+		}
+
+		// The engine rejects a batch holding an id twice, so the second record goes
+		// to the next batch, where it fails on its own as a taken id
+		id, _ := doc["_id"].(string)
+		if id != "" && im.ids[id] {
+			if err := im.flush(); err != nil {
+				return err
+			}
+		}
+		if id != "" {
+			if im.ids == nil {
+				im.ids = make(map[string]bool)
+			}
+			im.ids[id] = true
+		}
+		im.docs = append(im.docs, doc)
+		im.records = append(im.records, record)
+		if len(im.docs) < importBatchSize {
+			continue
+		}
+		if err := im.flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// flush inserts the buffered documents with one _insertMany request
+func (im *importer) flush() error {
+	if len(im.docs) == 0 {
+		return nil
+	}
+	docs, records := im.docs, im.records
+	im.docs, im.records, im.ids = nil, nil, nil
+
+	resp, err := im.client.makeRequest("POST", fmt.Sprintf("/docs/%s/_insertMany", url.PathEscape(im.collection)), map[string]interface{}{"documents": docs})
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Inserted int `json:"inserted"`
+		Errors   []struct {
+			Index int    `json:"index"`
+			ID    string `json:"id"`
+			Error string `json:"error"`
+		} `json:"errors"`
+	}
+	if resp.Data != nil {
+		encoded, _ := json.Marshal(resp.Data)
+		json.Unmarshal(encoded, &result)
+	}
+
+	im.job.update(func(p *ImportProgress) {
+		p.Records = records[len(records)-1]
+		p.Bytes = im.file.bytes
+		if !resp.Success && resp.Data == nil {
+			// The engine refused the whole batch
+			for _, record := range records {
+				p.fail(ImportError{Record: record, Error: resp.Error})
+			}
+			return
+		}
+		p.Inserted += result.Inserted
+		for _, failed := range result.Errors {
+			record := 0
+			if failed.Index >= 0 && failed.Index < len(records) {
+				record = records[failed.Index]
+			}
+			p.fail(ImportError{Record: record, ID: failed.ID, Error: failed.Error})
+		}
+	})
+	return nil
+}
+
+// fail counts a record that was not inserted
+func (p *ImportProgress) fail(err ImportError) {
+	p.Failed++
+	if len(p.Errors) < maxImportErrors {
+		p.Errors = append(p.Errors, err)
+	}
+}
+
+// importHandler imports an NDJSON or CSV file uploaded as the file field of a
+// multipart form into a collection, sending it to the engine in batches as it
+// arrives. With ?id= chosen by the browser, the progress is streamed by
+// importEventsHandler while the upload runs.
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	collection := mux.Vars(r)["collection"]
+	id := r.URL.Query().Get("id")
+
+	file, err := uploadedFile(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format, err := importFormat(r, file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job := &importJob{progress: ImportProgress{ID: id}, changed: make(chan struct{})}
+	if id != "" {
+		var started bool
+		if job, started = imports.start(id); !started {
+			http.Error(w, fmt.Sprintf("import %s was already started", id), http.StatusConflict)
+			return
+		}
+		defer time.AfterFunc(importRetention, func() { imports.forget(id, job) })
+	}
+	job.update(func(p *ImportProgress) {
+		p.Collection = collection
+		p.Format = format
+	})
+
+	var records recordReader = &ndjsonReader{reader: bufio.NewReader(file)}
+	if format == "csv" {
+		records = newCSVReader(file)
+	}
+	im := &importer{client: engine(r), collection: collection, job: job, file: file}
+	runErr := im.run(records)
+	job.update(func(p *ImportProgress) {
+		p.Records = im.read
+		p.Bytes = file.bytes
+		p.Done = true
+		if runErr != nil {
+			p.Error = runErr.Error()
+		}
+	})
+
+	progress, _ := job.watch()
+	response := Response{Success: runErr == nil && progress.Failed == 0, Data: progress}
+	switch {
+	case runErr != nil:
+		response.Error = fmt.Sprintf("import stopped after %d records: %v", progress.Records, runErr)
+	case progress.Failed > 0:
+		response.Message = fmt.Sprintf("%d of %d records imported", progress.Inserted, progress.Records)
+	default:
+		response.Message = fmt.Sprintf("%d records imported", progress.Inserted)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// importEventsHandler streams the progress of the import with id as server-sent
+// progress events, ending with a done event holding the report. The stream may be
+// opened before the upload starts.
+func importEventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	id := mux.Vars(r)["id"]
+	job := imports.job(id)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		progress, changed := job.watch()
+		if progress.Done {
+			writeImportEvent(w, "done", progress)
+			flusher.Flush()
+			return
+		}
+		if progress.Collection != "" {
+			progress.Errors = nil
+			writeImportEvent(w, "progress", progress)
+			flusher.Flush()
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			job.mutex.Lock()
+			started := job.started
+			job.mutex.Unlock()
+			if !started {
+				imports.forget(id, job)
+			}
+			return
+		}
+	}
+}
+
+func writeImportEvent(w io.Writer, event string, progress ImportProgress) {
+	data, _ := json.Marshal(progress)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
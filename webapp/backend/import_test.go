@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestCSVValueTypes(t *testing.T) {
+	tests := []struct {
+		cell string
+		want interface{}
+	}{
+		{"true", true},
+		{"false", false},
+		{"True", "True"},
+		{"42", json.Number("42")},
+		{"-3.5", json.Number("-3.5")},
+		{"1e3", json.Number("1e3")},
+		{"9007199254740993", json.Number("9007199254740993")},
+		{"007", "007"},
+		{"2024-01-05", "2024-01-05"},
+		{"12 apples", "12 apples"},
+		{"-", "-"},
+		{`{"a": 1}`, map[string]interface{}{"a": json.Number("1")}},
+		{`[1, "x"]`, []interface{}{json.Number("1"), "x"}},
+		{"[not json", "[not json"},
+		{`"quoted"`, `"quoted"`},
+		{"null", "null"},
+		{"oslo", "oslo"},
+	}
+	for _, tt := range tests {
+		if got := csvValue(tt.cell); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("csvValue(%q) = %#v, want %#v", tt.cell, got, tt.want)
+		}
+	}
+}
+
+// readRecords reads every record, listing the documents and the record errors
+func readRecords(t *testing.T, records recordReader) ([]Document, []string) {
+	t.Helper()
+	var docs []Document
+	var invalid []string
+	for {
+		doc, err := records.next()
+		if err == io.EOF {
+			return docs, invalid
+		}
+		if recordErr, ok := err.(*recordError); ok {
+			invalid = append(invalid, recordErr.Error())
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, doc)
+	}
+}
+
+func TestMalformedRecordsAreSkipped(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		file    string
+		docs    []Document
+		invalid []string
+	}{
+		{
+			name:   "ndjson",
+			format: "ndjson",
+			file:   "{\"_id\": \"1\"}\n\n{broken\n[1, 2]\n  \n{\"_id\": \"2\", \"n\": 12345678901234567890}",
+			docs:   []Document{{"_id": "1"}, {"_id": "2", "n": json.Number("12345678901234567890")}},
+			invalid: []string{
+				"invalid JSON: invalid character 'b' looking for beginning of object key string",
+				"a record must be a JSON object",
+			},
+		},
+		{
+			name:    "csv",
+			format:  "csv",
+			file:    "\ufeff_id,name,age\n1,ann,30\n2,bob\n3,,\n4,\"dee, jr\",41,extra\n",
+			docs:    []Document{{"_id": json.Number("1"), "name": "ann", "age": json.Number("30")}, {"_id": json.Number("3")}},
+			invalid: []string{"expected 3 fields, got 2", "expected 3 fields, got 4"},
+		},
+		{
+			name:   "csv header only",
+			format: "csv",
+			file:   "_id,name\n",
+		},
+		{
+			name:   "empty",
+			format: "ndjson",
+			file:   "",
+		},
+	}
+	for _, tt := range tests {
+		var records recordReader = &ndjsonReader{reader: bufio.NewReader(strings.NewReader(tt.file))}
+		if tt.format == "csv" {
+			records = newCSVReader(strings.NewReader(tt.file))
+		}
+		docs, invalid := readRecords(t, records)
+		if !reflect.DeepEqual(docs, tt.docs) || !reflect.DeepEqual(invalid, tt.invalid) {
+			t.Errorf("%s: read %v with errors %q, want %v with %q", tt.name, docs, invalid, tt.docs, tt.invalid)
+		}
+	}
+}
+
+// importEngine stubs the engine's _insertMany: documents named "bad" fail, and a
+// batch holding one named "refuse" is refused as a whole
+type importEngine struct {
+	batches  [][]Document
+	inserted map[string]bool
+	mutex    sync.Mutex
+}
+
+func (e *importEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Documents []Document `json:"documents"`
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.batches = append(e.batches, request.Documents)
+
+	type failure struct {
+		Index int    `json:"index"`
+		ID    string `json:"id,omitempty"`
+		Error string `json:"error"`
+	}
+	var failures []failure
+	for _, doc := range request.Documents {
+		if doc["name"] == "refuse" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{Error: "batch refused"})
+			return
+		}
+	}
+	inserted := 0
+	for i, doc := range request.Documents {
+		id, _ := doc["_id"].(string)
+		switch {
+		case doc["name"] == "bad":
+			failures = append(failures, failure{Index: i, ID: id, Error: "rejected"})
+		case id != "" && e.inserted[id]:
+			failures = append(failures, failure{Index: i, ID: id, Error: "document exists"})
+		default:
+			e.inserted[id] = true
+			inserted++
+		}
+	}
+	json.NewEncoder(w).Encode(Response{Success: len(failures) == 0, Data: map[string]interface{}{"inserted": inserted, "errors": failures}})
+}
+
+// newImportServer serves the web admin against a stub engine
+func newImportServer(t *testing.T) (*httptest.Server, *importEngine) {
+	t.Helper()
+	stub := &importEngine{inserted: make(map[string]bool)}
+	engineServer := httptest.NewServer(stub)
+	t.Cleanup(engineServer.Close)
+
+	previousAuth, previousClient := auth, dbClient
+	t.Cleanup(func() { auth, dbClient = previousAuth, previousClient })
+	auth = newAuthenticator(nil, time.Hour)
+	dbClient = NewDBClient(engineServer.URL)
+
+	router := mux.NewRouter()
+	setupRoutes(router)
+	admin := httptest.NewServer(router)
+	t.Cleanup(admin.Close)
+	return admin, stub
+}
+
+// upload posts file as the file field of a multipart form
+func upload(t *testing.T, url, name string, file io.Reader) ImportProgress {
+	t.Helper()
+	progress, err := postUpload(url, name, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return progress
+}
+
+func postUpload(url, name string, file io.Reader) (ImportProgress, error) {
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		part, err := form.CreateFormFile("file", name)
+		if err == nil {
+			_, err = io.Copy(part, file)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+	resp, err := http.Post(url, form.FormDataContentType(), body)
+	if err != nil {
+		return ImportProgress{}, err
+	}
+	defer resp.Body.Close()
+	var response struct {
+		Data ImportProgress `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return ImportProgress{}, fmt.Errorf("import answered %d: %v", resp.StatusCode, err)
+	}
+	return response.Data, nil
+}
+
+func TestImportReportsPartialBatchFailures(t *testing.T) {
+	admin, stub := newImportServer(t)
+
+	var file strings.Builder
+	for i := 1; i <= importBatchSize+2; i++ {
+		name := "ok"
+		switch i {
+		case 3, importBatchSize + 1:
+			name = "bad"
+		case 7:
+			file.WriteString("not json\n")
+		}
+		fmt.Fprintf(&file, "{\"_id\": \"%d\", \"name\": %q}\n", i, name)
+	}
+	// An id repeated within a batch starts the next one, where it fails on its own
+	fmt.Fprintf(&file, "{\"_id\": \"%d\", \"name\": \"again\"}\n", importBatchSize+2)
+
+	progress := upload(t, admin.URL+"/api/import/users", "users.ndjson", strings.NewReader(file.String()))
+	records := importBatchSize + 4
+	if !progress.Done || progress.Records != records || progress.Inserted != importBatchSize || progress.Failed != 4 {
+		t.Fatalf("progress = %+v", progress)
+	}
+	// Unreadable records are reported as they are read, others once their batch is sent
+	wantErrors := []ImportError{
+		{Record: 7, Error: "invalid JSON: invalid character 'o' in literal null (expecting 'u')"},
+		{Record: 3, ID: "3", Error: "rejected"},
+		{Record: importBatchSize + 2, ID: fmt.Sprint(importBatchSize + 1), Error: "rejected"},
+		{Record: records, ID: fmt.Sprint(importBatchSize + 2), Error: "document exists"},
+	}
+	if !reflect.DeepEqual(progress.Errors, wantErrors) {
+		t.Fatalf("errors = %+v", progress.Errors)
+	}
+	var sizes []int
+	for _, batch := range stub.batches {
+		sizes = append(sizes, len(batch))
+	}
+	if !reflect.DeepEqual(sizes, []int{importBatchSize, 2, 1}) {
+		t.Fatalf("batch sizes = %v", sizes)
+	}
+
+	// A batch the engine refuses fails all of its records, and the import goes on
+	progress = upload(t, admin.URL+"/api/import/users?format=csv", "users.txt", strings.NewReader("_id,name\nx1,refuse\nx2,ok\n"))
+	if progress.Inserted != 0 || progress.Failed != 2 || progress.Errors[1] != (ImportError{Record: 2, Error: "batch refused"}) {
+		t.Fatalf("refused batch progress = %+v", progress)
+	}
+
+	resp, err := http.Post(admin.URL+"/api/import/users", "text/plain", strings.NewReader("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("non-multipart upload answered %d", resp.StatusCode)
+	}
+}
+
+func TestImportEventStream(t *testing.T) {
+	admin, _ := newImportServer(t)
+	// Reports outlive the test, so each run takes an id of its own
+	id := fmt.Sprintf("up-%d", time.Now().UnixNano())
+
+	stream, err := http.Get(admin.URL + "/api/imports/" + id + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+	if stream.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("stream content type = %q", stream.Header.Get("Content-Type"))
+	}
+	events := bufio.NewReader(stream.Body)
+	nextEvent := func() (string, ImportProgress) {
+		t.Helper()
+		var event string
+		var progress ImportProgress
+		for {
+			line, err := events.ReadString('\n')
+			if err != nil {
+				t.Fatalf("stream ended: %v", err)
+			}
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimSpace(strings.TrimPrefix(line, "event: "))
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &progress); err != nil {
+					t.Fatal(err)
+				}
+			case line == "\n" && event != "":
+				return event, progress
+			}
+		}
+	}
+
+	// The upload is held open until the stream has reported it started
+	file, writer := io.Pipe()
+	done := make(chan ImportProgress, 1)
+	go func() {
+		report, err := postUpload(admin.URL+"/api/import/orders?id="+id, "orders.csv", file)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- report
+	}()
+	io.WriteString(writer, "_id,total\no1,10\n")
+	if event, progress := nextEvent(); event != "progress" || progress.Collection != "orders" || progress.Format != "csv" || progress.Done {
+		t.Fatalf("first event %s: %+v", event, progress)
+	}
+	io.WriteString(writer, "o2\no3,30\n")
+	writer.Close()
+
+	event, progress := nextEvent()
+	for event == "progress" {
+		event, progress = nextEvent()
+	}
+	if event != "done" || !progress.Done || progress.Inserted != 2 || progress.Failed != 1 || len(progress.Errors) != 1 {
+		t.Fatalf("last event %s: %+v", event, progress)
+	}
+	if report := <-done; !reflect.DeepEqual(report, progress) {
+		t.Fatalf("upload report %+v differs from the stream's %+v", report, progress)
+	}
+	if _, err := events.ReadByte(); err != io.EOF {
+		t.Fatalf("stream went on after the done event: %v", err)
+	}
+
+	// The id cannot be reused while the report is kept
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.CreateFormFile("file", "orders.csv")
+	form.Close()
+	resp, err := http.Post(admin.URL+"/api/import/orders?id="+id, form.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("second import with the same id answered %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Read consistency levels of DBClient
+const (
+	// ReadPrimary serves every read from the primary node
+	ReadPrimary = "primary"
+	// ReadNearest serves key-value reads from the nearest healthy node, which
+	// answers from a replica within MaxStaleness. Nodes that fail or have no
+	// fresh replica are skipped for the next nearest, and the primary is tried last.
+	ReadNearest = "nearest"
+)
+
+// latencyWeight is the weight of a new sample in a node's smoothed latency
+const latencyWeight = 0.3
+
+// NodeState is the measured round trip time and health of one engine node
+type NodeState struct {
+	URL       string        `json:"url"`
+	Latency   time.Duration `json:"-"`
+	LatencyMs float64       `json:"latency_ms"`
+	Healthy   bool          `json:"healthy"`
+	CheckedAt time.Time     `json:"checked_at"`
+	Primary   bool          `json:"primary,omitempty"`
+}
+
+// nodeHealth holds the measured state of each node
+type nodeHealth struct {
+	states map[string]*NodeState
+	mutex  sync.Mutex
+}
+
+// observe records the outcome of a request to node
+func (c *DBClient) observe(node string, rtt time.Duration, healthy bool) {
+	c.health.mutex.Lock()
+	defer c.health.mutex.Unlock()
+
+	state, exists := c.health.states[node]
+	if !exists {
+		state = &NodeState{URL: node, Latency: rtt}
+		c.health.states[node] = state
+	}
+	state.Healthy = healthy
+	state.CheckedAt = time.Now()
+	if healthy {
+		state.Latency = time.Duration(latencyWeight*float64(rtt) + (1-latencyWeight)*float64(state.Latency))
+	}
+}
+
+// NodeStates returns the measured nodes, nearest first
+func (c *DBClient) NodeStates() []NodeState {
+	c.health.mutex.Lock()
+	defer c.health.mutex.Unlock()
+
+	states := make([]NodeState, 0, len(c.Nodes))
+	for _, node := range c.Nodes {
+		state := NodeState{URL: node}
+		if measured, exists := c.health.states[node]; exists {
+			state = *measured
+		}
+		state.LatencyMs = float64(state.Latency) / float64(time.Millisecond)
+		state.Primary = node == c.BaseURL
+		states = append(states, state)
+	}
+	sort.SliceStable(states, func(i, j int) bool {
+		if states[i].Healthy != states[j].Healthy {
+			return states[i].Healthy
+		}
+		return states[i].Latency < states[j].Latency
+	})
+	return states
+}
+
+// ProbeNodes measures the round trip time of every node with a health check
+func (c *DBClient) ProbeNodes() {
+	var wg sync.WaitGroup
+	for _, node := range c.Nodes {
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			resp, status, err := c.requestNode(node, "GET", "/health", nil)
+			if err == nil && (status != http.StatusOK || !resp.Success) {
+				c.observe(node, 0, false)
+			}
+		}(node)
+	}
+	wg.Wait()
+}
+
+// StartProbing probes the nodes every interval in the background until ctx is done
+func (c *DBClient) StartProbing(ctx context.Context, interval time.Duration) {
+	c.ProbeNodes()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.ProbeNodes()
+			}
+		}
+	}()
+}
+
+// readNodes returns the nodes to try for a read in order: the healthy nodes nearest
+// first under ReadNearest, ending with the primary
+func (c *DBClient) readNodes() []string {
+	if c.ReadConsistency != ReadNearest {
+		return []string{c.BaseURL}
+	}
+	nodes := make([]string, 0, len(c.Nodes))
+	for _, state := range c.NodeStates() {
+		if state.Healthy && state.URL != c.BaseURL {
+			nodes = append(nodes, state.URL)
+		}
+	}
+	return append(nodes, c.BaseURL)
+}
+
+// read performs a key-value read on the nearest node able to answer it. Other nodes
+// than the primary are asked for a replica within MaxStaleness.
+func (c *DBClient) read(endpoint string) (*Response, error) {
+	var lastErr error
+	for _, node := range c.readNodes() {
+		path := endpoint
+		if node != c.BaseURL {
+			separator := "?"
+			if strings.Contains(path, "?") {
+				separator = "&"
+			}
+			path += separator + "maxStaleness=" + url.QueryEscape(c.MaxStaleness.String())
+		}
+
+		resp, status, err := c.requestNode(node, "GET", path, nil)
+		switch {
+		case err != nil:
+			lastErr = err
+		case status >= http.StatusInternalServerError:
+			// No replica within the bound, or the node is failing
+			lastErr = fmt.Errorf("%s answered %d: %s", node, status, resp.Error)
+		default:
+			return resp, nil
+		}
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testNode is an engine node answering health checks after delay and key-value
+// reads with status, recording the reads it receives
+type testNode struct {
+	*httptest.Server
+	delay  time.Duration
+	status int
+	probes int
+	reads  []string
+	mutex  sync.Mutex
+}
+
+func newTestNode(t *testing.T, delay time.Duration) *testNode {
+	node := &testNode{delay: delay, status: http.StatusOK}
+	node.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		node.mutex.Lock()
+		status := node.status
+		if r.URL.Path == "/health" {
+			node.probes++
+			status = http.StatusOK
+		} else {
+			node.reads = append(node.reads, r.URL.RequestURI())
+		}
+		node.mutex.Unlock()
+		if r.URL.Path == "/health" {
+			time.Sleep(node.delay)
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(Response{Success: status == http.StatusOK, Data: node.URL})
+	}))
+	t.Cleanup(node.Close)
+	return node
+}
+
+func (n *testNode) answer(status int) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.status = status
+}
+
+func (n *testNode) served() []string {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	reads := n.reads
+	n.reads = nil
+	return reads
+}
+
+func TestReadsGoToTheNearestHealthyNode(t *testing.T) {
+	primary, near, far := newTestNode(t, 0), newTestNode(t, 0), newTestNode(t, 40*time.Millisecond)
+	client := NewDBClient(primary.URL)
+	client.Nodes = []string{primary.URL, far.URL, near.URL}
+	client.ReadConsistency = ReadNearest
+	client.ProbeNodes()
+
+	if got, want := client.readNodes(), []string{near.URL, far.URL, primary.URL}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("read order = %v, want %v", got, want)
+	}
+	resp, err := client.GetKeyValue("k")
+	if err != nil || resp.Data != near.URL {
+		t.Fatalf("read = %+v, %v", resp, err)
+	}
+	if reads := near.served(); !reflect.DeepEqual(reads, []string{"/kv/k?maxStaleness=5s"}) {
+		t.Fatalf("near node served %v", reads)
+	}
+
+	// A node shedding load falls behind the others until a probe finds it healthy
+	near.answer(http.StatusServiceUnavailable)
+	if resp, err := client.GetKeyValue("k"); err != nil || resp.Data != far.URL {
+		t.Fatalf("read past an overloaded node = %+v, %v", resp, err)
+	}
+	if got, want := client.readNodes(), []string{far.URL, primary.URL}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("read order after a 503 = %v, want %v", got, want)
+	}
+
+	// Failing replicas fall back to the primary, asked without a staleness bound
+	far.answer(http.StatusInternalServerError)
+	if resp, err := client.GetKeyValue("k"); err != nil || resp.Data != primary.URL {
+		t.Fatalf("read falling back to the primary = %+v, %v", resp, err)
+	}
+	if reads := primary.served(); !reflect.DeepEqual(reads, []string{"/kv/k"}) {
+		t.Fatalf("primary served %v", reads)
+	}
+
+	near.answer(http.StatusOK)
+	client.ProbeNodes()
+	if got := client.readNodes(); got[0] != near.URL {
+		t.Fatalf("read order after a successful probe = %v", got)
+	}
+
+	// Under ReadPrimary only the primary serves reads
+	client.ReadConsistency = ReadPrimary
+	if got := client.readNodes(); !reflect.DeepEqual(got, []string{primary.URL}) {
+		t.Fatalf("read order under %s = %v", ReadPrimary, got)
+	}
+}
+
+func TestProbingStopsWithItsContext(t *testing.T) {
+	node := newTestNode(t, 0)
+	client := NewDBClient(node.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	client.StartProbing(ctx, time.Millisecond)
+
+	probes := func() int {
+		node.mutex.Lock()
+		defer node.mutex.Unlock()
+		return node.probes
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for probes() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	// A probe in flight when the context ends may still land
+	time.Sleep(20 * time.Millisecond)
+	stopped := probes()
+	time.Sleep(20 * time.Millisecond)
+	if stopped < 3 || probes() != stopped {
+		t.Fatalf("%d probes, then %d after stopping", stopped, probes())
+	}
+}
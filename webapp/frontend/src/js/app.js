@@ -187,7 +187,26 @@ class DatabaseAdminApp {
         }
     }
     
+    // Keep the cluster view current by reloading it on topology changes
+    subscribeClusterEvents() {
+        if (this.clusterEvents) return;
+        
+        this.clusterEvents = new EventSource(`${this.apiBaseUrl}/cluster/events`);
+        const reload = (event) => {
+            console.log('Cluster event:', event.type, event.data);
+            if (this.currentView === 'cluster') {
+                this.loadClusterData();
+            }
+        };
+        ['node_joined', 'node_left', 'node_down', 'node_up', 'failover', 'rebalance',
+         'partition_split', 'partition_map', 'repair_finished'].forEach(type => {
+            this.clusterEvents.addEventListener(type, reload);
+        });
+    }
+    
     async loadClusterData() {
+        this.subscribeClusterEvents();
+        
         try {
             const response = await fetch(`${this.apiBaseUrl}/cluster/status`);
             const result = await response.json();